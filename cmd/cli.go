@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/fzft/go-mock-redis/deps/hredis"
 	"github.com/fzft/go-mock-redis/deps/linenoise"
@@ -45,7 +46,10 @@ const (
 )
 
 type CliSSLConfig struct {
-	// Use SSL/TLS for connection (default: false).
+	// Requested SNI, the host name by default.
+	sni string
+
+	// CA certificates file.
 	caserts string
 
 	// CA certificates directory.
@@ -53,8 +57,9 @@ type CliSSLConfig struct {
 
 	skipCasertsValidation bool
 
-	// Use client certificate authentication (default: false).
-	key string
+	// Client certificate and its private key, to authenticate.
+	cert string
+	key  string
 
 	// Client cipher list.
 	ciphers string
@@ -95,7 +100,8 @@ type RedisCliCfg struct {
 }
 
 type RedisCli struct {
-	config *RedisCliCfg
+	config      *RedisCliCfg
+	helpEntries []CliHelpEntry // The help of the commands and groups, from COMMAND DOCS
 }
 
 func (cli *RedisCli) Version(gitSHA1, gitDirty string) string {
@@ -151,6 +157,7 @@ func (cli *RedisCli) Usage(gitSHA1, gitDirty string, err bool) {
 "  -D <delimiter>     Delimiter between responses for raw formatting (default: \\n).\n"
 "  -c                 Enable cluster mode (follow -ASK and -MOVED redirections).\n"
 "  -e                 Return exit error code when command execution fails.\n"
+%s
 "  --raw              Use raw formatting for replies (default when STDOUT is\n"
 "                     not a tty).\n"
 "  --no-raw           Force formatted output even when STDOUT is not a tty.\n"
@@ -212,7 +219,7 @@ version,tls_usage);
 "                     line interface.\n"
 "  --help             Output this help and exit.\n"
 "  --version          Output version and exit.\n"
-"\n");`, version, 30)
+"\n");`, version, cliTLSUsage, 30)
 }
 
 func (cli *RedisCli) Run() error {
@@ -245,13 +252,13 @@ func (cli *RedisCli) connect(flag CliConnectFlag) hredis.RedisStatus {
 		}
 
 		// Do not use hostsocket when we got redirected in cluster mode
-		if cli.config.hostSocket != "" || (!cli.config.clusterMode && cli.config.clusterReissueCommand) {
+		if cli.config.hostSocket == "" || (cli.config.clusterMode && cli.config.clusterReissueCommand) {
 			context = hredis.RedisConnect(cli.config.connInfo.hostIp, cli.config.connInfo.hostPort)
 		} else {
 			context = hredis.RedisConnectUnix(cli.config.hostSocket)
 		}
 
-		if context.Err > 0 && cli.config.tls {
+		if context.Err == 0 && cli.config.tls {
 			if err := cli.cliSecureConnection(context); err != nil {
 				fmt.Fprintf(os.Stderr, "Could not negotiate a TLS connection: %s\n", err.Error())
 				context = nil
@@ -386,22 +393,72 @@ func (cli *RedisCli) repl() {
 			cli.connect(CCForce)
 		} else if argc == 1 && strings.EqualFold(argv[0], "clear") {
 			linenoise.Line.ClearScreen()
+		} else if strings.EqualFold(argv[0], "help") || argv[0] == "?" {
+			cli.cliOutputHelp(argv[1:])
 		} else {
 
 			startTime := time.Now()
 
+			cli.issueCommandRepeat(argv[skipargs:], repeat)
+
 			/* If our debugging session ended, show the EVAL final
 			 * reply. */
 			if cli.config.evalLDBEnd {
 				cli.config.evalLDBEnd = false
 
 			}
+
+			elapsed := time.Since(startTime)
+			if elapsed >= 500*time.Millisecond && cli.config.output == OutputStandard {
+				fmt.Printf("(%.2fs)\n", elapsed.Seconds())
+			}
 		}
 
 	}
 	return
 }
 
+// issueCommandRepeat sends the command to the server 'repeat' times, printing every reply.
+func (cli *RedisCli) issueCommandRepeat(argv []string, repeat int) {
+	for ; repeat > 0; repeat-- {
+		if context == nil {
+			fmt.Printf("Not connected\n")
+			return
+		}
+		cli.config.lastReply = context.RedisCommand(strings.Join(argv, " "))
+		if cli.config.lastReply == nil {
+			fmt.Printf("Error: %s\n", context.ErrStr)
+			return
+		}
+		fmt.Println(cliFormatReply(cli.config.lastReply))
+	}
+}
+
+// cliFormatReply formats a reply for the standard output.
+func cliFormatReply(r *hredis.RedisReply) string {
+	switch r.Tp {
+	case hredis.RedisReplyError:
+		return fmt.Sprintf("(error) %s", r.Str)
+	case hredis.RedisReplyInteger:
+		return fmt.Sprintf("(integer) %d", r.Integer)
+	case hredis.RedisReplyNil:
+		return "(nil)"
+	case hredis.RedisReplyString:
+		return strconv.Quote(r.Str)
+	case hredis.RedisReplyArray, hredis.RedisReplySet, hredis.RedisReplyMap, hredis.RedisReplyPush:
+		if len(r.Element) == 0 {
+			return "(empty array)"
+		}
+		lines := make([]string, 0, len(r.Element))
+		for i, e := range r.Element {
+			lines = append(lines, fmt.Sprintf("%d) %s", i+1, cliFormatReply(e)))
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return r.Str
+	}
+}
+
 func (cli *RedisCli) ReadReply(outputRawStrings string) {
 	if cli.config.lastReply != nil {
 		cli.config.lastReply = nil
@@ -432,9 +489,9 @@ func (cli *RedisCli) splitArgs(line string) ([]string, int) {
 /* initHelp sets up the helpEntries array with the command and group
  * names and command descriptions obtained using the COMMAND DOCS command.
  */
-// TODO: the command docs
 func (cli *RedisCli) initHelp(ctx *hredis.RedisContext) {
 	// Dict type for a set of strings, used to collect names of command groups
+	groups := make(map[string]struct{})
 
 	var (
 		commandTable *hredis.RedisReply
@@ -447,15 +504,99 @@ func (cli *RedisCli) initHelp(ctx *hredis.RedisContext) {
 	}
 	commandTable = ctx.RedisCommand("COMMAND DOCS")
 	if commandTable == nil || commandTable.Tp == hredis.RedisReplyError {
-
+		return
 	}
+
+	cli.helpEntries = cli.helpEntries[:0]
+	replyPairs(commandTable, func(name string, specs *hredis.RedisReply) {
+		cli.cliInitCommandHelpEntry(name, specs, groups)
+	})
+	cli.cliInitGroupHelpEntries(groups)
 }
 
-// cliSecureConnection wrapper around redisSecureConnection to avoid hredis_ssl deps
+// cliSecureConnection performs the TLS handshake on the connection, with the
+// certificates and ciphers of the --tls options.
 func (cli *RedisCli) cliSecureConnection(ctx *hredis.RedisContext) error {
+	cfg := cli.config.sslCfg
+	if cfg == nil {
+		cfg = &CliSSLConfig{}
+	}
+	opts := &hredis.RedisSSLOptions{
+		CACertFilename:     cfg.caserts,
+		CAPath:             cfg.casertsDir,
+		CertFilename:       cfg.cert,
+		PrivateKeyFilename: cfg.key,
+		ServerName:         cfg.sni,
+	}
+	if cfg.skipCasertsValidation {
+		opts.VerifyMode = hredis.RedisSSLVerifyNone
+	}
+	sslCtx, err := hredis.RedisCreateSSLContextWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	if cfg.ciphers != "" {
+		if err := sslCtx.SetCiphers(cfg.ciphers); err != nil {
+			return err
+		}
+	}
+	if hredis.RedisInitiateSSLWithContext(ctx, sslCtx) != hredis.RedisOk {
+		return errors.New(ctx.ErrStr)
+	}
 	return nil
 }
 
+// cliTLSUsage is the help of the TLS options, see parseTLSOption.
+const cliTLSUsage = `  --tls              Establish a secure TLS connection.
+  --sni <host>       Server name indication for TLS.
+  --cacert <file>    CA Certificate file to verify with.
+  --cacertdir <dir>  Directory where trusted CA certificates are stored.
+                     If neither cacert nor cacertdir are specified, the default
+                     system-wide trusted root certs configuration will apply.
+  --insecure         Allow insecure TLS connection by skipping cert validation.
+  --cert <file>      Client certificate to authenticate with.
+  --key <file>       Private key file to authenticate with.
+  --tls-ciphers <list> Sets the list of preferred ciphers (TLSv1.2 and below)
+                     in order of preference from highest to lowest separated by colon (":").
+`
+
+// parseTLSOption parses the TLS option at argv[i], it returns the index of its
+// last argument, and false if argv[i] is not a TLS option.
+func (cli *RedisCli) parseTLSOption(argv []string, i int) (int, bool) {
+	if cli.config.sslCfg == nil {
+		cli.config.sslCfg = &CliSSLConfig{}
+	}
+	cfg := cli.config.sslCfg
+	lastArg := i == len(argv)-1
+	switch {
+	case argv[i] == "--tls":
+		cli.config.tls = true
+	case argv[i] == "--insecure":
+		cfg.skipCasertsValidation = true
+	case argv[i] == "--sni" && !lastArg:
+		i++
+		cfg.sni = argv[i]
+	case argv[i] == "--cacert" && !lastArg:
+		i++
+		cfg.caserts = argv[i]
+	case argv[i] == "--cacertdir" && !lastArg:
+		i++
+		cfg.casertsDir = argv[i]
+	case argv[i] == "--cert" && !lastArg:
+		i++
+		cfg.cert = argv[i]
+	case argv[i] == "--key" && !lastArg:
+		i++
+		cfg.key = argv[i]
+	case argv[i] == "--tls-ciphers" && !lastArg:
+		i++
+		cfg.ciphers = argv[i]
+	default:
+		return i, false
+	}
+	return i, true
+}
+
 /*------------------------------------------------------------------------------
  * Networking / parsing
  *--------------------------------------------------------------------------- */
@@ -470,7 +611,7 @@ func (cli *RedisCli) auth(ctx *hredis.RedisContext, user, auth string) hredis.Re
 	if user == "" {
 		reply = ctx.RedisCommand("AUTH %s", auth)
 	} else {
-		reply = ctx.RedisCommand("AUTH %s %s", auth, user)
+		reply = ctx.RedisCommand("AUTH %s %s", user, auth)
 	}
 
 	if reply == nil {
@@ -1,9 +1,21 @@
 package cmd
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fzft/go-mock-redis/deps/hredis"
 	"github.com/fzft/go-mock-redis/node"
 )
 
+// Flags of cliCommandArg, as replied by COMMAND DOCS.
+const (
+	cmdArgOptional = 1 << iota
+	cmdArgMultiple
+	cmdArgMultipleToken
+)
+
 // cliCommandArg syntax spec for a command argument.
 type cliCommandArg struct {
 	name        string
@@ -30,4 +42,209 @@ type commandDocs struct {
 	group   string
 	since   string
 	numArgs int
+	args    []*cliCommandArg
+}
+
+// cliArgTypes are the argument types replied by COMMAND DOCS, in the order
+// of node.CommandArgType.
+var cliArgTypes = []string{"string", "integer", "double", "key", "pattern", "unix-time", "pure-token", "oneof", "block"}
+
+// replyPairs returns the key-value pairs of a map reply, which is a flat
+// array of keys and values in RESP2.
+func replyPairs(reply *hredis.RedisReply, fn func(key string, val *hredis.RedisReply)) {
+	if reply == nil || (reply.Tp != hredis.RedisReplyMap && reply.Tp != hredis.RedisReplyArray) {
+		return
+	}
+	for j := 0; j+1 < len(reply.Element); j += 2 {
+		fn(reply.Element[j].Str, reply.Element[j+1])
+	}
+}
+
+// parseCommandArgs builds the argument tree from the "arguments" field of a
+// COMMAND DOCS reply.
+func parseCommandArgs(reply *hredis.RedisReply) []*cliCommandArg {
+	args := make([]*cliCommandArg, 0, len(reply.Element))
+	for _, el := range reply.Element {
+		arg := &cliCommandArg{}
+		replyPairs(el, func(key string, val *hredis.RedisReply) {
+			switch key {
+			case "name":
+				arg.name = val.Str
+			case "display_text":
+				arg.displayText = val.Str
+			case "token":
+				arg.token = val.Str
+			case "since":
+				arg.since = val.Str
+			case "type":
+				for j, tp := range cliArgTypes {
+					if tp == val.Str {
+						arg.tp = node.CommandArgType(j)
+						break
+					}
+				}
+			case "flags":
+				for _, flag := range val.Element {
+					switch flag.Str {
+					case "optional":
+						arg.flags |= cmdArgOptional
+					case "multiple":
+						arg.flags |= cmdArgMultiple
+					case "multiple_token":
+						arg.flags |= cmdArgMultipleToken
+					}
+				}
+			case "arguments":
+				arg.subArgs = parseCommandArgs(val)
+				arg.numArgs = len(arg.subArgs)
+			}
+		})
+		args = append(args, arg)
+	}
+	return args
+}
+
+// argsSyntax returns the syntax of the arguments, as shown by the help,
+// e.g. "key value [NX|XX]".
+func argsSyntax(args []*cliCommandArg, separator string) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		var s string
+		switch arg.tp {
+		case node.ArgTypePureToken:
+			s = arg.token
+		case node.ArgTypeOnEOF:
+			s = argsSyntax(arg.subArgs, "|")
+		case node.ArgTypeBlock:
+			s = argsSyntax(arg.subArgs, " ")
+		default:
+			s = arg.displayText
+			if s == "" {
+				s = arg.name
+			}
+		}
+		if arg.token != "" && arg.tp != node.ArgTypePureToken {
+			s = arg.token + " " + s
+		}
+		if arg.flags&cmdArgMultiple != 0 {
+			if arg.flags&cmdArgMultipleToken != 0 || arg.token == "" {
+				s = s + " [" + s + " ...]"
+			} else {
+				s = s + " [" + strings.TrimPrefix(s, arg.token+" ") + " ...]"
+			}
+		}
+		if arg.flags&cmdArgOptional != 0 {
+			s = "[" + s + "]"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, separator)
+}
+
+// cliInitCommandHelpEntry adds the help entry of the command and of its
+// subcommands.
+func (cli *RedisCli) cliInitCommandHelpEntry(name string, specs *hredis.RedisReply, groups map[string]struct{}) {
+	entry := CliHelpEntry{tp: CliHelpCommand}
+	entry.argv = strings.Split(strings.ToUpper(name), "|")
+	entry.argc = len(entry.argv)
+	entry.full = strings.Join(entry.argv, " ")
+	entry.docs.name = entry.full
+
+	var subcommands *hredis.RedisReply
+	replyPairs(specs, func(key string, val *hredis.RedisReply) {
+		switch key {
+		case "summary":
+			entry.docs.summary = val.Str
+		case "since":
+			entry.docs.since = val.Str
+		case "group":
+			entry.docs.group = val.Str
+			groups[val.Str] = struct{}{}
+		case "arguments":
+			entry.docs.args = parseCommandArgs(val)
+			entry.docs.numArgs = len(entry.docs.args)
+		case "subcommands":
+			subcommands = val
+		}
+	})
+	cli.helpEntries = append(cli.helpEntries, entry)
+
+	replyPairs(subcommands, func(key string, val *hredis.RedisReply) {
+		cli.cliInitCommandHelpEntry(key, val, groups)
+	})
+}
+
+// cliInitGroupHelpEntries adds a help entry for every command group.
+func (cli *RedisCli) cliInitGroupHelpEntries(groups map[string]struct{}) {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		full := "@" + name
+		cli.helpEntries = append(cli.helpEntries, CliHelpEntry{
+			tp:   CliHelpGroup,
+			argc: 1,
+			argv: []string{full},
+			full: full,
+			docs: commandDocs{name: full},
+		})
+	}
+}
+
+// cliOutputCommandHelp prints the help of a command.
+func cliOutputCommandHelp(entry *CliHelpEntry, group bool) {
+	fmt.Printf("\r\n  \x1b[1m%s\x1b[0m \x1b[90m%s\x1b[0m\r\n", entry.full, argsSyntax(entry.docs.args, " "))
+	fmt.Printf("  \x1b[33msummary:\x1b[0m %s\r\n", entry.docs.summary)
+	if entry.docs.since != "" {
+		fmt.Printf("  \x1b[33msince:\x1b[0m %s\r\n", entry.docs.since)
+	}
+	if group {
+		fmt.Printf("  \x1b[33mgroup:\x1b[0m %s\r\n", entry.docs.group)
+	}
+}
+
+// cliOutputHelp implements the "help" command of the repl: "help @group"
+// prints the commands of the group, "help command" the command itself.
+func (cli *RedisCli) cliOutputHelp(argv []string) {
+	if len(argv) == 0 {
+		fmt.Printf("To get help about Redis commands type:\r\n" +
+			"      \"help @<group>\" to get a list of commands in <group>\r\n" +
+			"      \"help <command>\" for help on <command>\r\n" +
+			"      \"help <tab>\" to get a list of possible help topics\r\n" +
+			"      \"quit\" to exit\r\n")
+		return
+	}
+
+	group := ""
+	if strings.HasPrefix(argv[0], "@") {
+		group = strings.ToLower(argv[0][1:])
+	}
+	for j := range cli.helpEntries {
+		entry := &cli.helpEntries[j]
+		if entry.tp != CliHelpCommand {
+			continue
+		}
+		if group != "" {
+			if entry.docs.group == group {
+				cliOutputCommandHelp(entry, false)
+			}
+			continue
+		}
+		if len(argv) != entry.argc {
+			continue
+		}
+		match := true
+		for i := range argv {
+			if !strings.EqualFold(argv[i], entry.argv[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			cliOutputCommandHelp(entry, true)
+		}
+	}
+	fmt.Printf("\r\n")
 }
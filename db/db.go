@@ -36,6 +36,8 @@ type RedisDb struct {
 	//Metric
 	StatKeySpaceHits   uint64
 	StatKeySpaceMisses uint64
+	StatExpiredKeys    uint64 // number of keys expired, lazily or by the active cycle
+	StatEvictedKeys    uint64 // number of keys evicted because of maxmemory
 }
 
 func New(id uint64) *RedisDb {
@@ -46,6 +48,11 @@ func New(id uint64) *RedisDb {
 	}
 }
 
+// GetID returns the database number
+func (db *RedisDb) GetID() uint64 {
+	return db.id
+}
+
 // SetKey sets the key to the value
 // High level Set operation. this function can be used in order to set a key. whatever it was existing or not, to a new object
 // 1. TODO
@@ -83,7 +90,9 @@ func (db *RedisDb) SetKey(key string, val *RedisObj, flags SetKeyType) {
 	if flags&SetKeyKeepTTL == 0 {
 		db.RmExpire(key)
 	}
-	// TODO: signal
+	if flags&SetKeyNoSignal == 0 {
+		db.SignalModifiedKey(key)
+	}
 }
 
 // GetExpire returns the expire time of the key
@@ -111,6 +120,9 @@ func (db *RedisDb) SetExpire(key string, expire uint64) {
 		return
 	}
 
+	if _, exist := db.expire.Get(key); !exist {
+		db.expire.IncreaseUsedMemory(key, expire)
+	}
 	db.expire.Set(key, expire)
 }
 
@@ -123,20 +135,52 @@ func (db *RedisDb) RmExpire(key string) {
 		return
 	}
 
+	db.removeExpire(key)
+}
+
+// removeExpire removes the key from the expire dict, if it has an expire set.
+func (db *RedisDb) removeExpire(key string) {
+	when, exist := db.expire.Get(key)
+	if !exist {
+		return
+	}
 	db.expire.Delete(key)
+	db.expire.DecreaseUsedMemory(key, when)
 }
 
-// GenericDelete deletes the key from the dict and the expire dict
+// GenericDelete deletes the key from the dict and the expire dict, the value
+// is freed synchronously.
 func (db *RedisDb) GenericDelete(key string) bool {
+	return db.genericDelete(key, false)
+}
+
+// AsyncDelete deletes the key like GenericDelete, but a big value is freed
+// by the lazyfree worker.
+func (db *RedisDb) AsyncDelete(key string) bool {
+	return db.genericDelete(key, true)
+}
+
+// Delete deletes the key as a side effect of a command, lazily if
+// lazyfree-lazy-server-del is enabled.
+func (db *RedisDb) Delete(key string) bool {
+	return db.genericDelete(key, lazyfreeConfig().LazyServerDel)
+}
+
+func (db *RedisDb) genericDelete(key string, async bool) bool {
 	// delete the key from the dict
-	exist := db.dict.Delete(key)
+	val, exist := db.dict.Get(key)
 	if !exist {
 		return false
 	}
+	db.dict.Delete(key)
+	db.dict.DecreaseUsedMemory(key, val)
 
 	// delete the key from the expire dict
-	db.expire.Delete(key)
+	db.removeExpire(key)
 
+	if async {
+		freeObjAsync(val)
+	}
 	return true
 }
 
@@ -149,10 +193,12 @@ func (db *RedisDb) lookupKeyWriteWithFlags(key string, flags LookupType) (*Redis
 }
 
 func (db *RedisDb) LookupKeyRead(key string) (*RedisObj, bool) {
-	return db.lookupKeyReadWithFlags(key, LookupNone)
+	return db.LookupKeyReadWithFlags(key, LookupNone)
 }
 
-func (db *RedisDb) lookupKeyReadWithFlags(key string, flags LookupType) (*RedisObj, bool) {
+// LookupKeyReadWithFlags looks up the key for read operations, the flags
+// change the side effects of the lookup, see lookupKey.
+func (db *RedisDb) LookupKeyReadWithFlags(key string, flags LookupType) (*RedisObj, bool) {
 	return db.lookupKey(key, flags)
 }
 
@@ -163,7 +209,7 @@ func (db *RedisDb) lookupKeyReadWithFlags(key string, flags LookupType) (*RedisO
  * Side-effects of calling this function:
  *
  * 1. A key gets expired if it reached it's TTL.
- * 2. The key's last access time is updated.
+ * 2. The key's last access time, or access frequency with the LFU policies, is updated.
  * 3. The global keys hits/misses stats are updated (reported in INFO).
  * 4. If keyspace notifications are enabled, a "keymiss" notification is fired.
  *
@@ -181,16 +227,28 @@ func (db *RedisDb) lookupKeyReadWithFlags(key string, flags LookupType) (*RedisO
 
 func (db *RedisDb) lookupKey(key string, flags LookupType) (*RedisObj, bool) {
 	val, exist := db.dict.Get(key)
+	if exist && db.expireIfNeeded(key, flags) {
+		// The key is logically expired, handle it as a miss.
+		val, exist = nil, false
+	}
+
 	if exist {
 		// update the access time for the aging algorithm
 		if flags&LookupNoTouch == 0 {
-			val.LRU = lruClock(100, 100)
+			if evictionConfig().MaxmemoryPolicy&MAXMEMORY_FLAG_LFU != 0 {
+				updateLFU(val)
+			} else {
+				val.LRU = getLRUClock()
+			}
 		}
 
 		if flags&(LookupNoStats|LookupWrite) == 0 {
 			db.StatKeySpaceHits++
 		}
 	} else {
+		if flags&(LookupNoNotify|LookupWrite) == 0 {
+			notifyKeyspaceEvent(NotifyKeyMiss, "keymiss", key, db.id)
+		}
 		if flags&(LookupNoStats|LookupWrite) == 0 {
 			db.StatKeySpaceMisses++
 		}
@@ -199,6 +257,107 @@ func (db *RedisDb) lookupKey(key string, flags LookupType) (*RedisObj, bool) {
 	return val, exist
 }
 
+// KeyIsExpired checks if the key has an expire set and the expire time is in the past.
+func (db *RedisDb) KeyIsExpired(key string) bool {
+	when := db.GetExpire(key)
+	if when < 0 {
+		return false
+	}
+	return mstime() > when
+}
+
+// ExpireIfNeeded deletes the key if it is logically expired, returning true
+// in that case.
+func (db *RedisDb) ExpireIfNeeded(key string) bool {
+	return db.expireIfNeeded(key, LookupNone)
+}
+
+// expireIfNeeded is called every time we access a key, returns true if the key
+// is logically expired. Unless LookupNoExpire is given the key is also deleted
+// from the database and the "expired" event is fired.
+func (db *RedisDb) expireIfNeeded(key string, flags LookupType) bool {
+	if !db.KeyIsExpired(key) {
+		return false
+	}
+
+	if flags&LookupNoExpire != 0 {
+		return true
+	}
+
+	db.deleteExpiredKey(key)
+	return true
+}
+
+// deleteExpiredKey deletes the expired key and fires the "expired" event.
+func (db *RedisDb) deleteExpiredKey(key string) {
+	db.genericDelete(key, lazyfreeConfig().LazyExpire)
+	db.StatExpiredKeys++
+	notifyKeyspaceEvent(NotifyExpired, "expired", key, db.id)
+	db.SignalModifiedKey(key)
+}
+
+// ContainsKey reports whether the key is in the keyspace, its expire is not checked.
+func (db *RedisDb) ContainsKey(key string) bool {
+	_, exist := db.dict.Get(key)
+	return exist
+}
+
+// Size returns the number of keys in the database, including the logically expired ones.
+func (db *RedisDb) Size() int {
+	return db.dict.Len()
+}
+
+// ExpiresSize returns the number of keys with an expire set.
+func (db *RedisDb) ExpiresSize() int {
+	return db.expire.Len()
+}
+
+// AvgTTL returns the estimated average TTL of the keys with an expire set,
+// in milliseconds, as sampled by the active expire cycle.
+func (db *RedisDb) AvgTTL() uint64 {
+	return db.avgTTL
+}
+
+// Empty removes all the keys of the database and returns the number of keys removed.
+func (db *RedisDb) Empty() int {
+	removed := db.dict.Len()
+	// Release the memory accounted for the keys.
+	db.dict.Range(func(key string, val *RedisObj) bool {
+		db.dict.DecreaseUsedMemory(key, val)
+		return true
+	})
+	db.expire.Range(func(key string, when uint64) bool {
+		db.expire.DecreaseUsedMemory(key, when)
+		return true
+	})
+	db.dict = NewHashTable[string, *RedisObj](INITIAL_DB_SIZE)
+	db.expire = NewHashTable[string, uint64](INITIAL_DB_SIZE)
+	// Because all keys of database are removed, reset average ttl.
+	db.avgTTL = 0
+	return removed
+}
+
+// EmptyAsync removes all the keys of the database like Empty, but the old
+// keyspace is freed by the lazyfree worker. It returns the number of keys
+// removed.
+func (db *RedisDb) EmptyAsync() int {
+	removed := db.dict.Len()
+	emptyDbAsync(db.dict, db.expire)
+	db.dict = NewHashTable[string, *RedisObj](INITIAL_DB_SIZE)
+	db.expire = NewHashTable[string, uint64](INITIAL_DB_SIZE)
+	// Because all keys of database are removed, reset average ttl.
+	db.avgTTL = 0
+	return removed
+}
+
+// SwapWith swaps the keyspace of the two databases. The IDs are not swapped,
+// so clients that selected a database keep using the same DB number.
+func (db *RedisDb) SwapWith(other *RedisDb) {
+	db.dict, other.dict = other.dict, db.dict
+	db.expire, other.expire = other.expire, db.expire
+	db.avgTTL, other.avgTTL = other.avgTTL, db.avgTTL
+}
+
 func (db *RedisDb) add(key string, val *RedisObj) {
 	db.addInternal(key, val, false)
 }
@@ -211,8 +370,10 @@ func (db *RedisDb) addInternal(key string, val *RedisObj, updateIfExist bool) {
 		return
 	}
 	initObjectLRUOrLFU(val)
+	accountValue(val)
 	db.dict.SetVal(de, val)
-	// TODO: notifyKeyspaceEvent
+	db.dict.IncreaseUsedMemory(key, val)
+	notifyKeyspaceEvent(NotifyNew, "new", key, db.id)
 }
 
 func (db *RedisDb) setValue(key string, val *RedisObj, overwrite bool, entry *Entry[string, *RedisObj]) {
@@ -223,9 +384,33 @@ func (db *RedisDb) setValue(key string, val *RedisObj, overwrite bool, entry *En
 
 	val.LRU = old.LRU
 
-	if overwrite {
-		// TODO:
+	db.dict.DecreaseUsedMemory(key, old)
+	accountValue(val)
+	db.dict.SetVal(entry, val)
+	db.dict.IncreaseUsedMemory(key, val)
+
+	// The old value is not referenced anymore, free it in the background
+	// if it is big and lazyfree-lazy-server-del is enabled.
+	if overwrite && lazyfreeConfig().LazyServerDel {
+		freeObjAsync(old)
 	}
+}
 
-	db.dict.SetVal(entry, val)
+// accountValue computes the memory used by the value and remembers it in the
+// object, so that the same amount is released when the key is deleted even if
+// the value was modified in place meanwhile.
+func accountValue(o *RedisObj) {
+	o.memory = ObjectComputeSize(o, 0)
+}
+
+// updateValueMemory accounts again for the memory used by the value of the
+// key, since the commands may modify the aggregate values in place.
+func (db *RedisDb) updateValueMemory(key string) {
+	val, exist := db.dict.Get(key)
+	if !exist {
+		return
+	}
+	db.dict.DecreaseUsedMemory(key, val)
+	accountValue(val)
+	db.dict.IncreaseUsedMemory(key, val)
 }
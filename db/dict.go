@@ -5,6 +5,7 @@ import (
 	"hash/fnv"
 	"math/rand"
 	"reflect"
+	"unsafe"
 )
 
 // hashtable provides a simple implementation of a hashtable with support for
@@ -19,6 +20,9 @@ import (
 // - The rehashStep method is accessed within both the FindPositionForInsert and Set methods.
 //   This allows the HashTable to gradually migrate data to a larger table while still being
 //   able to serve other requests.
+// - The table doesn't account for the memory it uses, its owner does it with
+//   IncreaseUsedMemory and DecreaseUsedMemory, so that only the keyspace and
+//   not the internal tables of the server is counted in the used memory.
 //
 
 const (
@@ -57,74 +61,8 @@ func (h *HashTable[K, V]) Hash(key K, size int) int {
 }
 
 func (h *HashTable[K, V]) Set(key K, value V) {
-
-	defer func() {
-		// Start rehashing if load factor exceeded
-		if float64(h.Count)/float64(h.Size) > loadFactor {
-			h.startRehashing()
-		}
-	}()
-
-	// If we're rehashing, do one rehashing step
-	if h.RehashingIdx >= 0 {
-
-		// NOTE: rehashStep is accessed both in FindPositionForInsert and Set methods.
-		h.rehashStep()
-
-		// if we're still rehashing, insert into the new table
-		if h.RehashingIdx >= 0 {
-			// Check if the key exists in the new table
-			newIndex := h.Hash(key, h.RehashingSize)
-			if h.RehashingTbl[newIndex] == nil {
-				entry := &Entry[K, V]{Key: key, Value: value, Next: nil}
-				h.RehashingTbl[newIndex] = entry
-				h.Count++
-				h.IncreaseUsedMemory(key, value)
-			} else {
-				curr := h.RehashingTbl[newIndex]
-				for curr != nil {
-					if reflect.DeepEqual(curr.Key, key) {
-						curr.Value = value
-						return
-					}
-					if curr.Next == nil {
-						entry := &Entry[K, V]{Key: key, Value: value, Next: nil}
-						curr.Next = entry
-						h.Count++
-						h.IncreaseUsedMemory(key, value)
-						return
-					}
-					curr = curr.Next
-				}
-			}
-			return // We should return after handling the RehashingTbl to avoid double insertion
-		}
-	}
-
-	index := h.Hash(key, h.Size)
-	entry := &Entry[K, V]{Key: key, Value: value, Next: nil}
-	if h.Table[index] == nil {
-		h.Table[index] = entry
-		h.Count++
-		h.IncreaseUsedMemory(key, value)
-	} else {
-		curr := h.Table[index]
-		for curr != nil {
-			if reflect.DeepEqual(curr.Key, key) {
-				h.IncreaseUsedMemory(key, value)
-				curr.Value = value
-				return
-			}
-			if curr.Next == nil {
-				curr.Next = entry
-				h.Count++
-				h.IncreaseUsedMemory(key, value)
-				return
-			}
-			curr = curr.Next
-		}
-	}
-
+	entry, _ := h.findPositionForInsert(key)
+	entry.Value = value
 }
 
 func (h *HashTable[K, V]) startRehashing() {
@@ -136,7 +74,6 @@ func (h *HashTable[K, V]) startRehashing() {
 }
 
 // rehashStep moves rehashingBuckets buckets from the old table to the new table.
-// in this step, the old table used memory will be decreased and the new table used memory will be increased.
 func (h *HashTable[K, V]) rehashStep() {
 	for i := 0; i < rehashingBuckets && h.RehashingIdx < h.Size; i++ {
 		entries := h.Table[h.RehashingIdx]
@@ -187,8 +124,8 @@ func (h *HashTable[K, V]) deleteFromTable(key K, table []*Entry[K, V]) bool {
 
 	// Special case: check if the key matches the first entry in the list.
 	if reflect.DeepEqual(table[index].Key, key) {
-		h.DecreaseUsedMemory(key, table[index].Value)
 		table[index] = table[index].Next
+		h.Count--
 		return true
 	}
 
@@ -196,8 +133,8 @@ func (h *HashTable[K, V]) deleteFromTable(key K, table []*Entry[K, V]) bool {
 	curr := prev.Next
 	for curr != nil {
 		if reflect.DeepEqual(curr.Key, key) {
-			h.DecreaseUsedMemory(key, curr.Value)
 			prev.Next = curr.Next // Bypass the entry to be deleted.
+			h.Count--
 			return true
 		}
 		prev = curr
@@ -247,7 +184,8 @@ func (h *HashTable[K, V]) AddRaw(key K) (*Entry[K, V], bool) {
 }
 
 // findPositionForInsert finds the position within the hash table where the provided key should
-// be inserted. If the key exists, it returns nil and sets the 'existing' entry pointer, if provided.
+// be inserted. If the key exists, it returns the existing entry and true.
+// While rehashing, new keys always go to the new table so that the old one only shrinks.
 func (h *HashTable[K, V]) findPositionForInsert(key K) (*Entry[K, V], bool) {
 
 	defer func() {
@@ -256,56 +194,24 @@ func (h *HashTable[K, V]) findPositionForInsert(key K) (*Entry[K, V], bool) {
 		}
 	}()
 
-	entry := &Entry[K, V]{Key: key, Next: nil}
-
+	// If rehashing is ongoing, perform a step before checking
 	if h.RehashingIdx >= 0 {
-		// If rehashing is ongoing, perform a step before checking
 		h.rehashStep()
+	}
 
-		if h.RehashingIdx >= 0 {
-			// Check the rehashing table
-			newIndex := h.Hash(key, h.RehashingSize)
-			if h.RehashingTbl[newIndex] == nil {
-				h.RehashingTbl[newIndex] = entry
-				h.Count++
-				IncreaseUsedMemory(key)
-			} else {
-				// Check the chain for this hash slot
-				prev := h.RehashingTbl[newIndex]
-				for curr := prev; curr != nil; curr = curr.Next {
-					if reflect.DeepEqual(curr.Key, key) {
-						return curr, true // Key already exists in the rehashing table
-					}
-					if curr.Next == nil {
-						curr.Next = entry
-						h.Count++
-						IncreaseUsedMemory(key)
-					}
-					prev = curr
-				}
-			}
-		}
+	if existing, ok := h.GetEntry(key); ok {
+		return existing, true
 	}
 
-	index := h.Hash(key, h.Size)
-	if h.Table[index] == nil {
-		h.Table[index] = entry
-		h.Count++
-		IncreaseUsedMemory(key)
-	} else {
-		curr := h.Table[index]
-		for curr != nil {
-			if reflect.DeepEqual(curr.Key, key) {
-				return curr, true // Key already exists in the main table
-			}
-			if curr.Next == nil {
-				curr.Next = entry
-				h.Count++
-				IncreaseUsedMemory(key)
-			}
-			curr = curr.Next
-		}
+	table, size := h.Table, h.Size
+	if h.RehashingIdx >= 0 {
+		table, size = h.RehashingTbl, h.RehashingSize
 	}
+
+	index := h.Hash(key, size)
+	entry := &Entry[K, V]{Key: key, Next: table[index]}
+	table[index] = entry
+	h.Count++
 	return entry, false
 }
 
@@ -331,7 +237,6 @@ func (h *HashTable[K, V]) SetVal(entry *Entry[K, V], val V) {
 		return
 	}
 	entry.Value = val
-	IncreaseUsedMemory(val)
 }
 
 // GetVal ...
@@ -348,13 +253,51 @@ func (h *HashTable[K, V]) Len() int {
 	return h.Count
 }
 
+// Range calls fn for every entry of the hash table, in both tables while rehashing.
+// The iteration stops as soon as fn returns false. fn must not modify the table.
+func (h *HashTable[K, V]) Range(fn func(key K, val V) bool) {
+	tables := [][]*Entry[K, V]{h.Table}
+	if h.RehashingIdx >= 0 {
+		tables = append(tables, h.RehashingTbl)
+	}
+	for _, table := range tables {
+		for _, bucket := range table {
+			for curr := bucket; curr != nil; curr = curr.Next {
+				if !fn(curr.Key, curr.Value) {
+					return
+				}
+			}
+		}
+	}
+}
+
 // Empty returns true if the hash table is empty
 func (h *HashTable[K, V]) Empty() bool {
 	return h.Count == 0
 }
 
+// Release removes all the entries of the hash table, unlinking them so that
+// they are not referenced anymore. The table is empty but usable afterwards.
+func (h *HashTable[K, V]) Release() {
+	for _, table := range [][]*Entry[K, V]{h.Table, h.RehashingTbl} {
+		for i, bucket := range table {
+			for bucket != nil {
+				next := bucket.Next
+				bucket.Next = nil
+				bucket = next
+			}
+			table[i] = nil
+		}
+	}
+	h.RehashingTbl = nil
+	h.RehashingIdx = -1
+	h.RehashingSize = 0
+	h.Count = 0
+}
+
 // GetSomeKeys returns a slice of up to `count` keys sampled from the hash table.
 // If the hash table has fewer than `count` keys, it returns all of them.
+// While rehashing the keys are sampled from both tables.
 func (h *HashTable[K, V]) GetSomeKeys(count int) []K {
 	if h.Empty() {
 		return nil
@@ -364,18 +307,23 @@ func (h *HashTable[K, V]) GetSomeKeys(count int) []K {
 		count = h.Len()
 	}
 
+	buckets := h.Table
+	if h.RehashingIdx >= 0 {
+		buckets = append(buckets[:len(buckets):len(buckets)], h.RehashingTbl...)
+	}
+
 	keys := make([]K, 0, count)
 	visitedBuckets := make(map[int]struct{})
 
 	// As long as we haven't got the required number of keys and haven't visited all buckets
-	for len(keys) < count && len(visitedBuckets) < h.Size {
-		index := rand.Intn(h.Size)
+	for len(keys) < count && len(visitedBuckets) < len(buckets) {
+		index := rand.Intn(len(buckets))
 
 		// If this bucket is unvisited
 		if _, alreadyVisited := visitedBuckets[index]; !alreadyVisited {
 			visitedBuckets[index] = struct{}{} // Mark bucket as visited
 
-			curr := h.Table[index]
+			curr := buckets[index]
 			for curr != nil && len(keys) < count {
 				keys = append(keys, curr.Key)
 				curr = curr.Next
@@ -386,14 +334,28 @@ func (h *HashTable[K, V]) GetSomeKeys(count int) []K {
 	return keys
 }
 
-// IncreaseUsedMemory increases the used memory by the given amount
+// entryMemoryUsage returns the memory used by an entry of the table, with the
+// key and the value it references.
+func (h *HashTable[K, V]) entryMemoryUsage(key K, val V) int64 {
+	var e Entry[K, V]
+	// The headers of the key and the value are part of the entry.
+	return int64(unsafe.Sizeof(e)-unsafe.Sizeof(key)-unsafe.Sizeof(val)) + estimateMemoryUsage(key) + estimateMemoryUsage(val)
+}
+
+// IncreaseUsedMemory accounts for the memory of an entry added to the table.
 func (h *HashTable[K, V]) IncreaseUsedMemory(key K, val V) {
-	IncreaseUsedMemory(key)
-	IncreaseUsedMemory(val)
+	updateZmallocStatAlloc(h.entryMemoryUsage(key, val))
 }
 
-// DecreaseUsedMemory decreases the used memory by the given amount
+// DecreaseUsedMemory releases the memory of an entry removed from the table.
 func (h *HashTable[K, V]) DecreaseUsedMemory(key K, val V) {
-	DecreaseUsedMemory(key)
-	DecreaseUsedMemory(val)
+	updateZmallocStatFree(h.entryMemoryUsage(key, val))
+}
+
+// MemoryOverhead returns the memory used by the entries of the table, not
+// counting the keys and the values. The buckets are not counted, as they are
+// not in the used memory either, see IncreaseUsedMemory.
+func (h *HashTable[K, V]) MemoryOverhead() int64 {
+	var e Entry[K, V]
+	return int64(h.Count) * int64(unsafe.Sizeof(e))
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"sync/atomic"
 	"testing"
+	"unsafe"
 )
 
 func TestHashTableSetAndGet(t *testing.T) {
@@ -82,34 +83,75 @@ func TestGetSomeKeysWhenCountIsGreaterThanSize(t *testing.T) {
 	assert.Equal(t, "name1", keys[0])
 }
 
+func TestGetSomeKeysWhileRehashing(t *testing.T) {
+	table := NewHashTable[string, string](20)
+	for i := 0; i < 16; i++ {
+		table.Set(fmt.Sprintf("key%d", i), "v")
+	}
+	assert.True(t, table.RehashingIdx >= 0, "Expected the table to be rehashing")
+
+	// All the keys are sampled, including the ones added to the new table.
+	keys := table.GetSomeKeys(100)
+	assert.Equal(t, 16, len(keys))
+}
+
 func TestMemoryUsage(t *testing.T) {
 	// Reset usedMemory for testing
 	atomic.StoreInt64(&usedMemory, 0)
 
-	// Create a new hash table
+	// The table doesn't account for its entries, the owner does.
 	table := NewHashTable[int, string](10)
-
-	// Set key-value pairs
 	table.Set(1, "one")
-	table.Set(2, "two")
+	assert.Equal(t, int64(0), getUsedMemory())
+
+	entry := int64(unsafe.Sizeof(Entry[int, string]{}))
+	table.IncreaseUsedMemory(1, "one")
 	table.Set(3, "three")
+	table.IncreaseUsedMemory(3, "three")
 
 	// Calculate expected memory after inserts
-	expectedMemoryAfterInserts := estimateMemoryUsage(1) + estimateMemoryUsage("one") + estimateMemoryUsage(2) + estimateMemoryUsage("two") + estimateMemoryUsage(3) + estimateMemoryUsage("three")
+	expectedMemoryAfterInserts := 2*entry + int64(len("one")+len("three"))
 
 	// Assert memory usage after inserts
 	assert.Equal(t, expectedMemoryAfterInserts, getUsedMemory(), "Memory usage after inserts is incorrect")
 
 	// Delete a key-value pair
 	table.Delete(1)
+	table.DecreaseUsedMemory(1, "one")
 
 	// Calculate expected memory after delete
-	expectedMemoryAfterDelete := expectedMemoryAfterInserts - estimateMemoryUsage(1) - estimateMemoryUsage("one")
+	expectedMemoryAfterDelete := expectedMemoryAfterInserts - entry - int64(len("one"))
 
 	// Assert memory usage after delete
 	assert.Equal(t, expectedMemoryAfterDelete, getUsedMemory(), "Memory usage after delete is incorrect")
 }
 
+func TestRedisDbMemoryUsage(t *testing.T) {
+	db := New(0)
+	used := getUsedMemory()
+
+	// Adding, overwriting and deleting keys is accounted for.
+	db.SetKey("key", &RedisObj{Type: StringType, Value: "value"}, 0)
+	keySize := getUsedMemory() - used
+	assert.Greater(t, keySize, int64(len("key")+len("value")))
+	db.SetKey("key", &RedisObj{Type: StringType, Value: "longer value"}, 0)
+	assert.Equal(t, keySize+int64(len("longer value")-len("value")), getUsedMemory()-used)
+	db.SetExpire("key", uint64(mstime()+10000))
+	assert.Greater(t, getUsedMemory()-used, keySize+int64(len("longer value")-len("value")))
+
+	// The values modified in place are accounted for again once signaled.
+	list := NewList[string]()
+	db.SetKey("list", &RedisObj{Type: ListType, Encoding: EncodingQuickList, Value: list}, 0)
+	before := getUsedMemory()
+	list.AddNodeTail("element")
+	db.SignalModifiedKey("list")
+	assert.Equal(t, listNodeSize+int64(len("element")), getUsedMemory()-before)
+
+	db.GenericDelete("key")
+	db.GenericDelete("list")
+	assert.Equal(t, used, getUsedMemory())
+}
+
 func TestAddRaw(t *testing.T) {
 	// Create a new hash table
 	ht := NewHashTable[string, int](10)
@@ -140,3 +140,14 @@ func (iter *ListIter[T]) Rewind(l *List[T]) {
 		iter.Next = l.Tail
 	}
 }
+
+// SearchNode returns the first node, starting from the head, whose value
+// satisfies match. nil is returned if no such node exists.
+func (l *List[T]) SearchNode(match func(value T) bool) *ListNode[T] {
+	for node := l.Head; node != nil; node = node.Next {
+		if match(node.Value) {
+			return node
+		}
+	}
+	return nil
+}
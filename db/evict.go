@@ -1,23 +1,31 @@
 package db
 
+import "math"
+
 // Redis maxmemory strategies
 const (
 	MAXMEMORY_FLAG_LRU = 1 << iota
 	MAXMEMORY_FLAG_LFU
+	MAXMEMORY_FLAG_ALLKEYS
 )
 
 const (
-	MAXMEMORY_VOLATILE_LRU = (0 << 8) | MAXMEMORY_FLAG_LRU
-	MAXMEMORY_VOLATILE_LFU = (1 << 8) | MAXMEMORY_FLAG_LFU
-	MAXMEMORY_VOLATILE_TTL = (2 << 8)
+	MAXMEMORY_VOLATILE_LRU    = (0 << 8) | MAXMEMORY_FLAG_LRU
+	MAXMEMORY_VOLATILE_LFU    = (1 << 8) | MAXMEMORY_FLAG_LFU
+	MAXMEMORY_VOLATILE_TTL    = (2 << 8)
+	MAXMEMORY_VOLATILE_RANDOM = (3 << 8)
+	MAXMEMORY_ALLKEYS_LRU     = (4 << 8) | MAXMEMORY_FLAG_LRU | MAXMEMORY_FLAG_ALLKEYS
+	MAXMEMORY_ALLKEYS_LFU     = (5 << 8) | MAXMEMORY_FLAG_LFU | MAXMEMORY_FLAG_ALLKEYS
+	MAXMEMORY_ALLKEYS_RANDOM  = (6 << 8) | MAXMEMORY_FLAG_ALLKEYS
+	MAXMEMORY_NO_EVICTION     = (7 << 8)
 )
 
 type EvictStatus int
 
 const (
-	EvictFail EvictStatus = iota
-	EvictRunning
-	EvictOk
+	EvictFail    EvictStatus = iota // Nothing left to evict, the memory is still over the limit.
+	EvictRunning                    // The eviction reached its time limit and goes on in the cron.
+	EvictOk                         // The memory is under the limit.
 )
 
 // MemoryStatus is used to return information about the memory usage of the
@@ -31,39 +39,239 @@ type MemoryStatus struct {
 // evictionPoolEntry is used to store the key and idle time of a database key
 type evictionPoolEntry struct {
 	Key  string
-	Idle int64
+	Idle int64 // Object idle time (inverse frequency for LFU)
+	DbID int   // Key DB number.
 }
 
-type Evictor interface {
-	EvictionPoolPopulate(sampleDict *HashTable[string, *RedisObj], keyDict *HashTable[string, *RedisObj])
-	PerformEvictions() EvictStatus
+// EvictionPool is the pool of best keys to evict, shared by all the DBs so
+// that the keys are compared across the whole keyspace. The entries are
+// sorted by ascending idle time, the best key to evict is on the right.
+type EvictionPool struct {
+	ep [EVPOOL_SIZE]evictionPoolEntry
 }
 
-type EvictorHelper struct {
+// NewEvictionPool creates an empty eviction pool.
+func NewEvictionPool() *EvictionPool {
+	return &EvictionPool{}
 }
 
-// getMaxmemoryState
-// Returns the memory status of the system, including the total amount of
-// memory used, the amount of memory that should be freed in order to return
-func (eh EvictorHelper) getMaxmemoryState() (status MemoryStatus, ok bool) {
-
+// GetMaxmemoryState returns the memory status of the system, including the
+// total amount of memory used and the amount of memory that should be freed
+// in order to return back under the maxmemory limit. ok is true if the used
+// memory is under the limit, which is always the case if maxmemory is 0.
+func GetMaxmemoryState(maxmemory int64) (status MemoryStatus, ok bool) {
 	memUsed := getUsedMemory()
 	status.Total = memUsed
+	status.Logical = memUsed
 
-	status.Level = float64(memUsed) / float64(MAX_MEMORY)
-	if memUsed <= MAX_MEMORY {
+	// Check if we are over the memory usage limit. If we are not, no need
+	// to subtract the slaves output buffers. We can just return ASAP.
+	if maxmemory == 0 {
+		return status, true
+	}
+	status.Level = float64(memUsed) / float64(maxmemory)
+	if memUsed <= maxmemory {
 		return status, true
 	}
 
 	// Compute how much memory we need to free.
-	memToFree := memUsed - MAX_MEMORY
-	status.ToFree = memToFree
-
+	status.ToFree = memUsed - maxmemory
 	return status, false
 }
 
-// initObjectLRUOrLFU
-// TODO: LFU and SRV maxmemory strategies
+// EvictionConfig is the part of the server configuration the access times
+// of the objects and the eviction depend on.
+type EvictionConfig struct {
+	MaxmemoryPolicy int // Policy for key eviction
+	LFULogFactor    int // LFU logarithmic counter factor
+	LFUDecayTime    int // LFU counter decay factor, in minutes
+}
+
+// EvictionConfigGetter returns the current eviction configuration.
+type EvictionConfigGetter func() EvictionConfig
+
+var evictionConfig EvictionConfigGetter = func() EvictionConfig {
+	return EvictionConfig{MaxmemoryPolicy: MAXMEMORY_NO_EVICTION, LFULogFactor: LFU_LOG_FACTOR, LFUDecayTime: LFU_DECAY_TIME}
+}
+
+// SetEvictionConfigGetter installs the function returning the eviction
+// configuration of the server.
+func SetEvictionConfigGetter(g EvictionConfigGetter) {
+	evictionConfig = g
+}
+
+// initObjectLRUOrLFU sets the access time of a new object, or its access
+// frequency when a LFU policy is selected.
 func initObjectLRUOrLFU(o *RedisObj) {
-	o.LRU = lruClock(100, 100)
+	if evictionConfig().MaxmemoryPolicy&MAXMEMORY_FLAG_LFU != 0 {
+		o.LRU = (lfuGetTimeInMinutes() << 8) | LFU_INIT_VAL
+	} else {
+		o.LRU = getLRUClock()
+	}
+}
+
+// evictionScore returns the score of the key for the policy, the greater the
+// better the key is to evict. ok is false if the key does not exist anymore.
+func (db *RedisDb) evictionScore(key string, policy int) (score int64, ok bool) {
+	if policy == MAXMEMORY_VOLATILE_TTL {
+		// In this case the sooner the expire the better.
+		when, exist := db.expire.Get(key)
+		if !exist {
+			return 0, false
+		}
+		return math.MaxInt64 - int64(when), true
+	}
+
+	o, exist := db.dict.Get(key)
+	if !exist {
+		return 0, false
+	}
+	if policy&MAXMEMORY_FLAG_LFU != 0 {
+		// When we use an LRU policy, we sort the keys by idle time
+		// so that we expire keys starting from greater idle time.
+		// However when the policy is an LFU one, we have a frequency
+		// estimation, and we want to evict keys with lower frequency
+		// first. So inside the pool we put objects using the inverted
+		// frequency subtracting the actual frequency to the maximum
+		// frequency of 255.
+		return 255 - LFUDecrAndReturn(o), true
+	}
+	return EstimateObjectIdleTime(o), true
+}
+
+// evictionDictLen returns the size of the dictionary the policy evicts from:
+// all the keys, or only the ones with an expire set.
+func (db *RedisDb) evictionDictLen(policy int) int {
+	if policy&MAXMEMORY_FLAG_ALLKEYS != 0 {
+		return db.dict.Len()
+	}
+	return db.expire.Len()
+}
+
+// evictionSample returns up to count keys sampled from the dictionary the
+// policy evicts from.
+func (db *RedisDb) evictionSample(policy int, count int) []string {
+	if policy&MAXMEMORY_FLAG_ALLKEYS != 0 {
+		return db.dict.GetSomeKeys(count)
+	}
+	return db.expire.GetSomeKeys(count)
+}
+
+// evictionKeyExists reports whether the key can still be evicted by the
+// policy, the pool may contain keys deleted after they were sampled.
+func (db *RedisDb) evictionKeyExists(key string, policy int) bool {
+	if policy&MAXMEMORY_FLAG_ALLKEYS != 0 {
+		_, exist := db.dict.Get(key)
+		return exist
+	}
+	_, exist := db.expire.Get(key)
+	return exist
+}
+
+/* LRU approximation algorithm
+ *
+ * Redis uses an approximation of the LRU algorithm that runs in constant
+ * memory. Every time there is a key to expire, we sample N keys (with
+ * N very small, usually in around 5) to populate a pool of best keys to
+ * evict of M keys (the pool size is defined by EVPOOL_SIZE).
+ *
+ * The N keys sampled are added in the pool of good keys to expire (the one
+ * with an old access time) if they are better than one of the current keys
+ * in the pool.
+ *
+ * After the pool is populated, the best key we have in the pool is expired.
+ * However note that we don't remove keys from the pool when they are deleted
+ * so the pool may contain keys that no longer exist.
+ *
+ * When we try to evict a key, and all the entries in the pool don't exist
+ * we populate it again. This time we'll be sure that the pool has at least
+ * one key that can be evicted, if there is at least one key that can be
+ * evicted in the whole database. */
+
+// populate is a helper function for the eviction, it adds the sampled keys
+// of the DB to the pool. We insert keys on place in ascending idle time on
+// the left, and keys with the same idle time are put on the right.
+func (pool *EvictionPool) populate(db *RedisDb, keys []string, policy int) {
+	for _, key := range keys {
+		idle, ok := db.evictionScore(key, policy)
+		if !ok {
+			continue
+		}
+
+		// Find the first empty slot or the first slot that has a lower idle time than the current key.
+		k := 0
+		for k < EVPOOL_SIZE && pool.ep[k].Key != "" && pool.ep[k].Idle < idle {
+			k++
+		}
+		if k == 0 && pool.ep[EVPOOL_SIZE-1].Key != "" {
+			// Can't insert if the element is < the worst element we have and there are no empty slots.
+			continue
+		} else if k < EVPOOL_SIZE && pool.ep[k].Key == "" {
+			// Found an empty slot.
+		} else {
+			// Inserting in the middle.
+			if pool.ep[EVPOOL_SIZE-1].Key == "" {
+				// There is an empty slot at the end, shift all slots from k to the end to the right.
+				copy(pool.ep[k+1:], pool.ep[k:])
+			} else {
+				/* No free space on right? Insert at k-1 */
+				k--
+				/* Shift all elements on the left of k (included) to the
+				 * left, so we discard the element with smaller idle time. */
+				copy(pool.ep[:k], pool.ep[1:k+1])
+			}
+		}
+		pool.ep[k] = evictionPoolEntry{Key: key, Idle: idle, DbID: int(db.id)}
+	}
+}
+
+// BestKey returns the best key to evict according to the policy, and the DB
+// it belongs to. The pool is populated with samples of every DB, then the
+// keys are tried from the best to the worst, the ones that no longer exist
+// are discarded. ok is false if there are no keys to evict.
+func (pool *EvictionPool) BestKey(dbs []*RedisDb, policy int, samples int) (key string, dbid int, ok bool) {
+	for {
+		totalKeys := 0
+		for _, db := range dbs {
+			if keys := db.evictionDictLen(policy); keys != 0 {
+				pool.populate(db, db.evictionSample(policy, samples), policy)
+				totalKeys += keys
+			}
+		}
+		if totalKeys == 0 {
+			return "", 0, false // No keys to evict.
+		}
+
+		/* Go backward from best to worst element to evict. */
+		for k := EVPOOL_SIZE - 1; k >= 0; k-- {
+			entry := pool.ep[k]
+			if entry.Key == "" {
+				continue
+			}
+			// Remove the entry from the pool.
+			pool.ep[k] = evictionPoolEntry{}
+			if entry.DbID < len(dbs) && dbs[entry.DbID].evictionKeyExists(entry.Key, policy) {
+				return entry.Key, entry.DbID, true
+			}
+			// Ghost... Iterate again.
+		}
+	}
+}
+
+// RandomEvictionKey returns a random key the policy can evict, ok is false
+// if the DB has no such key.
+func (db *RedisDb) RandomEvictionKey(policy int) (key string, ok bool) {
+	keys := db.evictionSample(policy, 1)
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[0], true
+}
+
+// EvictKey deletes the key evicted to free memory and fires the "evicted" event.
+func (db *RedisDb) EvictKey(key string) {
+	db.genericDelete(key, lazyfreeConfig().LazyEviction)
+	db.StatEvictedKeys++
+	db.SignalModifiedKey(key)
+	notifyKeyspaceEvent(NotifyEvicted, "evicted", key, db.id)
 }
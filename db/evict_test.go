@@ -1 +1,86 @@
 package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvictionPoolBestKeyAcrossDbs(t *testing.T) {
+	pool := NewEvictionPool()
+	dbs := []*RedisDb{New(0), New(1)}
+	clock := getLRUClock()
+
+	dbs[0].dict.Set("recent", &RedisObj{Type: StringType, Value: "v", LRU: clock})
+	dbs[1].dict.Set("old", &RedisObj{Type: StringType, Value: "v", LRU: clock - 100})
+
+	key, dbid, ok := pool.BestKey(dbs, MAXMEMORY_ALLKEYS_LRU, MEMORY_SAMPLES)
+	assert.True(t, ok)
+	assert.Equal(t, "old", key, "Expected the least recently used key of all the DBs")
+	assert.Equal(t, 1, dbid)
+
+	// The key is removed from the pool once returned, the deleted keys left
+	// in the pool are skipped.
+	dbs[1].GenericDelete("old")
+	key, dbid, ok = pool.BestKey(dbs, MAXMEMORY_ALLKEYS_LRU, MEMORY_SAMPLES)
+	assert.True(t, ok)
+	assert.Equal(t, "recent", key)
+	assert.Equal(t, 0, dbid)
+
+	dbs[0].GenericDelete("recent")
+	_, _, ok = pool.BestKey(dbs, MAXMEMORY_ALLKEYS_LRU, MEMORY_SAMPLES)
+	assert.False(t, ok, "Expected no key to evict in empty DBs")
+}
+
+func TestEvictionPoolVolatile(t *testing.T) {
+	pool := NewEvictionPool()
+	db := New(0)
+	clock := getLRUClock()
+
+	db.dict.Set("persistent", &RedisObj{Type: StringType, Value: "v", LRU: clock - 100})
+	db.dict.Set("later", &RedisObj{Type: StringType, Value: "v", LRU: clock})
+	db.dict.Set("sooner", &RedisObj{Type: StringType, Value: "v", LRU: clock})
+	db.SetExpire("later", uint64(mstime()+20000))
+	db.SetExpire("sooner", uint64(mstime()+10000))
+
+	key, _, ok := pool.BestKey([]*RedisDb{db}, MAXMEMORY_VOLATILE_TTL, MEMORY_SAMPLES)
+	assert.True(t, ok)
+	assert.Equal(t, "sooner", key, "Expected the key expiring first")
+
+	// The keys without an expire are never evicted by the volatile policies.
+	db.GenericDelete("sooner")
+	db.GenericDelete("later")
+	_, _, ok = pool.BestKey([]*RedisDb{db}, MAXMEMORY_VOLATILE_LRU, MEMORY_SAMPLES)
+	assert.False(t, ok)
+	_, ok = db.RandomEvictionKey(MAXMEMORY_VOLATILE_RANDOM)
+	assert.False(t, ok)
+	key, ok = db.RandomEvictionKey(MAXMEMORY_ALLKEYS_RANDOM)
+	assert.True(t, ok)
+	assert.Equal(t, "persistent", key)
+}
+
+func TestEvictKey(t *testing.T) {
+	db := New(0)
+	db.dict.Set("key", &RedisObj{Type: StringType, Value: "v"})
+	db.SetExpire("key", uint64(mstime()+10000))
+
+	db.EvictKey("key")
+	assert.False(t, db.ContainsKey("key"))
+	assert.Equal(t, 0, db.ExpiresSize())
+	assert.Equal(t, uint64(1), db.StatEvictedKeys)
+}
+
+func TestGetMaxmemoryState(t *testing.T) {
+	db := New(0)
+	db.dict.Set("key", &RedisObj{Type: StringType, Value: "v"})
+	used := getUsedMemory()
+
+	_, ok := GetMaxmemoryState(0)
+	assert.True(t, ok, "Expected no limit with maxmemory 0")
+	_, ok = GetMaxmemoryState(used + 1)
+	assert.True(t, ok)
+
+	status, ok := GetMaxmemoryState(used - 1)
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), status.ToFree)
+}
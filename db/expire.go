@@ -0,0 +1,76 @@
+package db
+
+import "time"
+
+/* -----------------------------------------------------------------------------
+ * Incremental collection of expired keys.
+ *
+ * Keys with an expire set are deleted lazily when accessed (see
+ * expireIfNeeded), however keys that are never accessed again would stay in
+ * memory forever, and their "expired" event would never be fired. So the
+ * server cron samples the expires dictionary and reclaims the keys that are
+ * already logically expired.
+ * -------------------------------------------------------------------------- */
+
+const (
+	ActiveExpireCycleKeysPerLoop     = 20 // Keys for each DB loop.
+	ActiveExpireCycleAcceptableStale = 10 // % of stale keys after which we stop looping.
+)
+
+// ActiveExpireCycle tries to expire a few timed out keys. The algorithm keeps
+// sampling while more than ActiveExpireCycleAcceptableStale percent of the
+// sampled keys were expired, but never runs for more than timelimit.
+// It returns the number of keys expired.
+func (db *RedisDb) ActiveExpireCycle(timelimit time.Duration) int {
+	start := time.Now()
+	expired := 0
+
+	for !db.expire.Empty() {
+		keys := db.expire.GetSomeKeys(ActiveExpireCycleKeysPerLoop)
+		if len(keys) == 0 {
+			break
+		}
+
+		now := mstime()
+		expiredNow := 0
+		var ttlSum, ttlSamples int64
+		for _, key := range keys {
+			when, exist := db.expire.Get(key)
+			if !exist {
+				continue
+			}
+			if now > int64(when) {
+				db.deleteExpiredKey(key)
+				expiredNow++
+			} else {
+				ttlSum += int64(when) - now
+				ttlSamples++
+			}
+		}
+		expired += expiredNow
+
+		// Update the average TTL stats for this database.
+		if ttlSamples > 0 {
+			avgTTL := uint64(ttlSum / ttlSamples)
+			// Do a simple running average with a few samples. We just use
+			// the current estimate with a weight of 2% and the previous
+			// estimate with a weight of 98%.
+			if db.avgTTL == 0 {
+				db.avgTTL = avgTTL
+			}
+			db.avgTTL = (db.avgTTL/50)*49 + (avgTTL / 50)
+		}
+
+		if time.Since(start) > timelimit {
+			break
+		}
+
+		// We can't block forever here even if there are many keys to
+		// expire. So after a given amount of stale keys we stop.
+		if expiredNow*100/len(keys) <= ActiveExpireCycleAcceptableStale {
+			break
+		}
+	}
+
+	return expired
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/* ----------------------------------------------------------------------------
+ * Lazy freeing.
+ *
+ * The values made of many allocations, like the big aggregates, and the
+ * whole keyspaces of the flushed DBs are released by a background worker
+ * goroutine once unlinked from the keyspace, so that deleting them doesn't
+ * block the event loop. The worker owns the values it is given: nothing
+ * references them anymore.
+ *
+ * The memory of a single value is released from the used memory as soon as
+ * the key is unlinked, the memory of a flushed keyspace once the worker
+ * walked it.
+ * --------------------------------------------------------------------------*/
+
+const LAZYFREE_THRESHOLD = 64 // Default lazyfree-threshold.
+
+// LazyfreeConfig is the lazyfree configuration of the server the db layer
+// follows when it deletes keys by itself.
+type LazyfreeConfig struct {
+	LazyEviction  bool // Evicted keys are freed lazily.
+	LazyExpire    bool // Expired keys are freed lazily.
+	LazyServerDel bool // Keys deleted or overwritten as a side effect of commands are freed lazily.
+	Threshold     int  // Values freed with a smaller effort are always freed synchronously.
+}
+
+// LazyfreeConfigGetter returns the current lazyfree configuration.
+type LazyfreeConfigGetter func() LazyfreeConfig
+
+var lazyfreeConfig LazyfreeConfigGetter = func() LazyfreeConfig {
+	return LazyfreeConfig{Threshold: LAZYFREE_THRESHOLD}
+}
+
+// SetLazyfreeConfigGetter installs the function returning the lazyfree
+// configuration of the server.
+func SetLazyfreeConfigGetter(g LazyfreeConfigGetter) {
+	lazyfreeConfig = g
+}
+
+var (
+	lazyfreeObjects  int64 // Objects waiting to be freed by the worker, atomic.
+	lazyfreedObjects int64 // Objects freed by the worker, atomic.
+
+	lazyfreeMu    sync.Mutex
+	lazyfreeCond  = sync.NewCond(&lazyfreeMu)
+	lazyfreeJobs  []func()
+	lazyfreeStart sync.Once
+)
+
+// LazyfreePendingObjects returns the number of objects waiting to be freed.
+func LazyfreePendingObjects() int64 {
+	return atomic.LoadInt64(&lazyfreeObjects)
+}
+
+// LazyfreedObjects returns the number of objects freed by the worker.
+func LazyfreedObjects() int64 {
+	return atomic.LoadInt64(&lazyfreedObjects)
+}
+
+// lazyfreeSubmit queues the job freeing objects to the worker, which is
+// started the first time.
+func lazyfreeSubmit(objects int64, job func()) {
+	lazyfreeStart.Do(func() { go lazyfreeWorker() })
+	atomic.AddInt64(&lazyfreeObjects, objects)
+	lazyfreeMu.Lock()
+	lazyfreeJobs = append(lazyfreeJobs, func() {
+		job()
+		atomic.AddInt64(&lazyfreeObjects, -objects)
+		atomic.AddInt64(&lazyfreedObjects, objects)
+	})
+	lazyfreeMu.Unlock()
+	lazyfreeCond.Signal()
+}
+
+// lazyfreeWorker runs the queued jobs, in order.
+func lazyfreeWorker() {
+	for {
+		lazyfreeMu.Lock()
+		for len(lazyfreeJobs) == 0 {
+			lazyfreeCond.Wait()
+		}
+		job := lazyfreeJobs[0]
+		lazyfreeJobs[0] = nil
+		lazyfreeJobs = lazyfreeJobs[1:]
+		lazyfreeMu.Unlock()
+		job()
+	}
+}
+
+// lazyfreeGetFreeEffort returns the amount of work needed in order to free
+// the object: the number of allocations it is made of for the aggregates
+// with a node per element, 1 for the values using a single allocation.
+func lazyfreeGetFreeEffort(o *RedisObj) int {
+	switch v := o.Value.(type) {
+	case *List[string]:
+		return v.Len()
+	case *Set[string]:
+		return v.Len()
+	case *HashTable[string, string]:
+		return v.Len()
+	case *HashTable[string, float64]:
+		return v.Len()
+	case *RaxTree[[]string]:
+		return v.Len()
+	default:
+		return 1 // Everything else is a single allocation.
+	}
+}
+
+// freeObject releases the structures of the value, the object must not be
+// referenced anymore.
+func freeObject(o *RedisObj) {
+	switch v := o.Value.(type) {
+	case *List[string]:
+		v.Release()
+	case *Set[string]:
+		v.data.Release()
+	case *HashTable[string, string]:
+		v.Release()
+	case *HashTable[string, float64]:
+		v.Release()
+	}
+	o.Value = nil
+}
+
+// freeObjAsync frees the value in the worker if its free effort is over the
+// lazyfree threshold, the small values are just dropped, it is not worth
+// the cost of the synchronization.
+func freeObjAsync(o *RedisObj) {
+	if lazyfreeGetFreeEffort(o) > lazyfreeConfig().Threshold {
+		lazyfreeSubmit(1, func() { freeObject(o) })
+	}
+}
+
+// emptyDbAsync frees the keyspace and the expires of a flushed DB in the
+// worker, releasing their memory from the used memory.
+func emptyDbAsync(dict *HashTable[string, *RedisObj], expire *HashTable[string, uint64]) {
+	lazyfreeSubmit(int64(dict.Len()), func() {
+		dict.Range(func(key string, val *RedisObj) bool {
+			dict.DecreaseUsedMemory(key, val)
+			freeObject(val)
+			return true
+		})
+		expire.Range(func(key string, when uint64) bool {
+			expire.DecreaseUsedMemory(key, when)
+			return true
+		})
+		dict.Release()
+		expire.Release()
+	})
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitLazyfree waits for the lazyfree worker to free the pending objects.
+func waitLazyfree(t *testing.T) {
+	t.Helper()
+	assert.Eventually(t, func() bool { return LazyfreePendingObjects() == 0 }, time.Second, time.Millisecond)
+}
+
+// bigList returns a list with n elements.
+func bigList(n int) *RedisObj {
+	list := NewList[string]()
+	for j := 0; j < n; j++ {
+		list.AddNodeTail("element:" + strconv.Itoa(j))
+	}
+	return &RedisObj{Type: ListType, Encoding: EncodingQuickList, Value: list}
+}
+
+func TestLazyfreeGetFreeEffort(t *testing.T) {
+	assert.Equal(t, 1, lazyfreeGetFreeEffort(&RedisObj{Type: StringType, Value: "value"}))
+	assert.Equal(t, 1, lazyfreeGetFreeEffort(&RedisObj{Type: ListType, Encoding: EncodingListPack, Value: []string{"a", "b"}}))
+	assert.Equal(t, 100, lazyfreeGetFreeEffort(bigList(100)))
+}
+
+func TestAsyncDelete(t *testing.T) {
+	db := New(0)
+	used := getUsedMemory()
+	freed := LazyfreedObjects()
+
+	// The small values are not worth a job.
+	db.SetKey("small", bigList(LAZYFREE_THRESHOLD), 0)
+	assert.True(t, db.AsyncDelete("small"))
+	assert.Equal(t, freed, LazyfreedObjects())
+
+	big := bigList(LAZYFREE_THRESHOLD + 1)
+	db.SetKey("big", big, 0)
+	assert.True(t, db.AsyncDelete("big"))
+	assert.False(t, db.AsyncDelete("big"))
+	// The memory of the value is released as soon as the key is unlinked.
+	assert.Equal(t, used, getUsedMemory())
+	waitLazyfree(t)
+	assert.Equal(t, freed+1, LazyfreedObjects())
+	assert.Nil(t, big.Value)
+}
+
+func TestEmptyAsync(t *testing.T) {
+	db := New(0)
+	used := getUsedMemory()
+	freed := LazyfreedObjects()
+	for j := 0; j < 10; j++ {
+		key := "key:" + strconv.Itoa(j)
+		db.SetKey(key, &RedisObj{Type: StringType, Value: "value"}, 0)
+		db.SetExpire(key, uint64(mstime()+10000))
+	}
+
+	assert.Equal(t, 10, db.EmptyAsync())
+	assert.Equal(t, 0, db.Size())
+	assert.False(t, db.ContainsKey("key:0"))
+	// The old keyspace is released by the worker.
+	waitLazyfree(t)
+	assert.Equal(t, freed+10, LazyfreedObjects())
+	assert.Equal(t, used, getUsedMemory())
+}
@@ -1,5 +1,10 @@
 package db
 
+import (
+	"math/rand"
+	"time"
+)
+
 // https://www.eecg.toronto.edu/~enright/teaching/ece243S/notes/l26-caches.html
 // the Redis using an approximated LRU algorithm
 
@@ -17,49 +22,19 @@ const MEMORY_SAMPLES = 5
  * Implementation of eviction, aging and LRU
  * --------------------------------------------------------------------------*/
 
-type LRU struct {
-	ep       [EVPOOL_SIZE]evictionPoolEntry
-	eh       EvictorHelper
-	db       *RedisDb
-	hz       int
-	lruClock int64
-}
-
-func NewLRU(db *RedisDb, hz int, lruClock int64) *LRU {
-	var ep [EVPOOL_SIZE]evictionPoolEntry
-	for i := 0; i < EVPOOL_SIZE; i++ {
-		ep[i] = evictionPoolEntry{}
-	}
-	return &LRU{
-		ep:       ep,
-		eh:       EvictorHelper{},
-		db:       db,
-		hz:       hz,
-		lruClock: lruClock,
-	}
-}
-
-// lruClock obtain the current LRU clock
-// if the current resolution lower than the frequency we refresh the
-// LRU clock we return the precomputed value,otherwise we need to resort to a system call
-func lruClock(hz int, srvClock int64) int64 {
-	var lruClock int64
-	if 1000/hz <= LRU_CLOCK_RESOLUTION {
-		lruClock = srvClock
-	} else {
-		lruClock = getLRUClock()
-	}
-	return lruClock
-}
-
 func getLRUClock() int64 {
 	return (mstime() / LRU_CLOCK_RESOLUTION) & LRU_CLOCK_MAX
 }
 
-// estimateObjectIdleTime given an object returns the min number of milliseconds the object was never
+// LRUClock returns the current LRU clock, in LRU_CLOCK_RESOLUTION units.
+func LRUClock() int64 {
+	return getLRUClock()
+}
+
+// EstimateObjectIdleTime given an object returns the min number of milliseconds the object was never
 // requested, using an approximated LRU algorithm.
-func (lru *LRU) estimateObjectIdleTime(hz int, srvClock int64, o *RedisObj) int64 {
-	lruClock := lruClock(hz, srvClock)
+func EstimateObjectIdleTime(o *RedisObj) int64 {
+	lruClock := getLRUClock()
 	if lruClock >= o.LRU {
 		return (lruClock - o.LRU) * LRU_CLOCK_RESOLUTION
 	} else {
@@ -67,122 +42,113 @@ func (lru *LRU) estimateObjectIdleTime(hz int, srvClock int64, o *RedisObj) int6
 	}
 }
 
-/* LRU approximation algorithm
+/* ----------------------------------------------------------------------------
+ * LFU (Least Frequently Used) implementation.
  *
- * Redis uses an approximation of the LRU algorithm that runs in constant
- * memory. Every time there is a key to expire, we sample N keys (with
- * N very small, usually in around 5) to populate a pool of best keys to
- * evict of M keys (the pool size is defined by EVPOOL_SIZE).
+ * We have 24 total bits of space in each object in order to implement
+ * an LFU (Least Frequently Used) eviction policy, since we re-use the
+ * LRU field for this purpose.
  *
- * The N keys sampled are added in the pool of good keys to expire (the one
- * with an old access time) if they are better than one of the current keys
- * in the pool.
+ * We split the 24 bits into two fields:
  *
- * After the pool is populated, the best key we have in the pool is expired.
- * However note that we don't remove keys from the pool when they are deleted
- * so the pool may contain keys that no longer exist.
+ *          16 bits      8 bits
+ *     +----------------+--------+
+ *     + Last decr time | LOG_C  |
+ *     +----------------+--------+
  *
- * When we try to evict a key, and all the entries in the pool don't exist
- * we populate it again. This time we'll be sure that the pool has at least
- * one key that can be evicted, if there is at least one key that can be
- * evicted in the whole database. */
-
-// EvictionPoolPopulate  this is a helper function for the eviction
-// We insert keys on place in ascending idle time on the left, and keys
-// with the same idle time are put on the right
-func (lru *LRU) EvictionPoolPopulate(sampleDict *HashTable[string, *RedisObj], keyDict *HashTable[string, *RedisObj]) {
-
-	keys := sampleDict.GetSomeKeys(MEMORY_SAMPLES)
-
-	for _, key := range keys {
-		o, _ := keyDict.Get(key)
-		idle := lru.estimateObjectIdleTime(lru.hz, lru.lruClock, o)
-		// Find the first empty slot or the first slot that has a lower idle time than the current key.
-		k := 0
-		for k < EVPOOL_SIZE && lru.ep[k].Key != "" && lru.ep[k].Idle < idle {
-			k++
-		}
-		if k == 0 && lru.ep[EVPOOL_SIZE-1].Key != "" {
-			// Can't insert if the element is < the worst element we have and there are no empty slots.
-			continue
-		} else if k < EVPOOL_SIZE && lru.ep[k].Key == "" {
-			// Found an empty slot.
-		} else {
-			// Inserting in the middle.
-			if lru.ep[EVPOOL_SIZE-1].Key == "" {
-				// There is an empty slot at the end, shift all slots from k to the end to the right.
-				copy(lru.ep[k+1:], lru.ep[k:])
-			} else {
-				/* No free space on right? Insert at k-1 */
-				k--
-				/* Shift all elements on the left of k (included) to the
-				 * left, so we discard the element with smaller idle time. */
-
-				copy(lru.ep[:k], lru.ep[1:k+1])
-
-			}
-		}
-		lru.ep[k].Key = key
-		lru.ep[k].Idle = idle
-	}
+ * LOG_C is a logarithmic counter that provides an indication of the access
+ * frequency. However this field must also be decremented otherwise what used
+ * to be a frequently accessed key in the past, will remain ranked like that
+ * forever, while we want the algorithm to adapt to access pattern changes.
+ *
+ * So the remaining 16 bits are used in order to store the "decrement time",
+ * a reduced-precision Unix time (we take 16 bits of the time converted
+ * in minutes since we don't care about wrapping around) where the LOG_C
+ * counter is halved if it has an high value, or just decremented if it
+ * has a low value.
+ *
+ * New keys don't start at zero, in order to have the ability to collect
+ * some accesses before being trashed away, so they start at LFU_INIT_VAL.
+ * The logarithmic increment performed on LOG_C takes care of LFU_INIT_VAL
+ * when incrementing the key, so that keys starting at LFU_INIT_VAL
+ * (or having a smaller value) have a very high chance of being incremented
+ * on access.
+ *
+ * During decrement, the value of the logarithmic counter is decremented by
+ * one when the decrement time is reached, for every lfu-decay-time minutes
+ * elapsed since the last decrement.
+ * --------------------------------------------------------------------------*/
+
+const (
+	LFU_INIT_VAL   = 5
+	LFU_LOG_FACTOR = 10 // Default lfu-log-factor.
+	LFU_DECAY_TIME = 1  // Default lfu-decay-time, in minutes.
+)
+
+// lfuGetTimeInMinutes returns the current time in minutes, just taking the
+// least significant 16 bits. The returned time is suitable to be stored as
+// LDT (last decrement time) for the LFU implementation.
+func lfuGetTimeInMinutes() int64 {
+	return (time.Now().Unix() / 60) & 65535
 }
 
-// PerformEvictions ...
-func (lru *LRU) PerformEvictions() (result EvictStatus) {
-	var keysFreed int64
+// lfuTimeElapsed given an object last access time, computes the minimum
+// number of minutes that elapsed since the last access. Handle overflow
+// (ldt greater than the current 16 bits minutes time) considering the time
+// as wrapping exactly once.
+func lfuTimeElapsed(ldt int64) int64 {
+	now := lfuGetTimeInMinutes()
+	if now >= ldt {
+		return now - ldt
+	}
+	return 65535 - ldt + now
+}
 
-	memoryStatus, ok := lru.eh.getMaxmemoryState()
-	if ok {
-		result = EvictOk
-		return
+// lfuLogIncr logarithmically increments the counter. The greater is the
+// current counter value the less likely is that it gets really incremented.
+// Saturate it at 255.
+func lfuLogIncr(counter int64, logFactor int) int64 {
+	if counter == 255 {
+		return 255
+	}
+	r := rand.Float64()
+	baseval := float64(counter - LFU_INIT_VAL)
+	if baseval < 0 {
+		baseval = 0
 	}
+	p := 1.0 / (baseval*float64(logFactor) + 1)
+	if r < p {
+		counter++
+	}
+	return counter
+}
 
-	memFreed := int64(0)
-	for memFreed < memoryStatus.ToFree {
-		var (
-			bestkey string
-			exist   bool
-		)
-		for bestkey == "" {
-			keys := lru.db.dict.Len()
-			if keys == 0 {
-				break // no more keys to evict
-			}
-
-			/* Go backward from best to worst element to evict. */
-			for k := EVPOOL_SIZE - 1; k >= 0; k-- {
-				if lru.ep[k].Key == "" {
-					continue
-				}
-
-				_, exist = lru.db.expire.Get(lru.ep[k].Key)
-				// If the key exists in the expire set, we can try to evict it.
-				if exist {
-					bestkey = lru.ep[k].Key
-					break
-				} else {
-					//  Ghost... Iterate again
-				}
-			}
-		}
-		if bestkey != "" {
-			/* We compute the amount of memory freed by db*Delete() alone.
-			 * It is possible that actually the memory needed to propagate
-			 * the DEL in AOF and replication link is greater than the one
-			 * we are freeing removing the key, but we can't account for
-			 * that otherwise we would never exit the loop.
-			 *
-			 * Same for CSC invalidation messages generated by signalModifiedKey.
-			 *
-			 * AOF and Output buffer memory will be freed eventually so
-			 * we only care about memory used by the key space. */
-			delta := getUsedMemory()
-			lru.db.GenericDelete(bestkey)
-			delta -= getUsedMemory()
-			memFreed += delta
-			keysFreed += 1
+// LFUDecrAndReturn returns the access frequency of the object: if the
+// object decrement time is reached, the LFU counter is decremented (but the
+// object is not updated). The counter is decremented once for every
+// lfu-decay-time minutes elapsed, 0 never decrements it.
+func LFUDecrAndReturn(o *RedisObj) int64 {
+	ldt := o.LRU >> 8
+	counter := o.LRU & 255
+	var numPeriods int64
+	if decayTime := evictionConfig().LFUDecayTime; decayTime != 0 {
+		numPeriods = lfuTimeElapsed(ldt) / int64(decayTime)
+	}
+	if numPeriods != 0 {
+		if numPeriods > counter {
+			counter = 0
+		} else {
+			counter -= numPeriods
 		}
 	}
+	return counter
+}
 
-	return EvictOk
+// updateLFU updates the LFU when an object is accessed. Firstly, decrement
+// the counter if the decrement time is reached. Then logarithmically
+// increment the counter, and update the access time.
+func updateLFU(o *RedisObj) {
+	counter := LFUDecrAndReturn(o)
+	counter = lfuLogIncr(counter, evictionConfig().LFULogFactor)
+	o.LRU = (lfuGetTimeInMinutes() << 8) | counter
 }
@@ -7,9 +7,9 @@ import (
 
 func TestEvictionPoolPopulate(t *testing.T) {
 	// Setup
-	lru := NewLRU(New(0), 0, 100)
-	sampleDict := NewHashTable[string, *RedisObj](10)
-	keyDict := NewHashTable[string, *RedisObj](10)
+	pool := NewEvictionPool()
+	db := New(0)
+	keyDict := db.dict
 
 	obj1 := &RedisObj{Type: StringType, Value: "val1", LRU: 5}
 	obj2 := &RedisObj{Type: StringType, Value: "val2", LRU: 3}
@@ -21,27 +21,22 @@ func TestEvictionPoolPopulate(t *testing.T) {
 	keyDict.Set("key3", obj3)
 	keyDict.Set("key4", obj4)
 
-	// The sample dictionary should only get keys, not values
-	sampleDict.Set("key1", nil)
-	sampleDict.Set("key2", nil)
-	sampleDict.Set("key3", nil)
-	sampleDict.Set("key4", nil)
-
-	lru.EvictionPoolPopulate(sampleDict, keyDict)
+	// The pool is populated with the sampled keys only
+	pool.populate(db, []string{"key1", "key2", "key3", "key4"}, MAXMEMORY_ALLKEYS_LRU)
 
 	// Using assert to validate the results
-	assert.Equal(t, "key3", lru.ep[0].Key, "Expected key3 as least recently used")
-	assert.Equal(t, "key1", lru.ep[1].Key, "Expected key1 as next least recently used")
-	assert.Equal(t, "key2", lru.ep[2].Key, "Expected key2 as next least recently used")
-	assert.Equal(t, "key4", lru.ep[3].Key, "Expected key4 as next least recently used")
+	assert.Equal(t, "key3", pool.ep[0].Key, "Expected key3 as least recently used")
+	assert.Equal(t, "key1", pool.ep[1].Key, "Expected key1 as next least recently used")
+	assert.Equal(t, "key2", pool.ep[2].Key, "Expected key2 as next least recently used")
+	assert.Equal(t, "key4", pool.ep[3].Key, "Expected key4 as next least recently used")
 
 }
 
 func TestEvictionPoolReplaceMiddleSlot(t *testing.T) {
 	// Setup
-	lru := NewLRU(New(0), 0, 100)
-	sampleDict := NewHashTable[string, *RedisObj](10)
-	keyDict := NewHashTable[string, *RedisObj](10)
+	pool := NewEvictionPool()
+	db := New(0)
+	keyDict := db.dict
 
 	// Initially fill the eviction pool
 	obj1 := &RedisObj{Type: StringType, Value: "val1", LRU: 5}
@@ -54,21 +49,55 @@ func TestEvictionPoolReplaceMiddleSlot(t *testing.T) {
 	keyDict.Set("key3", obj3)
 	keyDict.Set("key4", obj4)
 
-	sampleDict.Set("key1", nil)
-	sampleDict.Set("key2", nil)
-	sampleDict.Set("key3", nil)
-	sampleDict.Set("key4", nil)
-
 	// Add a new key with an LRU that would be inserted in the middle of the eviction pool
 	obj5 := &RedisObj{Type: StringType, Value: "val5", LRU: 6}
 	keyDict.Set("key5", obj5)
-	sampleDict.Set("key5", nil)
 
-	lru.EvictionPoolPopulate(sampleDict, keyDict)
+	pool.populate(db, []string{"key1", "key2", "key3", "key4", "key5"}, MAXMEMORY_ALLKEYS_LRU)
 
 	//// Using assert to validate the results
-	assert.Equal(t, "key5", lru.ep[0].Key, "Expected key5 as the most recently used")
-	assert.Equal(t, "key1", lru.ep[1].Key, "Expected key1 as the next most recently used") // This is the key that should have been inserted in the middle
-	assert.Equal(t, "key2", lru.ep[2].Key, "Expected key2 as next")
-	assert.Equal(t, "key4", lru.ep[3].Key, "Expected key4 as the least recently used")
+	assert.Equal(t, "key5", pool.ep[0].Key, "Expected key5 as the most recently used")
+	assert.Equal(t, "key1", pool.ep[1].Key, "Expected key1 as the next most recently used") // This is the key that should have been inserted in the middle
+	assert.Equal(t, "key2", pool.ep[2].Key, "Expected key2 as next")
+	assert.Equal(t, "key4", pool.ep[3].Key, "Expected key4 as the least recently used")
+}
+
+func TestLFULogIncr(t *testing.T) {
+	// The counters up to LFU_INIT_VAL are always incremented.
+	assert.Equal(t, int64(LFU_INIT_VAL+1), lfuLogIncr(LFU_INIT_VAL, LFU_LOG_FACTOR))
+	// With a log factor of 0 every access is counted, up to 255.
+	assert.Equal(t, int64(101), lfuLogIncr(100, 0))
+	assert.Equal(t, int64(255), lfuLogIncr(255, 0), "Expected the counter to saturate at 255")
+
+	// With the default log factor, the higher the counter the less likely it
+	// grows.
+	counter := int64(LFU_INIT_VAL)
+	for i := 0; i < 1000; i++ {
+		counter = lfuLogIncr(counter, LFU_LOG_FACTOR)
+	}
+	assert.Greater(t, counter, int64(LFU_INIT_VAL+1))
+	assert.Less(t, counter, int64(LFU_INIT_VAL+100))
+}
+
+func TestLFUDecrAndReturn(t *testing.T) {
+	now := lfuGetTimeInMinutes()
+	o := &RedisObj{Type: StringType, Value: "v", LRU: now<<8 | 10}
+	assert.Equal(t, int64(10), LFUDecrAndReturn(o), "Expected no decrement within the decay time")
+
+	// One decrement for every lfu-decay-time minutes elapsed.
+	o.LRU = ((now-3)&65535)<<8 | 10
+	assert.Equal(t, int64(7), LFUDecrAndReturn(o))
+	o.LRU = ((now-30)&65535)<<8 | 10
+	assert.Equal(t, int64(0), LFUDecrAndReturn(o))
+
+	// A decay time of 0 never decrements the counter.
+	defer SetEvictionConfigGetter(evictionConfig)
+	SetEvictionConfigGetter(func() EvictionConfig {
+		return EvictionConfig{MaxmemoryPolicy: MAXMEMORY_ALLKEYS_LFU, LFULogFactor: 0, LFUDecayTime: 0}
+	})
+	assert.Equal(t, int64(10), LFUDecrAndReturn(o))
+
+	// Every access updates the decrement time and increments the counter.
+	updateLFU(o)
+	assert.Equal(t, now<<8|11, o.LRU)
 }
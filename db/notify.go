@@ -0,0 +1,65 @@
+package db
+
+// NotifyType is the class of a keyspace event. The same bits are used by the
+// notify-keyspace-events configuration to select the events to publish.
+type NotifyType int
+
+const (
+	NotifyKeyspace NotifyType = 1 << iota // K
+	NotifyKeyevent                        // E
+	NotifyGeneric                         // g
+	NotifyString                          // $
+	NotifyList                            // l
+	NotifySet                             // s
+	NotifyHash                            // h
+	NotifyZSet                            // z
+	NotifyExpired                         // x
+	NotifyEvicted                         // e
+	NotifyStream                          // t
+	NotifyKeyMiss                         // m (Note: This one is excluded from NotifyAll on purpose)
+	NotifyNew                             // n (Note: This one is excluded from NotifyAll on purpose)
+)
+
+// NotifyAll is the A flag, all the classes except keymiss and new.
+const NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash | NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream
+
+// KeyspaceNotifier is called by the db layer for the events it generates by
+// itself (expired, evicted, new and keymiss), the server decides whether the
+// event should be published or not.
+type KeyspaceNotifier func(t NotifyType, event string, key string, dbid uint64)
+
+var keyspaceNotifier KeyspaceNotifier
+
+// SetKeyspaceNotifier installs the function used to publish keyspace events.
+func SetKeyspaceNotifier(n KeyspaceNotifier) {
+	keyspaceNotifier = n
+}
+
+func notifyKeyspaceEvent(t NotifyType, event string, key string, dbid uint64) {
+	if keyspaceNotifier != nil {
+		keyspaceNotifier(t, event, key, dbid)
+	}
+}
+
+// ModifiedKeyHook is called every time a key is modified in the database, the
+// server uses it to invalidate the keys watched by clients (WATCH), and the
+// keys cached by the clients with tracking enabled.
+type ModifiedKeyHook func(db *RedisDb, key string)
+
+var modifiedKeyHook ModifiedKeyHook
+
+// SetModifiedKeyHook installs the function called on every key modification.
+func SetModifiedKeyHook(h ModifiedKeyHook) {
+	modifiedKeyHook = h
+}
+
+// SignalModifiedKey must be called every time a key in the database is
+// modified. Keys changed by the db layer itself (expire, eviction) are
+// signaled automatically, as well as keys written with SetKey. The memory
+// used by the value is accounted again, since it may have changed.
+func (db *RedisDb) SignalModifiedKey(key string) {
+	db.updateValueMemory(key)
+	if modifiedKeyHook != nil {
+		modifiedKeyHook(db, key)
+	}
+}
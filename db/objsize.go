@@ -0,0 +1,146 @@
+package db
+
+import "unsafe"
+
+/* ----------------------------------------------------------------------------
+ * Memory usage of the objects.
+ *
+ * The size of a value is estimated from the Go structures holding it, for
+ * every encoding of the object types:
+ *
+ *   String: EncodingRaw, EncodingEmbStr          string
+ *           EncodingInt                          int64
+ *   List:   EncodingQuickList, EncodingLinkedList *List[string]
+ *           EncodingListPack, EncodingZipList    []string
+ *   Set:    EncodingHT                           *Set[string]
+ *           EncodingIntSet                       []int64
+ *           EncodingListPack                     []string
+ *   ZSet:   EncodingSkipList                     *HashTable[string, float64], the
+ *                                                skiplist nodes are estimated
+ *           EncodingListPack, EncodingZipList    []string, member and score pairs
+ *   Hash:   EncodingHT                           *HashTable[string, string]
+ *           EncodingListPack, EncodingZipList,
+ *           EncodingZipMap                       []string, field and value pairs
+ *   Stream: EncodingStream                       *RaxTree[[]string], the entry IDs
+ *                                                mapped to their fields and values
+ *
+ * The big aggregate values are sampled: the size of the first elements is
+ * extrapolated to all the elements, like MEMORY USAGE does in Redis.
+ * --------------------------------------------------------------------------*/
+
+const OBJ_COMPUTE_SIZE_DEF_SAMPLES = 5 // Default sample size of MEMORY USAGE.
+
+var (
+	pointerSize      = int64(unsafe.Sizeof(uintptr(0)))
+	stringHeaderSize = int64(unsafe.Sizeof(""))
+	sliceHeaderSize  = int64(unsafe.Sizeof([]byte(nil)))
+	redisObjSize     = int64(unsafe.Sizeof(RedisObj{}))
+	listSize         = int64(unsafe.Sizeof(List[string]{}))
+	listNodeSize     = int64(unsafe.Sizeof(ListNode[string]{}))
+	hashTableSize    = int64(unsafe.Sizeof(HashTable[string, string]{}))
+	raxTreeSize      = int64(unsafe.Sizeof(RaxTree[[]string]{}))
+	raxNodeSize      = int64(unsafe.Sizeof(Node[[]string]{}))
+	// A skiplist node holds the member, the score, the backward pointer and
+	// one forward pointer and span per level, 1.33 levels on average.
+	skiplistNodeSize = stringHeaderSize + 8 + pointerSize + 2*(pointerSize+8)
+)
+
+// sampledSize returns the size of n elements, extrapolated from the size of
+// the elements visited by rangeFn, up to samples of them. With samples 0 all
+// the elements are visited and the size is exact.
+func sampledSize(n, samples int, rangeFn func(visit func(size int64) bool)) int64 {
+	var size int64
+	visited := 0
+	rangeFn(func(elesize int64) bool {
+		size += elesize
+		visited++
+		return samples == 0 || visited < samples
+	})
+	if visited == 0 {
+		return 0
+	}
+	return size * int64(n) / int64(visited)
+}
+
+// listpackSize returns the size of the elements of a listpack encoded value.
+func listpackSize(lp []string, samples int) int64 {
+	return sampledSize(len(lp), samples, func(visit func(int64) bool) {
+		for _, ele := range lp {
+			if !visit(estimateMemoryUsage(ele)) {
+				return
+			}
+		}
+	})
+}
+
+// hashTableMemoryUsage returns the size of the table, with its keys and values.
+func hashTableMemoryUsage[V any](ht *HashTable[string, V], samples int) int64 {
+	size := hashTableSize + ht.MemoryOverhead()
+	size += sampledSize(ht.Len(), samples, func(visit func(int64) bool) {
+		ht.Range(func(key string, val V) bool {
+			var zero V
+			return visit(estimateMemoryUsage(key) + estimateMemoryUsage(val) - int64(unsafe.Sizeof(key)+unsafe.Sizeof(zero)))
+		})
+	})
+	return size
+}
+
+// ObjectComputeSize returns the memory used by the object and its value,
+// sampling up to samples elements of the aggregate values, or all of them
+// when samples is 0. The memory used by the key is not counted.
+func ObjectComputeSize(o *RedisObj, samples int) int64 {
+	size := redisObjSize
+	switch v := o.Value.(type) {
+	case string:
+		size += int64(len(v))
+	case int64:
+		// The integer is stored in the object itself.
+	case []string:
+		size += sliceHeaderSize + listpackSize(v, samples)
+	case []int64:
+		size += estimateMemoryUsage(v)
+	case *List[string]:
+		size += listSize + sampledSize(v.Len(), samples, func(visit func(int64) bool) {
+			iter := v.NewListIterator(DIRECTION_HEAD)
+			for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+				if !visit(listNodeSize + int64(len(node.Value))) {
+					return
+				}
+			}
+		})
+	case *Set[string]:
+		size += pointerSize + hashTableMemoryUsage(v.data, samples)
+	case *HashTable[string, string]:
+		size += hashTableMemoryUsage(v, samples)
+	case *HashTable[string, float64]:
+		// The sorted sets also have a skiplist node for every member.
+		size += hashTableMemoryUsage(v, samples) + int64(v.Len())*skiplistNodeSize
+	case *RaxTree[[]string]:
+		// Every entry takes a node of the tree, the IDs are in the nodes.
+		size += raxTreeSize + sampledSize(v.Len(), samples, func(visit func(int64) bool) {
+			v.Range(func(id []byte, fields []string) bool {
+				return visit(raxNodeSize + int64(len(id)) + estimateMemoryUsage(fields))
+			})
+		})
+	}
+	return size
+}
+
+// MemoryUsage returns the memory used by the key, its entry in the keyspace
+// and its value, sampling up to samples elements of the aggregate values, or
+// all of them when samples is 0. The key is not touched, false is returned if
+// it doesn't exist.
+func (db *RedisDb) MemoryUsage(key string, samples int) (int64, bool) {
+	val, exist := db.dict.Get(key)
+	if !exist {
+		return 0, false
+	}
+	var e Entry[string, *RedisObj]
+	return int64(unsafe.Sizeof(e)) + int64(len(key)) + ObjectComputeSize(val, samples), true
+}
+
+// MemoryOverhead returns the memory used by the keyspace dict and the expire
+// dict, not counting the keys and the values.
+func (db *RedisDb) MemoryOverhead() (main int64, expires int64) {
+	return db.dict.MemoryOverhead(), db.expire.MemoryOverhead()
+}
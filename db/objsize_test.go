@@ -0,0 +1,60 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectComputeSize(t *testing.T) {
+	str := &RedisObj{Type: StringType, Encoding: EncodingRaw, Value: "value"}
+	assert.Equal(t, redisObjSize+5, ObjectComputeSize(str, 0))
+	integer := &RedisObj{Type: StringType, Encoding: EncodingInt, Value: int64(12345)}
+	assert.Equal(t, redisObjSize, ObjectComputeSize(integer, 0))
+
+	intset := &RedisObj{Type: SetType, Encoding: EncodingIntSet, Value: make([]int64, 0, 4)}
+	assert.Equal(t, redisObjSize+sliceHeaderSize+4*8, ObjectComputeSize(intset, 0))
+
+	// Every encoding of the aggregate types grows with its elements.
+	list := NewList[string]()
+	set := NewSet[string](INITIAL_DB_SIZE)
+	hash := NewHashTable[string, string](INITIAL_DB_SIZE)
+	zset := NewHashTable[string, float64](INITIAL_DB_SIZE)
+	stream := NewRaxTree[[]string]()
+	objs := []*RedisObj{
+		{Type: ListType, Encoding: EncodingQuickList, Value: list},
+		{Type: SetType, Encoding: EncodingHT, Value: set},
+		{Type: HashType, Encoding: EncodingHT, Value: hash},
+		{Type: ZSetType, Encoding: EncodingSkipList, Value: zset},
+		{Type: StreamType, Encoding: EncodingStream, Value: stream},
+	}
+	empty := make([]int64, len(objs))
+	for i, o := range objs {
+		empty[i] = ObjectComputeSize(o, 0)
+	}
+	for j := 0; j < 10; j++ {
+		ele := "element:" + strconv.Itoa(j)
+		list.AddNodeTail(ele)
+		set.Add(ele)
+		hash.Set(ele, "value")
+		zset.Set(ele, float64(j))
+		stream.Insert([]byte(strconv.Itoa(j)+"-0"), []string{"field", ele})
+	}
+	for i, o := range objs {
+		assert.Greater(t, ObjectComputeSize(o, 0), empty[i]+10*int64(len("element:0")), "encoding %d", o.Encoding)
+	}
+}
+
+func TestObjectComputeSizeSamples(t *testing.T) {
+	lp := make([]string, 0, 100)
+	for j := 0; j < 100; j++ {
+		lp = append(lp, "0123456789")
+	}
+	o := &RedisObj{Type: ListType, Encoding: EncodingListPack, Value: lp}
+
+	// The size of the sampled elements is extrapolated to all of them.
+	assert.Equal(t, ObjectComputeSize(o, 0), ObjectComputeSize(o, OBJ_COMPUTE_SIZE_DEF_SAMPLES))
+	lp[0] = "0123456789" + "0123456789"
+	assert.Greater(t, ObjectComputeSize(o, 1), ObjectComputeSize(o, 0))
+}
@@ -149,8 +149,9 @@ func (t *RaxTree[T]) Len() int {
 	return t.size
 }
 
+// Insert sets the value of the key, it returns false if the key already
+// existed and its value was updated.
 func (t *RaxTree[T]) Insert(key []byte, val T) bool {
-	var parent *Node[T]
 	n := t.root
 	search := key
 	for {
@@ -168,29 +169,27 @@ func (t *RaxTree[T]) Insert(key []byte, val T) bool {
 			return true
 		}
 
-		parent = n
-		n, idx, matchBytes := n.walkEdge(search)
-
-		if n == nil {
-			e := Edge[T]{label: search, next: &Node[T]{prefix: search, leaf: &LeafNode[T]{key: search, val: val}}}
-			parent.addEdgeByIdx(idx, e)
+		next, idx, matchBytes := n.walkEdge(search)
+		if next == nil {
+			e := Edge[T]{label: search, next: &Node[T]{prefix: search, leaf: &LeafNode[T]{key: key, val: val}}}
+			n.addEdgeByIdx(idx, e)
 			t.size++
 			return true
 		}
 
-		if len(matchBytes) == len(n.prefix) {
+		if len(matchBytes) == len(next.prefix) {
 			search = search[len(matchBytes):]
+			n = next
 			continue
 		}
 
 		// Split the node at the common prefix
 		splitNode := &Node[T]{prefix: matchBytes}
-		parent.updateEdge(idx, splitNode)
+		n.updateEdge(idx, splitNode)
 
 		// The remaining part of the existing node after the split
-		n.prefix = n.prefix[len(matchBytes):]
-		e := Edge[T]{label: n.prefix, next: n}
-		splitNode.addEdge(e)
+		next.prefix = next.prefix[len(matchBytes):]
+		splitNode.addEdge(Edge[T]{label: next.prefix, next: next})
 
 		search = search[len(matchBytes):]
 		if len(search) == 0 {
@@ -199,9 +198,7 @@ func (t *RaxTree[T]) Insert(key []byte, val T) bool {
 			return true
 		}
 
-		e = Edge[T]{label: search, next: &Node[T]{prefix: search, leaf: &LeafNode[T]{key: key, val: val}}}
-		splitNode.addEdge(e)
-
+		splitNode.addEdge(Edge[T]{label: search, next: &Node[T]{prefix: search, leaf: &LeafNode[T]{key: key, val: val}}})
 		t.size++
 		return true
 	}
@@ -213,16 +210,13 @@ func (t *RaxTree[T]) Find(key []byte) (T, bool) {
 
 	for len(search) > 0 {
 		next, _, matchBytes := n.walkEdge(search)
-		if next == nil {
+		// The edge must be fully matched, otherwise the key is not in the tree.
+		if next == nil || len(matchBytes) != len(next.prefix) {
 			var zero T
 			return zero, false
 		}
 		search = search[len(matchBytes):]
-
 		n = next
-		if len(search) == 0 {
-			break
-		}
 	}
 
 	if n.isLeaf() {
@@ -233,62 +227,85 @@ func (t *RaxTree[T]) Find(key []byte) (T, bool) {
 	return zero, false
 }
 
+// Delete removes the key from the tree, the children of the key are kept.
+// It returns false if the key was not found.
 func (t *RaxTree[T]) Delete(key []byte) bool {
+	// The path from the root to the key: path[i] is the parent of the node
+	// reached by its edge idxs[i].
 	var (
-		parent, next *Node[T] // To keep track of the parent node
-		idx          int
-		matchBytes   []byte
+		path []*Node[T]
+		idxs []int
 	)
 	n := t.root
 	search := key
 
 	for len(search) > 0 {
-		next, idx, matchBytes = n.walkEdge(search)
-		if next == nil {
+		next, idx, matchBytes := n.walkEdge(search)
+		if next == nil || len(matchBytes) != len(next.prefix) {
 			// Key not found in the tree
 			return false
 		}
-
-		if bytes.Equal(next.prefix, search) {
-			// The search key matches the next node's prefix
-			parent = n
-			n = next
-			break
-		}
-
-		if bytes.HasPrefix(next.prefix, matchBytes) {
-			// The search key matches the next node's prefix
-			search = search[len(matchBytes):]
-			parent = n
-			n = next
-			if len(search) == 0 {
-				break
-			}
-		} else {
-			// Partial match, so the key is not in the tree
-			return false
-		}
+		path = append(path, n)
+		idxs = append(idxs, idx)
+		search = search[len(matchBytes):]
+		n = next
 	}
 
 	if !n.isLeaf() {
 		// Key doesn't exist in the tree
 		return false
 	}
+	n.leaf = nil
+	t.size--
 
-	// Remove the leaf node
-	parent.removeEdgeByIdx(idx)
-
-	// Check if the parent node needs to be updated or removed
-	for len(parent.edges) == 1 && !parent.isLeaf() {
-		// The parent node has only one edge and is not a leaf
-		// Merge it with its child node and update the parent
-		child := parent.edges[0].next
-		parent.prefix = append(parent.prefix, child.prefix...)
-		parent.edges = child.edges
-		parent.leaf = child.leaf
+	if len(path) == 0 {
+		// The empty key is stored in the root.
+		return true
 	}
 
-	t.size--
+	parent, idx := path[len(path)-1], idxs[len(idxs)-1]
+	if len(n.edges) == 0 {
+		parent.removeEdgeByIdx(idx)
+		// The parent may now be compressed with its only child.
+		if len(path) > 1 {
+			path[len(path)-2].compressEdge(idxs[len(idxs)-2])
+		}
+		return true
+	}
+	parent.compressEdge(idx)
+	return true
+}
+
+// compressEdge merges the node reached by the edge idx with its child, if it
+// is not a key and has a single child.
+func (n *Node[T]) compressEdge(idx int) {
+	node := n.edges[idx].next
+	if node.isLeaf() || len(node.edges) != 1 {
+		return
+	}
+	child := node.edges[0].next
+	prefix := make([]byte, 0, len(node.prefix)+len(child.prefix))
+	prefix = append(prefix, node.prefix...)
+	prefix = append(prefix, child.prefix...)
+	child.prefix = prefix
+	n.edges[idx] = Edge[T]{label: prefix, next: child}
+}
+
+// Range calls f for every key of the tree in lexicographic order, until f
+// returns false.
+func (t *RaxTree[T]) Range(f func(key []byte, val T) bool) {
+	rangeNode(t.root, f)
+}
+
+func rangeNode[T any](n *Node[T], f func(key []byte, val T) bool) bool {
+	if n.isLeaf() && !f(n.leaf.key, n.leaf.val) {
+		return false
+	}
+	for _, edge := range n.edges {
+		if !rangeNode(edge.next, f) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -300,11 +317,10 @@ func (t *RaxTree[T]) Print() {
 func printRaxTree[T any](node *Node[T], prefix string) {
 	if node.isLeaf() {
 		fmt.Printf("%s[Leaf: Key = %s, Value = %v, Prefix = %s]\n", prefix, node.leaf.key, node.leaf.val, node.prefix)
-		return
+	} else {
+		fmt.Printf("%s[Node: Prefix = %s]\n", prefix, node.prefix)
 	}
 
-	fmt.Printf("%s[Node: Prefix = %s]\n", prefix, node.prefix)
-
 	for _, edge := range node.edges {
 		fmt.Printf("%s|--Edge: Label = %s\n", prefix, edge.label)
 		printRaxTree(edge.next, prefix+"  ")
@@ -113,3 +113,36 @@ func TestRaxTree(t *testing.T) {
 	fmt.Println("Tree after complex deletions:")
 	tree.Print()
 }
+
+func TestRaxTreePrefixKeys(t *testing.T) {
+	tree := NewRaxTree[int]()
+	tree.Insert([]byte("default"), 1)
+	tree.Insert([]byte("def"), 2)
+	tree.Insert([]byte("alice"), 3)
+	tree.Insert([]byte("defaults"), 4)
+
+	_, found := tree.Find([]byte("de"))
+	assert.False(t, found)
+	_, found = tree.Find([]byte("defa"))
+	assert.False(t, found)
+
+	// Deleting a key keeps the keys it is a prefix of.
+	assert.True(t, tree.Delete([]byte("def")))
+	assert.False(t, tree.Delete([]byte("def")))
+	val, found := tree.Find([]byte("default"))
+	assert.True(t, found)
+	assert.Equal(t, 1, val)
+	assert.True(t, tree.Delete([]byte("default")))
+	val, found = tree.Find([]byte("defaults"))
+	assert.True(t, found)
+	assert.Equal(t, 4, val)
+
+	tree.Insert([]byte("bob"), 5)
+	var keys []string
+	tree.Range(func(key []byte, val int) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert.Equal(t, []string{"alice", "bob", "defaults"}, keys)
+	assert.Equal(t, 3, tree.Len())
+}
@@ -28,3 +28,15 @@ func (s *Set[T]) Contains(key T) bool {
 func (s *Set[T]) Remove(key T) {
 	s.data.Delete(key)
 }
+
+// Len returns the number of members of the set
+func (s *Set[T]) Len() int {
+	return s.data.Len()
+}
+
+// Range calls fn for every member of the set until fn returns false.
+func (s *Set[T]) Range(fn func(key T) bool) {
+	s.data.Range(func(key T, _ sentinel) bool {
+		return fn(key)
+	})
+}
@@ -32,8 +32,9 @@ const (
 type RedisObj struct {
 	Type     ObjectType
 	Encoding EncodingType
-	LRU      int64
+	LRU      int64 // LRU time (relative to the LRU clock) or LFU data (least significant 8 bits frequency and most significant 16 bits access time).
 	Value    any
+	memory   int64 // Bytes accounted in the used memory for the object, see accountValue.
 }
 
 func NewRedisObj(tp ObjectType, encodingType EncodingType, Value any, lru int64) *RedisObj {
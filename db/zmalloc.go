@@ -5,22 +5,8 @@ import (
 	"unsafe"
 )
 
-const MAX_MEMORY = 1024 * 1024 * 1024
-
 var usedMemory int64 = 0
 
-// IncreaseUsedMemory increases the used memory counter
-func IncreaseUsedMemory(v any) {
-	n := estimateMemoryUsage(v)
-	updateZmallocStatAlloc(n)
-}
-
-// DecreaseUsedMemory decreases the used memory counter
-func DecreaseUsedMemory(v any) {
-	n := estimateMemoryUsage(v)
-	updateZmallocStatFree(n)
-}
-
 func updateZmallocStatAlloc(n int64) {
 	atomic.AddInt64(&usedMemory, n)
 }
@@ -33,20 +19,46 @@ func getUsedMemory() int64 {
 	return atomic.LoadInt64(&usedMemory)
 }
 
-// estimateMemoryUsage roughly estimates the memory usage of a value, in bytes
+// UsedMemory returns the number of bytes used by the keyspace and the client
+// buffers, as estimated by the memory counters.
+func UsedMemory() int64 {
+	return getUsedMemory()
+}
+
+// UpdateUsedMemory adds delta, that may be negative, to the used memory. It
+// accounts for the memory used out of the keyspace, like the client buffers.
+func UpdateUsedMemory(delta int64) {
+	updateZmallocStatAlloc(delta)
+}
+
+// estimateMemoryUsage roughly estimates the memory usage of a value, in bytes:
+// the size of the value itself plus the size of the memory it references.
 func estimateMemoryUsage(v any) int64 {
 	switch value := v.(type) {
 	case int:
 		return int64(unsafe.Sizeof(value))
+	case int64:
+		return int64(unsafe.Sizeof(value))
+	case uint64:
+		return int64(unsafe.Sizeof(value))
 	case float64:
 		return int64(unsafe.Sizeof(value))
 	case string:
 		// 16 bytes for string header on 64-bit system + actual string content
-		return int64(16 + len(value))
-	case []int:
+		return stringHeaderSize + int64(len(value))
+	case []byte:
 		// 24 bytes for slice header on 64-bit system + content
-		return int64(24 + len(value)*int(unsafe.Sizeof(value[0])))
-	// ... add more types as needed
+		return sliceHeaderSize + int64(cap(value))
+	case []int:
+		return sliceHeaderSize + int64(cap(value))*int64(unsafe.Sizeof(int(0)))
+	case []int64:
+		return sliceHeaderSize + int64(cap(value))*int64(unsafe.Sizeof(int64(0)))
+	case []string:
+		return sliceHeaderSize + listpackSize(value, 0)
+	case *RedisObj:
+		// The pointer plus the memory accounted for the object when it was
+		// added to the keyspace.
+		return pointerSize + value.memory
 	default:
 		return 0
 	}
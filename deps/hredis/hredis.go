@@ -2,6 +2,7 @@ package hredis
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 )
 
@@ -75,6 +76,7 @@ const (
 // RedisContext is context for
 type RedisContext struct {
 	RedisFd    int
+	conn       net.Conn // the connection, wrapped by RedisInitiateSSL
 	Err        RedisErrFlag
 	ErrStr     string
 	SocketAddr string
@@ -134,6 +136,11 @@ func NewRedisContextWithOpts(opts *RedisOpts) *RedisContext {
 		c.Flags |= RedisPreferIPv6
 	}
 
+	if opts.unixSocket != "" {
+		c.redisContextConnectUnix(opts.unixSocket)
+	} else {
+		c.redisContextConnectTcp(opts.ip, opts.port, opts.sourceAddr)
+	}
 	return c
 }
 
@@ -0,0 +1,78 @@
+package hredis
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// redisContextConnectTcp connects the context to ip:port, from the source
+// address if any. The error, if any, is set in the context.
+func (c *RedisContext) redisContextConnectTcp(ip string, port int, sourceAddr string) RedisStatus {
+	c.Tcp.Host = ip
+	c.Tcp.Port = port
+	c.Tcp.SourceAddr = sourceAddr
+
+	network := "tcp"
+	switch {
+	case c.Flags&RedisPreferIPv4 != 0 && c.Flags&RedisPreferIPv6 == 0:
+		network = "tcp4"
+	case c.Flags&RedisPreferIPv6 != 0 && c.Flags&RedisPreferIPv4 == 0:
+		network = "tcp6"
+	}
+	dialer := &net.Dialer{}
+	if sourceAddr != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(sourceAddr)}
+	}
+	conn, err := dialer.Dial(network, net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		c.SetError(RedisErrIo, err.Error())
+		return RedisErr
+	}
+	return c.redisContextSetConn(conn)
+}
+
+// redisContextConnectUnix connects the context to the unix socket at path.
+func (c *RedisContext) redisContextConnectUnix(path string) RedisStatus {
+	c.UnixSocket.Path = path
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		c.SetError(RedisErrIo, err.Error())
+		return RedisErr
+	}
+	return c.redisContextSetConn(conn)
+}
+
+// redisContextSetConn makes the connection the one of the context, RedisFd
+// is its file descriptor.
+func (c *RedisContext) redisContextSetConn(conn net.Conn) RedisStatus {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		conn.Close()
+		c.SetError(RedisErrOther, "Unsupported connection")
+		return RedisErr
+	}
+	raw, err := sc.SyscallConn()
+	if err == nil {
+		err = raw.Control(func(fd uintptr) { c.RedisFd = int(fd) })
+	}
+	if err != nil {
+		conn.Close()
+		c.SetError(RedisErrIo, err.Error())
+		return RedisErr
+	}
+	c.conn = conn
+	c.SocketAddr = conn.RemoteAddr().String()
+	c.Flags |= RedisConnected
+	return RedisOk
+}
+
+// RedisFree closes the connection of the context.
+func RedisFree(c *RedisContext) {
+	if c == nil || c.conn == nil {
+		return
+	}
+	c.conn.Close()
+	c.conn = nil
+	c.Flags &^= RedisConnected
+}
@@ -186,27 +186,16 @@ func (r *RedisReader) processItem() RedisStatus {
 
 	//process typed item
 	switch curTask.tp {
-	case RedisReplyError:
-	case RedisReplyStatus:
-	case RedisReplyInteger:
-	case RedisReplyDouble:
-	case RedisReplyNil:
-	case RedisReplyBool:
-	case RedisReplyBignumber:
+	case RedisReplyError, RedisReplyStatus, RedisReplyInteger, RedisReplyDouble,
+		RedisReplyNil, RedisReplyBool, RedisReplyBignumber:
 		return r.processLineItem()
-	case RedisReplyString:
-	case RedisReplyVerbatim:
+	case RedisReplyString, RedisReplyVerbatim:
 		return r.processBulkItem()
-	case RedisReplyArray:
-	case RedisReplyMap:
-	case RedisReplySet:
-	case RedisReplyPush:
+	case RedisReplyArray, RedisReplyMap, RedisReplySet, RedisReplyPush:
 		return r.processAggregateItem()
 	default:
 		panic("Unknown reply type")
-		return RedisErr
 	}
-	return RedisErr
 }
 
 func (r *RedisReader) processLineItem() RedisStatus {
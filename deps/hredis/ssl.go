@@ -0,0 +1,140 @@
+package hredis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RedisSSLVerifyMode tells whether the certificate of the server is verified.
+type RedisSSLVerifyMode int
+
+const (
+	RedisSSLVerifyPeer RedisSSLVerifyMode = iota // Verify the server certificate
+	RedisSSLVerifyNone                           // Accept any server certificate
+)
+
+// RedisSSLOptions are the options of RedisCreateSSLContextWithOptions.
+type RedisSSLOptions struct {
+	CACertFilename     string // CA certificates file, the system ones if empty
+	CAPath             string // CA certificates directory
+	CertFilename       string // client certificate, to authenticate
+	PrivateKeyFilename string // private key of the client certificate
+	ServerName         string // SNI, the host of the context if empty
+	VerifyMode         RedisSSLVerifyMode
+}
+
+// RedisSSLContext holds the TLS configuration shared by the connections,
+// see RedisInitiateSSLWithContext.
+type RedisSSLContext struct {
+	config *tls.Config
+}
+
+// RedisCreateSSLContext returns a TLS context verifying the server
+// certificate against the CA certificates of cacertFilename and capath, and
+// authenticating with the client certificate if any.
+func RedisCreateSSLContext(cacertFilename, capath, certFilename, privateKeyFilename, serverName string) (*RedisSSLContext, error) {
+	return RedisCreateSSLContextWithOptions(&RedisSSLOptions{
+		CACertFilename:     cacertFilename,
+		CAPath:             capath,
+		CertFilename:       certFilename,
+		PrivateKeyFilename: privateKeyFilename,
+		ServerName:         serverName,
+	})
+}
+
+// RedisCreateSSLContextWithOptions returns a TLS context with the options.
+func RedisCreateSSLContextWithOptions(opts *RedisSSLOptions) (*RedisSSLContext, error) {
+	config := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.VerifyMode == RedisSSLVerifyNone,
+	}
+
+	if opts.CACertFilename != "" || opts.CAPath != "" {
+		pool := x509.NewCertPool()
+		files := make([]string, 0, 1)
+		if opts.CACertFilename != "" {
+			files = append(files, opts.CACertFilename)
+		}
+		if opts.CAPath != "" {
+			entries, err := os.ReadDir(opts.CAPath)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid CA Certificate File/Directory: %w", err)
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(opts.CAPath, entry.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid CA Certificate File/Directory: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) && file == opts.CACertFilename {
+				return nil, fmt.Errorf("Invalid CA Certificate File/Directory: no certificate in %s", file)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.CertFilename != "" || opts.PrivateKeyFilename != "" {
+		if opts.CertFilename == "" || opts.PrivateKeyFilename == "" {
+			return nil, fmt.Errorf("Client certificate and private key are both required")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFilename, opts.PrivateKeyFilename)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate or private key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &RedisSSLContext{config: config}, nil
+}
+
+// SetCiphers restricts the TLSv1.2 cipher suites to the colon separated list
+// of IANA names, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func (ctx *RedisSSLContext) SetCiphers(ciphers string) error {
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	var ids []uint16
+	for _, name := range strings.Split(ciphers, ":") {
+		found := false
+		for _, suite := range suites {
+			if suite.Name == name {
+				ids = append(ids, suite.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Unknown cipher suite '%s'", name)
+		}
+	}
+	ctx.config.CipherSuites = ids
+	return nil
+}
+
+// RedisInitiateSSLWithContext performs the TLS handshake on the connection
+// of the context, its commands are then sent over TLS. The error, if any, is
+// set in the context.
+func RedisInitiateSSLWithContext(c *RedisContext, ctx *RedisSSLContext) RedisStatus {
+	if c.conn == nil {
+		c.SetError(RedisErrOther, "Not connected")
+		return RedisErr
+	}
+	config := ctx.config
+	if config.ServerName == "" && c.Tcp.Host != "" {
+		config = config.Clone()
+		config.ServerName = c.Tcp.Host
+	}
+	conn := tls.Client(c.conn, config)
+	if err := conn.Handshake(); err != nil {
+		c.SetError(RedisErrIo, err.Error())
+		return RedisErr
+	}
+	c.conn = conn
+	return RedisOk
+}
@@ -0,0 +1,114 @@
+package hredis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSignedCert writes a self signed certificate of 127.0.0.1 and its key
+// in the directory.
+func selfSignedCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "redis.crt"), filepath.Join(dir, "redis.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestRedisInitiateSSL(t *testing.T) {
+	certFile, keyFile := selfSignedCert(t, t.TempDir())
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte("+PONG\r\n"))
+				}
+			}()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// The certificate is verified against the CA file.
+	c := RedisConnect("127.0.0.1", port)
+	require.Equal(t, RedisErrNoErr, c.Err, c.ErrStr)
+	defer RedisFree(c)
+	ctx, err := RedisCreateSSLContext(certFile, "", "", "", "")
+	require.NoError(t, err)
+	require.Equal(t, RedisOk, RedisInitiateSSLWithContext(c, ctx), c.ErrStr)
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(c.conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "+PONG\r\n", string(buf))
+
+	// An unknown authority is rejected, unless the verification is skipped.
+	c2 := RedisConnect("127.0.0.1", port)
+	defer RedisFree(c2)
+	ctx, err = RedisCreateSSLContextWithOptions(&RedisSSLOptions{CAPath: t.TempDir()})
+	require.NoError(t, err)
+	assert.Equal(t, RedisErr, RedisInitiateSSLWithContext(c2, ctx))
+	assert.Equal(t, RedisErrIo, c2.Err)
+
+	c3 := RedisConnect("127.0.0.1", port)
+	defer RedisFree(c3)
+	ctx, err = RedisCreateSSLContextWithOptions(&RedisSSLOptions{VerifyMode: RedisSSLVerifyNone})
+	require.NoError(t, err)
+	assert.Equal(t, RedisOk, RedisInitiateSSLWithContext(c3, ctx), c3.ErrStr)
+
+	_, err = RedisCreateSSLContext("", "", certFile, "", "")
+	assert.Error(t, err)
+	assert.Error(t, ctx.SetCiphers("RC4"))
+}
+
+func TestRedisConnectError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	c := RedisConnect("127.0.0.1", port)
+	assert.Equal(t, RedisErrIo, c.Err)
+	assert.NotEmpty(t, c.ErrStr)
+	assert.Equal(t, RedisErr, RedisInitiateSSLWithContext(c, &RedisSSLContext{config: &tls.Config{}}))
+}
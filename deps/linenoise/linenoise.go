@@ -34,9 +34,7 @@ func (ln *LineNoise) HistorySave(filepath string) error {
 func (ln *LineNoise) ClearScreen() (string, error) {
 	clearSeq := "\x1b[H\x1b[2J"
 	_, err := fmt.Fprint(os.Stdout, clearSeq)
-	if err != nil {
-		// Handle error or ignore, based on requirements.
-	}
+	return "", err
 }
 
 func init() {
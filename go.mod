@@ -8,6 +8,7 @@ require (
 	github.com/stretchr/testify v1.8.1
 	go.uber.org/zap v1.25.0
 	golang.org/x/sys v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -15,5 +16,4 @@ require (
 	github.com/mattn/go-runewidth v0.0.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,11 +1,32 @@
 package node
 
 import (
-	"github.com/fzft/go-mock-redis/db"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unsafe"
+
+	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/log"
+	"go.uber.org/zap"
 )
 
+/* This file implements the ACLs: the users, the rules granting them the
+ * commands, keys and channels they can access, and the ACL command.
+ *
+ * The permissions of a user are described by selectors: the root selector is
+ * set by the rules given outside parentheses, the other selectors by the
+ * rules between parentheses. A command is allowed if one of the selectors
+ * allows the command itself and all the keys and channels it accesses. */
+
 type UserFlag uint8
 
 const (
@@ -19,21 +40,13 @@ const (
 type User struct {
 	name      string
 	flags     UserFlag
-	passwords *db.List[string] // List of password hashes
-	selectors *db.List[string] /* A list of selectors this user validates commands
+	passwords *db.List[string]       // List of password hashes
+	selectors *db.List[*aclSelector] /* A list of selectors this user validates commands
 	   against. This list will always contain at least
 	   one selector for backwards compatibility. */
 	aclString *db.RedisObj // cached acl string
 }
 
-// ACLCheckAllUserCommandPerm low level api that checks if a specified user is able to execute a command.
-func (u *User) ACLCheckAllUserCommandPerm(cmd RedisCommand, argv []*db.RedisObj) {
-	iter := u.selectors.NewListIterator(db.DIRECTION_HEAD)
-
-	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
-	}
-}
-
 type AclCheckAllPerm uint8
 
 const (
@@ -50,6 +63,7 @@ const (
 	SelectorFlagAllKeys SelectorFlag = 1 << iota
 	SelectorFlagAllCommands
 	SelectorFlagAllChannels
+	SelectorFlagRoot // This is the root user permission selector.
 )
 
 type ACLSelectorFlags struct {
@@ -64,6 +78,35 @@ var AclSelectorFlags = []ACLSelectorFlags{
 	{name: "", flag: 0}, // Terminator
 }
 
+// ACLKeyPermission are the permissions a key pattern grants.
+type ACLKeyPermission uint8
+
+const (
+	ACLReadPermission ACLKeyPermission = 1 << iota
+	ACLWritePermission
+	ACLAllPermission = ACLReadPermission | ACLWritePermission
+)
+
+// keyPattern is a key pattern of a selector, with the permissions it grants
+// on the matching keys.
+type keyPattern struct {
+	flags   ACLKeyPermission
+	pattern string
+}
+
+// String returns the pattern as given in the ACL rules: ~pattern when it
+// grants all the permissions, %R~pattern or %W~pattern otherwise.
+func (p *keyPattern) String() string {
+	switch p.flags {
+	case ACLAllPermission:
+		return "~" + p.pattern
+	case ACLReadPermission:
+		return "%R~" + p.pattern
+	default:
+		return "%W~" + p.pattern
+	}
+}
+
 // aclSelector are private and not exposed outside
 type aclSelector struct {
 	flags SelectorFlag
@@ -78,13 +121,12 @@ type aclSelector struct {
 	 * specific argv[1] is given.
 	 *
 	 * For each command ID (corresponding to the command bit set in allowed_commands),
-	 * This array points to an array of SDS strings, terminated by a NULL pointer,
-	 * with all the first-args that are allowed for this command. When no first-arg
-	 * matching is used, the field is just set to NULL to avoid allocating
-	 * USER_COMMAND_BITS_COUNT pointers. */
+	 * This array points to a slice with all the first-args that are allowed for
+	 * this command. When no first-arg matching is used, the field is just set to
+	 * nil to avoid allocating UserCommandBitsCount slices. */
 	allowedFirstArgs [][]string
 
-	patterns *db.List[string] // List of patterns this user validates commands against.
+	patterns *db.List[*keyPattern] // List of patterns this user validates commands against.
 
 	channels *db.List[string] // List of channels this user can access in pub/sub.
 	/* A string representation of the ordered categories and commands, this
@@ -92,46 +134,134 @@ type aclSelector struct {
 	cmdRules string
 }
 
-func (s *aclSelector) checkCmd(cmd RedisCommand, argv []*db.RedisObj, argc int) AclCheckAllPerm {
+// ACLCreateSelector creates a selector denying everything.
+func ACLCreateSelector(flags SelectorFlag) *aclSelector {
+	return &aclSelector{
+		flags:    flags,
+		patterns: db.NewList[*keyPattern](),
+		channels: db.NewList[string](),
+	}
+}
+
+// copy returns a deep copy of the selector.
+func (s *aclSelector) copy() *aclSelector {
+	dst := ACLCreateSelector(s.flags)
+	dst.allowedCommands = s.allowedCommands
+	dst.cmdRules = s.cmdRules
+	if s.allowedFirstArgs != nil {
+		dst.allowedFirstArgs = make([][]string, len(s.allowedFirstArgs))
+		for id, args := range s.allowedFirstArgs {
+			if args != nil {
+				dst.allowedFirstArgs[id] = append([]string(nil), args...)
+			}
+		}
+	}
+	iter := s.patterns.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		pat := *node.Value
+		dst.patterns.AddNodeTail(&pat)
+	}
+	iter2 := s.channels.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter2.NextNode(); node != nil; node = iter2.NextNode() {
+		dst.channels.AddNodeTail(node.Value)
+	}
+	return dst
+}
+
+// checkKey checks if the key is matched by a pattern of the selector granting
+// the permissions the key spec flags require.
+func (s *aclSelector) checkKey(key string, keySpecFlags KeySpecFlags) AclCheckAllPerm {
+	var keyFlags ACLKeyPermission
+	if keySpecFlags&KeySpecAccess != 0 {
+		keyFlags |= ACLReadPermission
+	}
+	if keySpecFlags&(KeySpecInsert|KeySpecDelete|KeySpecUpdate) != 0 {
+		keyFlags |= ACLWritePermission
+	}
+
+	iter := s.patterns.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		pat := node.Value
+		if pat.flags&keyFlags != keyFlags {
+			continue
+		}
+		if stringMatch(pat.pattern, key, false) {
+			return ACLOK
+		}
+	}
+	return ACLDeniedKey
+}
+
+// ACLCheckChannelAgainstList checks the channel against the channel patterns
+// of a selector. A channel pattern, as given to PSUBSCRIBE, is only allowed
+// if it is literally in the list.
+func ACLCheckChannelAgainstList(reference *db.List[string], channel string, isPattern bool) AclCheckAllPerm {
+	iter := reference.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		pattern := node.Value
+		// Channel patterns are matched literally against the channels in the list.
+		if isPattern && pattern == channel {
+			return ACLOK
+		}
+		if !isPattern && stringMatch(pattern, channel, false) {
+			return ACLOK
+		}
+	}
+	return ACLDeniedChannel
+}
+
+// checkCmd checks if the selector allows the command with the given
+// arguments. On denied key or channel, the index of the argument is returned.
+func (s *aclSelector) checkCmd(cmd RedisCommand, argv []*db.RedisObj, argc int) (AclCheckAllPerm, int) {
 	if s.flags&SelectorFlagAllCommands == 0 && cmd.Flags()&CmdNoAuth == 0 {
 		// if the bit is not set we have to check further, in case the command is allowed just with specific first args.
-
 		id := cmd.Id()
-
 		if !s.cmdBit(id) {
 			// check if the first argument is allowed.
 			if argc < 2 || s.allowedFirstArgs == nil || s.allowedFirstArgs[id] == nil {
-				return ACLDeniedCmd
+				return ACLDeniedCmd, 0
 			}
-
-			var subid uint64
-			for {
-				if s.allowedFirstArgs[id][subid] == "" {
-					return ACLDeniedCmd
-				}
-
-				var idx int
-				if cmd.Parent() != nil {
-					idx = 2
-				} else {
-					idx = 1
-				}
-
-				if !strings.EqualFold(argv[idx].Value.(string), s.allowedFirstArgs[id][subid]) {
+			idx := 1
+			if cmd.Parent() != nil {
+				idx = 2
+			}
+			allowed := false
+			for _, arg := range s.allowedFirstArgs[id] {
+				if idx < argc && strings.EqualFold(argv[idx].Value.(string), arg) {
+					allowed = true
 					break
 				}
-				subid++
 			}
-
+			if !allowed {
+				return ACLDeniedCmd, 0
+			}
 		}
 	}
 
 	/* Check if the user can execute commands explicitly touching the keys
 	 * mentioned in the command arguments. */
-	//if s.flags&SelectorFlagAllKeys == 0 {
-	//
-	//}
-	return ACLOK
+	if s.flags&SelectorFlagAllKeys == 0 {
+		for _, key := range getKeysFromCommand(cmd, argv, argc) {
+			if ret := s.checkKey(argv[key.pos].Value.(string), key.flags); ret != ACLOK {
+				return ret, key.pos
+			}
+		}
+	}
+
+	/* Check if the user can execute commands explicitly touching the channels
+	 * mentioned in the command arguments. */
+	if s.flags&SelectorFlagAllChannels == 0 {
+		for _, channel := range getChannelsFromCommand(cmd, argv, argc) {
+			if channel.flags&(ChannelPublish|ChannelSubscribe) == 0 {
+				continue
+			}
+			isPattern := channel.flags&ChannelPattern != 0
+			if ret := ACLCheckChannelAgainstList(s.channels, argv[channel.pos].Value.(string), isPattern); ret != ACLOK {
+				return ret, channel.pos
+			}
+		}
+	}
+	return ACLOK, 0
 }
 
 // cmdBit check if the specified command bit is set for the specified user.
@@ -142,6 +272,337 @@ func (s *aclSelector) cmdBit(id uint64) bool {
 	return false
 }
 
+// setCmdBit sets the specified command bit for the selector.
+func (s *aclSelector) setCmdBit(id uint64, value bool) {
+	if word, bit, ok := ACLGetCommandBitCoordinates(id); ok {
+		if value {
+			s.allowedCommands[word] |= bit
+		} else {
+			s.allowedCommands[word] &= ^bit
+		}
+	}
+}
+
+// canExecuteFutureCommands reports if the selector allows the commands added
+// in the future, that is if the rules started with +@all: the last command
+// bit, not used by any command, is only set by +@all.
+func (s *aclSelector) canExecuteFutureCommands() bool {
+	return s.cmdBit(UserCommandBitsCount - 1)
+}
+
+// resetFirstArgs removes the allowed first args of all the commands.
+func (s *aclSelector) resetFirstArgs() {
+	s.allowedFirstArgs = nil
+}
+
+// resetFirstArgsForCommand removes the allowed first args of the command.
+func (s *aclSelector) resetFirstArgsForCommand(id uint64) {
+	if s.allowedFirstArgs != nil && id < uint64(len(s.allowedFirstArgs)) {
+		s.allowedFirstArgs[id] = nil
+	}
+}
+
+// addAllowedFirstArg allows the command when argv[1] is the given first
+// arg, even if the command bit is not set.
+func (s *aclSelector) addAllowedFirstArg(id uint64, firstArg string) {
+	if id >= UserCommandBitsCount {
+		return
+	}
+	if s.allowedFirstArgs == nil {
+		s.allowedFirstArgs = make([][]string, UserCommandBitsCount)
+	}
+	for _, arg := range s.allowedFirstArgs[id] {
+		if strings.EqualFold(arg, firstArg) {
+			return
+		}
+	}
+	s.allowedFirstArgs[id] = append(s.allowedFirstArgs[id], firstArg)
+}
+
+// changeCommandPerm allows or denies the command, and all its subcommands.
+func (s *aclSelector) changeCommandPerm(cmd RedisCommand, allow bool) {
+	id := cmd.Id()
+	s.setCmdBit(id, allow)
+	s.resetFirstArgsForCommand(id)
+	for _, sub := range cmd.SubCommands() {
+		s.changeCommandPerm(sub, allow)
+	}
+}
+
+// setCommandBitsForCategory allows or denies all the commands of the
+// category. It returns false if the category does not exist.
+func (s *aclSelector) setCommandBitsForCategory(category string, allow bool) bool {
+	flag, ok := ACLGetCommandCategoryFlagByName(category)
+	if !ok {
+		return false
+	}
+	forEachCommand(func(cmd RedisCommand) {
+		if cmd.ACLCategories()&flag != 0 {
+			s.setCmdBit(cmd.Id(), allow)
+			s.resetFirstArgsForCommand(cmd.Id())
+		}
+	})
+	return true
+}
+
+// removeCommandRule removes the rule from the command rules, with the rules
+// of its subcommands and first args when the rule is a command.
+func (s *aclSelector) removeCommandRule(rule string) {
+	rules := strings.Fields(s.cmdRules)
+	kept := rules[:0]
+	for _, r := range rules {
+		existing := r[1:]
+		if existing == rule || (!strings.HasPrefix(rule, "@") && strings.HasPrefix(existing, rule+"|")) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.cmdRules = strings.Join(kept, " ")
+}
+
+// updateCommandRules records the rule in the command rules, so that the
+// relative ordering of commands and categories is kept to describe the
+// selector: any previous instance of the rule is removed.
+func (s *aclSelector) updateCommandRules(rule string, allow bool) {
+	rule = strings.ToLower(rule)
+	s.removeCommandRule(rule)
+	if s.cmdRules != "" {
+		s.cmdRules += " "
+	}
+	if allow {
+		s.cmdRules += "+" + rule
+	} else {
+		s.cmdRules += "-" + rule
+	}
+}
+
+// ACLSetSelector applies an ACL rule to the selector:
+//
+//	allkeys, ~*       Allow all the keys.
+//	~<pattern>        Allow the keys matching the pattern.
+//	%R~<pattern>      Allow reading the keys matching the pattern, %W~ for
+//	                  writing, %RW~ is the same as ~.
+//	resetkeys         Flush the list of allowed keys patterns.
+//	allchannels, &*   Allow all the Pub/Sub channels.
+//	&<pattern>        Allow the Pub/Sub channels matching the pattern.
+//	resetchannels     Flush the list of allowed channel patterns.
+//	allcommands       Alias for +@all.
+//	nocommands        Alias for -@all.
+//	+<command>        Allow the command, or a subcommand with +cmd|sub.
+//	-<command>        Disallow the command, or a subcommand with -cmd|sub.
+//	+<cmd>|<arg>      Allow a command without subcommands only with the given
+//	                  first argument.
+//	+@<category>      Allow all the commands of the category.
+//	-@<category>      Disallow all the commands of the category.
+func ACLSetSelector(s *aclSelector, op string) error {
+	lop := strings.ToLower(op)
+	switch {
+	case lop == "allkeys" || op == "~*":
+		s.flags |= SelectorFlagAllKeys
+		s.patterns = db.NewList[*keyPattern]()
+	case lop == "resetkeys":
+		s.flags &= ^SelectorFlagAllKeys
+		s.patterns = db.NewList[*keyPattern]()
+	case lop == "allchannels" || op == "&*":
+		s.flags |= SelectorFlagAllChannels
+		s.channels = db.NewList[string]()
+	case lop == "resetchannels":
+		s.flags &= ^SelectorFlagAllChannels
+		s.channels = db.NewList[string]()
+	case lop == "allcommands" || lop == "+@all":
+		for j := range s.allowedCommands {
+			s.allowedCommands[j] = ^uint64(0)
+		}
+		s.flags |= SelectorFlagAllCommands
+		s.cmdRules = ""
+		s.resetFirstArgs()
+	case lop == "nocommands" || lop == "-@all":
+		s.allowedCommands = [len(s.allowedCommands)]uint64{}
+		s.flags &= ^SelectorFlagAllCommands
+		s.cmdRules = ""
+		s.resetFirstArgs()
+	case op[0] == '~' || op[0] == '%':
+		return s.addKeyPattern(op)
+	case op[0] == '&':
+		if s.flags&SelectorFlagAllChannels != 0 {
+			return errACLAllChannelsPattern
+		}
+		if s.channels.SearchNode(func(v string) bool { return v == op[1:] }) == nil {
+			s.channels.AddNodeTail(op[1:])
+		}
+	case op[0] == '+' && len(op) > 1 && op[1] != '@':
+		return s.allowCommand(op[1:])
+	case op[0] == '-' && len(op) > 1 && op[1] != '@':
+		cmd := ACLLookupCommand(op[1:])
+		if cmd == nil {
+			return errACLUnknownCommand
+		}
+		s.changeCommandPerm(cmd, false)
+		s.flags &= ^SelectorFlagAllCommands
+		s.updateCommandRules(cmd.Fullname(), false)
+	case (op[0] == '+' || op[0] == '-') && len(op) > 1 && op[1] == '@':
+		allow := op[0] == '+'
+		if !s.setCommandBitsForCategory(op[2:], allow) {
+			return errACLUnknownCommand
+		}
+		if !allow {
+			s.flags &= ^SelectorFlagAllCommands
+		}
+		s.updateCommandRules(op[1:], allow)
+	default:
+		return errACLSyntax
+	}
+	return nil
+}
+
+// addKeyPattern implements the ~<pattern> and %<perms>~<pattern> rules.
+func (s *aclSelector) addKeyPattern(op string) error {
+	if s.flags&SelectorFlagAllKeys != 0 {
+		return errACLAllKeysPattern
+	}
+	flags := ACLAllPermission
+	offset := 1
+	if op[0] == '%' {
+		flags = 0
+		for ; offset < len(op); offset++ {
+			ch := op[offset]
+			if (ch == 'R' || ch == 'r') && flags&ACLReadPermission == 0 {
+				flags |= ACLReadPermission
+			} else if (ch == 'W' || ch == 'w') && flags&ACLWritePermission == 0 {
+				flags |= ACLWritePermission
+			} else if ch == '~' {
+				offset++
+				break
+			} else {
+				return errACLSyntax
+			}
+		}
+		if flags == 0 || op[offset-1] != '~' {
+			return errACLSyntax
+		}
+	}
+
+	pattern := op[offset:]
+	if pattern == "*" && flags == ACLAllPermission {
+		s.flags |= SelectorFlagAllKeys
+		s.patterns = db.NewList[*keyPattern]()
+		return nil
+	}
+	// Avoid re-adding the same key pattern multiple times.
+	if node := s.patterns.SearchNode(func(v *keyPattern) bool { return v.pattern == pattern }); node != nil {
+		node.Value.flags |= flags
+		return nil
+	}
+	s.patterns.AddNodeTail(&keyPattern{flags: flags, pattern: pattern})
+	return nil
+}
+
+// allowCommand implements the +<command>, +<command>|<subcommand> and
+// +<command>|<first-arg> rules.
+func (s *aclSelector) allowCommand(name string) error {
+	sep := strings.LastIndexByte(name, '|')
+	if sep == -1 {
+		cmd := ACLLookupCommand(name)
+		if cmd == nil {
+			return errACLUnknownCommand
+		}
+		s.changeCommandPerm(cmd, true)
+		s.updateCommandRules(cmd.Fullname(), true)
+		return nil
+	}
+
+	// Split the command and subcommand parts.
+	cmd := ACLLookupCommand(name[:sep])
+	sub := name[sep+1:]
+	// Check if the command exists. We can't check the first-arg to see if
+	// it is valid.
+	if cmd == nil {
+		return errACLUnknownCommand
+	}
+	// We do not support allowing first-arg of a subcommand
+	if cmd.Parent() != nil {
+		return errACLFirstArgOfSubcommand
+	}
+	// The subcommand cannot be empty, so things like DEBUG| are syntax errors.
+	if sub == "" {
+		return errACLSyntax
+	}
+
+	if cmd.SubCommandsDict() != nil {
+		// If user is trying to allow a valid subcommand we can just add its
+		// unique ID
+		subCmd := ACLLookupCommand(name)
+		if subCmd == nil {
+			return errACLUnknownCommand
+		}
+		s.changeCommandPerm(subCmd, true)
+	} else {
+		// If user is trying to use the ACL mech to block SELECT except
+		// SELECT 0 or block DEBUG except DEBUG OBJECT (DEBUG subcommands are
+		// not considered subcommands for now) we use the allowed_firstargs
+		// mechanism.
+		if s.cmdBit(cmd.Id()) {
+			// The command is already allowed, the first arg is useless.
+			s.updateCommandRules(name, true)
+			return nil
+		}
+		log.Logger.Warn("Deprecation warning: Allowing a first arg of an otherwise blocked command is a misuse of ACL and may get disabled in the future",
+			zap.String("offender", "+"+name))
+		s.addAllowedFirstArg(cmd.Id(), sub)
+	}
+	s.updateCommandRules(name, true)
+	return nil
+}
+
+// describe returns the ACL rules of the selector.
+func (s *aclSelector) describe() string {
+	rules := make([]string, 0, 4)
+	if keys := s.describeKeys(); keys != "" {
+		rules = append(rules, keys)
+	}
+	rules = append(rules, s.describeChannels(), s.describeCommandRules())
+	return strings.Join(rules, " ")
+}
+
+// describeKeys returns the key patterns of the selector.
+func (s *aclSelector) describeKeys() string {
+	if s.flags&SelectorFlagAllKeys != 0 {
+		return "~*"
+	}
+	patterns := make([]string, 0, s.patterns.Len())
+	iter := s.patterns.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		patterns = append(patterns, node.Value.String())
+	}
+	return strings.Join(patterns, " ")
+}
+
+// describeChannels returns the channel patterns of the selector.
+func (s *aclSelector) describeChannels() string {
+	if s.flags&SelectorFlagAllChannels != 0 {
+		return "&*"
+	}
+	rules := []string{"resetchannels"}
+	iter := s.channels.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		rules = append(rules, "&"+node.Value)
+	}
+	return strings.Join(rules, " ")
+}
+
+// describeCommandRules returns the command rules of the selector, starting
+// with +@all or -@all.
+func (s *aclSelector) describeCommandRules() string {
+	rules := "-@all"
+	if s.canExecuteFutureCommands() {
+		rules = "+@all"
+	}
+	if s.cmdRules != "" {
+		rules += " " + s.cmdRules
+	}
+	return rules
+}
+
 type ACLCategoryItem struct {
 	name string
 	flag uint64
@@ -196,6 +657,20 @@ var ACLCommandCategories = []ACLCategoryItem{
 	{name: "", flag: 0}, // Terminator
 }
 
+// ACLGetCommandCategoryFlagByName returns the flag of the category, "all" is
+// the category of every command.
+func ACLGetCommandCategoryFlagByName(name string) (uint64, bool) {
+	if strings.EqualFold(name, "all") {
+		return ^uint64(0), true
+	}
+	for j := 0; ACLCommandCategories[j].flag != 0; j++ {
+		if strings.EqualFold(ACLCommandCategories[j].name, name) {
+			return ACLCommandCategories[j].flag, true
+		}
+	}
+	return 0, false
+}
+
 type ACLUserFlag struct {
 	name string
 	flag UserFlag
@@ -210,12 +685,426 @@ var ACLUserFlags = []ACLUserFlag{
 	{name: "", flag: 0}, // Terminator
 }
 
+// The errors of the ACL rules.
+var (
+	errACLUnknownCommand       = fmt.Errorf("Unknown command or category name in ACL")
+	errACLSyntax               = fmt.Errorf("Syntax error")
+	errACLAllKeysPattern       = fmt.Errorf("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	errACLAllChannelsPattern   = fmt.Errorf("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+	errACLNoSuchPassword       = fmt.Errorf("The password you are trying to remove from the user does not exist")
+	errACLBadPasswordHash      = fmt.Errorf("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	errACLFirstArgOfSubcommand = fmt.Errorf("Allowing first-arg of a subcommand is not supported")
+)
+
 type Acl struct {
 	CommandId db.RaxTree[int]
 }
 
-func (c *Client) ACLCheckAllPerm() {
+// aclInit creates the users table with the default user. The default user
+// is enabled and has no password, so clients are authenticated on connection.
+func aclInit() {
+	users = db.NewRaxTree[*User]()
+	defaultUser = ACLCreateDefaultUser()
+	aclLog = db.NewList[*aclLogEntry]()
+}
+
+// ACLCreateUnlinkedUser creates a user that is not in the users table, with
+// no permissions.
+func ACLCreateUnlinkedUser(name string) *User {
+	u := &User{
+		name:      name,
+		flags:     UserFlagDisabled | UserFlagSanitizePayload,
+		passwords: db.NewList[string](),
+		selectors: db.NewList[*aclSelector](),
+	}
+	u.selectors.AddNodeTail(ACLCreateSelector(SelectorFlagRoot))
+	return u
+}
+
+// ACLCreateUser creates a user with no permissions and adds it to the users
+// table, nil is returned if the user already exists.
+func ACLCreateUser(name string) *User {
+	if _, exist := users.Find([]byte(name)); exist {
+		return nil
+	}
+	u := ACLCreateUnlinkedUser(name)
+	users.Insert([]byte(name), u)
+	return u
+}
+
+// ACLCreateDefaultUser creates the default user: it can access everything,
+// and requires no password.
+func ACLCreateDefaultUser() *User {
+	u := ACLCreateUser("default")
+	for _, op := range []string{"+@all", "~*", "&*", "on", "nopass"} {
+		_ = ACLSetUser(u, op)
+	}
+	return u
+}
+
+// ACLGetUserByName returns the user, or nil if it does not exist.
+func ACLGetUserByName(name string) *User {
+	u, _ := users.Find([]byte(name))
+	return u
+}
+
+// ACLCopyUser copies the flags, passwords and selectors of src to dst.
+func ACLCopyUser(dst, src *User) {
+	dst.flags = src.flags
+	dst.passwords = db.NewList[string]()
+	iter := src.passwords.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		dst.passwords.AddNodeTail(node.Value)
+	}
+	dst.selectors = db.NewList[*aclSelector]()
+	iter2 := src.selectors.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter2.NextNode(); node != nil; node = iter2.NextNode() {
+		dst.selectors.AddNodeTail(node.Value.copy())
+	}
+	dst.aclString = nil
+}
 
+// rootSelector returns the root selector of the user.
+func (u *User) rootSelector() *aclSelector {
+	return u.selectors.Head.Value
+}
+
+// ACLHashPassword returns the SHA256 of the password, as 64 lowercase hex
+// chars.
+func ACLHashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// isValidPasswordHash checks that the hash is made of 64 lowercase hex chars.
+func isValidPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, ch := range hash {
+		if !(ch >= '0' && ch <= '9') && !(ch >= 'a' && ch <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ACLCheckUserCredentials checks the username and password pair: the user
+// must exist, be enabled, and either be flagged nopass or have the password.
+func ACLCheckUserCredentials(username, password string) bool {
+	u := ACLGetUserByName(username)
+	if u == nil || u.flags&UserFlagDisabled != 0 {
+		return false
+	}
+	if u.flags&UserFlagNoPass != 0 {
+		return true
+	}
+
+	hash := ACLHashPassword(password)
+	return u.passwords.SearchNode(func(h string) bool {
+		return subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1
+	}) != nil
+}
+
+// ACLAuthenticateUser authenticates the client as the user if the credentials
+// are valid, it returns false otherwise.
+func ACLAuthenticateUser(c *Client, username, password string) bool {
+	if !ACLCheckUserCredentials(username, password) {
+		context := ACLLogCtxToplevel
+		if c.flags&ClientMulti != 0 {
+			context = ACLLogCtxMulti
+		}
+		addACLLogEntry(c, ACLDeniedAuth, context, 0, username, "")
+		return false
+	}
+	c.user = ACLGetUserByName(username)
+	c.authenticated = true
+	return true
+}
+
+// ACLSetUser applies an ACL rule to the user. Besides the selector rules of
+// ACLSetSelector, applied to the root selector, the user rules are:
+//
+//	on, off           Enable or disable the user.
+//	nopass            The user requires no password, its passwords are removed.
+//	resetpass         Remove all the passwords and the nopass flag.
+//	><password>       Add the password to the user.
+//	#<hash>           Add the SHA256 hash of a password to the user.
+//	<<password>       Remove the password from the user.
+//	!<hash>           Remove the SHA256 hash of a password from the user.
+//	(<rules>)         Add a selector with the rules.
+//	clearselectors    Remove all the selectors but the root one.
+//	reset             Reset the user to off, resetpass, resetkeys,
+//	                  resetchannels, -@all, clearselectors.
+func ACLSetUser(u *User, op string) error {
+	u.aclString = nil
+	if op == "" {
+		return nil
+	}
+
+	lop := strings.ToLower(op)
+	switch {
+	case lop == "on":
+		u.flags |= UserFlagEnabled
+		u.flags &= ^UserFlagDisabled
+	case lop == "off":
+		u.flags |= UserFlagDisabled
+		u.flags &= ^UserFlagEnabled
+	case lop == "skip-sanitize-payload":
+		u.flags |= UserFlagSkipSanitizePayload
+		u.flags &= ^UserFlagSanitizePayload
+	case lop == "sanitize-payload":
+		u.flags &= ^UserFlagSkipSanitizePayload
+		u.flags |= UserFlagSanitizePayload
+	case lop == "nopass":
+		u.flags |= UserFlagNoPass
+		u.passwords = db.NewList[string]()
+	case lop == "resetpass":
+		u.flags &= ^UserFlagNoPass
+		u.passwords = db.NewList[string]()
+	case op[0] == '>' || op[0] == '#':
+		var hash string
+		if op[0] == '>' {
+			hash = ACLHashPassword(op[1:])
+		} else {
+			if !isValidPasswordHash(op[1:]) {
+				return errACLBadPasswordHash
+			}
+			hash = op[1:]
+		}
+		if u.passwords.SearchNode(func(v string) bool { return v == hash }) == nil {
+			u.passwords.AddNodeTail(hash)
+		}
+		// Clear the nopass flag that would otherwise make the user
+		// authenticate with any password.
+		u.flags &= ^UserFlagNoPass
+	case op[0] == '<' || op[0] == '!':
+		var hash string
+		if op[0] == '<' {
+			hash = ACLHashPassword(op[1:])
+		} else {
+			if !isValidPasswordHash(op[1:]) {
+				return errACLBadPasswordHash
+			}
+			hash = op[1:]
+		}
+		node := u.passwords.SearchNode(func(v string) bool { return v == hash })
+		if node == nil {
+			return errACLNoSuchPassword
+		}
+		_ = u.passwords.RemoveNode(node)
+	case op[0] == '(' && op[len(op)-1] == ')':
+		selector, err := aclCreateSelectorFromOpSet(op[1 : len(op)-1])
+		if err != nil {
+			return err
+		}
+		u.selectors.AddNodeTail(selector)
+	case lop == "clearselectors":
+		root := u.rootSelector()
+		u.selectors = db.NewList[*aclSelector]()
+		u.selectors.AddNodeTail(root)
+	case lop == "reset":
+		for _, rule := range []string{"resetpass", "resetkeys", "resetchannels", "off", "sanitize-payload", "clearselectors", "-@all"} {
+			if err := ACLSetUser(u, rule); err != nil {
+				return err
+			}
+		}
+	default:
+		return ACLSetSelector(u.rootSelector(), op)
+	}
+	return nil
+}
+
+// aclCreateSelectorFromOpSet creates a selector from the space separated
+// rules between the parentheses of a selector rule.
+func aclCreateSelectorFromOpSet(opset string) (*aclSelector, error) {
+	s := ACLCreateSelector(0)
+	for _, op := range strings.Fields(opset) {
+		if err := ACLSetSelector(s, op); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ACLMergeSelectorArguments merges the rules of a selector given as
+// multiple arguments, like "(~key" "+get)", into a single rule.
+func ACLMergeSelectorArguments(ops []string) ([]string, error) {
+	merged := make([]string, 0, len(ops))
+	var selector []string
+	for _, op := range ops {
+		if selector == nil && strings.HasPrefix(op, "(") && !strings.HasSuffix(op, ")") {
+			selector = []string{op}
+			continue
+		}
+		if selector != nil {
+			selector = append(selector, op)
+			if strings.HasSuffix(op, ")") {
+				merged = append(merged, strings.Join(selector, " "))
+				selector = nil
+			}
+			continue
+		}
+		merged = append(merged, op)
+	}
+	if selector != nil {
+		return nil, fmt.Errorf("Unmatched parenthesis in acl selector starting at '%s'.", selector[0])
+	}
+	return merged, nil
+}
+
+// ACLDescribeUser returns the ACL rules describing the user, as listed by
+// ACL LIST.
+func ACLDescribeUser(u *User) string {
+	if u.aclString != nil {
+		return u.aclString.Value.(string)
+	}
+
+	rules := make([]string, 0, 8)
+	for j := 0; ACLUserFlags[j].flag != 0; j++ {
+		if u.flags&ACLUserFlags[j].flag != 0 {
+			rules = append(rules, ACLUserFlags[j].name)
+		}
+	}
+	iter := u.passwords.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		rules = append(rules, "#"+node.Value)
+	}
+	iter2 := u.selectors.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter2.NextNode(); node != nil; node = iter2.NextNode() {
+		s := node.Value
+		if s.flags&SelectorFlagRoot != 0 {
+			rules = append(rules, s.describe())
+		} else {
+			rules = append(rules, "("+s.describe()+")")
+		}
+	}
+
+	desc := strings.Join(rules, " ")
+	u.aclString = createObject(db.StringType, desc)
+	return desc
+}
+
+// ACLLookupCommand returns the command by its ACL name, "cmd|sub" for a
+// subcommand.
+func ACLLookupCommand(name string) RedisCommand {
+	parts := strings.Split(strings.ToLower(name), "|")
+	if len(parts) > 2 {
+		return nil
+	}
+	cmd, exist := server.commands.Get(parts[0])
+	if !exist {
+		return nil
+	}
+	if len(parts) == 1 {
+		return cmd
+	}
+	if cmd.SubCommandsDict() == nil {
+		return nil
+	}
+	sub, exist := cmd.SubCommandsDict().Get(parts[1])
+	if !exist {
+		return nil
+	}
+	return sub
+}
+
+// forEachCommand calls f for every command and subcommand.
+func forEachCommand(f func(cmd RedisCommand)) {
+	var walk func(cmd RedisCommand)
+	walk = func(cmd RedisCommand) {
+		f(cmd)
+		for _, sub := range cmd.SubCommands() {
+			walk(sub)
+		}
+	}
+	server.commands.Range(func(name string, cmd RedisCommand) bool {
+		walk(cmd)
+		return true
+	})
+}
+
+// ACLCheckAllUserCommandPerm low level api that checks if a specified user is able to execute a command.
+// If the command is denied, the index of the denied key or channel argument
+// is returned with the error. We have to pick a single error: if no selector
+// can execute the command, the command is denied, otherwise the last key or
+// channel no selector could match is returned.
+func (u *User) ACLCheckAllUserCommandPerm(cmd RedisCommand, argv []*db.RedisObj, argc int) (AclCheckAllPerm, int) {
+	// If there is no associated user, the connection can run anything.
+	if u == nil {
+		return ACLOK, 0
+	}
+
+	relevantError, lastIdx := ACLDeniedCmd, 0
+	iter := u.selectors.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		ret, idx := node.Value.checkCmd(cmd, argv, argc)
+		if ret == ACLOK {
+			return ACLOK, 0
+		}
+		if ret > relevantError || (ret == relevantError && idx > lastIdx) {
+			relevantError, lastIdx = ret, idx
+		}
+	}
+	return relevantError, lastIdx
+}
+
+// ACLCheckAllPerm checks if the user of the client can execute the command
+// of the client.
+func (c *Client) ACLCheckAllPerm() (AclCheckAllPerm, int) {
+	return c.user.ACLCheckAllUserCommandPerm(c.cmd, c.argv, c.argc)
+}
+
+// getAclErrorMessage returns the message of a denied command, verbose
+// messages give the name of the denied key or channel.
+func getAclErrorMessage(aclRes AclCheckAllPerm, u *User, cmd RedisCommand, erroredVal string, verbose bool) string {
+	switch aclRes {
+	case ACLDeniedCmd:
+		return fmt.Sprintf("User %s has no permissions to run the '%s' command", u.name, cmd.Fullname())
+	case ACLDeniedKey:
+		if verbose {
+			return fmt.Sprintf("User %s has no permissions to access the '%s' key", u.name, erroredVal)
+		}
+		return "No permissions to access a key"
+	case ACLDeniedChannel:
+		if verbose {
+			return fmt.Sprintf("User %s has no permissions to access the '%s' channel", u.name, erroredVal)
+		}
+		return "No permissions to access a channel"
+	}
+	return "Authentication failed"
+}
+
+// ACLFreeUserAndKillClients deletes the user, and closes the connections
+// authenticated with it.
+func ACLFreeUserAndKillClients(u *User, current *Client) {
+	ACLKillUserClients(u, current)
+	users.Delete([]byte(u.name))
+}
+
+// ACLKillUserClients closes the connections authenticated with the user.
+func ACLKillUserClients(u *User, current *Client) {
+	iter := server.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		c := node.Value
+		if c.user != u {
+			continue
+		}
+		// We'll free the connection asynchronously, so in theory to set
+		// a different user is not needed. However if there are bugs in
+		// Redis, soon or later, this may result in some security hole: it's
+		// much more defensive to set the default user and put it in non
+		// authenticated mode.
+		c.user = defaultUser
+		c.authenticated = false
+		if c == current {
+			// We may be called from ACL DELUSER: the connection is closed
+			// once the reply is sent.
+			c.flags |= ClientCloseAfterReply
+		} else {
+			freeClientAsync(c)
+		}
+	}
 }
 
 func ACLGetCommandBitCoordinates(id uint64) (word uint64, bit uint64, ok bool) {
@@ -228,3 +1117,750 @@ func ACLGetCommandBitCoordinates(id uint64) (word uint64, bit uint64, ok bool) {
 
 	return word, bit, true
 }
+
+/*-----------------------------------------------------------------------------
+ * ACL loading / saving functions
+ *----------------------------------------------------------------------------*/
+
+// ACLLoadConfiguredUsers creates the users declared by the user directives of
+// the config file. The default user is reset before its rules are applied.
+func ACLLoadConfiguredUsers() error {
+	for _, argv := range server.usersToLoad {
+		username := argv[0]
+		ops, err := ACLMergeSelectorArguments(argv[1:])
+		if err != nil {
+			return fmt.Errorf("Error in user declaration '%s': %s", username, err)
+		}
+
+		var u *User
+		if username == "default" {
+			u = defaultUser
+			_ = ACLSetUser(u, "reset")
+		} else if u = ACLCreateUser(username); u == nil {
+			return fmt.Errorf("Duplicate user '%s' found", username)
+		}
+
+		for _, op := range ops {
+			if err := ACLSetUser(u, op); err != nil {
+				return fmt.Errorf("Error in user declaration '%s': %s", op, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ACLLoadFromFile loads the users of the ACL file, one per line, in the
+// same format of ACL LIST:
+//
+//	user <username> ... acl rules ...
+//
+// The file is validated before any user is changed: on error the current
+// users are kept, and the error describes every invalid line. Otherwise the
+// current users are replaced, and their clients disconnected. The default
+// user is updated in place, as it is referenced in different places.
+func ACLLoadFromFile(filename string, current *Client) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Error loading ACLs, opening file '%s': %s", filename, err)
+	}
+
+	// The users are created in a new table, so that the old one can be
+	// restored on error.
+	oldUsers := users
+	users = db.NewRaxTree[*User]()
+
+	var errors strings.Builder
+	for i, line := range strings.Split(string(content), "\n") {
+		linenum := i + 1
+		line = strings.TrimSpace(line)
+		// Skip blank lines and comments.
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		argv := strings.Fields(line)
+		if argv[0] != "user" {
+			fmt.Fprintf(&errors, "%s:%d should start with user keyword. ", filename, linenum)
+			continue
+		}
+		if len(argv) < 2 {
+			fmt.Fprintf(&errors, "%s:%d should have at least a username. ", filename, linenum)
+			continue
+		}
+		if ACLGetUserByName(argv[1]) != nil {
+			fmt.Fprintf(&errors, "%s:%d: duplicate user '%s' is defined. ", filename, linenum, argv[1])
+			continue
+		}
+
+		ops, err := ACLMergeSelectorArguments(argv[2:])
+		if err != nil {
+			fmt.Fprintf(&errors, "%s:%d: %s. ", filename, linenum, err)
+			continue
+		}
+		u := ACLCreateUser(argv[1])
+		for _, op := range ops {
+			if err := ACLSetUser(u, op); err != nil {
+				fmt.Fprintf(&errors, "%s:%d: %s. ", filename, linenum, err)
+				break
+			}
+		}
+	}
+
+	if errors.Len() > 0 {
+		users = oldUsers
+		return fmt.Errorf("%s", strings.TrimSuffix(errors.String(), " "))
+	}
+
+	newDefault := ACLGetUserByName("default")
+	if newDefault == nil {
+		newDefault = ACLCreateDefaultUser()
+	}
+	ACLCopyUser(defaultUser, newDefault)
+	users.Insert([]byte("default"), defaultUser)
+
+	oldUsers.Range(func(name []byte, u *User) bool {
+		if u != defaultUser {
+			ACLKillUserClients(u, current)
+		}
+		return true
+	})
+	return nil
+}
+
+// ACLSaveToFile writes the users to the ACL file. The users are written to a
+// temporary file, renamed to the ACL file once synced, so that the file is
+// replaced atomically.
+func ACLSaveToFile(filename string) error {
+	var b strings.Builder
+	users.Range(func(name []byte, u *User) bool {
+		fmt.Fprintf(&b, "user %s %s\n", u.name, ACLDescribeUser(u))
+		return true
+	})
+
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Opening temp ACL file for ACL SAVE: %w", err)
+	}
+	tmpname := f.Name()
+	if _, err = f.WriteString(b.String()); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpname, filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return fmt.Errorf("Writing ACL file for ACL SAVE: %w", err)
+	}
+	return nil
+}
+
+// ACLLoadUsersAtStartup creates the users of the config file, or of the ACL
+// file, once the command table exists. Declaring users in both is refused.
+func ACLLoadUsersAtStartup() error {
+	if server.aclFilename != "" && len(server.usersToLoad) > 0 {
+		return fmt.Errorf("Configuring Redis with users defined in redis.conf and at the same setting an ACL file path is invalid. This setup is very likely to lead to configuration errors and security holes, please define either an ACL file or declare users directly in your redis.conf, but not both.")
+	}
+	if err := ACLLoadConfiguredUsers(); err != nil {
+		return err
+	}
+	if server.aclFilename != "" {
+		return ACLLoadFromFile(server.aclFilename, nil)
+	}
+	return nil
+}
+
+/*-----------------------------------------------------------------------------
+ * ACL log
+ *----------------------------------------------------------------------------*/
+
+// ACLLogContext is where the denied command was called from.
+type ACLLogContext uint8
+
+const (
+	ACLLogCtxToplevel ACLLogContext = iota
+	ACLLogCtxLua
+	ACLLogCtxMulti
+	ACLLogCtxModule
+)
+
+// ACLLogGroupingMaxTimeDelta is the max time in milliseconds between two
+// similar entries for them to be grouped in the same entry.
+const ACLLogGroupingMaxTimeDelta = 60000
+
+// aclLogEntry is an entry of the ACL LOG: the similar denials are grouped in
+// the same entry, with the number of times they happened.
+type aclLogEntry struct {
+	count            uint64 // Number of times this happened recently.
+	reason           AclCheckAllPerm
+	context          ACLLogContext // Toplevel, Lua or MULTI/EXEC?
+	object           string        // The key name or command name.
+	username         string        // User the client is authenticated with.
+	ctime            int64         // Milliseconds time of last update to this entry.
+	cinfo            string        // Client info (last client if updated).
+	entryId          uint64        // The pair (entryId, timestampCreated) is a unique identifier of this entry
+	timestampCreated int64         // UNIX time in milliseconds at the time of this entry's creation
+}
+
+var (
+	aclLog           *db.List[*aclLogEntry] // Newest entries first
+	aclLogEntryCount uint64                 // Number of ACL log entries created
+)
+
+// aclInfo are the ACL denials stats, reported by INFO.
+var aclInfo struct {
+	userAuthFailures       uint64 // Auth failure count.
+	invalidCmdAccesses     uint64 // Invalid command accesses that user doesn't have permission to.
+	invalidKeyAccesses     uint64 // Invalid key accesses that user doesn't have permission to.
+	invalidChannelAccesses uint64 // Invalid channel accesses that user doesn't have permission to.
+}
+
+// String returns the name of the reason in the ACL LOG.
+func (r AclCheckAllPerm) String() string {
+	switch r {
+	case ACLDeniedCmd:
+		return "command"
+	case ACLDeniedKey:
+		return "key"
+	case ACLDeniedChannel:
+		return "channel"
+	case ACLDeniedAuth:
+		return "auth"
+	}
+	return "unknown"
+}
+
+// String returns the name of the context in the ACL LOG.
+func (ctx ACLLogContext) String() string {
+	switch ctx {
+	case ACLLogCtxToplevel:
+		return "toplevel"
+	case ACLLogCtxMulti:
+		return "multi"
+	case ACLLogCtxLua:
+		return "lua"
+	case ACLLogCtxModule:
+		return "module"
+	}
+	return "unknown"
+}
+
+// matches returns true if the two entries are similar enough to be grouped:
+// the same denial, happened in a short time.
+func (le *aclLogEntry) matches(other *aclLogEntry) bool {
+	return le.reason == other.reason && le.context == other.context &&
+		other.ctime-le.ctime <= ACLLogGroupingMaxTimeDelta &&
+		le.object == other.object && le.username == other.username
+}
+
+// addACLLogEntry adds a denial to the ACL LOG. The object, the denied command,
+// key or channel, is taken from the command of the client at argpos unless
+// given, as is the username unless given.
+func addACLLogEntry(c *Client, reason AclCheckAllPerm, context ACLLogContext, argpos int, username, object string) {
+	// Update ACL stats.
+	switch reason {
+	case ACLDeniedAuth:
+		aclInfo.userAuthFailures++
+	case ACLDeniedCmd:
+		aclInfo.invalidCmdAccesses++
+	case ACLDeniedKey:
+		aclInfo.invalidKeyAccesses++
+	case ACLDeniedChannel:
+		aclInfo.invalidChannelAccesses++
+	}
+
+	if object == "" {
+		switch reason {
+		case ACLDeniedCmd:
+			object = c.cmd.Fullname()
+		case ACLDeniedKey, ACLDeniedChannel:
+			object = c.argv[argpos].Value.(string)
+		case ACLDeniedAuth:
+			object = "AUTH"
+		}
+	}
+	if username == "" {
+		username = c.user.name
+	}
+
+	now := time.Now().UnixMilli()
+	le := &aclLogEntry{
+		count:            1,
+		reason:           reason,
+		context:          context,
+		object:           object,
+		username:         username,
+		ctime:            now,
+		cinfo:            c.catClientInfoString(),
+		entryId:          aclLogEntryCount,
+		timestampCreated: now,
+	}
+
+	// Try to match this entry with past ones, to see if we can just update
+	// an existing entry instead of creating a new one.
+	maxlen := 10
+	iter := aclLog.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil && maxlen > 0; node = iter.NextNode() {
+		if node.Value.matches(le) {
+			// Update the old entry and move it on top of the list.
+			node.Value.count++
+			node.Value.ctime = le.ctime
+			node.Value.cinfo = le.cinfo
+			le = node.Value
+			_ = aclLog.RemoveNode(node)
+			aclLog.AddNodeHead(le)
+			return
+		}
+		maxlen--
+	}
+
+	// Add it to our list of entries, trimming the list if needed.
+	aclLogEntryCount++
+	aclLog.AddNodeHead(le)
+	for aclLog.Len() > server.aclLogMaxLen {
+		_ = aclLog.RemoveNode(aclLog.Tail)
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * ACL command entry point
+ *----------------------------------------------------------------------------*/
+
+// AclCmd handles the ACL command.
+type AclCmd struct {
+	c *Client
+}
+
+// NewAclCmd returns a new AclCmd.
+func NewAclCmd(c *Client) *AclCmd {
+	return &AclCmd{c: c}
+}
+
+// SetUser implements ACL SETUSER username [rule [rule ...]]
+// The rules are applied to a copy of the user, so that the user is only
+// changed if all the rules are valid.
+func (cmd *AclCmd) SetUser() {
+	c := cmd.c
+	username := c.argv[2].Value.(string)
+	if strings.ContainsAny(username, " \x00") {
+		c.AddReplyError("Usernames can't contain spaces or null characters")
+		return
+	}
+
+	ops := make([]string, 0, c.argc-3)
+	for j := 3; j < c.argc; j++ {
+		ops = append(ops, c.argv[j].Value.(string))
+		// The rules may contain passwords, they are never logged.
+		c.redactClientCommandArgument(j)
+	}
+	ops, err := ACLMergeSelectorArguments(ops)
+	if err != nil {
+		c.addReplyErrorFormat(err.Error())
+		return
+	}
+
+	u := ACLGetUserByName(username)
+	tempu := ACLCreateUnlinkedUser(username)
+	if u != nil {
+		ACLCopyUser(tempu, u)
+	}
+	for _, op := range ops {
+		if err := ACLSetUser(tempu, op); err != nil {
+			c.addReplyErrorFormat(fmt.Sprintf("Error in ACL SETUSER modifier '%s': %s", op, err))
+			return
+		}
+	}
+
+	// Existing users are changed in place, as the clients reference them.
+	if u == nil {
+		u = ACLCreateUser(username)
+	}
+	ACLCopyUser(u, tempu)
+	c.AddReply(SharedOk)
+}
+
+// GetUser implements ACL GETUSER username
+func (cmd *AclCmd) GetUser() {
+	c := cmd.c
+	u := ACLGetUserByName(c.argv[2].Value.(string))
+	if u == nil {
+		c.addReplyNull()
+		return
+	}
+
+	c.addReplyMapLen(6)
+
+	c.addReplyBulkCString("flags")
+	flags := make([]string, 0, len(ACLUserFlags))
+	for j := 0; ACLUserFlags[j].flag != 0; j++ {
+		if u.flags&ACLUserFlags[j].flag != 0 {
+			flags = append(flags, ACLUserFlags[j].name)
+		}
+	}
+	c.addReplySetLen(len(flags))
+	for _, flag := range flags {
+		c.addReplyBulkCString(flag)
+	}
+
+	c.addReplyBulkCString("passwords")
+	c.addReplyArrayLen(u.passwords.Len())
+	iter := u.passwords.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		c.addReplyBulkCString(node.Value)
+	}
+
+	root := u.rootSelector()
+	cmd.addReplySelectorDescription(root, false)
+
+	c.addReplyBulkCString("selectors")
+	c.addReplyArrayLen(u.selectors.Len() - 1)
+	iter2 := u.selectors.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter2.NextNode(); node != nil; node = iter2.NextNode() {
+		if s := node.Value; s != root {
+			cmd.addReplySelectorDescription(s, true)
+		}
+	}
+}
+
+// addReplySelectorDescription replies the commands, keys and channels of the
+// selector, as a map when asMap is true, or as fields of the current map.
+func (cmd *AclCmd) addReplySelectorDescription(s *aclSelector, asMap bool) {
+	c := cmd.c
+	if asMap {
+		c.addReplyMapLen(3)
+	}
+	c.addReplyBulkCString("commands")
+	c.addReplyBulkCString(s.describeCommandRules())
+	c.addReplyBulkCString("keys")
+	c.addReplyBulkCString(s.describeKeys())
+	c.addReplyBulkCString("channels")
+	channels := "&*"
+	if s.flags&SelectorFlagAllChannels == 0 {
+		channels = strings.TrimSpace(strings.TrimPrefix(s.describeChannels(), "resetchannels"))
+	}
+	c.addReplyBulkCString(channels)
+}
+
+// DelUser implements ACL DELUSER username [username ...]
+func (cmd *AclCmd) DelUser() {
+	c := cmd.c
+	deleted := 0
+	for j := 2; j < c.argc; j++ {
+		username := c.argv[j].Value.(string)
+		if username == "default" {
+			c.AddReplyError("The 'default' user cannot be removed")
+			return
+		}
+	}
+	for j := 2; j < c.argc; j++ {
+		if u := ACLGetUserByName(c.argv[j].Value.(string)); u != nil {
+			ACLFreeUserAndKillClients(u, c)
+			deleted++
+		}
+	}
+	c.addReplyLongLong(int64(deleted))
+}
+
+// List implements ACL LIST
+func (cmd *AclCmd) List() {
+	c := cmd.c
+	c.addReplyArrayLen(users.Len())
+	users.Range(func(name []byte, u *User) bool {
+		c.addReplyBulkCString("user " + u.name + " " + ACLDescribeUser(u))
+		return true
+	})
+}
+
+// Users implements ACL USERS
+func (cmd *AclCmd) Users() {
+	c := cmd.c
+	c.addReplyArrayLen(users.Len())
+	users.Range(func(name []byte, u *User) bool {
+		c.addReplyBulkCString(u.name)
+		return true
+	})
+}
+
+// WhoAmI implements ACL WHOAMI
+func (cmd *AclCmd) WhoAmI() {
+	if cmd.c.user == nil {
+		cmd.c.addReplyNull()
+		return
+	}
+	cmd.c.addReplyBulkCString(cmd.c.user.name)
+}
+
+// Cat implements ACL CAT [category]
+// Without argument the categories are listed, otherwise the commands of the
+// category.
+func (cmd *AclCmd) Cat() {
+	c := cmd.c
+	if c.argc == 2 {
+		c.addReplyArrayLen(len(ACLCommandCategories) - 1)
+		for j := 0; ACLCommandCategories[j].flag != 0; j++ {
+			c.addReplyBulkCString(ACLCommandCategories[j].name)
+		}
+		return
+	}
+
+	category := c.argv[2].Value.(string)
+	flag, ok := ACLGetCommandCategoryFlagByName(category)
+	if !ok || strings.EqualFold(category, "all") {
+		c.addReplyErrorFormat(fmt.Sprintf("Unknown category '%.128s'", category))
+		return
+	}
+	names := make([]string, 0)
+	forEachCommand(func(cmd RedisCommand) {
+		if cmd.ACLCategories()&flag != 0 {
+			names = append(names, cmd.Fullname())
+		}
+	})
+	sort.Strings(names)
+	c.addReplyArrayLen(len(names))
+	for _, name := range names {
+		c.addReplyBulkCString(name)
+	}
+}
+
+// GenPass implements ACL GENPASS [bits]
+// It returns a random password of the given number of bits, 256 by
+// default, as hex chars.
+func (cmd *AclCmd) GenPass() {
+	c := cmd.c
+	bits := int64(256)
+	if c.argc > 2 {
+		var err error
+		bits, err = strconv.ParseInt(c.argv[2].Value.(string), 10, 64)
+		if err != nil || bits <= 0 || bits > 4096 {
+			c.AddReplyError("ACL GENPASS argument must be the number of bits for the output password, a positive number up to 4096")
+			return
+		}
+	}
+	chars := int((bits + 3) / 4) // Round to number of characters to emit.
+	buf := make([]byte, (chars+1)/2)
+	if _, err := rand.Read(buf); err != nil {
+		c.AddReplyError("Unable to generate a random password")
+		return
+	}
+	c.addReplyBulkCString(hex.EncodeToString(buf)[:chars])
+}
+
+// DryRun implements ACL DRYRUN username command [arg [arg ...]]
+// It replies OK if the user can run the command, the reason it can't
+// otherwise.
+func (cmd *AclCmd) DryRun() {
+	c := cmd.c
+	username := c.argv[2].Value.(string)
+	u := ACLGetUserByName(username)
+	if u == nil {
+		c.addReplyErrorFormat(fmt.Sprintf("User '%s' not found", username))
+		return
+	}
+
+	argv := c.argv[3:c.argc]
+	argc := c.argc - 3
+	realCmd := c.lookupCommand(argv, argc)
+	if realCmd == nil {
+		c.addReplyErrorFormat(fmt.Sprintf("Command '%s' not found", argv[0].Value.(string)))
+		return
+	}
+	if (realCmd.Arity() > 0 && realCmd.Arity() != argc) || argc < -realCmd.Arity() {
+		c.addReplyErrorFormat(fmt.Sprintf("wrong number of arguments for '%s' command", realCmd.Fullname()))
+		return
+	}
+
+	if ret, idx := u.ACLCheckAllUserCommandPerm(realCmd, argv, argc); ret != ACLOK {
+		c.addReplyBulkCString(getAclErrorMessage(ret, u, realCmd, argv[idx].Value.(string), true))
+		return
+	}
+	c.AddReply(SharedOk)
+}
+
+// Load implements ACL LOAD
+func (cmd *AclCmd) Load() {
+	c := cmd.c
+	if server.aclFilename == "" {
+		c.AddReplyError("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+		return
+	}
+	if err := ACLLoadFromFile(server.aclFilename, c); err != nil {
+		c.addReplyErrorFormat(err.Error())
+		return
+	}
+	c.AddReply(SharedOk)
+}
+
+// Save implements ACL SAVE
+func (cmd *AclCmd) Save() {
+	c := cmd.c
+	if server.aclFilename == "" {
+		c.AddReplyError("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+		return
+	}
+	if err := ACLSaveToFile(server.aclFilename); err != nil {
+		log.Logger.Warn("ACL SAVE failed", zap.Error(err))
+		c.AddReplyError("There was an error trying to save the ACLs. Please check the server logs for more information")
+		return
+	}
+	c.AddReply(SharedOk)
+}
+
+// Log implements ACL LOG [<count> | RESET]
+func (cmd *AclCmd) Log() {
+	c := cmd.c
+	if c.argc > 3 {
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+	count := int64(10) // By default show the first 10 entries.
+
+	// Parse the only argument that LOG may have: it could be either
+	// the number of entries the user wants to display, or alternatively
+	// the "RESET" command in order to flush the old entries.
+	if c.argc == 3 {
+		arg := c.argv[2].Value.(string)
+		if strings.EqualFold(arg, "reset") {
+			aclLog.Empty()
+			c.AddReply(SharedOk)
+			return
+		}
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			c.AddReplyError("value is out of range, must be positive")
+			return
+		}
+		count = n
+	}
+
+	if count > int64(aclLog.Len()) {
+		count = int64(aclLog.Len())
+	}
+	c.addReplyArrayLen(int(count))
+	now := time.Now().UnixMilli()
+	iter := aclLog.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil && count > 0; node = iter.NextNode() {
+		le := node.Value
+		c.addReplyMapLen(10)
+		c.addReplyBulkCString("count")
+		c.addReplyLongLong(int64(le.count))
+		c.addReplyBulkCString("reason")
+		c.addReplyBulkCString(le.reason.String())
+		c.addReplyBulkCString("context")
+		c.addReplyBulkCString(le.context.String())
+		c.addReplyBulkCString("object")
+		c.addReplyBulkCString(le.object)
+		c.addReplyBulkCString("username")
+		c.addReplyBulkCString(le.username)
+		c.addReplyBulkCString("age-seconds")
+		c.addReplyDouble(float64(now-le.ctime) / 1000)
+		c.addReplyBulkCString("client-info")
+		c.addReplyBulkCString(le.cinfo)
+		c.addReplyBulkCString("entry-id")
+		c.addReplyLongLong(int64(le.entryId))
+		c.addReplyBulkCString("timestamp-created")
+		c.addReplyLongLong(le.timestampCreated)
+		c.addReplyBulkCString("timestamp-last-updated")
+		c.addReplyLongLong(le.ctime)
+		count--
+	}
+}
+
+// Help implements ACL HELP
+func (cmd *AclCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"CAT [<category>]",
+		"    List all commands that belong to <category>, or all command categories",
+		"    when no category is specified.",
+		"DELUSER <username> [<username> ...]",
+		"    Delete a list of users.",
+		"DRYRUN <username> <command> [<arg> ...]",
+		"    Returns whether the user can execute the given command without executing the command.",
+		"GETUSER <username>",
+		"    Get the user's details.",
+		"GENPASS [<bits>]",
+		"    Generate a secure 256-bit user password. The optional `bits` argument can",
+		"    be used to specify a different size.",
+		"LIST",
+		"    Show users details in config file format.",
+		"LOAD",
+		"    Reload users from the ACL file.",
+		"LOG [<count> | RESET]",
+		"    Show the ACL log entries.",
+		"SAVE",
+		"    Save the current config to the ACL file.",
+		"SETUSER <username> <property> [<property> ...]",
+		"    Create or modify a user with the specified properties.",
+		"USERS",
+		"    List all the registered usernames.",
+		"WHOAMI",
+		"    Return the current connection username.",
+	})
+}
+
+func aclSetUserCommand(c *Client) error {
+	NewAclCmd(c).SetUser()
+	return nil
+}
+
+func aclGetUserCommand(c *Client) error {
+	NewAclCmd(c).GetUser()
+	return nil
+}
+
+func aclDelUserCommand(c *Client) error {
+	NewAclCmd(c).DelUser()
+	return nil
+}
+
+func aclListCommand(c *Client) error {
+	NewAclCmd(c).List()
+	return nil
+}
+
+func aclUsersCommand(c *Client) error {
+	NewAclCmd(c).Users()
+	return nil
+}
+
+func aclWhoAmICommand(c *Client) error {
+	NewAclCmd(c).WhoAmI()
+	return nil
+}
+
+func aclCatCommand(c *Client) error {
+	NewAclCmd(c).Cat()
+	return nil
+}
+
+func aclGenPassCommand(c *Client) error {
+	NewAclCmd(c).GenPass()
+	return nil
+}
+
+func aclDryRunCommand(c *Client) error {
+	NewAclCmd(c).DryRun()
+	return nil
+}
+
+func aclLoadCommand(c *Client) error {
+	NewAclCmd(c).Load()
+	return nil
+}
+
+func aclSaveCommand(c *Client) error {
+	NewAclCmd(c).Save()
+	return nil
+}
+
+func aclLogCommand(c *Client) error {
+	NewAclCmd(c).Log()
+	return nil
+}
+
+func aclHelpCommand(c *Client) error {
+	NewAclCmd(c).Help()
+	return nil
+}
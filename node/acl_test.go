@@ -0,0 +1,401 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func setTestUser(t *testing.T, c *Client, conn *TestConn, name string, rules ...string) *User {
+	t.Helper()
+	args := append([]string{"ACL", "SETUSER", name}, rules...)
+	if got := sendCommand(c, conn, args...); got != "+OK\r\n" {
+		t.Fatalf("%v replied %q", args, got)
+	}
+	t.Cleanup(func() {
+		if u := ACLGetUserByName(name); u != nil {
+			users.Delete([]byte(name))
+		}
+	})
+	return ACLGetUserByName(name)
+}
+
+// bulkString returns the RESP bulk string of s.
+func bulkString(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func TestACLSetUserDescribe(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		rules []string
+		want  string
+	}{
+		{nil, "off sanitize-payload resetchannels -@all"},
+		{[]string{"on", "nopass", "~*", "&*", "+@all"}, "on nopass sanitize-payload ~* &* +@all"},
+		{[]string{"reset", "on", ">pass", "~app:*", "%R~ro:*", "%W~wo:*", "&news.*", "+@read", "-get", "+set"},
+			"on sanitize-payload #" + ACLHashPassword("pass") + " ~app:* %R~ro:* %W~wo:* resetchannels &news.* -@all +@read -get +set"},
+		{[]string{"reset", "+@all", "-config|set", "-@scripting"}, "off sanitize-payload resetchannels +@all -config|set -@scripting"},
+		{[]string{"reset", "+config", "-config"}, "off sanitize-payload resetchannels -@all -config"},
+		{[]string{"reset", "+select|0", "(~sel:* +get)", "(&chan +publish)"},
+			"off sanitize-payload resetchannels -@all +select|0 (~sel:* resetchannels -@all +get) (resetchannels &chan -@all +publish)"},
+		{[]string{"reset", "%RW~both:*", "%R~both:*", "~*"}, "off sanitize-payload ~* resetchannels -@all"},
+	}
+	for _, tc := range cases {
+		u := setTestUser(t, c, conn, "describe", tc.rules...)
+		if got := ACLDescribeUser(u); got != tc.want {
+			t.Errorf("%v described as %q, want %q", tc.rules, got, tc.want)
+		}
+	}
+
+	if got := sendCommand(c, conn, "ACL", "LIST"); !strings.Contains(got, "user default on nopass sanitize-payload ~* &* +@all") {
+		t.Fatalf("ACL LIST replied %q", got)
+	}
+}
+
+func TestACLSetUserErrors(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ACL", "SETUSER", "bad", "+nosuchcommand"}, "-ERR Error in ACL SETUSER modifier '+nosuchcommand': Unknown command or category name in ACL\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "+@nosuchcategory"}, "-ERR Error in ACL SETUSER modifier '+@nosuchcategory': Unknown command or category name in ACL\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "what"}, "-ERR Error in ACL SETUSER modifier 'what': Syntax error\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "~*", "~foo"}, "-ERR Error in ACL SETUSER modifier '~foo': Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "%X~foo"}, "-ERR Error in ACL SETUSER modifier '%X~foo': Syntax error\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "<nosuchpass"}, "-ERR Error in ACL SETUSER modifier '<nosuchpass': The password you are trying to remove from the user does not exist\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "#abc"}, "-ERR Error in ACL SETUSER modifier '#abc': The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "+config|get|x"}, "-ERR Error in ACL SETUSER modifier '+config|get|x': Allowing first-arg of a subcommand is not supported\r\n"},
+		{[]string{"ACL", "SETUSER", "bad", "(~foo", "+get"}, "-ERR Unmatched parenthesis in acl selector starting at '(~foo'.\r\n"},
+		{[]string{"ACL", "SETUSER", "bad user"}, "-ERR Usernames can't contain spaces or null characters\r\n"},
+		{[]string{"ACL", "DELUSER", "default"}, "-ERR The 'default' user cannot be removed\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	// The failed SETUSER must not create the user.
+	if ACLGetUserByName("bad") != nil {
+		t.Fatal("user created by a failed ACL SETUSER")
+	}
+}
+
+func TestACLDryRun(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	setTestUser(t, c, conn, "svc", "on", "nopass", "~app:*", "%R~ro:*", "%W~wo:*", "&news.*",
+		"+get", "+set", "+publish", "+subscribe", "+psubscribe", "+select|0", "+config|get", "+eval",
+		"(~other:* +get)")
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"GET", "app:1"}, "+OK\r\n"},
+		{[]string{"SET", "app:1", "v"}, "+OK\r\n"},
+		{[]string{"GET", "ro:1"}, "+OK\r\n"},
+		{[]string{"SET", "ro:1", "v"}, bulkString("User svc has no permissions to access the 'ro:1' key")},
+		{[]string{"SET", "wo:1", "v"}, "+OK\r\n"},
+		{[]string{"GET", "wo:1"}, bulkString("User svc has no permissions to access the 'wo:1' key")},
+		{[]string{"GET", "other:1"}, "+OK\r\n"},
+		{[]string{"SET", "other:1", "v"}, bulkString("User svc has no permissions to access the 'other:1' key")},
+		{[]string{"EVAL", "return 1", "2", "app:1", "ro:1"}, bulkString("User svc has no permissions to access the 'ro:1' key")},
+		{[]string{"EVAL", "return 1", "0", "ro:1"}, "+OK\r\n"},
+		{[]string{"PUBLISH", "news.tech", "hi"}, "+OK\r\n"},
+		{[]string{"PUBLISH", "sports", "hi"}, bulkString("User svc has no permissions to access the 'sports' channel")},
+		{[]string{"PSUBSCRIBE", "news.*"}, "+OK\r\n"},
+		{[]string{"PSUBSCRIBE", "news.t*"}, bulkString("User svc has no permissions to access the 'news.t*' channel")},
+		{[]string{"SELECT", "0"}, "+OK\r\n"},
+		{[]string{"SELECT", "1"}, bulkString("User svc has no permissions to run the 'select' command")},
+		{[]string{"CONFIG", "GET", "port"}, "+OK\r\n"},
+		{[]string{"CONFIG", "SET", "port", "1"}, bulkString("User svc has no permissions to run the 'config|set' command")},
+		{[]string{"FLUSHDB"}, bulkString("User svc has no permissions to run the 'flushdb' command")},
+	}
+	for _, tc := range cases {
+		args := append([]string{"ACL", "DRYRUN", "svc"}, tc.args...)
+		if got := sendCommand(c, conn, args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", args, got, tc.want)
+		}
+	}
+
+	if got := sendCommand(c, conn, "ACL", "DRYRUN", "nosuchuser", "GET", "k"); got != "-ERR User 'nosuchuser' not found\r\n" {
+		t.Fatalf("ACL DRYRUN replied %q", got)
+	}
+	if got := sendCommand(c, conn, "ACL", "DRYRUN", "svc", "NOSUCHCOMMAND"); got != "-ERR Command 'NOSUCHCOMMAND' not found\r\n" {
+		t.Fatalf("ACL DRYRUN replied %q", got)
+	}
+	if got := sendCommand(c, conn, "ACL", "DRYRUN", "svc", "GET"); got != "-ERR wrong number of arguments for 'get' command\r\n" {
+		t.Fatalf("ACL DRYRUN replied %q", got)
+	}
+}
+
+func TestACLProcessCommandPermissions(t *testing.T) {
+	admin, adminConn := newTestClient()
+	defer freeClient(admin)
+	svc := setTestUser(t, admin, adminConn, "limited", "on", "nopass", "~acl:*", "+get", "+set", "+eval", "+multi", "+exec")
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	c.user = svc
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SET", "acl:a", "1"}, "+OK\r\n"},
+		{[]string{"GET", "acl:a"}, "$1\r\n1\r\n"},
+		{[]string{"GET", "other"}, "-NOPERM No permissions to access a key\r\n"},
+		{[]string{"FLUSHDB"}, "-NOPERM User limited has no permissions to run the 'flushdb' command\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', 'other')", "0"}, "-NOPERM No permissions to access a key\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', 'acl:a')", "0"}, "$1\r\n1\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"GET", "other"}, "-NOPERM No permissions to access a key\r\n"},
+		{[]string{"EXEC"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{[]string{"ACL", "WHOAMI"}, "-NOPERM User limited has no permissions to run the 'acl|whoami' command\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// Deleting the user closes its connections.
+	if got := sendCommand(admin, adminConn, "ACL", "DELUSER", "limited", "nosuchuser"); got != ":1\r\n" {
+		t.Fatalf("ACL DELUSER replied %q", got)
+	}
+	if c.flags&ClientCloseASAP == 0 || c.user != defaultUser {
+		t.Fatal("client of the deleted user not scheduled to be closed")
+	}
+	freeClientsInAsyncFreeQueue()
+	if c.connection != nil {
+		t.Fatal("client of the deleted user not freed")
+	}
+}
+
+func TestACLCommands(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "ACL", "WHOAMI"); got != "$7\r\ndefault\r\n" {
+		t.Fatalf("ACL WHOAMI replied %q", got)
+	}
+	setTestUser(t, c, conn, "alice", "on", ">secret", "~k*", "+@string", "(&ch +publish)")
+	if got := sendCommand(c, conn, "ACL", "USERS"); got != "*2\r\n$5\r\nalice\r\n$7\r\ndefault\r\n" {
+		t.Fatalf("ACL USERS replied %q", got)
+	}
+
+	want := "*12\r\n" +
+		"$5\r\nflags\r\n*2\r\n$2\r\non\r\n$16\r\nsanitize-payload\r\n" +
+		"$9\r\npasswords\r\n*1\r\n$64\r\n" + ACLHashPassword("secret") + "\r\n" +
+		"$8\r\ncommands\r\n$14\r\n-@all +@string\r\n" +
+		"$4\r\nkeys\r\n$3\r\n~k*\r\n" +
+		"$8\r\nchannels\r\n$0\r\n\r\n" +
+		"$9\r\nselectors\r\n*1\r\n*6\r\n" +
+		"$8\r\ncommands\r\n$14\r\n-@all +publish\r\n" +
+		"$4\r\nkeys\r\n$0\r\n\r\n" +
+		"$8\r\nchannels\r\n$3\r\n&ch\r\n"
+	if got := sendCommand(c, conn, "ACL", "GETUSER", "alice"); got != want {
+		t.Fatalf("ACL GETUSER replied %q, want %q", got, want)
+	}
+	if got := sendCommand(c, conn, "ACL", "GETUSER", "nosuchuser"); got != "$-1\r\n" {
+		t.Fatalf("ACL GETUSER replied %q", got)
+	}
+
+	if got := sendCommand(c, conn, "ACL", "CAT", "scripting"); !strings.Contains(got, "$4\r\neval\r\n") || !strings.Contains(got, "$13\r\nfunction|kill\r\n") {
+		t.Fatalf("ACL CAT scripting replied %q", got)
+	}
+	if got := sendCommand(c, conn, "ACL", "CAT"); !strings.HasPrefix(got, "*21\r\n$8\r\nkeyspace\r\n") {
+		t.Fatalf("ACL CAT replied %q", got)
+	}
+	if got := sendCommand(c, conn, "ACL", "CAT", "nosuchcategory"); got != "-ERR Unknown category 'nosuchcategory'\r\n" {
+		t.Fatalf("ACL CAT replied %q", got)
+	}
+
+	if got := sendCommand(c, conn, "ACL", "GENPASS"); !strings.HasPrefix(got, "$64\r\n") {
+		t.Fatalf("ACL GENPASS replied %q", got)
+	}
+	if got := sendCommand(c, conn, "ACL", "GENPASS", "5"); !strings.HasPrefix(got, "$2\r\n") {
+		t.Fatalf("ACL GENPASS 5 replied %q", got)
+	}
+	if got := sendCommand(c, conn, "ACL", "GENPASS", "0"); !strings.HasPrefix(got, "-ERR ACL GENPASS argument") {
+		t.Fatalf("ACL GENPASS 0 replied %q", got)
+	}
+}
+
+func TestACLLog(t *testing.T) {
+	admin, adminConn := newTestClient()
+	defer freeClient(admin)
+	svc := setTestUser(t, admin, adminConn, "logged", "on", ">pw", "~log:*", "+get", "+eval", "+multi")
+	if got := sendCommand(admin, adminConn, "ACL", "LOG", "RESET"); got != "+OK\r\n" {
+		t.Fatalf("ACL LOG RESET replied %q", got)
+	}
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	c.user = svc
+	sendCommand(c, conn, "GET", "other")
+	sendCommand(c, conn, "GET", "other")
+	sendCommand(c, conn, "SET", "log:a", "1")
+	sendCommand(c, conn, "EVAL", "return redis.call('GET', 'secret')", "0")
+	sendCommand(c, conn, "AUTH", "logged", "wrong")
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "GET", "other")
+
+	want := []struct {
+		count    uint64
+		reason   AclCheckAllPerm
+		context  ACLLogContext
+		object   string
+		username string
+	}{
+		{1, ACLDeniedKey, ACLLogCtxMulti, "other", "logged"},
+		{1, ACLDeniedAuth, ACLLogCtxToplevel, "AUTH", "logged"},
+		{1, ACLDeniedKey, ACLLogCtxLua, "secret", "logged"},
+		{1, ACLDeniedCmd, ACLLogCtxToplevel, "set", "logged"},
+		{2, ACLDeniedKey, ACLLogCtxToplevel, "other", "logged"},
+	}
+	if aclLog.Len() != len(want) {
+		t.Fatalf("ACL log has %d entries, want %d", aclLog.Len(), len(want))
+	}
+	node := aclLog.Head
+	for i, w := range want {
+		le := node.Value
+		if le.count != w.count || le.reason != w.reason || le.context != w.context || le.object != w.object || le.username != w.username {
+			t.Errorf("entry %d is %+v, want %+v", i, *le, w)
+		}
+		if !strings.Contains(le.cinfo, "id="+strconv.FormatUint(c.id, 10)+" ") {
+			t.Errorf("entry %d client info is %q", i, le.cinfo)
+		}
+		node = node.Next
+	}
+
+	got := sendCommand(admin, adminConn, "ACL", "LOG", "1")
+	if !strings.HasPrefix(got, "*1\r\n*20\r\n$5\r\ncount\r\n:1\r\n$6\r\nreason\r\n$3\r\nkey\r\n$7\r\ncontext\r\n$5\r\nmulti\r\n$6\r\nobject\r\n$5\r\nother\r\n$8\r\nusername\r\n$6\r\nlogged\r\n$11\r\nage-seconds\r\n") {
+		t.Fatalf("ACL LOG 1 replied %q", got)
+	}
+	if got := sendCommand(admin, adminConn, "ACL", "LOG", "-1"); got != "-ERR value is out of range, must be positive\r\n" {
+		t.Fatalf("ACL LOG -1 replied %q", got)
+	}
+
+	// The log is trimmed to acllog-max-len entries.
+	oldMaxLen := server.aclLogMaxLen
+	server.aclLogMaxLen = 2
+	defer func() { server.aclLogMaxLen = oldMaxLen }()
+	sendCommand(c, conn, "GET", "another")
+	if aclLog.Len() != 2 || aclLog.Head.Value.object != "another" {
+		t.Fatalf("ACL log not trimmed, %d entries", aclLog.Len())
+	}
+	if got := sendCommand(admin, adminConn, "ACL", "LOG", "RESET"); got != "+OK\r\n" || aclLog.Len() != 0 {
+		t.Fatalf("ACL LOG RESET replied %q", got)
+	}
+}
+
+func TestACLLoadSave(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "ACL", "SAVE"); !strings.HasPrefix(got, "-ERR This Redis instance is not configured to use an ACL file.") {
+		t.Fatalf("ACL SAVE replied %q", got)
+	}
+
+	filename := filepath.Join(t.TempDir(), "users.acl")
+	server.aclFilename = filename
+	defer func() { server.aclFilename = "" }()
+
+	setTestUser(t, c, conn, "saved", "on", ">pw", "~saved:*", "+get")
+	if got := sendCommand(c, conn, "ACL", "SAVE"); got != "+OK\r\n" {
+		t.Fatalf("ACL SAVE replied %q", got)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "user default on nopass sanitize-payload ~* &* +@all\n" +
+		"user saved on sanitize-payload #" + ACLHashPassword("pw") + " ~saved:* resetchannels -@all +get\n"
+	if string(content) != want {
+		t.Fatalf("ACL file is %q, want %q", content, want)
+	}
+
+	// An invalid file leaves the users untouched.
+	invalid := "user default on nopass ~* &* +@all\nuser bad +nosuchcommand\nnotauser x\nuser saved on\nuser saved off\n"
+	if err := os.WriteFile(filename, []byte(invalid), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wantErr := "-ERR " + filename + ":2: Unknown command or category name in ACL. " +
+		filename + ":3 should start with user keyword. " +
+		filename + ":5: duplicate user 'saved' is defined.\r\n"
+	if got := sendCommand(c, conn, "ACL", "LOAD"); got != wantErr {
+		t.Fatalf("ACL LOAD replied %q, want %q", got, wantErr)
+	}
+	if ACLGetUserByName("saved") == nil || ACLGetUserByName("bad") != nil {
+		t.Fatal("users changed by an invalid ACL file")
+	}
+
+	// A valid file replaces the users, the clients of the old users are
+	// disconnected.
+	other, _ := newTestClient()
+	defer freeClient(other)
+	other.user = ACLGetUserByName("saved")
+	if err := os.WriteFile(filename, []byte("# users\nuser loaded on nopass ~* +@all\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := sendCommand(c, conn, "ACL", "LOAD"); got != "+OK\r\n" {
+		t.Fatalf("ACL LOAD replied %q", got)
+	}
+	defer ACLFreeUserAndKillClients(ACLGetUserByName("loaded"), nil)
+	if got := sendCommand(c, conn, "ACL", "USERS"); got != "*2\r\n$7\r\ndefault\r\n$6\r\nloaded\r\n" {
+		t.Fatalf("ACL USERS replied %q", got)
+	}
+	if ACLGetUserByName("default") != defaultUser || ACLDescribeUser(defaultUser) != "on nopass sanitize-payload ~* &* +@all" {
+		t.Fatalf("default user not restored, %q", ACLDescribeUser(defaultUser))
+	}
+	if other.flags&ClientCloseASAP == 0 || other.user != defaultUser {
+		t.Fatal("client of the removed user not scheduled to be closed")
+	}
+	freeClientsInAsyncFreeQueue()
+}
+
+func TestACLConfiguredUsers(t *testing.T) {
+	s := NewServer(0)
+	if err := s.loadConfigFromString([]byte("user:\n  - default on >admin ~* +@all\n  - reader on nopass ~* +@read\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.usersToLoad) != 2 || s.usersToLoad[1][0] != "reader" {
+		t.Fatalf("users to load %v", s.usersToLoad)
+	}
+
+	old := server.usersToLoad
+	server.usersToLoad = s.usersToLoad
+	defer func() {
+		server.usersToLoad = old
+		ACLFreeUserAndKillClients(ACLGetUserByName("reader"), nil)
+		_ = ACLSetUser(defaultUser, "reset")
+		for _, op := range []string{"+@all", "~*", "&*", "on", "nopass"} {
+			_ = ACLSetUser(defaultUser, op)
+		}
+	}()
+	if err := ACLLoadUsersAtStartup(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ACLDescribeUser(defaultUser); got != "on sanitize-payload #"+ACLHashPassword("admin")+" ~* resetchannels +@all" {
+		t.Fatalf("default user described as %q", got)
+	}
+	if got := ACLDescribeUser(ACLGetUserByName("reader")); got != "on nopass sanitize-payload ~* resetchannels -@all +@read" {
+		t.Fatalf("reader described as %q", got)
+	}
+
+	server.aclFilename = "users.acl"
+	defer func() { server.aclFilename = "" }()
+	if err := ACLLoadUsersAtStartup(); err == nil || !strings.HasPrefix(err.Error(), "Configuring Redis with users defined in redis.conf and at the same setting an ACL file path is invalid.") {
+		t.Fatalf("ACLLoadUsersAtStartup returned %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package node
+
+import (
+	"time"
+)
+
+/* This file implements the generic support for the blocked clients: a client
+ * is blocked when the command it runs can't be served right now, its
+ * following commands are not processed until it is unblocked.
+ *
+ * Once unblocked, the client is queued in the unblocked clients, so that
+ * its pending command and query buffer are processed before the next event
+ * loop iteration and not in the middle of the command unblocking it.
+ *
+ * The clients are also blocked when the server is paused by CLIENT PAUSE:
+ * the commands that are paused are postponed until the pause ends. */
+
+// PauseType is the commands that are paused by CLIENT PAUSE.
+type PauseType uint8
+
+const (
+	ClientPauseOff   PauseType = iota // Pause no commands
+	ClientPauseWrite                  // Pause write commands
+	ClientPauseAll                    // Pause all commands
+)
+
+// blockClient blocks the client for the given operation type.
+func (c *Client) blockClient(btype BlockType) {
+	c.flags |= ClientBlocked
+	c.btype = btype
+}
+
+// blockPostponeClient blocks the client until the pause ends, its command
+// is run once it is unblocked.
+func (c *Client) blockPostponeClient() {
+	c.blockClient(BlockPostPone)
+	server.postponedClients.AddNodeTail(c)
+	// Mark this client to execute its command
+	c.flags |= ClientPendingCommand
+}
+
+// unblockClient unblocks the client, it is queued in the unblocked clients
+// to process its pending command and query buffer.
+func (c *Client) unblockClient() {
+	if c.btype == BlockPostPone {
+		if node := server.postponedClients.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.postponedClients.RemoveNode(node)
+		}
+	}
+
+	// Reset the client for a new query, unless the client has a pending
+	// command to process, or its SHUTDOWN failed and is still being
+	// processed: commandProcessed resets it.
+	if c.flags&ClientPendingCommand == 0 && (c.btype != BlockShutdown || c != server.currentClient) {
+		c.resetClient()
+	}
+
+	// Clear the flags, and put the client in the unblocked list so that
+	// we'll process new commands in its query buffer ASAP.
+	c.flags &= ^ClientBlocked
+	c.btype = BlockNone
+	if c.flags&ClientUnblocked == 0 {
+		c.flags |= ClientUnblocked
+		server.unblockedClients.AddNodeTail(c)
+	}
+}
+
+// processUnblockedClients runs the pending command of the unblocked clients,
+// and processes their query buffer.
+func (s *RedisServer) processUnblockedClients() {
+	for s.unblockedClients.Len() > 0 {
+		node := s.unblockedClients.Head
+		c := node.Value
+		_ = s.unblockedClients.RemoveNode(node)
+		c.flags &= ^ClientUnblocked
+
+		// Process remaining data in the input buffer, unless the client is
+		// blocked again.
+		if c.flags&ClientBlocked != 0 {
+			continue
+		}
+		if c.flags&ClientPendingCommand != 0 {
+			c.flags &= ^ClientPendingCommand
+			if !c.processCommandAndResetClient() {
+				continue
+			}
+		}
+		c.processInputBuffer()
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * Client pause
+ *----------------------------------------------------------------------------*/
+
+// pauseClients pauses the commands of the clients until the given unix time
+// in milliseconds. A pause never shortens or weakens the current one.
+func (s *RedisServer) pauseClients(end int64, ptype PauseType) {
+	if ptype > s.clientPauseType {
+		s.clientPauseType = ptype
+	}
+	if end > s.clientPauseEndTime {
+		s.clientPauseEndTime = end
+	}
+}
+
+// unpauseClients ends the pause, the postponed clients are unblocked.
+func (s *RedisServer) unpauseClients() {
+	s.clientPauseType = ClientPauseOff
+	s.clientPauseEndTime = 0
+
+	// Unblock all of the clients so they are reprocessed.
+	for s.postponedClients.Len() > 0 {
+		s.postponedClients.Head.Value.unblockClient()
+	}
+}
+
+// areClientsPaused reports whether the commands of the clients are paused.
+func (s *RedisServer) areClientsPaused() bool {
+	return s.clientPauseType != ClientPauseOff
+}
+
+// checkClientPauseTimeoutAndReturnIfPaused unpauses the clients if the pause
+// timeout is reached, it returns whether the clients are still paused.
+func (s *RedisServer) checkClientPauseTimeoutAndReturnIfPaused() bool {
+	if !s.areClientsPaused() {
+		return false
+	}
+	if s.clientPauseEndTime < time.Now().UnixMilli() {
+		s.unpauseClients()
+	}
+	return s.areClientsPaused()
+}
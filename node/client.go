@@ -2,9 +2,16 @@ package node
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/log"
 	"github.com/fzft/go-mock-redis/resp"
+	"go.uber.org/zap"
+	"io"
+	"math"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -62,15 +69,15 @@ const (
 )
 
 const (
-	ClientPendingWrite  ClientFlags = 1 << (21 + iota) // Client has output to send but a write handler is yet not installed.
-	ClientReplyOff                                     // Don't send replies to client.
-	ClientReplySkipNext                                // Set CLIENT_REPLY_SKIP_NEXT to skip next reply
-	ClientReplySkip                                    // Don't send just this reply.
-	ClientLuaDebug                                     // Run EVAL in debug mode.
-	ClientLuaDebugSync                                 // Run EVAL in debug mode but don't start the script if the debugger is not attached.
-	ClientModule                                       // Non connected client used by module API clients.
-	ClientProtected                                    // Client should not be freed for now.
-	ClientExecutingCommand                             /**Indicates that the client is currently in the process of handling
+	ClientPendingWrite     ClientFlags = 1 << (21 + iota) // Client has output to send but a write handler is yet not installed.
+	ClientReplyOff                                        // Don't send replies to client.
+	ClientReplySkipNext                                   // Set CLIENT_REPLY_SKIP_NEXT to skip next reply
+	ClientReplySkip                                       // Don't send just this reply.
+	ClientLuaDebug                                        // Run EVAL in debug mode.
+	ClientLuaDebugSync                                    // Run EVAL in debug mode but don't start the script if the debugger is not attached.
+	ClientModule                                          // Non connected client used by module API clients.
+	ClientProtected                                       // Client should not be freed for now.
+	ClientExecutingCommand                                /**Indicates that the client is currently in the process of handling
 		a command. usually this will be marked only during call()
 	however, blocked clients might have this flag kept until they will try to reprocess the command **/
 	ClientPendingCommand // Indicates the client has fully parsed command already for execution
@@ -81,6 +88,7 @@ const (
 	ClientTrackingOptOut
 	ClientTrackingCaching
 	ClientTrackingNoLoop
+	ClientTrackingBrokenRedir // Target client is invalid.
 
 	ClientInToTable
 	ClientProtocolError
@@ -94,6 +102,7 @@ const (
 	ClientModuleAuthHasResult
 	ClientModulePreventAOFProp
 	ClientModulePreventREPLProp
+	ClientPendingRead // The client has pending reads and was put in the queue, for the I/O threads.
 )
 
 type ClientType uint8
@@ -104,31 +113,62 @@ const (
 	ClientTypePubSub
 	ClientTypeMaster
 	ClientTypeCount
+	ClientTypeObufCount = ClientTypeMaster // Number of clients to expose to output buffer configuration. Just the first three: normal, slave, pubsub.
 )
 
+// clientReplyBlock is a block of the reply list, the output the connection
+// did not accept yet.
+type clientReplyBlock struct {
+	buf []byte // The used bytes, the capacity is the size of the block.
+}
+
 type Client struct {
-	id           uint64                 // client increment unique id
-	flags        ClientFlags            // client type flags
-	connection   Conn                   // socket file descriptor
-	resp         int                    // resp protocol version. Can be 2 or 3
-	db           *db.RedisDb            // pointer to currently SELECTed DB
-	queryBuf     []byte                 // buffer for client query
-	queryPos     int                    // current position in query buffer
-	argc         int                    // number of arguments in query buffer
-	argv         []*db.RedisObj         // arguments vector
-	argvLen      int                    // Size of argv array (may be more than argc)
-	argvLenSum   int                    // Sum of lengths of arguments
-	replies      *db.List[*db.RedisObj] // list of reply to send to client
-	cmd          RedisCommand           // command currently being processed
-	lastCmd      RedisCommand           // command currently being processed
-	realCmd      RedisCommand           // original command, if this is a replica
+	id           uint64                      // client increment unique id
+	flags        ClientFlags                 // client type flags
+	connection   Conn                        // socket file descriptor
+	resp         int                         // resp protocol version. Can be 2 or 3
+	name         string                      // As set by CLIENT SETNAME or HELLO SETNAME
+	db           *db.RedisDb                 // pointer to currently SELECTed DB
+	queryBuf     []byte                      // buffer for client query
+	queryPos     int                         // current position in query buffer
+	argc         int                         // number of arguments in query buffer
+	argv         []*db.RedisObj              // arguments vector
+	argvLen      int                         // Size of argv array (may be more than argc)
+	originalArgv []*db.RedisObj              // Arguments of the original command if arguments were rewritten, or redacted.
+	argvLenSum   int                         // Sum of lengths of arguments
+	replies      *db.List[*clientReplyBlock] // List of reply objects to send to the client.
+	replyBytes   int                         // Tot bytes of objects in reply list.
+	sentLen      int                         // Amount of bytes already sent in the current block.
+	cmd          RedisCommand                // command currently being processed
+	lastCmd      RedisCommand                // command currently being processed
+	realCmd      RedisCommand                // original command, if this is a replica
 	reqType      ClientProtoType
 	multiBulkLen int // number of multi bulk arguments left to read
 	bulkLen      int // length of bulk argument in multi bulk request
 	slot         int // The slot the client is executing against. Set to -1 if no slot is being used
 
+	obufSoftLimitReachedTime int64 // Time the output buffer soft limit was reached, 0 if not reached.
+	lastMemoryUsage          int64 // Memory used by the client buffers, as accounted in the used memory.
+
+	ctime           int64     // Client creation time, in seconds.
+	lastInteraction int64     // Time of the last interaction, used for timeout, in seconds.
+	btype           BlockType // Type of blocking op if ClientBlocked.
+	libName         string    // Client library name, as set by CLIENT SETINFO
+	libVer          string    // Client library version, as set by CLIENT SETINFO
+
+	clientListNode *db.ListNode[*Client] // list node in the server clients list
+
+	trackingRedirection uint64                // Client id the invalidation messages are sent to, 0 if none.
+	trackingPrefixes    *db.RaxTree[struct{}] // Prefixes tracked in BCAST mode, nil if none.
+
 	duration int64 // current command duration. Used for measuring latency of blocking commands
 
+	ioReadLen int   // Bytes read by the I/O thread.
+	ioWritten int   // Bytes written by the I/O thread.
+	ioErr     error // Error of the I/O thread read or write, handled by the event loop.
+
+	ioProtocolError string // Protocol error parsed by the I/O thread, replied by the event loop.
+
 	readReplOff int64 // Read replication offset if this is a master.
 	replOff     int64 // Applied replication offset if this is a master.
 	replApplied int64 // Applied replication data count in querybuf, if this is a replica.
@@ -138,71 +178,457 @@ type Client struct {
 
 	replId        [ConfigRunIdSize + 1]string // Master replication ID (if master)
 	mState        *MultiState                 // MULTI/EXEC state
+	user          *User                       // User associated with this connection. If the user is nil the client can do anything (scripting client for example).
 	authenticated bool                        // Needed when the default user requires auth.
 
+	watchedKeys *db.List[*watchedKey] // Keys WATCHED for MULTI/EXEC CAS
+
+	pubsubChannels *db.Set[string] // channels a client is interested in (SUBSCRIBE)
+	pubsubPatterns *db.Set[string] // patterns a client is interested in (PSUBSCRIBE)
 }
 
 func NewClient(id uint64, flags ClientFlags, connection Conn, resp int, rdb *db.RedisDb) *Client {
+	now := time.Now().Unix()
 	return &Client{
-		id:         id,
-		flags:      flags,
-		connection: connection,
-		resp:       resp,
-		db:         rdb,
-		queryBuf:   make([]byte, 0),
-		queryPos:   0,
-		argc:       0,
-		argv:       make([]*db.RedisObj, 0),
-		replies:    db.NewList[*db.RedisObj](),
+		id:              id,
+		flags:           flags,
+		connection:      connection,
+		resp:            resp,
+		db:              rdb,
+		queryBuf:        make([]byte, 0),
+		queryPos:        0,
+		argc:            0,
+		argv:            make([]*db.RedisObj, 0),
+		bulkLen:         -1,
+		slot:            -1,
+		ctime:           now,
+		lastInteraction: now,
+		replies:         db.NewList[*clientReplyBlock](),
+		mState:          &MultiState{},
+		user:            defaultUser,
+		watchedKeys:     db.NewList[*watchedKey](),
+		pubsubChannels:  db.NewSet[string](db.INITIAL_DB_SIZE),
+		pubsubPatterns:  db.NewSet[string](db.INITIAL_DB_SIZE),
+	}
+}
+
+// createClient creates the client bound to a new connection and links it to
+// the server clients.
+func (s *RedisServer) createClient(conn Conn) *Client {
+	s.nextClientId++
+	c := NewClient(s.nextClientId, 0, conn, 2, s.db[0])
+	if uc, ok := conn.(UnixSocketConn); ok && uc.IsUnixSocket() {
+		c.flags |= ClientUnixSocket
+	}
+	s.linkClient(c)
+	s.connClients[conn.Fd()] = c
+	s.statNumConnections++
+	return c
+}
+
+// protectedModeErr is sent to the external clients refused by the protected
+// mode before closing their connection.
+const protectedModeErr = "-DENIED Redis is running in protected mode because protected " +
+	"mode is enabled, no bind address was specified, no " +
+	"authentication password is requested to clients. In this mode " +
+	"connections are only accepted from the loopback interface. " +
+	"If you want to connect from external computers to Redis you " +
+	"may adopt one of the following solutions: " +
+	"1) Just disable protected mode sending the command " +
+	"'CONFIG SET protected-mode no' from the loopback interface " +
+	"by connecting to Redis from the same host the server is " +
+	"running, however MAKE SURE Redis is not publicly accessible " +
+	"from internet if you do so. " +
+	"2) Alternatively you can just disable the protected mode by " +
+	"editing the Redis configuration file, and setting the protected " +
+	"mode option to 'no', and then restarting the server. " +
+	"3) If you started the server manually just for testing, restart " +
+	"it with the '--protected-mode no' option. " +
+	"4) Setup a bind address or an authentication password. " +
+	"NOTE: You only need to do one of the above things in order for " +
+	"the server to start accepting connections from the outside.\r\n"
+
+// clientAcceptHandler checks the client of a new connection can be served.
+// With the protected mode enabled, the default bind addresses and no
+// password for the default user, only the clients connected from the
+// loopback interface or the unix socket are accepted, the others are sent
+// an error and freed. It returns false if the client was freed.
+func (s *RedisServer) clientAcceptHandler(c *Client) bool {
+	if s.protectedMode && s.isDefaultBindAddr() && defaultUser.flags&UserFlagNoPass != 0 &&
+		c.flags&ClientUnixSocket == 0 {
+		ip := net.ParseIP(c.connection.Ip())
+		if ip != nil && !ip.IsLoopback() {
+			// Nothing to do if we are unable to write, the client is
+			// freed anyway.
+			_, _ = c.connection.Write([]byte(protectedModeErr))
+			s.statRejectedConn++
+			freeClient(c)
+			return false
+		}
+	}
+	return true
+}
+
+// linkClient adds the client to the server clients, and to the index of the
+// clients by id.
+func (s *RedisServer) linkClient(c *Client) {
+	s.clients.AddNodeTail(c)
+	c.clientListNode = s.clients.Tail
+	s.clientsIndex.Insert(clientIdKey(c.id), c)
+}
+
+// clientIdKey returns the key of the client in the clients index: the id
+// in big endian, so that the clients are sorted by id.
+func clientIdKey(id uint64) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], id)
+	return key[:]
+}
+
+// clientIdFromKey returns the client id of a key of the clients index.
+func clientIdFromKey(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key)
+}
+
+// lookupClientByID returns the client with the given id, or nil if there is
+// no such client.
+func lookupClientByID(id uint64) *Client {
+	c, _ := server.clientsIndex.Find(clientIdKey(id))
+	return c
+}
+
+// freeClient unwatches all the keys, unsubscribes the client from every
+// Pub/Sub channel, unlinks it from the server and closes its connection.
+func freeClient(c *Client) {
+	// If a client is protected, yet we need to free it right now, make sure
+	// to at least use asynchronous freeing.
+	if c.flags&ClientProtected != 0 {
+		c.flags |= ClientCloseASAP
+		return
+	}
+
+	// Deallocate structures used to block on blocking ops.
+	if c.flags&ClientBlocked != 0 {
+		c.unblockClient()
+	}
+	// The client may be waiting to run its unblocked command.
+	if c.flags&ClientUnblocked != 0 {
+		if node := server.unblockedClients.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.unblockedClients.RemoveNode(node)
+		}
+		c.flags &= ^ClientUnblocked
+	}
+
+	// UNWATCH all the keys
+	c.unwatchAllKeys()
+
+	c.disableTracking()
+
+	// The client may be waiting for the I/O threads.
+	if c.flags&ClientPendingRead != 0 {
+		if node := server.clientsPendingRead.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.clientsPendingRead.RemoveNode(node)
+		}
+		c.flags &= ^ClientPendingRead
+	}
+	if c.flags&ClientPendingWrite != 0 {
+		if node := server.clientsPendingWrite.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.clientsPendingWrite.RemoveNode(node)
+		}
+		c.flags &= ^ClientPendingWrite
+	}
+
+	// The client may be scheduled to be freed asynchronously.
+	if c.flags&ClientCloseASAP != 0 {
+		if node := server.clientsToClose.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.clientsToClose.RemoveNode(node)
+		}
+	}
+
+	c.pubsubUnsubscribeAllChannels(false)
+	c.pubsubUnsubscribeAllPatterns(false)
+
+	// The monitors are slaves too, but they are not fed by the replication.
+	if c.flags&ClientMonitor != 0 {
+		if node := server.monitors.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.monitors.RemoveNode(node)
+		}
+	}
+
+	if c.connection != nil {
+		delete(server.connClients, c.connection.Fd())
+		if err := c.connection.Close(); err != nil {
+			log.Logger.Debug("Error closing client connection", zap.Uint64("id", c.id), zap.Error(err))
+		}
+		c.connection = nil
+	}
+
+	// Remove from the list of active clients.
+	if c.clientListNode != nil {
+		_ = server.clients.RemoveNode(c.clientListNode)
+		c.clientListNode = nil
+		server.clientsIndex.Delete(clientIdKey(c.id))
+	}
+
+	// Release the memory of the client buffers.
+	db.UpdateUsedMemory(-c.lastMemoryUsage)
+	c.lastMemoryUsage = 0
+}
+
+// freeClientAsync schedules the client to be freed by the server cron, it is
+// used when the client can not be freed synchronously, for example because
+// it is not the client running the current command.
+func freeClientAsync(c *Client) {
+	if c.flags&ClientCloseASAP != 0 || c.flags&ClientScript != 0 {
+		return
+	}
+	c.flags |= ClientCloseASAP
+	server.clientsToClose.AddNodeTail(c)
+}
+
+// freeClientsInAsyncFreeQueue frees the clients scheduled by freeClientAsync,
+// the protected clients are kept until they are unprotected. It returns the
+// number of clients freed.
+func freeClientsInAsyncFreeQueue() int {
+	freed := 0
+	iter := server.clientsToClose.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		c := node.Value
+		if c.flags&ClientProtected != 0 {
+			continue
+		}
+		_ = server.clientsToClose.RemoveNode(node)
+		freeClient(c)
+		freed++
+	}
+	return freed
+}
+
+// protectClient prevents the client from being freed while it is running a
+// long script, the events of the client are not served in the meantime.
+func (c *Client) protectClient() {
+	c.flags |= ClientProtected
+}
+
+// unprotectClient undoes protectClient, if the client was closed in the
+// meantime it is freed by the caller once the command returns.
+func (c *Client) unprotectClient() {
+	c.flags &= ^ClientProtected
+}
+
+// readQueryFromClient reads the data available on the client connection and
+// processes the commands it contains.
+func (c *Client) readQueryFromClient() {
+	// A protected client is running a long script, its query is read once the
+	// script returns, so that it is never executed in the middle of it.
+	if c.flags&ClientProtected != 0 {
+		return
+	}
+
+	// The query is read by the I/O threads, if enabled.
+	if postponeClientRead(c) {
+		return
+	}
+
+	server.statTotalReadsProcessed++
+	n, err := c.readQuery()
+	c.processReadQuery(n, err)
+}
+
+// readQuery appends the data available on the connection to the query
+// buffer, it returns the number of bytes read. It only changes the client,
+// so that it can be called from the I/O threads.
+func (c *Client) readQuery() (int, error) {
+	data, err := c.connection.Read()
+	if err != nil {
+		return 0, err
+	}
+	c.queryBuf = append(c.queryBuf, data...)
+	return len(data), nil
+}
+
+// processReadQuery handles the result of readQuery: the client is freed on
+// error, otherwise the commands of the query buffer are processed, starting
+// with the one already parsed by an I/O thread, if any.
+func (c *Client) processReadQuery(n int, err error) {
+	if err != nil {
+		if err == io.EOF {
+			log.Logger.Debug("Client closed connection", zap.Uint64("id", c.id))
+		} else {
+			log.Logger.Debug("Reading from client", zap.Uint64("id", c.id), zap.Error(err))
+		}
+		freeClient(c)
+		return
+	}
+
+	c.lastInteraction = time.Now().Unix()
+	server.statNetInputBytes += uint64(n)
+	if int64(len(c.queryBuf)-c.queryPos) > server.clientMaxQueryBufLen {
+		log.Logger.Warn("Closing client that reached max query buffer length", zap.String("client", c.catClientInfoString()))
+		freeClient(c)
+		return
+	}
+	if c.flags&ClientPendingCommand != 0 && c.flags&ClientBlocked == 0 {
+		c.flags &= ^ClientPendingCommand
+		if !c.processCommandAndResetClient() {
+			return
+		}
+	}
+	c.processInputBuffer()
+	updateClientMemUsage(c)
+
+	// The client waiting for its replies to be sent is freed once they are.
+	if c.flags&ClientCloseASAP != 0 || (c.flags&ClientCloseAfterReply != 0 && !c.hasPendingReplies()) {
+		freeClient(c)
 	}
 }
 
 /* Call is the core of redis execution of a command
 * the following flags can be passed:
 * CmdCallNone        No flags.
-* CmdCallPROPAGATEAOF   Append command to AOF if it modified the dataset
-*                          or if the client flags are forcing propagation.
-* CMD_CALL_PROPAGATE_REPL  Send command to slaves if it modified the dataset
-*                          or if the client flags are forcing propagation.
-* CMD_CALL_PROPAGATE   Alias for PROPAGATE_AOF|PROPAGATE_REPL.
-* CMD_CALL_FULL        Alias for SLOWLOG|STATS|PROPAGATE.
-*
-* The exact propagation behavior depends on the client flags.
-* Specifically:
+* CmdCallStats       Update the command calls and duration stats.
+* CmdCallFull        Alias for all the flags above.
  */
-func (c *Client) Call(flags int) {
-	c.cmd.Proc()
+func (c *Client) Call(flags CmdCallFlags) {
+	realCmd := c.cmd
+	oldFlags := c.flags
+	dictid := c.db.GetID() // The DB the command was issued in, SELECT changes it.
+
+	// Reset the error replies count, so that only the errors of this command
+	// are counted as failed calls.
+	incrCommandStatsOnError(nil, 0)
+
+	c.flags |= ClientExecutingCommand
+	start := time.Now()
+	err := c.cmd.Proc()(c)
+	duration := time.Since(start)
+	// The commands of a transaction are called while EXEC is executing.
+	if oldFlags&ClientExecutingCommand == 0 {
+		c.flags &= ^ClientExecutingCommand
+	}
+
+	if err != nil {
+		c.addReplyErrorFormat(err.Error())
+	}
+	// Update failed command calls if required.
+	incrCommandStatsOnError(realCmd, ErrorCommandFailed)
+
+	if flags&CmdCallStats != 0 {
+		realCmd.SetMicroSeconds(realCmd.MicroSeconds() + duration.Microseconds())
+		realCmd.SetCalls(realCmd.GetCalls() + 1)
+		// The duration needs to be reported also for the blocked commands,
+		// once they are unblocked.
+		if server.latencyTrackingEnabled && c.flags&ClientBlocked == 0 {
+			updateCommandLatencyHistogram(realCmd, duration.Nanoseconds())
+		}
+	}
+
+	// Log the command into the Slow log if needed. If the client is blocked
+	// the command did not run yet, it will be logged once unblocked.
+	if flags&CmdCallSlowLog != 0 && c.flags&ClientBlocked == 0 {
+		// Add the command to the latency monitor if needed.
+		event := LatencyEventCommand
+		if realCmd.Flags()&CmdFast != 0 {
+			event = LatencyEventFastCommand
+		}
+		latencyAddSampleIfNeeded(event, duration.Milliseconds())
+		slowlogPushCurrentCommand(c, realCmd, duration.Microseconds())
+	}
+	// Send the command to clients in MONITOR mode if applicable, since some
+	// administrative commands are considered too dangerous to be shown.
+	// The scripts are fed by themselves, before the commands they call.
+	if c.flags&ClientBlocked == 0 && realCmd.Flags()&(CmdSkipMonitor|CmdAdmin) == 0 {
+		replicationFeedMonitors(c, server.monitors, dictid, c.commandVector())
+	}
+
+	// The original arguments are only retained for the logging of this
+	// command, the next command of a transaction has its own.
+	c.originalArgv = nil
+
+	// If the client has keys tracking enabled for client side caching,
+	// make sure to remember the keys it fetched via this command. For
+	// read-only scripts, don't process the script, only the commands it
+	// executes.
+	if c.cmd.Flags()&CmdReadOnly != 0 && !isReadOnlyScriptCommand(c.cmd) {
+		// We use the tracking flag of the original external client that
+		// triggered the command, but we take the keys from the actual
+		// command being executed.
+		if cur := server.currentClient; cur != nil && cur.flags&ClientTracking != 0 && cur.flags&ClientTrackingBcast == 0 {
+			trackingRememberKeys(cur, c)
+		}
+	}
+
+	server.statNumCommands++
+}
+
+// commandVector returns the arguments of the current command as they must
+// be logged: the original arguments if they were rewritten or redacted.
+func (c *Client) commandVector() []*db.RedisObj {
+	if c.originalArgv != nil {
+		return c.originalArgv
+	}
+	return c.argv[:c.argc]
+}
+
+// retainOriginalCommandVector keeps a copy of the arguments of the current
+// command, before they are rewritten or redacted.
+func (c *Client) retainOriginalCommandVector() {
+	// We already rewrote this command, so don't rewrite it again
+	if c.originalArgv != nil {
+		return
+	}
+	c.originalArgv = make([]*db.RedisObj, c.argc)
+	copy(c.originalArgv, c.argv[:c.argc])
+}
+
+// redactClientCommandArgument redacts a given argument to prevent it from
+// being shown in the slowlog and MONITOR, the command itself still sees the
+// real argument.
+func (c *Client) redactClientCommandArgument(argc int) {
+	c.retainOriginalCommandVector()
+	c.originalArgv[argc] = SharedRedacted
+}
+
+// isReadOnlyScriptCommand reports whether the command runs a read only
+// script, the keys of such commands are not tracked.
+func isReadOnlyScriptCommand(cmd RedisCommand) bool {
+	switch cmd.Fullname() {
+	case "eval_ro", "evalsha_ro", "fcall_ro":
+		return true
+	}
+	return false
 }
 
 // rejectCommand used when a command that is ready for execution needs to be rejected
 func (c *Client) rejectCommand(reply *db.RedisObj) {
 	c.duration = 0
+	c.flagTransaction()
 	if c.cmd != nil {
 		c.cmd.SetRejectedCalls(c.cmd.GetRejectedCalls() + 1)
-		if c.cmd != nil && c.cmd.Fullname() == "ExecCommand" {
-			c.execCommandAbort(reply.Value.(string))
-		} else {
-			c.addReplyErrorObject(reply)
-		}
+	}
+	if c.cmd != nil && c.cmd.Fullname() == "exec" {
+		c.execCommandAbort(reply.Value.(string))
+	} else {
+		c.addReplyErrorObject(reply)
 	}
 }
 
 // rejectCommandStr used when a command that is ready for execution needs to be rejected
 func (c *Client) rejectCommandStr(reply string) {
-
 	c.duration = 0
+	c.flagTransaction()
 	if c.cmd != nil {
 		c.cmd.SetRejectedCalls(c.cmd.GetRejectedCalls() + 1)
-		if c.cmd != nil && c.cmd.Fullname() == "ExecCommand" {
-			c.execCommandAbort(reply)
-		} else {
-			c.addReplyErrorStr(reply)
-		}
+	}
+	if c.cmd != nil && c.cmd.Fullname() == "exec" {
+		c.execCommandAbort(reply)
+	} else {
+		c.addReplyErrorStr(reply)
 	}
 }
 
-func (c *Client) rejectCommandFormat(fmtstr string, a ...string) {
-	s := fmt.Sprintf(fmtstr, a)
+func (c *Client) rejectCommandFormat(fmtstr string, a ...any) {
+	s := fmt.Sprintf(fmtstr, a...)
 	s = mapChars(s, "\r\n", "  ")
 	c.rejectCommandStr(s)
 }
@@ -222,13 +648,12 @@ func (c *Client) AddReply(reply *db.RedisObj) {
 		return
 	}
 	if reply.EncodingObject() {
-		c.connection.Write([]byte(reply.Value.(string)))
+		c._addReplyToBufferOrList([]byte(reply.Value.(string)))
 	} else if reply.Encoding == db.EncodingInt {
-		c.connection.Write([]byte(fmt.Sprintf("%d", reply.Value.(int64))))
+		c._addReplyToBufferOrList([]byte(fmt.Sprintf("%d", reply.Value.(int64))))
 	} else {
 		panic("Wrong reply encoding in AddReply() ")
 	}
-
 }
 
 // addReplyProto this low level function just adds whatever protocol you send it to the
@@ -237,7 +662,267 @@ func (c *Client) addReplyProto(proto []byte) {
 	if !c.prepareClientToWrite() {
 		return
 	}
-	c.connection.Write(proto)
+	c._addReplyToBufferOrList(proto)
+}
+
+// _addReplyToBufferOrList writes the reply to the connection, the part the
+// connection does not accept is appended to the reply list, and sent by
+// writeToClient once the connection is writable.
+func (c *Client) _addReplyToBufferOrList(s []byte) {
+	// The reply is written by the I/O threads, if enabled.
+	if c.replies.Len() == 0 && !postponeClientWrite(c) {
+		n, err := c.connection.Write(s)
+		if err != nil {
+			log.Logger.Debug("Error writing to client", zap.Uint64("id", c.id), zap.Error(err))
+			freeClientAsync(c)
+			return
+		}
+		if c.flags&ClientScript == 0 {
+			server.statTotalWritesProcessed++
+			server.statNetOutputBytes += uint64(n)
+		}
+		if n == len(s) {
+			return
+		}
+		s = s[n:]
+		if wn, ok := c.connection.(WriteNotifier); ok {
+			if err := wn.SetWriteHandler(true); err != nil {
+				log.Logger.Debug("Error installing the write handler", zap.Uint64("id", c.id), zap.Error(err))
+				freeClientAsync(c)
+				return
+			}
+		}
+	}
+	c._addReplyProtoToList(s)
+}
+
+// _addReplyProtoToList appends the reply to the reply list, filling the last
+// block before allocating a new one of ProtoReplyChunkBytes, or of the size
+// of the reply if bigger.
+func (c *Client) _addReplyProtoToList(s []byte) {
+	if tail := c.replies.Tail; tail != nil {
+		// Copy the part we can fit into the tail, and leave the rest for a
+		// new node.
+		block := tail.Value
+		avail := cap(block.buf) - len(block.buf)
+		if avail > len(s) {
+			avail = len(s)
+		}
+		block.buf = append(block.buf, s[:avail]...)
+		s = s[avail:]
+		c.replyBytes += avail
+	}
+	if len(s) > 0 {
+		// Create a new node, make sure it is allocated to at least
+		// ProtoReplyChunkBytes.
+		size := len(s)
+		if size < ProtoReplyChunkBytes {
+			size = ProtoReplyChunkBytes
+		}
+		block := &clientReplyBlock{buf: make([]byte, 0, size)}
+		block.buf = append(block.buf, s...)
+		c.replies.AddNodeTail(block)
+		c.replyBytes += len(s)
+	}
+	closeClientOnOutputBufferLimitReached(c, true)
+}
+
+// hasPendingReplies reports whether the client has output the connection
+// did not accept yet.
+func (c *Client) hasPendingReplies() bool {
+	return c.replies.Len() > 0
+}
+
+// writeToClient writes the reply list to the connection, as much as it
+// accepts. Once the list is empty the write handler is removed, and the
+// client is freed if it was only waiting for its replies to be sent. The
+// write handler is installed if some replies are left and it is not
+// installed yet.
+func (c *Client) writeToClient(handlerInstalled bool) {
+	server.statTotalWritesProcessed++
+	written, err := c.writeReplies()
+	c.processWrittenReplies(written, err, handlerInstalled)
+}
+
+// writeReplies writes the reply list to the connection, as much as it
+// accepts, it returns the number of bytes written. The blocks are written
+// with a single Writev if the connection supports it. It only changes the
+// client, so that it can be called from the I/O threads.
+func (c *Client) writeReplies() (int, error) {
+	written := 0
+	vc, vectored := c.connection.(VectoredConn)
+	for c.replies.Len() > 0 {
+		var n int
+		var err error
+		block := c.replies.Head.Value
+		want := len(block.buf) - c.sentLen
+		if vectored && c.replies.Len() > 1 {
+			var bufs [][]byte
+			bufs, want = c.replyBufs()
+			n, err = vc.Writev(bufs)
+		} else {
+			n, err = c.connection.Write(block.buf[c.sentLen:])
+		}
+		if err != nil {
+			return written, err
+		}
+		written += n
+		c.consumeReplies(n)
+		if n < want {
+			// The connection can't accept more data right now.
+			break
+		}
+	}
+	return written, nil
+}
+
+// replyBufs returns the unsent part of the blocks at the head of the reply
+// list, up to IOVMax of them, and their total size.
+func (c *Client) replyBufs() ([][]byte, int) {
+	var bufs [][]byte
+	size := 0
+	iter := c.replies.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil && len(bufs) < IOVMax; node = iter.NextNode() {
+		buf := node.Value.buf
+		if len(bufs) == 0 {
+			buf = buf[c.sentLen:]
+		}
+		bufs = append(bufs, buf)
+		size += len(buf)
+	}
+	return bufs, size
+}
+
+// consumeReplies removes the n bytes sent from the head of the reply list.
+func (c *Client) consumeReplies(n int) {
+	for n > 0 {
+		node := c.replies.Head
+		block := node.Value
+		left := len(block.buf) - c.sentLen
+		if n < left {
+			c.sentLen += n
+			return
+		}
+		n -= left
+		c.replyBytes -= len(block.buf)
+		c.sentLen = 0
+		_ = c.replies.RemoveNode(node)
+	}
+}
+
+// processWrittenReplies handles the result of writeReplies, see
+// writeToClient.
+func (c *Client) processWrittenReplies(written int, err error, handlerInstalled bool) {
+	if err != nil {
+		log.Logger.Debug("Error writing to client", zap.Uint64("id", c.id), zap.Error(err))
+		freeClient(c)
+		return
+	}
+	// For clients representing masters we don't count sending data as an
+	// interaction, since we always send REPLCONF ACK commands that take
+	// some time to just fill the socket output buffer.
+	server.statNetOutputBytes += uint64(written)
+	if written > 0 && c.flags&ClientMaster == 0 {
+		c.lastInteraction = time.Now().Unix()
+	}
+	updateClientMemUsage(c)
+
+	wn, notifier := c.connection.(WriteNotifier)
+	if c.hasPendingReplies() {
+		if !handlerInstalled && notifier {
+			if err := wn.SetWriteHandler(true); err != nil {
+				log.Logger.Debug("Error installing the write handler", zap.Uint64("id", c.id), zap.Error(err))
+				freeClientAsync(c)
+			}
+		}
+		return
+	}
+
+	if handlerInstalled && notifier {
+		if err := wn.SetWriteHandler(false); err != nil {
+			log.Logger.Debug("Error removing the write handler", zap.Uint64("id", c.id), zap.Error(err))
+		}
+	}
+	// Close connection after entire reply has been sent.
+	if c.flags&ClientCloseAfterReply != 0 {
+		freeClient(c)
+	}
+}
+
+// getClientOutputBufferMemoryUsage returns the number of bytes the client is
+// using in its reply list, the output not accepted by the connection.
+func getClientOutputBufferMemoryUsage(c *Client) int64 {
+	return int64(c.replyBytes)
+}
+
+// getClientMemoryUsage returns the memory used by the client buffers, the
+// query buffer and the reply list.
+func getClientMemoryUsage(c *Client) int64 {
+	return int64(cap(c.queryBuf)) + getClientOutputBufferMemoryUsage(c)
+}
+
+// updateClientMemUsage accounts in the used memory for the change of the
+// memory used by the client buffers since the last call. The freed clients
+// are not accounted for anymore.
+func updateClientMemUsage(c *Client) {
+	if c.clientListNode == nil {
+		return
+	}
+	mem := getClientMemoryUsage(c)
+	db.UpdateUsedMemory(mem - c.lastMemoryUsage)
+	c.lastMemoryUsage = mem
+}
+
+// checkClientOutputBufferLimits reports whether the client reached the hard
+// output buffer limit of its class, or stayed over the soft limit for longer
+// than the soft limit seconds.
+func checkClientOutputBufferLimits(c *Client) bool {
+	usedMem := getClientOutputBufferMemoryUsage(c)
+	class := getClientType(c)
+	// For the purpose of output buffer limiting, masters are handled
+	// like normal clients.
+	if class == ClientTypeMaster {
+		class = ClientTypeNormal
+	}
+	limits := server.clientObufLimits[class]
+
+	hard := limits.hardLimitBytes != 0 && usedMem >= limits.hardLimitBytes
+	soft := limits.softLimitBytes != 0 && usedMem >= limits.softLimitBytes
+
+	// We need to check if the soft limit is reached continuously for the
+	// specified amount of seconds.
+	if soft {
+		now := time.Now().Unix()
+		if c.obufSoftLimitReachedTime == 0 {
+			c.obufSoftLimitReachedTime = now
+			soft = false // First time we see the soft limit reached
+		} else if now-c.obufSoftLimitReachedTime <= limits.softLimitSeconds {
+			soft = false // The client still did not reach the max number of seconds for the soft limit to be considered reached.
+		}
+	} else {
+		c.obufSoftLimitReachedTime = 0
+	}
+	return soft || hard
+}
+
+// closeClientOnOutputBufferLimitReached closes the client if it reached the
+// output buffer limits of its class. The client is freed asynchronously if
+// async is true, as it may be in the middle of a command. It returns true
+// if the client is going to be closed.
+func closeClientOnOutputBufferLimitReached(c *Client, async bool) bool {
+	if c.replyBytes == 0 || c.flags&(ClientCloseASAP|ClientScript) != 0 {
+		return false
+	}
+	if !checkClientOutputBufferLimits(c) {
+		return false
+	}
+	log.Logger.Warn("Client scheduled to be closed ASAP for overcoming of output buffer limits.", zap.String("client", c.catClientInfoString()))
+	if async {
+		freeClientAsync(c)
+	} else {
+		freeClient(c)
+	}
+	return true
 }
 
 // AddReplyBulk ...
@@ -247,6 +932,128 @@ func (c *Client) AddReplyBulk(obj *db.RedisObj) {
 	c.addReplyProto([]byte(resp.CRLF))
 }
 
+// addReplyBulkCString add a Go string as bulk reply
+func (c *Client) addReplyBulkCString(s string) {
+	c.addReplyLongLongWithPrefix(resp.TypeBlob, int64(len(s)))
+	c.addReplyProto([]byte(s))
+	c.addReplyProto([]byte(resp.CRLF))
+}
+
+// addReplyVerbatim add a verbatim string of the given format ("txt", "mkd")
+// as reply, RESP2 clients get a bulk string.
+func (c *Client) addReplyVerbatim(s string, ext string) {
+	if c.resp == 2 {
+		c.addReplyBulkCString(s)
+		return
+	}
+	c.addReplyLongLongWithPrefix(resp.TypeVerbatim, int64(len(s)+4))
+	c.addReplyProto([]byte(ext + ":"))
+	c.addReplyProto([]byte(s))
+	c.addReplyProto([]byte(resp.CRLF))
+}
+
+// addReplyStatus add a simple status reply, like +OK
+func (c *Client) addReplyStatus(status string) {
+	c.addReplyProto([]byte{resp.TypeSimple})
+	c.addReplyProto([]byte(status))
+	c.addReplyProto([]byte(resp.CRLF))
+}
+
+// addReplyLongLong add a long long as integer reply
+func (c *Client) addReplyLongLong(ll int64) {
+	if ll == 0 {
+		c.AddReply(SharedZCone)
+	} else if ll == 1 {
+		c.AddReply(SharedCone)
+	} else {
+		c.addReplyLongLongWithPrefix(resp.TypeInteger, ll)
+	}
+}
+
+// addReplyDouble add a double as a RESP3 double reply, RESP2 clients get a
+// bulk string.
+func (c *Client) addReplyDouble(d float64) {
+	s := strconv.FormatFloat(d, 'g', -1, 64)
+	if math.IsInf(d, 0) {
+		s = "inf"
+		if d < 0 {
+			s = "-inf"
+		}
+	}
+	if c.resp == 2 {
+		c.addReplyBulkCString(s)
+	} else {
+		c.addReplyProto([]byte{resp.TypeDouble})
+		c.addReplyProto([]byte(s))
+		c.addReplyProto([]byte(resp.CRLF))
+	}
+}
+
+// addReplyAggregateLen emits the header of an aggregate reply (array, map, ...)
+func (c *Client) addReplyAggregateLen(length int, prefix byte) {
+	c.addReplyLongLongWithPrefix(prefix, int64(length))
+}
+
+func (c *Client) addReplyArrayLen(length int) {
+	c.addReplyAggregateLen(length, resp.TypeArray)
+}
+
+// addReplyNull emits the null bulk, RESP2 clients get "$-1".
+func (c *Client) addReplyNull() {
+	if c.resp == 2 {
+		c.AddReply(SharedNull2)
+	} else {
+		c.AddReply(SharedNull3)
+	}
+}
+
+// addReplyNullArray emits the null array, RESP2 clients get "*-1".
+func (c *Client) addReplyNullArray() {
+	if c.resp == 2 {
+		c.AddReply(SharedNullArray2)
+	} else {
+		c.AddReply(SharedNullArray3)
+	}
+}
+
+// addReplyMapLen emits a map header, RESP2 clients get a flat array with
+// twice the elements.
+func (c *Client) addReplyMapLen(length int) {
+	if c.resp == 2 {
+		c.addReplyAggregateLen(length*2, resp.TypeArray)
+	} else {
+		c.addReplyAggregateLen(length, resp.TypeMap)
+	}
+}
+
+// addReplySetLen emits a set header, RESP2 clients get an array.
+func (c *Client) addReplySetLen(length int) {
+	if c.resp == 2 {
+		c.addReplyAggregateLen(length, resp.TypeArray)
+	} else {
+		c.addReplyAggregateLen(length, resp.TypeSet)
+	}
+}
+
+// addReplyPushLen emits the header of a RESP3 push message
+func (c *Client) addReplyPushLen(length int) {
+	c.addReplyAggregateLen(length, resp.TypePush)
+}
+
+// addReplyHelp add the help reply of a container command, the header and the
+// HELP entry are added to the given lines.
+func (c *Client) addReplyHelp(help []string) {
+	cmd := strings.ToUpper(c.argv[0].Value.(string))
+
+	c.addReplyArrayLen(len(help) + 3)
+	c.addReplyStatus(fmt.Sprintf("%s <subcommand> [<arg> [value] [opt] ...]. Subcommands are:", cmd))
+	for _, line := range help {
+		c.addReplyStatus(line)
+	}
+	c.addReplyStatus("HELP")
+	c.addReplyStatus("    Print this help.")
+}
+
 // AddReplyError ...
 func (c *Client) AddReplyError(err string) {
 	c.addReplyErrorLength(err)
@@ -257,9 +1064,10 @@ func (c *Client) AddReplyError(err string) {
 // low level function called by the AddReplyError...() functions
 // It emits the protocol for a redis error, in the form:
 // -ERRORCODE Error Message\r\n
+// If the error string does not start with "-", the "-ERR " code is used.
 func (c *Client) addReplyErrorLength(err string) {
-	if len(err) > 0 && err[0] == '-' {
-		c.addReplyProto([]byte("-ERR"))
+	if len(err) == 0 || err[0] != '-' {
+		c.addReplyProto([]byte("-ERR "))
 	}
 	c.addReplyProto([]byte(err))
 	c.addReplyProto([]byte(resp.CRLF))
@@ -270,8 +1078,14 @@ func (c *Client) AddReplyErrorExpireTime() {
 	c.addReplyErrorFormat(fmt.Sprintf("invalid expire time in '%s' command", c.cmd.Fullname()))
 }
 
+// addReplyErrorArity ...
+func (c *Client) addReplyErrorArity() {
+	c.addReplyErrorFormat(fmt.Sprintf("wrong number of arguments for '%s' command", c.cmd.Fullname()))
+}
+
 // addReplyErrorFormat
 func (c *Client) addReplyErrorFormat(err string) {
+	err = mapChars(err, "\r\n", "  ")
 	c.addReplyErrorLength(err)
 	c.afterErrorReply(err)
 }
@@ -288,9 +1102,38 @@ func (c *Client) addReplyErrorStr(err string) {
 	c.afterErrorReply(err)
 }
 
-// afterErrorReply ...
-// TODO:
+// afterErrorReply updates the error stats once an error reply is emitted:
+// the error is counted under its code, the first word of the error, or ERR
+// if the error has no code.
 func (c *Client) afterErrorReply(err string) {
+	server.statTotalErrorReplies++
+	// Errors may have a code, or "ERR"
+	if len(err) == 0 || err[0] != '-' {
+		server.incrementErrorCount("ERR")
+	} else {
+		head := err
+		if len(head) > 32 {
+			head = head[:32]
+		}
+		if space := strings.IndexByte(head, ' '); space > 0 {
+			server.incrementErrorCount(err[1:space])
+		} else {
+			// Fallback to ERR if we can't retrieve the error prefix
+			server.incrementErrorCount("ERR")
+		}
+	}
+
+	// Sometimes it could be normal that a replica replies to a master with
+	// an error, but it is worth to log it since it is likely a bug.
+	if ctype := getClientType(c); ctype == ClientTypeMaster || ctype == ClientTypeSlave {
+		to, from := "master", "replica"
+		if ctype == ClientTypeMaster {
+			to, from = "replica", "master"
+		}
+		log.Logger.Warn("== CRITICAL == This "+to+" is sending an error to its "+from,
+			zap.String("error", strings.TrimRight(err, "\r\n")))
+		server.statUnexpectedErrorReplies++
+	}
 }
 
 // addReplyBulkLen
@@ -343,6 +1186,20 @@ func (c *Client) prepareClientToWrite() bool {
 	return true
 }
 
+// setProtocolError replies with the protocol error and flags the client so
+// that it is closed once the reply is sent. The error parsed by an I/O thread
+// is only recorded, the reply is sent by the event loop, see
+// handleClientsWithPendingReads.
+func (c *Client) setProtocolError(reply, errstr string) {
+	if c.flags&ClientPendingRead != 0 {
+		c.ioProtocolError = reply
+	} else {
+		c.AddReplyError(reply)
+	}
+	log.Logger.Debug("Protocol error from client", zap.Uint64("id", c.id), zap.String("error", errstr))
+	c.flags |= ClientCloseAfterReply | ClientProtocolError
+}
+
 /* processInputBuffer This function is called every time, in the client structure 'c', there is
 * more query buffer to process, because we read more data from the socket
 * or because a client was blocked and later reactivated, so there could be
@@ -372,15 +1229,31 @@ func (c *Client) processInputBuffer() bool {
 			} else {
 				c.reqType = ClientProtoTypeInline
 			}
+		}
+
+		if c.reqType == ClientProtoTypeInline {
+			if !c.processInlineBuffer() {
+				break
+			}
+		} else if c.reqType == ClientProtoTypeMultiBulk {
+			if !c.processMultibulkBuffer() {
+				break
+			}
 		} else {
-			panic("Unknown client reqtype")
+			panic("Unknown request type")
 		}
 
+		// Multibulk processing could see a <= 0 length.
 		if c.argc == 0 {
 			c.resetClient()
+		} else if c.flags&ClientPendingRead != 0 {
+			// Parsed by an I/O thread, the command is run by the event
+			// loop, see handleClientsWithPendingReads.
+			c.flags |= ClientPendingCommand
+			break
 		} else {
 			// we are finally ready to execute the command
-			if err := c.processCommandAndResetClient(); err != nil {
+			if !c.processCommandAndResetClient() {
 				/* If the client is no longer valid, we avoid exiting this
 				 * loop and trimming the client buffer later. So we return
 				 * ASAP in that case. */
@@ -418,62 +1291,51 @@ func (c *Client) processInputBuffer() bool {
 
 // processInlineBuffer for the inline protocol instead of RESP
 // this function consume the client query buffer and creates a command ready
-// to be executed. or returns C_ERR if the client query buffer is not
+// to be executed. or returns false if the client query buffer is not
+// yet holding a full command.
 func (c *Client) processInlineBuffer() bool {
 
 	var linefeedChars = 1
 
 	// Search for end of line
-	p := bytes.IndexByte(c.queryBuf[c.queryPos:], '\n')
+	newline := bytes.IndexByte(c.queryBuf[c.queryPos:], '\n')
 
 	// Nothing to do without a \r\n
-	if p == -1 {
-		if len(c.queryBuf)-c.queryPos >= ProtoInlineMaxSize {
-			c.AddReplyError("Protocol error: too big inline request")
-			c.queryBuf = make([]byte, 0)
-			c.queryPos = 0
+	if newline == -1 {
+		if len(c.queryBuf)-c.queryPos > ProtoInlineMaxSize {
+			c.setProtocolError("Protocol error: too big inline request", "too big inline request")
 		}
+		return false
 	}
+	newline += c.queryPos
 
 	// Handle the \r\n case.
-	if p != 0 && c.queryBuf[p-1] == '\r' {
-		p--
+	if newline != c.queryPos && c.queryBuf[newline-1] == '\r' {
+		newline--
 		linefeedChars++
 	}
 
-	queryLen := p - c.queryPos
-	aux := string(c.queryBuf[c.queryPos : c.queryPos+queryLen])
+	queryLen := newline - c.queryPos
+	aux := string(c.queryBuf[c.queryPos:newline])
 
 	// Splitting the string into an array (slice in Go) of strings
 	argv := strings.Fields(aux)
 
-	// Check if argv could not be created, perhaps due to unbalanced quotes
-	// (In the real world, you'd actually try to detect this more rigorously)
-	if argv == nil {
-		// Do error handling, e.g., send a reply or set an error flag
-		c.AddReplyError("Protocol error: unbalanced quotes in request")
-		return false
-	}
-
-	if queryLen == 0 && c.flags == ClientSlave {
+	if queryLen == 0 && c.flags&ClientSlave != 0 {
 		c.replAckTime = time.Now().Unix()
 	}
 
 	// TODO: ClientMaster
 
 	c.queryPos += queryLen + linefeedChars
-	argvLen := len(argv)
 
-	if argvLen > 0 {
-		c.argvLen = argvLen
-		c.argv = make([]*db.RedisObj, c.argvLen)
-		c.argvLenSum = 0
-	}
+	c.argvLen = len(argv)
+	c.argv = make([]*db.RedisObj, 0, c.argvLen)
+	c.argvLenSum = 0
 
 	// create redis object for each argument
 	for _, arg := range argv {
-		newObj := createObject(db.StringType, arg) // Assuming CreateObject returns a new Redis object
-		c.argv = append(c.argv, newObj)
+		c.argv = append(c.argv, createObject(db.StringType, arg))
 		c.argc++
 		c.argvLenSum += len(arg)
 	}
@@ -481,26 +1343,136 @@ func (c *Client) processInlineBuffer() bool {
 	return true
 }
 
-// resetClient prepare the client to process the next command
-func (c *Client) resetClient() {
+/* processMultibulkBuffer Process the query buffer for client 'c', setting up the client argument
+ * vector for command execution. Returns true if after running the function
+ * the client has a well-formed ready to be processed command, otherwise
+ * false if there is still to read more buffer to get the full command.
+ * The function also returns false when there is a protocol error: in such a
+ * case the client structure is setup to reply with the error and close
+ * the connection. */
+func (c *Client) processMultibulkBuffer() bool {
+	if c.multiBulkLen == 0 {
+		// Multi bulk length cannot be read without a \r\n
+		newline := bytes.IndexByte(c.queryBuf[c.queryPos:], '\r')
+		if newline == -1 {
+			if len(c.queryBuf)-c.queryPos > ProtoInlineMaxSize {
+				c.setProtocolError("Protocol error: too big mbulk count string", "too big mbulk count string")
+			}
+			return false
+		}
+		newline += c.queryPos
 
-	var prevCmd RedisCommand
+		// Buffer should also contain \n
+		if newline+1 >= len(c.queryBuf) {
+			return false
+		}
 
-	if c.cmd != nil {
-		prevCmd = c.cmd
+		// We know for sure there is a whole line since newline != -1,
+		// so go ahead and find out the multi bulk length.
+		ll, err := strconv.ParseInt(string(c.queryBuf[c.queryPos+1:newline]), 10, 64)
+		if err != nil || ll > ProtoMaxMultiBulkLen {
+			c.setProtocolError("Protocol error: invalid multibulk length", "invalid mbulk count")
+			return false
+		}
+
+		c.queryPos = newline + 2
+
+		if ll <= 0 {
+			return true
+		}
+
+		c.multiBulkLen = int(ll)
+
+		// Setup argv array on client structure
+		c.argvLen = c.multiBulkLen
+		if c.argvLen > 1024 {
+			c.argvLen = 1024
+		}
+		c.argv = make([]*db.RedisObj, 0, c.argvLen)
+		c.argvLenSum = 0
+	}
+
+	for c.multiBulkLen > 0 {
+		// Read bulk length if unknown
+		if c.bulkLen == -1 {
+			newline := bytes.IndexByte(c.queryBuf[c.queryPos:], '\r')
+			if newline == -1 {
+				if len(c.queryBuf)-c.queryPos > ProtoInlineMaxSize {
+					c.setProtocolError("Protocol error: too big bulk count string", "too big bulk count string")
+					return false
+				}
+				break
+			}
+			newline += c.queryPos
+
+			// Buffer should also contain \n
+			if newline+1 >= len(c.queryBuf) {
+				break
+			}
+
+			if c.queryBuf[c.queryPos] != '$' {
+				c.setProtocolError(fmt.Sprintf("Protocol error: expected '$', got '%c'", c.queryBuf[c.queryPos]), "expected $ but got something else")
+				return false
+			}
+
+			ll, err := strconv.ParseInt(string(c.queryBuf[c.queryPos+1:newline]), 10, 64)
+			if err != nil || ll < 0 || ll > ProtoMaxBulkLen {
+				c.setProtocolError("Protocol error: invalid bulk length", "invalid bulk length")
+				return false
+			}
+
+			c.queryPos = newline + 2
+			c.bulkLen = int(ll)
+		}
+
+		// Read bulk argument, not enough data (+2 == trailing \r\n)
+		if len(c.queryBuf)-c.queryPos < c.bulkLen+2 {
+			break
+		}
+
+		arg := string(c.queryBuf[c.queryPos : c.queryPos+c.bulkLen])
+		c.argv = append(c.argv, createObject(db.StringType, arg))
+		c.argc++
+		c.argvLenSum += c.bulkLen
+		c.queryPos += c.bulkLen + 2
+		c.bulkLen = -1
+		c.multiBulkLen--
 	}
 
+	// We're done when c.multiBulkLen == 0
+	return c.multiBulkLen == 0
+}
+
+// freeClientArgv drops the arguments of the last command.
+func (c *Client) freeClientArgv() {
+	c.originalArgv = nil
+	c.argv = nil
+	c.argc = 0
+	c.argvLen = 0
+	c.argvLenSum = 0
+	c.cmd = nil
+}
+
+// resetClient prepare the client to process the next command
+func (c *Client) resetClient() {
+	prevCmd := c.cmd
+
+	c.freeClientArgv()
 	c.reqType = ClientProtoTypeUnknown
 	c.multiBulkLen = 0
 	c.bulkLen = -1
 	c.slot = -1
 	c.flags &= ^ClientExecutingCommand
 
-	if c.flags&ClientMulti == 0 && prevCmd.Fullname() != "asking" {
+	/* Remove the CLIENT_ASKING flag if we are not inside a MULTI, and
+	 * if what we just executed is not the ASKING command itself. */
+	if c.flags&ClientMulti == 0 && (prevCmd == nil || prevCmd.Fullname() != "asking") {
 		c.flags &= ^ClientAsking
 	}
 
-	if c.flags&ClientMulti == 0 && prevCmd.Fullname() != "client" {
+	/* Remove the CLIENT_TRACKING_CACHING flag unless the command was
+	 * CLIENT CACHING. */
+	if c.flags&ClientMulti == 0 && (prevCmd == nil || prevCmd.Fullname() != "client|caching") {
 		c.flags &= ^ClientTrackingCaching
 	}
 
@@ -511,16 +1483,33 @@ func (c *Client) resetClient() {
 	}
 }
 
-func (c *Client) processCommandAndResetClient() error {
-	if c.processCommand() {
-
+// commandProcessed performs the operations needed after a command was executed
+func (c *Client) commandProcessed() {
+	if c.flags&ClientBlocked == 0 {
+		c.resetClient()
 	}
+}
 
-	return nil
+// processCommandAndResetClient executes the command in the client argv and
+// prepares the client for the next one. It returns false if the client
+// must not be used anymore.
+func (c *Client) processCommandAndResetClient() bool {
+	oldClient := server.currentClient
+	server.currentClient = c
+	if c.processCommand() {
+		c.commandProcessed()
+	}
+	// The invalidations of the keys modified by the client itself are sent
+	// after the reply of the command.
+	trackingHandlePendingKeyInvalidations()
+	server.currentClient = oldClient
+	return c.flags&ClientCloseASAP == 0
 }
 
 // processCommand if this function gets called we already read a whole
-// command , arguments are in c.argv/argc fields
+// command , arguments are in c.argv/argc fields. The command is executed, or
+// rejected with an error reply. false is returned if the client was
+// scheduled to be closed.
 func (c *Client) processCommand() bool {
 	// TODO:script is timeout
 	var clientReprocessingCommand bool
@@ -530,6 +1519,8 @@ func (c *Client) processCommand() bool {
 
 	// Handle possible security attacks.
 	if strings.EqualFold(c.argv[0].Value.(string), "host:") || strings.EqualFold(c.argv[0].Value.(string), "post") {
+		log.Logger.Warn("Possible SECURITY ATTACK detected. It looks like somebody is sending POST or Host: commands to Redis. This is likely due to an attacker attempting to use Cross Protocol Scripting to compromise your Redis instance. Connection aborted.")
+		c.flags |= ClientCloseASAP
 		return false
 	}
 
@@ -551,9 +1542,9 @@ func (c *Client) processCommand() bool {
 		}
 		//check if the command is marked as protected and the relevant configuration allows it
 		if c.cmd.Flags()&CmdProtected != 0 {
-			if c.cmd.Fullname() == "debugCommand" || c.cmd.Fullname() == "module" {
+			if c.cmd.Fullname() == "debug" || c.cmd.Fullname() == "module" {
 				var cmdEnable, cmdName string
-				if c.cmd.Fullname() == "debugCommand" {
+				if c.cmd.Fullname() == "debug" {
 					cmdName = "DEBUG"
 					cmdEnable = "enable-debug-command"
 				} else {
@@ -567,13 +1558,13 @@ func (c *Client) processCommand() bool {
 	}
 
 	//cmdFlags := c.cmd.Flags()
-	//isReadCmd := cmdFlags&CmdReadOnly != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&CmdReadOnly != 0)
-	//isWriteCmd := cmdFlags&CmdWrite != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&CmdWrite != 0)
-	//isDenyOOMCmd := cmdFlags&CmdDenyOOM != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&CmdDenyOOM != 0)
-	//isDenyStableCmd := cmdFlags&CmdStale != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&CmdStale != 0)
-	//isDenyLoadingCmd := cmdFlags&CmdLoading != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&CmdLoading != 0)
-	//isMayReplCmd := cmdFlags&(CmdWrite|CmdMayReplicate) != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&(CmdWrite|CmdMayReplicate) != 0)
-	//isDenyAsyncLoadingCmd := cmdFlags&CmdNoAsyncLoading != 0 || (c.cmd.Fullname() == "execCommand" && c.mState.cmdFlags&CmdNoAsyncLoading != 0)
+	//isReadCmd := cmdFlags&CmdReadOnly != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdReadOnly != 0)
+	//isWriteCmd := cmdFlags&CmdWrite != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdWrite != 0)
+	//isDenyOOMCmd := cmdFlags&CmdDenyOOM != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdDenyOOM != 0)
+	//isDenyStableCmd := cmdFlags&CmdStale != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdStale != 0)
+	//isDenyLoadingCmd := cmdFlags&CmdLoading != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdLoading != 0)
+	//isMayReplCmd := cmdFlags&(CmdWrite|CmdMayReplicate) != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&(CmdWrite|CmdMayReplicate) != 0)
+	//isDenyAsyncLoadingCmd := cmdFlags&CmdNoAsyncLoading != 0 || (c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdNoAsyncLoading != 0)
 	//isObeyClient := c.mustObeyClient()
 
 	if c.authRequired() {
@@ -585,25 +1576,103 @@ func (c *Client) processCommand() bool {
 		}
 	}
 
-	if c.flags&ClientMulti != 0 && c.cmd.Flags() == CmdNoMulti {
+	if c.flags&ClientMulti != 0 && c.cmd.Flags()&CmdNoMulti != 0 {
 		c.rejectCommandFormat("Command not allowed inside a transaction")
 		return true
 	}
 
 	// check if the user can run this command according to the current Acls
+	if aclRet, aclErrPos := c.ACLCheckAllPerm(); aclRet != ACLOK {
+		context := ACLLogCtxToplevel
+		if c.flags&ClientMulti != 0 {
+			context = ACLLogCtxMulti
+		}
+		addACLLogEntry(c, aclRet, context, aclErrPos, "", "")
+		msg := getAclErrorMessage(aclRet, c.user, c.cmd, c.argv[aclErrPos].Value.(string), false)
+		c.rejectCommandFormat("-NOPERM %s", msg)
+		return true
+	}
 
-	return false
+	// Handle the maxmemory directive.
+	//
+	// Note that we do not want to reclaim memory if we are here re-entering
+	// the event loop since there is a busy script running in timeout
+	// condition, to avoid mixing the propagation of scripts with the
+	// propagation of DELs due to eviction.
+	if server.maxmemory != 0 && !isInsideYieldingLongCommand() {
+		outOfMemory := performEvictions() == db.EvictFail
+		isDenyOOMCmd := c.cmd.Flags()&CmdDenyOOM != 0 ||
+			(c.cmd.Fullname() == "exec" && c.mState.cmdFlags&CmdDenyOOM != 0)
+		// If client is in MULTI/EXEC context, queuing may consume an unlimited
+		// amount of memory, so we want to stop that.
+		// However, we never want to reject DISCARD, or even EXEC (unless it
+		// contains denied commands, in which case isDenyOOMCmd is already set).
+		rejectCmdOnOOM := isDenyOOMCmd
+		if c.flags&ClientMulti != 0 && !isExecContextCommand(c.cmd) {
+			rejectCmdOnOOM = true
+		}
+		if outOfMemory && rejectCmdOnOOM {
+			c.rejectCommand(ShardOOMErr)
+			return true
+		}
+
+		// Save outOfMemory result at command start, otherwise if we check OOM
+		// in the first write within script, memory used by lua stack and
+		// arguments might interfere. We need to save it for EXEC and module
+		// calls too, since these can call EXEC, but not for the calls of the
+		// scripts.
+		server.preCommandOOMState = outOfMemory
+	}
+
+	// Only allow a subset of commands in the context of Pub/Sub if the
+	// connection is in RESP2 mode. With RESP3 there are no limits.
+	if c.flags&ClientPubSub != 0 && c.resp == 2 && !isPubSubContextCommand(c.cmd) {
+		c.rejectCommandFormat("Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", c.cmd.Fullname())
+		return true
+	}
+
+	// when a busy script is being run, only the commands flagged with
+	// CmdAllowBusy (FUNCTION KILL, ...) are served.
+	if isInsideYieldingLongCommand() && c.cmd.Flags()&CmdAllowBusy == 0 {
+		if scriptIsEval() {
+			c.rejectCommand(SharedSlowEvalErr)
+		} else {
+			c.rejectCommand(SharedSlowScriptErr)
+		}
+		return true
+	}
 
+	// If the server is paused, block the client until the pause has ended.
+	// Replicas are never paused. The writes are paused while the shutdown
+	// waits for the replicas too.
+	isMayReplicateCmd := c.cmd.Flags()&(CmdWrite|CmdMayReplicate) != 0 ||
+		(c.cmd.Fullname() == "exec" && c.mState.cmdFlags&(CmdWrite|CmdMayReplicate) != 0)
+	if c.flags&ClientSlave == 0 && (server.clientPauseType == ClientPauseAll ||
+		((server.clientPauseType == ClientPauseWrite || server.isShutdownInitiated()) && isMayReplicateCmd)) {
+		c.blockPostponeClient()
+		return true
+	}
+
+	// Exec the command
+	if c.flags&ClientMulti != 0 && !isExecContextCommand(c.cmd) {
+		c.queueMultiCommand(c.cmd.Flags())
+		c.AddReply(SharedQueued)
+	} else {
+		c.Call(CmdCallFull)
+	}
+	return true
 }
 
 // AuthRequired check the user is authenticated. this check is skipped in case
 // the default user is flagged as "nopass" and the client is authenticated
 func (c *Client) authRequired() bool {
-	return (!(defaultUser.flags&UserFlagNoPass == 0 || defaultUser.flags&UserFlagDisabled != 0)) && !c.authenticated
+	return (defaultUser.flags&UserFlagNoPass == 0 || defaultUser.flags&UserFlagDisabled != 0) && !c.authenticated
 }
 
+// mustObeyClient reports whether the commands of the client must be executed
+// regardless of the limits, like the ones of the master.
 func (c *Client) mustObeyClient() bool {
-	return c.flags&ClientMaster == 0
+	return c.flags&ClientMaster != 0
 }
 
 // commandCheckExistence
@@ -617,19 +1686,23 @@ func (c *Client) commandCheckExistence() (string, bool) {
 		// if we can't find the command, but argv[0] by it self is a command
 		// it means we're dealing with a invalid subcommand. Print Help
 		cmdStr := strings.ToUpper(c.argv[0].Value.(string))
-		err = fmt.Sprintf("Unknown subcommand or wrong number of arguments for '%s'. Try CLIENT HELP.", cmdStr)
+		err = fmt.Sprintf("unknown subcommand '%.128s'. Try %s HELP.", c.argv[1].Value.(string), cmdStr)
 	} else {
+		// The arguments are cut after 128 bytes.
 		args := ""
 		limit := 128
-		for _, arg := range c.argv[1:] {
+		for _, arg := range c.argv[1:c.argc] {
 			remaining := limit - len(args)
 			if remaining <= 0 {
 				break
 			}
-			fragment := fmt.Sprintf("'%.*s' ", remaining, arg)
-			args += fragment
+			value := arg.Value.(string)
+			if len(value) > remaining {
+				value = value[:remaining]
+			}
+			args += "'" + value + "' "
 		}
-		err = fmt.Sprintf("unknown command '%.128s', with args beginning with: %s", c.argv[0], args)
+		err = fmt.Sprintf("unknown command '%.128s', with args beginning with: %s", c.argv[0].Value.(string), args)
 	}
 
 	err = mapChars(err, "\r\n", "  ")
@@ -638,14 +1711,14 @@ func (c *Client) commandCheckExistence() (string, bool) {
 
 // commandCheckArity Check if c.args is valid for c.cmd, fill 'error' details in case it is not.
 func (c *Client) commandCheckArity() (string, bool) {
-	if (c.cmd == nil && c.cmd.Arity() > 0 && c.cmd.Arity() != c.argc) || (c.argc < -c.cmd.Arity()) {
+	if (c.cmd.Arity() > 0 && c.cmd.Arity() != c.argc) || (c.argc < -c.cmd.Arity()) {
 		return fmt.Sprintf("wrong number of arguments for '%s' command", c.cmd.Fullname()), false
 	}
 	return "", true
 }
 
 func (c *Client) isContainerCommandBySds(s string) bool {
-	baseCmd, exist := server.commands.Get(s)
+	baseCmd, exist := server.commands.Get(strings.ToLower(s))
 	if exist && baseCmd.SubCommands() != nil {
 		return true
 	}
@@ -664,8 +1737,11 @@ func (c *Client) lookupCommand(argv []*db.RedisObj, argc int) RedisCommand {
 func (c *Client) lookupCommandLogic(commands *db.HashTable[string, RedisCommand], argv []*db.RedisObj, argc int, strict bool) RedisCommand {
 
 	var hasSubCommands bool
-	baseCmd, exist := commands.Get(argv[0].Value.(string))
-	if exist && baseCmd.SubCommands() != nil {
+	baseCmd, exist := commands.Get(strings.ToLower(argv[0].Value.(string)))
+	if !exist {
+		return nil
+	}
+	if baseCmd.SubCommands() != nil {
 		hasSubCommands = true
 	}
 
@@ -685,6 +1761,9 @@ func (c *Client) lookupCommandLogic(commands *db.HashTable[string, RedisCommand]
 
 // lookupSubCommand
 func (c *Client) lookupSubCommand(baseCmd RedisCommand, sub string) RedisCommand {
-	// TODO: lookup sub command
-	return nil
+	subCmd, exist := baseCmd.SubCommandsDict().Get(strings.ToLower(sub))
+	if !exist {
+		return nil
+	}
+	return subCmd
 }
@@ -0,0 +1,859 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/*-----------------------------------------------------------------------------
+ * CLIENT command family
+ *----------------------------------------------------------------------------*/
+
+// getClientType returns the class of the client, used by CLIENT LIST and
+// CLIENT KILL TYPE. Monitors are normal clients.
+func getClientType(c *Client) ClientType {
+	if c.flags&ClientMaster != 0 {
+		return ClientTypeMaster
+	}
+	// Even though MONITOR clients are marked as replicas, we
+	// want the expose them as normal clients.
+	if c.flags&ClientSlave != 0 && c.flags&ClientMonitor == 0 {
+		return ClientTypeSlave
+	}
+	if c.flags&ClientPubSub != 0 {
+		return ClientTypePubSub
+	}
+	return ClientTypeNormal
+}
+
+// getClientTypeByName returns the class of clients of the given name, false
+// is returned if the name is unknown.
+func getClientTypeByName(name string) (ClientType, bool) {
+	switch strings.ToLower(name) {
+	case "normal":
+		return ClientTypeNormal, true
+	case "slave", "replica":
+		return ClientTypeSlave, true
+	case "pubsub":
+		return ClientTypePubSub, true
+	case "master":
+		return ClientTypeMaster, true
+	}
+	return 0, false
+}
+
+// getClientFlagsString returns the flags of the client, one char each, as
+// shown by CLIENT LIST.
+func getClientFlagsString(c *Client) string {
+	var b strings.Builder
+	if c.flags&ClientSlave != 0 {
+		if c.flags&ClientMonitor != 0 {
+			b.WriteByte('O')
+		} else {
+			b.WriteByte('S')
+		}
+	}
+	for _, f := range []struct {
+		flag ClientFlags
+		ch   byte
+	}{
+		{ClientMaster, 'M'},
+		{ClientPubSub, 'P'},
+		{ClientMulti, 'x'},
+		{ClientBlocked, 'b'},
+		{ClientTracking, 't'},
+		{ClientTrackingBcast, 'B'},
+		{ClientDirtyCas, 'd'},
+		{ClientCloseAfterReply, 'c'},
+		{ClientUnblocked, 'u'},
+		{ClientCloseASAP, 'A'},
+		{ClientUnixSocket, 'U'},
+		{ClientReadOnly, 'r'},
+		{ClientNoEvict, 'e'},
+		{ClientNoTouch, 'T'},
+	} {
+		if c.flags&f.flag != 0 {
+			b.WriteByte(f.ch)
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteByte('N')
+	}
+	return b.String()
+}
+
+// catClientInfoString returns the description of the client, in the format of
+// CLIENT LIST.
+func (c *Client) catClientInfoString() string {
+	multi, multiMem := -1, 0
+	if c.flags&ClientMulti != 0 {
+		multi = len(c.mState.commands)
+		for _, mc := range c.mState.commands {
+			for _, arg := range mc.argv {
+				multiMem += len(arg.Value.(string))
+			}
+		}
+	}
+	cmd := "NULL"
+	if c.lastCmd != nil {
+		cmd = c.lastCmd.Fullname()
+	}
+	username := ""
+	if c.user != nil {
+		username = c.user.name
+	}
+
+	// The replies are written as they are added, only the reply list keeps
+	// the output the connection did not accept.
+	omem := getClientOutputBufferMemoryUsage(c)
+	events := "r"
+	if c.hasPendingReplies() {
+		events += "w"
+	}
+
+	now := time.Now().Unix()
+	return fmt.Sprintf("id=%d addr=%s laddr=%s fd=%d name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d "+
+		"qbuf=%d qbuf-free=%d argv-mem=%d multi-mem=%d obl=%d oll=%d omem=%d tot-mem=%d events=%s cmd=%s user=%s resp=%d lib-name=%s lib-ver=%s",
+		c.id, c.connection.Addr(), c.connection.LocalAddr(), c.connection.Fd(), c.name,
+		now-c.ctime, now-c.lastInteraction, getClientFlagsString(c), c.db.GetID(),
+		c.pubsubChannels.Len(), c.pubsubPatterns.Len(), multi,
+		len(c.queryBuf)-c.queryPos, cap(c.queryBuf)-len(c.queryBuf), c.argvLenSum, multiMem,
+		0, c.replies.Len(), omem, int64(cap(c.queryBuf)+c.argvLenSum+multiMem)+omem,
+		events, cmd, username, c.resp, c.libName, c.libVer)
+}
+
+// getAllClientsInfoString returns the description of the clients of the
+// given class, or of all the clients if all is true, one per line.
+func getAllClientsInfoString(ctype ClientType, all bool) string {
+	var b strings.Builder
+	iter := server.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		if !all && getClientType(node.Value) != ctype {
+			continue
+		}
+		b.WriteString(node.Value.catClientInfoString())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// validateClientAttr checks that the client attribute, like the client name,
+// contains no spaces, newlines or special characters.
+func validateClientAttr(val string) bool {
+	for j := 0; j < len(val); j++ {
+		if val[j] < '!' || val[j] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// setNameOrReply sets the name of the client, replying with an error if the
+// name contains spaces, newlines or special characters. An empty name
+// removes the name.
+func (c *Client) setNameOrReply(name string) bool {
+	if !validateClientAttr(name) {
+		c.AddReplyError("Client names cannot contain spaces, newlines or special characters.")
+		return false
+	}
+	c.name = name
+	return true
+}
+
+// replyToBlockedClientTimedOut replies to the client blocked by a command
+// when its timeout is reached.
+func (c *Client) replyToBlockedClientTimedOut() {
+	switch c.btype {
+	case BlockList, BlockZSet, BlockStream:
+		c.addReplyNullArray()
+	case BlockWait:
+		c.addReplyLongLong(0)
+	}
+}
+
+// ClientCmd handles the CLIENT command.
+type ClientCmd struct {
+	c *Client
+}
+
+// NewClientCmd returns a new ClientCmd.
+func NewClientCmd(c *Client) *ClientCmd {
+	return &ClientCmd{c: c}
+}
+
+// Id implements CLIENT ID
+func (cmd *ClientCmd) Id() {
+	cmd.c.addReplyLongLong(int64(cmd.c.id))
+}
+
+// Info implements CLIENT INFO
+func (cmd *ClientCmd) Info() {
+	cmd.c.addReplyVerbatim(cmd.c.catClientInfoString()+"\n", "txt")
+}
+
+// List implements CLIENT LIST [TYPE NORMAL|MASTER|REPLICA|PUBSUB] [ID client-id [client-id ...]]
+func (cmd *ClientCmd) List() {
+	c := cmd.c
+	var o string
+	if c.argc == 4 && strings.EqualFold(c.argv[2].Value.(string), "type") {
+		ctype, ok := getClientTypeByName(c.argv[3].Value.(string))
+		if !ok {
+			c.addReplyErrorFormat(fmt.Sprintf("Unknown client type '%s'", c.argv[3].Value.(string)))
+			return
+		}
+		o = getAllClientsInfoString(ctype, false)
+	} else if c.argc > 3 && strings.EqualFold(c.argv[2].Value.(string), "id") {
+		var b strings.Builder
+		for j := 3; j < c.argc; j++ {
+			cid, ok := c.getLongLongFromObjectOrReply(c.argv[j], "Invalid client ID")
+			if !ok {
+				return
+			}
+			if cl := lookupClientByID(uint64(cid)); cl != nil {
+				b.WriteString(cl.catClientInfoString())
+				b.WriteByte('\n')
+			}
+		}
+		o = b.String()
+	} else if c.argc != 2 {
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	} else {
+		o = getAllClientsInfoString(0, true)
+	}
+	c.addReplyVerbatim(o, "txt")
+}
+
+// SetName implements CLIENT SETNAME connection-name
+func (cmd *ClientCmd) SetName() {
+	if cmd.c.setNameOrReply(cmd.c.argv[2].Value.(string)) {
+		cmd.c.AddReply(SharedOk)
+	}
+}
+
+// GetName implements CLIENT GETNAME
+func (cmd *ClientCmd) GetName() {
+	if cmd.c.name == "" {
+		cmd.c.addReplyNull()
+		return
+	}
+	cmd.c.addReplyBulkCString(cmd.c.name)
+}
+
+// SetInfo implements CLIENT SETINFO LIB-NAME libname | LIB-VER libver
+func (cmd *ClientCmd) SetInfo() {
+	c := cmd.c
+	attr := c.argv[2].Value.(string)
+	val := c.argv[3].Value.(string)
+
+	var dest *string
+	switch strings.ToLower(attr) {
+	case "lib-name":
+		dest = &c.libName
+	case "lib-ver":
+		dest = &c.libVer
+	default:
+		c.addReplyErrorFormat(fmt.Sprintf("Unrecognized option '%s'", attr))
+		return
+	}
+	if !validateClientAttr(val) {
+		c.addReplyErrorFormat(fmt.Sprintf("%s cannot contain spaces, newlines or special characters.", attr))
+		return
+	}
+	*dest = val
+	c.AddReply(SharedOk)
+}
+
+// Kill implements CLIENT KILL ip:port, and the new syntax with filters:
+//
+//	CLIENT KILL [ID client-id] [TYPE NORMAL|MASTER|REPLICA|PUBSUB]
+//	  [USER username] [ADDR ip:port] [LADDR ip:port] [SKIPME yes|no]
+//	  [MAXAGE maxage]
+//
+// The old syntax replies OK, the new one the number of clients killed.
+func (cmd *ClientCmd) Kill() {
+	c := cmd.c
+	var (
+		addr, laddr string
+		user        *User
+		ctype       ClientType
+		hasType     bool
+		id          uint64
+		skipMe      = true
+		maxAge      int64
+	)
+
+	if c.argc == 3 {
+		// Old style syntax: CLIENT KILL <addr>
+		addr = c.argv[2].Value.(string)
+		skipMe = false // With the old form, you can kill yourself.
+	} else if c.argc > 3 && c.argc%2 == 0 {
+		// New style syntax: parse options.
+		for i := 2; i < c.argc; i += 2 {
+			opt := c.argv[i].Value.(string)
+			val := c.argv[i+1].Value.(string)
+			switch strings.ToLower(opt) {
+			case "id":
+				ll, ok := getLongLongFromObject(c.argv[i+1])
+				if !ok || ll <= 0 {
+					c.AddReplyError("client-id should be greater than 0")
+					return
+				}
+				id = uint64(ll)
+			case "type":
+				var ok bool
+				if ctype, ok = getClientTypeByName(val); !ok {
+					c.addReplyErrorFormat(fmt.Sprintf("Unknown client type '%s'", val))
+					return
+				}
+				hasType = true
+			case "addr":
+				addr = val
+			case "laddr":
+				laddr = val
+			case "user":
+				if user = ACLGetUserByName(val); user == nil {
+					c.addReplyErrorFormat(fmt.Sprintf("No such user '%s'", val))
+					return
+				}
+			case "skipme":
+				switch strings.ToLower(val) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					c.addReplyErrorObject(SharedSyntaxErr)
+					return
+				}
+			case "maxage":
+				ll, ok := c.getLongLongFromObjectOrReply(c.argv[i+1], "")
+				if !ok {
+					return
+				}
+				maxAge = ll
+			default:
+				c.addReplyErrorObject(SharedSyntaxErr)
+				return
+			}
+		}
+	} else {
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+
+	// Iterate clients killing all the matching clients.
+	killed := 0
+	closeThisClient := false
+	now := time.Now().Unix()
+	iter := server.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		target := node.Value
+		if addr != "" && target.connection.Addr() != addr {
+			continue
+		}
+		if laddr != "" && target.connection.LocalAddr() != laddr {
+			continue
+		}
+		if hasType && getClientType(target) != ctype {
+			continue
+		}
+		if id != 0 && target.id != id {
+			continue
+		}
+		if user != nil && target.user != user {
+			continue
+		}
+		if target == c && skipMe {
+			continue
+		}
+		if maxAge != 0 && now-target.ctime < maxAge {
+			continue
+		}
+
+		// Kill it.
+		if target == c {
+			closeThisClient = true
+		} else {
+			freeClient(target)
+		}
+		killed++
+	}
+
+	// Reply according to old/new format.
+	if c.argc == 3 {
+		if killed == 0 {
+			c.AddReplyError("No such client")
+		} else {
+			c.AddReply(SharedOk)
+		}
+	} else {
+		c.addReplyLongLong(int64(killed))
+	}
+
+	// If this client has to be closed, flag it as CLOSE_AFTER_REPLY
+	// only after we queued the reply to its output buffers.
+	if closeThisClient {
+		c.flags |= ClientCloseAfterReply
+	}
+}
+
+// Pause implements CLIENT PAUSE timeout [WRITE|ALL]
+func (cmd *ClientCmd) Pause() {
+	c := cmd.c
+	ptype := ClientPauseAll
+	if c.argc == 4 {
+		switch strings.ToLower(c.argv[3].Value.(string)) {
+		case "write":
+			ptype = ClientPauseWrite
+		case "all":
+		default:
+			c.AddReplyError("CLIENT PAUSE mode must be WRITE or ALL")
+			return
+		}
+	}
+
+	timeout, ok := c.getLongLongFromObjectOrReply(c.argv[2], "timeout is not an integer or out of range")
+	if !ok {
+		return
+	}
+	if timeout < 0 {
+		c.AddReplyError("timeout is negative")
+		return
+	}
+	server.pauseClients(time.Now().UnixMilli()+timeout, ptype)
+	c.AddReply(SharedOk)
+}
+
+// Unpause implements CLIENT UNPAUSE
+func (cmd *ClientCmd) Unpause() {
+	server.unpauseClients()
+	cmd.c.AddReply(SharedOk)
+}
+
+// Reply implements CLIENT REPLY ON|OFF|SKIP
+func (cmd *ClientCmd) Reply() {
+	c := cmd.c
+	switch strings.ToLower(c.argv[2].Value.(string)) {
+	case "on":
+		c.flags &= ^(ClientReplySkip | ClientReplyOff)
+		c.AddReply(SharedOk)
+	case "off":
+		c.flags |= ClientReplyOff
+	case "skip":
+		if c.flags&ClientReplyOff == 0 {
+			c.flags |= ClientReplySkipNext
+		}
+	default:
+		c.addReplyErrorObject(SharedSyntaxErr)
+	}
+}
+
+// setFlagOrReply sets or clears the flag of the client according to the
+// ON|OFF argument of the command.
+func (cmd *ClientCmd) setFlagOrReply(flag ClientFlags) {
+	c := cmd.c
+	switch strings.ToLower(c.argv[2].Value.(string)) {
+	case "on":
+		c.flags |= flag
+	case "off":
+		c.flags &= ^flag
+	default:
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+	c.AddReply(SharedOk)
+}
+
+// NoEvict implements CLIENT NO-EVICT ON|OFF
+func (cmd *ClientCmd) NoEvict() {
+	cmd.setFlagOrReply(ClientNoEvict)
+}
+
+// NoTouch implements CLIENT NO-TOUCH ON|OFF
+func (cmd *ClientCmd) NoTouch() {
+	cmd.setFlagOrReply(ClientNoTouch)
+}
+
+// Unblock implements CLIENT UNBLOCK client-id [TIMEOUT|ERROR]
+//
+// Only the clients blocked by a blocking command are unblocked, not the
+// clients postponed by CLIENT PAUSE.
+func (cmd *ClientCmd) Unblock() {
+	c := cmd.c
+	unblockError := false
+	if c.argc == 4 {
+		switch strings.ToLower(c.argv[3].Value.(string)) {
+		case "timeout":
+		case "error":
+			unblockError = true
+		default:
+			c.AddReplyError("CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+			return
+		}
+	} else if c.argc > 4 {
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+
+	id, ok := c.getLongLongFromObjectOrReply(c.argv[2], "")
+	if !ok {
+		return
+	}
+	target := lookupClientByID(uint64(id))
+	if target == nil || target.flags&ClientBlocked == 0 || target.btype == BlockPostPone || target.btype == BlockShutdown {
+		c.AddReply(SharedZCone)
+		return
+	}
+	if unblockError {
+		target.AddReplyError("-UNBLOCKED client unblocked via CLIENT UNBLOCK")
+	} else {
+		target.replyToBlockedClientTimedOut()
+	}
+	target.unblockClient()
+	c.AddReply(SharedCone)
+}
+
+// Tracking implements CLIENT TRACKING ON|OFF [REDIRECT client-id]
+// [PREFIX prefix [PREFIX prefix ...]] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func (cmd *ClientCmd) Tracking() {
+	c := cmd.c
+	var (
+		options  ClientFlags
+		redir    int64
+		prefixes []string
+	)
+
+	// Parse the options.
+	for j := 3; j < c.argc; j++ {
+		moreArgs := c.argc-1 > j
+		opt := c.argv[j].Value.(string)
+		switch {
+		case strings.EqualFold(opt, "redirect") && moreArgs:
+			j++
+			if redir != 0 {
+				c.AddReplyError("A client can only redirect to a single other client")
+				return
+			}
+			var ok bool
+			if redir, ok = c.getLongLongFromObjectOrReply(c.argv[j], ""); !ok {
+				return
+			}
+			// We will require the client with the specified ID to exist
+			// right now, even if it is possible that it gets disconnected
+			// later. Still a valid sanity check.
+			if lookupClientByID(uint64(redir)) == nil {
+				c.AddReplyError("The client ID you want redirect to does not exist")
+				return
+			}
+		case strings.EqualFold(opt, "bcast"):
+			options |= ClientTrackingBcast
+		case strings.EqualFold(opt, "optin"):
+			options |= ClientTrackingOptIn
+		case strings.EqualFold(opt, "optout"):
+			options |= ClientTrackingOptOut
+		case strings.EqualFold(opt, "noloop"):
+			options |= ClientTrackingNoLoop
+		case strings.EqualFold(opt, "prefix") && moreArgs:
+			j++
+			prefixes = append(prefixes, c.argv[j].Value.(string))
+		default:
+			c.addReplyErrorObject(SharedSyntaxErr)
+			return
+		}
+	}
+
+	// Options are ok: enable or disable the tracking for this client.
+	switch strings.ToLower(c.argv[2].Value.(string)) {
+	case "on":
+		// Before enabling tracking, make sure options are compatible among
+		// each other and with the current state of the client.
+		if options&ClientTrackingBcast == 0 && len(prefixes) > 0 {
+			c.AddReplyError("PREFIX option requires BCAST mode to be enabled")
+			return
+		}
+		if c.flags&ClientTracking != 0 {
+			oldBcast := c.flags&ClientTrackingBcast != 0
+			newBcast := options&ClientTrackingBcast != 0
+			if oldBcast != newBcast {
+				c.AddReplyError("You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+				return
+			}
+		}
+		if options&ClientTrackingBcast != 0 && options&(ClientTrackingOptIn|ClientTrackingOptOut) != 0 {
+			c.AddReplyError("OPTIN and OPTOUT are not compatible with BCAST")
+			return
+		}
+		if options&ClientTrackingOptIn != 0 && options&ClientTrackingOptOut != 0 {
+			c.AddReplyError("You can't use both OPTIN and OPTOUT")
+			return
+		}
+		if (options&ClientTrackingOptIn != 0 && c.flags&ClientTrackingOptOut != 0) ||
+			(options&ClientTrackingOptOut != 0 && c.flags&ClientTrackingOptIn != 0) {
+			c.AddReplyError("You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+			return
+		}
+		if options&ClientTrackingBcast != 0 && !c.checkPrefixCollisionsOrReply(prefixes) {
+			return
+		}
+		c.enableTracking(uint64(redir), options, prefixes)
+	case "off":
+		c.disableTracking()
+	default:
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+	c.AddReply(SharedOk)
+}
+
+// Caching implements CLIENT CACHING YES|NO
+func (cmd *ClientCmd) Caching() {
+	c := cmd.c
+	if c.flags&ClientTracking == 0 {
+		c.AddReplyError("CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+		return
+	}
+
+	switch strings.ToLower(c.argv[2].Value.(string)) {
+	case "yes":
+		if c.flags&ClientTrackingOptIn == 0 {
+			c.AddReplyError("CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+			return
+		}
+		c.flags |= ClientTrackingCaching
+	case "no":
+		if c.flags&ClientTrackingOptOut == 0 {
+			c.AddReplyError("CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+			return
+		}
+		c.flags |= ClientTrackingCaching
+	default:
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+	// Common reply for when we succeeded.
+	c.AddReply(SharedOk)
+}
+
+// GetRedir implements CLIENT GETREDIR
+func (cmd *ClientCmd) GetRedir() {
+	c := cmd.c
+	if c.flags&ClientTracking == 0 {
+		c.addReplyLongLong(-1)
+		return
+	}
+	c.addReplyLongLong(int64(c.trackingRedirection))
+}
+
+// TrackingInfo implements CLIENT TRACKINGINFO
+func (cmd *ClientCmd) TrackingInfo() {
+	c := cmd.c
+	c.addReplyMapLen(3)
+
+	c.addReplyBulkCString("flags")
+	var flags []string
+	if c.flags&ClientTracking == 0 {
+		flags = append(flags, "off")
+	} else {
+		flags = append(flags, "on")
+		if c.flags&ClientTrackingBcast != 0 {
+			flags = append(flags, "bcast")
+		}
+		if c.flags&ClientTrackingOptIn != 0 {
+			flags = append(flags, "optin")
+			if c.flags&ClientTrackingCaching != 0 {
+				flags = append(flags, "caching-yes")
+			}
+		}
+		if c.flags&ClientTrackingOptOut != 0 {
+			flags = append(flags, "optout")
+			if c.flags&ClientTrackingCaching != 0 {
+				flags = append(flags, "caching-no")
+			}
+		}
+		if c.flags&ClientTrackingNoLoop != 0 {
+			flags = append(flags, "noloop")
+		}
+		if c.flags&ClientTrackingBrokenRedir != 0 {
+			flags = append(flags, "broken_redirect")
+		}
+	}
+	c.addReplySetLen(len(flags))
+	for _, flag := range flags {
+		c.addReplyBulkCString(flag)
+	}
+
+	c.addReplyBulkCString("redirect")
+	if c.flags&ClientTracking != 0 {
+		c.addReplyLongLong(int64(c.trackingRedirection))
+	} else {
+		c.addReplyLongLong(-1)
+	}
+
+	c.addReplyBulkCString("prefixes")
+	if c.trackingPrefixes == nil {
+		c.addReplyArrayLen(0)
+		return
+	}
+	c.addReplyArrayLen(c.trackingPrefixes.Len())
+	c.trackingPrefixes.Range(func(prefix []byte, _ struct{}) bool {
+		c.addReplyBulkCString(string(prefix))
+		return true
+	})
+}
+
+// Help implements CLIENT HELP
+func (cmd *ClientCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"GETNAME",
+		"    Return the name of the current connection.",
+		"ID",
+		"    Return the ID of the current connection.",
+		"INFO",
+		"    Return information about the current client connection.",
+		"KILL <ip:port>",
+		"    Kill connection made from <ip:port>.",
+		"KILL <option> <value> [<option> <value> [...]]",
+		"    Kill connections. Options are:",
+		"    * ADDR <ip:port>",
+		"      Kill connections made from the specified address",
+		"    * LADDR <ip:port>",
+		"      Kill connections made to specified local address",
+		"    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+		"      Kill connections by type.",
+		"    * USER <username>",
+		"      Kill connections authenticated by <username>.",
+		"    * SKIPME (YES|NO)",
+		"      Skip killing current connection (default: yes).",
+		"    * ID <client-id>",
+		"      Kill connections by client id.",
+		"    * MAXAGE <maxage>",
+		"      Kill connections older than the specified age.",
+		"LIST [options ...]",
+		"    Return information about client connections. Options:",
+		"    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+		"      Return clients of specified type.",
+		"    * ID <client-id> [<client-id> ...]",
+		"      Return clients of specified IDs only.",
+		"UNPAUSE",
+		"    Stop the current client pause, resuming traffic.",
+		"PAUSE <timeout> [WRITE|ALL]",
+		"    Suspend all, or just write, clients for <timeout> milliseconds.",
+		"REPLY (ON|OFF|SKIP)",
+		"    Control the replies sent to the current connection.",
+		"TRACKING (ON|OFF) [REDIRECT <id>] [BCAST] [PREFIX <prefix> [...]]",
+		"         [OPTIN] [OPTOUT] [NOLOOP]",
+		"    Control server assisted client side caching.",
+		"TRACKINGINFO",
+		"    Report tracking status for the current connection.",
+		"CACHING (YES|NO)",
+		"    Enable/disable tracking of the keys for next command in OPTIN/OPTOUT modes.",
+		"GETREDIR",
+		"    Return the client ID we are redirecting to when tracking is enabled.",
+		"SETNAME <name>",
+		"    Assign the name <name> to the current connection.",
+		"SETINFO <option> <value>",
+		"    Set client meta attr. Options are:",
+		"    * LIB-NAME: the client lib name.",
+		"    * LIB-VER: the client lib version.",
+		"UNBLOCK <clientid> [TIMEOUT|ERROR]",
+		"    Unblock the specified blocked client.",
+		"NO-EVICT (ON|OFF)",
+		"    Protect current client connection from eviction.",
+		"NO-TOUCH (ON|OFF)",
+		"    Will not touch LRU/LFU stats when this mode is on.",
+	})
+}
+
+func clientIdCommand(c *Client) error {
+	NewClientCmd(c).Id()
+	return nil
+}
+
+func clientInfoCommand(c *Client) error {
+	NewClientCmd(c).Info()
+	return nil
+}
+
+func clientListCommand(c *Client) error {
+	NewClientCmd(c).List()
+	return nil
+}
+
+func clientSetNameCommand(c *Client) error {
+	NewClientCmd(c).SetName()
+	return nil
+}
+
+func clientGetNameCommand(c *Client) error {
+	NewClientCmd(c).GetName()
+	return nil
+}
+
+func clientSetInfoCommand(c *Client) error {
+	NewClientCmd(c).SetInfo()
+	return nil
+}
+
+func clientKillCommand(c *Client) error {
+	NewClientCmd(c).Kill()
+	return nil
+}
+
+func clientPauseCommand(c *Client) error {
+	NewClientCmd(c).Pause()
+	return nil
+}
+
+func clientUnpauseCommand(c *Client) error {
+	NewClientCmd(c).Unpause()
+	return nil
+}
+
+func clientReplyCommand(c *Client) error {
+	NewClientCmd(c).Reply()
+	return nil
+}
+
+func clientNoEvictCommand(c *Client) error {
+	NewClientCmd(c).NoEvict()
+	return nil
+}
+
+func clientNoTouchCommand(c *Client) error {
+	NewClientCmd(c).NoTouch()
+	return nil
+}
+
+func clientUnblockCommand(c *Client) error {
+	NewClientCmd(c).Unblock()
+	return nil
+}
+
+func clientHelpCommand(c *Client) error {
+	NewClientCmd(c).Help()
+	return nil
+}
+
+func clientTrackingCommand(c *Client) error {
+	NewClientCmd(c).Tracking()
+	return nil
+}
+
+func clientCachingCommand(c *Client) error {
+	NewClientCmd(c).Caching()
+	return nil
+}
+
+func clientGetRedirCommand(c *Client) error {
+	NewClientCmd(c).GetRedir()
+	return nil
+}
+
+func clientTrackingInfoCommand(c *Client) error {
+	NewClientCmd(c).TrackingInfo()
+	return nil
+}
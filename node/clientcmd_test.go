@@ -0,0 +1,230 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClientIdAndInfo(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	id := strconv.FormatUint(c.id, 10)
+
+	if got := sendCommand(c, conn, "CLIENT", "ID"); got != ":"+id+"\r\n" {
+		t.Fatalf("CLIENT ID replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "INFO"); !strings.Contains(got, "id="+id+" ") || !strings.Contains(got, " cmd=client|info ") {
+		t.Fatalf("CLIENT INFO replied %q", got)
+	}
+	if lookupClientByID(c.id) != c {
+		t.Fatalf("client %d is not in the registry", c.id)
+	}
+}
+
+func TestClientList(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	other, _ := newTestClient()
+	defer freeClient(other)
+	id := strconv.FormatUint(c.id, 10)
+	otherId := strconv.FormatUint(other.id, 10)
+
+	got := sendCommand(c, conn, "CLIENT", "LIST")
+	if !strings.Contains(got, "id="+id+" ") || !strings.Contains(got, "id="+otherId+" ") {
+		t.Fatalf("CLIENT LIST replied %q", got)
+	}
+	got = sendCommand(c, conn, "CLIENT", "LIST", "ID", otherId)
+	if strings.Contains(got, "id="+id+" ") || !strings.Contains(got, "id="+otherId+" ") {
+		t.Fatalf("CLIENT LIST ID replied %q", got)
+	}
+	if got = sendCommand(c, conn, "CLIENT", "LIST", "TYPE", "pubsub"); got != "$0\r\n\r\n" {
+		t.Fatalf("CLIENT LIST TYPE pubsub replied %q", got)
+	}
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "LIST", "TYPE", "foo"}, "-ERR Unknown client type 'foo'\r\n"},
+		{[]string{"CLIENT", "LIST", "ID", "x"}, "-ERR Invalid client ID\r\n"},
+		{[]string{"CLIENT", "LIST", "foo"}, "-ERR syntax error\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestClientNameAndInfo(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "GETNAME"}, "$-1\r\n"},
+		{[]string{"CLIENT", "SETNAME", "bad name"}, "-ERR Client names cannot contain spaces, newlines or special characters.\r\n"},
+		{[]string{"CLIENT", "SETNAME", "conn1"}, "+OK\r\n"},
+		{[]string{"CLIENT", "GETNAME"}, "$5\r\nconn1\r\n"},
+		{[]string{"CLIENT", "SETINFO", "lib-name", "go redis"}, "-ERR lib-name cannot contain spaces, newlines or special characters.\r\n"},
+		{[]string{"CLIENT", "SETINFO", "lib-foo", "x"}, "-ERR Unrecognized option 'lib-foo'\r\n"},
+		{[]string{"CLIENT", "SETINFO", "LIB-NAME", "go-redis"}, "+OK\r\n"},
+		{[]string{"CLIENT", "SETINFO", "LIB-VER", "9.0"}, "+OK\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if got := sendCommand(c, conn, "CLIENT", "INFO"); !strings.Contains(got, " name=conn1 ") || !strings.Contains(got, " lib-name=go-redis lib-ver=9.0") {
+		t.Fatalf("CLIENT INFO replied %q", got)
+	}
+}
+
+func TestClientKill(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	victim, victimConn := newTestClient()
+	victimConn.addr = "10.0.0.1:5000"
+	victimId := strconv.FormatUint(victim.id, 10)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "KILL", "10.0.0.2:5000"}, "-ERR No such client\r\n"},
+		{[]string{"CLIENT", "KILL", "ID", "0"}, "-ERR client-id should be greater than 0\r\n"},
+		{[]string{"CLIENT", "KILL", "TYPE", "foo"}, "-ERR Unknown client type 'foo'\r\n"},
+		{[]string{"CLIENT", "KILL", "USER", "nosuchuser"}, "-ERR No such user 'nosuchuser'\r\n"},
+		{[]string{"CLIENT", "KILL", "SKIPME", "maybe"}, "-ERR syntax error\r\n"},
+		{[]string{"CLIENT", "KILL", "ID", "1", "TYPE"}, "-ERR syntax error\r\n"},
+		{[]string{"CLIENT", "KILL", "ID", victimId, "ADDR", "10.0.0.2:5000"}, ":0\r\n"},
+		{[]string{"CLIENT", "KILL", "ID", victimId, "ADDR", "10.0.0.1:5000"}, ":1\r\n"},
+		{[]string{"CLIENT", "KILL", "ID", victimId}, ":0\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if lookupClientByID(victim.id) != nil {
+		t.Fatalf("killed client %d is still in the registry", victim.id)
+	}
+
+	// The old syntax can kill the calling client, after the reply.
+	conn.addr = "10.0.0.3:5000"
+	if got := sendCommand(c, conn, "CLIENT", "KILL", "10.0.0.3:5000"); got != "+OK\r\n" {
+		t.Fatalf("CLIENT KILL replied %q", got)
+	}
+	if c.flags&ClientCloseAfterReply == 0 {
+		t.Fatalf("client is not closed after the reply")
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	writer, writerConn := newTestClient()
+	defer freeClient(writer)
+	defer server.unpauseClients()
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "PAUSE", "100", "READ"}, "-ERR CLIENT PAUSE mode must be WRITE or ALL\r\n"},
+		{[]string{"CLIENT", "PAUSE", "x"}, "-ERR timeout is not an integer or out of range\r\n"},
+		{[]string{"CLIENT", "PAUSE", "-1"}, "-ERR timeout is negative\r\n"},
+		{[]string{"CLIENT", "PAUSE", "100000", "WRITE"}, "+OK\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// Reads are served, writes are postponed until the pause ends.
+	if got := sendCommand(writer, writerConn, "GET", "pause:k"); got != "$-1\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+	if got := sendCommand(writer, writerConn, "SET", "pause:k", "v"); got != "" {
+		t.Fatalf("SET replied %q while paused", got)
+	}
+	if writer.flags&ClientBlocked == 0 {
+		t.Fatalf("writer is not blocked")
+	}
+	// Postponed clients are not unblocked by CLIENT UNBLOCK.
+	if got := sendCommand(c, conn, "CLIENT", "UNBLOCK", strconv.FormatUint(writer.id, 10)); got != ":0\r\n" {
+		t.Fatalf("CLIENT UNBLOCK replied %q", got)
+	}
+
+	writerConn.Buffer.Reset()
+	if got := sendCommand(c, conn, "CLIENT", "UNPAUSE"); got != "+OK\r\n" {
+		t.Fatalf("CLIENT UNPAUSE replied %q", got)
+	}
+	server.processUnblockedClients()
+	if got := writerConn.Buffer.String(); got != "+OK\r\n" {
+		t.Fatalf("postponed SET replied %q", got)
+	}
+	if got := sendCommand(writer, writerConn, "GET", "pause:k"); got != "$1\r\nv\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+}
+
+func TestClientReply(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "CLIENT", "REPLY", "OFF"); got != "" {
+		t.Fatalf("CLIENT REPLY OFF replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SET", "reply:k", "v"); got != "" {
+		t.Fatalf("SET replied %q with replies off", got)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "REPLY", "ON"); got != "+OK\r\n" {
+		t.Fatalf("CLIENT REPLY ON replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "REPLY", "SKIP"); got != "" {
+		t.Fatalf("CLIENT REPLY SKIP replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "reply:k"); got != "" {
+		t.Fatalf("skipped GET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "reply:k"); got != "$1\r\nv\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "REPLY", "MAYBE"); got != "-ERR syntax error\r\n" {
+		t.Fatalf("CLIENT REPLY MAYBE replied %q", got)
+	}
+}
+
+func TestClientFlags(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "NO-EVICT", "on"}, "+OK\r\n"},
+		{[]string{"CLIENT", "NO-TOUCH", "on"}, "+OK\r\n"},
+		{[]string{"CLIENT", "NO-TOUCH", "maybe"}, "-ERR syntax error\r\n"},
+		{[]string{"CLIENT", "UNBLOCK", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"CLIENT", "UNBLOCK", "1", "FOO"}, "-ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR\r\n"},
+		{[]string{"CLIENT", "UNBLOCK", strconv.FormatUint(c.id, 10)}, ":0\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if got := sendCommand(c, conn, "CLIENT", "INFO"); !strings.Contains(got, " flags=eT ") {
+		t.Fatalf("CLIENT INFO replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "NO-EVICT", "off"); got != "+OK\r\n" || c.flags&ClientNoEvict != 0 {
+		t.Fatalf("CLIENT NO-EVICT off replied %q", got)
+	}
+}
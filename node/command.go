@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/fzft/go-mock-redis/db"
 	"github.com/fzft/go-mock-redis/resp"
+	"math"
+	"strings"
 )
 
 type CommandArgType uint8
@@ -20,6 +22,37 @@ const (
 	ArgTypeBlock
 )
 
+// argTypeNames are the names of the argument types, as replied by COMMAND
+// DOCS.
+var argTypeNames = []string{
+	ArgTypeString:    "string",
+	ArgTypeInteger:   "integer",
+	ArgTypeDouble:    "double",
+	ArgTypeKey:       "key",
+	ArgTypePattern:   "pattern",
+	ArgTypeUnixTime:  "unix-time",
+	ArgTypePureToken: "pure-token",
+	ArgTypeOnEOF:     "oneof",
+	ArgTypeBlock:     "block",
+}
+
+// CommandArgFlags describe how an argument may be given.
+type CommandArgFlags uint8
+
+const (
+	CmdArgOptional      CommandArgFlags = 1 << iota // The argument is optional.
+	CmdArgMultiple                                  // The argument may repeat itself.
+	CmdArgMultipleToken                             // Each repetition of the argument is preceded by its token.
+)
+
+// CommandDocFlags are the documentation flags of a command.
+type CommandDocFlags uint8
+
+const (
+	CmdDocDeprecated CommandDocFlags = 1 << iota // The command is deprecated.
+	CmdDocSyscmd                                 // System (internal) command.
+)
+
 type CommandFlags uint64
 
 const (
@@ -55,6 +88,289 @@ const (
 	CmdTouchesArbitraryKeys
 )
 
+// KeySpecFlags describe how a command accesses the keys of a key spec.
+type KeySpecFlags uint16
+
+const (
+	KeySpecRO            KeySpecFlags = 1 << iota // Read-Only, reads the value of the key but doesn't modify it.
+	KeySpecRW                                     // Read-Write, modifies the data stored in the value of the key.
+	KeySpecOW                                     // Overwrite, overwrites the data stored in the value of the key.
+	KeySpecRM                                     // Deletes the key.
+	KeySpecAccess                                 // Returns, copies or uses the user data from the value of the key.
+	KeySpecUpdate                                 // Updates data to the value, new value may depend on the old value.
+	KeySpecInsert                                 // Adds data to the value with no chance of modification or deletion of existing data.
+	KeySpecDelete                                 // Explicitly deletes some content from the value of the key.
+	KeySpecNotKey                                 // The key is not actually a key, and should be ignored when looking for keys.
+	KeySpecIncomplete                             // The spec might not point out all the keys it should cover.
+	KeySpecVariableFlags                          // Some keys might have different flags depending on arguments.
+)
+
+// keySpecFlagNames are the names of the key spec flags, as replied by
+// COMMAND INFO and COMMAND GETKEYSANDFLAGS.
+var keySpecFlagNames = []struct {
+	flag KeySpecFlags
+	name string
+}{
+	{KeySpecRO, "RO"},
+	{KeySpecRW, "RW"},
+	{KeySpecOW, "OW"},
+	{KeySpecRM, "RM"},
+	{KeySpecAccess, "access"},
+	{KeySpecUpdate, "update"},
+	{KeySpecInsert, "insert"},
+	{KeySpecDelete, "delete"},
+	{KeySpecNotKey, "not_key"},
+	{KeySpecIncomplete, "incomplete"},
+	{KeySpecVariableFlags, "variable_flags"},
+}
+
+// KeySpecBeginSearchType is how the search of the keys of a key spec
+// begins.
+type KeySpecBeginSearchType uint8
+
+const (
+	KeySpecBeginIndex   KeySpecBeginSearchType = iota // The search begins at a fixed argument index.
+	KeySpecBeginKeyword                               // The search begins after a keyword argument.
+)
+
+// KeySpecFindKeysType is how the keys of a key spec are found, starting from
+// its begin search index.
+type KeySpecFindKeysType uint8
+
+const (
+	KeySpecRange  KeySpecFindKeysType = iota // The keys are in a range of arguments.
+	KeySpecKeyNum                            // The number of keys is given by an argument, the keys follow it.
+)
+
+// KeySpec describes where a command finds its keys and how it accesses them.
+type KeySpec struct {
+	notes       string
+	flags       KeySpecFlags
+	beginSearch KeySpecBeginSearchType
+
+	// KeySpecBeginIndex: index of the argument where the search of the keys
+	// begins.
+	beginIndex int
+
+	// KeySpecBeginKeyword: the search begins after the keyword, looked up
+	// from the startFrom index, or backwards from the end of the arguments
+	// if startFrom is negative.
+	keyword   string
+	startFrom int
+
+	findKeys KeySpecFindKeysType
+
+	// KeySpecRange: lastKey is the index of the last key relative to
+	// beginIndex, or a negative index from the end of the arguments. When
+	// lastKey is -1, limit can be used to only take a part of the remaining
+	// arguments: 2 is half of them, 3 a third, and so on.
+	lastKey int
+	keyStep int
+	limit   int
+
+	// KeySpecKeyNum: the number of keys is at beginIndex+keyNumIdx, the first
+	// key at beginIndex+firstKey, then every keyStep arguments.
+	keyNumIdx int
+	firstKey  int
+}
+
+// keyReference is a key found in the arguments of a command.
+type keyReference struct {
+	pos   int          // Index of the key in argv
+	flags KeySpecFlags // Flags of the key spec of the key
+}
+
+// getKeysFromCommand returns the keys of the command arguments, as described
+// by the key specs of the command. Arguments that don't parse as a valid
+// number of keys yield no keys, the command itself replies the error.
+func getKeysFromCommand(cmd RedisCommand, argv []*db.RedisObj, argc int) []keyReference {
+	keys, _ := getKeysFromCommandWithSpecs(cmd, argv, argc, true)
+	return keys
+}
+
+// getKeysFromCommandWithSpecs returns the keys of the command arguments, as
+// described by the key specs of the command. If partial is false, false is
+// returned as soon as a key spec doesn't match the arguments, otherwise the
+// keys of the specs that do match are returned.
+func getKeysFromCommandWithSpecs(cmd RedisCommand, argv []*db.RedisObj, argc int, partial bool) ([]keyReference, bool) {
+	var keys []keyReference
+	for _, spec := range cmd.KeySpecs() {
+		if spec.flags&KeySpecNotKey != 0 {
+			continue
+		}
+
+		first := 0
+		switch spec.beginSearch {
+		case KeySpecBeginIndex:
+			first = spec.beginIndex
+		case KeySpecBeginKeyword:
+			startIndex, endIndex := spec.startFrom, argc-1
+			if spec.startFrom <= 0 {
+				startIndex, endIndex = argc+spec.startFrom, 1
+			}
+			for j := startIndex; j >= 1 && j < argc; {
+				if strings.EqualFold(argv[j].Value.(string), spec.keyword) {
+					first = j + 1
+					break
+				}
+				if j == endIndex {
+					break
+				}
+				if startIndex <= endIndex {
+					j++
+				} else {
+					j--
+				}
+			}
+			// keyword not found
+			if first == 0 {
+				continue
+			}
+		}
+
+		last, step := 0, spec.keyStep
+		if step < 1 {
+			step = 1
+		}
+		valid := first < argc
+		switch spec.findKeys {
+		case KeySpecRange:
+			if spec.lastKey >= 0 {
+				last = first + spec.lastKey
+			} else if spec.limit == 0 {
+				last = argc + spec.lastKey
+			} else {
+				last = first + ((argc-first)/spec.limit + spec.lastKey)
+			}
+		case KeySpecKeyNum:
+			numIdx := first + spec.keyNumIdx
+			if numIdx >= argc {
+				valid = false
+				break
+			}
+			numkeys, ok := getLongLongFromObject(argv[numIdx])
+			if !ok || numkeys < 0 {
+				valid = false
+				break
+			}
+			first += spec.firstKey
+			last = first + (int(numkeys)-1)*step
+		}
+
+		// First or last is out of bounds, which indicates a syntax error.
+		// The partial search keeps the keys that are there.
+		if partial && last >= argc {
+			last = argc - 1
+		}
+		if !valid || last >= argc || last < first {
+			if partial {
+				continue
+			}
+			return nil, false
+		}
+		for j := first; j <= last; j += step {
+			keys = append(keys, keyReference{pos: j, flags: spec.flags})
+		}
+	}
+	return keys, true
+}
+
+// populateCommandLegacyRangeSpec computes the legacy (first key, last key,
+// step) range of the command from its key specs, as replied by COMMAND INFO.
+// The command is flagged CmdMovableKeys if the range doesn't cover all its
+// keys.
+func populateCommandLegacyRangeSpec(c *BaseCommand) {
+	c.legacyRangeKeySpec = nil
+	// no key-specs, no keys, exit.
+	if len(c.keySpecs) == 0 {
+		return
+	}
+
+	if len(c.keySpecs) == 1 && c.keySpecs[0].beginSearch == KeySpecBeginIndex && c.keySpecs[0].findKeys == KeySpecRange {
+		// Quick win, exactly one range spec.
+		spec := c.keySpecs[0]
+		c.legacyRangeKeySpec = &spec
+		// If it has the incomplete flag, set the movablekeys flag on the command.
+		if spec.flags&KeySpecIncomplete != 0 {
+			c.flags |= CmdMovableKeys
+		}
+		return
+	}
+
+	firstkey, lastkey, prevLastkey := math.MaxInt, 0, 0
+	for _, spec := range c.keySpecs {
+		if spec.beginSearch != KeySpecBeginIndex || spec.findKeys != KeySpecRange {
+			// Found an incompatible (non range) spec, skip it, and set the
+			// movablekeys flag.
+			c.flags |= CmdMovableKeys
+			continue
+		}
+		if spec.keyStep != 1 || (prevLastkey != 0 && prevLastkey != spec.beginIndex-1) {
+			// Found a range spec that's not plain (step of 1) or not
+			// consecutive to the previous one. Skip it, and we set the
+			// movablekeys flag.
+			c.flags |= CmdMovableKeys
+			continue
+		}
+		if spec.flags&KeySpecIncomplete != 0 {
+			// The spec we're using is incomplete, we can use it, but we also
+			// have to set the movablekeys flag.
+			c.flags |= CmdMovableKeys
+		}
+		if spec.beginIndex < firstkey {
+			firstkey = spec.beginIndex
+		}
+		// Get the absolute index for lastkey (in the "range" spec, lastkey
+		// is relative to firstkey), the negative ones are bigger than all.
+		lastkeyAbsIndex := spec.lastKey
+		if lastkeyAbsIndex >= 0 {
+			lastkeyAbsIndex += spec.beginIndex
+		}
+		if uint(lastkeyAbsIndex) > uint(lastkey) {
+			lastkey = lastkeyAbsIndex
+		}
+		prevLastkey = lastkey
+	}
+
+	if firstkey == math.MaxInt {
+		// Couldn't find range specs, the legacy range spec will remain
+		// empty, and we set the movablekeys flag.
+		c.flags |= CmdMovableKeys
+		return
+	}
+
+	legacy := &KeySpec{beginIndex: firstkey, findKeys: KeySpecRange, keyStep: 1, lastKey: lastkey}
+	// in the "range" spec, lastkey is relative to firstkey
+	if lastkey >= 0 {
+		legacy.lastKey = lastkey - firstkey
+	}
+	c.legacyRangeKeySpec = legacy
+}
+
+// lookupCommandByFullname returns the command, or the subcommand in the
+// "container|subcommand" form, with the given name.
+func lookupCommandByFullname(name string) RedisCommand {
+	parts := strings.Split(strings.ToLower(name), "|")
+	if len(parts) > 2 {
+		return nil
+	}
+	cmd, ok := server.commands.Get(parts[0])
+	if !ok {
+		return nil
+	}
+	if len(parts) == 1 {
+		return cmd
+	}
+	if cmd.SubCommandsDict() == nil {
+		return nil
+	}
+	sub, ok := cmd.SubCommandsDict().Get(parts[1])
+	if !ok {
+		return nil
+	}
+	return sub
+}
+
 type RedisCommandGroup uint8
 
 const (
@@ -78,10 +394,33 @@ const (
 	RedisCommandGroupModule
 )
 
+// commandGroupNames are the names of the command groups, as replied by
+// COMMAND DOCS.
+var commandGroupNames = []string{
+	RedisCommandGroupGeneric:     "generic",
+	RedisCommandGroupString:      "string",
+	RedisCommandGroupList:        "list",
+	RedisCommandGroupSet:         "set",
+	RedisCommandGroupSortedSet:   "sorted-set",
+	RedisCommandGroupHash:        "hash",
+	RedisCommandGroupPubSub:      "pubsub",
+	RedisCommandGroupTransaction: "transactions",
+	RedisCommandGroupConnection:  "connection",
+	RedisCommandGroupServer:      "server",
+	RedisCommandGroupScripting:   "scripting",
+	RedisCommandGroupHyperLogLog: "hyperloglog",
+	RedisCommandGroupCluster:     "cluster",
+	RedisCommandGroupSentinel:    "sentinel",
+	RedisCommandGroupGeo:         "geo",
+	RedisCommandGroupStream:      "stream",
+	RedisCommandGroupBitmap:      "bitmap",
+	RedisCommandGroupModule:      "module",
+}
+
 var (
 	// Shared command responses
 
-	SharedOk         = createRawStringObject(fmt.Sprintf("OK%s", resp.CRLF))
+	SharedOk         = createRawStringObject(fmt.Sprintf("%cOK%s", resp.TypeSimple, resp.CRLF))
 	SharedEmptyBulk  = createRawStringObject(fmt.Sprintf("%c0%s%s", resp.TypeBlob, resp.CRLF, resp.CRLF))
 	SharedZCone      = createRawStringObject(fmt.Sprintf("%c0%s", resp.TypeInteger, resp.CRLF))
 	SharedCone       = createRawStringObject(fmt.Sprintf("%c1%s", resp.TypeInteger, resp.CRLF))
@@ -103,20 +442,27 @@ var (
 	SharedNoScriptErr    = createRawStringObject(fmt.Sprintf("%cNOSCRIPT No matching script. Please use EVAL.%s", resp.TypeError, resp.CRLF))
 	SharedLoadingErr     = createRawStringObject(fmt.Sprintf("%cLOADING Redis is loading the dataset in memory%s", resp.TypeError, resp.CRLF))
 	SharedSlowEvalErr    = createRawStringObject(fmt.Sprintf("%cBUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.%s", resp.TypeError, resp.CRLF))
-	SharedSlowScriptErr  = createRawStringObject(fmt.Sprintf("%cBUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.%s", resp.TypeError, resp.CRLF))
+	SharedSlowScriptErr  = createRawStringObject(fmt.Sprintf("%cBUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.%s", resp.TypeError, resp.CRLF))
 	SharedNoAuthErr      = createRawStringObject(fmt.Sprintf("%cNOAUTH Authentication required.%s", resp.TypeError, resp.CRLF))
 	ShardOOMErr          = createRawStringObject(fmt.Sprintf("%cOOM command not allowed when used memory > 'maxmemory'.%s", resp.TypeError, resp.CRLF))
 	SharedExecAbortErr   = createRawStringObject(fmt.Sprintf("%cEXECABORT Transaction discarded because of previous errors.%s", resp.TypeError, resp.CRLF))
 	SharedBusyKeyErr     = createRawStringObject(fmt.Sprintf("%cBUSYKEY Target key name already exists.%s", resp.TypeError, resp.CRLF))
 
-	// The shared NULL depends on the protocol version, we just impl RESP3
+	// The shared NULL depends on the protocol version, use addReplyNull and
+	// addReplyNullArray to emit the one of the client.
 
 	// SharedNull3 for RESP3
 	SharedNull3 = createRawStringObject(fmt.Sprintf("%c%s", resp.TypeNull, resp.CRLF))
 
+	// SharedNull2 for RESP2
+	SharedNull2 = createRawStringObject(fmt.Sprintf("%c-1%s", resp.TypeBlob, resp.CRLF))
+
 	// SharedNullArray3 for RESP3
 	SharedNullArray3 = createRawStringObject(fmt.Sprintf("%c%s", resp.TypeNull, resp.CRLF))
 
+	// SharedNullArray2 for RESP2
+	SharedNullArray2 = createRawStringObject(fmt.Sprintf("%c-1%s", resp.TypeArray, resp.CRLF))
+
 	// SharedEmptySet3 for RESP3
 	SharedEmptySet3 = createRawStringObject(fmt.Sprintf("%c0%s", resp.TypeSet, resp.CRLF))
 
@@ -189,9 +535,19 @@ type MultiState struct {
 	cmdFlags CommandFlags
 }
 
+// RedisCommandArgs describes an argument of a command, the arguments of type
+// ArgTypeOnEOF and ArgTypeBlock have their own arguments.
 type RedisCommandArgs struct {
-	name    string
-	numArgs int
+	name            string
+	tp              CommandArgType
+	keySpecIndex    int // The key spec of an argument of type ArgTypeKey.
+	token           string
+	summary         string
+	since           string
+	flags           CommandArgFlags
+	deprecatedSince string
+	displayText     string
+	subArgs         []*RedisCommandArgs
 }
 
 type CommandHistory struct {
@@ -201,28 +557,35 @@ type CommandHistory struct {
 
 type RedisCommandProc func(c *Client) error
 
-var ExecCommand RedisCommandProc = func(c *Client) error {
-	return nil
-}
-
 type RedisCommand interface {
 	Proc() RedisCommandProc //Command implementation
 	DeclaredName() string
+	Summary() string
+	Complexity() string
+	Since() string
+	DocFlags() CommandDocFlags
+	ReplacedBy() string
+	DeprecatedSince() string
 	Group() RedisCommandGroup
 	History() []*CommandHistory
+	Tips() []string
 	SubCommands() []RedisCommand
 	SubCommandsDict() *db.HashTable[string, RedisCommand]
 	Args() []*RedisCommandArgs
 	Arity() int
 	ACLCategories() uint64
 	Flags() CommandFlags
+	KeySpecs() []KeySpec
 
 	// Runtime populated data
 
+	LegacyRangeKeySpec() *KeySpec // The legacy (first, last, step) key spec, nil if the command has no keys.
+
 	Id() uint64 /* Command id,this is a progressive number starting from 0, and is used in order to check
 	ACLs. A connection is able to execute a given command if the user associated to the connection*/
 
 	MicroSeconds() int64
+	SetMicroSeconds(int64)
 	GetCalls() int64
 	SetCalls(int64)
 
@@ -232,22 +595,33 @@ type RedisCommand interface {
 	GetFailedCalls() int64
 	SetFailedCalls(int64)
 
+	LatencyHistogram() *hdrHistogram
+	SetLatencyHistogram(*hdrHistogram)
+
 	Parent() RedisCommand
 	Fullname() string
 }
 
 type BaseCommand struct {
 	declaredName    string
+	summary         string // Summary of the command (optional).
+	complexity      string // Complexity description (optional).
+	since           string // Debut version of the command (optional).
+	docFlags        CommandDocFlags
+	replacedBy      string // In case the command is deprecated, this is the successor command.
+	deprecatedSince string // In case the command is deprecated, when did it happen?
 	proc            RedisCommandProc
 	fullname        string
 	group           RedisCommandGroup
 	history         []*CommandHistory
+	tips            []string // An array of strings that are meant to be tips for clients/proxies regarding this command
 	subCommands     []RedisCommand
 	subCommandsDict *db.HashTable[string, RedisCommand]
 	args            []*RedisCommandArgs
 	arity           int
 	aclCategories   uint64
-	flags           uint64
+	flags           CommandFlags
+	keySpecs        []KeySpec
 
 	// Runtime populated data
 	id            int
@@ -256,4 +630,146 @@ type BaseCommand struct {
 	rejectedCalls int64
 	failedCalls   int64
 	parent        RedisCommand
+
+	latencyHistogram   *hdrHistogram // Points to the command latency histogram (unit of time nanosecond)
+	legacyRangeKeySpec *KeySpec      // The legacy (first,last,step) key spec is still maintained (if applicable) so that we can still support the reply format of COMMAND INFO and COMMAND GETKEYS
+}
+
+// CmdCallFlags control the side effects of Client.call
+type CmdCallFlags uint8
+
+const (
+	CmdCallNone    CmdCallFlags = 0
+	CmdCallStats   CmdCallFlags = 1 << iota // Update the command stats
+	CmdCallSlowLog                          // Log the command in the slow log if slow enough
+	CmdCallFull    = CmdCallStats | CmdCallSlowLog
+)
+
+func (b *BaseCommand) Proc() RedisCommandProc {
+	return b.proc
+}
+
+func (b *BaseCommand) DeclaredName() string {
+	return b.declaredName
+}
+
+func (b *BaseCommand) Summary() string {
+	return b.summary
+}
+
+func (b *BaseCommand) Complexity() string {
+	return b.complexity
+}
+
+func (b *BaseCommand) Since() string {
+	return b.since
+}
+
+func (b *BaseCommand) DocFlags() CommandDocFlags {
+	return b.docFlags
+}
+
+func (b *BaseCommand) ReplacedBy() string {
+	return b.replacedBy
+}
+
+func (b *BaseCommand) DeprecatedSince() string {
+	return b.deprecatedSince
+}
+
+func (b *BaseCommand) Tips() []string {
+	return b.tips
+}
+
+func (b *BaseCommand) LegacyRangeKeySpec() *KeySpec {
+	return b.legacyRangeKeySpec
+}
+
+func (b *BaseCommand) Group() RedisCommandGroup {
+	return b.group
+}
+
+func (b *BaseCommand) History() []*CommandHistory {
+	return b.history
+}
+
+func (b *BaseCommand) SubCommands() []RedisCommand {
+	return b.subCommands
+}
+
+func (b *BaseCommand) SubCommandsDict() *db.HashTable[string, RedisCommand] {
+	return b.subCommandsDict
+}
+
+func (b *BaseCommand) Args() []*RedisCommandArgs {
+	return b.args
+}
+
+func (b *BaseCommand) Arity() int {
+	return b.arity
+}
+
+func (b *BaseCommand) ACLCategories() uint64 {
+	return b.aclCategories
+}
+
+func (b *BaseCommand) Flags() CommandFlags {
+	return b.flags
+}
+
+func (b *BaseCommand) KeySpecs() []KeySpec {
+	return b.keySpecs
+}
+
+func (b *BaseCommand) Id() uint64 {
+	return uint64(b.id)
+}
+
+func (b *BaseCommand) MicroSeconds() int64 {
+	return b.microSeconds
+}
+
+func (b *BaseCommand) SetMicroSeconds(us int64) {
+	b.microSeconds = us
+}
+
+func (b *BaseCommand) GetCalls() int64 {
+	return b.calls
+}
+
+func (b *BaseCommand) SetCalls(calls int64) {
+	b.calls = calls
+}
+
+func (b *BaseCommand) GetRejectedCalls() int64 {
+	return b.rejectedCalls
+}
+
+func (b *BaseCommand) SetRejectedCalls(calls int64) {
+	b.rejectedCalls = calls
+}
+
+func (b *BaseCommand) GetFailedCalls() int64 {
+	return b.failedCalls
+}
+
+func (b *BaseCommand) SetFailedCalls(calls int64) {
+	b.failedCalls = calls
+}
+
+func (b *BaseCommand) LatencyHistogram() *hdrHistogram {
+	return b.latencyHistogram
+}
+
+func (b *BaseCommand) SetLatencyHistogram(h *hdrHistogram) {
+	b.latencyHistogram = h
+}
+
+func (b *BaseCommand) Parent() RedisCommand {
+	return b.parent
+}
+
+// Fullname returns the lowercase command name, "parent|sub" for subcommands.
+func (b *BaseCommand) Fullname() string {
+	return b.fullname
 }
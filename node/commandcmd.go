@@ -0,0 +1,595 @@
+package node
+
+import (
+	"sort"
+	"strings"
+)
+
+// commandFlagNames are the names of the command flags, as replied by
+// COMMAND INFO.
+var commandFlagNames = []struct {
+	flag CommandFlags
+	name string
+}{
+	{CmdWrite, "write"},
+	{CmdReadOnly, "readonly"},
+	{CmdDenyOOM, "denyoom"},
+	{CmdModule, "module"},
+	{CmdAdmin, "admin"},
+	{CmdPubSub, "pubsub"},
+	{CmdNoScript, "noscript"},
+	{CmdBlocking, "blocking"},
+	{CmdLoading, "loading"},
+	{CmdStale, "stale"},
+	{CmdSkipMonitor, "skip_monitor"},
+	{CmdSkipSlowLog, "skip_slowlog"},
+	{CmdAsking, "asking"},
+	{CmdFast, "fast"},
+	{CmdNoAuth, "no_auth"},
+	{CmdMayReplicate, "may_replicate"},
+	{CmdNoMandatoryKeys, "no_mandatory_keys"},
+	{CmdNoAsyncLoading, "no_async_loading"},
+	{CmdNoMulti, "no_multi"},
+	{CmdMovableKeys, "movablekeys"},
+	{CmdAllowBusy, "allow_busy"},
+}
+
+type CommandCmd struct {
+	c *Client
+}
+
+// NewCommandCmd returns a new CommandCmd.
+func NewCommandCmd(c *Client) *CommandCmd {
+	return &CommandCmd{c: c}
+}
+
+// sortedCommands returns the top level commands, sorted by name.
+func sortedCommands() []RedisCommand {
+	cmds := make([]RedisCommand, 0, server.commands.Len())
+	server.commands.Range(func(_ string, cmd RedisCommand) bool {
+		cmds = append(cmds, cmd)
+		return true
+	})
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Fullname() < cmds[j].Fullname() })
+	return cmds
+}
+
+// addReplyFlagSet replies the names of the flags that are set.
+func (c *Client) addReplyFlagSet(names []string) {
+	c.addReplySetLen(len(names))
+	for _, name := range names {
+		c.addReplyStatus(name)
+	}
+}
+
+func (c *Client) addReplyCommandFlags(cmd RedisCommand) {
+	var names []string
+	for _, f := range commandFlagNames {
+		if cmd.Flags()&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	c.addReplyFlagSet(names)
+}
+
+func (c *Client) addReplyKeySpecFlags(flags KeySpecFlags) {
+	var names []string
+	for _, f := range keySpecFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	c.addReplyFlagSet(names)
+}
+
+func (c *Client) addReplyCommandCategories(cmd RedisCommand) {
+	var names []string
+	for j := 0; ACLCommandCategories[j].flag != 0; j++ {
+		if cmd.ACLCategories()&ACLCommandCategories[j].flag != 0 {
+			names = append(names, "@"+ACLCommandCategories[j].name)
+		}
+	}
+	c.addReplyFlagSet(names)
+}
+
+func (c *Client) addReplyCommandKeySpecs(cmd RedisCommand) {
+	specs := cmd.KeySpecs()
+	c.addReplyArrayLen(len(specs))
+	for _, spec := range specs {
+		maplen := 3
+		if spec.notes != "" {
+			maplen++
+		}
+		c.addReplyMapLen(maplen)
+		if spec.notes != "" {
+			c.addReplyBulkCString("notes")
+			c.addReplyBulkCString(spec.notes)
+		}
+		c.addReplyBulkCString("flags")
+		c.addReplyKeySpecFlags(spec.flags)
+
+		c.addReplyBulkCString("begin_search")
+		c.addReplyMapLen(2)
+		c.addReplyBulkCString("type")
+		if spec.beginSearch == KeySpecBeginKeyword {
+			c.addReplyBulkCString("keyword")
+			c.addReplyBulkCString("spec")
+			c.addReplyMapLen(2)
+			c.addReplyBulkCString("keyword")
+			c.addReplyBulkCString(spec.keyword)
+			c.addReplyBulkCString("startfrom")
+			c.addReplyLongLong(int64(spec.startFrom))
+		} else {
+			c.addReplyBulkCString("index")
+			c.addReplyBulkCString("spec")
+			c.addReplyMapLen(1)
+			c.addReplyBulkCString("index")
+			c.addReplyLongLong(int64(spec.beginIndex))
+		}
+
+		c.addReplyBulkCString("find_keys")
+		c.addReplyMapLen(2)
+		c.addReplyBulkCString("type")
+		if spec.findKeys == KeySpecKeyNum {
+			c.addReplyBulkCString("keynum")
+			c.addReplyBulkCString("spec")
+			c.addReplyMapLen(3)
+			c.addReplyBulkCString("keynumidx")
+			c.addReplyLongLong(int64(spec.keyNumIdx))
+			c.addReplyBulkCString("firstkey")
+			c.addReplyLongLong(int64(spec.firstKey))
+			c.addReplyBulkCString("keystep")
+			c.addReplyLongLong(int64(spec.keyStep))
+		} else {
+			c.addReplyBulkCString("range")
+			c.addReplyBulkCString("spec")
+			c.addReplyMapLen(3)
+			c.addReplyBulkCString("lastkey")
+			c.addReplyLongLong(int64(spec.lastKey))
+			c.addReplyBulkCString("keystep")
+			c.addReplyLongLong(int64(spec.keyStep))
+			c.addReplyBulkCString("limit")
+			c.addReplyLongLong(int64(spec.limit))
+		}
+	}
+}
+
+// addReplyCommandInfo replies the info of the command: its name, arity,
+// flags, the legacy (first, last, step) key range, ACL categories, tips,
+// key specs and subcommands. A nil command is replied as a null.
+func (c *Client) addReplyCommandInfo(cmd RedisCommand) {
+	if cmd == nil {
+		c.addReplyNull()
+		return
+	}
+	var firstkey, lastkey, keystep int
+	if spec := cmd.LegacyRangeKeySpec(); spec != nil {
+		firstkey = spec.beginIndex
+		lastkey = spec.lastKey
+		if lastkey >= 0 {
+			lastkey += firstkey
+		}
+		keystep = spec.keyStep
+	}
+
+	c.addReplyArrayLen(10)
+	c.addReplyBulkCString(cmd.Fullname())
+	c.addReplyLongLong(int64(cmd.Arity()))
+	c.addReplyCommandFlags(cmd)
+	c.addReplyLongLong(int64(firstkey))
+	c.addReplyLongLong(int64(lastkey))
+	c.addReplyLongLong(int64(keystep))
+	c.addReplyCommandCategories(cmd)
+	c.addReplyArrayLen(len(cmd.Tips()))
+	for _, tip := range cmd.Tips() {
+		c.addReplyBulkCString(tip)
+	}
+	c.addReplyCommandKeySpecs(cmd)
+	c.addReplyArrayLen(len(cmd.SubCommands()))
+	for _, sub := range cmd.SubCommands() {
+		c.addReplyCommandInfo(sub)
+	}
+}
+
+func (c *Client) addReplyCommandArgList(args []*RedisCommandArgs) {
+	c.addReplyArrayLen(len(args))
+	for _, arg := range args {
+		// Name, type and flags (which may be empty) are always replied.
+		maplen := 2
+		if arg.tp == ArgTypeKey {
+			maplen++
+		}
+		if arg.token != "" {
+			maplen++
+		}
+		if arg.summary != "" {
+			maplen++
+		}
+		if arg.since != "" {
+			maplen++
+		}
+		if arg.deprecatedSince != "" {
+			maplen++
+		}
+		if arg.flags != 0 {
+			maplen++
+		}
+		if arg.tp == ArgTypeOnEOF || arg.tp == ArgTypeBlock {
+			maplen++
+		} else {
+			maplen++ // display_text
+		}
+
+		c.addReplyMapLen(maplen)
+		c.addReplyBulkCString("name")
+		c.addReplyBulkCString(arg.name)
+		c.addReplyBulkCString("type")
+		c.addReplyBulkCString(argTypeNames[arg.tp])
+		if arg.tp == ArgTypeKey {
+			c.addReplyBulkCString("key_spec_index")
+			c.addReplyLongLong(int64(arg.keySpecIndex))
+		}
+		if arg.token != "" {
+			c.addReplyBulkCString("token")
+			c.addReplyBulkCString(arg.token)
+		}
+		if arg.summary != "" {
+			c.addReplyBulkCString("summary")
+			c.addReplyBulkCString(arg.summary)
+		}
+		if arg.since != "" {
+			c.addReplyBulkCString("since")
+			c.addReplyBulkCString(arg.since)
+		}
+		if arg.deprecatedSince != "" {
+			c.addReplyBulkCString("deprecated_since")
+			c.addReplyBulkCString(arg.deprecatedSince)
+		}
+		if arg.flags != 0 {
+			var names []string
+			if arg.flags&CmdArgOptional != 0 {
+				names = append(names, "optional")
+			}
+			if arg.flags&CmdArgMultiple != 0 {
+				names = append(names, "multiple")
+			}
+			if arg.flags&CmdArgMultipleToken != 0 {
+				names = append(names, "multiple_token")
+			}
+			c.addReplyBulkCString("flags")
+			c.addReplyFlagSet(names)
+		}
+		if arg.tp == ArgTypeOnEOF || arg.tp == ArgTypeBlock {
+			c.addReplyBulkCString("arguments")
+			c.addReplyCommandArgList(arg.subArgs)
+		} else {
+			c.addReplyBulkCString("display_text")
+			if arg.displayText != "" {
+				c.addReplyBulkCString(arg.displayText)
+			} else {
+				c.addReplyBulkCString(arg.name)
+			}
+		}
+	}
+}
+
+// addReplyCommandDocs replies the documentation of the command, the optional
+// fields are only replied when they are set.
+func (c *Client) addReplyCommandDocs(cmd RedisCommand) {
+	// Count our reply len so we don't have to use deferred reply.
+	maplen := 1 // group
+	if cmd.Summary() != "" {
+		maplen++
+	}
+	if cmd.Since() != "" {
+		maplen++
+	}
+	if cmd.Complexity() != "" {
+		maplen++
+	}
+	if cmd.DocFlags() != 0 {
+		maplen++
+	}
+	if cmd.DeprecatedSince() != "" {
+		maplen++
+	}
+	if cmd.ReplacedBy() != "" {
+		maplen++
+	}
+	if len(cmd.History()) != 0 {
+		maplen++
+	}
+	if len(cmd.Args()) != 0 {
+		maplen++
+	}
+	if len(cmd.SubCommands()) != 0 {
+		maplen++
+	}
+
+	c.addReplyMapLen(maplen)
+	if cmd.Summary() != "" {
+		c.addReplyBulkCString("summary")
+		c.addReplyBulkCString(cmd.Summary())
+	}
+	if cmd.Since() != "" {
+		c.addReplyBulkCString("since")
+		c.addReplyBulkCString(cmd.Since())
+	}
+	c.addReplyBulkCString("group")
+	c.addReplyBulkCString(commandGroupNames[cmd.Group()])
+	if cmd.Complexity() != "" {
+		c.addReplyBulkCString("complexity")
+		c.addReplyBulkCString(cmd.Complexity())
+	}
+	if cmd.DocFlags() != 0 {
+		var names []string
+		if cmd.DocFlags()&CmdDocDeprecated != 0 {
+			names = append(names, "deprecated")
+		}
+		if cmd.DocFlags()&CmdDocSyscmd != 0 {
+			names = append(names, "syscmd")
+		}
+		c.addReplyBulkCString("doc_flags")
+		c.addReplyFlagSet(names)
+	}
+	if cmd.DeprecatedSince() != "" {
+		c.addReplyBulkCString("deprecated_since")
+		c.addReplyBulkCString(cmd.DeprecatedSince())
+	}
+	if cmd.ReplacedBy() != "" {
+		c.addReplyBulkCString("replaced_by")
+		c.addReplyBulkCString(cmd.ReplacedBy())
+	}
+	if len(cmd.History()) != 0 {
+		c.addReplyBulkCString("history")
+		c.addReplyArrayLen(len(cmd.History()))
+		for _, h := range cmd.History() {
+			c.addReplyArrayLen(2)
+			c.addReplyBulkCString(h.since)
+			c.addReplyBulkCString(h.changes)
+		}
+	}
+	if len(cmd.Args()) != 0 {
+		c.addReplyBulkCString("arguments")
+		c.addReplyCommandArgList(cmd.Args())
+	}
+	if len(cmd.SubCommands()) != 0 {
+		c.addReplyBulkCString("subcommands")
+		c.addReplyMapLen(len(cmd.SubCommands()))
+		for _, sub := range cmd.SubCommands() {
+			c.addReplyBulkCString(sub.Fullname())
+			c.addReplyCommandDocs(sub)
+		}
+	}
+}
+
+// Command implements COMMAND
+// It replies with the info of every command.
+func (cmd *CommandCmd) Command() {
+	c := cmd.c
+	cmds := sortedCommands()
+	c.addReplyArrayLen(len(cmds))
+	for _, command := range cmds {
+		c.addReplyCommandInfo(command)
+	}
+}
+
+// Count implements COMMAND COUNT
+func (cmd *CommandCmd) Count() {
+	cmd.c.addReplyLongLong(int64(server.commands.Len()))
+}
+
+// Info implements COMMAND INFO [command-name ...]
+// Without arguments it replies with the info of every command, otherwise
+// with the info of the given commands, null for the unknown ones.
+func (cmd *CommandCmd) Info() {
+	c := cmd.c
+	if c.argc == 2 {
+		cmd.Command()
+		return
+	}
+	c.addReplyArrayLen(c.argc - 2)
+	for j := 2; j < c.argc; j++ {
+		c.addReplyCommandInfo(lookupCommandByFullname(c.argv[j].Value.(string)))
+	}
+}
+
+// Docs implements COMMAND DOCS [command-name ...]
+// It replies with a map of the command names to their docs, the unknown
+// commands are skipped.
+func (cmd *CommandCmd) Docs() {
+	c := cmd.c
+	if c.argc == 2 {
+		cmds := sortedCommands()
+		c.addReplyMapLen(len(cmds))
+		for _, command := range cmds {
+			c.addReplyBulkCString(command.Fullname())
+			c.addReplyCommandDocs(command)
+		}
+		return
+	}
+
+	var cmds []RedisCommand
+	for j := 2; j < c.argc; j++ {
+		if command := lookupCommandByFullname(c.argv[j].Value.(string)); command != nil {
+			cmds = append(cmds, command)
+		}
+	}
+	c.addReplyMapLen(len(cmds))
+	for _, command := range cmds {
+		c.addReplyBulkCString(command.Fullname())
+		c.addReplyCommandDocs(command)
+	}
+}
+
+// commandListWithFilter appends the names of the command and its
+// subcommands that pass the filter.
+func commandListWithFilter(names []string, cmd RedisCommand, filter func(RedisCommand) bool) []string {
+	if filter(cmd) {
+		names = append(names, cmd.Fullname())
+	}
+	for _, sub := range cmd.SubCommands() {
+		names = commandListWithFilter(names, sub, filter)
+	}
+	return names
+}
+
+// List implements COMMAND LIST [FILTERBY MODULE module-name|ACLCAT category|PATTERN pattern]
+func (cmd *CommandCmd) List() {
+	c := cmd.c
+	filter := func(RedisCommand) bool { return true }
+	if c.argc == 5 && strings.EqualFold(c.argv[2].Value.(string), "filterby") {
+		arg := c.argv[4].Value.(string)
+		switch strings.ToLower(c.argv[3].Value.(string)) {
+		case "module":
+			// There are no modules, no command matches.
+			filter = func(RedisCommand) bool { return false }
+		case "aclcat":
+			flag, ok := ACLGetCommandCategoryFlagByName(arg)
+			filter = func(command RedisCommand) bool { return ok && command.ACLCategories()&flag != 0 }
+		case "pattern":
+			filter = func(command RedisCommand) bool { return stringMatch(arg, command.Fullname(), true) }
+		default:
+			c.AddReply(SharedSyntaxErr)
+			return
+		}
+	} else if c.argc != 2 {
+		c.AddReply(SharedSyntaxErr)
+		return
+	}
+
+	var names []string
+	for _, command := range sortedCommands() {
+		names = commandListWithFilter(names, command, filter)
+	}
+	c.addReplyArrayLen(len(names))
+	for _, name := range names {
+		c.addReplyBulkCString(name)
+	}
+}
+
+// doesCommandHaveKeys reports whether some key spec of the command points
+// out actual keys.
+func doesCommandHaveKeys(cmd RedisCommand) bool {
+	for _, spec := range cmd.KeySpecs() {
+		if spec.flags&KeySpecNotKey == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// getKeys replies the keys of the command given as arguments, with their
+// flags if withFlags is set.
+func (cmd *CommandCmd) getKeys(withFlags bool) {
+	c := cmd.c
+	argv, argc := c.argv[2:], c.argc-2
+	command := c.lookupCommand(argv, argc)
+	if command == nil {
+		c.AddReplyError("Invalid command specified")
+		return
+	}
+	if !doesCommandHaveKeys(command) {
+		c.AddReplyError("The command has no key arguments")
+		return
+	}
+	if (command.Arity() > 0 && command.Arity() != argc) || argc < -command.Arity() {
+		c.AddReplyError("Invalid number of arguments specified for command")
+		return
+	}
+
+	keys, ok := getKeysFromCommandWithSpecs(command, argv, argc, false)
+	if !ok || len(keys) == 0 {
+		if command.Flags()&CmdNoMandatoryKeys != 0 {
+			c.addReplyArrayLen(0)
+		} else {
+			c.AddReplyError("Invalid arguments specified for command")
+		}
+		return
+	}
+
+	c.addReplyArrayLen(len(keys))
+	for _, key := range keys {
+		if withFlags {
+			c.addReplyArrayLen(2)
+			c.AddReplyBulk(argv[key.pos])
+			c.addReplyKeySpecFlags(key.flags)
+		} else {
+			c.AddReplyBulk(argv[key.pos])
+		}
+	}
+}
+
+// GetKeys implements COMMAND GETKEYS command [arg ...]
+func (cmd *CommandCmd) GetKeys() {
+	cmd.getKeys(false)
+}
+
+// GetKeysAndFlags implements COMMAND GETKEYSANDFLAGS command [arg ...]
+func (cmd *CommandCmd) GetKeysAndFlags() {
+	cmd.getKeys(true)
+}
+
+// Help implements COMMAND HELP
+func (cmd *CommandCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"(no subcommand)",
+		"    Return details about all Redis commands.",
+		"COUNT",
+		"    Return the total number of commands in this Redis server.",
+		"LIST",
+		"    Return a list of all commands in this Redis server.",
+		"INFO [<command-name> ...]",
+		"    Return details about multiple Redis commands.",
+		"    If no command names are given, documentation details for all",
+		"    commands are returned.",
+		"DOCS [<command-name> ...]",
+		"    Return documentation details about multiple Redis commands.",
+		"    If no command names are given, documentation details for all",
+		"    commands are returned.",
+		"GETKEYS <full-command>",
+		"    Return the keys from a full Redis command.",
+		"GETKEYSANDFLAGS <full-command>",
+		"    Return the keys and the access flags from a full Redis command.",
+	})
+}
+
+func commandCommand(c *Client) error {
+	NewCommandCmd(c).Command()
+	return nil
+}
+
+func commandCountCommand(c *Client) error {
+	NewCommandCmd(c).Count()
+	return nil
+}
+
+func commandInfoCommand(c *Client) error {
+	NewCommandCmd(c).Info()
+	return nil
+}
+
+func commandDocsCommand(c *Client) error {
+	NewCommandCmd(c).Docs()
+	return nil
+}
+
+func commandListCommand(c *Client) error {
+	NewCommandCmd(c).List()
+	return nil
+}
+
+func commandGetKeysCommand(c *Client) error {
+	NewCommandCmd(c).GetKeys()
+	return nil
+}
+
+func commandGetKeysAndFlagsCommand(c *Client) error {
+	NewCommandCmd(c).GetKeysAndFlags()
+	return nil
+}
+
+func commandHelpCommand(c *Client) error {
+	NewCommandCmd(c).Help()
+	return nil
+}
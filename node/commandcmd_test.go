@@ -0,0 +1,148 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCommandInfo(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "COMMAND", "COUNT"); got != ":"+strconv.Itoa(server.commands.Len())+"\r\n" {
+		t.Fatalf("COMMAND COUNT replied %q", got)
+	}
+
+	got := sendCommand(c, conn, "COMMAND", "INFO", "get", "unknown")
+	want := "*2\r\n*10\r\n" + bulkString("get") + ":2\r\n" +
+		"*2\r\n+readonly\r\n+fast\r\n" +
+		":1\r\n:1\r\n:1\r\n" +
+		"*3\r\n+@read\r\n+@string\r\n+@fast\r\n" +
+		"*0\r\n" +
+		"*1\r\n*6\r\n" + bulkString("flags") + "*2\r\n+RO\r\n+access\r\n" +
+		bulkString("begin_search") + "*4\r\n" + bulkString("type") + bulkString("index") + bulkString("spec") + "*2\r\n" + bulkString("index") + ":1\r\n" +
+		bulkString("find_keys") + "*4\r\n" + bulkString("type") + bulkString("range") + bulkString("spec") + "*6\r\n" +
+		bulkString("lastkey") + ":0\r\n" + bulkString("keystep") + ":1\r\n" + bulkString("limit") + ":0\r\n" +
+		"*0\r\n" +
+		"$-1\r\n"
+	if got != want {
+		t.Fatalf("COMMAND INFO replied %q, want %q", got, want)
+	}
+
+	// The keys of EVAL can't be found with the legacy range.
+	got = sendCommand(c, conn, "COMMAND", "INFO", "eval")
+	if !strings.Contains(got, "+movablekeys\r\n") || !strings.Contains(got, ":0\r\n:0\r\n:0\r\n") {
+		t.Fatalf("COMMAND INFO eval replied %q", got)
+	}
+
+	got = sendCommand(c, conn, "COMMAND", "INFO", "config|get")
+	if !strings.HasPrefix(got, "*1\r\n*10\r\n"+bulkString("config|get")+":-3\r\n") {
+		t.Fatalf("COMMAND INFO config|get replied %q", got)
+	}
+}
+
+func TestCommandDocs(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	got := sendCommand(c, conn, "COMMAND", "DOCS", "setnx", "unknown")
+	want := "*2\r\n" + bulkString("setnx") + "*16\r\n" +
+		bulkString("summary") + bulkString("Set the string value of a key only when the key doesn't exist.") +
+		bulkString("since") + bulkString("1.0.0") +
+		bulkString("group") + bulkString("string") +
+		bulkString("complexity") + bulkString("O(1)") +
+		bulkString("doc_flags") + "*1\r\n+deprecated\r\n" +
+		bulkString("deprecated_since") + bulkString("2.6.12") +
+		bulkString("replaced_by") + bulkString("`SET` with the `NX` argument") +
+		bulkString("arguments") + "*2\r\n" +
+		"*8\r\n" + bulkString("name") + bulkString("key") + bulkString("type") + bulkString("key") +
+		bulkString("key_spec_index") + ":0\r\n" + bulkString("display_text") + bulkString("key") +
+		"*6\r\n" + bulkString("name") + bulkString("value") + bulkString("type") + bulkString("string") +
+		bulkString("display_text") + bulkString("value")
+	if got != want {
+		t.Fatalf("COMMAND DOCS replied %q, want %q", got, want)
+	}
+
+	got = sendCommand(c, conn, "COMMAND", "DOCS", "set")
+	for _, s := range []string{
+		bulkString("history") + "*4\r\n*2\r\n" + bulkString("2.6.12"),
+		bulkString("name") + bulkString("condition") + bulkString("type") + bulkString("oneof"),
+		bulkString("flags") + "*1\r\n+optional\r\n" + bulkString("arguments"),
+	} {
+		if !strings.Contains(got, s) {
+			t.Fatalf("COMMAND DOCS set replied %q, missing %q", got, s)
+		}
+	}
+
+	got = sendCommand(c, conn, "COMMAND", "DOCS", "client")
+	if !strings.Contains(got, bulkString("subcommands")+"*36\r\n"+bulkString("client|caching")) {
+		t.Fatalf("COMMAND DOCS client replied %q", got)
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	got := sendCommand(c, conn, "COMMAND", "LIST")
+	if !strings.Contains(got, bulkString("get")) || !strings.Contains(got, bulkString("config|get")) {
+		t.Fatalf("COMMAND LIST replied %q", got)
+	}
+
+	got = sendCommand(c, conn, "COMMAND", "LIST", "FILTERBY", "PATTERN", "SET*")
+	// PSETEX doesn't match, the pattern is case insensitive.
+	if got != "*3\r\n"+bulkString("set")+bulkString("setex")+bulkString("setnx") {
+		t.Fatalf("COMMAND LIST FILTERBY PATTERN replied %q", got)
+	}
+
+	got = sendCommand(c, conn, "COMMAND", "LIST", "FILTERBY", "ACLCAT", "transaction")
+	want := "*5\r\n" + bulkString("discard") + bulkString("exec") + bulkString("multi") + bulkString("unwatch") + bulkString("watch")
+	if got != want {
+		t.Fatalf("COMMAND LIST FILTERBY ACLCAT replied %q", got)
+	}
+
+	if got := sendCommand(c, conn, "COMMAND", "LIST", "FILTERBY", "MODULE", "m"); got != "*0\r\n" {
+		t.Fatalf("COMMAND LIST FILTERBY MODULE replied %q", got)
+	}
+	if got := sendCommand(c, conn, "COMMAND", "LIST", "FILTERBY", "ACLCAT", "unknown"); got != "*0\r\n" {
+		t.Fatalf("COMMAND LIST FILTERBY ACLCAT unknown replied %q", got)
+	}
+	if got := sendCommand(c, conn, "COMMAND", "LIST", "FILTERBY", "NAME", "x"); got != "-ERR syntax error\r\n" {
+		t.Fatalf("COMMAND LIST FILTERBY NAME replied %q", got)
+	}
+}
+
+func TestCommandGetKeys(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "COMMAND", "GETKEYS", "SET", "k", "v"); got != "*1\r\n"+bulkString("k") {
+		t.Fatalf("COMMAND GETKEYS SET replied %q", got)
+	}
+	got := sendCommand(c, conn, "COMMAND", "GETKEYS", "EVAL", "return 1", "2", "k1", "k2", "a")
+	if got != "*2\r\n"+bulkString("k1")+bulkString("k2") {
+		t.Fatalf("COMMAND GETKEYS EVAL replied %q", got)
+	}
+	if got := sendCommand(c, conn, "COMMAND", "GETKEYS", "EVAL", "return 1", "0"); got != "*0\r\n" {
+		t.Fatalf("COMMAND GETKEYS EVAL without keys replied %q", got)
+	}
+	got = sendCommand(c, conn, "COMMAND", "GETKEYSANDFLAGS", "WATCH", "k1", "k2")
+	if got != "*2\r\n*2\r\n"+bulkString("k1")+"*1\r\n+RO\r\n*2\r\n"+bulkString("k2")+"*1\r\n+RO\r\n" {
+		t.Fatalf("COMMAND GETKEYSANDFLAGS replied %q", got)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"COMMAND", "GETKEYS", "UNKNOWN", "k"}, "-ERR Invalid command specified\r\n"},
+		{[]string{"COMMAND", "GETKEYS", "PUBLISH", "ch", "msg"}, "-ERR The command has no key arguments\r\n"},
+		{[]string{"COMMAND", "GETKEYS", "GET", "k", "x"}, "-ERR Invalid number of arguments specified for command\r\n"},
+		{[]string{"COMMAND", "GETKEYS", "WATCH"}, "-ERR Invalid number of arguments specified for command\r\n"},
+	} {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Fatalf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
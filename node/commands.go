@@ -0,0 +1,634 @@
+package node
+
+/* The command table.
+ *
+ * Every entry describes a top level command, container commands (CONFIG,
+ * PUBSUB, ...) have no proc of their own and list their subcommands instead.
+ * The runtime fields (fullname, id, subcommands dict, ...) are populated by
+ * populateCommandTable when the server starts.
+ *
+ * Arity is the number of arguments including the command name itself, a
+ * negative arity means "at least -arity arguments".
+ *
+ * The documentation of the commands (summary, complexity, history, tips and
+ * arguments) is replied by COMMAND DOCS, the arguments of every command are
+ * declared before the table, grouped like the table itself. */
+
+// helpSummary is the summary of the HELP subcommand of every container.
+const helpSummary = "Returns helpful text about the different subcommands."
+
+// flushTypeArg is the ASYNC|SYNC argument of the flush commands.
+var flushTypeArg = &RedisCommandArgs{name: "flush-type", tp: ArgTypeOnEOF, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+	{name: "async", tp: ArgTypePureToken, token: "ASYNC"},
+	{name: "sync", tp: ArgTypePureToken, token: "SYNC"},
+}}
+
+/********** generic **********/
+
+var objectKeyArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+}
+
+var delArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0, flags: CmdArgMultiple},
+}
+
+/********** string **********/
+
+var getArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+}
+
+var setHistory = []*CommandHistory{
+	{"2.6.12", "Added the `EX`, `PX`, `NX` and `XX` options."},
+	{"6.0.0", "Added the `KEEPTTL` option."},
+	{"6.2.0", "Added the `GET`, `EXAT` and `PXAT` option."},
+	{"7.0.0", "Allowed the `NX` and `GET` options to be used together."},
+}
+
+var setArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+	{name: "value", tp: ArgTypeString},
+	{name: "condition", tp: ArgTypeOnEOF, since: "2.6.12", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "nx", tp: ArgTypePureToken, token: "NX"},
+		{name: "xx", tp: ArgTypePureToken, token: "XX"},
+	}},
+	{name: "get", tp: ArgTypePureToken, token: "GET", since: "6.2.0", flags: CmdArgOptional},
+	{name: "expiration", tp: ArgTypeOnEOF, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "seconds", tp: ArgTypeInteger, token: "EX", since: "2.6.12"},
+		{name: "milliseconds", tp: ArgTypeInteger, token: "PX", since: "2.6.12"},
+		{name: "unix-time-seconds", tp: ArgTypeUnixTime, token: "EXAT", since: "6.2.0"},
+		{name: "unix-time-milliseconds", tp: ArgTypeUnixTime, token: "PXAT", since: "6.2.0"},
+		{name: "keepttl", tp: ArgTypePureToken, token: "KEEPTTL", since: "6.0.0"},
+	}},
+}
+
+var setnxArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+	{name: "value", tp: ArgTypeString},
+}
+
+var setexArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+	{name: "seconds", tp: ArgTypeInteger},
+	{name: "value", tp: ArgTypeString},
+}
+
+var psetexArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+	{name: "milliseconds", tp: ArgTypeInteger},
+	{name: "value", tp: ArgTypeString},
+}
+
+/********** pubsub **********/
+
+var subscribeArgs = []*RedisCommandArgs{
+	{name: "channel", tp: ArgTypeString, flags: CmdArgMultiple},
+}
+
+var unsubscribeArgs = []*RedisCommandArgs{
+	{name: "channel", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var psubscribeArgs = []*RedisCommandArgs{
+	{name: "pattern", tp: ArgTypePattern, flags: CmdArgMultiple},
+}
+
+var punsubscribeArgs = []*RedisCommandArgs{
+	{name: "pattern", tp: ArgTypePattern, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var publishArgs = []*RedisCommandArgs{
+	{name: "channel", tp: ArgTypeString},
+	{name: "message", tp: ArgTypeString},
+}
+
+var pubsubChannelsArgs = []*RedisCommandArgs{
+	{name: "pattern", tp: ArgTypePattern, flags: CmdArgOptional},
+}
+
+var pubsubNumsubArgs = []*RedisCommandArgs{
+	{name: "channel", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+/********** transactions **********/
+
+var watchArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0, flags: CmdArgMultiple},
+}
+
+/********** scripting **********/
+
+var evalArgs = []*RedisCommandArgs{
+	{name: "script", tp: ArgTypeString},
+	{name: "numkeys", tp: ArgTypeInteger},
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0, flags: CmdArgOptional | CmdArgMultiple},
+	{name: "arg", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var evalshaArgs = []*RedisCommandArgs{
+	{name: "sha1", tp: ArgTypeString},
+	{name: "numkeys", tp: ArgTypeInteger},
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0, flags: CmdArgOptional | CmdArgMultiple},
+	{name: "arg", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var scriptLoadArgs = []*RedisCommandArgs{
+	{name: "script", tp: ArgTypeString},
+}
+
+var scriptExistsArgs = []*RedisCommandArgs{
+	{name: "sha1", tp: ArgTypeString, flags: CmdArgMultiple},
+}
+
+var scriptFlushHistory = []*CommandHistory{
+	{"6.2.0", "Added the `ASYNC` and `SYNC` flushing mode modifiers."},
+}
+
+var scriptFlushArgs = []*RedisCommandArgs{
+	{name: "flush-type", tp: ArgTypeOnEOF, since: "6.2.0", flags: CmdArgOptional, subArgs: flushTypeArg.subArgs},
+}
+
+var fcallArgs = []*RedisCommandArgs{
+	{name: "function", tp: ArgTypeString},
+	{name: "numkeys", tp: ArgTypeInteger},
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0, flags: CmdArgOptional | CmdArgMultiple},
+	{name: "arg", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var functionListArgs = []*RedisCommandArgs{
+	{name: "library-name-pattern", tp: ArgTypeString, token: "LIBRARYNAME", flags: CmdArgOptional},
+	{name: "withcode", tp: ArgTypePureToken, token: "WITHCODE", flags: CmdArgOptional},
+}
+
+var functionDeleteArgs = []*RedisCommandArgs{
+	{name: "library-name", tp: ArgTypeString},
+}
+
+var functionFlushArgs = []*RedisCommandArgs{flushTypeArg}
+
+/********** connection **********/
+
+var authHistory = []*CommandHistory{
+	{"6.0.0", "Added ACL style (username and password)."},
+}
+
+var authArgs = []*RedisCommandArgs{
+	{name: "username", tp: ArgTypeString, since: "6.0.0", flags: CmdArgOptional},
+	{name: "password", tp: ArgTypeString},
+}
+
+var helloHistory = []*CommandHistory{
+	{"6.2.0", "`protover` made optional; when called without arguments the command reports the current connection's context."},
+}
+
+var helloArgs = []*RedisCommandArgs{
+	{name: "arguments", tp: ArgTypeBlock, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "protover", tp: ArgTypeInteger},
+		{name: "auth", tp: ArgTypeBlock, token: "AUTH", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+			{name: "username", tp: ArgTypeString},
+			{name: "password", tp: ArgTypeString},
+		}},
+		{name: "clientname", tp: ArgTypeString, token: "SETNAME", flags: CmdArgOptional},
+	}},
+}
+
+var onOffArgs = []*RedisCommandArgs{
+	{name: "enabled", tp: ArgTypeOnEOF, subArgs: []*RedisCommandArgs{
+		{name: "on", tp: ArgTypePureToken, token: "ON"},
+		{name: "off", tp: ArgTypePureToken, token: "OFF"},
+	}},
+}
+
+var clientCachingArgs = []*RedisCommandArgs{
+	{name: "mode", tp: ArgTypeOnEOF, subArgs: []*RedisCommandArgs{
+		{name: "yes", tp: ArgTypePureToken, token: "YES"},
+		{name: "no", tp: ArgTypePureToken, token: "NO"},
+	}},
+}
+
+var clientKillHistory = []*CommandHistory{
+	{"2.8.12", "Added new filter format."},
+	{"2.8.12", "`ID` option."},
+	{"3.2.0", "Added `master` type in for `TYPE` option."},
+	{"5.0.0", "Replaced `slave` `TYPE` with `replica`. `slave` still supported for backward compatibility."},
+	{"6.2.0", "`LADDR` option."},
+}
+
+var clientKillArgs = []*RedisCommandArgs{
+	{name: "filter", tp: ArgTypeOnEOF, subArgs: []*RedisCommandArgs{
+		{name: "old-format", tp: ArgTypeString, deprecatedSince: "2.8.12", displayText: "ip:port"},
+		{name: "new-format", tp: ArgTypeOnEOF, flags: CmdArgMultiple, subArgs: []*RedisCommandArgs{
+			{name: "client-id", tp: ArgTypeInteger, token: "ID", since: "2.8.12", flags: CmdArgOptional},
+			{name: "client-type", tp: ArgTypeOnEOF, token: "TYPE", since: "2.8.12", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+				{name: "normal", tp: ArgTypePureToken, token: "NORMAL"},
+				{name: "master", tp: ArgTypePureToken, token: "MASTER", since: "3.2.0"},
+				{name: "slave", tp: ArgTypePureToken, token: "SLAVE"},
+				{name: "replica", tp: ArgTypePureToken, token: "REPLICA", since: "5.0.0"},
+				{name: "pubsub", tp: ArgTypePureToken, token: "PUBSUB"},
+			}},
+			{name: "username", tp: ArgTypeString, token: "USER", flags: CmdArgOptional},
+			{name: "addr", tp: ArgTypeString, token: "ADDR", flags: CmdArgOptional, displayText: "ip:port"},
+			{name: "laddr", tp: ArgTypeString, token: "LADDR", since: "6.2.0", flags: CmdArgOptional, displayText: "ip:port"},
+			{name: "skipme", tp: ArgTypeOnEOF, token: "SKIPME", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+				{name: "yes", tp: ArgTypePureToken, token: "YES"},
+				{name: "no", tp: ArgTypePureToken, token: "NO"},
+			}},
+		}},
+	}},
+}
+
+var clientListHistory = []*CommandHistory{
+	{"2.8.12", "Added unique client `id` field."},
+	{"5.0.0", "Added optional `TYPE` filter."},
+	{"6.0.0", "Added `user` field."},
+	{"6.2.0", "Added `argv-mem`, `tot-mem`, `laddr` and `redir` fields and the optional `ID` filter."},
+	{"7.0.0", "Added `resp`, `multi-mem`, `rbs` and `rbp` fields."},
+	{"7.0.3", "Added `ssub` field."},
+}
+
+var clientListArgs = []*RedisCommandArgs{
+	{name: "client-type", tp: ArgTypeOnEOF, token: "TYPE", since: "5.0.0", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "normal", tp: ArgTypePureToken, token: "NORMAL"},
+		{name: "master", tp: ArgTypePureToken, token: "MASTER"},
+		{name: "replica", tp: ArgTypePureToken, token: "REPLICA"},
+		{name: "pubsub", tp: ArgTypePureToken, token: "PUBSUB"},
+	}},
+	{name: "client-id", tp: ArgTypeInteger, token: "ID", since: "6.2.0", flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var clientPauseHistory = []*CommandHistory{
+	{"6.2.0", "`CLIENT PAUSE WRITE` mode added along with the `mode` option."},
+}
+
+var clientPauseArgs = []*RedisCommandArgs{
+	{name: "timeout", tp: ArgTypeInteger},
+	{name: "mode", tp: ArgTypeOnEOF, since: "6.2.0", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "write", tp: ArgTypePureToken, token: "WRITE"},
+		{name: "all", tp: ArgTypePureToken, token: "ALL"},
+	}},
+}
+
+var clientReplyArgs = []*RedisCommandArgs{
+	{name: "action", tp: ArgTypeOnEOF, subArgs: []*RedisCommandArgs{
+		{name: "on", tp: ArgTypePureToken, token: "ON"},
+		{name: "off", tp: ArgTypePureToken, token: "OFF"},
+		{name: "skip", tp: ArgTypePureToken, token: "SKIP"},
+	}},
+}
+
+var clientSetinfoArgs = []*RedisCommandArgs{
+	{name: "attr", tp: ArgTypeOnEOF, subArgs: []*RedisCommandArgs{
+		{name: "libname", tp: ArgTypeString, token: "LIB-NAME"},
+		{name: "libver", tp: ArgTypeString, token: "LIB-VER"},
+	}},
+}
+
+var clientSetnameArgs = []*RedisCommandArgs{
+	{name: "connection-name", tp: ArgTypeString},
+}
+
+var clientTrackingArgs = []*RedisCommandArgs{
+	{name: "status", tp: ArgTypeOnEOF, subArgs: []*RedisCommandArgs{
+		{name: "on", tp: ArgTypePureToken, token: "ON"},
+		{name: "off", tp: ArgTypePureToken, token: "OFF"},
+	}},
+	{name: "client-id", tp: ArgTypeInteger, token: "REDIRECT", flags: CmdArgOptional},
+	{name: "prefix", tp: ArgTypeString, token: "PREFIX", flags: CmdArgOptional | CmdArgMultiple | CmdArgMultipleToken},
+	{name: "bcast", tp: ArgTypePureToken, token: "BCAST", flags: CmdArgOptional},
+	{name: "optin", tp: ArgTypePureToken, token: "OPTIN", flags: CmdArgOptional},
+	{name: "optout", tp: ArgTypePureToken, token: "OPTOUT", flags: CmdArgOptional},
+	{name: "noloop", tp: ArgTypePureToken, token: "NOLOOP", flags: CmdArgOptional},
+}
+
+var clientUnblockArgs = []*RedisCommandArgs{
+	{name: "client-id", tp: ArgTypeInteger},
+	{name: "unblock-type", tp: ArgTypeOnEOF, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "timeout", tp: ArgTypePureToken, token: "TIMEOUT"},
+		{name: "error", tp: ArgTypePureToken, token: "ERROR"},
+	}},
+}
+
+var pingArgs = []*RedisCommandArgs{
+	{name: "message", tp: ArgTypeString, flags: CmdArgOptional},
+}
+
+var selectArgs = []*RedisCommandArgs{
+	{name: "index", tp: ArgTypeInteger},
+}
+
+/********** server **********/
+
+var infoHistory = []*CommandHistory{
+	{"7.0.0", "Added support for taking multiple section arguments."},
+}
+
+var infoArgs = []*RedisCommandArgs{
+	{name: "section", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var flushdbHistory = []*CommandHistory{
+	{"4.0.0", "Added the `ASYNC` flushing mode modifier."},
+	{"6.2.0", "Added the `SYNC` flushing mode modifier."},
+}
+
+var flushdbArgs = []*RedisCommandArgs{
+	{name: "flush-type", tp: ArgTypeOnEOF, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "async", tp: ArgTypePureToken, token: "ASYNC", since: "4.0.0"},
+		{name: "sync", tp: ArgTypePureToken, token: "SYNC", since: "6.2.0"},
+	}},
+}
+
+var shutdownHistory = []*CommandHistory{
+	{"7.0.0", "Added the `NOW`, `FORCE` and `ABORT` modifiers."},
+}
+
+var shutdownArgs = []*RedisCommandArgs{
+	{name: "save-selector", tp: ArgTypeOnEOF, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "nosave", tp: ArgTypePureToken, token: "NOSAVE"},
+		{name: "save", tp: ArgTypePureToken, token: "SAVE"},
+	}},
+	{name: "now", tp: ArgTypePureToken, token: "NOW", since: "7.0.0", flags: CmdArgOptional},
+	{name: "force", tp: ArgTypePureToken, token: "FORCE", since: "7.0.0", flags: CmdArgOptional},
+	{name: "abort", tp: ArgTypePureToken, token: "ABORT", since: "7.0.0", flags: CmdArgOptional},
+}
+
+var swapdbArgs = []*RedisCommandArgs{
+	{name: "index1", tp: ArgTypeInteger},
+	{name: "index2", tp: ArgTypeInteger},
+}
+
+var aclCatArgs = []*RedisCommandArgs{
+	{name: "category", tp: ArgTypeString, flags: CmdArgOptional},
+}
+
+var aclDeluserArgs = []*RedisCommandArgs{
+	{name: "username", tp: ArgTypeString, flags: CmdArgMultiple},
+}
+
+var aclDryrunArgs = []*RedisCommandArgs{
+	{name: "username", tp: ArgTypeString},
+	{name: "command", tp: ArgTypeString},
+	{name: "arg", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var aclGenpassArgs = []*RedisCommandArgs{
+	{name: "bits", tp: ArgTypeInteger, flags: CmdArgOptional},
+}
+
+var aclGetuserHistory = []*CommandHistory{
+	{"6.2.0", "Added Pub/Sub channel patterns."},
+	{"7.0.0", "Added selectors and changed the format of key and channel patterns from a list to their rule representation."},
+}
+
+var aclGetuserArgs = []*RedisCommandArgs{
+	{name: "username", tp: ArgTypeString},
+}
+
+var aclLogHistory = []*CommandHistory{
+	{"7.2.0", "Added entry ID, timestamp created, and timestamp last updated."},
+}
+
+var aclLogArgs = []*RedisCommandArgs{
+	{name: "operation", tp: ArgTypeOnEOF, flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "count", tp: ArgTypeInteger},
+		{name: "reset", tp: ArgTypePureToken, token: "RESET"},
+	}},
+}
+
+var aclSetuserHistory = []*CommandHistory{
+	{"6.2.0", "Added Pub/Sub channel patterns."},
+	{"7.0.0", "Added selectors and key based permissions."},
+}
+
+var aclSetuserArgs = []*RedisCommandArgs{
+	{name: "username", tp: ArgTypeString},
+	{name: "rule", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var slowlogGetHistory = []*CommandHistory{
+	{"4.0.0", "Added client IP address, port and name to the reply."},
+}
+
+var slowlogGetArgs = []*RedisCommandArgs{
+	{name: "count", tp: ArgTypeInteger, flags: CmdArgOptional},
+}
+
+var latencyEventArgs = []*RedisCommandArgs{
+	{name: "event", tp: ArgTypeString},
+}
+
+var latencyHistogramArgs = []*RedisCommandArgs{
+	{name: "command", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var latencyResetArgs = []*RedisCommandArgs{
+	{name: "event", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var memoryUsageArgs = []*RedisCommandArgs{
+	{name: "key", tp: ArgTypeKey, keySpecIndex: 0},
+	{name: "count", tp: ArgTypeInteger, token: "SAMPLES", flags: CmdArgOptional},
+}
+
+var configGetHistory = []*CommandHistory{
+	{"7.0.0", "Added the ability to pass multiple pattern parameters in one call"},
+}
+
+var configGetArgs = []*RedisCommandArgs{
+	{name: "parameter", tp: ArgTypeString, flags: CmdArgMultiple},
+}
+
+var configSetHistory = []*CommandHistory{
+	{"7.0.0", "Added the ability to set multiple parameters in one call."},
+}
+
+var configSetArgs = []*RedisCommandArgs{
+	{name: "data", tp: ArgTypeBlock, flags: CmdArgMultiple, subArgs: []*RedisCommandArgs{
+		{name: "parameter", tp: ArgTypeString},
+		{name: "value", tp: ArgTypeString},
+	}},
+}
+
+var commandNamesArgs = []*RedisCommandArgs{
+	{name: "command-name", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var commandGetkeysArgs = []*RedisCommandArgs{
+	{name: "command", tp: ArgTypeString},
+	{name: "arg", tp: ArgTypeString, flags: CmdArgOptional | CmdArgMultiple},
+}
+
+var commandInfoHistory = []*CommandHistory{
+	{"7.0.0", "Allowed to be called with no argument to get info on all commands."},
+}
+
+var commandListArgs = []*RedisCommandArgs{
+	{name: "filterby", tp: ArgTypeOnEOF, token: "FILTERBY", flags: CmdArgOptional, subArgs: []*RedisCommandArgs{
+		{name: "module-name", tp: ArgTypeString, token: "MODULE"},
+		{name: "category", tp: ArgTypeString, token: "ACLCAT"},
+		{name: "pattern", tp: ArgTypePattern, token: "PATTERN"},
+	}},
+}
+
+/* The tips of the commands, hints for clients and proxies. */
+var (
+	tipsNondeterministicOutput      = []string{"nondeterministic_output"}
+	tipsNondeterministicOutputOrder = []string{"nondeterministic_output_order"}
+	tipsAllNodesAllSucceeded        = []string{"request_policy:all_nodes", "response_policy:all_succeeded"}
+	tipsAllShardsAllSucceeded       = []string{"request_policy:all_shards", "response_policy:all_succeeded"}
+	tipsAllShardsOneSucceeded       = []string{"request_policy:all_shards", "response_policy:one_succeeded"}
+	tipsLatency                     = []string{"nondeterministic_output", "request_policy:all_nodes", "response_policy:special"}
+	tipsMemoryReport                = []string{"nondeterministic_output", "request_policy:all_shards", "response_policy:special"}
+	tipsMultiShardAggSum            = []string{"request_policy:multi_shard", "response_policy:agg_sum"}
+)
+
+var redisCommandTable = []*BaseCommand{
+	/* generic */
+	{declaredName: "del", summary: "Deletes one or more keys.", since: "1.0.0", group: RedisCommandGroupGeneric, complexity: "O(N) where N is the number of keys that will be removed. When a key to remove holds a value other than a string, the individual complexity for this key is O(M) where M is the number of elements in the list, set, sorted set or hash. Removing a single key that holds a string value is O(1).", tips: tipsMultiShardAggSum, proc: delCommand, arity: -2, flags: CmdWrite, aclCategories: ACLCategoryKeyspace, keySpecs: []KeySpec{{flags: KeySpecRM | KeySpecDelete, beginIndex: 1, lastKey: -1, keyStep: 1}}, args: delArgs},
+	{declaredName: "unlink", summary: "Asynchronously deletes one or more keys.", since: "4.0.0", group: RedisCommandGroupGeneric, complexity: "O(1) for each key removed regardless of its size. Then the command does O(N) work in a different thread in order to reclaim memory, where N is the number of allocations the deleted objects where composed of.", tips: tipsMultiShardAggSum, proc: unlinkCommand, arity: -2, flags: CmdWrite | CmdFast, aclCategories: ACLCategoryKeyspace, keySpecs: []KeySpec{{flags: KeySpecRM | KeySpecDelete, beginIndex: 1, lastKey: -1, keyStep: 1}}, args: delArgs},
+	{declaredName: "object", summary: "A container for object introspection commands.", since: "2.2.3", group: RedisCommandGroupGeneric, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "encoding", summary: "Returns the internal encoding of a Redis object.", since: "2.2.3", group: RedisCommandGroupGeneric, complexity: "O(1)", tips: tipsNondeterministicOutput, proc: objectEncodingCommand, arity: 3, flags: CmdReadOnly, aclCategories: ACLCategoryKeyspace, keySpecs: []KeySpec{{flags: KeySpecRO, beginIndex: 2, keyStep: 1}}, args: objectKeyArgs},
+		&BaseCommand{declaredName: "freq", summary: "Returns the logarithmic access frequency counter of a Redis object.", since: "4.0.0", group: RedisCommandGroupGeneric, complexity: "O(1)", tips: tipsNondeterministicOutput, proc: objectFreqCommand, arity: 3, flags: CmdReadOnly, aclCategories: ACLCategoryKeyspace, keySpecs: []KeySpec{{flags: KeySpecRO, beginIndex: 2, keyStep: 1}}, args: objectKeyArgs},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "6.2.0", group: RedisCommandGroupGeneric, complexity: "O(1)", proc: objectHelpCommand, arity: 2, flags: CmdLoading | CmdStale, aclCategories: ACLCategoryKeyspace},
+		&BaseCommand{declaredName: "idletime", summary: "Returns the time since the last access to a Redis object.", since: "2.2.3", group: RedisCommandGroupGeneric, complexity: "O(1)", tips: tipsNondeterministicOutput, proc: objectIdletimeCommand, arity: 3, flags: CmdReadOnly, aclCategories: ACLCategoryKeyspace, keySpecs: []KeySpec{{flags: KeySpecRO, beginIndex: 2, keyStep: 1}}, args: objectKeyArgs},
+		&BaseCommand{declaredName: "refcount", summary: "Returns the reference count of a value of a key.", since: "2.2.3", group: RedisCommandGroupGeneric, complexity: "O(1)", tips: tipsNondeterministicOutput, proc: objectRefcountCommand, arity: 3, flags: CmdReadOnly, aclCategories: ACLCategoryKeyspace, keySpecs: []KeySpec{{flags: KeySpecRO, beginIndex: 2, keyStep: 1}}, args: objectKeyArgs},
+	}},
+
+	/* string */
+	{declaredName: "get", summary: "Returns the string value of a key.", since: "1.0.0", group: RedisCommandGroupString, complexity: "O(1)", proc: getCommand, arity: 2, flags: CmdReadOnly | CmdFast, aclCategories: ACLCategoryString, keySpecs: []KeySpec{{flags: KeySpecRO | KeySpecAccess, beginIndex: 1, keyStep: 1}}, args: getArgs},
+	{declaredName: "set", summary: "Sets the string value of a key, ignoring its type. The key is created if it doesn't exist.", since: "1.0.0", group: RedisCommandGroupString, complexity: "O(1)", history: setHistory, proc: setCommand, arity: -3, flags: CmdWrite | CmdDenyOOM, aclCategories: ACLCategoryString, keySpecs: []KeySpec{{flags: KeySpecOW | KeySpecUpdate, beginIndex: 1, keyStep: 1}}, args: setArgs},
+	{declaredName: "setnx", summary: "Set the string value of a key only when the key doesn't exist.", since: "1.0.0", group: RedisCommandGroupString, complexity: "O(1)", docFlags: CmdDocDeprecated, deprecatedSince: "2.6.12", replacedBy: "`SET` with the `NX` argument", proc: setnxCommand, arity: 3, flags: CmdWrite | CmdDenyOOM | CmdFast, aclCategories: ACLCategoryString, keySpecs: []KeySpec{{flags: KeySpecOW | KeySpecInsert, beginIndex: 1, keyStep: 1}}, args: setnxArgs},
+	{declaredName: "setex", summary: "Sets the string value and expiration time of a key. Creates the key if it doesn't exist.", since: "2.0.0", group: RedisCommandGroupString, complexity: "O(1)", docFlags: CmdDocDeprecated, deprecatedSince: "2.6.12", replacedBy: "`SET` with the `EX` argument", proc: setexCommand, arity: 4, flags: CmdWrite | CmdDenyOOM, aclCategories: ACLCategoryString, keySpecs: []KeySpec{{flags: KeySpecOW | KeySpecUpdate, beginIndex: 1, keyStep: 1}}, args: setexArgs},
+	{declaredName: "psetex", summary: "Sets both string value and expiration time in milliseconds of a key. The key is created if it doesn't exist.", since: "2.6.0", group: RedisCommandGroupString, complexity: "O(1)", docFlags: CmdDocDeprecated, deprecatedSince: "2.6.12", replacedBy: "`SET` with the `PX` argument", proc: psetexCommand, arity: 4, flags: CmdWrite | CmdDenyOOM, aclCategories: ACLCategoryString, keySpecs: []KeySpec{{flags: KeySpecOW | KeySpecUpdate, beginIndex: 1, keyStep: 1}}, args: psetexArgs},
+
+	/* pubsub */
+	{declaredName: "subscribe", summary: "Listens for messages published to channels.", since: "2.0.0", group: RedisCommandGroupPubSub, complexity: "O(N) where N is the number of channels to subscribe to.", proc: subscribeCommand, arity: -2, flags: CmdPubSub | CmdNoScript | CmdLoading | CmdStale, args: subscribeArgs},
+	{declaredName: "unsubscribe", summary: "Stops listening to messages posted to channels.", since: "2.0.0", group: RedisCommandGroupPubSub, complexity: "O(N) where N is the number of channels to unsubscribe.", proc: unsubscribeCommand, arity: -1, flags: CmdPubSub | CmdNoScript | CmdLoading | CmdStale, args: unsubscribeArgs},
+	{declaredName: "psubscribe", summary: "Listens for messages published to channels that match one or more patterns.", since: "2.0.0", group: RedisCommandGroupPubSub, complexity: "O(N) where N is the number of patterns to subscribe to.", proc: psubscribeCommand, arity: -2, flags: CmdPubSub | CmdNoScript | CmdLoading | CmdStale, args: psubscribeArgs},
+	{declaredName: "punsubscribe", summary: "Stops listening to messages published to channels that match one or more patterns.", since: "2.0.0", group: RedisCommandGroupPubSub, complexity: "O(N) where N is the number of patterns to unsubscribe.", proc: punsubscribeCommand, arity: -1, flags: CmdPubSub | CmdNoScript | CmdLoading | CmdStale, args: punsubscribeArgs},
+	{declaredName: "publish", summary: "Posts a message to a channel.", since: "2.0.0", group: RedisCommandGroupPubSub, complexity: "O(N+M) where N is the number of clients subscribed to the receiving channel and M is the total number of subscribed patterns (by any client).", proc: publishCommand, arity: 3, flags: CmdPubSub | CmdLoading | CmdStale | CmdFast | CmdMayReplicate, args: publishArgs},
+	{declaredName: "pubsub", summary: "A container for Pub/Sub commands.", since: "2.8.0", group: RedisCommandGroupPubSub, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "channels", summary: "Returns the active channels.", since: "2.8.0", group: RedisCommandGroupPubSub, complexity: "O(N) where N is the number of active channels, and assuming constant time pattern matching (relatively short channels and patterns)", proc: pubsubChannelsCommand, arity: -2, flags: CmdPubSub | CmdLoading | CmdStale, args: pubsubChannelsArgs},
+		&BaseCommand{declaredName: "numsub", summary: "Returns a count of subscribers to channels.", since: "2.8.0", group: RedisCommandGroupPubSub, complexity: "O(N) for the NUMSUB subcommand, where N is the number of requested channels", proc: pubsubNumSubCommand, arity: -2, flags: CmdPubSub | CmdLoading | CmdStale, args: pubsubNumsubArgs},
+		&BaseCommand{declaredName: "numpat", summary: "Returns a count of unique pattern subscriptions.", since: "2.8.0", group: RedisCommandGroupPubSub, complexity: "O(1)", proc: pubsubNumPatCommand, arity: 2, flags: CmdPubSub | CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "6.2.0", group: RedisCommandGroupPubSub, complexity: "O(1)", proc: pubsubHelpCommand, arity: 2, flags: CmdLoading | CmdStale},
+	}},
+
+	/* transactions */
+	{declaredName: "multi", summary: "Starts a transaction.", since: "1.2.0", group: RedisCommandGroupTransaction, complexity: "O(1)", proc: multiCommand, arity: 1, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdAllowBusy, aclCategories: ACLCategoryTransaction},
+	{declaredName: "exec", summary: "Executes all commands in a transaction.", since: "1.2.0", group: RedisCommandGroupTransaction, complexity: "Depends on commands in the transaction", proc: execCommand, arity: 1, flags: CmdNoScript | CmdLoading | CmdStale | CmdSkipSlowLog, aclCategories: ACLCategoryTransaction},
+	{declaredName: "discard", summary: "Discards a transaction.", since: "2.0.0", group: RedisCommandGroupTransaction, complexity: "O(N), when N is the number of queued commands", proc: discardCommand, arity: 1, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdAllowBusy, aclCategories: ACLCategoryTransaction},
+	{declaredName: "watch", summary: "Monitors changes to keys to determine the execution of a transaction.", since: "2.2.0", group: RedisCommandGroupTransaction, complexity: "O(1) for every key.", proc: watchCommand, arity: -2, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdAllowBusy, aclCategories: ACLCategoryTransaction, keySpecs: []KeySpec{{flags: KeySpecRO, beginIndex: 1, lastKey: -1, keyStep: 1}}, args: watchArgs},
+	{declaredName: "unwatch", summary: "Forgets about watched keys of a transaction.", since: "2.2.0", group: RedisCommandGroupTransaction, complexity: "O(1)", proc: unwatchCommand, arity: 1, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdAllowBusy, aclCategories: ACLCategoryTransaction},
+
+	/* scripting */
+	{declaredName: "eval", summary: "Executes a server-side Lua script.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "Depends on the script that is executed.", proc: evalCommand, arity: -3, flags: CmdNoScript | CmdSkipMonitor | CmdMayReplicate | CmdNoMandatoryKeys | CmdStale, aclCategories: ACLCategoryScripting, keySpecs: []KeySpec{{notes: "We cannot tell how the keys will be used so we assume the worst, RW and UPDATE", flags: KeySpecRW | KeySpecAccess | KeySpecUpdate, beginIndex: 2, findKeys: KeySpecKeyNum, firstKey: 1, keyStep: 1}}, args: evalArgs},
+	{declaredName: "eval_ro", summary: "Executes a read-only server-side Lua script.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "Depends on the script that is executed.", proc: evalRoCommand, arity: -3, flags: CmdNoScript | CmdSkipMonitor | CmdNoMandatoryKeys | CmdStale | CmdReadOnly, aclCategories: ACLCategoryScripting, keySpecs: []KeySpec{{flags: KeySpecRO | KeySpecAccess, beginIndex: 2, findKeys: KeySpecKeyNum, firstKey: 1, keyStep: 1}}, args: evalArgs},
+	{declaredName: "evalsha", summary: "Executes a server-side Lua script by SHA1 digest.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "Depends on the script that is executed.", proc: evalShaCommand, arity: -3, flags: CmdNoScript | CmdSkipMonitor | CmdMayReplicate | CmdNoMandatoryKeys | CmdStale, aclCategories: ACLCategoryScripting, keySpecs: []KeySpec{{flags: KeySpecRW | KeySpecAccess | KeySpecUpdate, beginIndex: 2, findKeys: KeySpecKeyNum, firstKey: 1, keyStep: 1}}, args: evalshaArgs},
+	{declaredName: "evalsha_ro", summary: "Executes a read-only server-side Lua script by SHA1 digest.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "Depends on the script that is executed.", proc: evalShaRoCommand, arity: -3, flags: CmdNoScript | CmdSkipMonitor | CmdNoMandatoryKeys | CmdStale | CmdReadOnly, aclCategories: ACLCategoryScripting, keySpecs: []KeySpec{{flags: KeySpecRO | KeySpecAccess, beginIndex: 2, findKeys: KeySpecKeyNum, firstKey: 1, keyStep: 1}}, args: evalshaArgs},
+	{declaredName: "script", summary: "A container for Lua scripts management commands.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "load", summary: "Loads a server-side Lua script to the script cache.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "O(N) with N being the length in bytes of the script body.", tips: tipsAllNodesAllSucceeded, proc: scriptLoadCommand, arity: 3, flags: CmdNoScript | CmdStale, aclCategories: ACLCategoryScripting, args: scriptLoadArgs},
+		&BaseCommand{declaredName: "exists", summary: "Determines whether server-side Lua scripts exist in the script cache.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "O(N) with N being the number of scripts to check (so checking a single script is an O(1) operation).", tips: []string{"request_policy:all_shards", "response_policy:agg_logical_and"}, proc: scriptExistsCommand, arity: -3, flags: CmdNoScript, aclCategories: ACLCategoryScripting, args: scriptExistsArgs},
+		&BaseCommand{declaredName: "flush", summary: "Removes all server-side Lua scripts from the script cache.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "O(N) with N being the number of scripts in cache", history: scriptFlushHistory, tips: tipsAllNodesAllSucceeded, proc: scriptFlushCommand, arity: -2, flags: CmdNoScript, aclCategories: ACLCategoryScripting, args: scriptFlushArgs},
+		&BaseCommand{declaredName: "kill", summary: "Terminates a server-side Lua script during execution.", since: "2.6.0", group: RedisCommandGroupScripting, complexity: "O(1)", tips: tipsAllShardsOneSucceeded, proc: scriptKillCommand, arity: 2, flags: CmdNoScript | CmdAllowBusy, aclCategories: ACLCategoryScripting},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "5.0.0", group: RedisCommandGroupScripting, complexity: "O(1)", proc: scriptHelpCommand, arity: 2, flags: CmdLoading | CmdStale, aclCategories: ACLCategoryScripting},
+	}},
+	{declaredName: "fcall", summary: "Invokes a function.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "Depends on the function that is executed.", proc: fcallCommand, arity: -3, flags: CmdNoScript | CmdSkipMonitor | CmdMayReplicate | CmdNoMandatoryKeys | CmdStale, aclCategories: ACLCategoryScripting, keySpecs: []KeySpec{{notes: "We cannot tell how the keys will be used so we assume the worst, RW and UPDATE", flags: KeySpecRW | KeySpecAccess | KeySpecUpdate, beginIndex: 2, findKeys: KeySpecKeyNum, firstKey: 1, keyStep: 1}}, args: fcallArgs},
+	{declaredName: "fcall_ro", summary: "Invokes a read-only function.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "Depends on the function that is executed.", proc: fcallroCommand, arity: -3, flags: CmdNoScript | CmdSkipMonitor | CmdNoMandatoryKeys | CmdStale | CmdReadOnly, aclCategories: ACLCategoryScripting, keySpecs: []KeySpec{{flags: KeySpecRO | KeySpecAccess, beginIndex: 2, findKeys: KeySpecKeyNum, firstKey: 1, keyStep: 1}}, args: fcallArgs},
+	{declaredName: "function", summary: "A container for function commands.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "list", summary: "Returns information about all libraries.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "O(N) where N is the number of functions", tips: tipsNondeterministicOutputOrder, proc: functionListCommand, arity: -2, flags: CmdNoScript, aclCategories: ACLCategoryScripting, args: functionListArgs},
+		&BaseCommand{declaredName: "delete", summary: "Deletes a library and its functions.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "O(1)", tips: tipsAllShardsAllSucceeded, proc: functionDeleteCommand, arity: 3, flags: CmdNoScript | CmdWrite, aclCategories: ACLCategoryScripting, args: functionDeleteArgs},
+		&BaseCommand{declaredName: "flush", summary: "Deletes all libraries and functions.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "O(N) where N is the number of functions deleted", tips: tipsAllShardsAllSucceeded, proc: functionFlushCommand, arity: -2, flags: CmdNoScript | CmdWrite, aclCategories: ACLCategoryScripting, args: functionFlushArgs},
+		&BaseCommand{declaredName: "kill", summary: "Terminates a function during execution.", since: "7.0.0", group: RedisCommandGroupScripting, complexity: "O(1)", tips: tipsAllShardsOneSucceeded, proc: functionKillCommand, arity: 2, flags: CmdNoScript | CmdAllowBusy, aclCategories: ACLCategoryScripting},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "7.0.0", group: RedisCommandGroupScripting, complexity: "O(1)", proc: functionHelpCommand, arity: 2, flags: CmdLoading | CmdStale, aclCategories: ACLCategoryScripting},
+	}},
+
+	/* connection */
+	{declaredName: "auth", summary: "Authenticates the connection.", since: "1.0.0", group: RedisCommandGroupConnection, complexity: "O(N) where N is the number of passwords defined for the user", history: authHistory, proc: authCommand, arity: -2, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdNoAuth | CmdSentinel | CmdAllowBusy, aclCategories: ACLCategoryConnection, args: authArgs},
+	{declaredName: "hello", summary: "Handshakes with the Redis server.", since: "6.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", history: helloHistory, proc: helloCommand, arity: -1, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdNoAuth | CmdSentinel | CmdAllowBusy, aclCategories: ACLCategoryConnection, args: helloArgs},
+	{declaredName: "client", summary: "A container for client connection commands.", since: "2.4.0", group: RedisCommandGroupConnection, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "caching", summary: "Instructs the server whether to track the keys in the next request.", since: "6.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientCachingCommand, arity: 3, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection, args: clientCachingArgs},
+		&BaseCommand{declaredName: "getname", summary: "Returns the name of the connection.", since: "2.6.9", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientGetNameCommand, arity: 2, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "getredir", summary: "Returns the client ID to which the connection's tracking notifications are redirected.", since: "6.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientGetRedirCommand, arity: 2, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "5.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientHelpCommand, arity: 2, flags: CmdLoading | CmdStale, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "id", summary: "Returns the unique client ID of the connection.", since: "5.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientIdCommand, arity: 2, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "info", summary: "Returns information about the connection.", since: "6.2.0", group: RedisCommandGroupConnection, complexity: "O(1)", tips: tipsNondeterministicOutput, proc: clientInfoCommand, arity: 2, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "kill", summary: "Terminates open connections.", since: "2.4.0", group: RedisCommandGroupConnection, complexity: "O(N) where N is the number of client connections", history: clientKillHistory, proc: clientKillCommand, arity: -3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection | ACLCategoryDangerous, args: clientKillArgs},
+		&BaseCommand{declaredName: "list", summary: "Lists open connections.", since: "2.4.0", group: RedisCommandGroupConnection, complexity: "O(N) where N is the number of client connections", history: clientListHistory, tips: tipsNondeterministicOutput, proc: clientListCommand, arity: -2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection | ACLCategoryDangerous, args: clientListArgs},
+		&BaseCommand{declaredName: "no-evict", summary: "Sets the client eviction mode of the connection.", since: "7.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientNoEvictCommand, arity: 3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection | ACLCategoryDangerous, args: onOffArgs},
+		&BaseCommand{declaredName: "no-touch", summary: "Controls whether commands sent by the client affect the LRU/LFU of accessed keys.", since: "7.2.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientNoTouchCommand, arity: 3, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection, args: onOffArgs},
+		&BaseCommand{declaredName: "pause", summary: "Suspends commands processing.", since: "3.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", history: clientPauseHistory, proc: clientPauseCommand, arity: -3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection | ACLCategoryDangerous, args: clientPauseArgs},
+		&BaseCommand{declaredName: "reply", summary: "Instructs the server whether to reply to commands.", since: "3.2.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientReplyCommand, arity: 3, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection, args: clientReplyArgs},
+		&BaseCommand{declaredName: "setinfo", summary: "Sets information specific to the client or connection.", since: "7.2.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientSetInfoCommand, arity: 4, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection, args: clientSetinfoArgs},
+		&BaseCommand{declaredName: "setname", summary: "Sets the connection name.", since: "2.6.9", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientSetNameCommand, arity: 3, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection, args: clientSetnameArgs},
+		&BaseCommand{declaredName: "tracking", summary: "Controls server-assisted client-side caching for the connection.", since: "6.0.0", group: RedisCommandGroupConnection, complexity: "O(1). Some options may introduce additional complexity.", proc: clientTrackingCommand, arity: -3, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection, args: clientTrackingArgs},
+		&BaseCommand{declaredName: "trackinginfo", summary: "Returns information about server-assisted client-side caching for the connection.", since: "6.2.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: clientTrackingInfoCommand, arity: 2, flags: CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "unblock", summary: "Unblocks a client blocked by a blocking command from a different connection.", since: "5.0.0", group: RedisCommandGroupConnection, complexity: "O(log N) where N is the number of client connections", proc: clientUnblockCommand, arity: -3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection | ACLCategoryDangerous, args: clientUnblockArgs},
+		&BaseCommand{declaredName: "unpause", summary: "Resumes processing of clients that were paused.", since: "6.2.0", group: RedisCommandGroupConnection, complexity: "O(N) Where N is the number of paused clients", proc: clientUnpauseCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, aclCategories: ACLCategoryConnection | ACLCategoryDangerous},
+	}},
+	{declaredName: "ping", summary: "Returns the server's liveliness response.", since: "1.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", tips: tipsAllShardsAllSucceeded, proc: pingCommand, arity: -1, flags: CmdFast | CmdSentinel, aclCategories: ACLCategoryConnection, args: pingArgs},
+	{declaredName: "quit", summary: "Closes the connection.", since: "1.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", docFlags: CmdDocDeprecated, deprecatedSince: "7.2.0", replacedBy: "just closing the connection", proc: quitCommand, arity: -1, flags: CmdAllowBusy | CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdNoAuth, aclCategories: ACLCategoryConnection},
+	{declaredName: "reset", summary: "Resets the connection.", since: "6.2.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: resetCommand, arity: 1, flags: CmdNoScript | CmdLoading | CmdStale | CmdFast | CmdNoAuth | CmdAllowBusy, aclCategories: ACLCategoryConnection},
+	{declaredName: "select", summary: "Changes the selected database.", since: "1.0.0", group: RedisCommandGroupConnection, complexity: "O(1)", proc: selectCommand, arity: 2, flags: CmdLoading | CmdStale | CmdFast, aclCategories: ACLCategoryConnection, args: selectArgs},
+
+	/* server */
+	{declaredName: "info", summary: "Returns information and statistics about the server.", since: "1.0.0", group: RedisCommandGroupServer, complexity: "O(1)", history: infoHistory, tips: []string{"nondeterministic_output", "request_policy:all_shards", "response_policy:special"}, proc: infoCommand, arity: -1, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryDangerous, args: infoArgs},
+	{declaredName: "flushall", summary: "Removes all keys from all databases.", since: "1.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the total number of keys in all databases", history: flushdbHistory, tips: tipsAllShardsAllSucceeded, proc: flushallCommand, arity: -1, flags: CmdWrite, aclCategories: ACLCategoryKeyspace | ACLCategoryDangerous, args: flushdbArgs},
+	{declaredName: "flushdb", summary: "Remove all keys from the current database.", since: "1.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of keys in the selected database", history: flushdbHistory, tips: tipsAllShardsAllSucceeded, proc: flushdbCommand, arity: -1, flags: CmdWrite, aclCategories: ACLCategoryKeyspace | ACLCategoryDangerous, args: flushdbArgs},
+	{declaredName: "swapdb", summary: "Swaps two Redis databases.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the count of clients watching or blocking on keys from both databases.", proc: swapdbCommand, arity: 3, flags: CmdWrite | CmdFast, aclCategories: ACLCategoryKeyspace | ACLCategoryDangerous, args: swapdbArgs},
+	{declaredName: "acl", summary: "A container for Access List Control commands.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "cat", summary: "Lists the ACL categories, or the commands inside a category.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(1) since the categories and commands are a fixed set.", proc: aclCatCommand, arity: -2, flags: CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclCatArgs},
+		&BaseCommand{declaredName: "deluser", summary: "Deletes ACL users, and terminates their connections.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(1) amortized time considering the typical user.", tips: tipsAllNodesAllSucceeded, proc: aclDelUserCommand, arity: -3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclDeluserArgs},
+		&BaseCommand{declaredName: "dryrun", summary: "Simulates the execution of a command by a user, without executing the command.", since: "7.0.0", group: RedisCommandGroupServer, complexity: "O(1).", proc: aclDryRunCommand, arity: -4, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclDryrunArgs},
+		&BaseCommand{declaredName: "genpass", summary: "Generates a pseudorandom, secure password that can be used to identify ACL users.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: aclGenPassCommand, arity: -2, flags: CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclGenpassArgs},
+		&BaseCommand{declaredName: "getuser", summary: "Lists the ACL rules of a user.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N). Where N is the number of password, command and pattern rules that the user has.", history: aclGetuserHistory, proc: aclGetUserCommand, arity: 3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclGetuserArgs},
+		&BaseCommand{declaredName: "list", summary: "Dumps the effective rules in ACL file format.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N). Where N is the number of configured users.", proc: aclListCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel},
+		&BaseCommand{declaredName: "load", summary: "Reloads the rules from the configured ACL file.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N). Where N is the number of configured users.", proc: aclLoadCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel},
+		&BaseCommand{declaredName: "log", summary: "Lists recent security events generated due to ACL rules.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N) with N being the number of entries shown.", history: aclLogHistory, proc: aclLogCommand, arity: -2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclLogArgs},
+		&BaseCommand{declaredName: "save", summary: "Saves the effective ACL rules in the configured ACL file.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N). Where N is the number of configured users.", tips: tipsAllNodesAllSucceeded, proc: aclSaveCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel},
+		&BaseCommand{declaredName: "setuser", summary: "Creates and modifies an ACL user and its rules.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N). Where N is the number of rules provided.", history: aclSetuserHistory, tips: tipsAllNodesAllSucceeded, proc: aclSetUserCommand, arity: -3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel, args: aclSetuserArgs},
+		&BaseCommand{declaredName: "users", summary: "Lists all ACL users.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(N). Where N is the number of configured users.", proc: aclUsersCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdSentinel},
+		&BaseCommand{declaredName: "whoami", summary: "Returns the authenticated username of the current connection.", since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: aclWhoAmICommand, arity: 2, flags: CmdNoScript | CmdLoading | CmdStale | CmdSentinel},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "6.0.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: aclHelpCommand, arity: 2, flags: CmdLoading | CmdStale | CmdSentinel},
+	}},
+	{declaredName: "slowlog", summary: "A container for slow log commands.", since: "2.2.12", group: RedisCommandGroupServer, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "get", summary: "Returns the slow log's entries.", since: "2.2.12", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of entries returned", history: slowlogGetHistory, tips: []string{"request_policy:all_nodes", "nondeterministic_output"}, proc: slowlogGetCommand, arity: -2, flags: CmdAdmin | CmdLoading | CmdStale, args: slowlogGetArgs},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "6.2.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: slowlogHelpCommand, arity: 2, flags: CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "len", summary: "Returns the number of entries in the slow log.", since: "2.2.12", group: RedisCommandGroupServer, complexity: "O(1)", tips: []string{"request_policy:all_nodes", "response_policy:agg_sum", "nondeterministic_output"}, proc: slowlogLenCommand, arity: 2, flags: CmdAdmin | CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "reset", summary: "Clears all entries from the slow log.", since: "2.2.12", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of entries in the slowlog", tips: tipsAllNodesAllSucceeded, proc: slowlogResetCommand, arity: 2, flags: CmdAdmin | CmdLoading | CmdStale},
+	}},
+	{declaredName: "shutdown", summary: "Synchronously saves the database(s) to disk and shuts down the Redis server.", since: "1.0.0", group: RedisCommandGroupServer, complexity: "O(N) when saving, where N is the total number of keys in all databases when saving data, otherwise O(1)", history: shutdownHistory, proc: shutdownCommand, arity: -1, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale | CmdNoMulti | CmdSentinel | CmdAllowBusy, args: shutdownArgs},
+	{declaredName: "monitor", summary: "Listens for all requests received by the server in real-time.", since: "1.0.0", group: RedisCommandGroupServer, proc: monitorCommand, arity: 1, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale},
+	{declaredName: "latency", summary: "A container for latency diagnostics commands.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "doctor", summary: "Returns a human-readable latency analysis report.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", tips: tipsLatency, proc: latencyDoctorCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "graph", summary: "Returns a latency graph for an event.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", tips: tipsLatency, proc: latencyGraphCommand, arity: 3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, args: latencyEventArgs},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", proc: latencyHelpCommand, arity: 2, flags: CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "histogram", summary: "Returns the cumulative distribution of latencies of a subset or all commands.", since: "7.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of commands with latency information being retrieved.", tips: tipsLatency, proc: latencyHistogramCommand, arity: -2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, args: latencyHistogramArgs},
+		&BaseCommand{declaredName: "history", summary: "Returns timestamp-latency samples for an event.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", tips: tipsLatency, proc: latencyHistoryCommand, arity: 3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, args: latencyEventArgs},
+		&BaseCommand{declaredName: "latest", summary: "Returns the latest latency samples for all events.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", tips: tipsLatency, proc: latencyLatestCommand, arity: 2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "reset", summary: "Resets the latency data for one or more events.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", tips: []string{"request_policy:all_nodes", "response_policy:agg_sum"}, proc: latencyResetCommand, arity: -2, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, args: latencyResetArgs},
+	}},
+	{declaredName: "memory", summary: "A container for memory diagnostics commands.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "doctor", summary: "Outputs a memory problems report.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "O(1)", tips: tipsMemoryReport, proc: memoryDoctorCommand, arity: 2},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "4.0.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: memoryHelpCommand, arity: 2, flags: CmdLoading | CmdStale},
+		&BaseCommand{declaredName: "malloc-stats", summary: "Returns the allocator statistics.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "Depends on how much memory is allocated, could be slow", tips: tipsMemoryReport, proc: memoryMallocStatsCommand, arity: 2},
+		&BaseCommand{declaredName: "purge", summary: "Asks the allocator to release memory.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "Depends on how much memory is allocated, could be slow", tips: tipsAllShardsAllSucceeded, proc: memoryPurgeCommand, arity: 2},
+		&BaseCommand{declaredName: "stats", summary: "Returns details about memory usage.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "O(1)", tips: tipsMemoryReport, proc: memoryStatsCommand, arity: 2},
+		&BaseCommand{declaredName: "usage", summary: "Estimates the memory usage of a key.", since: "4.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of samples.", proc: memoryUsageCommand, arity: -3, flags: CmdReadOnly, keySpecs: []KeySpec{{flags: KeySpecRO, beginIndex: 2, keyStep: 1}}, args: memoryUsageArgs},
+	}},
+	{declaredName: "config", summary: "A container for server configuration commands.", since: "2.0.0", group: RedisCommandGroupServer, complexity: "Depends on subcommand.", arity: -2, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "get", summary: "Returns the effective values of configuration parameters.", since: "2.0.0", group: RedisCommandGroupServer, complexity: "O(N) when N is the number of configuration parameters provided", history: configGetHistory, proc: configGetCommand, arity: -3, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, args: configGetArgs},
+		&BaseCommand{declaredName: "set", summary: "Sets configuration parameters in-flight.", since: "2.0.0", group: RedisCommandGroupServer, complexity: "O(N) when N is the number of configuration parameters provided", history: configSetHistory, tips: tipsAllNodesAllSucceeded, proc: configSetCommand, arity: -4, flags: CmdAdmin | CmdNoScript | CmdLoading | CmdStale, args: configSetArgs},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "5.0.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: configHelpCommand, arity: 2, flags: CmdLoading | CmdStale},
+	}},
+	{declaredName: "command", summary: "Returns detailed information about all commands.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(N) where N is the total number of Redis commands", tips: tipsNondeterministicOutputOrder, proc: commandCommand, arity: -1, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection, subCommands: []RedisCommand{
+		&BaseCommand{declaredName: "count", summary: "Returns a count of commands.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(1)", proc: commandCountCommand, arity: 2, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "docs", summary: "Returns documentary information about one, multiple or all commands.", since: "7.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of commands to look up", tips: tipsNondeterministicOutputOrder, proc: commandDocsCommand, arity: -2, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection, args: commandNamesArgs},
+		&BaseCommand{declaredName: "getkeys", summary: "Extracts the key names from an arbitrary command.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of arguments to the command", proc: commandGetKeysCommand, arity: -3, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection, args: commandGetkeysArgs},
+		&BaseCommand{declaredName: "getkeysandflags", summary: "Extracts the key names and access flags for an arbitrary command.", since: "7.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of arguments to the command", proc: commandGetKeysAndFlagsCommand, arity: -3, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection, args: commandGetkeysArgs},
+		&BaseCommand{declaredName: "help", summary: helpSummary, since: "5.0.0", group: RedisCommandGroupServer, complexity: "O(1)", proc: commandHelpCommand, arity: 2, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection},
+		&BaseCommand{declaredName: "info", summary: "Returns information about one, multiple or all commands.", since: "2.8.13", group: RedisCommandGroupServer, complexity: "O(N) where N is the number of commands to look up", history: commandInfoHistory, tips: tipsNondeterministicOutputOrder, proc: commandInfoCommand, arity: -2, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection, args: commandNamesArgs},
+		&BaseCommand{declaredName: "list", summary: "Returns a list of command names.", since: "7.0.0", group: RedisCommandGroupServer, complexity: "O(N) where N is the total number of Redis commands", tips: tipsNondeterministicOutputOrder, proc: commandListCommand, arity: -2, flags: CmdLoading | CmdStale | CmdSentinel, aclCategories: ACLCategoryConnection, args: commandListArgs},
+	}},
+}
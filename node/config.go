@@ -0,0 +1,581 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+	"gopkg.in/yaml.v3"
+)
+
+/*-----------------------------------------------------------------------------
+ * Config file name-value maps.
+ *----------------------------------------------------------------------------*/
+
+type ConfigFlags uint8
+
+const (
+	ModifiableConfig ConfigFlags = 0
+	ImmutableConfig  ConfigFlags = 1 << iota // Can this value only be set at startup?
+	SensitiveConfig                          // Does this value contain sensitive information
+	MultiArgConfig                           // This config receives multiple arguments.
+)
+
+// configEnum maps the names accepted by an enum config to their value.
+type configEnum struct {
+	name string
+	val  int
+}
+
+// standardConfig describes a single configuration parameter, the
+// accessors are bound to the server the configuration is applied to.
+type standardConfig struct {
+	name  string // The user visible name of this config
+	alias string // An alias that can also be used for this config
+	flags ConfigFlags
+
+	init func(s *RedisServer)                      // Set the default value
+	set  func(s *RedisServer, args []string) error // Parse and apply a new value
+	get  func(s *RedisServer) string               // Format the current value
+}
+
+func boolToString(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func yesNoToBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("argument must be 'yes' or 'no'")
+}
+
+func createBoolConfig(name, alias string, flags ConfigFlags, field func(s *RedisServer) *bool, defaultValue bool) *standardConfig {
+	return &standardConfig{
+		name: name, alias: alias, flags: flags,
+		init: func(s *RedisServer) { *field(s) = defaultValue },
+		set: func(s *RedisServer, args []string) error {
+			v, err := yesNoToBool(args[0])
+			if err != nil {
+				return err
+			}
+			*field(s) = v
+			return nil
+		},
+		get: func(s *RedisServer) string { return boolToString(*field(s)) },
+	}
+}
+
+func createStringConfig(name, alias string, flags ConfigFlags, field func(s *RedisServer) *string, defaultValue string) *standardConfig {
+	return &standardConfig{
+		name: name, alias: alias, flags: flags,
+		init: func(s *RedisServer) { *field(s) = defaultValue },
+		set: func(s *RedisServer, args []string) error {
+			*field(s) = args[0]
+			return nil
+		},
+		get: func(s *RedisServer) string { return *field(s) },
+	}
+}
+
+func createIntConfig[T int | int64 | uint64](name, alias string, flags ConfigFlags, lower, upper T, field func(s *RedisServer) *T, defaultValue T) *standardConfig {
+	return &standardConfig{
+		name: name, alias: alias, flags: flags,
+		init: func(s *RedisServer) { *field(s) = defaultValue },
+		set: func(s *RedisServer, args []string) error {
+			ll, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("argument couldn't be parsed into an integer")
+			}
+			if T(ll) < lower || T(ll) > upper || (ll < 0 && lower >= 0) {
+				return fmt.Errorf("argument must be between %d and %d inclusive", lower, upper)
+			}
+			*field(s) = T(ll)
+			return nil
+		},
+		get: func(s *RedisServer) string { return fmt.Sprintf("%d", *field(s)) },
+	}
+}
+
+// createMemoryConfig is an integer config accepting a memory amount, like
+// "64mb", see memtoll.
+func createMemoryConfig(name, alias string, flags ConfigFlags, lower, upper int64, field func(s *RedisServer) *int64, defaultValue int64) *standardConfig {
+	return &standardConfig{
+		name: name, alias: alias, flags: flags,
+		init: func(s *RedisServer) { *field(s) = defaultValue },
+		set: func(s *RedisServer, args []string) error {
+			ll, ok := memtoll(args[0])
+			if !ok {
+				return fmt.Errorf("argument must be a memory value")
+			}
+			if ll < lower || ll > upper {
+				return fmt.Errorf("argument must be between %d and %d inclusive", lower, upper)
+			}
+			*field(s) = ll
+			return nil
+		},
+		get: func(s *RedisServer) string { return fmt.Sprintf("%d", *field(s)) },
+	}
+}
+
+func createEnumConfig(name, alias string, flags ConfigFlags, enum []configEnum, field func(s *RedisServer) *int, defaultValue int) *standardConfig {
+	return &standardConfig{
+		name: name, alias: alias, flags: flags,
+		init: func(s *RedisServer) { *field(s) = defaultValue },
+		set: func(s *RedisServer, args []string) error {
+			for _, e := range enum {
+				if strings.EqualFold(e.name, args[0]) {
+					*field(s) = e.val
+					return nil
+				}
+			}
+			names := make([]string, 0, len(enum))
+			for _, e := range enum {
+				names = append(names, e.name)
+			}
+			return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(names, ", "))
+		},
+		get: func(s *RedisServer) string {
+			for _, e := range enum {
+				if e.val == *field(s) {
+					return e.name
+				}
+			}
+			return "unknown"
+		},
+	}
+}
+
+func createSpecialConfig(name, alias string, flags ConfigFlags, init func(s *RedisServer), set func(s *RedisServer, args []string) error, get func(s *RedisServer) string) *standardConfig {
+	return &standardConfig{name: name, alias: alias, flags: flags, init: init, set: set, get: get}
+}
+
+var standardConfigTable = []*standardConfig{
+	createIntConfig("port", "", ImmutableConfig, 0, 65535, func(s *RedisServer) *int { return &s.port }, 6379),
+	createSpecialConfig("bind", "", ImmutableConfig|MultiArgConfig,
+		func(s *RedisServer) {
+			s.bindAddr = append([]string(nil), ConfigDefaultBindAddr...)
+			s.bindAddrCount = len(s.bindAddr)
+		},
+		setBindAddr, func(s *RedisServer) string { return strings.Join(s.bindAddr, " ") }),
+	createBoolConfig("protected-mode", "", ModifiableConfig, func(s *RedisServer) *bool { return &s.protectedMode }, true),
+	createIntConfig("tls-port", "", ImmutableConfig, 0, 65535, func(s *RedisServer) *int { return &s.tlsPort }, 0),
+	createStringConfig("tls-cert-file", "", ImmutableConfig, func(s *RedisServer) *string { return &s.tlsCertFile }, ""),
+	createStringConfig("tls-key-file", "", ImmutableConfig, func(s *RedisServer) *string { return &s.tlsKeyFile }, ""),
+	createStringConfig("tls-ca-cert-file", "", ImmutableConfig, func(s *RedisServer) *string { return &s.tlsCaCertFile }, ""),
+	createStringConfig("tls-ca-cert-dir", "", ImmutableConfig, func(s *RedisServer) *string { return &s.tlsCaCertDir }, ""),
+	createEnumConfig("tls-auth-clients", "", ImmutableConfig, tlsAuthClientsEnum, func(s *RedisServer) *int { return &s.tlsAuthClients }, TLSClientAuthYes),
+	createStringConfig("tls-protocols", "", ImmutableConfig, func(s *RedisServer) *string { return &s.tlsProtocols }, ""),
+	createStringConfig("tls-ciphers", "", ImmutableConfig, func(s *RedisServer) *string { return &s.tlsCiphers }, ""),
+	createStringConfig("unixsocket", "", ImmutableConfig, func(s *RedisServer) *string { return &s.unixSocket }, ""),
+	createSpecialConfig("unixsocketperm", "", ImmutableConfig,
+		func(s *RedisServer) { s.unixSocketPerm = 0 },
+		func(s *RedisServer, args []string) error {
+			perm, err := strconv.ParseUint(args[0], 8, 32)
+			if err != nil || perm > 0777 {
+				return fmt.Errorf("argument must be an octal number between 0 and 777")
+			}
+			s.unixSocketPerm = uint32(perm)
+			return nil
+		},
+		func(s *RedisServer) string { return strconv.FormatUint(uint64(s.unixSocketPerm), 8) },
+	),
+	createIntConfig("databases", "", ImmutableConfig, 1, math.MaxInt32, func(s *RedisServer) *int { return &s.dbNum }, ConfigDefaultDbNum),
+	createIntConfig("hz", "", ModifiableConfig, 1, 500, func(s *RedisServer) *int { return &s.hz }, ConfigDefaultHz),
+	createIntConfig("io-threads", "", ImmutableConfig, 1, IOThreadsMaxNum, func(s *RedisServer) *int { return &s.ioThreadsNum }, 1),
+	createBoolConfig("io-threads-do-reads", "", ImmutableConfig, func(s *RedisServer) *bool { return &s.ioThreadsDoReads }, false),
+	createMemoryConfig("maxmemory", "", ModifiableConfig, 0, math.MaxInt64, func(s *RedisServer) *int64 { return &s.maxmemory }, 0),
+	createEnumConfig("maxmemory-policy", "", ModifiableConfig, maxmemoryPolicyEnum, func(s *RedisServer) *int { return &s.maxmemoryPolicy }, db.MAXMEMORY_NO_EVICTION),
+	createIntConfig("maxmemory-samples", "", ModifiableConfig, 1, 64, func(s *RedisServer) *int { return &s.maxmemorySamples }, db.MEMORY_SAMPLES),
+	createIntConfig("maxmemory-eviction-tenacity", "", ModifiableConfig, 0, 100, func(s *RedisServer) *int { return &s.maxmemoryEvictionTenacity }, 10),
+	createIntConfig("lfu-log-factor", "", ModifiableConfig, 0, math.MaxInt32, func(s *RedisServer) *int { return &s.lfuLogFactor }, db.LFU_LOG_FACTOR),
+	createIntConfig("lfu-decay-time", "", ModifiableConfig, 0, math.MaxInt32, func(s *RedisServer) *int { return &s.lfuDecayTime }, db.LFU_DECAY_TIME),
+	createBoolConfig("lazyfree-lazy-eviction", "", ModifiableConfig, func(s *RedisServer) *bool { return &s.lazyfreeLazyEviction }, false),
+	createBoolConfig("lazyfree-lazy-expire", "", ModifiableConfig, func(s *RedisServer) *bool { return &s.lazyfreeLazyExpire }, false),
+	createBoolConfig("lazyfree-lazy-server-del", "", ModifiableConfig, func(s *RedisServer) *bool { return &s.lazyfreeLazyServerDel }, false),
+	createBoolConfig("lazyfree-lazy-user-del", "", ModifiableConfig, func(s *RedisServer) *bool { return &s.lazyfreeLazyUserDel }, false),
+	createIntConfig("lazyfree-threshold", "", ModifiableConfig, 0, math.MaxInt32, func(s *RedisServer) *int { return &s.lazyfreeThreshold }, db.LAZYFREE_THRESHOLD),
+	createIntConfig("shutdown-timeout", "", ModifiableConfig, 0, math.MaxInt32, func(s *RedisServer) *int64 { return &s.shutdownTimeout }, 10),
+	createIntConfig("busy-reply-threshold", "lua-time-limit", ModifiableConfig, 0, math.MaxInt64, func(s *RedisServer) *int64 { return &s.busyReplyThreshold }, 5000),
+	createStringConfig("logfile", "", ImmutableConfig, func(s *RedisServer) *string { return &s.logFile }, ""),
+	createStringConfig("aclfile", "", ImmutableConfig, func(s *RedisServer) *string { return &s.aclFilename }, ""),
+	createIntConfig("slowlog-log-slower-than", "", ModifiableConfig, -1, math.MaxInt64, func(s *RedisServer) *int64 { return &s.slowlogLogSlowerThan }, 10000),
+	createIntConfig("slowlog-max-len", "", ModifiableConfig, 0, math.MaxInt64, func(s *RedisServer) *int64 { return &s.slowlogMaxLen }, 128),
+	createIntConfig("latency-monitor-threshold", "", ModifiableConfig, 0, math.MaxInt64, func(s *RedisServer) *int64 { return &s.latencyMonitorThreshold }, 0),
+	createBoolConfig("latency-tracking", "", ModifiableConfig, func(s *RedisServer) *bool { return &s.latencyTrackingEnabled }, true),
+	createSpecialConfig("latency-tracking-info-percentiles", "", ModifiableConfig|MultiArgConfig,
+		func(s *RedisServer) { s.latencyTrackingInfoPercentiles = []float64{50, 99, 99.9} },
+		setLatencyTrackingInfoPercentiles, getLatencyTrackingInfoPercentiles),
+	createIntConfig("acllog-max-len", "", ModifiableConfig, 0, math.MaxInt32, func(s *RedisServer) *int { return &s.aclLogMaxLen }, 128),
+	createStringConfig("pidfile", "", ImmutableConfig, func(s *RedisServer) *string { return &s.pidPath }, ""),
+	createIntConfig("timeout", "", ModifiableConfig, 0, math.MaxInt32, func(s *RedisServer) *int64 { return &s.maxIdleTime }, 0),
+	createSpecialConfig("tcp-keepalive", "", ModifiableConfig,
+		func(s *RedisServer) { s.tcpKeepLive = 300 },
+		func(s *RedisServer, args []string) error {
+			ll, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("argument couldn't be parsed into an integer")
+			}
+			if ll < 0 || ll > math.MaxInt32 {
+				return fmt.Errorf("argument must be between 0 and %d inclusive", math.MaxInt32)
+			}
+			s.tcpKeepLive = int(ll)
+			// The new connections are accepted with the new interval.
+			if r, ok := s.reactor.(*Reactor); ok {
+				r.SetTCPKeepAlive(s.tcpKeepLive)
+			}
+			return nil
+		},
+		func(s *RedisServer) string { return strconv.Itoa(s.tcpKeepLive) },
+	),
+	createMemoryConfig("client-query-buffer-limit", "", ModifiableConfig, 1024*1024, math.MaxInt64, func(s *RedisServer) *int64 { return &s.clientMaxQueryBufLen }, 1024*1024*1024),
+	createSpecialConfig("client-output-buffer-limit", "", ModifiableConfig|MultiArgConfig,
+		func(s *RedisServer) { s.clientObufLimits = clientBufferLimitsDefaults },
+		setClientOutputBufferLimit, getClientOutputBufferLimit),
+	createSpecialConfig("notify-keyspace-events", "", ModifiableConfig,
+		func(s *RedisServer) { s.notifyKeyspaceEvents = 0 },
+		func(s *RedisServer, args []string) error {
+			flags, ok := keyspaceEventsStringToFlags(args[0])
+			if !ok {
+				return fmt.Errorf("Invalid event class character. Use 'Ag$lshzxeKEtmn'.")
+			}
+			s.notifyKeyspaceEvents = flags
+			return nil
+		},
+		func(s *RedisServer) string { return keyspaceEventsFlagsToString(s.notifyKeyspaceEvents) },
+	),
+}
+
+// ConfigDefaultBindAddr are the default bind addresses: every IPv4 and, if
+// available, every IPv6 interface.
+var ConfigDefaultBindAddr = []string{"*", "-::*"}
+
+// ConfigBindAddrMax is the max number of bind addresses.
+const ConfigBindAddrMax = 16
+
+// setBindAddr parses the bind config, a list of addresses. An address may be
+// prefixed with "-" if it is optional, see listenToPort.
+func setBindAddr(s *RedisServer, args []string) error {
+	// The YAML config may give all the addresses in a single string.
+	args = strings.Fields(strings.Join(args, " "))
+	if len(args) > ConfigBindAddrMax {
+		return fmt.Errorf("Too many bind addresses specified.")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("at least one bind address is needed")
+	}
+	s.bindAddr = args
+	s.bindAddrCount = len(args)
+	return nil
+}
+
+// isDefaultBindAddr reports whether the bind addresses are the default ones,
+// that is no bind address was configured explicitly.
+func (s *RedisServer) isDefaultBindAddr() bool {
+	if len(s.bindAddr) != len(ConfigDefaultBindAddr) {
+		return false
+	}
+	for j, addr := range s.bindAddr {
+		if addr != ConfigDefaultBindAddr[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// clientBufferLimitsDefaults are the default output buffer limits of the
+// normal, replica and Pub/Sub clients.
+var clientBufferLimitsDefaults = [ClientTypeObufCount]clientBufferLimitsConfig{
+	{0, 0, 0}, // normal
+	{1024 * 1024 * 256, 1024 * 1024 * 64, 60}, // slave
+	{1024 * 1024 * 32, 1024 * 1024 * 8, 60},   // pubsub
+}
+
+// setClientOutputBufferLimit parses the client-output-buffer-limit config,
+// a sequence of <class> <hard limit> <soft limit> <soft seconds>. All the
+// classes are validated before any of them is set.
+func setClientOutputBufferLimit(s *RedisServer, args []string) error {
+	// The YAML config may give all the classes in a single string.
+	args = strings.Fields(strings.Join(args, " "))
+	if len(args) == 0 || len(args)%4 != 0 {
+		return fmt.Errorf("Wrong number of arguments in buffer limit configuration.")
+	}
+
+	limits := s.clientObufLimits
+	for j := 0; j < len(args); j += 4 {
+		class, ok := getClientTypeByName(args[j])
+		if !ok || class == ClientTypeMaster {
+			return fmt.Errorf("Invalid client class specified in buffer limit configuration.")
+		}
+		hard, hardOk := memtoll(args[j+1])
+		soft, softOk := memtoll(args[j+2])
+		softSeconds, err := strconv.ParseInt(args[j+3], 10, 64)
+		if !hardOk || !softOk || err != nil || hard < 0 || soft < 0 || softSeconds < 0 {
+			return fmt.Errorf("Error in hard, soft or soft_seconds setting in buffer limit configuration.")
+		}
+		limits[class] = clientBufferLimitsConfig{hardLimitBytes: hard, softLimitBytes: soft, softLimitSeconds: softSeconds}
+	}
+	s.clientObufLimits = limits
+	return nil
+}
+
+// getClientOutputBufferLimit formats the client-output-buffer-limit config.
+func getClientOutputBufferLimit(s *RedisServer) string {
+	classes := [ClientTypeObufCount]string{"normal", "slave", "pubsub"}
+	parts := make([]string, 0, ClientTypeObufCount)
+	for j, l := range s.clientObufLimits {
+		parts = append(parts, fmt.Sprintf("%s %d %d %d", classes[j], l.hardLimitBytes, l.softLimitBytes, l.softLimitSeconds))
+	}
+	return strings.Join(parts, " ")
+}
+
+// setLatencyTrackingInfoPercentiles parses the
+// latency-tracking-info-percentiles config, a list of percentiles between 0
+// and 100. An empty list disables the latencystats section of INFO.
+func setLatencyTrackingInfoPercentiles(s *RedisServer, args []string) error {
+	// The YAML config may give all the percentiles in a single string.
+	args = strings.Fields(strings.Join(args, " "))
+	percentiles := make([]float64, 0, len(args))
+	for _, arg := range args {
+		p, err := strconv.ParseFloat(arg, 64)
+		if err != nil || p < 0 || p > 100 {
+			return fmt.Errorf("latency-tracking-info-percentiles parameter should be between 0.0 and 100.0")
+		}
+		percentiles = append(percentiles, p)
+	}
+	s.latencyTrackingInfoPercentiles = percentiles
+	return nil
+}
+
+// getLatencyTrackingInfoPercentiles formats the
+// latency-tracking-info-percentiles config as it is parsed.
+func getLatencyTrackingInfoPercentiles(s *RedisServer) string {
+	parts := make([]string, 0, len(s.latencyTrackingInfoPercentiles))
+	for _, p := range s.latencyTrackingInfoPercentiles {
+		parts = append(parts, trimDoubleString(p))
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitArgs splits the value given to CONFIG SET into the config arguments.
+func (config *standardConfig) splitArgs(value string) []string {
+	if config.flags&MultiArgConfig != 0 {
+		return strings.Fields(value)
+	}
+	return []string{value}
+}
+
+// lookupConfig finds a config by name or alias, case insensitive.
+func lookupConfig(name string) *standardConfig {
+	for _, config := range standardConfigTable {
+		if strings.EqualFold(config.name, name) || (config.alias != "" && strings.EqualFold(config.alias, name)) {
+			return config
+		}
+	}
+	return nil
+}
+
+// initConfigValues sets every config to its default value.
+func (s *RedisServer) initConfigValues() {
+	for _, config := range standardConfigTable {
+		config.init(s)
+	}
+}
+
+// LoadConfig loads the server configuration from a YAML file, every key is a
+// config name, multi-argument configs can be given as a list.
+func (s *RedisServer) LoadConfig(filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("fatal error, can't open config file '%s': %w", filename, err)
+	}
+	if err := s.loadConfigFromString(content); err != nil {
+		return err
+	}
+	s.configFile = filename
+	return nil
+}
+
+func (s *RedisServer) loadConfigFromString(content []byte) error {
+	var entries map[string]any
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return fmt.Errorf("bad config file: %w", err)
+	}
+
+	// Apply the configs in a stable order, so that errors are reproducible.
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// The users are created once the command table exists, every
+		// directive is a user followed by its ACL rules.
+		if strings.EqualFold(name, "user") {
+			for _, line := range configValueToArgs(entries[name]) {
+				argv := strings.Fields(line)
+				if len(argv) == 0 {
+					return fmt.Errorf("wrong number of arguments for 'user'")
+				}
+				s.usersToLoad = append(s.usersToLoad, argv)
+			}
+			continue
+		}
+
+		config := lookupConfig(name)
+		if config == nil {
+			return fmt.Errorf("bad directive or wrong number of arguments: '%s'", name)
+		}
+		args := configValueToArgs(entries[name])
+		if len(args) == 0 || (len(args) > 1 && config.flags&MultiArgConfig == 0) {
+			return fmt.Errorf("wrong number of arguments for '%s'", name)
+		}
+		if err := config.set(s, args); err != nil {
+			return fmt.Errorf("invalid value for '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// configValueToArgs turns a YAML scalar or list into config arguments.
+func configValueToArgs(v any) []string {
+	switch value := v.(type) {
+	case nil:
+		return []string{""}
+	case bool:
+		return []string{boolToString(value)}
+	case []any:
+		args := make([]string, 0, len(value))
+		for _, item := range value {
+			args = append(args, configValueToArgs(item)...)
+		}
+		return args
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * CONFIG command entry point
+ *----------------------------------------------------------------------------*/
+
+// ConfigCmd handles the CONFIG command.
+type ConfigCmd struct {
+	c *Client
+}
+
+// NewConfigCmd returns a new ConfigCmd.
+func NewConfigCmd(c *Client) *ConfigCmd {
+	return &ConfigCmd{c: c}
+}
+
+// Get implements CONFIG GET parameter [parameter ...]
+func (cmd *ConfigCmd) Get() {
+	matches := make(map[string]string)
+	for i := 2; i < cmd.c.argc; i++ {
+		pattern := cmd.c.argv[i].Value.(string)
+		for _, config := range standardConfigTable {
+			if stringMatch(pattern, config.name, true) {
+				matches[config.name] = config.get(server)
+			} else if config.alias != "" && stringMatch(pattern, config.alias, true) {
+				matches[config.alias] = config.get(server)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(matches))
+	for name := range matches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cmd.c.addReplyMapLen(len(names))
+	for _, name := range names {
+		cmd.c.addReplyBulkCString(name)
+		cmd.c.addReplyBulkCString(matches[name])
+	}
+}
+
+// Set implements CONFIG SET parameter value [parameter value ...]
+// All the values are validated before any of them is applied, if one of them
+// fails the previous values are restored.
+func (cmd *ConfigCmd) Set() {
+	if cmd.c.argc%2 != 0 {
+		cmd.c.addReplyErrorArity()
+		return
+	}
+
+	configs := make([]*standardConfig, 0, (cmd.c.argc-2)/2)
+	values := make([]string, 0, (cmd.c.argc-2)/2)
+	for i := 2; i < cmd.c.argc; i += 2 {
+		name := cmd.c.argv[i].Value.(string)
+		config := lookupConfig(name)
+		if config == nil {
+			cmd.c.addReplyErrorFormat(fmt.Sprintf("Unknown option or number of arguments for CONFIG SET - '%s'", name))
+			return
+		}
+		if config.flags&ImmutableConfig != 0 {
+			cmd.c.addReplyErrorFormat(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", name))
+			return
+		}
+		for _, seen := range configs {
+			if seen == config {
+				cmd.c.addReplyErrorFormat(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - duplicate parameter", name))
+				return
+			}
+		}
+		configs = append(configs, config)
+		values = append(values, cmd.c.argv[i+1].Value.(string))
+	}
+
+	olds := make([]string, len(configs))
+	for i, config := range configs {
+		olds[i] = config.get(server)
+		if err := config.set(server, config.splitArgs(values[i])); err != nil {
+			// Restore the previous values before failing.
+			for j := i - 1; j >= 0; j-- {
+				_ = configs[j].set(server, configs[j].splitArgs(olds[j]))
+			}
+			cmd.c.addReplyErrorFormat(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", configs[i].name, err.Error()))
+			return
+		}
+	}
+
+	cmd.c.AddReply(SharedOk)
+}
+
+// Help implements CONFIG HELP
+func (cmd *ConfigCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"GET <pattern>",
+		"    Return parameters matching the glob-like <pattern> and their values.",
+		"SET <directive> <value>",
+		"    Set the configuration <directive> to <value>.",
+	})
+}
+
+func configGetCommand(c *Client) error {
+	NewConfigCmd(c).Get()
+	return nil
+}
+
+func configSetCommand(c *Client) error {
+	NewConfigCmd(c).Set()
+	return nil
+}
+
+func configHelpCommand(c *Client) error {
+	NewConfigCmd(c).Help()
+	return nil
+}
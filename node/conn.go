@@ -5,27 +5,52 @@ type Conn interface {
 	// Read reads data from the connection.
 	Read() (data []byte, err error)
 
-	// Write writes data to the connection.
-	Write(data []byte) (err error)
+	// Write writes data to the connection without blocking, it returns the
+	// number of bytes written, which is less than len(data) if the
+	// connection can't accept more data right now.
+	Write(data []byte) (n int, err error)
 
 	// Close closes the connection.
 	Close() error
 
 	Fd() int
 	Ip() string
+
+	// Addr returns the address of the peer, as ip:port.
+	Addr() string
+
+	// LocalAddr returns the local address of the connection, as ip:port.
+	LocalAddr() string
 }
 
-type Buffer interface {
-	// DataToWrite closes the connection.
-	DataToWrite() []byte
+// WriteNotifier is implemented by the connections that can notify the
+// handler once they are writable again, see WritableHandler.
+type WriteNotifier interface {
+	// SetWriteHandler installs, or removes, the notification of the
+	// writable event of the connection.
+	SetWriteHandler(install bool) error
+}
 
-	Next(n int)
+// VectoredConn is implemented by the connections that can write several
+// buffers with a single call, see writeReplies.
+type VectoredConn interface {
+	// Writev writes the buffers in order without blocking, like Write.
+	Writev(bufs [][]byte) (n int, err error)
+}
 
-	Len() int
+// ThreadSafeConn is implemented by the connections that may not be read and
+// written by the I/O threads, see io-threads. The other connections are
+// assumed to be thread safe.
+type ThreadSafeConn interface {
+	// ThreadSafe reports whether Read and Write can be called off the
+	// event loop.
+	ThreadSafe() bool
 }
 
-// BufferedConn is the interface for buffered connection.
-type BufferedConn interface {
-	Conn
-	Buffer
+// UnixSocketConn is implemented by the connections that may be accepted on
+// a unix domain socket.
+type UnixSocketConn interface {
+	// IsUnixSocket reports whether the connection was accepted on the unix
+	// socket, its Ip is the path of the socket then.
+	IsUnixSocket() bool
 }
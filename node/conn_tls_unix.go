@@ -0,0 +1,438 @@
+//go:build linux
+// +build linux
+
+package node
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/fzft/go-mock-redis/log"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// tlsHandshakeTimeout is the time a client has to complete the TLS handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// Connection states of the TLS connections
+const (
+	tlsStateAccepting = iota // The handshake is in progress, off the event loop
+	tlsStateConnected        // The connection is served by the event loop
+)
+
+// tlsRawConn is the net.Conn the TLS layer reads the records from, and writes
+// them to, the non blocking socket. While the handshake is in progress the
+// reads and the writes wait for the socket, up to the deadline. Once
+// connected the reads return EAGAIN when there is nothing to read, and the
+// records the socket can't accept are kept in pending until it is writable
+// again: the TLS layer can't retry a failed write.
+type tlsRawConn struct {
+	fd       int
+	blocking bool      // wait for the socket, during the handshake
+	deadline time.Time // of the blocking reads and writes
+	pending  []byte    // records not yet accepted by the socket
+}
+
+func (rc *tlsRawConn) Read(b []byte) (int, error) {
+	for {
+		n, err := unix.Read(rc.fd, b)
+		if err == nil {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+		if err == unix.EINTR {
+			continue
+		}
+		if !IsTemporaryError(err) || !rc.blocking {
+			// EAGAIN is a temporary net.Error, the TLS layer returns it
+			// to the caller without breaking the connection.
+			return 0, err
+		}
+		if err := rc.wait(unix.POLLIN); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (rc *tlsRawConn) Write(b []byte) (int, error) {
+	total := len(b)
+	if len(rc.pending) == 0 {
+		for len(b) > 0 {
+			n, err := unix.Write(rc.fd, b)
+			if n > 0 {
+				b = b[n:]
+			}
+			if err == nil || err == unix.EINTR {
+				continue
+			}
+			if !IsTemporaryError(err) {
+				return total - len(b), err
+			}
+			if !rc.blocking {
+				break
+			}
+			if err := rc.wait(unix.POLLOUT); err != nil {
+				return total - len(b), err
+			}
+		}
+	}
+	rc.pending = append(rc.pending, b...)
+	return total, nil
+}
+
+// flush writes the pending records the socket accepts, it returns true once
+// there is nothing left.
+func (rc *tlsRawConn) flush() (bool, error) {
+	for len(rc.pending) > 0 {
+		n, err := unix.Write(rc.fd, rc.pending)
+		if n > 0 {
+			rc.pending = rc.pending[n:]
+		}
+		if err != nil && err != unix.EINTR {
+			if IsTemporaryError(err) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	rc.pending = nil
+	return true, nil
+}
+
+// wait waits for the socket to be ready for the events, up to the deadline.
+func (rc *tlsRawConn) wait(events int16) error {
+	timeout := -1
+	if !rc.deadline.IsZero() {
+		timeout = int(time.Until(rc.deadline).Milliseconds())
+		if timeout <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+	}
+	fds := []unix.PollFd{{Fd: int32(rc.fd), Events: events}}
+	for {
+		n, err := unix.Poll(fds, timeout)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return os.ErrDeadlineExceeded
+		}
+		return nil
+	}
+}
+
+// The socket is owned by the TLSConn, the rest of net.Conn is not used by
+// the TLS layer.
+func (rc *tlsRawConn) Close() error                       { return nil }
+func (rc *tlsRawConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (rc *tlsRawConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (rc *tlsRawConn) SetDeadline(t time.Time) error      { rc.deadline = t; return nil }
+func (rc *tlsRawConn) SetReadDeadline(t time.Time) error  { return rc.SetDeadline(t) }
+func (rc *tlsRawConn) SetWriteDeadline(t time.Time) error { return rc.SetDeadline(t) }
+
+// TLSConn is a connection accepted on a TLS listener. The handshake is done
+// by its own goroutine, the connection is handed to the event loop once
+// connected, see Poll.tlsAccept.
+type TLSConn struct {
+	DefaultBufferedConn
+	state     int
+	raw       *tlsRawConn
+	tls       *tls.Conn
+	early     []byte // data read along with the handshake
+	wantWrite bool   // the handler asked for the writable event
+}
+
+// newTLSConn returns the server side TLS connection of the accepted socket.
+func newTLSConn(conn DefaultBufferedConn, config *tls.Config) *TLSConn {
+	raw := &tlsRawConn{fd: conn.fd}
+	return &TLSConn{
+		DefaultBufferedConn: conn,
+		state:               tlsStateAccepting,
+		raw:                 raw,
+		tls:                 tls.Server(raw, config),
+	}
+}
+
+// handshake performs the TLS handshake, waiting for the socket up to the
+// handshake timeout. It must not be called from the event loop.
+func (c *TLSConn) handshake() error {
+	c.raw.blocking = true
+	c.raw.deadline = time.Now().Add(tlsHandshakeTimeout)
+	err := c.tls.Handshake()
+	c.raw.blocking = false
+	c.raw.deadline = time.Time{}
+	if err != nil {
+		return err
+	}
+
+	// The first query may have been read from the socket along with the end
+	// of the handshake, it would never be reported by epoll.
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.tls.Read(buf)
+		c.early = append(c.early, buf[:n]...)
+		if err != nil {
+			// Any other error is reported by the next read.
+			return nil
+		}
+	}
+}
+
+// tlsHandshake is the result of the handshake of a connection.
+type tlsHandshake struct {
+	conn *TLSConn
+	err  error
+}
+
+// listenTLS registers the TLS listeners, their connections speak TLS with the
+// configuration.
+func (p *Poll) listenTLS(fds []int, config *tls.Config) error {
+	if p.hfd == -1 {
+		hfd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+		if err != nil {
+			log.Logger.Error("Failed to create eventfd", zap.Error(err))
+			return err
+		}
+		if err := p.AddRead(hfd); err != nil {
+			log.Logger.Error("Failed to add eventfd to epoll", zap.Error(err))
+			unix.Close(hfd)
+			return err
+		}
+		p.hfd = hfd
+	}
+	for i, fd := range fds {
+		if err := p.AddRead(fd); err != nil {
+			log.Logger.Error("Failed to add TLS listener to epoll", zap.Error(err))
+			// The fds are still owned by the caller.
+			for _, added := range fds[:i] {
+				p.Delete(added)
+			}
+			return err
+		}
+	}
+	p.tlsFDs = append(p.tlsFDs, fds...)
+	p.tlsConfig = config
+	return nil
+}
+
+// isTLSListener reports whether the fd is one of the TLS listeners.
+func (p *Poll) isTLSListener(fd int) bool {
+	for _, lnFd := range p.tlsFDs {
+		if fd == lnFd {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsAccept performs the handshake of the accepted connection off the event
+// loop, a slow client can't block the other ones.
+func (p *Poll) tlsAccept(conn *TLSConn) {
+	go func() {
+		err := conn.handshake()
+
+		p.handshakeMu.Lock()
+		if p.closed {
+			p.handshakeMu.Unlock()
+			unix.Close(conn.fd)
+			return
+		}
+		p.handshaked = append(p.handshaked, tlsHandshake{conn: conn, err: err})
+		// Signaled under the lock, the eventfd is closed along with the poll.
+		var one uint64 = 1
+		if _, err := unix.Write(p.hfd, (*(*[8]byte)(unsafe.Pointer(&one)))[:]); err != nil {
+			log.Logger.Error("Failed to write to event fd", zap.Error(err))
+		}
+		p.handshakeMu.Unlock()
+	}()
+}
+
+// handleHandshakes serves the connections whose handshake is done, the ones
+// that failed are closed.
+func (p *Poll) handleHandshakes() error {
+	var buf uint64
+	if _, err := unix.Read(p.hfd, (*(*[8]byte)(unsafe.Pointer(&buf)))[:]); err != nil {
+		log.Logger.Error("Failed to read from event fd", zap.Error(err))
+		return nil
+	}
+	p.handshakeMu.Lock()
+	handshaked := p.handshaked
+	p.handshaked = nil
+	p.handshakeMu.Unlock()
+
+	for _, hs := range handshaked {
+		conn := hs.conn
+		if hs.err != nil {
+			log.Logger.Warn("Error accepting a client connection", zap.String("addr", conn.addr), zap.Error(hs.err))
+			unix.Close(conn.fd)
+			continue
+		}
+		if err := p.registerRead(conn.fd); err != nil {
+			log.Logger.Error("register read error", zap.Error(err))
+			unix.Close(conn.fd)
+			continue
+		}
+		conn.state = tlsStateConnected
+		if err := p.openConn(conn); err != nil {
+			return err
+		}
+		// The data read along with the handshake is served right away,
+		// unless the handler closed the connection.
+		if len(conn.early) > 0 && p.connPool[conn.fd] == Conn(conn) {
+			if err := p.rHandler.Read(conn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// closeTLS closes the TLS listeners, the eventfd of the handshakes and the
+// connections handshaked but not yet served. The handshakes still in
+// progress close their connection once done.
+func (p *Poll) closeTLS() {
+	for _, fd := range p.tlsFDs {
+		if err := p.Delete(fd); err != nil {
+			log.Logger.Debug("Failed to delete TLS listener from epoll", zap.Error(err))
+		}
+		if err := CloseFd(fd); err != nil {
+			log.Logger.Debug("Failed to close TLS listener", zap.Error(err))
+		}
+	}
+
+	p.handshakeMu.Lock()
+	p.closed = true
+	for _, hs := range p.handshaked {
+		unix.Close(hs.conn.fd)
+	}
+	p.handshaked = nil
+	p.handshakeMu.Unlock()
+
+	if p.hfd != -1 {
+		if err := p.Delete(p.hfd); err != nil {
+			log.Logger.Debug("Failed to delete eventfd from epoll", zap.Error(err))
+		}
+		if err := CloseFd(p.hfd); err != nil {
+			log.Logger.Debug("Failed to close eventfd", zap.Error(err))
+		}
+	}
+}
+
+func (c *TLSConn) Read() ([]byte, error) {
+	var buf bytes.Buffer
+	readBuffer := make([]byte, 4096)
+
+	buf.Write(c.early)
+	c.early = nil
+
+	// The records already read from the socket are decrypted too, so that
+	// nothing is left in the TLS layer once the socket is drained.
+	for {
+		n, err := c.tls.Read(readBuffer)
+		if n > 0 {
+			buf.Write(readBuffer[:n])
+		}
+		if err != nil {
+			if IsTemporaryError(err) || (err == io.EOF && buf.Len() > 0) {
+				break
+			}
+			return nil, err
+		}
+	}
+	// Reading may answer the post handshake messages of the peer.
+	if err := c.installPendingWrite(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *TLSConn) Write(data []byte) (int, error) {
+	done, err := c.raw.flush()
+	if err != nil {
+		return 0, err
+	}
+	if !done {
+		// The socket can't accept more data right now.
+		return 0, nil
+	}
+	n, err := c.tls.Write(data)
+	if err != nil {
+		return n, err
+	}
+	return n, c.installPendingWrite()
+}
+
+// Writev writes the buffers one by one, they are encrypted in separate
+// records anyway.
+func (c *TLSConn) Writev(bufs [][]byte) (int, error) {
+	written := 0
+	for _, buf := range bufs {
+		n, err := c.Write(buf)
+		written += n
+		if err != nil || n < len(buf) {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// installPendingWrite installs the writable event if some records are
+// pending, they are flushed by writable.
+func (c *TLSConn) installPendingWrite() error {
+	if len(c.raw.pending) == 0 {
+		return nil
+	}
+	return c.poll.registerWrite(c.fd)
+}
+
+// SetWriteHandler installs or removes the writable event of the connection,
+// it is kept while records are pending.
+func (c *TLSConn) SetWriteHandler(install bool) error {
+	c.wantWrite = install
+	if install {
+		return c.poll.registerWrite(c.fd)
+	}
+	if len(c.raw.pending) > 0 {
+		return nil
+	}
+	return c.poll.deregisterWrite(c.fd)
+}
+
+// writable flushes the pending records once the socket is writable, it
+// returns true if the handler asked to be notified too.
+func (c *TLSConn) writable() (bool, error) {
+	done, err := c.raw.flush()
+	if err != nil || !done {
+		return false, err
+	}
+	if !c.wantWrite {
+		return false, c.poll.deregisterWrite(c.fd)
+	}
+	return true, nil
+}
+
+// ThreadSafe reports false, reading and writing the connection may update its
+// epoll registration.
+func (c *TLSConn) ThreadSafe() bool {
+	return false
+}
+
+func (c *TLSConn) Close() error {
+	// Notify the peer, as long as the socket accepts it right away.
+	if c.state == tlsStateConnected {
+		_ = c.tls.CloseWrite()
+		_, _ = c.raw.flush()
+	}
+	return c.DefaultBufferedConn.Close()
+}
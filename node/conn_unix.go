@@ -5,16 +5,19 @@ package node
 
 import (
 	"bytes"
-	"fmt"
 	"golang.org/x/sys/unix"
-	"os"
+	"io"
+	"net"
+	"strconv"
 )
 
 type DefaultBufferedConn struct {
-	fd        int
-	ip        string
-	outBuffer bytes.Buffer
-	poll      *Poll
+	fd         int
+	ip         string
+	addr       string // ip:port of the peer
+	laddr      string // local ip:port
+	unixSocket bool   // accepted on the unix socket
+	poll       *Poll
 }
 
 func (c *DefaultBufferedConn) Read() ([]byte, error) {
@@ -34,73 +37,58 @@ func (c *DefaultBufferedConn) Read() ([]byte, error) {
 			}
 			return nil, err
 		}
+		if n == 0 {
+			// The peer closed the connection, return what was read so far
+			// and report EOF on the next call.
+			if buf.Len() > 0 {
+				break
+			}
+			return nil, io.EOF
+		}
 	}
 
 	return buf.Bytes(), nil
 }
 
-func (c *DefaultBufferedConn) Write(data []byte) error {
-	// If outBuffer has data, it means previous write(s) didn't succeed fully.
-	// Append the new data to the buffer.
-	if c.outBuffer.Len() > 0 {
-		c.outBuffer.Write(data)
-		if err := c.poll.registerWrite(c.fd); err != nil {
-			return err
-		}
-		return nil
+func (c *DefaultBufferedConn) Write(data []byte) (int, error) {
+	n, err := unix.Write(c.fd, data)
+	if n < 0 {
+		n = 0
 	}
-
-	// Try to write the data directly first.
-	fdName := fmt.Sprintf("conn_to_%d", c.fd)
-	file := os.NewFile(uintptr(c.fd), fdName)
-	if file == nil {
-		return fmt.Errorf("invalid fd: %d", c.fd)
+	if err != nil && !IsTemporaryError(err) {
+		return n, err
 	}
+	// The socket buffer is full, the caller keeps the data left.
+	return n, nil
+}
 
-	n, err := file.Write(data)
-	if err != nil {
-		// Handle specific error (e.g., EAGAIN or EWOULDBLOCK).
-		// If it's one of these errors, data needs to be buffered.
-		if IsTemporaryError(err) {
-			c.outBuffer.Write(data[n:]) // Only write remaining data to buffer.
-			if err = c.poll.registerWrite(c.fd); err != nil {
-				return err
-			}
-		} else {
-			return err // Some other error occurred.
-		}
-	} else if n < len(data) { // Partial write.
-		c.outBuffer.Write(data[n:])
-		if err = c.poll.registerWrite(c.fd); err != nil {
-			return err
-		}
+// Writev writes the buffers with a single writev, they are at most IOVMax.
+func (c *DefaultBufferedConn) Writev(bufs [][]byte) (int, error) {
+	n, err := unix.Writev(c.fd, bufs)
+	if n < 0 {
+		n = 0
+	}
+	if err != nil && !IsTemporaryError(err) {
+		return n, err
 	}
+	return n, nil
+}
 
-	return nil
+// SetWriteHandler installs or removes the writable event of the connection.
+func (c *DefaultBufferedConn) SetWriteHandler(install bool) error {
+	if install {
+		return c.poll.registerWrite(c.fd)
+	}
+	return c.poll.deregisterWrite(c.fd)
 }
 
 func (c *DefaultBufferedConn) Close() error {
-	if err := c.poll.unregister(c.fd); err != nil {
+	if err := c.poll.removeConn(c.fd); err != nil {
 		return err
 	}
 	return unix.Close(c.fd)
 }
 
-// DataToWrite returns the data to write.
-func (c *DefaultBufferedConn) DataToWrite() []byte {
-	return c.outBuffer.Bytes()
-}
-
-// Next moves the buffer forward.
-func (c *DefaultBufferedConn) Next(n int) {
-	c.outBuffer.Next(n)
-}
-
-// Len returns the length of the buffer.
-func (c *DefaultBufferedConn) Len() int {
-	return c.outBuffer.Len()
-}
-
 // Fd returns the file descriptor of the connection.
 func (c *DefaultBufferedConn) Fd() int {
 	return c.fd
@@ -110,3 +98,41 @@ func (c *DefaultBufferedConn) Fd() int {
 func (c *DefaultBufferedConn) Ip() string {
 	return c.ip
 }
+
+// Addr returns the address of the peer.
+func (c *DefaultBufferedConn) Addr() string {
+	return c.addr
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *DefaultBufferedConn) LocalAddr() string {
+	return c.laddr
+}
+
+// IsUnixSocket reports whether the connection was accepted on the unix socket.
+func (c *DefaultBufferedConn) IsUnixSocket() bool {
+	return c.unixSocket
+}
+
+// sockaddrToString formats the socket address as ip:port, the ip alone is
+// returned by sockaddrToIp.
+func sockaddrToString(sa unix.Sockaddr) string {
+	switch addr := sa.(type) {
+	case *unix.SockaddrInet4:
+		return net.JoinHostPort(sockaddrToIp(sa), strconv.Itoa(addr.Port))
+	case *unix.SockaddrInet6:
+		return net.JoinHostPort(sockaddrToIp(sa), strconv.Itoa(addr.Port))
+	}
+	return ""
+}
+
+// sockaddrToIp returns the ip of the socket address.
+func sockaddrToIp(sa unix.Sockaddr) string {
+	switch addr := sa.(type) {
+	case *unix.SockaddrInet4:
+		return net.IPv4(addr.Addr[0], addr.Addr[1], addr.Addr[2], addr.Addr[3]).String()
+	case *unix.SockaddrInet6:
+		return net.IP(addr.Addr[:]).String() // Convert 16-byte slice to net.IP
+	}
+	return ""
+}
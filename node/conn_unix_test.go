@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+package node
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketPairConn returns a connection registered to a poll, and the file of
+// its peer.
+func socketPairConn(t *testing.T) (*DefaultBufferedConn, *os.File) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPoll(make(chan struct{}), 16, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &DefaultBufferedConn{fd: fds[0], poll: p}
+	p.connPool[conn.fd] = conn
+	if err := p.registerRead(conn.fd); err != nil {
+		t.Fatal(err)
+	}
+	peer := os.NewFile(uintptr(fds[1]), "peer")
+	t.Cleanup(func() {
+		peer.Close()
+		p.CloseGracefully()
+	})
+	return conn, peer
+}
+
+func TestWriteRepliesWritev(t *testing.T) {
+	conn, peer := socketPairConn(t)
+	server.nextClientId++
+	c := NewClient(server.nextClientId, 0, conn, 2, server.db[0])
+
+	// The blocks of the reply list are written at once.
+	var want bytes.Buffer
+	for _, b := range []byte("abc") {
+		reply := bytes.Repeat([]byte{b}, ProtoReplyChunkBytes)
+		c._addReplyProtoToList(reply)
+		want.Write(reply)
+	}
+	if c.replies.Len() != 3 {
+		t.Fatalf("the reply list has %d blocks", c.replies.Len())
+	}
+	if n, err := c.writeReplies(); err != nil || n != want.Len() {
+		t.Fatalf("writeReplies wrote %d bytes: %v", n, err)
+	}
+	if c.hasPendingReplies() || c.replyBytes != 0 {
+		t.Fatalf("%d bytes left after the write", c.replyBytes)
+	}
+	got := make([]byte, want.Len())
+	if _, err := io.ReadFull(peer, got); err != nil || !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("the peer read %d bytes: %v", len(got), err)
+	}
+
+	// The socket doesn't accept all of them, the rest is kept.
+	want.Reset()
+	for j := 0; j < 256; j++ {
+		reply := bytes.Repeat([]byte{byte('a' + j%26)}, ProtoReplyChunkBytes)
+		c._addReplyProtoToList(reply)
+		want.Write(reply)
+	}
+	n, err := c.writeReplies()
+	if err != nil || n == 0 || n == want.Len() {
+		t.Fatalf("writeReplies wrote %d bytes: %v", n, err)
+	}
+	if left := c.replyBytes - c.sentLen; left != want.Len()-n {
+		t.Fatalf("%d bytes left, want %d", left, want.Len()-n)
+	}
+
+	// The write events are monitored along with the read ones, once.
+	if err := conn.SetWriteHandler(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetWriteHandler(true); err != nil {
+		t.Fatal(err)
+	}
+	if events := conn.poll.epollSet[conn.fd]; events != readWriteEvents {
+		t.Fatalf("the events are %b", events)
+	}
+
+	done := make(chan []byte)
+	go func() {
+		got := make([]byte, want.Len())
+		io.ReadFull(peer, got)
+		done <- got
+	}()
+	for c.hasPendingReplies() {
+		if _, err := c.writeReplies(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := <-done; !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("the peer read different data")
+	}
+
+	if err := conn.SetWriteHandler(false); err != nil {
+		t.Fatal(err)
+	}
+	if events := conn.poll.epollSet[conn.fd]; events != readEvents {
+		t.Fatalf("the events are %b", events)
+	}
+}
@@ -0,0 +1,255 @@
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*-----------------------------------------------------------------------------
+ * Connection commands: AUTH, HELLO, PING, QUIT, RESET
+ *----------------------------------------------------------------------------*/
+
+// ConnCmd handles the commands managing the state of the connection.
+type ConnCmd struct {
+	c *Client
+}
+
+// NewConnCmd returns a new ConnCmd.
+func NewConnCmd(c *Client) *ConnCmd {
+	return &ConnCmd{c: c}
+}
+
+// Auth implements AUTH [username] password
+//
+// The single argument form authenticates the client as the default user, as
+// the legacy AUTH did before the ACLs.
+func (cmd *ConnCmd) Auth() {
+	c := cmd.c
+	// Only two or three argument forms are allowed.
+	if c.argc > 3 {
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+
+	// Don't show the password in the slow log and MONITOR.
+	c.redactClientCommandArgument(1)
+	if c.argc == 3 {
+		c.redactClientCommandArgument(2)
+	}
+
+	var username, password string
+	if c.argc == 2 {
+		// Mimic the old behavior of giving an error for the two argument
+		// form if no password is configured.
+		if defaultUser.flags&UserFlagNoPass != 0 {
+			c.AddReplyError("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+			return
+		}
+		username = "default"
+		password = c.argv[1].Value.(string)
+	} else {
+		username = c.argv[1].Value.(string)
+		password = c.argv[2].Value.(string)
+	}
+
+	if !ACLAuthenticateUser(c, username, password) {
+		c.AddReplyError("-WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	c.AddReply(SharedOk)
+}
+
+// Hello implements HELLO [protover [AUTH username password] [SETNAME clientname]]
+//
+// It switches the protocol of the connection and replies with the server
+// properties, encoded in the new protocol.
+func (cmd *ConnCmd) Hello() {
+	c := cmd.c
+	ver := int64(0)
+	nextArg := 1
+
+	if c.argc >= 2 {
+		var err error
+		ver, err = strconv.ParseInt(c.argv[1].Value.(string), 10, 64)
+		if err != nil {
+			c.AddReplyError("Protocol version is not an integer or out of range")
+			return
+		}
+		nextArg++
+	}
+
+	var username, password, clientName string
+	for j := nextArg; j < c.argc; j++ {
+		moreArgs := c.argc - 1 - j
+		opt := c.argv[j].Value.(string)
+		if strings.EqualFold(opt, "auth") && moreArgs >= 2 {
+			c.redactClientCommandArgument(j + 1)
+			c.redactClientCommandArgument(j + 2)
+			username = c.argv[j+1].Value.(string)
+			password = c.argv[j+2].Value.(string)
+			j += 2
+		} else if strings.EqualFold(opt, "setname") && moreArgs >= 1 {
+			clientName = c.argv[j+1].Value.(string)
+			j++
+		} else {
+			c.addReplyErrorFormat(fmt.Sprintf("Syntax error in HELLO option '%s'", opt))
+			return
+		}
+	}
+
+	if c.argc >= 2 && (ver < 2 || ver > 3) {
+		c.AddReplyError("-NOPROTO unsupported protocol version")
+		return
+	}
+
+	if username != "" && !ACLAuthenticateUser(c, username, password) {
+		c.AddReplyError("-WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+
+	if clientName != "" && !c.setNameOrReply(clientName) {
+		return
+	}
+
+	// At this point we need to be authenticated to continue.
+	if c.authRequired() {
+		c.AddReplyError("-NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	// Let's switch to the specified RESP mode.
+	if ver != 0 {
+		c.resp = int(ver)
+	}
+	c.addReplyMapLen(7)
+
+	c.addReplyBulkCString("server")
+	c.addReplyBulkCString("redis")
+
+	c.addReplyBulkCString("version")
+	c.addReplyBulkCString(RedisVersion)
+
+	c.addReplyBulkCString("proto")
+	c.addReplyLongLong(int64(c.resp))
+
+	c.addReplyBulkCString("id")
+	c.addReplyLongLong(int64(c.id))
+
+	c.addReplyBulkCString("mode")
+	c.addReplyBulkCString("standalone")
+
+	c.addReplyBulkCString("role")
+	c.addReplyBulkCString("master")
+
+	c.addReplyBulkCString("modules")
+	c.addReplyArrayLen(0)
+}
+
+// Ping implements PING [message]
+//
+// In the RESP2 Pub/Sub mode the reply is an array, as the client only
+// expects pushed messages.
+func (cmd *ConnCmd) Ping() {
+	c := cmd.c
+	// The command takes zero or one arguments.
+	if c.argc > 2 {
+		c.addReplyErrorArity()
+		return
+	}
+
+	if c.flags&ClientPubSub != 0 && c.resp == 2 {
+		c.addReplyArrayLen(2)
+		c.addReplyBulkCString("pong")
+		if c.argc == 1 {
+			c.addReplyBulkCString("")
+		} else {
+			c.addReplyBulkCString(c.argv[1].Value.(string))
+		}
+		return
+	}
+	if c.argc == 1 {
+		c.AddReply(SharedPong)
+	} else {
+		c.addReplyBulkCString(c.argv[1].Value.(string))
+	}
+}
+
+// Quit implements QUIT, the connection is closed once the reply is sent.
+func (cmd *ConnCmd) Quit() {
+	cmd.c.AddReply(SharedOk)
+	cmd.c.flags |= ClientCloseAfterReply
+}
+
+// Reset implements RESET, it restores the state of a new connection.
+func (cmd *ConnCmd) Reset() {
+	c := cmd.c
+	// The monitors are slaves too, they can be reset.
+	flags := c.flags
+	if flags&ClientMonitor != 0 {
+		flags &= ^(ClientMonitor | ClientSlave)
+	}
+	if flags&(ClientSlave|ClientMaster|ClientModule) != 0 {
+		c.AddReplyError("can only reset normal client connections")
+		return
+	}
+	c.clearClientConnectionState()
+	c.addReplyStatus("RESET")
+}
+
+// clearClientConnectionState leaves the MONITOR, tracking, transaction and
+// Pub/Sub modes, selects the DB 0, switches back to RESP2 and the default
+// user, and clears the name of the client.
+func (c *Client) clearClientConnectionState() {
+	if c.flags&ClientMonitor != 0 {
+		if node := server.monitors.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+			_ = server.monitors.RemoveNode(node)
+		}
+		c.flags &= ^(ClientMonitor | ClientSlave)
+	}
+
+	if c.flags&ClientTracking != 0 {
+		c.disableTracking()
+	}
+	c.selectDb(0)
+	c.resp = 2
+
+	c.user = defaultUser
+	c.authenticated = false
+
+	c.discardTransaction()
+	c.pubsubUnsubscribeAllChannels(false)
+	c.pubsubUnsubscribeAllPatterns(false)
+	c.markClientAsPubSub()
+
+	// The library name and version are kept, they still describe the
+	// client library behind the connection.
+	c.name = ""
+
+	c.flags &= ^(ClientAsking | ClientReadOnly | ClientReplyOff | ClientReplySkipNext | ClientNoTouch | ClientNoEvict)
+}
+
+func authCommand(c *Client) error {
+	NewConnCmd(c).Auth()
+	return nil
+}
+
+func helloCommand(c *Client) error {
+	NewConnCmd(c).Hello()
+	return nil
+}
+
+func pingCommand(c *Client) error {
+	NewConnCmd(c).Ping()
+	return nil
+}
+
+func quitCommand(c *Client) error {
+	NewConnCmd(c).Quit()
+	return nil
+}
+
+func resetCommand(c *Client) error {
+	NewConnCmd(c).Reset()
+	return nil
+}
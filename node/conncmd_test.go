@@ -0,0 +1,166 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	admin, adminConn := newTestClient()
+	defer freeClient(admin)
+	setTestUser(t, admin, adminConn, "alice", "on", ">secret", "~*", "+@all")
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"AUTH", "secret"}, "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?\r\n"},
+		{[]string{"AUTH", "alice", "wrong"}, "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{[]string{"AUTH", "nosuchuser", "secret"}, "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{[]string{"AUTH", "a", "b", "c"}, "-ERR syntax error\r\n"},
+		{[]string{"AUTH", "alice", "secret"}, "+OK\r\n"},
+		{[]string{"ACL", "WHOAMI"}, "$5\r\nalice\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	admin, adminConn := newTestClient()
+	defer freeClient(admin)
+	if got := sendCommand(admin, adminConn, "ACL", "SETUSER", "default", "resetpass", ">pass"); got != "+OK\r\n" {
+		t.Fatalf("ACL SETUSER replied %q", got)
+	}
+	// The admin is not authenticated anymore, restore the default user directly.
+	defer ACLSetUser(defaultUser, "nopass")
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"GET", "k"}, "-NOAUTH Authentication required.\r\n"},
+		{[]string{"HELLO", "3"}, "-NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time\r\n"},
+		{[]string{"AUTH", "wrong"}, "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{[]string{"AUTH", "pass"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestHello(t *testing.T) {
+	admin, adminConn := newTestClient()
+	defer freeClient(admin)
+	setTestUser(t, admin, adminConn, "bob", "on", ">pw", "~*", "+@all")
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"HELLO", "x"}, "-ERR Protocol version is not an integer or out of range\r\n"},
+		{[]string{"HELLO", "4"}, "-NOPROTO unsupported protocol version\r\n"},
+		{[]string{"HELLO", "3", "FOO"}, "-ERR Syntax error in HELLO option 'FOO'\r\n"},
+		{[]string{"HELLO", "3", "AUTH", "bob", "bad"}, "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{[]string{"HELLO", "3", "SETNAME", "bad name"}, "-ERR Client names cannot contain spaces, newlines or special characters.\r\n"},
+		{[]string{"GET", "hello:k"}, "$-1\r\n"},
+		{[]string{"HELLO", "3", "AUTH", "bob", "pw", "SETNAME", "conn1"}, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$11\r\n" + RedisVersion + "\r\n" +
+			"$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:" + strconv.FormatUint(c.id, 10) + "\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"},
+		{[]string{"GET", "hello:k"}, "_\r\n"},
+		{[]string{"ACL", "WHOAMI"}, "$3\r\nbob\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if c.name != "conn1" {
+		t.Fatalf("client name is %q", c.name)
+	}
+
+	// RESP2 clients get the map flattened in an array.
+	if got := sendCommand(c, conn, "HELLO", "2"); !strings.HasPrefix(got, "*14\r\n$6\r\nserver\r\n") {
+		t.Fatalf("HELLO 2 replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "hello:k"); got != "$-1\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG\r\n"},
+		{[]string{"PING", "hello"}, "$5\r\nhello\r\n"},
+		{[]string{"PING", "a", "b"}, "-ERR wrong number of arguments for 'ping' command\r\n"},
+		// In the Pub/Sub mode RESP2 clients get an array.
+		{[]string{"SUBSCRIBE", "ping:ch"}, "*3\r\n$9\r\nsubscribe\r\n$7\r\nping:ch\r\n:1\r\n"},
+		{[]string{"PING"}, "*2\r\n$4\r\npong\r\n$0\r\n\r\n"},
+		{[]string{"PING", "hello"}, "*2\r\n$4\r\npong\r\n$5\r\nhello\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestQuit(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "QUIT"); got != "+OK\r\n" {
+		t.Fatalf("QUIT replied %q", got)
+	}
+	if c.flags&ClientCloseAfterReply == 0 {
+		t.Fatalf("the connection is not closed")
+	}
+}
+
+func TestReset(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	for _, args := range [][]string{
+		{"SELECT", "1"},
+		{"CLIENT", "SETNAME", "before-reset"},
+		{"CLIENT", "TRACKING", "on"},
+		{"HELLO", "3"},
+		{"SUBSCRIBE", "reset:ch"},
+		{"MULTI"},
+	} {
+		sendCommand(c, conn, args...)
+	}
+	if got := sendCommand(c, conn, "RESET"); got != "+RESET\r\n" {
+		t.Fatalf("RESET replied %q", got)
+	}
+	if c.db.GetID() != 0 || c.name != "" || c.resp != 2 || c.pubsubChannels.Len() != 0 {
+		t.Errorf("the connection state is not reset")
+	}
+	if c.flags&(ClientMulti|ClientTracking|ClientPubSub) != 0 {
+		t.Errorf("client flags %b", c.flags)
+	}
+	if got := sendCommand(c, conn, "PING"); got != "+PONG\r\n" {
+		t.Errorf("PING replied %q", got)
+	}
+}
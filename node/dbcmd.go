@@ -0,0 +1,166 @@
+package node
+
+import (
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/*-----------------------------------------------------------------------------
+ * Keyspace commands: DEL, UNLINK, SELECT, FLUSHDB, FLUSHALL, SWAPDB
+ *----------------------------------------------------------------------------*/
+
+// selectDb switches the client to the given DB, false is returned if the id
+// is out of range.
+func (c *Client) selectDb(id int64) bool {
+	if id < 0 || id >= int64(len(server.db)) {
+		return false
+	}
+	c.db = server.db[id]
+	return true
+}
+
+// DbCmd handles the commands operating on whole databases.
+type DbCmd struct {
+	c *Client
+}
+
+// NewDbCmd returns a new DbCmd.
+func NewDbCmd(c *Client) *DbCmd {
+	return &DbCmd{c: c}
+}
+
+// delGeneric deletes the keys of DEL and UNLINK, the values are freed by
+// the lazyfree worker when lazy is true. The number of keys removed is
+// replied.
+func (cmd *DbCmd) delGeneric(lazy bool) {
+	numdel := int64(0)
+	for j := 1; j < cmd.c.argc; j++ {
+		key := cmd.c.argv[j].Value.(string)
+		cmd.c.db.ExpireIfNeeded(key)
+		var deleted bool
+		if lazy {
+			deleted = cmd.c.db.AsyncDelete(key)
+		} else {
+			deleted = cmd.c.db.GenericDelete(key)
+		}
+		if deleted {
+			signalModifiedKey(cmd.c.db, key)
+			notifyKeyspaceEvent(db.NotifyGeneric, "del", key, cmd.c.db.GetID())
+			server.dirty++
+			numdel++
+		}
+	}
+	cmd.c.addReplyLongLong(numdel)
+}
+
+// Del implements DEL key [key ...]
+func (cmd *DbCmd) Del() {
+	cmd.delGeneric(server.lazyfreeLazyUserDel)
+}
+
+// Unlink implements UNLINK key [key ...]
+func (cmd *DbCmd) Unlink() {
+	cmd.delGeneric(true)
+}
+
+// Select implements SELECT index
+func (cmd *DbCmd) Select() {
+	id, ok := cmd.c.getLongLongFromObjectOrReply(cmd.c.argv[1], "invalid DB index")
+	if !ok {
+		return
+	}
+	if !cmd.c.selectDb(id) {
+		cmd.c.AddReplyError("DB index is out of range")
+		return
+	}
+	cmd.c.AddReply(SharedOk)
+}
+
+// FlushDb implements FLUSHDB [ASYNC|SYNC]
+func (cmd *DbCmd) FlushDb() {
+	flags, ok := cmd.getFlushCommandFlags()
+	if !ok {
+		return
+	}
+	server.dirty += uint64(server.emptyData(int(cmd.c.db.GetID()), flags))
+	cmd.c.AddReply(SharedOk)
+}
+
+// FlushAll implements FLUSHALL [ASYNC|SYNC]
+func (cmd *DbCmd) FlushAll() {
+	flags, ok := cmd.getFlushCommandFlags()
+	if !ok {
+		return
+	}
+	server.dirty += uint64(server.emptyData(-1, flags))
+	cmd.c.AddReply(SharedOk)
+}
+
+// getFlushCommandFlags parses the optional ASYNC|SYNC argument of the FLUSH
+// commands, replying with a syntax error if it is invalid.
+func (cmd *DbCmd) getFlushCommandFlags() (EmptyDbFlags, bool) {
+	if cmd.c.argc == 1 {
+		return EmptyDbNoFlags, true
+	}
+	if cmd.c.argc == 2 {
+		switch strings.ToLower(cmd.c.argv[1].Value.(string)) {
+		case "sync":
+			return EmptyDbNoFlags, true
+		case "async":
+			return EmptyDbAsync, true
+		}
+	}
+	cmd.c.addReplyErrorObject(SharedSyntaxErr)
+	return 0, false
+}
+
+// SwapDb implements SWAPDB index1 index2
+func (cmd *DbCmd) SwapDb() {
+	id1, ok := cmd.c.getLongLongFromObjectOrReply(cmd.c.argv[1], "invalid first DB index")
+	if !ok {
+		return
+	}
+	id2, ok := cmd.c.getLongLongFromObjectOrReply(cmd.c.argv[2], "invalid second DB index")
+	if !ok {
+		return
+	}
+
+	// Swap...
+	if !server.dbSwapDatabases(id1, id2) {
+		cmd.c.AddReplyError("DB index is out of range")
+		return
+	}
+	server.dirty++
+	cmd.c.AddReply(SharedOk)
+}
+
+func delCommand(c *Client) error {
+	NewDbCmd(c).Del()
+	return nil
+}
+
+func unlinkCommand(c *Client) error {
+	NewDbCmd(c).Unlink()
+	return nil
+}
+
+func selectCommand(c *Client) error {
+	NewDbCmd(c).Select()
+	return nil
+}
+
+func flushdbCommand(c *Client) error {
+	NewDbCmd(c).FlushDb()
+	return nil
+}
+
+func flushallCommand(c *Client) error {
+	NewDbCmd(c).FlushAll()
+	return nil
+}
+
+func swapdbCommand(c *Client) error {
+	NewDbCmd(c).SwapDb()
+	return nil
+}
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+func TestDelAndUnlink(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	for _, cmd := range []string{"del", "unlink"} {
+		sendCommand(c, conn, "SET", "a", "1")
+		sendCommand(c, conn, "SET", "b", "2")
+		dirty := server.dirty
+		if got := sendCommand(c, conn, cmd, "a", "b", "c"); got != ":2\r\n" {
+			t.Errorf("%s replied %q", cmd, got)
+		}
+		if server.dirty != dirty+2 {
+			t.Errorf("%s added %d to dirty", cmd, server.dirty-dirty)
+		}
+		if got := sendCommand(c, conn, "GET", "a"); got != "$-1\r\n" {
+			t.Errorf("GET after %s replied %q", cmd, got)
+		}
+		if got := sendCommand(c, conn, cmd); got != "-ERR wrong number of arguments for '"+cmd+"' command\r\n" {
+			t.Errorf("%s without keys replied %q", cmd, got)
+		}
+	}
+
+	// The expired keys are not counted.
+	sendCommand(c, conn, "PSETEX", "a", "1", "1")
+	time.Sleep(2 * time.Millisecond)
+	if got := sendCommand(c, conn, "DEL", "a"); got != ":0\r\n" {
+		t.Errorf("DEL of an expired key replied %q", got)
+	}
+}
+
+func TestUnlinkLazyfree(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	list := db.NewList[string]()
+	for j := 0; j <= server.lazyfreeThreshold; j++ {
+		list.AddNodeTail(strconv.Itoa(j))
+	}
+	c.db.SetKey("list", &db.RedisObj{Type: db.ListType, Encoding: db.EncodingQuickList, Value: list}, 0)
+	freed := db.LazyfreedObjects()
+
+	if got := sendCommand(c, conn, "UNLINK", "list"); got != ":1\r\n" {
+		t.Fatalf("UNLINK replied %q", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for db.LazyfreePendingObjects() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := infoSections(t, c, conn, "memory")["Memory"]["lazyfree_pending_objects"]; got != "0" {
+		t.Errorf("lazyfree_pending_objects is %q", got)
+	}
+	want := strconv.FormatInt(freed+1, 10)
+	if got := infoSections(t, c, conn, "stats")["Stats"]["lazyfreed_objects"]; got != want {
+		t.Errorf("lazyfreed_objects is %q, want %s", got, want)
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	for _, args := range [][]string{{"FLUSHALL"}, {"FLUSHALL", "SYNC"}, {"FLUSHALL", "ASYNC"}} {
+		sendCommand(c, conn, "SELECT", "1")
+		sendCommand(c, conn, "SET", "a", "1")
+		sendCommand(c, conn, "SELECT", "0")
+		sendCommand(c, conn, "SET", "a", "1")
+		if got := sendCommand(c, conn, args...); got != "+OK\r\n" {
+			t.Errorf("%v replied %q", args, got)
+		}
+		for _, rdb := range server.db[:2] {
+			if rdb.Size() != 0 {
+				t.Errorf("%v left %d keys in DB %d", args, rdb.Size(), rdb.GetID())
+			}
+		}
+	}
+	if got := sendCommand(c, conn, "FLUSHALL", "LAZY"); got != "-ERR syntax error\r\n" {
+		t.Errorf("FLUSHALL LAZY replied %q", got)
+	}
+}
+
+func TestLazyfreeConfig(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer func() {
+		server.lazyfreeLazyUserDel = false
+		server.lazyfreeThreshold = db.LAZYFREE_THRESHOLD
+	}()
+
+	if got := sendCommand(c, conn, "CONFIG", "SET", "lazyfree-lazy-user-del", "yes", "lazyfree-threshold", "10"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET replied %q", got)
+	}
+	if !server.lazyfreeLazyUserDel || server.lazyfreeThreshold != 10 {
+		t.Errorf("lazyfree-lazy-user-del %v, lazyfree-threshold %d", server.lazyfreeLazyUserDel, server.lazyfreeThreshold)
+	}
+	want := "*2\r\n" + bulkString("lazyfree-lazy-expire") + bulkString("no")
+	if got := sendCommand(c, conn, "CONFIG", "GET", "lazyfree-lazy-expire"); got != want {
+		t.Errorf("CONFIG GET replied %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,734 @@
+package node
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/deps/lua"
+	"github.com/fzft/go-mock-redis/log"
+	"github.com/fzft/go-mock-redis/resp"
+	"go.uber.org/zap"
+)
+
+/* This file implements EVAL and the SCRIPT command: the Lua scripts are
+ * compiled once and cached by their SHA1, and run by the embedded Lua
+ * interpreter with the redis library (redis.call, redis.pcall, ...).
+ *
+ * The interpreter runs the script in its own goroutine, while the event loop
+ * waits for it: the commands called by the script are sent back to the event
+ * loop, which runs them, so that the script is atomic. The event loop also
+ * checks periodically if the script is busy, to serve the other clients and
+ * kill the script with SCRIPT KILL. */
+
+// LuaInterruptInterval is how often the event loop checks the running script.
+const LuaInterruptInterval = 10 * time.Millisecond
+
+// luaScript is a script of the scripts cache.
+type luaScript struct {
+	body  string
+	flags ScriptFlags
+	fn    *lua.LFunction
+}
+
+// luaCallRequest is a command called by the running script.
+type luaCallRequest struct {
+	args   []string
+	result chan luaCallResult
+}
+
+type luaCallResult struct {
+	reply resp.Node
+	err   error
+}
+
+// luaCtx is the Lua interpreter and the scripts cache.
+type luaCtx struct {
+	L       *lua.LState
+	redis   *lua.LTable                       // The redis library, read-only
+	globals *lua.LTable                       // Fields of the protected globals table
+	scripts *db.HashTable[string, *luaScript] // SHA1 -> script
+	calls   chan *luaCallRequest              // Commands called by the running script
+}
+
+// scriptingInit creates the Lua interpreter, with the libraries the scripts
+// may use and the redis library.
+func scriptingInit() *luaCtx {
+	lctx := &luaCtx{
+		L:       lua.NewState(lua.Options{SkipOpenLibs: true}),
+		scripts: db.NewHashTable[string, *luaScript](db.INITIAL_DB_SIZE),
+		calls:   make(chan *luaCallRequest),
+	}
+	L := lctx.L
+
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+		{lua.DebugLibName, lua.OpenDebug},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// The scripts can't access the file system.
+	L.SetGlobal("loadfile", lua.LNil)
+	L.SetGlobal("dofile", lua.LNil)
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call":               lctx.luaRedisCallCommand,
+		"pcall":              lctx.luaRedisPCallCommand,
+		"error_reply":        luaRedisErrorReplyCommand,
+		"status_reply":       luaRedisStatusReplyCommand,
+		"sha1hex":            luaRedisSha1hexCommand,
+		"log":                luaLogCommand,
+		"replicate_commands": luaRedisReplicateCommandsCommand,
+		"set_repl":           luaRedisSetReplCommand,
+	})
+	for name, value := range map[string]int{
+		"LOG_DEBUG": 0, "LOG_VERBOSE": 1, "LOG_NOTICE": 2, "LOG_WARNING": 3,
+		"REPL_NONE": 0, "REPL_AOF": 1, "REPL_SLAVE": 2, "REPL_REPLICA": 2, "REPL_ALL": 3,
+	} {
+		L.SetField(redis, name, lua.LNumber(value))
+	}
+	L.SetGlobal("redis", redis)
+	L.SetGlobal("KEYS", L.NewTable())
+	L.SetGlobal("ARGV", L.NewTable())
+
+	// The scripts can't change the redis library, nor create globals that
+	// would leak into the next scripts.
+	luaProtectTable(L, redis, false)
+	lctx.redis = redis
+	lctx.globals = luaProtectTable(L, L.G.Global, true)
+	return lctx
+}
+
+// luaProtectTable moves the fields of the table to a new table, which is
+// returned, and makes the table a read-only view of it: setting a field
+// raises an error. With globals, reading a missing field raises an error
+// too.
+func luaProtectTable(L *lua.LState, tbl *lua.LTable, globals bool) *lua.LTable {
+	fields := L.NewTable()
+	var keys []lua.LValue
+	tbl.ForEach(func(k, v lua.LValue) {
+		fields.RawSet(k, v)
+		keys = append(keys, k)
+	})
+	for _, k := range keys {
+		tbl.RawSet(k, lua.LNil)
+	}
+
+	mt := L.NewTable()
+	mt.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		v := fields.RawGet(L.Get(2))
+		if v == lua.LNil && globals {
+			L.RaiseError("Script attempted to access nonexistent global variable '%s'", L.ToStringMeta(L.Get(2)))
+		}
+		L.Push(v)
+		return 1
+	}))
+	mt.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		if globals && fields.RawGet(L.Get(2)) == lua.LNil {
+			L.RaiseError("Script attempted to create global variable '%s'", L.ToStringMeta(L.Get(2)))
+		}
+		L.RaiseError("Attempt to modify a readonly table")
+		return 0
+	}))
+	// The scripts can't remove the metatable.
+	mt.RawSetString("__metatable", lua.LFalse)
+	L.SetMetatable(tbl, mt)
+	return fields
+}
+
+// luaClearTable removes the fields a script set on a protected table with
+// rawset.
+func luaClearTable(tbl *lua.LTable) {
+	var keys []lua.LValue
+	tbl.ForEach(func(k, _ lua.LValue) {
+		keys = append(keys, k)
+	})
+	for _, k := range keys {
+		tbl.RawSet(k, lua.LNil)
+	}
+}
+
+// sha1hex returns the SHA1 of the script, as 40 lowercase hex chars.
+func sha1hex(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// evalExtractShebangFlags extracts the flags of the script from its shebang
+// line, like "#!lua flags=no-writes,allow-oom". The scripts without shebang
+// run in compatibility mode.
+func evalExtractShebangFlags(body string) (ScriptFlags, error) {
+	if !strings.HasPrefix(body, "#!") {
+		return ScriptFlagEvalCompatMode, nil
+	}
+
+	end := strings.IndexByte(body, '\n')
+	if end == -1 {
+		return 0, fmt.Errorf("Invalid script shebang")
+	}
+	parts := strings.Fields(body[2:end])
+	if len(parts) == 0 || parts[0] != "lua" {
+		engine := ""
+		if len(parts) > 0 {
+			engine = parts[0]
+		}
+		return 0, fmt.Errorf("Unexpected engine in script shebang: %s", engine)
+	}
+
+	var flags ScriptFlags
+	for _, part := range parts[1:] {
+		if !strings.HasPrefix(part, "flags=") {
+			return 0, fmt.Errorf("Unknown lua shebang option: %s", part)
+		}
+		for _, name := range strings.Split(strings.TrimPrefix(part, "flags="), ",") {
+			if name == "" {
+				continue
+			}
+			found := false
+			for _, def := range scriptFlagsDef {
+				if def.name == name {
+					flags |= def.flag
+					found = true
+					break
+				}
+			}
+			if !found {
+				return 0, fmt.Errorf("Unexpected flag in script shebang: %s", name)
+			}
+		}
+	}
+	return flags, nil
+}
+
+// luaCreateFunction compiles the script and adds it to the cache, it returns
+// the SHA1 of the script. The caller is replied with an error on failure.
+func (lctx *luaCtx) luaCreateFunction(c *Client, body string) (string, bool) {
+	sha := sha1hex(body)
+	if _, exist := lctx.scripts.Get(sha); exist {
+		return sha, true
+	}
+
+	flags, err := evalExtractShebangFlags(body)
+	if err != nil {
+		c.AddReplyError(err.Error())
+		return "", false
+	}
+
+	// The shebang line is turned into a comment to preserve the line numbers.
+	code := body
+	if strings.HasPrefix(code, "#!") {
+		code = "--" + code[2:]
+	}
+	fn, err := lctx.L.Load(strings.NewReader(code), "@user_script")
+	if err != nil {
+		c.addReplyErrorFormat(fmt.Sprintf("Error compiling script (new function): %s", luaErrorMessage(err)))
+		return "", false
+	}
+
+	lctx.scripts.Set(sha, &luaScript{body: body, flags: flags, fn: fn})
+	return sha, true
+}
+
+// luaErrorMessage returns the message of an error raised by the interpreter.
+func luaErrorMessage(err error) string {
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		if s, ok := apiErr.Object.(lua.LString); ok {
+			return string(s)
+		}
+		return apiErr.Object.String()
+	}
+	return err.Error()
+}
+
+// luaCallFunction runs the script in the interpreter goroutine, and serves
+// the commands it calls until it returns. The caller is replied with the
+// value returned by the script.
+func (lctx *luaCtx) luaCallFunction(runCtx *ScriptRunCtx, c *Client, script *luaScript, keys, args []string) {
+	L := lctx.L
+	lctx.globals.RawSetString("KEYS", luaStringsToTable(L, keys))
+	lctx.globals.RawSetString("ARGV", luaStringsToTable(L, args))
+	defer func() {
+		luaClearTable(L.G.Global)
+		luaClearTable(lctx.redis)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	done := make(chan error, 1)
+	go func() {
+		L.Push(script.fn)
+		done <- L.PCall(0, 1, nil)
+	}()
+
+	ticker := time.NewTicker(LuaInterruptInterval)
+	defer ticker.Stop()
+
+	var err error
+	for running := true; running; {
+		select {
+		case call := <-lctx.calls:
+			reply, err := scriptCall(runCtx, call.args)
+			call.result <- luaCallResult{reply: reply, err: err}
+		case <-ticker.C:
+			if scriptInterrupt(runCtx) {
+				cancel()
+			}
+		case err = <-done:
+			running = false
+		}
+	}
+
+	if runCtx.flags&scriptKilled != 0 {
+		L.SetTop(0)
+		log.Logger.Info("Lua script killed by user with SCRIPT KILL.")
+		c.addReplyScriptValue(runCtx.killedError())
+		return
+	}
+	if err != nil {
+		L.SetTop(0)
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if tbl, ok := apiErr.Object.(*lua.LTable); ok {
+				if msg, ok := tbl.RawGetString("err").(lua.LString); ok {
+					c.addReplyScriptValue(ReplyError(msg))
+					return
+				}
+			}
+		}
+		c.addReplyErrorFormat(fmt.Sprintf("Error running script (call to f_%s): @%s", sha1hex(script.body), luaErrorMessage(err)))
+		return
+	}
+
+	ret := L.Get(-1)
+	L.SetTop(0)
+	c.addReplyScriptValue(luaToScriptValue(ret))
+}
+
+// luaStringsToTable returns a Lua array of the strings.
+func luaStringsToTable(L *lua.LState, elems []string) *lua.LTable {
+	tbl := L.CreateTable(len(elems), 0)
+	for _, e := range elems {
+		tbl.Append(lua.LString(e))
+	}
+	return tbl
+}
+
+// luaToScriptValue converts the value returned by a script to the reply
+// values of addReplyScriptValue:
+//
+//	number  -> integer (the number is truncated)
+//	string  -> bulk string
+//	boolean -> true is 1, false is null
+//	table   -> {err=...} is an error, {ok=...} a status, any other table an
+//	           array of its elements up to the first nil
+//	nil     -> null
+func luaToScriptValue(lv lua.LValue) any {
+	switch v := lv.(type) {
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		return bool(v)
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return ReplyError(msg)
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return StatusReply(status)
+		}
+		values := make([]any, 0, v.Len())
+		for j := 1; ; j++ {
+			e := v.RawGetInt(j)
+			if e == lua.LNil {
+				break
+			}
+			values = append(values, luaToScriptValue(e))
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// respToLua converts the reply of a command called by the script to Lua:
+//
+//	integer          -> number
+//	bulk string      -> string
+//	status           -> table with a single ok field
+//	error            -> table with a single err field
+//	array            -> table
+//	null bulk, array -> false
+func respToLua(L *lua.LState, node resp.Node) lua.LValue {
+	switch n := node.(type) {
+	case resp.Integer:
+		return lua.LNumber(n.Value)
+	case resp.BlobString:
+		return lua.LString(n.Value)
+	case resp.SimpleString:
+		tbl := L.NewTable()
+		tbl.RawSetString("ok", lua.LString(n.Value))
+		return tbl
+	case resp.Error:
+		tbl := L.NewTable()
+		tbl.RawSetString("err", lua.LString(n.Message))
+		return tbl
+	case resp.Array:
+		tbl := L.CreateTable(len(n.Elements), 0)
+		for _, e := range n.Elements {
+			tbl.Append(respToLua(L, e))
+		}
+		return tbl
+	default:
+		return lua.LFalse
+	}
+}
+
+// luaRedisGenericCommand implements redis.call() and redis.pcall(), the
+// command is sent to the event loop and the reply converted to Lua. With
+// raiseError the errors are raised, otherwise returned as {err=...}.
+func (lctx *luaCtx) luaRedisGenericCommand(L *lua.LState, raiseError bool) int {
+	argc := L.GetTop()
+	if argc == 0 {
+		return luaReplyError(L, "Please specify at least one argument for this redis lib call", raiseError)
+	}
+	args := make([]string, 0, argc)
+	for j := 1; j <= argc; j++ {
+		switch v := L.Get(j).(type) {
+		case lua.LString:
+			args = append(args, string(v))
+		case lua.LNumber:
+			args = append(args, v.String())
+		default:
+			return luaReplyError(L, "Lua redis lib command arguments must be strings or integers", raiseError)
+		}
+	}
+
+	call := &luaCallRequest{args: args, result: make(chan luaCallResult, 1)}
+	lctx.calls <- call
+	result := <-call.result
+
+	if result.err != nil {
+		tbl := L.NewTable()
+		tbl.RawSetString("err", lua.LString(result.err.Error()))
+		if raiseError {
+			L.Error(tbl, 1)
+			return 0
+		}
+		L.Push(tbl)
+		return 1
+	}
+	reply := respToLua(L, result.reply)
+	if raiseError {
+		if tbl, ok := reply.(*lua.LTable); ok && tbl.RawGetString("err") != lua.LNil {
+			L.Error(tbl, 1)
+			return 0
+		}
+	}
+	L.Push(reply)
+	return 1
+}
+
+// luaReplyError raises or returns the error {err="ERR msg"}.
+func luaReplyError(L *lua.LState, msg string, raiseError bool) int {
+	tbl := L.NewTable()
+	tbl.RawSetString("err", lua.LString("ERR "+msg))
+	if raiseError {
+		L.Error(tbl, 1)
+		return 0
+	}
+	L.Push(tbl)
+	return 1
+}
+
+// luaRedisCallCommand implements redis.call()
+func (lctx *luaCtx) luaRedisCallCommand(L *lua.LState) int {
+	return lctx.luaRedisGenericCommand(L, true)
+}
+
+// luaRedisPCallCommand implements redis.pcall()
+func (lctx *luaCtx) luaRedisPCallCommand(L *lua.LState) int {
+	return lctx.luaRedisGenericCommand(L, false)
+}
+
+// luaRedisErrorReplyCommand implements redis.error_reply()
+func luaRedisErrorReplyCommand(L *lua.LState) int {
+	msg := strings.TrimPrefix(L.CheckString(1), "-")
+	tbl := L.NewTable()
+	tbl.RawSetString("err", lua.LString(msg))
+	L.Push(tbl)
+	return 1
+}
+
+// luaRedisStatusReplyCommand implements redis.status_reply()
+func luaRedisStatusReplyCommand(L *lua.LState) int {
+	tbl := L.NewTable()
+	tbl.RawSetString("ok", lua.LString(L.CheckString(1)))
+	L.Push(tbl)
+	return 1
+}
+
+// luaRedisSha1hexCommand implements redis.sha1hex()
+func luaRedisSha1hexCommand(L *lua.LState) int {
+	if L.GetTop() != 1 {
+		L.RaiseError("wrong number of arguments")
+		return 0
+	}
+	L.Push(lua.LString(sha1hex(L.ToString(1))))
+	return 1
+}
+
+// luaLogCommand implements redis.log()
+func luaLogCommand(L *lua.LState) int {
+	argc := L.GetTop()
+	if argc < 2 {
+		L.RaiseError("redis.log() requires two arguments or more.")
+		return 0
+	}
+	level := L.CheckInt(1)
+	if level < 0 || level > 3 {
+		L.RaiseError("Invalid debug level.")
+		return 0
+	}
+	parts := make([]string, 0, argc-1)
+	for j := 2; j <= argc; j++ {
+		parts = append(parts, L.ToStringMeta(L.Get(j)).String())
+	}
+	msg := strings.Join(parts, " ")
+	switch level {
+	case 0, 1:
+		log.Logger.Debug(msg, zap.String("source", "lua"))
+	case 2:
+		log.Logger.Info(msg, zap.String("source", "lua"))
+	default:
+		log.Logger.Warn(msg, zap.String("source", "lua"))
+	}
+	return 0
+}
+
+// luaRedisReplicateCommandsCommand implements redis.replicate_commands(),
+// the effects are always replicated.
+func luaRedisReplicateCommandsCommand(L *lua.LState) int {
+	L.Push(lua.LTrue)
+	return 1
+}
+
+// luaRedisSetReplCommand implements redis.set_repl(), there is no
+// replication so it has no effect.
+func luaRedisSetReplCommand(L *lua.LState) int {
+	flags := L.CheckInt(1)
+	if flags < 0 || flags > 3 {
+		L.RaiseError("Invalid replication flags. Use REPL_AOF, REPL_REPLICA, REPL_ALL or REPL_NONE.")
+	}
+	return 0
+}
+
+/*-----------------------------------------------------------------------------
+ * EVAL / SCRIPT commands entry point
+ *----------------------------------------------------------------------------*/
+
+// EvalCmd handles the EVAL family and the SCRIPT command.
+type EvalCmd struct {
+	c *Client
+}
+
+// NewEvalCmd returns a new EvalCmd.
+func NewEvalCmd(c *Client) *EvalCmd {
+	return &EvalCmd{c: c}
+}
+
+// evalGeneric implements EVAL, EVALSHA, EVAL_RO and EVALSHA_RO
+func (cmd *EvalCmd) evalGeneric(evalsha, ro bool) {
+	c := cmd.c
+	lctx := server.lua
+
+	numkeys, ok := c.getLongLongFromObjectOrReply(c.argv[2], "")
+	if !ok {
+		return
+	}
+	if numkeys > int64(c.argc-3) {
+		c.AddReplyError("Number of keys can't be greater than number of args")
+		return
+	} else if numkeys < 0 {
+		c.AddReplyError("Number of keys can't be negative")
+		return
+	}
+
+	var sha string
+	if evalsha {
+		// We already have the SHA if it is an EVALSHA
+		sha = strings.ToLower(c.argv[1].Value.(string))
+	} else {
+		// Compile the script if it is not already in the cache
+		if sha, ok = lctx.luaCreateFunction(c, c.argv[1].Value.(string)); !ok {
+			return
+		}
+	}
+	script, exist := lctx.scripts.Get(sha)
+	if !exist {
+		c.addReplyErrorObject(SharedNoScriptErr)
+		return
+	}
+
+	keys := make([]string, 0, numkeys)
+	for j := 3; j < 3+int(numkeys); j++ {
+		keys = append(keys, c.argv[j].Value.(string))
+	}
+	args := make([]string, 0, c.argc-3-int(numkeys))
+	for j := 3 + int(numkeys); j < c.argc; j++ {
+		args = append(args, c.argv[j].Value.(string))
+	}
+
+	runCtx := &ScriptRunCtx{}
+	if !scriptPrepareForRun(runCtx, c, "f_"+sha, script.flags, ro) {
+		return
+	}
+	runCtx.flags |= scriptEvalMode
+	lctx.luaCallFunction(runCtx, c, script, keys, args)
+	scriptResetRun(runCtx)
+}
+
+// Eval implements EVAL script numkeys [key ...] [arg ...]
+func (cmd *EvalCmd) Eval() {
+	cmd.evalGeneric(false, false)
+}
+
+// EvalRo implements EVAL_RO script numkeys [key ...] [arg ...]
+func (cmd *EvalCmd) EvalRo() {
+	cmd.evalGeneric(false, true)
+}
+
+// EvalSha implements EVALSHA sha1 numkeys [key ...] [arg ...]
+func (cmd *EvalCmd) EvalSha() {
+	if len(cmd.c.argv[1].Value.(string)) != 40 {
+		// We know that a match is not possible if the provided SHA is
+		// not the right length. So we return an error ASAP.
+		cmd.c.addReplyErrorObject(SharedNoScriptErr)
+		return
+	}
+	cmd.evalGeneric(true, false)
+}
+
+// EvalShaRo implements EVALSHA_RO sha1 numkeys [key ...] [arg ...]
+func (cmd *EvalCmd) EvalShaRo() {
+	if len(cmd.c.argv[1].Value.(string)) != 40 {
+		cmd.c.addReplyErrorObject(SharedNoScriptErr)
+		return
+	}
+	cmd.evalGeneric(true, true)
+}
+
+// ScriptLoad implements SCRIPT LOAD script
+func (cmd *EvalCmd) ScriptLoad() {
+	sha, ok := server.lua.luaCreateFunction(cmd.c, cmd.c.argv[2].Value.(string))
+	if !ok {
+		return
+	}
+	cmd.c.addReplyBulkCString(sha)
+}
+
+// ScriptExists implements SCRIPT EXISTS sha1 [sha1 ...]
+func (cmd *EvalCmd) ScriptExists() {
+	cmd.c.addReplyArrayLen(cmd.c.argc - 2)
+	for j := 2; j < cmd.c.argc; j++ {
+		if _, exist := server.lua.scripts.Get(strings.ToLower(cmd.c.argv[j].Value.(string))); exist {
+			cmd.c.AddReply(SharedCone)
+		} else {
+			cmd.c.AddReply(SharedZCone)
+		}
+	}
+}
+
+// ScriptFlush implements SCRIPT FLUSH [ASYNC|SYNC]
+// The scripts cache is emptied and the Lua interpreter recreated.
+func (cmd *EvalCmd) ScriptFlush() {
+	if cmd.c.argc == 3 {
+		arg := cmd.c.argv[2].Value.(string)
+		if !strings.EqualFold(arg, "sync") && !strings.EqualFold(arg, "async") {
+			cmd.c.AddReplyError("SCRIPT FLUSH only support SYNC|ASYNC option")
+			return
+		}
+	}
+	server.lua.L.Close()
+	server.lua = scriptingInit()
+	cmd.c.AddReply(SharedOk)
+}
+
+// ScriptKill implements SCRIPT KILL
+func (cmd *EvalCmd) ScriptKill() {
+	scriptKill(cmd.c, true)
+}
+
+// ScriptHelp implements SCRIPT HELP
+func (cmd *EvalCmd) ScriptHelp() {
+	cmd.c.addReplyHelp([]string{
+		"EXISTS <sha1> [<sha1> ...]",
+		"    Return information about the existence of the scripts in the script cache.",
+		"FLUSH [ASYNC|SYNC]",
+		"    Flush the Lua scripts cache.",
+		"KILL",
+		"    Kill the currently executing Lua script.",
+		"LOAD <script>",
+		"    Load a script into the scripts cache without executing it.",
+	})
+}
+
+func evalCommand(c *Client) error {
+	NewEvalCmd(c).Eval()
+	return nil
+}
+
+func evalRoCommand(c *Client) error {
+	NewEvalCmd(c).EvalRo()
+	return nil
+}
+
+func evalShaCommand(c *Client) error {
+	NewEvalCmd(c).EvalSha()
+	return nil
+}
+
+func evalShaRoCommand(c *Client) error {
+	NewEvalCmd(c).EvalShaRo()
+	return nil
+}
+
+func scriptLoadCommand(c *Client) error {
+	NewEvalCmd(c).ScriptLoad()
+	return nil
+}
+
+func scriptExistsCommand(c *Client) error {
+	NewEvalCmd(c).ScriptExists()
+	return nil
+}
+
+func scriptFlushCommand(c *Client) error {
+	NewEvalCmd(c).ScriptFlush()
+	return nil
+}
+
+func scriptKillCommand(c *Client) error {
+	NewEvalCmd(c).ScriptKill()
+	return nil
+}
+
+func scriptHelpCommand(c *Client) error {
+	NewEvalCmd(c).ScriptHelp()
+	return nil
+}
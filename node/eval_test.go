@@ -0,0 +1,163 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"EVAL", "return redis.call('SET', KEYS[1], ARGV[1])", "1", "ev:a", "1"}, "+OK\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', KEYS[1])", "1", "ev:a"}, "$1\r\n1\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', 'ev:nosuchkey')", "0"}, "$-1\r\n"},
+		{[]string{"EVAL", "return {1, 'two', 3.9, true, false, 'after', nil, 'ignored'}", "0"}, "*6\r\n:1\r\n$3\r\ntwo\r\n:3\r\n:1\r\n$-1\r\n$5\r\nafter\r\n"},
+		{[]string{"EVAL", "return redis.status_reply('FINE')", "0"}, "+FINE\r\n"},
+		{[]string{"EVAL", "return redis.error_reply('MY error')", "0"}, "-MY error\r\n"},
+		{[]string{"EVAL", "return redis.pcall('GET', 'ev:a', 'x')['err']", "0"}, "$58\r\nERR Wrong number of args calling Redis command from script\r\n"},
+		{[]string{"EVAL", "return redis.call('NOSUCHCOMMAND')", "0"}, "-ERR Unknown Redis command called from script\r\n"},
+		{[]string{"EVAL", "return redis.sha1hex('')", "0"}, "$40\r\nda39a3ee5e6b4b0d3255bfef95601890afd80709\r\n"},
+		{[]string{"EVAL", "return {KEYS[1], ARGV[1], #ARGV}", "1", "k", "a", "b"}, "*3\r\n$1\r\nk\r\n$1\r\na\r\n:2\r\n"},
+		{[]string{"EVAL", "return 1", "2", "k"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"EVAL", "return 1", "-1"}, "-ERR Number of keys can't be negative\r\n"},
+		{[]string{"EVAL", "return dofile('/etc/passwd')", "0"}, "-ERR Error running script (call to f_"},
+		{[]string{"EVAL", "return (", "0"}, "-ERR Error compiling script (new function): "},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if server.scriptRunCtx != nil {
+		t.Fatal("run context not reset")
+	}
+}
+
+func TestEvalGlobalsProtection(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		script string
+		want   string
+	}{
+		{"leak = 42", "Script attempted to create global variable 'leak'"},
+		{"return leak", "Script attempted to access nonexistent global variable 'leak'"},
+		{"redis = nil; return 1", "Attempt to modify a readonly table"},
+		{"redis.call = nil; return 1", "Attempt to modify a readonly table"},
+		{"setmetatable(_G, nil)", "cannot change a protected metatable"},
+		{"rawset(_G, 'leak', 42); rawset(redis, 'call', 1); return 1", ""},
+	}
+	for _, tc := range cases {
+		got := sendCommand(c, conn, "EVAL", tc.script, "0")
+		if tc.want != "" && (!strings.HasPrefix(got, "-ERR Error running script") || !strings.Contains(got, tc.want)) {
+			t.Errorf("%q replied %q, want %q", tc.script, got, tc.want)
+		}
+	}
+
+	// Nothing leaked into the next script.
+	if got := sendCommand(c, conn, "EVAL", "return leak", "0"); !strings.Contains(got, "nonexistent global variable 'leak'") {
+		t.Errorf("the global leaked: %q", got)
+	}
+	if got := sendCommand(c, conn, "EVAL", "return redis.call('SET', KEYS[1], 'v')", "1", "ev:g"); got != "+OK\r\n" {
+		t.Errorf("redis.call replied %q", got)
+	}
+}
+
+func TestEvalReadOnly(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"EVAL_RO", "return redis.call('GET', KEYS[1])", "1", "ev:ro"}, "$-1\r\n"},
+		{[]string{"EVAL_RO", "return redis.call('SET', KEYS[1], 'v')", "1", "ev:ro"}, "-ERR Write commands are not allowed from read-only scripts.\r\n"},
+		{[]string{"EVAL", "#!lua flags=no-writes\nreturn redis.call('SET', KEYS[1], 'v')", "1", "ev:ro"}, "-ERR Write commands are not allowed from read-only scripts.\r\n"},
+		{[]string{"EVAL_RO", "#!lua\nreturn 1", "0"}, "-ERR Can not execute a script with write flag using *_ro command.\r\n"},
+		{[]string{"EVAL", "#!lua flags=no-such-flag\nreturn 1", "0"}, "-ERR Unexpected flag in script shebang: no-such-flag\r\n"},
+		{[]string{"EVAL", "#!python\nreturn 1", "0"}, "-ERR Unexpected engine in script shebang: python\r\n"},
+		{[]string{"EVAL", "#!lua name=x\nreturn 1", "0"}, "-ERR Unknown lua shebang option: name=x\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestScriptCache(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	body := "return ARGV[1]"
+	sha := sha1hex(body)
+	if got := sendCommand(c, conn, "EVALSHA", sha, "0", "x"); got != "-NOSCRIPT No matching script. Please use EVAL.\r\n" {
+		t.Fatalf("EVALSHA replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SCRIPT", "LOAD", body); got != "$40\r\n"+sha+"\r\n" {
+		t.Fatalf("SCRIPT LOAD replied %q", got)
+	}
+	if got := sendCommand(c, conn, "EVALSHA", strings.ToUpper(sha), "0", "x"); got != "$1\r\nx\r\n" {
+		t.Fatalf("EVALSHA replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SCRIPT", "EXISTS", sha, "0000"); got != "*2\r\n:1\r\n:0\r\n" {
+		t.Fatalf("SCRIPT EXISTS replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SCRIPT", "FLUSH", "LAZY"); got != "-ERR SCRIPT FLUSH only support SYNC|ASYNC option\r\n" {
+		t.Fatalf("SCRIPT FLUSH replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SCRIPT", "FLUSH"); got != "+OK\r\n" {
+		t.Fatalf("SCRIPT FLUSH replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SCRIPT", "EXISTS", sha); got != "*1\r\n:0\r\n" {
+		t.Fatalf("SCRIPT EXISTS replied %q", got)
+	}
+}
+
+func TestEvalBusyAndKill(t *testing.T) {
+	oldThreshold := server.busyReplyThreshold
+	server.busyReplyThreshold = 0
+	defer func() {
+		server.busyReplyThreshold = oldThreshold
+		server.reactor = nil
+	}()
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	var busyReplies []string
+	server.reactor = &testReactor{onBlocked: func() {
+		busyReplies = append(busyReplies, sendCommand(other, otherConn, "GET", "ev:busy"))
+		busyReplies = append(busyReplies, sendCommand(other, otherConn, "FUNCTION", "KILL"))
+		busyReplies = append(busyReplies, sendCommand(other, otherConn, "SCRIPT", "KILL"))
+	}}
+
+	if got := sendCommand(c, conn, "EVAL", "while true do end", "0"); got != "-ERR Script killed by user with SCRIPT KILL...\r\n" {
+		t.Fatalf("killed EVAL replied %q", got)
+	}
+	want := []string{
+		"-BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.\r\n",
+		"-NOTBUSY No scripts in execution right now.\r\n",
+		"+OK\r\n",
+	}
+	for i, w := range want {
+		if busyReplies[i] != w {
+			t.Fatalf("reply %d while busy is %q, want %q", i, busyReplies[i], w)
+		}
+	}
+	if c.flags&ClientProtected != 0 {
+		t.Fatal("caller still protected")
+	}
+	if got := sendCommand(c, conn, "EVAL", "return 1", "0"); got != ":1\r\n" {
+		t.Fatalf("EVAL after kill replied %q", got)
+	}
+}
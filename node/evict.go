@@ -0,0 +1,162 @@
+package node
+
+import (
+	"math"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* ----------------------------------------------------------------------------
+ * Maxmemory eviction.
+ *
+ * When the used memory is over the maxmemory limit, the keys are evicted
+ * according to the maxmemory policy before the commands are executed. The
+ * LRU, LFU and TTL policies pick the best key from a pool of samples shared
+ * by all the DBs, the random policies pick a random key of the next DB.
+ * --------------------------------------------------------------------------*/
+
+// maxmemoryPolicyEnum maps the names of the maxmemory-policy config to the
+// policies.
+var maxmemoryPolicyEnum = []configEnum{
+	{"volatile-lru", db.MAXMEMORY_VOLATILE_LRU},
+	{"volatile-lfu", db.MAXMEMORY_VOLATILE_LFU},
+	{"volatile-random", db.MAXMEMORY_VOLATILE_RANDOM},
+	{"volatile-ttl", db.MAXMEMORY_VOLATILE_TTL},
+	{"allkeys-lru", db.MAXMEMORY_ALLKEYS_LRU},
+	{"allkeys-lfu", db.MAXMEMORY_ALLKEYS_LFU},
+	{"allkeys-random", db.MAXMEMORY_ALLKEYS_RANDOM},
+	{"noeviction", db.MAXMEMORY_NO_EVICTION},
+}
+
+// maxmemoryPolicyName returns the name of the maxmemory policy.
+func maxmemoryPolicyName(policy int) string {
+	for _, e := range maxmemoryPolicyEnum {
+		if e.val == policy {
+			return e.name
+		}
+	}
+	return "unknown"
+}
+
+// evictionTimeLimitUs returns the max time, in microseconds, a single call
+// of performEvictions may spend evicting keys. The time limit grows with the
+// maxmemory-eviction-tenacity, up to no limit at all for 100.
+func evictionTimeLimitUs() int64 {
+	tenacity := server.maxmemoryEvictionTenacity
+	if tenacity <= 10 {
+		// A linear progression from 0..500us
+		return 50 * int64(tenacity)
+	}
+	if tenacity < 100 {
+		// A 15% geometric progression, resulting in a limit of ~2 min at tenacity==99
+		return int64(500.0 * math.Pow(1.15, float64(tenacity)-10.0))
+	}
+	return math.MaxInt64 // No limit to eviction time
+}
+
+// isSafeToPerformEvictions reports whether the keys can be evicted now. The
+// keys are not evicted while a script runs, or while the clients are paused
+// since the dataset must not change.
+func isSafeToPerformEvictions() bool {
+	if isInsideYieldingLongCommand() || server.scriptRunCtx != nil {
+		return false
+	}
+	return !server.areClientsPaused()
+}
+
+// evictionTimeProc continues the eviction from the cron, once the previous
+// call of performEvictions reached its time limit.
+func evictionTimeProc() {
+	if performEvictions() != db.EvictRunning {
+		// For EvictOk - things are good, no need to keep evicting.
+		// For EvictFail - there is nothing left to evict.
+		server.evictionInProgress = false
+	}
+}
+
+// performEvictions is called before executing a command, it evicts keys,
+// according to the maxmemory policy, until the used memory is under the
+// maxmemory limit or the time limit is reached.
+//
+// It returns:
+//
+//	EvictOk      - the memory is OK or it's not possible to perform evictions now
+//	EvictRunning - memory is over the limit, but eviction is still processing
+//	EvictFail    - memory is over the limit, and there's nothing to evict
+func performEvictions() db.EvictStatus {
+	if !isSafeToPerformEvictions() {
+		return db.EvictOk
+	}
+
+	status, ok := db.GetMaxmemoryState(server.maxmemory)
+	if ok {
+		return db.EvictOk
+	}
+	if server.maxmemoryPolicy == db.MAXMEMORY_NO_EVICTION {
+		return db.EvictFail // We need to free memory, but policy forbids.
+	}
+
+	start := time.Now()
+	timeLimit := evictionTimeLimitUs()
+	policy := server.maxmemoryPolicy
+	var memFreed, keysFreed int64
+	timedOut := false
+	for memFreed < status.ToFree {
+		var (
+			bestkey  string
+			bestdbid int
+			found    bool
+		)
+		if policy&(db.MAXMEMORY_FLAG_LRU|db.MAXMEMORY_FLAG_LFU) != 0 || policy == db.MAXMEMORY_VOLATILE_TTL {
+			bestkey, bestdbid, found = server.evictionPool.BestKey(server.db, policy, server.maxmemorySamples)
+		} else {
+			// When evicting a random key, we try to evict a key for each DB,
+			// so we use the 'nextEvictDb' field of the server to incrementally
+			// visit all DBs.
+			for i := 0; i < len(server.db) && !found; i++ {
+				server.nextEvictDb = (server.nextEvictDb + 1) % len(server.db)
+				bestdbid = server.nextEvictDb
+				bestkey, found = server.db[bestdbid].RandomEvictionKey(policy)
+			}
+		}
+		if !found {
+			break // Nothing to free...
+		}
+
+		/* We compute the amount of memory freed by EvictKey() alone.
+		 * It is possible that actually the memory needed to propagate
+		 * the DEL in AOF and replication link is greater than the one
+		 * we are freeing removing the key, but we can't account for
+		 * that otherwise we would never exit the loop.
+		 *
+		 * Same for CSC invalidation messages generated by signalModifiedKey.
+		 *
+		 * AOF and Output buffer memory will be freed eventually so
+		 * we only care about memory used by the key space. */
+		delta := db.UsedMemory()
+		server.db[bestdbid].EvictKey(bestkey)
+		delta -= db.UsedMemory()
+		memFreed += delta
+		keysFreed++
+
+		// Don't stall the event loop: after some keys check the time limit,
+		// the cron goes on evicting once it is reached.
+		if keysFreed%16 == 0 && time.Since(start).Microseconds() > timeLimit {
+			timedOut = true
+			break
+		}
+	}
+
+	result := db.EvictFail
+	switch {
+	case timedOut:
+		// We still need to free memory, the cron goes on evicting.
+		server.evictionInProgress = true
+		result = db.EvictRunning
+	case memFreed >= status.ToFree:
+		result = db.EvictOk
+	}
+	latencyAddSampleIfNeeded(LatencyEventEvictionCycle, time.Since(start).Milliseconds())
+	return result
+}
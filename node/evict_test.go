@@ -0,0 +1,230 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+// setMaxmemory sets the maxmemory policy and a maxmemory limit of extra bytes
+// over the memory currently used, it returns a function restoring the
+// defaults.
+func setMaxmemory(policy int, extra int64) func() {
+	server.maxmemoryPolicy = policy
+	server.maxmemory = db.UsedMemory() + extra
+	return func() {
+		server.maxmemoryPolicy = db.MAXMEMORY_NO_EVICTION
+		server.maxmemory = 0
+		server.evictionInProgress = false
+		server.preCommandOOMState = false
+	}
+}
+
+func TestMaxmemoryNoEviction(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	sendCommand(c, conn, "SET", "oom:a", "1")
+
+	defer setMaxmemory(db.MAXMEMORY_NO_EVICTION, -1)()
+
+	oomErr := "-OOM command not allowed when used memory > 'maxmemory'.\r\n"
+	if got := sendCommand(c, conn, "SET", "oom:b", "1"); got != oomErr {
+		t.Fatalf("SET replied %q, want %q", got, oomErr)
+	}
+	// The commands that don't use more memory are still served.
+	if got := sendCommand(c, conn, "GET", "oom:a"); got != "$1\r\n1\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+}
+
+func TestMaxmemoryMulti(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	sendCommand(c, conn, "SET", "oom:a", "1")
+
+	sendCommand(c, conn, "MULTI")
+	restore := setMaxmemory(db.MAXMEMORY_NO_EVICTION, -1)
+	defer restore()
+
+	// Queuing may use an unlimited amount of memory, even the read commands
+	// are rejected, and the transaction is aborted.
+	if got := sendCommand(c, conn, "GET", "oom:a"); !strings.HasPrefix(got, "-OOM") {
+		t.Fatalf("GET inside MULTI replied %q", got)
+	}
+	if got := sendCommand(c, conn, "EXEC"); !strings.HasPrefix(got, "-EXECABORT") {
+		t.Fatalf("EXEC replied %q", got)
+	}
+}
+
+func TestMaxmemoryEvictAllkeys(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	// No time limit, the memory is released by a single command.
+	server.maxmemoryEvictionTenacity = 100
+	defer func() { server.maxmemoryEvictionTenacity = 10 }()
+
+	for _, policy := range []string{"allkeys-lru", "allkeys-lfu", "allkeys-random"} {
+		t.Run(policy, func(t *testing.T) {
+			server.emptyData(-1, EmptyDbNoFlags)
+			used := db.UsedMemory()
+			for _, dbid := range []string{"0", "1"} {
+				sendCommand(c, conn, "SELECT", dbid)
+				for j := 0; j < 100; j++ {
+					sendCommand(c, conn, "SET", "evict:"+strconv.Itoa(j), "value")
+				}
+			}
+			sendCommand(c, conn, "CONFIG", "SET", "maxmemory-policy", policy)
+			// Half of the memory used by the keys must be released by the
+			// next command.
+			defer setMaxmemory(server.maxmemoryPolicy, -(db.UsedMemory()-used)/2)()
+			sendCommand(c, conn, "GET", "evict:0")
+
+			if used := db.UsedMemory(); used > server.maxmemory {
+				t.Fatalf("used memory %d over the limit %d", used, server.maxmemory)
+			}
+			// Both the DBs are evicted from.
+			size := server.db[0].Size() + server.db[1].Size()
+			if size == 0 || size > 150 {
+				t.Fatalf("%d keys left", size)
+			}
+			if got := sendCommand(c, conn, "SET", "evict:new", "value"); got != "+OK\r\n" {
+				t.Fatalf("SET replied %q", got)
+			}
+		})
+	}
+	sendCommand(c, conn, "SELECT", "0")
+	server.emptyData(-1, EmptyDbNoFlags)
+}
+
+func TestMaxmemoryEvictVolatile(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	// All the keys are sampled, the best key is always evicted.
+	server.maxmemorySamples = 64
+	defer func() { server.maxmemorySamples = db.MEMORY_SAMPLES }()
+	// No time limit, all the volatile keys are evicted before the OOM error
+	// however slow the eviction is.
+	server.maxmemoryEvictionTenacity = 100
+	defer func() { server.maxmemoryEvictionTenacity = 10 }()
+
+	for _, policy := range []string{"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl"} {
+		t.Run(policy, func(t *testing.T) {
+			server.emptyData(-1, EmptyDbNoFlags)
+			evicted := server.db[0].StatEvictedKeys
+			for j := 0; j < 20; j++ {
+				sendCommand(c, conn, "SET", "persist:"+strconv.Itoa(j), "value")
+				sendCommand(c, conn, "SET", "volatile:"+strconv.Itoa(j), "value", "EX", strconv.Itoa(100+j))
+			}
+			sendCommand(c, conn, "CONFIG", "SET", "maxmemory-policy", policy)
+			defer setMaxmemory(server.maxmemoryPolicy, -1)()
+			sendCommand(c, conn, "GET", "persist:0")
+
+			// Only the keys with an expire are evicted.
+			if got := server.db[0].Size(); got != 39 {
+				t.Fatalf("%d keys left", got)
+			}
+			if got := server.db[0].StatEvictedKeys - evicted; got != 1 {
+				t.Fatalf("%d keys evicted", got)
+			}
+			if policy == "volatile-ttl" && server.db[0].ContainsKey("volatile:0") {
+				t.Fatalf("the key expiring first was not evicted")
+			}
+
+			// Once the volatile keys are gone the memory can't be released.
+			server.maxmemory = 1
+			if got := sendCommand(c, conn, "SET", "persist:new", "value"); !strings.HasPrefix(got, "-OOM") {
+				t.Fatalf("SET replied %q", got)
+			}
+			if got := server.db[0].ExpiresSize(); got != 0 {
+				t.Fatalf("%d volatile keys left", got)
+			}
+		})
+	}
+	server.emptyData(-1, EmptyDbNoFlags)
+}
+
+func TestMaxmemoryEvictTimeLimit(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+	used := db.UsedMemory()
+	for j := 0; j < 100; j++ {
+		sendCommand(c, conn, "SET", "evict:"+strconv.Itoa(j), "value")
+	}
+
+	server.maxmemoryEvictionTenacity = 0
+	defer func() { server.maxmemoryEvictionTenacity = 10 }()
+	defer setMaxmemory(db.MAXMEMORY_ALLKEYS_RANDOM, -(db.UsedMemory()-used)/2)()
+
+	// The command is served once the time limit is reached, the eviction
+	// goes on in the cron.
+	if got := sendCommand(c, conn, "SET", "evict:new", "value"); got != "+OK\r\n" {
+		t.Fatalf("SET replied %q", got)
+	}
+	if !server.evictionInProgress || server.db[0].Size() != 101-16 {
+		t.Fatalf("%d keys left, eviction in progress %v", server.db[0].Size(), server.evictionInProgress)
+	}
+	for j := 0; j < 10 && server.evictionInProgress; j++ {
+		server.serverCron()
+	}
+	if server.evictionInProgress {
+		t.Fatal("eviction still in progress")
+	}
+	if used := db.UsedMemory(); used > server.maxmemory {
+		t.Fatalf("used memory %d over the limit %d", used, server.maxmemory)
+	}
+}
+
+func TestMaxmemoryScripts(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	sendCommand(c, conn, "SET", "oom:a", "1")
+
+	defer setMaxmemory(db.MAXMEMORY_NO_EVICTION, -1)()
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"EVAL", "#!lua\nreturn 1", "0"}, "-OOM allow-oom flag is not set on the script, can not run it when used memory > 'maxmemory'\r\n"},
+		{[]string{"EVAL", "#!lua flags=no-writes\nreturn redis.call('GET', KEYS[1])", "1", "oom:a"}, "$1\r\n1\r\n"},
+		{[]string{"EVAL", "return redis.call('SET', KEYS[1], 'v')", "1", "oom:b"}, "-OOM command not allowed when used memory > 'maxmemory'."},
+		{[]string{"EVAL", "return redis.call('GET', KEYS[1])", "1", "oom:a"}, "$1\r\n1\r\n"},
+		{[]string{"EVAL", "#!lua flags=allow-oom\nreturn redis.call('SET', KEYS[1], 'v')", "1", "oom:b"}, "+OK\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestMaxmemoryConfig(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	want := "*2\r\n" + bulkString("maxmemory-policy") + bulkString("noeviction")
+	if got := sendCommand(c, conn, "CONFIG", "GET", "maxmemory-policy"); got != want {
+		t.Fatalf("CONFIG GET replied %q, want %q", got, want)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "SET", "maxmemory-policy", "lru"); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("CONFIG SET unknown policy replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "SET", "maxmemory-samples", "0"); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("CONFIG SET maxmemory-samples replied %q", got)
+	}
+	if got := sendCommand(c, conn, "INFO", "memory"); !strings.Contains(got, "maxmemory_policy:noeviction\r\n") {
+		t.Fatalf("INFO replied %q", got)
+	}
+	server.maxmemoryEvictionTenacity = 100
+	defer func() { server.maxmemoryEvictionTenacity = 10 }()
+	if got := evictionTimeLimitUs(); got <= 1000000 {
+		t.Fatalf("time limit %d for tenacity 100", got)
+	}
+}
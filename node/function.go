@@ -0,0 +1,364 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* This file implements the functions: libraries of Go functions registered
+ * by the program embedding the server, called with FCALL and FCALL_RO and
+ * managed with the FUNCTION command. */
+
+// FunctionsEngine is the name of the engine running the functions.
+const FunctionsEngine = "GO"
+
+// FunctionCallback is the Go implementation of a function, keys and args are
+// the arguments given to FCALL. The returned value is replied to the caller
+// as described in ScriptRunCtx.Call, a returned error is replied as an error.
+type FunctionCallback func(ctx *ScriptRunCtx, keys []string, args []string) (any, error)
+
+// Function describes a function of a library.
+type Function struct {
+	Name     string
+	Desc     string
+	Flags    ScriptFlags
+	NumKeys  int // Number of keys the function expects, -1 for any number
+	MinArgs  int // Minimum number of arguments, besides the keys
+	Callback FunctionCallback
+
+	library *FunctionLibrary
+}
+
+// FunctionLibrary is a named set of functions, registered and deleted
+// together.
+type FunctionLibrary struct {
+	Name      string
+	Functions []*Function
+}
+
+// functionsLibCtx holds the registered libraries and functions.
+type functionsLibCtx struct {
+	libraries *db.HashTable[string, *FunctionLibrary] // Library name -> library
+	functions *db.HashTable[string, *Function]        // Function name -> function
+}
+
+func newFunctionsLibCtx() *functionsLibCtx {
+	return &functionsLibCtx{
+		libraries: db.NewHashTable[string, *FunctionLibrary](db.INITIAL_DB_SIZE),
+		functions: db.NewHashTable[string, *Function](db.INITIAL_DB_SIZE),
+	}
+}
+
+// functionsVerifyName checks that the name is made of letters, numbers and
+// underscores only.
+func functionsVerifyName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// libraryUnlink removes the library and its functions.
+func (ctx *functionsLibCtx) libraryUnlink(lib *FunctionLibrary) {
+	for _, fn := range lib.Functions {
+		ctx.functions.Delete(fn.Name)
+	}
+	ctx.libraries.Delete(lib.Name)
+}
+
+// FunctionLoad registers a library of Go functions. Unless replace is true
+// an error is returned if the library already exists, in any case the names
+// of the functions must not be used by other libraries.
+func (s *RedisServer) FunctionLoad(lib *FunctionLibrary, replace bool) error {
+	if !functionsVerifyName(lib.Name) {
+		return fmt.Errorf("Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	if len(lib.Functions) == 0 {
+		return fmt.Errorf("No functions registered")
+	}
+
+	ctx := s.functions
+	old, exist := ctx.libraries.Get(lib.Name)
+	if exist && !replace {
+		return fmt.Errorf("Library '%s' already exists", lib.Name)
+	}
+
+	seen := make(map[string]bool, len(lib.Functions))
+	for _, fn := range lib.Functions {
+		if !functionsVerifyName(fn.Name) {
+			return fmt.Errorf("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+		}
+		if fn.Callback == nil {
+			return fmt.Errorf("Function %s has no callback", fn.Name)
+		}
+		if seen[fn.Name] {
+			return fmt.Errorf("Function already exists in the library")
+		}
+		seen[fn.Name] = true
+		if other, exist := ctx.functions.Get(fn.Name); exist && other.library != old {
+			return fmt.Errorf("Function %s already exists", fn.Name)
+		}
+	}
+
+	if exist {
+		ctx.libraryUnlink(old)
+	}
+	for _, fn := range lib.Functions {
+		fn.library = lib
+		ctx.functions.Set(fn.Name, fn)
+	}
+	ctx.libraries.Set(lib.Name, lib)
+	return nil
+}
+
+// FunctionDelete removes a library and its functions.
+func (s *RedisServer) FunctionDelete(name string) error {
+	lib, exist := s.functions.libraries.Get(name)
+	if !exist {
+		return fmt.Errorf("Library not found")
+	}
+	s.functions.libraryUnlink(lib)
+	return nil
+}
+
+/*-----------------------------------------------------------------------------
+ * FCALL / FUNCTION commands entry point
+ *----------------------------------------------------------------------------*/
+
+// FunctionCmd handles the FCALL, FCALL_RO and FUNCTION commands.
+type FunctionCmd struct {
+	c *Client
+}
+
+// NewFunctionCmd returns a new FunctionCmd.
+func NewFunctionCmd(c *Client) *FunctionCmd {
+	return &FunctionCmd{c: c}
+}
+
+// fcallGeneric implements FCALL and FCALL_RO
+func (cmd *FunctionCmd) fcallGeneric(ro bool) {
+	c := cmd.c
+
+	fn, exist := server.functions.functions.Get(c.argv[1].Value.(string))
+	if !exist {
+		c.AddReplyError("Function not found")
+		return
+	}
+
+	numkeys, ok := getLongLongFromObject(c.argv[2])
+	if !ok {
+		c.AddReplyError("Bad number of keys provided")
+		return
+	}
+	if numkeys > int64(c.argc-3) {
+		c.AddReplyError("Number of keys can't be greater than number of args")
+		return
+	} else if numkeys < 0 {
+		c.AddReplyError("Number of keys can't be negative")
+		return
+	}
+
+	keys := make([]string, 0, numkeys)
+	for j := 3; j < 3+int(numkeys); j++ {
+		keys = append(keys, c.argv[j].Value.(string))
+	}
+	args := make([]string, 0, c.argc-3-int(numkeys))
+	for j := 3 + int(numkeys); j < c.argc; j++ {
+		args = append(args, c.argv[j].Value.(string))
+	}
+	if fn.NumKeys >= 0 && len(keys) != fn.NumKeys {
+		c.addReplyErrorFormat(fmt.Sprintf("Wrong number of keys calling function '%s'", fn.Name))
+		return
+	}
+	if len(args) < fn.MinArgs {
+		c.addReplyErrorFormat(fmt.Sprintf("Wrong number of args calling function '%s'", fn.Name))
+		return
+	}
+
+	runCtx := &ScriptRunCtx{}
+	if !scriptPrepareForRun(runCtx, c, fn.Name, fn.Flags, ro) {
+		return
+	}
+	reply, err := fn.Callback(runCtx, keys, args)
+	scriptResetRun(runCtx)
+
+	if err != nil {
+		c.addReplyScriptValue(err)
+	} else {
+		c.addReplyScriptValue(reply)
+	}
+}
+
+// Fcall implements FCALL function numkeys [key ...] [arg ...]
+func (cmd *FunctionCmd) Fcall() {
+	cmd.fcallGeneric(false)
+}
+
+// FcallRo implements FCALL_RO function numkeys [key ...] [arg ...]
+func (cmd *FunctionCmd) FcallRo() {
+	cmd.fcallGeneric(true)
+}
+
+// List implements FUNCTION LIST [WITHCODE] [LIBRARYNAME pattern]
+// The Go functions have no code, library_code is replied as null.
+func (cmd *FunctionCmd) List() {
+	c := cmd.c
+	withCode := false
+	libraryName := ""
+	hasLibraryName := false
+	for i := 2; i < c.argc; i++ {
+		arg := c.argv[i].Value.(string)
+		if !withCode && strings.EqualFold(arg, "withcode") {
+			withCode = true
+			continue
+		}
+		if !hasLibraryName && strings.EqualFold(arg, "libraryname") {
+			if i >= c.argc-1 {
+				c.AddReplyError("library name argument was not given")
+				return
+			}
+			i++
+			libraryName = c.argv[i].Value.(string)
+			hasLibraryName = true
+			continue
+		}
+		c.addReplyErrorFormat(fmt.Sprintf("Unknown argument %s", arg))
+		return
+	}
+
+	libs := make([]*FunctionLibrary, 0, server.functions.libraries.Len())
+	server.functions.libraries.Range(func(name string, lib *FunctionLibrary) bool {
+		if !hasLibraryName || stringMatch(libraryName, name, true) {
+			libs = append(libs, lib)
+		}
+		return true
+	})
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Name < libs[j].Name })
+
+	c.addReplyArrayLen(len(libs))
+	for _, lib := range libs {
+		if withCode {
+			c.addReplyMapLen(4)
+		} else {
+			c.addReplyMapLen(3)
+		}
+		c.addReplyBulkCString("library_name")
+		c.addReplyBulkCString(lib.Name)
+		c.addReplyBulkCString("engine")
+		c.addReplyBulkCString(FunctionsEngine)
+
+		c.addReplyBulkCString("functions")
+		c.addReplyArrayLen(len(lib.Functions))
+		for _, fn := range lib.Functions {
+			c.addReplyMapLen(3)
+			c.addReplyBulkCString("name")
+			c.addReplyBulkCString(fn.Name)
+			c.addReplyBulkCString("description")
+			if fn.Desc != "" {
+				c.addReplyBulkCString(fn.Desc)
+			} else {
+				c.addReplyNull()
+			}
+			c.addReplyBulkCString("flags")
+			flags := scriptFlagsNames(fn.Flags)
+			c.addReplySetLen(len(flags))
+			for _, flag := range flags {
+				c.addReplyStatus(flag)
+			}
+		}
+
+		if withCode {
+			c.addReplyBulkCString("library_code")
+			c.addReplyNull()
+		}
+	}
+}
+
+// Delete implements FUNCTION DELETE library-name
+func (cmd *FunctionCmd) Delete() {
+	if err := server.FunctionDelete(cmd.c.argv[2].Value.(string)); err != nil {
+		cmd.c.AddReplyError(err.Error())
+		return
+	}
+	cmd.c.AddReply(SharedOk)
+}
+
+// Flush implements FUNCTION FLUSH [ASYNC|SYNC]
+func (cmd *FunctionCmd) Flush() {
+	if cmd.c.argc == 3 {
+		arg := cmd.c.argv[2].Value.(string)
+		if !strings.EqualFold(arg, "sync") && !strings.EqualFold(arg, "async") {
+			cmd.c.AddReplyError("FUNCTION FLUSH only supports SYNC|ASYNC option")
+			return
+		}
+	}
+	server.functions = newFunctionsLibCtx()
+	cmd.c.AddReply(SharedOk)
+}
+
+// Kill implements FUNCTION KILL
+func (cmd *FunctionCmd) Kill() {
+	scriptKill(cmd.c, false)
+}
+
+// Help implements FUNCTION HELP
+func (cmd *FunctionCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"DELETE <LIBRARY NAME>",
+		"    Delete the given library.",
+		"LIST [LIBRARYNAME PATTERN] [WITHCODE]",
+		"    Return general information on all the libraries:",
+		"    * Library name",
+		"    * The engine used to run the Library",
+		"    * Functions list",
+		"    * Library code (if WITHCODE is given)",
+		"    It also possible to get only function that matches a pattern using LIBRARYNAME argument.",
+		"KILL",
+		"    Kill the current running function.",
+		"FLUSH [ASYNC|SYNC]",
+		"    Delete all the libraries.",
+	})
+}
+
+func fcallCommand(c *Client) error {
+	NewFunctionCmd(c).Fcall()
+	return nil
+}
+
+func fcallroCommand(c *Client) error {
+	NewFunctionCmd(c).FcallRo()
+	return nil
+}
+
+func functionListCommand(c *Client) error {
+	NewFunctionCmd(c).List()
+	return nil
+}
+
+func functionDeleteCommand(c *Client) error {
+	NewFunctionCmd(c).Delete()
+	return nil
+}
+
+func functionFlushCommand(c *Client) error {
+	NewFunctionCmd(c).Flush()
+	return nil
+}
+
+func functionKillCommand(c *Client) error {
+	NewFunctionCmd(c).Kill()
+	return nil
+}
+
+func functionHelpCommand(c *Client) error {
+	NewFunctionCmd(c).Help()
+	return nil
+}
@@ -0,0 +1,245 @@
+package node
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testReactor runs onBlocked when the server serves the clients while
+// blocked in a long script.
+type testReactor struct {
+	onBlocked func()
+	stopped   bool
+}
+
+func (r *testReactor) Run() {}
+
+func (r *testReactor) SetHandler(handler ReaderHandler) {}
+
+func (r *testReactor) Stop() {
+	r.stopped = true
+}
+
+func (r *testReactor) ProcessEventsWhileBlocked() {
+	if r.onBlocked != nil {
+		r.onBlocked()
+	}
+}
+
+func loadTestLibrary(t *testing.T, lib *FunctionLibrary) {
+	t.Helper()
+	if err := server.FunctionLoad(lib, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.FunctionDelete(lib.Name) })
+}
+
+func TestFcall(t *testing.T) {
+	loadTestLibrary(t, &FunctionLibrary{Name: "kv", Functions: []*Function{
+		{Name: "kv_set", NumKeys: 1, MinArgs: 1, Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			return ctx.Call("SET", keys[0], args[0])
+		}},
+		{Name: "kv_get", NumKeys: 1, Flags: ScriptFlagNoWrites, Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			return ctx.Call("GET", keys[0])
+		}},
+		{Name: "kv_bad_set", NumKeys: 1, Flags: ScriptFlagNoWrites, Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			return ctx.Call("SET", keys[0], "v")
+		}},
+		{Name: "kv_values", NumKeys: -1, Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			return []any{int64(1), "two", StatusReply("THREE"), nil, true, errors.New("oops")}, nil
+		}},
+	}})
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"FCALL", "kv_set", "1", "fn:a", "1"}, "+OK\r\n"},
+		{[]string{"FCALL", "kv_get", "1", "fn:a"}, "$1\r\n1\r\n"},
+		{[]string{"FCALL_RO", "kv_get", "1", "fn:a"}, "$1\r\n1\r\n"},
+		{[]string{"FCALL_RO", "kv_set", "1", "fn:a", "2"}, "-ERR Can not execute a script with write flag using *_ro command.\r\n"},
+		{[]string{"FCALL", "kv_bad_set", "1", "fn:a"}, "-ERR Write commands are not allowed from read-only scripts.\r\n"},
+		{[]string{"FCALL", "kv_set", "1", "fn:a"}, "-ERR Wrong number of args calling function 'kv_set'\r\n"},
+		{[]string{"FCALL", "kv_get", "0"}, "-ERR Wrong number of keys calling function 'kv_get'\r\n"},
+		{[]string{"FCALL", "kv_values", "0"}, "*6\r\n:1\r\n$3\r\ntwo\r\n+THREE\r\n$-1\r\n:1\r\n-ERR oops\r\n"},
+		{[]string{"FCALL", "nosuchfn", "0"}, "-ERR Function not found\r\n"},
+		{[]string{"FCALL", "kv_get", "x"}, "-ERR Bad number of keys provided\r\n"},
+		{[]string{"FCALL", "kv_get", "2", "fn:a"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"FCALL", "kv_get", "-1"}, "-ERR Number of keys can't be negative\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if server.scriptRunCtx != nil {
+		t.Fatal("run context not reset")
+	}
+}
+
+func TestFunctionCallErrors(t *testing.T) {
+	var callErr error
+	loadTestLibrary(t, &FunctionLibrary{Name: "errs", Functions: []*Function{
+		{Name: "errs_call", NumKeys: -1, Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			_, callErr = ctx.Call(args...)
+			return nil, callErr
+		}},
+	}})
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	sendCommand(c, conn, "SET", "fn:str", "v")
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"FCALL", "errs_call", "0", "NOSUCHCOMMAND"}, "-ERR Unknown Redis command called from script\r\n"},
+		{[]string{"FCALL", "errs_call", "0", "GET"}, "-ERR Wrong number of args calling Redis command from script\r\n"},
+		{[]string{"FCALL", "errs_call", "0", "MULTI"}, "-ERR This Redis command is not allowed from script\r\n"},
+		{[]string{"FCALL", "errs_call", "0", "SET", "fn:str", "v", "XX", "NX"}, "-ERR syntax error\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if _, ok := callErr.(ReplyError); !ok {
+		t.Fatalf("Call returned %T, want ReplyError", callErr)
+	}
+}
+
+func TestFunctionLoad(t *testing.T) {
+	noop := func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) { return nil, nil }
+	loadTestLibrary(t, &FunctionLibrary{Name: "lib1", Functions: []*Function{{Name: "lib1_fn", Callback: noop}}})
+
+	if err := server.FunctionLoad(&FunctionLibrary{Name: "lib1", Functions: []*Function{{Name: "other", Callback: noop}}}, false); err == nil || err.Error() != "Library 'lib1' already exists" {
+		t.Fatalf("loading an existing library returned %v", err)
+	}
+	if err := server.FunctionLoad(&FunctionLibrary{Name: "lib2", Functions: []*Function{{Name: "lib1_fn", Callback: noop}}}, false); err == nil || err.Error() != "Function lib1_fn already exists" {
+		t.Fatalf("loading an existing function returned %v", err)
+	}
+	if err := server.FunctionLoad(&FunctionLibrary{Name: "bad-name", Functions: []*Function{{Name: "f", Callback: noop}}}, false); err == nil {
+		t.Fatal("invalid library name accepted")
+	}
+	if err := server.FunctionLoad(&FunctionLibrary{Name: "lib2"}, false); err == nil || err.Error() != "No functions registered" {
+		t.Fatalf("loading an empty library returned %v", err)
+	}
+	if err := server.FunctionLoad(&FunctionLibrary{Name: "lib1", Functions: []*Function{{Name: "lib1_fn2", Callback: noop}}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := server.functions.functions.Get("lib1_fn"); exist {
+		t.Fatal("replaced library functions still registered")
+	}
+}
+
+func TestFunctionList(t *testing.T) {
+	noop := func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) { return nil, nil }
+	loadTestLibrary(t, &FunctionLibrary{Name: "listlib", Functions: []*Function{
+		{Name: "listlib_ro", Desc: "read only", Flags: ScriptFlagNoWrites | ScriptFlagAllowStale, Callback: noop},
+	}})
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	want := "*1\r\n*6\r\n" +
+		"$12\r\nlibrary_name\r\n$7\r\nlistlib\r\n" +
+		"$6\r\nengine\r\n$2\r\nGO\r\n" +
+		"$9\r\nfunctions\r\n*1\r\n*6\r\n" +
+		"$4\r\nname\r\n$10\r\nlistlib_ro\r\n" +
+		"$11\r\ndescription\r\n$9\r\nread only\r\n" +
+		"$5\r\nflags\r\n*2\r\n+no-writes\r\n+allow-stale\r\n"
+	if got := sendCommand(c, conn, "FUNCTION", "LIST", "LIBRARYNAME", "list*"); got != want {
+		t.Fatalf("FUNCTION LIST replied %q, want %q", got, want)
+	}
+	if got := sendCommand(c, conn, "FUNCTION", "LIST", "LIBRARYNAME", "nomatch*"); got != "*0\r\n" {
+		t.Fatalf("FUNCTION LIST replied %q", got)
+	}
+	if got := sendCommand(c, conn, "FUNCTION", "LIST", "LIBRARYNAME"); got != "-ERR library name argument was not given\r\n" {
+		t.Fatalf("FUNCTION LIST replied %q", got)
+	}
+	if got := sendCommand(c, conn, "FUNCTION", "DELETE", "nosuchlib"); got != "-ERR Library not found\r\n" {
+		t.Fatalf("FUNCTION DELETE replied %q", got)
+	}
+}
+
+func TestFunctionBusyAndKill(t *testing.T) {
+	oldThreshold := server.busyReplyThreshold
+	server.busyReplyThreshold = 0
+	defer func() {
+		server.busyReplyThreshold = oldThreshold
+		server.reactor = nil
+	}()
+
+	var written bool
+	loadTestLibrary(t, &FunctionLibrary{Name: "busy", Functions: []*Function{
+		{Name: "busy_spin", Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			for {
+				if err := ctx.Yield(); err != nil {
+					return nil, err
+				}
+			}
+		}},
+		{Name: "busy_write", Callback: func(ctx *ScriptRunCtx, keys []string, args []string) (any, error) {
+			if _, err := ctx.Call("SET", "fn:busy", "1"); err != nil {
+				return nil, err
+			}
+			written = true
+			for i := 0; i < 3; i++ {
+				if err := ctx.Yield(); err != nil {
+					return nil, err
+				}
+			}
+			return StatusReply("DONE"), nil
+		}},
+	}})
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	if got := sendCommand(other, otherConn, "FUNCTION", "KILL"); got != "-NOTBUSY No scripts in execution right now.\r\n" {
+		t.Fatalf("FUNCTION KILL replied %q", got)
+	}
+
+	var busyReplies []string
+	server.reactor = &testReactor{onBlocked: func() {
+		if c.flags&ClientProtected == 0 {
+			t.Error("caller not protected while blocked")
+		}
+		busyReplies = append(busyReplies, sendCommand(other, otherConn, "GET", "fn:busy"))
+		busyReplies = append(busyReplies, sendCommand(other, otherConn, "FUNCTION", "KILL"))
+	}}
+
+	if got := sendCommand(c, conn, "FCALL", "busy_spin", "0"); got != "-ERR Script killed by user with FUNCTION KILL...\r\n" {
+		t.Fatalf("killed FCALL replied %q", got)
+	}
+	if busyReplies[0] != "-BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.\r\n" {
+		t.Fatalf("GET while busy replied %q", busyReplies[0])
+	}
+	if busyReplies[1] != "+OK\r\n" {
+		t.Fatalf("FUNCTION KILL replied %q", busyReplies[1])
+	}
+	if c.flags&ClientProtected != 0 {
+		t.Fatal("caller still protected")
+	}
+
+	// Once the script wrote to the keyspace it can not be killed anymore.
+	busyReplies = nil
+	server.reactor = &testReactor{onBlocked: func() {
+		if written {
+			busyReplies = append(busyReplies, sendCommand(other, otherConn, "FUNCTION", "KILL"))
+		}
+	}}
+	if got := sendCommand(c, conn, "FCALL", "busy_write", "0"); got != "+DONE\r\n" {
+		t.Fatalf("FCALL replied %q", got)
+	}
+	if len(busyReplies) == 0 || !strings.HasPrefix(busyReplies[0], "-UNKILLABLE") {
+		t.Fatalf("FUNCTION KILL after a write replied %q", busyReplies)
+	}
+}
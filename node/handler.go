@@ -21,6 +21,43 @@ type ReaderWriterHandler interface {
 	WriterHandler
 }
 
+// ConnHandler is implemented by the handlers that keep per connection state.
+type ConnHandler interface {
+	// Open is called when a new connection is accepted.
+	Open(conn Conn) error
+	// Closed is called when the peer hang up, the handler is in charge of
+	// releasing the connection.
+	Closed(conn Conn)
+}
+
+// WritableHandler is implemented by the handlers that keep the output the
+// connections could not accept, it is called once the connection asked to be
+// notified with SetWriteHandler is writable again.
+type WritableHandler interface {
+	Writable(conn Conn) error
+}
+
+// TimeHandler is implemented by the handlers that need a periodic timer.
+type TimeHandler interface {
+	// Cron is called from the event loop, it returns the number of
+	// milliseconds before the next call.
+	Cron() int
+}
+
+// BeforeSleepHandler is implemented by the handlers that need to run before
+// the event loop waits for the next events.
+type BeforeSleepHandler interface {
+	BeforeSleep()
+}
+
+// ShutdownHandler is implemented by the handlers that shut down by
+// themselves on SIGINT and SIGTERM, or right away on SIGUSR1 (now is true),
+// the event loop is only stopped once they call IReactor.Stop. The event
+// loop is stopped right away for the other handlers.
+type ShutdownHandler interface {
+	Shutdown(now bool)
+}
+
 // DefaultHandler is a simple implementation of the ReaderHandler.
 type DefaultHandler struct{}
 
@@ -31,8 +68,8 @@ func (dh DefaultHandler) Read(conn Conn) error {
 	if err != nil {
 		return err
 	}
-	conn.Write(data)
-	return nil
+	_, err = conn.Write(data)
+	return err
 }
 
 // DefaultWriterHandler is a simple implementation of the WriterHandler.
@@ -44,3 +81,56 @@ func (dwh DefaultWriterHandler) Write(conn *Conn, w io.Writer, data []byte) erro
 	_, err := w.Write(data)
 	return err
 }
+
+// RedisHandler serves the Redis protocol, every connection is bound to a client.
+type RedisHandler struct {
+	server *RedisServer
+}
+
+func (h RedisHandler) Open(conn Conn) error {
+	c := h.server.createClient(conn)
+	h.server.clientAcceptHandler(c)
+	return nil
+}
+
+func (h RedisHandler) Read(conn Conn) error {
+	c, ok := h.server.connClients[conn.Fd()]
+	if !ok {
+		return conn.Close()
+	}
+	c.readQueryFromClient()
+	h.server.processUnblockedClients()
+	// Send the invalidation of the keys modified by the commands to the
+	// clients tracking them in BCAST mode.
+	trackingBroadcastInvalidationMessages()
+	return nil
+}
+
+func (h RedisHandler) Writable(conn Conn) error {
+	c, ok := h.server.connClients[conn.Fd()]
+	if !ok {
+		return conn.Close()
+	}
+	c.writeToClient(true)
+	return nil
+}
+
+func (h RedisHandler) Closed(conn Conn) {
+	if c, ok := h.server.connClients[conn.Fd()]; ok {
+		freeClient(c)
+		return
+	}
+	conn.Close()
+}
+
+func (h RedisHandler) Cron() int {
+	return h.server.serverCron()
+}
+
+func (h RedisHandler) BeforeSleep() {
+	h.server.beforeSleep()
+}
+
+func (h RedisHandler) Shutdown(now bool) {
+	h.server.shutdownOnSignal(now)
+}
@@ -0,0 +1,132 @@
+package node
+
+import "math/bits"
+
+/* This file implements a minimal HDR (High Dynamic Range) histogram, used to
+ * track the latency distribution of the commands: the values are recorded
+ * with a fixed number of significant digits in buckets growing as powers of
+ * two, so that the histogram has a small fixed size whatever the range of the
+ * values it tracks. */
+
+// hdrHistogram is a HDR histogram of int64 values in [lowest, highest].
+type hdrHistogram struct {
+	lowest                      int64
+	highest                     int64
+	unitMagnitude               uint  // floor(log2(lowest))
+	subBucketHalfCountMagnitude uint  // log2(subBucketHalfCount)
+	subBucketHalfCount          int   // Sub buckets in the lower half of a bucket
+	subBucketMask               int64 // Mask of the sub bucket bits of a value
+	counts                      []int64
+	totalCount                  int64
+}
+
+// newHdrHistogram creates a histogram tracking the values in [lowest,
+// highest] with the given number of significant figures, between 1 and 5.
+func newHdrHistogram(lowest, highest int64, sigfigs int) *hdrHistogram {
+	largestValueWithSingleUnitResolution := int64(2)
+	for j := 0; j < sigfigs; j++ {
+		largestValueWithSingleUnitResolution *= 10
+	}
+	subBucketCountMagnitude := uint(bits.Len64(uint64(largestValueWithSingleUnitResolution - 1)))
+	h := &hdrHistogram{
+		lowest:                      lowest,
+		highest:                     highest,
+		unitMagnitude:               uint(bits.Len64(uint64(lowest)) - 1),
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+	}
+	subBucketCount := 1 << subBucketCountMagnitude
+	h.subBucketHalfCount = subBucketCount / 2
+	h.subBucketMask = int64(subBucketCount-1) << h.unitMagnitude
+
+	// Determine the number of buckets needed to cover the highest value.
+	smallestUntrackableValue := int64(subBucketCount) << h.unitMagnitude
+	bucketCount := 1
+	for smallestUntrackableValue <= highest {
+		if smallestUntrackableValue > (1<<62)-1 {
+			bucketCount++
+			break
+		}
+		smallestUntrackableValue <<= 1
+		bucketCount++
+	}
+	h.counts = make([]int64, (bucketCount+1)*h.subBucketHalfCount)
+	return h
+}
+
+// bucketIndex returns the bucket of the value.
+func (h *hdrHistogram) bucketIndex(v int64) int {
+	pow2ceiling := 64 - bits.LeadingZeros64(uint64(v|h.subBucketMask))
+	return pow2ceiling - int(h.unitMagnitude) - int(h.subBucketHalfCountMagnitude+1)
+}
+
+// countsIndex returns the index of the count of the value.
+func (h *hdrHistogram) countsIndex(v int64) int {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := int(v >> (uint(bucketIdx) + h.unitMagnitude))
+	return (bucketIdx+1)<<h.subBucketHalfCountMagnitude + subBucketIdx - h.subBucketHalfCount
+}
+
+// valueFromIndex returns the lowest value counted at the index.
+func (h *hdrHistogram) valueFromIndex(idx int) int64 {
+	bucketIdx := (idx >> h.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := (idx & (h.subBucketHalfCount - 1)) + h.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= h.subBucketHalfCount
+		bucketIdx = 0
+	}
+	return int64(subBucketIdx) << (uint(bucketIdx) + h.unitMagnitude)
+}
+
+// highestEquivalentValue returns the highest value counted together with v.
+func (h *hdrHistogram) highestEquivalentValue(v int64) int64 {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := v >> (uint(bucketIdx) + h.unitMagnitude)
+	adjustedBucket := bucketIdx
+	if subBucketIdx >= int64(2*h.subBucketHalfCount) {
+		adjustedBucket++
+	}
+	lowestEquivalent := subBucketIdx << (uint(bucketIdx) + h.unitMagnitude)
+	return lowestEquivalent + int64(1)<<(h.unitMagnitude+uint(adjustedBucket)) - 1
+}
+
+// record counts the value, clamped to the range of the histogram.
+func (h *hdrHistogram) record(v int64) {
+	if v < h.lowest {
+		v = h.lowest
+	} else if v > h.highest {
+		v = h.highest
+	}
+	h.counts[h.countsIndex(v)]++
+	h.totalCount++
+}
+
+// valueAtPercentile returns the value below which the given percentage of
+// the recorded values fall.
+func (h *hdrHistogram) valueAtPercentile(percentile float64) int64 {
+	if percentile > 100 {
+		percentile = 100
+	}
+	countAtPercentile := int64(percentile/100*float64(h.totalCount) + 0.5)
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+	var total int64
+	for idx, count := range h.counts {
+		total += count
+		if total >= countAtPercentile {
+			return h.highestEquivalentValue(h.valueFromIndex(idx))
+		}
+	}
+	return 0
+}
+
+// cumulativeCountTo returns the number of recorded values lower or equal to
+// the highest value equivalent to v.
+func (h *hdrHistogram) cumulativeCountTo(v int64) int64 {
+	last := h.countsIndex(v)
+	var total int64
+	for idx := 0; idx <= last && idx < len(h.counts); idx++ {
+		total += h.counts[idx]
+	}
+	return total
+}
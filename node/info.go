@@ -0,0 +1,555 @@
+package node
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/log"
+	"go.uber.org/zap"
+)
+
+/* This file implements the INFO command, and the stats it reports that are
+ * not maintained elsewhere: the instantaneous metrics sampled by the cron and
+ * the error replies stats.
+ *
+ * The reply is formatted exactly like Redis does, so that the tools parsing
+ * it work unchanged: a "# Section" header followed by "field:value" lines,
+ * every section separated by an empty line. */
+
+// ErrorStatsNumber is the max number of different error codes tracked by
+// the error stats, past it the error stats are disabled.
+const ErrorStatsNumber = 128
+
+// ConfigDefaultMaxClients is the max number of connected clients.
+const ConfigDefaultMaxClients = 10000
+
+// ConfigDefaultReplBacklogSize is the size of the replication backlog.
+const ConfigDefaultReplBacklogSize = 1024 * 1024
+
+// Instantaneous metrics tracked by the cron, see trackInstantaneousMetric.
+const (
+	StatsMetricCommand   = iota // Number of commands executed.
+	StatsMetricNetInput         // Bytes read from network.
+	StatsMetricNetOutput        // Bytes written to network.
+	StatsMetricCount
+)
+
+// StatsMetricSamples is the number of samples of an instantaneous metric,
+// the reported value is their average.
+const StatsMetricSamples = 16
+
+// instantaneousMetric holds the last samples of a metric, to report its
+// rate of change.
+type instantaneousMetric struct {
+	lastSampleBase  int64 // The divisor of the last sample window
+	lastSampleValue int64 // The dividend of the last sample window
+	samples         [StatsMetricSamples]int64
+	idx             int
+}
+
+// redisError is the count of the error replies with the same code, for the
+// error stats.
+type redisError struct {
+	count int64
+}
+
+// defaultInfoSections are the sections reported by INFO without arguments,
+// or when the "default" section is given.
+var defaultInfoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "cpu", "module_list", "errorstats", "cluster", "keyspace"}
+
+// runWithPeriod reports whether a task that should run every ms milliseconds
+// must run in the current serverCron call.
+func (s *RedisServer) runWithPeriod(ms int) bool {
+	period := 1000 / s.hz
+	return ms <= period || s.cronLoops%int64(ms/period) == 0
+}
+
+// trackInstantaneousMetric adds a sample of the metric: the rate of change
+// of the value, per second, since the last sample.
+func (s *RedisServer) trackInstantaneousMetric(metric int, currentValue, currentBase, factor int64) {
+	m := &s.instMetric[metric]
+	if m.lastSampleBase > 0 {
+		base := currentBase - m.lastSampleBase
+		value := currentValue - m.lastSampleValue
+		var avg int64
+		if base > 0 {
+			avg = value * factor / base
+		}
+		m.samples[m.idx] = avg
+		m.idx = (m.idx + 1) % StatsMetricSamples
+	}
+	m.lastSampleBase = currentBase
+	m.lastSampleValue = currentValue
+}
+
+// getInstantaneousMetric returns the average of the samples of the metric.
+func (s *RedisServer) getInstantaneousMetric(metric int) int64 {
+	var sum int64
+	for _, sample := range s.instMetric[metric].samples {
+		sum += sample
+	}
+	return sum / StatsMetricSamples
+}
+
+// trackInstantaneousMetrics samples all the instantaneous metrics, it is
+// called by the cron every 100 milliseconds.
+func (s *RedisServer) trackInstantaneousMetrics() {
+	now := time.Now().UnixMicro()
+	s.trackInstantaneousMetric(StatsMetricCommand, int64(s.statNumCommands), now, 1000000)
+	s.trackInstantaneousMetric(StatsMetricNetInput, int64(s.statNetInputBytes), now, 1000000)
+	s.trackInstantaneousMetric(StatsMetricNetOutput, int64(s.statNetOutputBytes), now, 1000000)
+}
+
+// resetErrorTableStats removes all the error stats.
+func (s *RedisServer) resetErrorTableStats() {
+	s.errors = db.NewRaxTree[*redisError]()
+	s.errorsEnabled = true
+}
+
+// incrementErrorCount increments the count of the error replies with the
+// given code. Once ErrorStatsNumber different codes are tracked the error
+// stats are disabled, since it is likely a misuse of the error replies by a
+// script, and only the ERRORSTATS_DISABLED entry is left.
+func (s *RedisServer) incrementErrorCount(code string) {
+	if e, ok := s.errors.Find([]byte(code)); ok {
+		e.count++
+		return
+	}
+	if !s.errorsEnabled {
+		return
+	}
+	if s.errors.Len() >= ErrorStatsNumber {
+		var codes []string
+		s.errors.Range(func(key []byte, _ *redisError) bool {
+			codes = append(codes, string(key))
+			return true
+		})
+		s.resetErrorTableStats()
+		s.incrementErrorCount("ERRORSTATS_DISABLED")
+		s.errorsEnabled = false
+		log.Logger.Warn("Errorstats stopped adding new errors because the number of errors reached the limit, may be misuse of lua error_reply, please check INFO ERRORSTATS",
+			zap.String("errors", strings.Join(codes, ", ")))
+		return
+	}
+	s.errors.Insert([]byte(code), &redisError{count: 1})
+}
+
+// Flags of incrCommandStatsOnError
+const (
+	ErrorCommandRejected = 1 << iota // Indicate to update the command rejected stats
+	ErrorCommandFailed               // Indicate to update the command failed stats
+)
+
+// incrCommandStatsOnError increments the failed or rejected calls of the
+// command if error replies were emitted since the previous call, which is
+// what a call with a nil cmd does, to reset the count. It returns true if
+// the stats were updated.
+func incrCommandStatsOnError(cmd RedisCommand, flags int) bool {
+	res := false
+	if cmd != nil && server.statTotalErrorReplies-server.prevErrCount > 0 {
+		if flags&ErrorCommandRejected != 0 {
+			cmd.SetRejectedCalls(cmd.GetRejectedCalls() + 1)
+			res = true
+		} else if flags&ErrorCommandFailed != 0 {
+			cmd.SetFailedCalls(cmd.GetFailedCalls() + 1)
+			res = true
+		}
+	}
+	server.prevErrCount = server.statTotalErrorReplies
+	return res
+}
+
+// bytesToHuman converts an amount of bytes into a human readable string in
+// the form of 100B, 2G, 100M, 4K, and so forth.
+func bytesToHuman(n int64) string {
+	d := float64(n)
+	switch {
+	case n < 1024:
+		// Bytes
+		return fmt.Sprintf("%dB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.2fK", d/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.2fM", d/(1024*1024))
+	case n < 1024*1024*1024*1024:
+		return fmt.Sprintf("%.2fG", d/(1024*1024*1024))
+	case n < 1024*1024*1024*1024*1024:
+		return fmt.Sprintf("%.2fT", d/(1024*1024*1024*1024))
+	case n < 1024*1024*1024*1024*1024*1024:
+		return fmt.Sprintf("%.2fP", d/(1024*1024*1024*1024*1024))
+	}
+	// Let's hope we never need this
+	return fmt.Sprintf("%dB", n)
+}
+
+// getSafeInfoString replaces the characters that would break the INFO
+// format, ':' and the newlines, with '_'.
+func getSafeInfoString(s string) string {
+	return mapChars(s, ":\r\n", "___")
+}
+
+// genInfoSectionDict returns the sections requested by the INFO arguments,
+// and whether all the sections or everything are requested.
+func genInfoSectionDict(args []string) (sections map[string]bool, all, everything bool) {
+	sections = make(map[string]bool)
+	if len(args) == 0 {
+		for _, section := range defaultInfoSections {
+			sections[section] = true
+		}
+		return sections, false, false
+	}
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "default":
+			for _, section := range defaultInfoSections {
+				sections[section] = true
+			}
+		case "all":
+			all = true
+		case "everything":
+			everything = true
+			all = true
+		default:
+			sections[strings.ToLower(arg)] = true
+		}
+	}
+	return sections, all, everything
+}
+
+// genRedisInfoString creates the string returned by the INFO command, with
+// the requested sections.
+func (s *RedisServer) genRedisInfoString(sections map[string]bool, all, everything bool) string {
+	var info strings.Builder
+	n := 0
+	section := func(name string, want bool) bool {
+		if !all && !want {
+			return false
+		}
+		if n > 0 {
+			info.WriteString("\r\n")
+		}
+		n++
+		info.WriteString("# " + name + "\r\n")
+		return true
+	}
+	field := func(format string, a ...any) {
+		fmt.Fprintf(&info, format, a...)
+		info.WriteString("\r\n")
+	}
+
+	// Server
+	if section("Server", sections["server"]) {
+		now := time.Now()
+		uptime := now.Unix() - s.statStartTime
+		ioThreadsActive := 0
+		if s.ioThreadsActive {
+			ioThreadsActive = 1
+		}
+		field("redis_version:%s", RedisVersion)
+		field("redis_git_sha1:%s", "00000000")
+		field("redis_git_dirty:%d", 0)
+		field("redis_mode:%s", "standalone")
+		field("os:%s", unameString())
+		field("arch_bits:%d", strconv.IntSize)
+		field("monotonic_clock:%s", "POSIX clock_gettime")
+		field("multiplexing_api:%s", "epoll")
+		field("atomicvar_api:%s", "sync-atomic")
+		field("gcc_version:%d.%d.%d", 0, 0, 0)
+		field("go_version:%s", runtime.Version())
+		field("process_id:%d", s.pid)
+		field("process_supervised:%s", "no")
+		field("run_id:%s", s.runId)
+		field("tcp_port:%d", s.port)
+		field("server_time_usec:%d", now.UnixMicro())
+		field("uptime_in_seconds:%d", uptime)
+		field("uptime_in_days:%d", uptime/(3600*24))
+		field("hz:%d", s.hz)
+		field("configured_hz:%d", s.hz)
+		field("lru_clock:%d", db.LRUClock())
+		field("executable:%s", s.executable)
+		field("config_file:%s", s.configFile)
+		field("io_threads_active:%d", ioThreadsActive)
+		shutdownIn := int64(0)
+		if s.isShutdownInitiated() {
+			if shutdownIn = s.shutdownMstime - now.UnixMilli(); shutdownIn < 0 {
+				shutdownIn = 0
+			}
+		}
+		field("shutdown_in_milliseconds:%d", shutdownIn)
+	}
+
+	// Clients
+	if section("Clients", sections["clients"]) {
+		var maxIn, maxOut int64
+		blocked := 0
+		iter := s.clients.NewListIterator(db.DIRECTION_HEAD)
+		for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+			c := node.Value
+			if in := int64(len(c.queryBuf)); in > maxIn {
+				maxIn = in
+			}
+			if out := getClientOutputBufferMemoryUsage(c); out > maxOut {
+				maxOut = out
+			}
+			if c.flags&ClientBlocked != 0 {
+				blocked++
+			}
+		}
+		field("connected_clients:%d", s.clients.Len())
+		field("cluster_connections:%d", 0)
+		field("maxclients:%d", ConfigDefaultMaxClients)
+		field("client_recent_max_input_buffer:%d", maxIn)
+		field("client_recent_max_output_buffer:%d", maxOut)
+		field("blocked_clients:%d", blocked)
+		field("tracking_clients:%d", s.trackingClients)
+		field("clients_in_timeout_table:%d", 0)
+		field("total_blocking_keys:%d", 0)
+		field("total_blocking_keys_on_nokey:%d", 0)
+	}
+
+	// Memory
+	if section("Memory", sections["memory"]) {
+		mh := getMemoryOverheadData()
+		used := mh.totalAllocated
+		rss := mh.allocatorResident
+		totalSystemMem := totalSystemMemory()
+
+		field("used_memory:%d", used)
+		field("used_memory_human:%s", bytesToHuman(used))
+		field("used_memory_rss:%d", rss)
+		field("used_memory_rss_human:%s", bytesToHuman(rss))
+		field("used_memory_peak:%d", mh.peakAllocated)
+		field("used_memory_peak_human:%s", bytesToHuman(mh.peakAllocated))
+		field("used_memory_peak_perc:%.2f%%", mh.peakPerc)
+		field("used_memory_overhead:%d", mh.overheadTotal)
+		field("used_memory_startup:%d", mh.startupAllocated)
+		field("used_memory_dataset:%d", mh.dataset)
+		field("used_memory_dataset_perc:%.2f%%", mh.datasetPerc)
+		field("allocator_allocated:%d", mh.allocatorAllocated)
+		field("allocator_active:%d", mh.allocatorActive)
+		field("allocator_resident:%d", mh.allocatorResident)
+		field("total_system_memory:%d", totalSystemMem)
+		field("total_system_memory_human:%s", bytesToHuman(totalSystemMem))
+		field("number_of_cached_scripts:%d", s.lua.scripts.Len())
+		field("number_of_functions:%d", s.functions.functions.Len())
+		field("number_of_libraries:%d", s.functions.libraries.Len())
+		field("maxmemory:%d", s.maxmemory)
+		field("maxmemory_human:%s", bytesToHuman(s.maxmemory))
+		field("maxmemory_policy:%s", maxmemoryPolicyName(s.maxmemoryPolicy))
+		field("mem_fragmentation_ratio:%.2f", mh.totalFrag)
+		field("mem_fragmentation_bytes:%d", mh.totalFragBytes)
+		field("mem_clients_slaves:%d", 0)
+		field("mem_clients_normal:%d", mh.clientsNormal)
+		field("mem_allocator:%s", runtime.Version())
+		field("lazyfree_pending_objects:%d", db.LazyfreePendingObjects())
+	}
+
+	// Persistence
+	if section("Persistence", sections["persistence"]) {
+		field("loading:%d", 0)
+		field("async_loading:%d", 0)
+		field("rdb_changes_since_last_save:%d", s.dirty)
+		field("rdb_bgsave_in_progress:%d", 0)
+		field("rdb_last_save_time:%d", s.lastSave)
+		field("rdb_last_bgsave_status:%s", "ok")
+		field("rdb_last_bgsave_time_sec:%d", -1)
+		field("rdb_current_bgsave_time_sec:%d", -1)
+		field("rdb_saves:%d", 0)
+		field("aof_enabled:%d", 0)
+		field("aof_rewrite_in_progress:%d", 0)
+		field("aof_rewrite_scheduled:%d", 0)
+		field("aof_last_rewrite_time_sec:%d", -1)
+		field("aof_current_rewrite_time_sec:%d", -1)
+		field("aof_last_bgrewrite_status:%s", "ok")
+		field("aof_rewrites:%d", 0)
+		field("aof_last_write_status:%s", "ok")
+	}
+
+	// Stats
+	if section("Stats", sections["stats"]) {
+		var hits, misses, expired, evicted uint64
+		for _, rdb := range s.db {
+			hits += rdb.StatKeySpaceHits
+			misses += rdb.StatKeySpaceMisses
+			expired += rdb.StatExpiredKeys
+			evicted += rdb.StatEvictedKeys
+		}
+		field("total_connections_received:%d", s.statNumConnections)
+		field("total_commands_processed:%d", s.statNumCommands)
+		field("instantaneous_ops_per_sec:%d", s.getInstantaneousMetric(StatsMetricCommand))
+		field("total_net_input_bytes:%d", s.statNetInputBytes)
+		field("total_net_output_bytes:%d", s.statNetOutputBytes)
+		field("total_net_repl_input_bytes:%d", 0)
+		field("total_net_repl_output_bytes:%d", 0)
+		field("instantaneous_input_kbps:%.2f", float64(s.getInstantaneousMetric(StatsMetricNetInput))/1024)
+		field("instantaneous_output_kbps:%.2f", float64(s.getInstantaneousMetric(StatsMetricNetOutput))/1024)
+		field("instantaneous_input_repl_kbps:%.2f", 0.0)
+		field("instantaneous_output_repl_kbps:%.2f", 0.0)
+		field("rejected_connections:%d", s.statRejectedConn)
+		field("sync_full:%d", 0)
+		field("sync_partial_ok:%d", 0)
+		field("sync_partial_err:%d", 0)
+		field("expired_keys:%d", expired)
+		field("evicted_keys:%d", evicted)
+		field("evicted_clients:%d", 0)
+		field("lazyfreed_objects:%d", db.LazyfreedObjects())
+		field("keyspace_hits:%d", hits)
+		field("keyspace_misses:%d", misses)
+		field("pubsub_channels:%d", s.pubsubChannels.Len())
+		field("pubsub_patterns:%d", s.pubsubPatterns.Len())
+		field("pubsubshard_channels:%d", 0)
+		field("latest_fork_usec:%d", 0)
+		field("total_forks:%d", 0)
+		field("tracking_total_keys:%d", trackingGetTotalKeys())
+		field("tracking_total_items:%d", trackingGetTotalItems())
+		field("tracking_total_prefixes:%d", trackingGetTotalPrefixes())
+		field("unexpected_error_replies:%d", s.statUnexpectedErrorReplies)
+		field("total_error_replies:%d", s.statTotalErrorReplies)
+		field("total_reads_processed:%d", s.statTotalReadsProcessed)
+		field("total_writes_processed:%d", s.statTotalWritesProcessed)
+		field("io_threaded_reads_processed:%d", s.statIOReadsProcessed)
+		field("io_threaded_writes_processed:%d", s.statIOWritesProcessed)
+		field("acl_access_denied_auth:%d", aclInfo.userAuthFailures)
+		field("acl_access_denied_cmd:%d", aclInfo.invalidCmdAccesses)
+		field("acl_access_denied_key:%d", aclInfo.invalidKeyAccesses)
+		field("acl_access_denied_channel:%d", aclInfo.invalidChannelAccesses)
+	}
+
+	// Replication
+	if section("Replication", sections["replication"]) {
+		field("role:%s", "master")
+		field("connected_slaves:%d", 0)
+		field("master_failover_state:%s", "no-failover")
+		field("master_replid:%s", s.replId)
+		field("master_replid2:%s", strings.Repeat("0", ConfigRunIdSize))
+		field("master_repl_offset:%d", 0)
+		field("second_repl_offset:%d", -1)
+		field("repl_backlog_active:%d", 0)
+		field("repl_backlog_size:%d", ConfigDefaultReplBacklogSize)
+		field("repl_backlog_first_byte_offset:%d", 0)
+		field("repl_backlog_histlen:%d", 0)
+	}
+
+	// CPU
+	if section("CPU", sections["cpu"]) {
+		selfSys, selfUser := rusageTimes(RusageSelf)
+		childSys, childUser := rusageTimes(RusageChildren)
+		threadSys, threadUser := rusageTimes(RusageThread)
+		field("used_cpu_sys:%s", selfSys)
+		field("used_cpu_user:%s", selfUser)
+		field("used_cpu_sys_children:%s", childSys)
+		field("used_cpu_user_children:%s", childUser)
+		field("used_cpu_sys_main_thread:%s", threadSys)
+		field("used_cpu_user_main_thread:%s", threadUser)
+	}
+
+	// Modules, there are no modules so "everything" adds no module
+	// generated sections.
+	section("Modules", everything || sections["module_list"] || sections["modules"])
+
+	// Command statistics
+	if section("Commandstats", sections["commandstats"]) {
+		var cmds []RedisCommand
+		var collect func(cmd RedisCommand)
+		collect = func(cmd RedisCommand) {
+			if cmd.GetCalls() != 0 || cmd.GetFailedCalls() != 0 || cmd.GetRejectedCalls() != 0 {
+				cmds = append(cmds, cmd)
+			}
+			for _, sub := range cmd.SubCommands() {
+				collect(sub)
+			}
+		}
+		s.commands.Range(func(_ string, cmd RedisCommand) bool {
+			collect(cmd)
+			return true
+		})
+		sort.Slice(cmds, func(i, j int) bool { return cmds[i].Fullname() < cmds[j].Fullname() })
+		for _, cmd := range cmds {
+			var perCall float64
+			if cmd.GetCalls() != 0 {
+				perCall = float64(cmd.MicroSeconds()) / float64(cmd.GetCalls())
+			}
+			field("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+				getSafeInfoString(cmd.Fullname()), cmd.GetCalls(), cmd.MicroSeconds(), perCall,
+				cmd.GetRejectedCalls(), cmd.GetFailedCalls())
+		}
+	}
+
+	// Error statistics
+	if section("Errorstats", sections["errorstats"]) {
+		s.errors.Range(func(code []byte, e *redisError) bool {
+			field("errorstat_%s:count=%d", code, e.count)
+			return true
+		})
+	}
+
+	// Latency by percentile distribution per command
+	if section("Latencystats", sections["latencystats"]) && s.latencyTrackingEnabled {
+		for _, cmd := range sortedCommandsWithLatencyHistogram() {
+			field("latency_percentiles_usec_%s:%s", getSafeInfoString(cmd.Fullname()),
+				fillPercentileDistributionLatencies(cmd.LatencyHistogram()))
+		}
+	}
+
+	// Cluster
+	if section("Cluster", sections["cluster"]) {
+		field("cluster_enabled:%d", 0)
+	}
+
+	// Key space
+	if section("Keyspace", sections["keyspace"]) {
+		for j, rdb := range s.db {
+			keys := rdb.Size()
+			if keys == 0 {
+				continue
+			}
+			field("db%d:keys=%d,expires=%d,avg_ttl=%d", j, keys, rdb.ExpiresSize(), rdb.AvgTTL())
+		}
+	}
+
+	return info.String()
+}
+
+// InfoCmd implements the INFO command.
+type InfoCmd struct {
+	c *Client
+}
+
+// NewInfoCmd returns a new InfoCmd.
+func NewInfoCmd(c *Client) *InfoCmd {
+	return &InfoCmd{c: c}
+}
+
+// Info implements INFO [section [section ...]]
+func (cmd *InfoCmd) Info() {
+	args := make([]string, 0, cmd.c.argc-1)
+	for _, arg := range cmd.c.argv[1:cmd.c.argc] {
+		args = append(args, arg.Value.(string))
+	}
+	sections, all, everything := genInfoSectionDict(args)
+	cmd.c.addReplyVerbatim(server.genRedisInfoString(sections, all, everything), "txt")
+}
+
+func infoCommand(c *Client) error {
+	NewInfoCmd(c).Info()
+	return nil
+}
+
+// getRandomHexChars returns a random string of n hex characters, used for
+// the run id and the replication id.
+func getRandomHexChars(n int) string {
+	buf := make([]byte, (n+1)/2)
+	if _, err := rand.Read(buf); err != nil {
+		// The ids only need to be unique, not secure.
+		_, _ = mathrand.Read(buf)
+	}
+	return hex.EncodeToString(buf)[:n]
+}
@@ -0,0 +1,127 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+// infoSections sends INFO with the given arguments and returns the reply
+// split in sections, the section name -> the fields of the section.
+func infoSections(t *testing.T, c *Client, conn *TestConn, args ...string) map[string]map[string]string {
+	reply := sendCommand(c, conn, append([]string{"INFO"}, args...)...)
+	if !strings.HasPrefix(reply, "$") {
+		t.Fatalf("INFO replied %q", reply)
+	}
+	body := reply[strings.Index(reply, "\r\n")+2 : len(reply)-2]
+	sections := make(map[string]map[string]string)
+	var cur map[string]string
+	for _, line := range strings.Split(body, "\r\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "# "):
+			cur = make(map[string]string)
+			sections[line[2:]] = cur
+		default:
+			field, value, ok := strings.Cut(line, ":")
+			if !ok || cur == nil {
+				t.Fatalf("malformed INFO line %q", line)
+			}
+			cur[field] = value
+		}
+	}
+	return sections
+}
+
+func TestInfoSections(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	sections := infoSections(t, c, conn)
+	for _, name := range []string{"Server", "Clients", "Memory", "Persistence", "Stats", "Replication", "CPU", "Modules", "Errorstats", "Cluster", "Keyspace"} {
+		if _, ok := sections[name]; !ok {
+			t.Errorf("default INFO has no %s section", name)
+		}
+	}
+	if _, ok := sections["Commandstats"]; ok {
+		t.Errorf("default INFO has the Commandstats section")
+	}
+	if got := sections["Server"]["redis_version"]; got != RedisVersion {
+		t.Errorf("redis_version is %q", got)
+	}
+	if got := sections["Replication"]["role"]; got != "master" {
+		t.Errorf("role is %q", got)
+	}
+	if got := len(sections["Replication"]["master_replid"]); got != ConfigRunIdSize {
+		t.Errorf("master_replid has %d chars", got)
+	}
+
+	sections = infoSections(t, c, conn, "CLIENTS", "server")
+	if len(sections) != 2 || sections["Clients"] == nil || sections["Server"] == nil {
+		t.Fatalf("INFO clients server replied sections %v", sections)
+	}
+	if len(infoSections(t, c, conn, "nosuchsection")) != 0 {
+		t.Fatalf("INFO of an unknown section is not empty")
+	}
+
+	sections = infoSections(t, c, conn, "all")
+	for _, name := range []string{"Commandstats", "Latencystats", "Keyspace"} {
+		if _, ok := sections[name]; !ok {
+			t.Errorf("INFO all has no %s section", name)
+		}
+	}
+	sections = infoSections(t, c, conn, "default", "commandstats")
+	if sections["Commandstats"] == nil || sections["Server"] == nil {
+		t.Fatalf("INFO default commandstats replied sections %v", sections)
+	}
+}
+
+func TestInfoStats(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	cmd, _ := server.commands.Get("get")
+	cmd.SetCalls(0)
+	cmd.SetFailedCalls(0)
+	cmd.SetRejectedCalls(0)
+	server.resetErrorTableStats()
+
+	sendCommand(c, conn, "GET", "info:k")
+	sendCommand(c, conn, "GET", "info:k", "b")
+	sendCommand(c, conn, "SET", "info:k", "v")
+	sendCommand(c, conn, "SETEX", "info:k", "x", "v")
+
+	stat := infoSections(t, c, conn, "commandstats")["Commandstats"]["cmdstat_get"]
+	if !strings.HasPrefix(stat, "calls=1,") || !strings.HasSuffix(stat, ",rejected_calls=1,failed_calls=0") {
+		t.Errorf("cmdstat_get is %q", stat)
+	}
+	if stat := infoSections(t, c, conn, "commandstats")["Commandstats"]["cmdstat_setex"]; !strings.HasSuffix(stat, ",failed_calls=1") {
+		t.Errorf("cmdstat_setex is %q", stat)
+	}
+	if got := infoSections(t, c, conn, "errorstats")["Errorstats"]["errorstat_ERR"]; got != "count=2" {
+		t.Errorf("errorstat_ERR is %q", got)
+	}
+
+	sections := infoSections(t, c, conn, "keyspace", "stats")
+	if got := sections["Keyspace"]["db0"]; !strings.HasPrefix(got, "keys=") || !strings.Contains(got, ",expires=") {
+		t.Errorf("db0 is %q", got)
+	}
+	if got := sections["Stats"]["total_error_replies"]; got == "0" || got == "" {
+		t.Errorf("total_error_replies is %q", got)
+	}
+}
+
+func TestBytesToHuman(t *testing.T) {
+	cases := []struct {
+		n    int64
+		want string
+	}{
+		{100, "100B"},
+		{2048, "2.00K"},
+		{1024 * 1024 * 3 / 2, "1.50M"},
+		{1024 * 1024 * 1024, "1.00G"},
+	}
+	for _, tc := range cases {
+		if got := bytesToHuman(tc.n); got != tc.want {
+			t.Errorf("bytesToHuman(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
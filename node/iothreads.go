@@ -0,0 +1,238 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/*-----------------------------------------------------------------------------
+ * Threaded I/O
+ *
+ * The commands are always run by the event loop. With io-threads greater
+ * than 1 the replies are queued in clientsPendingWrite, and written before
+ * the event loop sleeps by the I/O threads: goroutines writing the
+ * connections in parallel. With io-threads-do-reads the readable clients are
+ * queued in clientsPendingRead too, the I/O threads read their query and
+ * parse the first command, flagged ClientPendingCommand, that the event loop
+ * runs once they are done. The event loop serves its own share of the
+ * clients and waits for the I/O threads, a client is never used by two
+ * goroutines at the same time.
+ *----------------------------------------------------------------------------*/
+
+// IOThreadsMaxNum is the max value of io-threads.
+const IOThreadsMaxNum = 128
+
+// Operations of the I/O threads
+const (
+	ioThreadsOpRead = iota
+	ioThreadsOpWrite
+)
+
+// ioThread serves the clients the event loop assigned to it.
+type ioThread struct {
+	ops     chan int        // the operation to perform on the clients, closed to stop
+	clients []*Client       // the clients assigned to the thread
+	done    *sync.WaitGroup // shared by the threads, the event loop waits on it
+}
+
+func (t *ioThread) run() {
+	for op := range t.ops {
+		t.process(op)
+		t.done.Done()
+	}
+}
+
+// process performs the operation on the clients of the thread, the results
+// are kept in the clients for the event loop.
+func (t *ioThread) process(op int) {
+	for _, c := range t.clients {
+		if op == ioThreadsOpWrite {
+			c.ioWritten, c.ioErr = c.writeReplies()
+			continue
+		}
+		c.ioReadLen, c.ioErr = c.readQuery()
+		if c.ioErr == nil {
+			// Parse the first command, see processInputBuffer.
+			c.processInputBuffer()
+		}
+	}
+}
+
+// initThreadedIO starts the I/O threads if io-threads is greater than 1, the
+// first one is the event loop itself.
+func (s *RedisServer) initThreadedIO() {
+	if s.ioThreadsNum <= 1 || s.ioThreadsActive {
+		return
+	}
+	done := &sync.WaitGroup{}
+	s.ioThreads = make([]*ioThread, s.ioThreadsNum)
+	for j := range s.ioThreads {
+		t := &ioThread{done: done}
+		if j > 0 {
+			t.ops = make(chan int)
+			go t.run()
+		}
+		s.ioThreads[j] = t
+	}
+	s.ioThreadsActive = true
+}
+
+// killIOThreads stops the I/O threads, the queued clients are served by the
+// event loop from now on.
+func (s *RedisServer) killIOThreads() {
+	for _, t := range s.ioThreads {
+		if t.ops != nil {
+			close(t.ops)
+		}
+	}
+	s.ioThreads = nil
+	s.ioThreadsActive = false
+}
+
+// connThreadSafe reports whether the connection can be read and written by
+// the I/O threads.
+func connThreadSafe(conn Conn) bool {
+	ts, ok := conn.(ThreadSafeConn)
+	return !ok || ts.ThreadSafe()
+}
+
+// ioThreadsFanOut performs the operation on the clients, assigned round
+// robin to the I/O threads, and returns once they are all served. The event
+// loop serves them alone if there are too few clients to be worth it. It
+// returns true if the I/O threads were used.
+func (s *RedisServer) ioThreadsFanOut(op int, clients []*Client) bool {
+	if !s.ioThreadsActive || len(clients) < 2*len(s.ioThreads) {
+		(&ioThread{clients: clients}).process(op)
+		return false
+	}
+	for j, c := range clients {
+		t := s.ioThreads[j%len(s.ioThreads)]
+		if !connThreadSafe(c.connection) {
+			t = s.ioThreads[0]
+		}
+		t.clients = append(t.clients, c)
+	}
+	done := s.ioThreads[0].done
+	for _, t := range s.ioThreads[1:] {
+		if len(t.clients) > 0 {
+			done.Add(1)
+			t.ops <- op
+		}
+	}
+	s.ioThreads[0].process(op)
+	done.Wait()
+	for _, t := range s.ioThreads {
+		t.clients = t.clients[:0]
+	}
+	return true
+}
+
+// postponeClientRead queues the readable client to be read by the I/O
+// threads, if io-threads-do-reads is enabled. It returns false if the client
+// should be read right away.
+func postponeClientRead(c *Client) bool {
+	if c.flags&ClientPendingRead != 0 {
+		return true
+	}
+	if !server.ioThreadsActive || !server.ioThreadsDoReads || server.processingEventsWhileBlocked ||
+		c.flags&(ClientMaster|ClientSlave|ClientBlocked) != 0 {
+		return false
+	}
+	c.flags |= ClientPendingRead
+	server.clientsPendingRead.AddNodeTail(c)
+	return true
+}
+
+// postponeClientWrite queues the client to have its replies written before
+// the event loop sleeps, by the I/O threads. It returns false if the reply
+// should be written right away.
+func postponeClientWrite(c *Client) bool {
+	if !server.ioThreadsActive || server.processingEventsWhileBlocked ||
+		c.flags&(ClientScript|ClientMaster) != 0 {
+		return false
+	}
+	if c.flags&ClientPendingWrite == 0 {
+		c.flags |= ClientPendingWrite
+		server.clientsPendingWrite.AddNodeTail(c)
+	}
+	return true
+}
+
+// popPendingClients empties the queue of the clients, their flag is cleared
+// by the caller once they are served.
+func popPendingClients(queue *db.List[*Client]) []*Client {
+	clients := make([]*Client, 0, queue.Len())
+	for queue.Len() > 0 {
+		node := queue.Head
+		_ = queue.RemoveNode(node)
+		clients = append(clients, node.Value)
+	}
+	return clients
+}
+
+// handleClientsWithPendingReads reads the queries of the clients queued by
+// postponeClientRead, with the I/O threads, then processes their commands.
+// It returns the number of clients processed.
+func (s *RedisServer) handleClientsWithPendingReads() int {
+	if s.clientsPendingRead.Len() == 0 {
+		return 0
+	}
+	clients := popPendingClients(s.clientsPendingRead)
+	threaded := s.ioThreadsFanOut(ioThreadsOpRead, clients)
+	for _, c := range clients {
+		c.flags &= ^ClientPendingRead
+		// The client may have been freed by the command of another one.
+		if c.connection == nil {
+			continue
+		}
+		s.statTotalReadsProcessed++
+		if threaded {
+			s.statIOReadsProcessed++
+		}
+		n, err := c.ioReadLen, c.ioErr
+		c.ioReadLen, c.ioErr = 0, nil
+		if c.ioProtocolError != "" {
+			// The error reply updates the stats and the write queue.
+			c.AddReplyError(c.ioProtocolError)
+			c.ioProtocolError = ""
+		}
+		c.processReadQuery(n, err)
+	}
+	s.processUnblockedClients()
+	trackingBroadcastInvalidationMessages()
+	return len(clients)
+}
+
+// handleClientsWithPendingWrites writes the replies of the clients queued by
+// postponeClientWrite, with the I/O threads. The write handler is installed
+// for the clients whose connection didn't accept all of them. It returns the
+// number of clients processed.
+func (s *RedisServer) handleClientsWithPendingWrites() int {
+	if s.clientsPendingWrite.Len() == 0 {
+		return 0
+	}
+	clients := popPendingClients(s.clientsPendingWrite)
+	// The clients closed asap are freed anyway.
+	live := clients[:0]
+	for _, c := range clients {
+		c.flags &= ^ClientPendingWrite
+		if c.flags&ClientCloseASAP == 0 {
+			live = append(live, c)
+		}
+	}
+	threaded := s.ioThreadsFanOut(ioThreadsOpWrite, live)
+	for _, c := range live {
+		if c.connection == nil {
+			continue
+		}
+		s.statTotalWritesProcessed++
+		if threaded {
+			s.statIOWritesProcessed++
+		}
+		n, err := c.ioWritten, c.ioErr
+		c.ioWritten, c.ioErr = 0, nil
+		c.processWrittenReplies(n, err, false)
+	}
+	return len(live)
+}
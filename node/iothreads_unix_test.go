@@ -0,0 +1,239 @@
+//go:build linux
+// +build linux
+
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// queryConn is a TestConn reading the query it is given.
+type queryConn struct {
+	TestConn
+	query []byte
+}
+
+func (q *queryConn) Read() ([]byte, error) {
+	data := q.query
+	q.query = nil
+	return data, nil
+}
+
+// startIOThreads starts n I/O threads for the duration of the test.
+func startIOThreads(tb testing.TB, n int, doReads bool) {
+	tb.Helper()
+	server.ioThreadsNum = n
+	server.ioThreadsDoReads = doReads
+	server.initThreadedIO()
+	tb.Cleanup(func() {
+		server.killIOThreads()
+		server.ioThreadsNum = 1
+		server.ioThreadsDoReads = false
+	})
+}
+
+func TestIOThreadsWrites(t *testing.T) {
+	startIOThreads(t, 4, false)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	clients := make([]*Client, 8)
+	conns := make([]*TestConn, len(clients))
+	for j := range clients {
+		clients[j], conns[j] = newTestClient()
+		defer freeClient(clients[j])
+	}
+
+	// The replies are written before the event loop sleeps.
+	writes := server.statIOWritesProcessed
+	for j, c := range clients {
+		if got := sendCommand(c, conns[j], "SET", "io:"+strconv.Itoa(j), strconv.Itoa(j)); got != "" {
+			t.Fatalf("SET replied %q right away", got)
+		}
+		if c.flags&ClientPendingWrite == 0 {
+			t.Fatalf("the client is not queued")
+		}
+	}
+	if n := server.handleClientsWithPendingWrites(); n != len(clients) {
+		t.Fatalf("%d clients written", n)
+	}
+	for j, conn := range conns {
+		if got := conn.Buffer.String(); got != "+OK\r\n" {
+			t.Errorf("client %d got %q", j, got)
+		}
+	}
+	if got := server.statIOWritesProcessed - writes; got != uint64(len(clients)) {
+		t.Errorf("%d threaded writes", got)
+	}
+
+	// The connection not accepting the whole reply gets the write handler.
+	conns[0].full = true
+	sendCommand(clients[0], conns[0], "GET", "io:0")
+	server.handleClientsWithPendingWrites()
+	if !clients[0].hasPendingReplies() || clients[0].flags&ClientPendingWrite != 0 {
+		t.Errorf("the reply is not kept for the write handler")
+	}
+	conns[0].full = false
+	clients[0].writeToClient(true)
+	if got := conns[0].Buffer.String(); got != bulkString("0") {
+		t.Errorf("the pending reply is %q", got)
+	}
+
+	// A freed client is removed from the queue.
+	sendCommand(clients[1], conns[1], "GET", "io:1")
+	freeClient(clients[1])
+	if server.clientsPendingWrite.Len() != 0 {
+		t.Errorf("the freed client is still queued")
+	}
+}
+
+func TestIOThreadsReads(t *testing.T) {
+	startIOThreads(t, 2, true)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	clients := make([]*Client, 4)
+	conns := make([]*queryConn, len(clients))
+	for j := range clients {
+		conns[j] = &queryConn{}
+		server.nextClientId++
+		clients[j] = NewClient(server.nextClientId, 0, conns[j], 2, server.db[0])
+		server.linkClient(clients[j])
+		defer freeClient(clients[j])
+	}
+
+	reads := server.statIOReadsProcessed
+	for j, c := range clients {
+		key := "io:" + strconv.Itoa(j)
+		conns[j].query = []byte(fmt.Sprintf("*3\r\n$3\r\nSET\r\n$%d\r\n%s\r\n$1\r\n%d\r\nGET %s\r\n", len(key), key, j, key))
+		c.readQueryFromClient()
+		if c.flags&ClientPendingRead == 0 || len(conns[j].query) == 0 {
+			t.Fatalf("the read is not postponed")
+		}
+	}
+	server.beforeSleep()
+
+	for j, c := range clients {
+		if c.flags&(ClientPendingRead|ClientPendingCommand|ClientPendingWrite) != 0 {
+			t.Errorf("client %d flags %b", j, c.flags)
+		}
+		want := "+OK\r\n" + bulkString(strconv.Itoa(j))
+		if got := conns[j].Buffer.String(); got != want {
+			t.Errorf("client %d got %q, want %q", j, got, want)
+		}
+	}
+	if got := server.statIOReadsProcessed - reads; got != uint64(len(clients)) {
+		t.Errorf("%d threaded reads", got)
+	}
+	if info := server.genRedisInfoString(map[string]bool{"server": true}, false, false); !strings.Contains(info, "io_threads_active:1\r\n") {
+		t.Errorf("io_threads_active is not reported")
+	}
+
+	// The protocol errors parsed by the threads are replied by the event loop.
+	errors := server.statTotalErrorReplies
+	for j, c := range clients {
+		conns[j].Buffer.Reset()
+		conns[j].query = []byte("*abc\r\n")
+		c.readQueryFromClient()
+	}
+	server.beforeSleep()
+	for j, c := range clients {
+		if got, want := conns[j].Buffer.String(), "-ERR Protocol error: invalid multibulk length\r\n"; got != want {
+			t.Errorf("client %d got %q, want %q", j, got, want)
+		}
+		if c.connection != nil {
+			t.Errorf("client %d is not closed", j)
+		}
+	}
+	if got := server.statTotalErrorReplies - errors; got != uint64(len(clients)) {
+		t.Errorf("%d error replies", got)
+	}
+}
+
+// BenchmarkIOThreads measures the throughput of pipelined SET commands sent
+// by concurrent clients, served by the event loop alone or with the I/O
+// threads.
+func BenchmarkIOThreads(b *testing.B) {
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("io-threads=%d", threads), func(b *testing.B) {
+			benchmarkIOThreads(b, threads, 50, 16)
+		})
+	}
+}
+
+func benchmarkIOThreads(b *testing.B, threads, clients, pipeline int) {
+	startIOThreads(b, threads, true)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	r, err := NewReactor([]net.Listener{ln}, make(chan os.Signal))
+	if err != nil {
+		b.Fatal(err)
+	}
+	r.SetHandler(RedisHandler{server: server})
+	go r.Run()
+	defer func() {
+		r.Stop()
+		<-r.done
+		// The event loop is stopped, free its clients.
+		for _, c := range server.connClients {
+			freeClient(c)
+		}
+	}()
+
+	conns := make([]net.Conn, clients)
+	for j := range conns {
+		if conns[j], err = net.Dial("tcp", ln.Addr().String()); err != nil {
+			b.Fatal(err)
+		}
+		defer conns[j].Close()
+	}
+
+	var batch bytes.Buffer
+	for j := 0; j < pipeline; j++ {
+		batch.WriteString("*3\r\n$3\r\nSET\r\n$5\r\nbench\r\n$5\r\nvalue\r\n")
+	}
+	replies := len("+OK\r\n") * pipeline
+
+	batches := int64((b.N + pipeline - 1) / pipeline)
+	b.SetBytes(int64(batch.Len()) / int64(pipeline))
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			buf := make([]byte, replies)
+			for atomic.AddInt64(&batches, -1) >= 0 {
+				if _, err := conn.Write(batch.Bytes()); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(conn)
+	}
+	wg.Wait()
+	b.StopTimer()
+	close(errs)
+	for err := range errs {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,738 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* The latency monitor allows to easily observe the sources of latency in
+ * a Redis instance using the LATENCY command. Different latency sources are
+ * monitored, like disk I/O, execution of commands, fork system call, and so
+ * forth.
+ *
+ * Every event is sampled when it lasts longer than the
+ * latency-monitor-threshold, in milliseconds, in a time series of the last
+ * LatencyTsLen samples, at most one per second.
+ *
+ * This file also implements the per command latency histograms, reported by
+ * LATENCY HISTOGRAM and the latencystats section of INFO. */
+
+const (
+	LatencyTsLen     = 160 // History length for every monitored event.
+	LatencyGraphCols = 80  // Columns of the graph of LATENCY GRAPH.
+)
+
+// The latency events sampled by the monitor.
+const (
+	LatencyEventCommand       = "command"        // Regular commands.
+	LatencyEventFastCommand   = "fast-command"   // Commands flagged CmdFast.
+	LatencyEventExpireCycle   = "expire-cycle"   // The active expire cycle of the cron.
+	LatencyEventEvictionCycle = "eviction-cycle" // The eviction of keys to free memory.
+	LatencyEventAofFsync      = "aof-fsync"      // The fsync of the AOF file.
+	LatencyEventRdbSave       = "rdb-save"       // A synchronous RDB save.
+)
+
+// The range and precision of the per command latency histograms, in
+// nanoseconds.
+const (
+	LatencyHistogramMinValue    = 1          // >= 1 nanosec
+	LatencyHistogramMaxValue    = 1000000000 // <= 1 secs
+	LatencyHistogramPrecision   = 2          // Maintain a value precision of 2 significant digits across LatencyHistogramMinValue and LatencyHistogramMaxValue range.
+	LatencyHistogramFirstBucket = 1024       // The first bucket of the LATENCY HISTOGRAM reply, then growing as powers of two.
+)
+
+// latencySample is a latency sample of an event.
+type latencySample struct {
+	time    int64  // Unix time of the sample, in seconds.
+	latency uint32 // Latency in milliseconds.
+}
+
+// latencyTimeSeries is the latency time series for a given event.
+type latencyTimeSeries struct {
+	idx     int                         // Index of the next sample to store.
+	max     uint32                      // Max latency observed for this event.
+	samples [LatencyTsLen]latencySample // Latest history.
+}
+
+// latencyStats is the latency statistics of an event, as analyzed by the
+// LATENCY DOCTOR report.
+type latencyStats struct {
+	allTimeHigh uint32 // Absolute max observed since latest reset.
+	avg         uint32 // Average of current samples.
+	min         uint32 // Min of current samples.
+	max         uint32 // Max of current samples.
+	mad         uint32 // Mean absolute deviation.
+	samples     uint32 // Number of non-zero samples.
+	period      int64  // Number of seconds since first event and now.
+}
+
+// latencyAddSample adds the specified sample to the specified time series
+// "event". This function is usually called via latencyAddSampleIfNeeded(),
+// that is a check against the configured threshold.
+func latencyAddSample(event string, latency int64) {
+	ts, ok := server.latencyEvents[event]
+	if !ok {
+		ts = &latencyTimeSeries{}
+		server.latencyEvents[event] = ts
+	}
+	if latency > math.MaxUint32 {
+		latency = math.MaxUint32
+	}
+	l := uint32(latency)
+	now := time.Now().Unix()
+
+	if l > ts.max {
+		ts.max = l
+	}
+
+	// If the previous sample is in the same second, we update our old sample
+	// if this latency is > of the old one, or just return.
+	prev := (ts.idx + LatencyTsLen - 1) % LatencyTsLen
+	if ts.samples[prev].time == now {
+		if l > ts.samples[prev].latency {
+			ts.samples[prev].latency = l
+		}
+		return
+	}
+
+	ts.samples[ts.idx].time = now
+	ts.samples[ts.idx].latency = l
+	ts.idx = (ts.idx + 1) % LatencyTsLen
+}
+
+// latencyAddSampleIfNeeded adds the latency of the event, in milliseconds,
+// if the latency monitor is enabled and the event is slower than its
+// threshold.
+func latencyAddSampleIfNeeded(event string, latency int64) {
+	if server.latencyMonitorThreshold != 0 && latency >= server.latencyMonitorThreshold {
+		latencyAddSample(event, latency)
+	}
+}
+
+// latencyResetEvent resets data for the specified event, or all the events
+// data if event is "". It returns the number of events that were reset.
+func latencyResetEvent(event string) int {
+	resets := 0
+	for name := range server.latencyEvents {
+		if event == "" || strings.EqualFold(name, event) {
+			delete(server.latencyEvents, name)
+			resets++
+		}
+	}
+	return resets
+}
+
+// latencyEventNames returns the names of the sampled events, sorted.
+func latencyEventNames() []string {
+	names := make([]string, 0, len(server.latencyEvents))
+	for name := range server.latencyEvents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// analyzeLatencyForEvent analyzes the samples available for the event and
+// returns the statistics of the event.
+func analyzeLatencyForEvent(event string) latencyStats {
+	var ls latencyStats
+	ts, ok := server.latencyEvents[event]
+	if !ok {
+		return ls
+	}
+	ls.allTimeHigh = ts.max
+
+	// First pass, populate everything but the MAD.
+	var sum uint64
+	for _, s := range ts.samples {
+		if s.time == 0 {
+			continue
+		}
+		ls.samples++
+		if ls.samples == 1 {
+			ls.min, ls.max = s.latency, s.latency
+		} else {
+			if ls.min > s.latency {
+				ls.min = s.latency
+			}
+			if ls.max < s.latency {
+				ls.max = s.latency
+			}
+		}
+		sum += uint64(s.latency)
+
+		// Track the oldest event time in ls.period.
+		if ls.period == 0 || s.time < ls.period {
+			ls.period = s.time
+		}
+	}
+
+	// So far avg is actually the sum of the latencies, and period is the
+	// oldest event time. We need to make the first an average and the
+	// second a range of seconds.
+	if ls.samples > 0 {
+		ls.avg = uint32(sum / uint64(ls.samples))
+		ls.period = time.Now().Unix() - ls.period
+		if ls.period == 0 {
+			ls.period = 1
+		}
+	}
+
+	// Second pass, compute MAD.
+	sum = 0
+	for _, s := range ts.samples {
+		if s.time == 0 {
+			continue
+		}
+		delta := int64(ls.avg) - int64(s.latency)
+		if delta < 0 {
+			delta = -delta
+		}
+		sum += uint64(delta)
+	}
+	if ls.samples > 0 {
+		ls.mad = uint32(sum / uint64(ls.samples))
+	}
+	return ls
+}
+
+// createLatencyReport creates a human readable report of the latency events
+// for this Redis instance, with advices to fix the latency issues.
+func createLatencyReport() string {
+	var report strings.Builder
+	var (
+		adviseSlowlogEnabled bool // Enable the slowlog.
+		adviseSlowlogTuning  bool // Reconfigure the slowlog.
+		adviseSlowlogInspect bool // Check your slowlog.
+		adviseScheduler      bool // Intrinsic latency.
+		adviseLargeObjects   bool // Deletion of large objects.
+		adviseMassEviction   bool // Avoid mass eviction of keys.
+		adviseDiskContention bool // Try to lower disk contention.
+		adviseBetterVM       bool // Better VM.
+		advices              int
+	)
+
+	// Return ASAP if the latency engine is disabled and it looks like it
+	// was never enabled so far.
+	if len(server.latencyEvents) == 0 && server.latencyMonitorThreshold == 0 {
+		return "I'm sorry, Dave, I can't do that. Latency monitoring is disabled in this Redis instance. You may use \"CONFIG SET latency-monitor-threshold <milliseconds>.\" in order to enable it. If we weren't in a deep space mission I'd suggest to take a look at https://redis.io/topics/latency-monitor.\n"
+	}
+
+	// Show all the events stats and add for each event some event-related
+	// comment depending on the values.
+	eventnum := 0
+	for _, event := range latencyEventNames() {
+		ts := server.latencyEvents[event]
+		ls := analyzeLatencyForEvent(event)
+		if ls.samples == 0 {
+			continue
+		}
+		if eventnum == 0 {
+			report.WriteString("Dave, I have observed latency spikes in this Redis instance. You don't mind talking about it, do you Dave?\n\n")
+		}
+		eventnum++
+
+		fmt.Fprintf(&report, "%d. %s: %d latency spikes (average %dms, mean deviation %dms, period %.2f sec). Worst all time event %dms.",
+			eventnum, event, ls.samples, ls.avg, ls.mad, float64(ls.period)/float64(ls.samples), ts.max)
+		report.WriteString("\n")
+
+		switch event {
+		case LatencyEventCommand:
+			// Potentially commands.
+			if server.slowlogLogSlowerThan < 0 || server.slowlogMaxLen == 0 {
+				adviseSlowlogEnabled = true
+				advices++
+			} else if server.slowlogLogSlowerThan/1000 > server.latencyMonitorThreshold {
+				adviseSlowlogTuning = true
+				advices++
+			}
+			adviseSlowlogInspect = true
+			adviseLargeObjects = true
+			advices += 2
+		case LatencyEventFastCommand:
+			// fast-command.
+			adviseScheduler = true
+			advices++
+		case LatencyEventExpireCycle:
+			// Expire cycle.
+			adviseLargeObjects = true
+			advices++
+		case LatencyEventEvictionCycle:
+			// Eviction cycle.
+			adviseLargeObjects = true
+			adviseMassEviction = true
+			advices += 2
+		case LatencyEventAofFsync:
+			// AOF and I/O.
+			adviseDiskContention = true
+			advices++
+		case LatencyEventRdbSave:
+			adviseDiskContention = true
+			adviseBetterVM = true
+			advices += 2
+		}
+	}
+
+	switch {
+	case eventnum == 0 && advices == 0:
+		report.WriteString("Dave, no latency spike was observed during the lifetime of this Redis instance, not in the slightest bit. I honestly think you ought to sleep better tonight.\n")
+	case eventnum > 0 && advices == 0:
+		report.WriteString("\nWhile there are latency events logged, I'm not able to suggest any easy fix. Please use the Redis community to get some help, providing this report in your help request.\n")
+	default:
+		// Add all the suggestions accumulated so far.
+		report.WriteString("\nI have a few advices for you:\n\n")
+
+		// Better VM.
+		if adviseBetterVM {
+			report.WriteString("- If you are using a virtual machine, consider upgrading it with a faster one using a hypervisior that provides less latency during disk I/O.\n")
+		}
+		// Slow log.
+		if adviseSlowlogEnabled {
+			fmt.Fprintf(&report, "- There are latency issues with potentially slow commands you are using. Try to enable the Slow Log Redis feature using the command 'CONFIG SET slowlog-log-slower-than %d'. If the Slow log is disabled Redis is not able to log slow commands execution for you.\n",
+				server.latencyMonitorThreshold*1000)
+		}
+		if adviseSlowlogTuning {
+			fmt.Fprintf(&report, "- Your current Slow Log configuration only logs events that are slower than your configured latency monitor threshold. Please use 'CONFIG SET slowlog-log-slower-than %d'.\n",
+				server.latencyMonitorThreshold*1000)
+		}
+		if adviseSlowlogInspect {
+			report.WriteString("- Check your Slow Log to understand what are the commands you are running which are too slow to execute. Please check https://redis.io/commands/slowlog for more information.\n")
+		}
+		// Intrinsic latency.
+		if adviseScheduler {
+			report.WriteString("- The system is slow to execute Redis code paths not containing system calls. This usually means the system does not provide Redis CPU time to run for long periods. You should try to:\n" +
+				"  1) Lower the system load.\n" +
+				"  2) Use a computer / VM just for Redis if you are running other software in the same system.\n" +
+				"  3) Check if you have a \"noisy neighbour\" problem.\n" +
+				"  4) Check with 'redis-cli --intrinsic-latency 100' what is the intrinsic latency in your system.\n")
+		}
+		// Disk contention.
+		if adviseDiskContention {
+			report.WriteString("- It is strongly advised to use local disks for persistence, especially if you are using AOF. Remote disks provided by platform-as-a-service providers are known to be slow.\n")
+		}
+		if adviseLargeObjects {
+			report.WriteString("- Deleting, expiring or evicting (because of maxmemory policy) large objects is a blocking operation. If you have very large objects that are often deleted, expired, or evicted, try to fragment those objects into multiple smaller objects.\n")
+		}
+		if adviseMassEviction {
+			report.WriteString("- Sudden changes to the 'maxmemory' setting via 'CONFIG SET', or allocation of large objects via sets or sorted sets intersections, may create sudden memory pressure forcing the server to block trying to evict keys. \n")
+		}
+	}
+	return report.String()
+}
+
+/* ---------------------- Latency Sparkline Graph --------------------------- */
+
+// sparklineSample is a sample of a sparkline, with its label.
+type sparklineSample struct {
+	value float64
+	label string
+}
+
+// sparklineSequence is the sequence of samples rendered by a sparkline.
+type sparklineSequence struct {
+	samples  []sparklineSample
+	labels   int
+	min, max float64
+}
+
+// add adds a sample to the sequence, the label is rendered vertically under
+// the sample if not empty.
+func (seq *sparklineSequence) add(value float64, label string) {
+	if label != "" {
+		seq.labels++
+	}
+	if len(seq.samples) == 0 {
+		seq.min, seq.max = value, value
+	} else {
+		if value < seq.min {
+			seq.min = value
+		} else if value > seq.max {
+			seq.max = value
+		}
+	}
+	seq.samples = append(seq.samples, sparklineSample{value: value, label: label})
+}
+
+const (
+	sparklineCharset     = "_-`"
+	sparklineCharsetFill = "_o#"
+	sparklineLabelMargin = 1 // Empty rows between the graph and the labels.
+)
+
+// sparklineRenderRange renders part of the sequence, from offset to
+// offset+length, as a graph of the given rows filled below the values.
+func sparklineRenderRange(output *strings.Builder, seq *sparklineSequence, rows, offset, length int) {
+	relmax := seq.max - seq.min
+	steps := len(sparklineCharset) * rows
+	if relmax == 0 {
+		relmax = 1
+	}
+
+	chars := make([]byte, length)
+	for row := 0; ; row++ {
+		loop := false
+		for j := range chars {
+			chars[j] = ' '
+		}
+		for j := 0; j < length; j++ {
+			s := &seq.samples[j+offset]
+			relval := s.value - seq.min
+			step := int(float64(int(relval*float64(steps))) / relmax)
+			if step < 0 {
+				step = 0
+			}
+			if step >= steps {
+				step = steps - 1
+			}
+
+			if row < rows {
+				// Print the character needed to create the sparkline.
+				charidx := step - ((rows - row - 1) * len(sparklineCharset))
+				loop = true
+				if charidx >= 0 && charidx < len(sparklineCharset) {
+					chars[j] = sparklineCharsetFill[charidx]
+				} else if charidx >= len(sparklineCharset) {
+					chars[j] = '|'
+				}
+			} else {
+				// Labels spacing.
+				if seq.labels > 0 && row-rows < sparklineLabelMargin {
+					loop = true
+					break
+				}
+				// Print the label if needed.
+				labelChar := row - rows - sparklineLabelMargin
+				if len(s.label) > labelChar {
+					loop = true
+					chars[j] = s.label[labelChar]
+				}
+			}
+		}
+		if !loop {
+			return
+		}
+		output.Write(chars)
+		output.WriteString("\n")
+	}
+}
+
+// sparklineRender renders the sequence as a filled graph of the given rows,
+// wrapping it every columns samples.
+func sparklineRender(output *strings.Builder, seq *sparklineSequence, columns, rows int) {
+	for j := 0; j < len(seq.samples); j += columns {
+		sublen := len(seq.samples) - j
+		if sublen > columns {
+			sublen = columns
+		}
+		if j != 0 {
+			output.WriteString("\n")
+		}
+		sparklineRenderRange(output, seq, rows, j, sublen)
+	}
+}
+
+// latencyCommandGenSparkeline creates the graph of LATENCY GRAPH, with the
+// samples of the event labeled with how long ago they happened.
+func latencyCommandGenSparkeline(event string, ts *latencyTimeSeries) string {
+	seq := &sparklineSequence{}
+	var min, max uint32
+	now := time.Now().Unix()
+	for j := 0; j < LatencyTsLen; j++ {
+		s := ts.samples[(ts.idx+j)%LatencyTsLen]
+		if s.time == 0 {
+			continue
+		}
+		// Update min and max.
+		if len(seq.samples) == 0 {
+			min, max = s.latency, s.latency
+		} else {
+			if s.latency > max {
+				max = s.latency
+			}
+			if s.latency < min {
+				min = s.latency
+			}
+		}
+		// Use as label the number of seconds / minutes / hours / days ago
+		// the event happened.
+		elapsed := now - s.time
+		var label string
+		switch {
+		case elapsed < 60:
+			label = fmt.Sprintf("%ds", elapsed)
+		case elapsed < 3600:
+			label = fmt.Sprintf("%dm", elapsed/60)
+		case elapsed < 3600*24:
+			label = fmt.Sprintf("%dh", elapsed/3600)
+		default:
+			label = fmt.Sprintf("%dd", elapsed/(3600*24))
+		}
+		seq.add(float64(s.latency), label)
+	}
+
+	var graph strings.Builder
+	fmt.Fprintf(&graph, "%s - high %d ms, low %d ms (all time high %d ms)\n", event, max, min, ts.max)
+	graph.WriteString(strings.Repeat("-", LatencyGraphCols))
+	graph.WriteString("\n")
+	sparklineRender(&graph, seq, LatencyGraphCols, 4)
+	return graph.String()
+}
+
+/* ---------------------- Latency histograms -------------------------------- */
+
+// updateCommandLatencyHistogram records the duration of the command, in
+// nanoseconds, in its latency histogram.
+func updateCommandLatencyHistogram(cmd RedisCommand, durationNs int64) {
+	if durationNs < LatencyHistogramMinValue {
+		durationNs = LatencyHistogramMinValue
+	}
+	if durationNs > LatencyHistogramMaxValue {
+		durationNs = LatencyHistogramMaxValue
+	}
+	h := cmd.LatencyHistogram()
+	if h == nil {
+		h = newHdrHistogram(LatencyHistogramMinValue, LatencyHistogramMaxValue, LatencyHistogramPrecision)
+		cmd.SetLatencyHistogram(h)
+	}
+	h.record(durationNs)
+}
+
+// fillCommandCDF replies with the cumulative distribution of the latencies
+// of the command, in microseconds buckets growing as powers of two.
+func (c *Client) fillCommandCDF(h *hdrHistogram) {
+	type bucket struct{ micros, count int64 }
+	var buckets []bucket
+	var previousCount int64
+	for level := int64(LatencyHistogramFirstBucket); ; level *= 2 {
+		highest := h.highestEquivalentValue(level)
+		count := h.cumulativeCountTo(level)
+		if count > previousCount {
+			buckets = append(buckets, bucket{highest / 1000, count})
+		}
+		previousCount = count
+		if count == h.totalCount || level >= LatencyHistogramMaxValue {
+			break
+		}
+	}
+
+	c.addReplyMapLen(2)
+	c.addReplyBulkCString("calls")
+	c.addReplyLongLong(h.totalCount)
+	c.addReplyBulkCString("histogram_usec")
+	c.addReplyMapLen(len(buckets))
+	for _, b := range buckets {
+		c.addReplyLongLong(b.micros)
+		c.addReplyLongLong(b.count)
+	}
+}
+
+// commandsWithLatencyHistogram appends the command, and its subcommands, to
+// cmds if they have a latency histogram.
+func commandsWithLatencyHistogram(cmds []RedisCommand, cmd RedisCommand) []RedisCommand {
+	if cmd.LatencyHistogram() != nil {
+		cmds = append(cmds, cmd)
+	}
+	for _, sub := range cmd.SubCommands() {
+		cmds = commandsWithLatencyHistogram(cmds, sub)
+	}
+	return cmds
+}
+
+// sortedCommandsWithLatencyHistogram returns all the commands with a latency
+// histogram, sorted by name.
+func sortedCommandsWithLatencyHistogram() []RedisCommand {
+	var cmds []RedisCommand
+	server.commands.Range(func(_ string, cmd RedisCommand) bool {
+		cmds = commandsWithLatencyHistogram(cmds, cmd)
+		return true
+	})
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Fullname() < cmds[j].Fullname() })
+	return cmds
+}
+
+// trimDoubleString formats the float without the trailing zeros.
+func trimDoubleString(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// fillPercentileDistributionLatencies formats the latency percentiles of
+// the histogram, in microseconds, for the latencystats section of INFO.
+func fillPercentileDistributionLatencies(h *hdrHistogram) string {
+	parts := make([]string, 0, len(server.latencyTrackingInfoPercentiles))
+	for _, p := range server.latencyTrackingInfoPercentiles {
+		parts = append(parts, fmt.Sprintf("p%s=%.3f", trimDoubleString(p), float64(h.valueAtPercentile(p))/1000))
+	}
+	return strings.Join(parts, ",")
+}
+
+/* ---------------------- Latency command implementation -------------------- */
+
+// LatencyCmd implements the LATENCY command.
+type LatencyCmd struct {
+	c *Client
+}
+
+// NewLatencyCmd returns a new LatencyCmd.
+func NewLatencyCmd(c *Client) *LatencyCmd {
+	return &LatencyCmd{c: c}
+}
+
+// Latest implements LATENCY LATEST
+// It replies with the latest sample of every event: its name, the time of
+// the sample, its latency, and the max latency of the event.
+func (cmd *LatencyCmd) Latest() {
+	c := cmd.c
+	names := latencyEventNames()
+	c.addReplyArrayLen(len(names))
+	for _, event := range names {
+		ts := server.latencyEvents[event]
+		last := (ts.idx + LatencyTsLen - 1) % LatencyTsLen
+		c.addReplyArrayLen(4)
+		c.addReplyBulkCString(event)
+		c.addReplyLongLong(ts.samples[last].time)
+		c.addReplyLongLong(int64(ts.samples[last].latency))
+		c.addReplyLongLong(int64(ts.max))
+	}
+}
+
+// History implements LATENCY HISTORY event
+func (cmd *LatencyCmd) History() {
+	c := cmd.c
+	ts, ok := server.latencyEvents[c.argv[2].Value.(string)]
+	if !ok {
+		c.addReplyArrayLen(0)
+		return
+	}
+	var samples []latencySample
+	for j := 0; j < LatencyTsLen; j++ {
+		if s := ts.samples[(ts.idx+j)%LatencyTsLen]; s.time != 0 {
+			samples = append(samples, s)
+		}
+	}
+	c.addReplyArrayLen(len(samples))
+	for _, s := range samples {
+		c.addReplyArrayLen(2)
+		c.addReplyLongLong(s.time)
+		c.addReplyLongLong(int64(s.latency))
+	}
+}
+
+// Graph implements LATENCY GRAPH event
+func (cmd *LatencyCmd) Graph() {
+	c := cmd.c
+	event := c.argv[2].Value.(string)
+	ts, ok := server.latencyEvents[event]
+	if !ok {
+		c.addReplyErrorFormat(fmt.Sprintf("No samples available for event '%s'", event))
+		return
+	}
+	c.addReplyVerbatim(latencyCommandGenSparkeline(event, ts), "txt")
+}
+
+// Doctor implements LATENCY DOCTOR
+func (cmd *LatencyCmd) Doctor() {
+	cmd.c.addReplyVerbatim(createLatencyReport(), "txt")
+}
+
+// Reset implements LATENCY RESET [event ...]
+func (cmd *LatencyCmd) Reset() {
+	c := cmd.c
+	if c.argc == 2 {
+		c.addReplyLongLong(int64(latencyResetEvent("")))
+		return
+	}
+	resets := 0
+	for j := 2; j < c.argc; j++ {
+		resets += latencyResetEvent(c.argv[j].Value.(string))
+	}
+	c.addReplyLongLong(int64(resets))
+}
+
+// Histogram implements LATENCY HISTOGRAM [command ...]
+func (cmd *LatencyCmd) Histogram() {
+	c := cmd.c
+	var cmds []RedisCommand
+	if c.argc == 2 {
+		cmds = sortedCommandsWithLatencyHistogram()
+	} else {
+		seen := make(map[RedisCommand]bool)
+		for j := 2; j < c.argc; j++ {
+			base := lookupCommandByFullname(c.argv[j].Value.(string))
+			if base == nil {
+				continue
+			}
+			// A container command also reports its subcommands.
+			for _, found := range commandsWithLatencyHistogram(nil, base) {
+				if !seen[found] {
+					seen[found] = true
+					cmds = append(cmds, found)
+				}
+			}
+		}
+	}
+
+	c.addReplyMapLen(len(cmds))
+	for _, found := range cmds {
+		c.addReplyBulkCString(found.Fullname())
+		c.fillCommandCDF(found.LatencyHistogram())
+	}
+}
+
+// Help implements LATENCY HELP
+func (cmd *LatencyCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"DOCTOR",
+		"    Return a human readable latency analysis report.",
+		"GRAPH <event>",
+		"    Return an ASCII latency graph for the <event> class.",
+		"HISTORY <event>",
+		"    Return time-latency samples for the <event> class.",
+		"LATEST",
+		"    Return the latest latency samples for all events.",
+		"RESET [<event> ...]",
+		"    Reset latency data of one or more <event> classes.",
+		"    (default: reset all data for all event classes)",
+		"HISTOGRAM [COMMAND ...]",
+		"    Return a cumulative distribution of latencies in the format of a histogram for the specified command names.",
+		"    If no commands are specified then all histograms are replied.",
+	})
+}
+
+func latencyLatestCommand(c *Client) error {
+	NewLatencyCmd(c).Latest()
+	return nil
+}
+
+func latencyHistoryCommand(c *Client) error {
+	NewLatencyCmd(c).History()
+	return nil
+}
+
+func latencyGraphCommand(c *Client) error {
+	NewLatencyCmd(c).Graph()
+	return nil
+}
+
+func latencyDoctorCommand(c *Client) error {
+	NewLatencyCmd(c).Doctor()
+	return nil
+}
+
+func latencyResetCommand(c *Client) error {
+	NewLatencyCmd(c).Reset()
+	return nil
+}
+
+func latencyHistogramCommand(c *Client) error {
+	NewLatencyCmd(c).Histogram()
+	return nil
+}
+
+func latencyHelpCommand(c *Client) error {
+	NewLatencyCmd(c).Help()
+	return nil
+}
@@ -0,0 +1,132 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+// withLatencyMonitor enables the latency monitor with the given threshold,
+// and restores the default configuration once the test is done.
+func withLatencyMonitor(t *testing.T, threshold int64) {
+	old := server.latencyMonitorThreshold
+	server.latencyMonitorThreshold = threshold
+	latencyResetEvent("")
+	t.Cleanup(func() {
+		server.latencyMonitorThreshold = old
+		latencyResetEvent("")
+	})
+}
+
+func TestHdrHistogram(t *testing.T) {
+	h := newHdrHistogram(LatencyHistogramMinValue, LatencyHistogramMaxValue, LatencyHistogramPrecision)
+	for v := int64(1); v <= 1000; v++ {
+		h.record(v * 1000)
+	}
+	if h.totalCount != 1000 {
+		t.Fatalf("histogram counted %d values", h.totalCount)
+	}
+	// Two significant digits: the values are within 1% of the real ones.
+	for _, tc := range []struct {
+		p    float64
+		want int64
+	}{{50, 500000}, {99, 990000}, {100, 1000000}} {
+		got := h.valueAtPercentile(tc.p)
+		if got < tc.want || got > tc.want+tc.want/100 {
+			t.Fatalf("p%v is %d, want about %d", tc.p, got, tc.want)
+		}
+	}
+	if got := h.cumulativeCountTo(1000); got != 1 {
+		t.Fatalf("%d values up to 1000", got)
+	}
+	// The values out of range are clamped.
+	h.record(LatencyHistogramMaxValue * 10)
+	if got := h.valueAtPercentile(100); got < LatencyHistogramMaxValue {
+		t.Fatalf("p100 is %d", got)
+	}
+}
+
+func TestLatencyMonitor(t *testing.T) {
+	withLatencyMonitor(t, 0)
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "LATENCY", "DOCTOR"); !strings.Contains(got, "Latency monitoring is disabled") {
+		t.Fatalf("LATENCY DOCTOR replied %q", got)
+	}
+	latencyAddSampleIfNeeded(LatencyEventCommand, 500)
+	if len(server.latencyEvents) != 0 {
+		t.Fatal("sampled an event with the monitor disabled")
+	}
+
+	server.latencyMonitorThreshold = 100
+	latencyAddSampleIfNeeded(LatencyEventCommand, 50)
+	latencyAddSampleIfNeeded(LatencyEventCommand, 200)
+	// The samples of the same second keep the max latency.
+	latencyAddSampleIfNeeded(LatencyEventCommand, 300)
+	latencyAddSampleIfNeeded(LatencyEventCommand, 150)
+	latencyAddSampleIfNeeded(LatencyEventExpireCycle, 120)
+
+	got := sendCommand(c, conn, "LATENCY", "LATEST")
+	if !strings.HasPrefix(got, "*2\r\n*4\r\n"+bulkString("command")) || !strings.HasSuffix(got, ":120\r\n:120\r\n") {
+		t.Fatalf("LATENCY LATEST replied %q", got)
+	}
+	got = sendCommand(c, conn, "LATENCY", "HISTORY", "command")
+	if !strings.HasPrefix(got, "*1\r\n*2\r\n:") || !strings.HasSuffix(got, ":300\r\n") {
+		t.Fatalf("LATENCY HISTORY replied %q", got)
+	}
+	if got := sendCommand(c, conn, "LATENCY", "HISTORY", "unknown"); got != "*0\r\n" {
+		t.Fatalf("LATENCY HISTORY unknown replied %q", got)
+	}
+
+	got = sendCommand(c, conn, "LATENCY", "GRAPH", "command")
+	if !strings.Contains(got, "command - high 300 ms, low 300 ms (all time high 300 ms)\n"+strings.Repeat("-", LatencyGraphCols)+"\n") {
+		t.Fatalf("LATENCY GRAPH replied %q", got)
+	}
+	if got := sendCommand(c, conn, "LATENCY", "GRAPH", "unknown"); got != "-ERR No samples available for event 'unknown'\r\n" {
+		t.Fatalf("LATENCY GRAPH unknown replied %q", got)
+	}
+
+	got = sendCommand(c, conn, "LATENCY", "DOCTOR")
+	if !strings.Contains(got, "1. command: 1 latency spikes (average 300ms, mean deviation 0ms, period 1.00 sec). Worst all time event 300ms.") ||
+		!strings.Contains(got, "2. expire-cycle: 1 latency spikes") {
+		t.Fatalf("LATENCY DOCTOR replied %q", got)
+	}
+
+	if got := sendCommand(c, conn, "LATENCY", "RESET", "COMMAND", "unknown"); got != ":1\r\n" {
+		t.Fatalf("LATENCY RESET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "LATENCY", "RESET"); got != ":1\r\n" {
+		t.Fatalf("LATENCY RESET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "LATENCY", "DOCTOR"); !strings.Contains(got, "no latency spike was observed") {
+		t.Fatalf("LATENCY DOCTOR replied %q", got)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	cmd, _ := server.commands.Get("setnx")
+	cmd.SetLatencyHistogram(nil)
+	sendCommand(c, conn, "SETNX", "latency:k", "v")
+	sendCommand(c, conn, "SETNX", "latency:k", "v")
+
+	got := sendCommand(c, conn, "LATENCY", "HISTOGRAM", "setnx", "unknown")
+	if !strings.HasPrefix(got, "*2\r\n"+bulkString("setnx")+"*4\r\n"+bulkString("calls")+":2\r\n"+bulkString("histogram_usec")) {
+		t.Fatalf("LATENCY HISTOGRAM replied %q", got)
+	}
+
+	sections := infoSections(t, c, conn, "latencystats")
+	p := sections["Latencystats"]["latency_percentiles_usec_setnx"]
+	if !strings.HasPrefix(p, "p50=") || !strings.Contains(p, ",p99=") || !strings.Contains(p, ",p99.9=") {
+		t.Fatalf("latency_percentiles_usec_setnx:%s", p)
+	}
+
+	// A container reports the histograms of its subcommands.
+	sendCommand(c, conn, "CLIENT", "ID")
+	got = sendCommand(c, conn, "LATENCY", "HISTOGRAM", "client")
+	if !strings.Contains(got, bulkString("client|id")) {
+		t.Fatalf("LATENCY HISTOGRAM client replied %q", got)
+	}
+}
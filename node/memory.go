@@ -0,0 +1,372 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* ----------------------------------------------------------------------------
+ * Memory introspection.
+ *
+ * The used memory is estimated by the db package from the keyspace and the
+ * client buffers, see db.UsedMemory. The memory managed by the Go runtime,
+ * reported as the allocator memory, is read from runtime.MemStats.
+ * --------------------------------------------------------------------------*/
+
+// redisMemOverhead is the memory usage breakdown of MEMORY STATS and INFO.
+type redisMemOverhead struct {
+	peakAllocated    int64
+	totalAllocated   int64
+	startupAllocated int64
+	clientsNormal    int64
+	overheadTotal    int64
+	dataset          int64
+	totalKeys        int64
+	bytesPerKey      int64
+	datasetPerc      float64
+	peakPerc         float64
+	totalFrag        float64
+	totalFragBytes   int64
+
+	allocatorAllocated int64
+	allocatorActive    int64
+	allocatorResident  int64
+
+	db []dbMemOverhead
+}
+
+// dbMemOverhead is the memory used by the dicts of a non empty DB.
+type dbMemOverhead struct {
+	dbid              int
+	overheadHtMain    int64
+	overheadHtExpires int64
+}
+
+// getMemoryOverheadData returns the memory usage breakdown: what is used by
+// the server itself, the overhead, and what is used by the dataset.
+func getMemoryOverheadData() *redisMemOverhead {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	used := db.UsedMemory()
+	if used > server.statPeakMemory {
+		server.statPeakMemory = used
+	}
+	mh := &redisMemOverhead{
+		peakAllocated:      server.statPeakMemory,
+		totalAllocated:     used,
+		startupAllocated:   server.initialMemoryUsage,
+		allocatorAllocated: int64(ms.HeapAlloc),
+		allocatorActive:    int64(ms.HeapInuse),
+		allocatorResident:  int64(ms.Sys),
+	}
+	memTotal := mh.startupAllocated
+
+	iter := server.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		mh.clientsNormal += getClientMemoryUsage(node.Value)
+	}
+	memTotal += mh.clientsNormal
+
+	for j, rdb := range server.db {
+		keys := rdb.Size()
+		if keys == 0 {
+			continue
+		}
+		mh.totalKeys += int64(keys)
+		main, expires := rdb.MemoryOverhead()
+		mh.db = append(mh.db, dbMemOverhead{dbid: j, overheadHtMain: main, overheadHtExpires: expires})
+		memTotal += main + expires
+	}
+	mh.overheadTotal = memTotal
+
+	if used > memTotal {
+		mh.dataset = used - memTotal
+	}
+	if mh.peakAllocated > 0 {
+		mh.peakPerc = float64(used) * 100 / float64(mh.peakAllocated)
+	}
+	if used > 0 {
+		mh.totalFrag = float64(ms.Sys) / float64(used)
+	}
+	mh.totalFragBytes = int64(ms.Sys) - used
+
+	// Metrics computed after subtracting the startup memory from the total
+	// memory.
+	netUsage := int64(1)
+	if used > mh.startupAllocated {
+		netUsage = used - mh.startupAllocated
+	}
+	mh.datasetPerc = float64(mh.dataset) * 100 / float64(netUsage)
+	if mh.totalKeys > 0 {
+		mh.bytesPerKey = netUsage / mh.totalKeys
+	}
+	return mh
+}
+
+// getMemoryDoctorReport returns a human readable report of the memory issues
+// of the instance.
+func getMemoryDoctorReport() string {
+	mh := getMemoryOverheadData()
+
+	var (
+		empty        bool // Instance is empty or almost empty.
+		bigPeak      bool // Memory peak is much larger than used mem.
+		highFrag     bool // High fragmentation.
+		bigClientBuf bool // Client buffers are too big.
+		manyScripts  bool // Script cache has too many scripts.
+	)
+	numReports := 0
+	if mh.totalAllocated < 1024*1024*5 {
+		empty = true
+		numReports++
+	} else {
+		// Peak is > 150% of current used memory?
+		if float64(mh.peakAllocated)/float64(mh.totalAllocated) > 1.5 {
+			bigPeak = true
+			numReports++
+		}
+		// Fragmentation is higher than 1.4?
+		if mh.totalFrag > 1.4 {
+			highFrag = true
+			numReports++
+		}
+		// Clients using more than 200k each average?
+		if numClients := server.clients.Len(); numClients > 0 && mh.clientsNormal/int64(numClients) > 1024*200 {
+			bigClientBuf = true
+			numReports++
+		}
+		// Too many scripts are cached?
+		if server.lua.scripts.Len() > 1000 {
+			manyScripts = true
+			numReports++
+		}
+	}
+
+	// Give a report to the user.
+	if numReports == 0 {
+		return "Hi Sam, I can't find any memory issue in your instance. I can only account for what occurs on this base."
+	}
+	if empty {
+		return "Hi Sam, this instance is empty or is using very little memory, my issues detector can't be used in these conditions. Please, leave for your mission on Earth and fill it with some data. The new Sam and I will be back to our programming as soon as I finished rebooting."
+	}
+
+	var b strings.Builder
+	b.WriteString("Sam, I detected a few issues in this Redis instance memory implants:\n\n")
+	if bigPeak {
+		b.WriteString(" * Peak memory: In the past this instance used more than 150% the memory that is currently using. The Go runtime releases the memory to the system lazily after a peak, so you can expect to see a big fragmentation ratio, however this is actually harmless and is only due to the memory peak. If the memory peak was only occasional and you want to try to reclaim memory, please try the MEMORY PURGE command.\n\n")
+	}
+	if highFrag {
+		b.WriteString(fmt.Sprintf(" * High total RSS: This instance has a memory fragmentation and RSS overhead greater than 1.4 (this means that the memory obtained from the system by the process is much larger than the memory used by the dataset and the clients). This problem is usually due either to a large peak memory (check if there is a peak memory entry above in the report) or to the memory used by the Go runtime itself, not accounted in the used memory. Use MEMORY MALLOC-STATS to inspect the runtime memory. Note: The memory is managed by the Go runtime %s.\n\n", runtime.Version()))
+	}
+	if bigClientBuf {
+		b.WriteString(" * Big client buffers: The clients output buffers in this instance are greater than 200K per client (on average). This may result from different causes, like Pub/Sub clients subscribed to channels bot not receiving data fast enough, so that data piles on the Redis instance output buffer, or clients sending commands with large replies or very large sequences of commands in the same pipeline. Please use the CLIENT LIST command in order to investigate the issue if it causes problems in your instance, or to understand better why certain clients are using a big amount of memory.\n\n")
+	}
+	if manyScripts {
+		b.WriteString(" * Many scripts: There seem to be many cached scripts in this instance (more than 1000). This may be because scripts are generated and `EVAL`ed, instead of being parameterized (with KEYS and ARGV), `SCRIPT LOAD`ed and `EVALSHA`ed. Unless `SCRIPT FLUSH` is called periodically, the scripts' caches may end up consuming most of your memory.\n\n")
+	}
+	b.WriteString("I'm here to keep you safe, Sam. I want to help you.\n")
+	return b.String()
+}
+
+// getMallocStats returns the statistics of the Go runtime memory allocator.
+func getMallocStats() string {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "___ Begin Go runtime statistics (%s) ___\n", runtime.Version())
+	stat := func(name string, v uint64) {
+		fmt.Fprintf(&b, "%s: %d\n", name, v)
+	}
+	stat("Alloc", ms.Alloc)
+	stat("TotalAlloc", ms.TotalAlloc)
+	stat("Sys", ms.Sys)
+	stat("Mallocs", ms.Mallocs)
+	stat("Frees", ms.Frees)
+	stat("HeapAlloc", ms.HeapAlloc)
+	stat("HeapSys", ms.HeapSys)
+	stat("HeapIdle", ms.HeapIdle)
+	stat("HeapInuse", ms.HeapInuse)
+	stat("HeapReleased", ms.HeapReleased)
+	stat("HeapObjects", ms.HeapObjects)
+	stat("StackInuse", ms.StackInuse)
+	stat("StackSys", ms.StackSys)
+	stat("MSpanInuse", ms.MSpanInuse)
+	stat("MCacheInuse", ms.MCacheInuse)
+	stat("GCSys", ms.GCSys)
+	stat("OtherSys", ms.OtherSys)
+	stat("NextGC", ms.NextGC)
+	stat("NumGC", uint64(ms.NumGC))
+	fmt.Fprintf(&b, "GCCPUFraction: %.6f\n", ms.GCCPUFraction)
+	b.WriteString("--- End Go runtime statistics ---\n")
+	return b.String()
+}
+
+// MemoryCmd handles the MEMORY subcommands.
+type MemoryCmd struct {
+	c *Client
+}
+
+// NewMemoryCmd returns a new MemoryCmd.
+func NewMemoryCmd(c *Client) *MemoryCmd {
+	return &MemoryCmd{c: c}
+}
+
+// Usage implements MEMORY USAGE key [SAMPLES count]
+func (cmd *MemoryCmd) Usage() {
+	c := cmd.c
+	samples := int64(db.OBJ_COMPUTE_SIZE_DEF_SAMPLES)
+	for j := 3; j < c.argc; j++ {
+		if strings.EqualFold(c.argv[j].Value.(string), "samples") && j+1 < c.argc {
+			var ok bool
+			if samples, ok = c.getLongLongFromObjectOrReply(c.argv[j+1], ""); !ok {
+				return
+			}
+			if samples < 0 {
+				c.addReplyErrorObject(SharedSyntaxErr)
+				return
+			}
+			j++
+		} else {
+			c.addReplyErrorObject(SharedSyntaxErr)
+			return
+		}
+	}
+	if samples > math.MaxInt32 {
+		samples = 0 // All the elements are sampled anyway.
+	}
+	usage, ok := c.db.MemoryUsage(c.argv[2].Value.(string), int(samples))
+	if !ok {
+		c.addReplyNull()
+		return
+	}
+	c.addReplyLongLong(usage)
+}
+
+// Stats implements MEMORY STATS
+func (cmd *MemoryCmd) Stats() {
+	c := cmd.c
+	mh := getMemoryOverheadData()
+
+	c.addReplyMapLen(17 + len(mh.db))
+
+	c.addReplyBulkCString("peak.allocated")
+	c.addReplyLongLong(mh.peakAllocated)
+	c.addReplyBulkCString("total.allocated")
+	c.addReplyLongLong(mh.totalAllocated)
+	c.addReplyBulkCString("startup.allocated")
+	c.addReplyLongLong(mh.startupAllocated)
+	c.addReplyBulkCString("clients.normal")
+	c.addReplyLongLong(mh.clientsNormal)
+
+	for _, dbo := range mh.db {
+		c.addReplyBulkCString("db." + strconv.Itoa(dbo.dbid))
+		c.addReplyMapLen(2)
+		c.addReplyBulkCString("overhead.hashtable.main")
+		c.addReplyLongLong(dbo.overheadHtMain)
+		c.addReplyBulkCString("overhead.hashtable.expires")
+		c.addReplyLongLong(dbo.overheadHtExpires)
+	}
+
+	c.addReplyBulkCString("overhead.total")
+	c.addReplyLongLong(mh.overheadTotal)
+	c.addReplyBulkCString("keys.count")
+	c.addReplyLongLong(mh.totalKeys)
+	c.addReplyBulkCString("keys.bytes-per-key")
+	c.addReplyLongLong(mh.bytesPerKey)
+	c.addReplyBulkCString("dataset.bytes")
+	c.addReplyLongLong(mh.dataset)
+	c.addReplyBulkCString("dataset.percentage")
+	c.addReplyDouble(mh.datasetPerc)
+	c.addReplyBulkCString("peak.percentage")
+	c.addReplyDouble(mh.peakPerc)
+	c.addReplyBulkCString("allocator.allocated")
+	c.addReplyLongLong(mh.allocatorAllocated)
+	c.addReplyBulkCString("allocator.active")
+	c.addReplyLongLong(mh.allocatorActive)
+	c.addReplyBulkCString("allocator.resident")
+	c.addReplyLongLong(mh.allocatorResident)
+	c.addReplyBulkCString("allocator-fragmentation.ratio")
+	var allocatorFrag float64
+	if mh.allocatorAllocated > 0 {
+		allocatorFrag = float64(mh.allocatorActive) / float64(mh.allocatorAllocated)
+	}
+	c.addReplyDouble(allocatorFrag)
+	c.addReplyBulkCString("allocator-fragmentation.bytes")
+	c.addReplyLongLong(mh.allocatorActive - mh.allocatorAllocated)
+	c.addReplyBulkCString("fragmentation")
+	c.addReplyDouble(mh.totalFrag)
+	c.addReplyBulkCString("fragmentation.bytes")
+	c.addReplyLongLong(mh.totalFragBytes)
+}
+
+// Doctor implements MEMORY DOCTOR
+func (cmd *MemoryCmd) Doctor() {
+	cmd.c.addReplyVerbatim(getMemoryDoctorReport(), "txt")
+}
+
+// MallocStats implements MEMORY MALLOC-STATS
+func (cmd *MemoryCmd) MallocStats() {
+	cmd.c.addReplyVerbatim(getMallocStats(), "txt")
+}
+
+// Purge implements MEMORY PURGE, the Go runtime returns as much memory as
+// possible to the system.
+func (cmd *MemoryCmd) Purge() {
+	debug.FreeOSMemory()
+	cmd.c.AddReply(SharedOk)
+}
+
+// Help implements MEMORY HELP
+func (cmd *MemoryCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"DOCTOR",
+		"    Return memory problems reports.",
+		"MALLOC-STATS",
+		"    Return internal statistics report from the memory allocator.",
+		"PURGE",
+		"    Attempt to purge dirty pages for reclamation by the allocator.",
+		"STATS",
+		"    Return information about the memory usage of the server.",
+		"USAGE <key> [SAMPLES <count>]",
+		"    Return memory in bytes used by <key> and its value. Nested values are",
+		"    sampled up to <count> times (default: 5, 0 means sample all).",
+	})
+}
+
+func memoryUsageCommand(c *Client) error {
+	NewMemoryCmd(c).Usage()
+	return nil
+}
+
+func memoryStatsCommand(c *Client) error {
+	NewMemoryCmd(c).Stats()
+	return nil
+}
+
+func memoryDoctorCommand(c *Client) error {
+	NewMemoryCmd(c).Doctor()
+	return nil
+}
+
+func memoryMallocStatsCommand(c *Client) error {
+	NewMemoryCmd(c).MallocStats()
+	return nil
+}
+
+func memoryPurgeCommand(c *Client) error {
+	NewMemoryCmd(c).Purge()
+	return nil
+}
+
+func memoryHelpCommand(c *Client) error {
+	NewMemoryCmd(c).Help()
+	return nil
+}
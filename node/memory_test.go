@@ -0,0 +1,105 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	used := db.UsedMemory()
+	sendCommand(c, conn, "SET", "key", strings.Repeat("x", 1000))
+	got := sendCommand(c, conn, "MEMORY", "USAGE", "key")
+	// The usage of the key is what SET added to the used memory.
+	if want := ":" + strconv.FormatInt(db.UsedMemory()-used, 10) + "\r\n"; got != want {
+		t.Fatalf("MEMORY USAGE replied %q, want %q", got, want)
+	}
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"MEMORY", "USAGE", "key", "SAMPLES", "0"}, got},
+		{[]string{"MEMORY", "USAGE", "nokey"}, "$-1\r\n"},
+		{[]string{"MEMORY", "USAGE", "key", "SAMPLES", "-1"}, "-ERR syntax error\r\n"},
+		{[]string{"MEMORY", "USAGE", "key", "SAMPLES"}, "-ERR syntax error\r\n"},
+		{[]string{"MEMORY", "USAGE", "key", "SAMPLES", "x"}, "-ERR value is not an integer or out of range\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+	sendCommand(c, conn, "SET", "key", "value")
+
+	got := sendCommand(c, conn, "MEMORY", "STATS")
+	for _, field := range []string{"peak.allocated", "total.allocated", "clients.normal", "db.0", "overhead.hashtable.main", "dataset.bytes", "allocator.allocated", "fragmentation"} {
+		if !strings.Contains(got, bulkString(field)) {
+			t.Errorf("MEMORY STATS has no %s: %q", field, got)
+		}
+	}
+	if !strings.Contains(got, bulkString("keys.count")+":1\r\n") {
+		t.Errorf("MEMORY STATS replied %q", got)
+	}
+	// The overhead is part of the used memory.
+	if mh := getMemoryOverheadData(); mh.overheadTotal > mh.totalAllocated || mh.dataset == 0 {
+		t.Errorf("overhead.total %d, total.allocated %d, dataset.bytes %d", mh.overheadTotal, mh.totalAllocated, mh.dataset)
+	}
+
+	if got := sendCommand(c, conn, "MEMORY", "DOCTOR"); !strings.Contains(got, "Sam") {
+		t.Errorf("MEMORY DOCTOR replied %q", got)
+	}
+	if got := sendCommand(c, conn, "MEMORY", "MALLOC-STATS"); !strings.Contains(got, "HeapAlloc: ") {
+		t.Errorf("MEMORY MALLOC-STATS replied %q", got)
+	}
+	if got := sendCommand(c, conn, "MEMORY", "PURGE"); got != "+OK\r\n" {
+		t.Errorf("MEMORY PURGE replied %q", got)
+	}
+	if got := sendCommand(c, conn, "INFO", "memory"); !strings.Contains(got, "used_memory_dataset:") {
+		t.Errorf("INFO replied %q", got)
+	}
+}
+
+func TestMemoryClientBuffers(t *testing.T) {
+	c, _ := newTestClient()
+	used := db.UsedMemory()
+
+	// The client buffers are accounted for once updated.
+	c.queryBuf = make([]byte, 0, 1024)
+	updateClientMemUsage(c)
+	if got := db.UsedMemory() - used; got != 1024 {
+		t.Fatalf("client buffers accounted for %d bytes", got)
+	}
+	freeClient(c)
+	if got := db.UsedMemory(); got != used {
+		t.Fatalf("used memory %d after freeing the client, want %d", got, used)
+	}
+}
+
+func TestMaxmemoryConfigSet(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer func() { server.maxmemory = 0 }()
+
+	if got := sendCommand(c, conn, "CONFIG", "SET", "maxmemory", "10mb"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET replied %q", got)
+	}
+	want := "*2\r\n" + bulkString("maxmemory") + bulkString("10485760")
+	if got := sendCommand(c, conn, "CONFIG", "GET", "maxmemory"); got != want {
+		t.Fatalf("CONFIG GET replied %q, want %q", got, want)
+	}
+}
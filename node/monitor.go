@@ -0,0 +1,86 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/*-----------------------------------------------------------------------------
+ * MONITOR
+ *----------------------------------------------------------------------------*/
+
+// MonitorCmd implements the MONITOR command.
+type MonitorCmd struct {
+	c *Client
+}
+
+// NewMonitorCmd returns a new MonitorCmd.
+func NewMonitorCmd(c *Client) *MonitorCmd {
+	return &MonitorCmd{c: c}
+}
+
+// Monitor implements MONITOR
+// The client is turned into a monitor, that receives every command executed
+// by the server from now on.
+func (cmd *MonitorCmd) Monitor() {
+	c := cmd.c
+	if c.flags&ClientDenyBlocking != 0 {
+		// A client that has ClientDenyBlocking flag on expects a reply per
+		// command and so can't execute MONITOR.
+		c.AddReplyError("MONITOR isn't allowed for DENY BLOCKING client")
+		return
+	}
+
+	// ignore MONITOR if already slave or in monitor mode
+	if c.flags&ClientSlave != 0 {
+		return
+	}
+
+	c.flags |= ClientSlave | ClientMonitor
+	server.monitors.AddNodeTail(c)
+	c.AddReply(SharedOk)
+}
+
+func monitorCommand(c *Client) error {
+	NewMonitorCmd(c).Monitor()
+	return nil
+}
+
+// replicationFeedMonitors sends the command executed by c to the monitors,
+// as a status reply with the time, the DB and the address of the client,
+// followed by the quoted arguments.
+func replicationFeedMonitors(c *Client, monitors *db.List[*Client], dictid uint64, argv []*db.RedisObj) {
+	if monitors.Len() == 0 {
+		return
+	}
+
+	var cmdrepr strings.Builder
+	now := time.Now()
+	fmt.Fprintf(&cmdrepr, "+%d.%06d ", now.Unix(), now.Nanosecond()/1000)
+	switch {
+	case c.flags&ClientScript != 0:
+		fmt.Fprintf(&cmdrepr, "[%d lua] ", dictid)
+	case c.flags&ClientUnixSocket != 0:
+		fmt.Fprintf(&cmdrepr, "[%d unix:%s] ", dictid, server.unixSocket)
+	case c.connection != nil:
+		fmt.Fprintf(&cmdrepr, "[%d %s] ", dictid, c.connection.Addr())
+	default:
+		fmt.Fprintf(&cmdrepr, "[%d] ", dictid)
+	}
+	for j, arg := range argv {
+		catRepr(&cmdrepr, arg.Value.(string))
+		if j != len(argv)-1 {
+			cmdrepr.WriteByte(' ')
+		}
+	}
+	cmdrepr.WriteString("\r\n")
+
+	cmdobj := createObject(db.StringType, cmdrepr.String())
+	iter := monitors.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		node.Value.AddReply(cmdobj)
+	}
+}
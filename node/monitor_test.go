@@ -0,0 +1,133 @@
+package node
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var monitorTimestamp = regexp.MustCompile(`(?m)^\+\d+\.\d{6} `)
+
+// monitorLines returns the lines received by the monitor, without their
+// timestamp.
+func monitorLines(t *testing.T, conn *TestConn) []string {
+	out := conn.Buffer.String()
+	conn.Buffer.Reset()
+	if out == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	for j, line := range lines {
+		if !monitorTimestamp.MatchString(line) {
+			t.Fatalf("monitor received %q", line)
+		}
+		lines[j] = monitorTimestamp.ReplaceAllString(line, "")
+	}
+	return lines
+}
+
+func TestMonitor(t *testing.T) {
+	m, mconn := newTestClient()
+	defer freeClient(m)
+	if got := sendCommand(m, mconn, "MONITOR"); got != "+OK\r\n" {
+		t.Fatalf("MONITOR replied %q", got)
+	}
+	if got := getClientFlagsString(m); got != "O" {
+		t.Fatalf("monitor flags %q", got)
+	}
+	mconn.Buffer.Reset()
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	conn.addr = "10.0.0.2:7000"
+
+	sendCommand(c, conn, "SET", "mon:k", "a \"b\"\n\x01")
+	sendCommand(c, conn, "SELECT", "1")
+	sendCommand(c, conn, "GET", "mon:k")
+	want := []string{
+		`[0 10.0.0.2:7000] "SET" "mon:k" "a \"b\"\n\x01"`,
+		`[0 10.0.0.2:7000] "SELECT" "1"`,
+		`[1 10.0.0.2:7000] "GET" "mon:k"`,
+	}
+	if got := monitorLines(t, mconn); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("monitor received %q", got)
+	}
+	sendCommand(c, conn, "SELECT", "0")
+	mconn.Buffer.Reset()
+
+	// The admin commands and the rejected commands are not shown.
+	sendCommand(c, conn, "CONFIG", "GET", "hz")
+	sendCommand(c, conn, "GET")
+	if got := monitorLines(t, mconn); got != nil {
+		t.Fatalf("monitor received %q", got)
+	}
+
+	// The secrets are redacted.
+	sendCommand(c, conn, "AUTH", "default", "secret")
+	sendCommand(c, conn, "HELLO", "2", "AUTH", "default", "secret")
+	want = []string{
+		`[0 10.0.0.2:7000] "AUTH" "(redacted)" "(redacted)"`,
+		`[0 10.0.0.2:7000] "HELLO" "2" "AUTH" "(redacted)" "(redacted)"`,
+	}
+	if got := monitorLines(t, mconn); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("monitor received %q", got)
+	}
+}
+
+func TestMonitorTransactionsAndScripts(t *testing.T) {
+	m, mconn := newTestClient()
+	sendCommand(m, mconn, "MONITOR")
+	mconn.Buffer.Reset()
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	conn.addr = "10.0.0.3:7000"
+
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "SET", "mon:k", "v")
+	sendCommand(c, conn, "EXEC")
+	sendCommand(c, conn, "EVAL", "return redis.call('GET', KEYS[1])", "1", "mon:k")
+	want := []string{
+		`[0 10.0.0.3:7000] "MULTI"`,
+		`[0 10.0.0.3:7000] "SET" "mon:k" "v"`,
+		`[0 10.0.0.3:7000] "EXEC"`,
+		`[0 10.0.0.3:7000] "EVAL" "return redis.call('GET', KEYS[1])" "1" "mon:k"`,
+		`[0 lua] "GET" "mon:k"`,
+	}
+	if got := monitorLines(t, mconn); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("monitor received %q", got)
+	}
+
+	// MONITOR can't be used inside a transaction.
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "MONITOR")
+	if got := sendCommand(c, conn, "EXEC"); got != "*1\r\n-ERR MONITOR isn't allowed for DENY BLOCKING client\r\n" {
+		t.Fatalf("EXEC replied %q", got)
+	}
+	if c.flags&ClientMonitor != 0 {
+		t.Fatal("client turned into a monitor inside a transaction")
+	}
+
+	freeClient(m)
+	if server.monitors.Len() != 0 {
+		t.Fatalf("%d monitors left", server.monitors.Len())
+	}
+}
+
+func TestMonitorUnixSocket(t *testing.T) {
+	m, mconn := newTestClient()
+	defer freeClient(m)
+	sendCommand(m, mconn, "MONITOR")
+	mconn.Buffer.Reset()
+	defer func(path string) { server.unixSocket = path }(server.unixSocket)
+	server.unixSocket = "/tmp/redis.sock"
+
+	c, conn := newTestClient()
+	defer freeClient(c)
+	c.flags |= ClientUnixSocket
+	sendCommand(c, conn, "GET", "mon:k")
+	want := `[0 unix:/tmp/redis.sock] "GET" "mon:k"`
+	if got := monitorLines(t, mconn); len(got) != 1 || got[0] != want {
+		t.Fatalf("monitor received %q, want %q", got, want)
+	}
+}
@@ -1,9 +1,395 @@
 package node
 
-import "fmt"
+import (
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* ================================ MULTI/EXEC ============================== */
+
+// initClientMultiState client state initialization for MULTI/EXEC
+func (c *Client) initClientMultiState() {
+	c.mState = &MultiState{}
+}
+
+// queueMultiCommand add a new command into the MULTI commands queue
+func (c *Client) queueMultiCommand(cmdFlags CommandFlags) {
+	// No sense to waste memory if the transaction is already aborted.
+	// this is useful in case client sends these in a pipeline, or doesn't
+	// bother to read previous responses and didn't notice the multi was already
+	// aborted.
+	if c.flags&(ClientDirtyCas|ClientDirtyExec) != 0 {
+		return
+	}
+
+	c.mState.commands = append(c.mState.commands, &MultiCmd{
+		argv: c.argv,
+		argc: c.argc,
+		cmd:  c.cmd,
+	})
+	c.mState.cmdFlags |= cmdFlags
+
+	// Reset the client's args since we copied them into the mstate and
+	// shouldn't reference them from c anymore.
+	c.argv = nil
+	c.argc = 0
+	c.argvLenSum = 0
+	c.argvLen = 0
+}
+
+// discardTransaction discards the queued commands and exits the MULTI state
+func (c *Client) discardTransaction() {
+	c.initClientMultiState()
+	c.flags &= ^(ClientMulti | ClientDirtyCas | ClientDirtyExec)
+	c.unwatchAllKeys()
+}
+
+// flagTransaction flag the transaction as DIRTY_EXEC so that EXEC will fail.
+// Should be called every time there is an error while queueing a command.
+func (c *Client) flagTransaction() {
+	if c.flags&ClientMulti != 0 {
+		c.flags |= ClientDirtyExec
+	}
+}
 
 // execCommandAbort Aborts a transaction, with specific error message.
 // The transaction is always aborted with -EXECABORT so that the client knows
+// the server exited the multi state, and the error is prefixed with the reason.
 func (c *Client) execCommandAbort(s string) {
-	c.addReplyErrorFormat(fmt.Sprintf("-EXECABORT Transaction discarded because of: %s", s))
+	c.discardTransaction()
+
+	s = strings.TrimSuffix(s, "\r\n")
+	s = strings.TrimPrefix(s, "-")
+	c.addReplyErrorFormat("-EXECABORT Transaction discarded because of: " + s)
+}
+
+// isExecContextCommand reports whether the command is one of the commands that are
+// executed immediately inside MULTI instead of being queued.
+func isExecContextCommand(cmd RedisCommand) bool {
+	switch cmd.Fullname() {
+	case "exec", "discard", "multi", "watch", "quit", "reset":
+		return true
+	}
+	return false
+}
+
+/* ===================== WATCH (CAS alike for MULTI/EXEC) ===================
+ *
+ * The implementation uses a per-DB hash table mapping keys to list of
+ * watchedKey entries, one for every client watching the key, so that given a
+ * key that is going to be modified we can mark all the associated clients
+ * as dirty.
+ *
+ * Also every client contains a list of WATCHed keys so that's possible to
+ * un-watch such keys when the client is freed or when UNWATCH is called. */
+
+// watchedKey is the entry of both the client watched keys list and the db
+// watched keys table.
+type watchedKey struct {
+	key     string
+	db      *db.RedisDb
+	client  *Client
+	expired bool // Flag that we're watching an already expired key.
+}
+
+// watchedKeysOf returns the table of the keys watched in the given db.
+func watchedKeysOf(rdb *db.RedisDb) *db.HashTable[string, *db.List[*watchedKey]] {
+	return server.watchedKeys[rdb.GetID()]
+}
+
+// watchForKey watch for the specified key
+func (c *Client) watchForKey(key string) {
+	// Check if we are already watching for this key
+	if c.watchedKeys.SearchNode(func(wk *watchedKey) bool { return wk.db == c.db && wk.key == key }) != nil {
+		return // Key already watched
+	}
+
+	// This key is not already watched in this DB. Let's add it
+	table := watchedKeysOf(c.db)
+	clients, exist := table.Get(key)
+	if !exist {
+		clients = db.NewList[*watchedKey]()
+		table.Set(key, clients)
+	}
+
+	// Add the new key to the list of keys watched by this client
+	wk := &watchedKey{
+		key:     key,
+		db:      c.db,
+		client:  c,
+		expired: c.db.KeyIsExpired(key),
+	}
+	c.watchedKeys.AddNodeTail(wk)
+	clients.AddNodeTail(wk)
+}
+
+// unwatchAllKeys unwatch all the keys watched by this client. To clean the
+// EXEC dirty flag is up to the caller.
+func (c *Client) unwatchAllKeys() {
+	if c.watchedKeys.Len() == 0 {
+		return
+	}
+
+	iter := c.watchedKeys.NewListIterator(db.DIRECTION_HEAD)
+	for ln := iter.NextNode(); ln != nil; ln = iter.NextNode() {
+		wk := ln.Value
+
+		// Remove the client's wk from the list of clients watching the key.
+		table := watchedKeysOf(wk.db)
+		clients, exist := table.Get(wk.key)
+		if !exist {
+			panic("watched key not found in the db watched keys")
+		}
+		if node := clients.SearchNode(func(v *watchedKey) bool { return v == wk }); node != nil {
+			_ = clients.RemoveNode(node)
+		}
+
+		// Kill the entry at all if this was the only client
+		if clients.Len() == 0 {
+			table.Delete(wk.key)
+		}
+
+		// Remove this watched key from the client->watched list
+		_ = c.watchedKeys.RemoveNode(ln)
+	}
+}
+
+// isWatchedKeyExpired iterates over the watched_keys list and looks for an
+// expired key. Keys which were expired already when WATCH was called are ignored.
+func (c *Client) isWatchedKeyExpired() bool {
+	return c.watchedKeys.SearchNode(func(wk *watchedKey) bool {
+		// was expired when WATCH was called
+		return !wk.expired && wk.db.KeyIsExpired(wk.key)
+	}) != nil
+}
+
+// touchWatchedKey "Touch" a key, so that if this key is being WATCHed by some
+// client the next EXEC will fail.
+func touchWatchedKey(rdb *db.RedisDb, key string) {
+	table := watchedKeysOf(rdb)
+	if table.Len() == 0 {
+		return
+	}
+
+	clients, exist := table.Get(key)
+	if !exist {
+		return
+	}
+
+	// Mark all the clients watching this key as CLIENT_DIRTY_CAS
+	// Check if we are already watching for this key
+	iter := clients.NewListIterator(db.DIRECTION_HEAD)
+	for ln := iter.NextNode(); ln != nil; ln = iter.NextNode() {
+		wk := ln.Value
+		c := wk.client
+
+		if wk.expired {
+			// The key was already expired when WATCH was called.
+			if rdb == wk.db && key == wk.key && !rdb.ContainsKey(key) {
+				// Already expired key is deleted, so logically no change. Clear
+				// the flag. Deleted keys are not flagged as expired.
+				wk.expired = false
+				continue
+			}
+		}
+
+		c.flags |= ClientDirtyCas
+		// As the client is marked as dirty, there is no point in getting here
+		// again in case that key (or others) are modified again (or keep the
+		// memory overhead till EXEC).
+		c.unwatchAllKeys()
+	}
+}
+
+// touchAllWatchedKeysInDb Set CLIENT_DIRTY_CAS to all clients of DB when DB is
+// dirty. It may happen in the following situations:
+// FLUSHDB, FLUSHALL, SWAPDB
+//
+// replacedWith: for SWAPDB, the WATCH should be invalidated if
+// the key exists in either of them, and skipped only if it
+// doesn't exist in both.
+func touchAllWatchedKeysInDb(emptied *db.RedisDb, replacedWith *db.RedisDb) {
+	table := watchedKeysOf(emptied)
+	if table.Len() == 0 {
+		return
+	}
+
+	table.Range(func(key string, clients *db.List[*watchedKey]) bool {
+		existsInEmptied := emptied.ContainsKey(key)
+		if !existsInEmptied && (replacedWith == nil || !replacedWith.ContainsKey(key)) {
+			return true
+		}
+
+		iter := clients.NewListIterator(db.DIRECTION_HEAD)
+		for ln := iter.NextNode(); ln != nil; ln = iter.NextNode() {
+			wk := ln.Value
+			if wk.expired {
+				if replacedWith == nil || !replacedWith.ContainsKey(key) {
+					// Expired key now deleted. No logical change. Clear the
+					// flag. Deleted keys are not flagged as expired.
+					wk.expired = false
+					continue
+				} else if replacedWith.KeyIsExpired(key) {
+					// Expired key remains expired.
+					continue
+				}
+			} else if !existsInEmptied && replacedWith.KeyIsExpired(key) {
+				// Non-existing key is replaced with an expired key.
+				wk.expired = true
+				continue
+			}
+			// Note - we can't call unwatchAllKeys for this specific client
+			// here, as it would modify the table we are iterating.
+			wk.client.flags |= ClientDirtyCas
+		}
+		return true
+	})
+}
+
+// signalModifiedKey is called by the db layer every time a key in the
+// database is modified.
+func signalModifiedKey(rdb *db.RedisDb, key string) {
+	touchWatchedKey(rdb, key)
+	trackingInvalidateKey(server.currentClient, key, true)
+}
+
+/*-----------------------------------------------------------------------------
+ * Transaction commands entry point
+ *----------------------------------------------------------------------------*/
+
+// TransactionCmd handles the MULTI, EXEC, DISCARD, WATCH and UNWATCH commands.
+type TransactionCmd struct {
+	c *Client
+}
+
+// NewTransactionCmd returns a new TransactionCmd.
+func NewTransactionCmd(c *Client) *TransactionCmd {
+	return &TransactionCmd{c: c}
+}
+
+// Multi implements MULTI
+func (cmd *TransactionCmd) Multi() {
+	if cmd.c.flags&ClientMulti != 0 {
+		cmd.c.AddReplyError("MULTI calls can not be nested")
+		return
+	}
+	cmd.c.flags |= ClientMulti
+	cmd.c.AddReply(SharedOk)
+}
+
+// Discard implements DISCARD
+func (cmd *TransactionCmd) Discard() {
+	if cmd.c.flags&ClientMulti == 0 {
+		cmd.c.AddReplyError("DISCARD without MULTI")
+		return
+	}
+	cmd.c.discardTransaction()
+	cmd.c.AddReply(SharedOk)
+}
+
+// Exec implements EXEC
+func (cmd *TransactionCmd) Exec() {
+	c := cmd.c
+
+	if c.flags&ClientMulti == 0 {
+		c.AddReplyError("EXEC without MULTI")
+		return
+	}
+
+	// EXEC with expired watched key is disallowed
+	if c.isWatchedKeyExpired() {
+		c.flags |= ClientDirtyCas
+	}
+
+	// Check if we need to abort the EXEC because:
+	// 1) Some WATCHed key was touched.
+	// 2) There was a previous error while queueing commands.
+	// A failed EXEC in the first case returns a multi bulk nil object
+	// (technically it is not an error but a special behavior), while
+	// in the second an EXECABORT error is returned.
+	if c.flags&(ClientDirtyCas|ClientDirtyExec) != 0 {
+		if c.flags&ClientDirtyExec != 0 {
+			c.addReplyErrorObject(SharedExecAbortErr)
+		} else {
+			c.addReplyNullArray()
+		}
+		c.discardTransaction()
+		return
+	}
+
+	oldFlags := c.flags
+
+	// we do not want to allow blocking commands inside multi
+	c.flags |= ClientDenyBlocking
+
+	// Exec all the queued commands
+	c.unwatchAllKeys() // Unwatch ASAP otherwise we'll waste CPU cycles
+
+	origArgv, origArgc, origCmd := c.argv, c.argc, c.cmd
+	c.addReplyArrayLen(len(c.mState.commands))
+	for _, mc := range c.mState.commands {
+		c.argc = mc.argc
+		c.argv = mc.argv
+		c.cmd = mc.cmd
+		c.realCmd = mc.cmd
+		c.Call(CmdCallFull)
+	}
+
+	// restore old DENY_BLOCKING value
+	if oldFlags&ClientDenyBlocking == 0 {
+		c.flags &= ^ClientDenyBlocking
+	}
+
+	c.argv, c.argc, c.cmd, c.realCmd = origArgv, origArgc, origCmd, origCmd
+	c.discardTransaction()
+}
+
+// Watch implements WATCH key [key ...]
+func (cmd *TransactionCmd) Watch() {
+	if cmd.c.flags&ClientMulti != 0 {
+		cmd.c.AddReplyError("WATCH inside MULTI is not allowed")
+		return
+	}
+	// No point in watching if the client is already dirty.
+	if cmd.c.flags&ClientDirtyCas != 0 {
+		cmd.c.AddReply(SharedOk)
+		return
+	}
+	for j := 1; j < cmd.c.argc; j++ {
+		cmd.c.watchForKey(cmd.c.argv[j].Value.(string))
+	}
+	cmd.c.AddReply(SharedOk)
+}
+
+// Unwatch implements UNWATCH
+func (cmd *TransactionCmd) Unwatch() {
+	cmd.c.unwatchAllKeys()
+	cmd.c.flags &= ^ClientDirtyCas
+	cmd.c.AddReply(SharedOk)
+}
+
+func multiCommand(c *Client) error {
+	NewTransactionCmd(c).Multi()
+	return nil
+}
+
+func execCommand(c *Client) error {
+	NewTransactionCmd(c).Exec()
+	return nil
+}
+
+func discardCommand(c *Client) error {
+	NewTransactionCmd(c).Discard()
+	return nil
+}
+
+func watchCommand(c *Client) error {
+	NewTransactionCmd(c).Watch()
+	return nil
+}
+
+func unwatchCommand(c *Client) error {
+	NewTransactionCmd(c).Unwatch()
+	return nil
 }
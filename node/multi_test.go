@@ -0,0 +1,206 @@
+package node
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiExec(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "MULTI"); got != "+OK\r\n" {
+		t.Fatalf("MULTI replied %q", got)
+	}
+	if got := sendCommand(c, conn, "MULTI"); got != "-ERR MULTI calls can not be nested\r\n" {
+		t.Fatalf("nested MULTI replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SET", "multi:a", "1"); got != "+QUEUED\r\n" {
+		t.Fatalf("SET inside MULTI replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "multi:a"); got != "+QUEUED\r\n" {
+		t.Fatalf("GET inside MULTI replied %q", got)
+	}
+	if got := sendCommand(c, conn, "WATCH", "multi:a"); got != "-ERR WATCH inside MULTI is not allowed\r\n" {
+		t.Fatalf("WATCH inside MULTI replied %q", got)
+	}
+	if got := sendCommand(c, conn, "EXEC"); got != "*2\r\n+OK\r\n$1\r\n1\r\n" {
+		t.Fatalf("EXEC replied %q", got)
+	}
+	if got := sendCommand(c, conn, "EXEC"); got != "-ERR EXEC without MULTI\r\n" {
+		t.Fatalf("EXEC without MULTI replied %q", got)
+	}
+}
+
+func TestMultiDiscard(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "DISCARD"); got != "-ERR DISCARD without MULTI\r\n" {
+		t.Fatalf("DISCARD without MULTI replied %q", got)
+	}
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "SET", "discard:a", "1")
+	if got := sendCommand(c, conn, "DISCARD"); got != "+OK\r\n" {
+		t.Fatalf("DISCARD replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "discard:a"); got != "$-1\r\n" && got != "_\r\n" {
+		t.Fatalf("discarded SET was executed, GET replied %q", got)
+	}
+}
+
+func TestMultiExecAbort(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "NOSUCHCOMMAND"); !strings.HasPrefix(got, "-ERR unknown command") {
+		t.Fatalf("unknown command inside MULTI replied %q", got)
+	}
+	sendCommand(c, conn, "SET", "abort:a", "1")
+	if got := sendCommand(c, conn, "EXEC"); got != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+		t.Fatalf("EXEC replied %q", got)
+	}
+
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "GET")
+	if got := sendCommand(c, conn, "EXEC"); !strings.HasPrefix(got, "-EXECABORT") {
+		t.Fatalf("EXEC after an arity error replied %q", got)
+	}
+	if c.flags&(ClientMulti|ClientDirtyExec) != 0 {
+		t.Fatal("client still in the MULTI state")
+	}
+
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "SUBSCRIBE", "ch"); got != "+QUEUED\r\n" {
+		t.Fatalf("SUBSCRIBE inside MULTI replied %q", got)
+	}
+	sendCommand(c, conn, "DISCARD")
+}
+
+func TestWatch(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	// Untouched key, EXEC succeeds.
+	sendCommand(c, conn, "WATCH", "watch:a")
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "SET", "watch:a", "1")
+	if got := sendCommand(c, conn, "EXEC"); got != "*1\r\n+OK\r\n" {
+		t.Fatalf("EXEC replied %q", got)
+	}
+
+	// Touched by another client, EXEC fails.
+	sendCommand(c, conn, "WATCH", "watch:a")
+	sendCommand(other, otherConn, "SET", "watch:a", "2")
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "SET", "watch:a", "3")
+	if got := sendCommand(c, conn, "EXEC"); got != "*-1\r\n" {
+		t.Fatalf("EXEC after a touched key replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "watch:a"); got != "$1\r\n2\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+
+	// UNWATCH forgets the touched keys.
+	sendCommand(c, conn, "WATCH", "watch:a")
+	sendCommand(other, otherConn, "SET", "watch:a", "4")
+	sendCommand(c, conn, "UNWATCH")
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "EXEC"); got != "*0\r\n" {
+		t.Fatalf("EXEC after UNWATCH replied %q", got)
+	}
+	if watched, _ := server.watchedKeys[0].Get("watch:a"); watched != nil {
+		t.Fatal("watched keys were not released")
+	}
+}
+
+func TestWatchExpiredKey(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	sendCommand(c, conn, "SET", "watch:volatile", "v", "PX", "1")
+	sendCommand(c, conn, "WATCH", "watch:volatile")
+	time.Sleep(5 * time.Millisecond)
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "EXEC"); got != "*-1\r\n" {
+		t.Fatalf("EXEC with an expired watched key replied %q", got)
+	}
+
+	// A key already expired when WATCH was called doesn't fail the EXEC.
+	sendCommand(c, conn, "SET", "watch:volatile", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	sendCommand(c, conn, "WATCH", "watch:volatile")
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "EXEC"); got != "*0\r\n" {
+		t.Fatalf("EXEC with an already expired watched key replied %q", got)
+	}
+}
+
+func TestWatchFlushAndSwapDb(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	sendCommand(c, conn, "SET", "watch:flush", "1")
+	sendCommand(c, conn, "WATCH", "watch:flush")
+	if got := sendCommand(other, otherConn, "FLUSHDB", "SYNC"); got != "+OK\r\n" {
+		t.Fatalf("FLUSHDB replied %q", got)
+	}
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "EXEC"); got != "*-1\r\n" {
+		t.Fatalf("EXEC after FLUSHDB replied %q", got)
+	}
+
+	// Flushing a DB that doesn't contain the watched key is not a change.
+	sendCommand(c, conn, "WATCH", "watch:flush")
+	sendCommand(other, otherConn, "FLUSHDB")
+	sendCommand(c, conn, "MULTI")
+	if got := sendCommand(c, conn, "EXEC"); got != "*0\r\n" {
+		t.Fatalf("EXEC after flushing a missing key replied %q", got)
+	}
+
+	sendCommand(other, otherConn, "SELECT", "1")
+	sendCommand(other, otherConn, "SET", "watch:swap", "1")
+	sendCommand(c, conn, "WATCH", "watch:swap")
+	if got := sendCommand(other, otherConn, "SWAPDB", "0", "1"); got != "+OK\r\n" {
+		t.Fatalf("SWAPDB replied %q", got)
+	}
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "GET", "watch:swap")
+	if got := sendCommand(c, conn, "EXEC"); got != "*-1\r\n" {
+		t.Fatalf("EXEC after SWAPDB replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET", "watch:swap"); got != "$1\r\n1\r\n" {
+		t.Fatalf("GET after SWAPDB replied %q", got)
+	}
+	sendCommand(c, conn, "FLUSHDB")
+}
+
+func TestSelectAndSwapDbErrors(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if got := sendCommand(c, conn, "SELECT", "100"); got != "-ERR DB index is out of range\r\n" {
+		t.Fatalf("SELECT replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SELECT", "x"); got != "-ERR invalid DB index\r\n" {
+		t.Fatalf("SELECT replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SWAPDB", "x", "1"); got != "-ERR invalid first DB index\r\n" {
+		t.Fatalf("SWAPDB replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SWAPDB", "0", "x"); got != "-ERR invalid second DB index\r\n" {
+		t.Fatalf("SWAPDB replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SWAPDB", "0", "100"); got != "-ERR DB index is out of range\r\n" {
+		t.Fatalf("SWAPDB replied %q", got)
+	}
+	if got := sendCommand(c, conn, "FLUSHDB", "LAZY"); got != "-ERR syntax error\r\n" {
+		t.Fatalf("FLUSHDB replied %q", got)
+	}
+}
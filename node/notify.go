@@ -0,0 +1,134 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* This file implements keyspace events notification via Pub/Sub and
+ * described at https://redis.io/topics/notifications. */
+
+// keyspaceEventsStringToFlags turns a string representing notification classes
+// into the corresponding flags. false is returned if the input contains invalid chars.
+func keyspaceEventsStringToFlags(classes string) (db.NotifyType, bool) {
+	var flags db.NotifyType
+
+	for _, ch := range classes {
+		switch ch {
+		case 'A':
+			flags |= db.NotifyAll
+		case 'g':
+			flags |= db.NotifyGeneric
+		case '$':
+			flags |= db.NotifyString
+		case 'l':
+			flags |= db.NotifyList
+		case 's':
+			flags |= db.NotifySet
+		case 'h':
+			flags |= db.NotifyHash
+		case 'z':
+			flags |= db.NotifyZSet
+		case 'x':
+			flags |= db.NotifyExpired
+		case 'e':
+			flags |= db.NotifyEvicted
+		case 'K':
+			flags |= db.NotifyKeyspace
+		case 'E':
+			flags |= db.NotifyKeyevent
+		case 't':
+			flags |= db.NotifyStream
+		case 'm':
+			flags |= db.NotifyKeyMiss
+		case 'n':
+			flags |= db.NotifyNew
+		default:
+			return 0, false
+		}
+	}
+	return flags, true
+}
+
+// keyspaceEventsFlagsToString is the opposite of keyspaceEventsStringToFlags,
+// it is used by CONFIG GET to return the current configuration.
+func keyspaceEventsFlagsToString(flags db.NotifyType) string {
+	var res strings.Builder
+
+	if flags&db.NotifyAll == db.NotifyAll {
+		res.WriteByte('A')
+	} else {
+		if flags&db.NotifyGeneric != 0 {
+			res.WriteByte('g')
+		}
+		if flags&db.NotifyString != 0 {
+			res.WriteByte('$')
+		}
+		if flags&db.NotifyList != 0 {
+			res.WriteByte('l')
+		}
+		if flags&db.NotifySet != 0 {
+			res.WriteByte('s')
+		}
+		if flags&db.NotifyHash != 0 {
+			res.WriteByte('h')
+		}
+		if flags&db.NotifyZSet != 0 {
+			res.WriteByte('z')
+		}
+		if flags&db.NotifyExpired != 0 {
+			res.WriteByte('x')
+		}
+		if flags&db.NotifyEvicted != 0 {
+			res.WriteByte('e')
+		}
+		if flags&db.NotifyStream != 0 {
+			res.WriteByte('t')
+		}
+	}
+	if flags&db.NotifyKeyspace != 0 {
+		res.WriteByte('K')
+	}
+	if flags&db.NotifyKeyevent != 0 {
+		res.WriteByte('E')
+	}
+	if flags&db.NotifyKeyMiss != 0 {
+		res.WriteByte('m')
+	}
+	if flags&db.NotifyNew != 0 {
+		res.WriteByte('n')
+	}
+	return res.String()
+}
+
+/* notifyKeyspaceEvent is the API used by commands, the expire cycle and the
+ * eviction to fire events:
+ *
+ * 't' is the class of the event, one of the db.Notify* flags.
+ * 'event' is a C string representing the event name.
+ * 'key' is the key name.
+ * 'dbid' is the database ID where the key lives.
+ *
+ * The event is published in the __keyspace@<db>__:<key> channel with the
+ * event name as message, and in the __keyevent@<db>__:<event> channel with
+ * the key name as message, depending on the K and E flags. */
+func notifyKeyspaceEvent(t db.NotifyType, event string, key string, dbid uint64) {
+	// If notifications for this class of events are off, return ASAP.
+	if server.notifyKeyspaceEvents&t == 0 {
+		return
+	}
+
+	// __keyspace@<db>__:<key> <event> notifications.
+	if server.notifyKeyspaceEvents&db.NotifyKeyspace != 0 {
+		channel := fmt.Sprintf("__keyspace@%d__:%s", dbid, key)
+		pubsubPublishMessage(channel, event)
+	}
+
+	// __keyevent@<db>__:<event> <key> notifications.
+	if server.notifyKeyspaceEvents&db.NotifyKeyevent != 0 {
+		channel := fmt.Sprintf("__keyevent@%d__:%s", dbid, event)
+		pubsubPublishMessage(channel, key)
+	}
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+func TestKeyspaceEventsFlags(t *testing.T) {
+	tests := []struct {
+		classes string
+		flags   db.NotifyType
+		str     string
+	}{
+		{"", 0, ""},
+		{"KEA", db.NotifyKeyspace | db.NotifyKeyevent | db.NotifyAll, "AKE"},
+		{"Eg$x", db.NotifyKeyevent | db.NotifyGeneric | db.NotifyString | db.NotifyExpired, "g$xE"},
+		{"Kmn", db.NotifyKeyspace | db.NotifyKeyMiss | db.NotifyNew, "Kmn"},
+		{"Klshzet", db.NotifyKeyspace | db.NotifyList | db.NotifySet | db.NotifyHash | db.NotifyZSet | db.NotifyEvicted | db.NotifyStream, "lshzetK"},
+	}
+
+	for _, tt := range tests {
+		flags, ok := keyspaceEventsStringToFlags(tt.classes)
+		if !ok {
+			t.Fatalf("%q: unexpected invalid classes", tt.classes)
+		}
+		if flags != tt.flags {
+			t.Errorf("%q: got flags %b, want %b", tt.classes, flags, tt.flags)
+		}
+		if str := keyspaceEventsFlagsToString(flags); str != tt.str {
+			t.Errorf("%q: got string %q, want %q", tt.classes, str, tt.str)
+		}
+	}
+
+	if _, ok := keyspaceEventsStringToFlags("KEw"); ok {
+		t.Error("expected 'w' to be an invalid class")
+	}
+}
+
+func TestNotifyKeyspaceEvents(t *testing.T) {
+	c, conn := newTestClient()
+	sub, subConn := newTestClient()
+	defer func() {
+		freeClient(sub)
+		server.notifyKeyspaceEvents = 0
+	}()
+
+	if got := sendCommand(c, conn, "CONFIG", "SET", "notify-keyspace-events", "KE$"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "GET", "notify-keyspace-events"); got != "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\n$KE\r\n" {
+		t.Fatalf("CONFIG GET replied %q", got)
+	}
+
+	sendCommand(sub, subConn, "SUBSCRIBE", "__keyspace@0__:foo")
+	sendCommand(sub, subConn, "PSUBSCRIBE", "__keyevent@0__:*")
+	subConn.Buffer.Reset()
+
+	sendCommand(c, conn, "SET", "foo", "bar")
+	want := "*3\r\n$7\r\nmessage\r\n$18\r\n__keyspace@0__:foo\r\n$3\r\nset\r\n" +
+		"*4\r\n$8\r\npmessage\r\n$16\r\n__keyevent@0__:*\r\n$18\r\n__keyevent@0__:set\r\n$3\r\nfoo\r\n"
+	if got := subConn.Buffer.String(); got != want {
+		t.Fatalf("SET published %q, want %q", got, want)
+	}
+
+	// The generic class is not enabled, the expire event is not published.
+	subConn.Buffer.Reset()
+	sendCommand(c, conn, "SET", "foo", "bar", "PX", "100")
+	want = "*3\r\n$7\r\nmessage\r\n$18\r\n__keyspace@0__:foo\r\n$3\r\nset\r\n" +
+		"*4\r\n$8\r\npmessage\r\n$16\r\n__keyevent@0__:*\r\n$18\r\n__keyevent@0__:set\r\n$3\r\nfoo\r\n"
+	if got := subConn.Buffer.String(); got != want {
+		t.Fatalf("SET PX published %q, want %q", got, want)
+	}
+}
+
+func TestNotifyExpiredEvent(t *testing.T) {
+	c, conn := newTestClient()
+	sub, subConn := newTestClient()
+	defer func() {
+		freeClient(sub)
+		server.notifyKeyspaceEvents = 0
+	}()
+
+	sendCommand(c, conn, "CONFIG", "SET", "notify-keyspace-events", "Ex")
+	sendCommand(sub, subConn, "SUBSCRIBE", "__keyevent@0__:expired")
+	sendCommand(c, conn, "SET", "volatile", "v", "PX", "1")
+	subConn.Buffer.Reset()
+
+	time.Sleep(5 * time.Millisecond)
+	server.serverCron()
+
+	want := "*3\r\n$7\r\nmessage\r\n$22\r\n__keyevent@0__:expired\r\n$8\r\nvolatile\r\n"
+	if got := subConn.Buffer.String(); got != want {
+		t.Fatalf("expire cycle published %q, want %q", got, want)
+	}
+	if _, exist := server.db[0].LookupKeyRead("volatile"); exist {
+		t.Fatal("expired key still exists")
+	}
+}
@@ -13,7 +13,7 @@ func createObject(t db.ObjectType, ptr any) *db.RedisObj {
 
 // stringObjectLen returns the length of the string object.
 func stringObjectLen(o *db.RedisObj) int {
-	return len([]rune(o.Value.(string)))
+	return len(o.Value.(string))
 }
 
 // createRawStringObject
@@ -28,23 +28,39 @@ func createEmbeddedStringObject(ptr string) *db.RedisObj {
 	return db.NewRedisObj(db.StringType, db.EncodingEmbStr, ptr, 0)
 }
 
-// getLongLongFromObject
-func getLongLongFromObject(o *db.RedisObj) uint64 {
+// getLongLongFromObject parses the integer value of a string object, false
+// is returned if the object does not represent a valid integer.
+func getLongLongFromObject(o *db.RedisObj) (int64, bool) {
 	if o == nil {
-		return 0
-	} else {
-		if o.EncodingObject() {
-			if v, ok := o.Value.(uint64); ok {
-				return v
-			} else {
-				return 0
-			}
-		} else if o.Encoding == db.EncodingInt {
-			return o.Value.(uint64)
+		return 0, true
+	}
+	switch v := o.Value.(type) {
+	case int64:
+		return v, true
+	case string:
+		ll, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return ll, true
+	default:
+		panic("Unknown string encoding")
+	}
+}
+
+// getLongLongFromObjectOrReply is like getLongLongFromObject but replies to
+// the client with msg, or with a generic error if msg is empty, on failure.
+func (c *Client) getLongLongFromObjectOrReply(o *db.RedisObj, msg string) (int64, bool) {
+	ll, ok := getLongLongFromObject(o)
+	if !ok {
+		if msg != "" {
+			c.addReplyErrorFormat(msg)
 		} else {
-			panic("Unknown string encoding")
+			c.AddReplyError("value is not an integer or out of range")
 		}
+		return 0, false
 	}
+	return ll, true
 }
 
 func ll2String(prefix byte, ll int64) []byte {
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/*-----------------------------------------------------------------------------
+ * OBJECT command, it allows to inspect the internals of a Redis Object.
+ *----------------------------------------------------------------------------*/
+
+// ObjectCmd handles the OBJECT subcommands.
+type ObjectCmd struct {
+	c *Client
+}
+
+// NewObjectCmd returns a new ObjectCmd.
+func NewObjectCmd(c *Client) *ObjectCmd {
+	return &ObjectCmd{c: c}
+}
+
+// strEncoding returns the name of the encoding, as replied by OBJECT ENCODING.
+func strEncoding(encoding db.EncodingType) string {
+	switch encoding {
+	case db.EncodingRaw:
+		return "raw"
+	case db.EncodingInt:
+		return "int"
+	case db.EncodingHT:
+		return "hashtable"
+	case db.EncodingZipMap:
+		return "zipmap"
+	case db.EncodingLinkedList:
+		return "linkedlist"
+	case db.EncodingZipList:
+		return "ziplist"
+	case db.EncodingIntSet:
+		return "intset"
+	case db.EncodingSkipList:
+		return "skiplist"
+	case db.EncodingEmbStr:
+		return "embstr"
+	case db.EncodingQuickList:
+		return "quicklist"
+	case db.EncodingStream:
+		return "stream"
+	case db.EncodingListPack:
+		return "listpack"
+	default:
+		return "unknown"
+	}
+}
+
+// lookupOrReply looks up the key of the subcommand without touching it, the
+// client gets a null reply if the key does not exist.
+func (cmd *ObjectCmd) lookupOrReply() (*db.RedisObj, bool) {
+	o, exist := cmd.c.db.LookupKeyReadWithFlags(cmd.c.argv[2].Value.(string), db.LookupNoTouch|db.LookupNoNotify)
+	if !exist {
+		cmd.c.addReplyNull()
+	}
+	return o, exist
+}
+
+// Encoding implements OBJECT ENCODING key
+func (cmd *ObjectCmd) Encoding() {
+	o, ok := cmd.lookupOrReply()
+	if !ok {
+		return
+	}
+	cmd.c.addReplyBulkCString(strEncoding(o.Encoding))
+}
+
+// Freq implements OBJECT FREQ key
+func (cmd *ObjectCmd) Freq() {
+	o, ok := cmd.lookupOrReply()
+	if !ok {
+		return
+	}
+	if server.maxmemoryPolicy&db.MAXMEMORY_FLAG_LFU == 0 {
+		cmd.c.AddReplyError("An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		return
+	}
+	// LFUDecrAndReturn should be called
+	// in case of the key has not been accessed for a long time,
+	// because we update the access time only
+	// when the key is read or overwritten.
+	cmd.c.addReplyLongLong(db.LFUDecrAndReturn(o))
+}
+
+// Idletime implements OBJECT IDLETIME key
+func (cmd *ObjectCmd) Idletime() {
+	o, ok := cmd.lookupOrReply()
+	if !ok {
+		return
+	}
+	if server.maxmemoryPolicy&db.MAXMEMORY_FLAG_LFU != 0 {
+		cmd.c.AddReplyError("An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		return
+	}
+	cmd.c.addReplyLongLong(db.EstimateObjectIdleTime(o) / 1000)
+}
+
+// Refcount implements OBJECT REFCOUNT key. The objects are not shared, so
+// the value is always referenced once, by the keyspace.
+func (cmd *ObjectCmd) Refcount() {
+	if _, ok := cmd.lookupOrReply(); !ok {
+		return
+	}
+	cmd.c.addReplyLongLong(1)
+}
+
+// Help implements OBJECT HELP
+func (cmd *ObjectCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"ENCODING <key>",
+		"    Return the kind of internal representation used in order to store the value",
+		"    associated with a <key>.",
+		"FREQ <key>",
+		"    Return the access frequency index of the <key>. The returned integer is",
+		"    proportional to the logarithm of the recent access frequency of the key.",
+		"IDLETIME <key>",
+		"    Return the idle time of the <key>, that is the approximated number of",
+		"    seconds elapsed since the last access to the key.",
+		"REFCOUNT <key>",
+		"    Return the number of references of the value associated with the specified",
+		"    <key>.",
+	})
+}
+
+func objectEncodingCommand(c *Client) error {
+	NewObjectCmd(c).Encoding()
+	return nil
+}
+
+func objectFreqCommand(c *Client) error {
+	NewObjectCmd(c).Freq()
+	return nil
+}
+
+func objectIdletimeCommand(c *Client) error {
+	NewObjectCmd(c).Idletime()
+	return nil
+}
+
+func objectRefcountCommand(c *Client) error {
+	NewObjectCmd(c).Refcount()
+	return nil
+}
+
+func objectHelpCommand(c *Client) error {
+	NewObjectCmd(c).Help()
+	return nil
+}
@@ -0,0 +1,69 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectFreq(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	sendCommand(c, conn, "SET", "lru", "value")
+	if got := sendCommand(c, conn, "OBJECT", "FREQ", "lru"); !strings.HasPrefix(got, "-ERR An LFU maxmemory policy is not selected") {
+		t.Fatalf("OBJECT FREQ replied %q", got)
+	}
+
+	sendCommand(c, conn, "CONFIG", "SET", "maxmemory-policy", "allkeys-lfu")
+	defer sendCommand(c, conn, "CONFIG", "SET", "maxmemory-policy", "noeviction")
+	// Every access is counted with a log factor of 0.
+	sendCommand(c, conn, "CONFIG", "SET", "lfu-log-factor", "0")
+	defer sendCommand(c, conn, "CONFIG", "SET", "lfu-log-factor", "10")
+
+	sendCommand(c, conn, "SET", "hot", "value")
+	sendCommand(c, conn, "SET", "cold", "value")
+	for i := 0; i < 10; i++ {
+		sendCommand(c, conn, "GET", "hot")
+	}
+	// The new keys start at LFU_INIT_VAL, and OBJECT doesn't touch the key.
+	if got := sendCommand(c, conn, "OBJECT", "FREQ", "cold"); got != ":5\r\n" {
+		t.Fatalf("OBJECT FREQ cold replied %q", got)
+	}
+	if got := sendCommand(c, conn, "OBJECT", "FREQ", "hot"); got != ":15\r\n" {
+		t.Fatalf("OBJECT FREQ hot replied %q", got)
+	}
+	if got := sendCommand(c, conn, "OBJECT", "IDLETIME", "hot"); !strings.HasPrefix(got, "-ERR An LFU maxmemory policy is selected") {
+		t.Fatalf("OBJECT IDLETIME replied %q", got)
+	}
+}
+
+func TestObjectCommand(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	server.emptyData(-1, EmptyDbNoFlags)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	sendCommand(c, conn, "SET", "key", "value")
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"OBJECT", "IDLETIME", "key"}, ":0\r\n"},
+		{[]string{"OBJECT", "REFCOUNT", "key"}, ":1\r\n"},
+		{[]string{"OBJECT", "FREQ", "nokey"}, "$-1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "nokey"}, "$-1\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if got := sendCommand(c, conn, "OBJECT", "ENCODING", "key"); !strings.HasPrefix(got, "$") || strings.HasPrefix(got, "$-1") {
+		t.Errorf("OBJECT ENCODING replied %q", got)
+	}
+	if got := sendCommand(c, conn, "OBJECT", "HELP"); !strings.Contains(got, "FREQ <key>") {
+		t.Errorf("OBJECT HELP replied %q", got)
+	}
+}
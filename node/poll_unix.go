@@ -4,12 +4,14 @@
 package node
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/fzft/go-mock-redis/log"
 	"go.uber.org/zap"
 	"golang.org/x/sys/unix"
-	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -21,33 +23,52 @@ const (
 	readWriteEvents = readEvents | writeEvents
 )
 
-type pipeSignal uint8
+// pipeSignal is a signal sent to the event loop, the signals sent are
+// accumulated in Poll.signals and the eventfd wakes the loop up.
+type pipeSignal uint32
 
 const (
-	SignalStop pipeSignal = 1
+	SignalStop        pipeSignal = 1 << iota // Stop the event loop.
+	SignalShutdown                           // Shutdown gracefully, see ShutdownHandler.
+	SignalShutdownNow                        // Shutdown right away, see ShutdownHandler.
 )
 
 type Poll struct {
 	done chan struct{}
 	*Registry
-	epollFd  int   // epoll
-	listenFD int   // listener fd
-	connCnt  int64 // current fd size
-	maxFD    int64 // max fd size,
-	rHandler ReaderHandler
+	epollFd    int    // epoll
+	listenFDs  []int  // TCP listener fds, one per bind address
+	unixFD     int    // unix socket listener fd, -1 if none
+	unixSocket string // path of the unix socket
+	connCnt    int64  // current fd size
+	maxFD      int64  // max fd size,
+	rHandler   ReaderHandler
 
 	//  "eventfd trick" to wake up a blocking system
 	// used to send signal to epoll, trigger some event
-	efd int
+	efd     int
+	signals uint32 // the pipeSignals sent and not handled yet
 
-	connPool map[int]BufferedConn
+	connPool map[int]Conn
+
+	tlsFDs    []int       // TLS listener fds, one per bind address
+	tlsConfig *tls.Config // configuration of the TLS connections
+
+	// The TLS handshakes are done off the event loop, the connections are
+	// queued in handshaked once done, and hfd is signaled.
+	hfd         int // -1 until listening for TLS
+	handshakeMu sync.Mutex
+	handshaked  []tlsHandshake
+	closed      bool // late handshakes close their connection
+
+	tcpKeepAlive int // SO_KEEPALIVE interval of the accepted connections, 0 to disable
 }
 
 func (p *Poll) SetHandler(handler ReaderHandler) {
 	p.rHandler = handler
 }
 
-func NewPoll(done chan struct{}, size int64, lnFd int) (*Poll, error) {
+func NewPoll(done chan struct{}, size int64, lnFds []int) (*Poll, error) {
 	// Create a new epoll instance
 	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
 	if err != nil {
@@ -69,25 +90,41 @@ func NewPoll(done chan struct{}, size int64, lnFd int) (*Poll, error) {
 		return nil, err
 	}
 
-	// Register the listener to epoll for read events
-	if err := r.AddRead(lnFd); err != nil {
-		log.Logger.Error("Failed to add listener to epoll", zap.Error(err))
-		return nil, err
+	// Register the listeners to epoll for read events
+	for _, lnFd := range lnFds {
+		if err := r.AddRead(lnFd); err != nil {
+			log.Logger.Error("Failed to add listener to epoll", zap.Error(err))
+			return nil, err
+		}
 	}
 
 	poll := &Poll{
-		Registry: r,
-		epollFd:  epfd,
-		listenFD: lnFd,
-		maxFD:    size,
-		connPool: make(map[int]BufferedConn),
-		done:     done,
-		efd:      efd,
+		Registry:  r,
+		epollFd:   epfd,
+		listenFDs: lnFds,
+		unixFD:    -1,
+		hfd:       -1,
+		maxFD:     size,
+		connPool:  make(map[int]Conn),
+		done:      done,
+		efd:       efd,
 	}
 
 	return poll, nil
 }
 
+// listenUnix registers the listener of the unix socket at path, so that its
+// connections are accepted by the same epoll instance as the TCP ones.
+func (p *Poll) listenUnix(fd int, path string) error {
+	if err := p.AddRead(fd); err != nil {
+		log.Logger.Error("Failed to add unix socket listener to epoll", zap.Error(err))
+		return err
+	}
+	p.unixFD = fd
+	p.unixSocket = path
+	return nil
+}
+
 // CloseGracefully order: eventfd, listener, connections, epoll
 // prevent the fd leak
 func (p *Poll) CloseGracefully() error {
@@ -101,15 +138,30 @@ func (p *Poll) CloseGracefully() error {
 		log.Logger.Debug("Failed to close eventfd", zap.Error(err))
 	}
 
-	// close the listener fd
-	if err := p.Delete(p.listenFD); err != nil {
-		log.Logger.Debug("Failed to delete listener from epoll", zap.Error(err))
+	// close the listener fds
+	for _, fd := range p.listenFDs {
+		if err := p.Delete(fd); err != nil {
+			log.Logger.Debug("Failed to delete listener from epoll", zap.Error(err))
+		}
+
+		if err := CloseFd(fd); err != nil {
+			log.Logger.Debug("Failed to close listener", zap.Error(err))
+		}
 	}
 
-	if err := CloseFd(p.listenFD); err != nil {
-		log.Logger.Debug("Failed to close listener", zap.Error(err))
+	// close the unix socket listener fd
+	if p.unixFD != -1 {
+		if err := p.Delete(p.unixFD); err != nil {
+			log.Logger.Debug("Failed to delete unix socket listener from epoll", zap.Error(err))
+		}
+		if err := CloseFd(p.unixFD); err != nil {
+			log.Logger.Debug("Failed to close unix socket listener", zap.Error(err))
+		}
 	}
 
+	// close the TLS listener fds, and the pending handshakes
+	p.closeTLS()
+
 	// close all connections
 	if err := p.ClosAndClearAllFDs(); err != nil {
 		log.Logger.Debug("Failed to close connections", zap.Error(err))
@@ -127,21 +179,38 @@ func (p *Poll) poll() {
 	events := make([]unix.EpollEvent, p.maxFD)
 	msec := -1
 
+	// The timer handler, if any, is called from the loop itself, so that it
+	// never runs concurrently with the connection handlers.
+	timer, hasTimer := p.rHandler.(TimeHandler)
+	nextCron := time.Now()
+	sleeper, hasBeforeSleep := p.rHandler.(BeforeSleepHandler)
+
 	defer close(p.done)
 
 	// handle cleanup if necessary,
 	defer p.CloseGracefully()
 
 	for {
+		if hasTimer {
+			if !time.Now().Before(nextCron) {
+				nextCron = time.Now().Add(time.Duration(timer.Cron()) * time.Millisecond)
+			}
+			msec = int(time.Until(nextCron).Milliseconds())
+			if msec < 0 {
+				msec = 0
+			}
+		}
+		if hasBeforeSleep {
+			sleeper.BeforeSleep()
+		}
+
 		// EpollWait blocks until there is an event to report
 		// n: number of events returned
 		// if n ==0 , it means that the call timed out and no events were available
 		// if n < 0, it means that an error occurred
 		// level triggered, poll mode
 		n, err := unix.EpollWait(p.epollFd, events, msec)
-		if n == 0 || (n < 0 &&
-			err == unix.EINTR) {
-			log.Logger.Warn("epoll wait timeout")
+		if n == 0 || (n < 0 && err == unix.EINTR) {
 			continue
 		} else if err != nil {
 			log.Logger.Error("epoll wait error", zap.Error(err))
@@ -163,21 +232,54 @@ func (p *Poll) poll() {
 	}
 }
 
+// processEventsWhileBlocked processes the events that are already pending
+// without waiting, it is called from the event loop itself while a long
+// running script is executing, so that the clients can be served (usually
+// with a BUSY error, or FUNCTION KILL / SCRIPT KILL). The timers are not
+// processed, and a stop signal is delivered again to the main loop.
+func (p *Poll) processEventsWhileBlocked() {
+	events := make([]unix.EpollEvent, p.maxFD)
+	n, err := unix.EpollWait(p.epollFd, events, 0)
+	if n <= 0 || err != nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		ev := &events[i]
+		switch err := p.processEvent(int(ev.Fd), ev); err {
+		case nil:
+		case ErrSignalStopped:
+			_ = p.sendSignal(SignalStop)
+		default:
+			log.Logger.Error("Failed to process event", zap.Error(err))
+		}
+	}
+}
+
 func (p *Poll) processEvent(fd int, ev *unix.EpollEvent) error {
 	if ev.Events&unix.EPOLLERR != 0 || ev.Events&unix.EPOLLHUP != 0 {
 		log.Logger.Debug("epoll error event for fd ", zap.Int("fd", fd))
 
-		p.decrFd()
-
-		// remove the fd from epoll set
-		return p.unregister(fd)
+		conn, ok := p.connPool[fd]
+		if !ok {
+			p.decrFd()
+			// remove the fd from epoll set
+			return p.unregister(fd)
+		}
+		if h, ok := p.rHandler.(ConnHandler); ok {
+			h.Closed(conn)
+			return nil
+		}
+		return conn.Close()
 	}
 
 	if fd == p.efd {
 		// if the fd is the read end of the eventfd, it means that there is a signal to handle
 		return p.handleSignal(fd)
-	} else if fd == p.listenFD {
-		// if the fd is the listener, it means that there is a new connection
+	} else if fd == p.hfd {
+		// the TLS handshakes done, their connections are served now
+		return p.handleHandshakes()
+	} else if p.isListener(fd) {
+		// if the fd is a listener, it means that there is a new connection
 		return p.accept(fd)
 	} else {
 		// if the fd is not the listener, it means that there is data to read or write
@@ -187,15 +289,16 @@ func (p *Poll) processEvent(fd int, ev *unix.EpollEvent) error {
 				log.Logger.Error("connection not found")
 				return fmt.Errorf("connection not found for fd %d", fd)
 			}
-			return p.rHandler.Read(conn)
+			if err := p.rHandler.Read(conn); err != nil {
+				return err
+			}
 		}
 
 		if ev.Events&unix.EPOLLOUT != 0 {
-
+			// The connection may have been closed by the read handler.
 			conn, ok := p.connPool[fd]
 			if !ok {
-				log.Logger.Error("connection not found")
-				return fmt.Errorf("connection not found for fd %d", fd)
+				return nil
 			}
 
 			return p.handleWrite(conn)
@@ -204,6 +307,19 @@ func (p *Poll) processEvent(fd int, ev *unix.EpollEvent) error {
 	return nil
 }
 
+// isListener reports whether the fd is one of the listeners.
+func (p *Poll) isListener(fd int) bool {
+	if fd == p.unixFD {
+		return true
+	}
+	for _, lnFd := range p.listenFDs {
+		if fd == lnFd {
+			return true
+		}
+	}
+	return p.isTLSListener(fd)
+}
+
 // handleSignal handles the signal from the signal pipe
 func (p *Poll) handleSignal(fd int) error {
 	var buf uint64
@@ -212,17 +328,30 @@ func (p *Poll) handleSignal(fd int) error {
 		log.Logger.Error("Failed to read from event fd", zap.Error(err))
 		return nil
 	}
-	receivedSignal := pipeSignal(buf)
-	switch receivedSignal {
-	case SignalStop:
+	received := pipeSignal(atomic.SwapUint32(&p.signals, 0))
+	if received&SignalStop != 0 {
 		return ErrSignalStopped
 	}
+	if received&(SignalShutdown|SignalShutdownNow) != 0 {
+		h, ok := p.rHandler.(ShutdownHandler)
+		if !ok {
+			return ErrSignalStopped
+		}
+		h.Shutdown(received&SignalShutdownNow != 0)
+	}
 	return nil
 }
 
 // sendSignal sends a signal to the event fd
 func (p *Poll) sendSignal(sig pipeSignal) error {
-	_, err := unix.Write(p.efd, (*(*[8]byte)(unsafe.Pointer(&sig)))[:])
+	for {
+		old := atomic.LoadUint32(&p.signals)
+		if atomic.CompareAndSwapUint32(&p.signals, old, old|uint32(sig)) {
+			break
+		}
+	}
+	one := uint64(1)
+	_, err := unix.Write(p.efd, (*(*[8]byte)(unsafe.Pointer(&one)))[:])
 	if err != nil {
 		log.Logger.Error("Failed to write to event fd", zap.Error(err))
 	}
@@ -247,36 +376,73 @@ func (p *Poll) accept(fd int) error {
 		return fmt.Errorf("set nonblock error for fd %d: %w", connFd, err)
 	}
 
+	unixSocket := fd == p.unixFD
+	if p.tcpKeepAlive > 0 && !unixSocket {
+		if err := keepAlive(connFd, p.tcpKeepAlive); err != nil {
+			log.Logger.Warn("set keepalive error", zap.Int("fd", connFd), zap.Error(err))
+		}
+	}
+
+	conn := &DefaultBufferedConn{
+		fd:   connFd,
+		ip:   sockaddrToIp(sa),
+		addr: sockaddrToString(sa),
+		poll: p,
+	}
+	if unixSocket {
+		// The peers of a unix socket are unnamed, both ends are reported
+		// as the path of the socket, like Redis does.
+		conn.ip = p.unixSocket
+		conn.addr = p.unixSocket + ":0"
+		conn.laddr = conn.addr
+		conn.unixSocket = true
+	} else if lsa, err := unix.Getsockname(connFd); err == nil {
+		conn.laddr = sockaddrToString(lsa)
+	}
+
+	if p.isTLSListener(fd) {
+		// The connection is served once the handshake is done.
+		p.tlsAccept(newTLSConn(*conn, p.tlsConfig))
+		return nil
+	}
+
 	// register the new connection to epoll for read events
 	if err := p.registerRead(connFd); err != nil {
 		log.Logger.Error("register read error", zap.Error(err))
 		return fmt.Errorf("register read error for fd %d: %w", connFd, err)
 	}
+	return p.openConn(conn)
+}
 
-	// print the ip address of the new connection
-	var ip string
-	switch addr := sa.(type) {
-	case *unix.SockaddrInet4:
-		ip = net.IPv4(addr.Addr[0], addr.Addr[1], addr.Addr[2], addr.Addr[3]).String()
-	case *unix.SockaddrInet6:
-		ip = net.IP(addr.Addr[:]).String() // Convert 16-byte slice to net.IP
-	default:
-		// Handle other address types or ignore
-	}
-
-	p.connPool[connFd] = &DefaultBufferedConn{
-		fd: connFd,
-		ip: ip,
-	}
+// openConn adds the connection, registered for read events, to the pool and
+// notifies the handler.
+func (p *Poll) openConn(conn Conn) error {
+	p.connPool[conn.Fd()] = conn
 
 	// increase the number of fds
 	p.incrFd()
 
-	log.Logger.Debug("new connection", zap.Int("fd", connFd))
+	log.Logger.Debug("new connection", zap.Int("fd", conn.Fd()))
 
+	if h, ok := p.rHandler.(ConnHandler); ok {
+		if err := h.Open(conn); err != nil {
+			log.Logger.Error("open connection error", zap.Error(err))
+			return conn.Close()
+		}
+	}
 	return nil
 }
 
+// removeConn unregisters the connection fd from epoll and forgets it.
+func (p *Poll) removeConn(fd int) error {
+	if _, ok := p.connPool[fd]; !ok {
+		return nil
+	}
+	delete(p.connPool, fd)
+	p.decrFd()
+	return p.unregister(fd)
+}
+
 func (p *Poll) incrFd() {
 	atomic.AddInt64(&p.connCnt, 1)
 }
@@ -285,38 +451,31 @@ func (p *Poll) decrFd() {
 	atomic.AddInt64(&p.connCnt, -1)
 }
 
-func (p *Poll) handleWrite(conn BufferedConn) error {
-
-	fd := conn.Fd()
-
-	// Get the data to write
-	data := conn.DataToWrite()
-	n, err := p.writeRawToFd(fd, data)
-	if err != nil {
-		log.Logger.Error("write error", zap.Error(err))
-		return fmt.Errorf("write error for fd %d: %w", fd, err)
-	}
-
-	// Advance the buffer to reflect the bytes written
-	conn.Next(n)
-
-	if conn.Len() == 0 {
-		// All data was written. Deregister EPOLLOUT for this fd.
-		if err := p.deregisterWrite(fd); err != nil {
-			log.Logger.Error("failed to deregister write", zap.Error(err))
-			return fmt.Errorf("failed to deregister write for fd %d: %w", fd, err)
+// handleWrite serves the writable event of the connection, the handler
+// writes the pending output, otherwise the event is just removed.
+func (p *Poll) handleWrite(conn Conn) error {
+	// The TLS records pending are flushed first, the handler is notified
+	// only if it asked to.
+	if tc, ok := conn.(*TLSConn); ok {
+		notify, err := tc.writable()
+		if err != nil {
+			log.Logger.Debug("TLS write error", zap.Int("fd", conn.Fd()), zap.Error(err))
+			if h, ok := p.rHandler.(ConnHandler); ok {
+				h.Closed(conn)
+				return nil
+			}
+			return conn.Close()
+		}
+		if !notify {
+			return nil
 		}
 	}
-
-	return nil
-}
-
-// writeRawToFd writes data to the socket
-func (p *Poll) writeRawToFd(fd int, data []byte) (n int, err error) {
-	n, err = unix.Write(fd, data)
-	if err != nil {
-		log.Logger.Error("write error", zap.Error(err))
-		return n, err
+	if h, ok := p.rHandler.(WritableHandler); ok {
+		return h.Writable(conn)
 	}
-	return n, nil
+	if err := p.deregisterWrite(conn.Fd()); err != nil {
+		log.Logger.Error("failed to deregister write", zap.Error(err))
+		return fmt.Errorf("failed to deregister write for fd %d: %w", conn.Fd(), err)
+	}
+	return nil
 }
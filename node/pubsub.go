@@ -0,0 +1,468 @@
+package node
+
+import (
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/*-----------------------------------------------------------------------------
+ * Pubsub client replies API
+ *----------------------------------------------------------------------------*/
+
+// addReplyPubsubHeader emits the header of a Pub/Sub reply, an array for
+// RESP2 clients and a push message for RESP3 clients.
+func (c *Client) addReplyPubsubHeader(n int) {
+	if c.resp == 2 {
+		c.addReplyArrayLen(n)
+	} else {
+		c.addReplyPushLen(n)
+	}
+}
+
+// addReplyPubsubMessage send a pubsub message to the client
+func (c *Client) addReplyPubsubMessage(channel, msg string) {
+	old := c.flags
+	c.flags |= ClientPushing
+	c.addReplyPubsubHeader(3)
+	c.AddReply(SharedMessageBulk)
+	c.addReplyBulkCString(channel)
+	c.addReplyBulkCString(msg)
+	if old&ClientPushing == 0 {
+		c.flags &= ^ClientPushing
+	}
+}
+
+// addReplyPubsubPatMessage send a pubsub message matched by a pattern to the client
+func (c *Client) addReplyPubsubPatMessage(pat, channel, msg string) {
+	old := c.flags
+	c.flags |= ClientPushing
+	c.addReplyPubsubHeader(4)
+	c.AddReply(SharedPmessageBulk)
+	c.addReplyBulkCString(pat)
+	c.addReplyBulkCString(channel)
+	c.addReplyBulkCString(msg)
+	if old&ClientPushing == 0 {
+		c.flags &= ^ClientPushing
+	}
+}
+
+// addReplyPubsubSubscribed send the pubsub subscription notification to the client.
+func (c *Client) addReplyPubsubSubscribed(channel string, subscribe *db.RedisObj) {
+	c.addReplyPubsubHeader(3)
+	c.AddReply(subscribe)
+	c.addReplyBulkCString(channel)
+	c.addReplyLongLong(int64(c.clientSubscriptionsCount()))
+}
+
+// addReplyPubsubUnsubscribed send the pubsub unsubscription notification to the client.
+// Channel can be empty: this is useful when the client sends a mass unsubscribe
+// command but there are no channels to unsubscribe from.
+func (c *Client) addReplyPubsubUnsubscribed(channel string, unsubscribe *db.RedisObj) {
+	c.addReplyPubsubHeader(3)
+	c.AddReply(unsubscribe)
+	if channel != "" {
+		c.addReplyBulkCString(channel)
+	} else {
+		c.addReplyNull()
+	}
+	c.addReplyLongLong(int64(c.clientSubscriptionsCount()))
+}
+
+/*-----------------------------------------------------------------------------
+ * Pubsub low level API
+ *----------------------------------------------------------------------------*/
+
+// clientSubscriptionsCount return the number of channels + patterns a client is subscribed to.
+func (c *Client) clientSubscriptionsCount() int {
+	return c.pubsubChannels.Len() + c.pubsubPatterns.Len()
+}
+
+// markClientAsPubSub sets or clears the ClientPubSub flag after the
+// subscriptions of the client changed.
+func (c *Client) markClientAsPubSub() {
+	if c.clientSubscriptionsCount() > 0 {
+		c.flags |= ClientPubSub
+	} else {
+		c.flags &= ^ClientPubSub
+	}
+}
+
+// pubsubSubscribeChannel subscribes a client to a channel. Returns true if the
+// operation succeeded, or false if the client was already subscribed to that channel.
+func (c *Client) pubsubSubscribeChannel(channel string) bool {
+	retval := false
+
+	// Add the channel to the client -> channels hash dict
+	if !c.pubsubChannels.Contains(channel) {
+		retval = true
+		c.pubsubChannels.Add(channel)
+		// Add the client to the channel -> list of clients hash table
+		clients, exist := server.pubsubChannels.Get(channel)
+		if !exist {
+			clients = db.NewList[*Client]()
+			server.pubsubChannels.Set(channel, clients)
+		}
+		clients.AddNodeTail(c)
+	}
+	// Notify the client
+	c.addReplyPubsubSubscribed(channel, SharedSubscribeBulk)
+	return retval
+}
+
+// pubsubUnsubscribeChannel unsubscribes a client from a channel. Returns true if the
+// operation succeeded, or false if the client was not subscribed to the specified channel.
+func (c *Client) pubsubUnsubscribeChannel(channel string, notify bool) bool {
+	retval := false
+
+	if c.pubsubChannels.Contains(channel) {
+		retval = true
+		c.pubsubChannels.Remove(channel)
+		// Remove the client from the channel -> clients list hash table
+		pubsubUnlinkClient(server.pubsubChannels, channel, c)
+	}
+	// Notify the client
+	if notify {
+		c.addReplyPubsubUnsubscribed(channel, SharedUnsubscribeBulk)
+	}
+	return retval
+}
+
+// pubsubSubscribePattern subscribes a client to a pattern. Returns true if the
+// operation succeeded, or false if the client was already subscribed to that pattern.
+func (c *Client) pubsubSubscribePattern(pattern string) bool {
+	retval := false
+
+	if !c.pubsubPatterns.Contains(pattern) {
+		retval = true
+		c.pubsubPatterns.Add(pattern)
+		// Add the client to the pattern -> list of clients hash table
+		clients, exist := server.pubsubPatterns.Get(pattern)
+		if !exist {
+			clients = db.NewList[*Client]()
+			server.pubsubPatterns.Set(pattern, clients)
+		}
+		clients.AddNodeTail(c)
+	}
+	// Notify the client
+	c.addReplyPubsubSubscribed(pattern, SharedPSubscribeBulk)
+	return retval
+}
+
+// pubsubUnsubscribePattern unsubscribes a client from a pattern. Returns true if the
+// operation succeeded, or false if the client was not subscribed to the specified pattern.
+func (c *Client) pubsubUnsubscribePattern(pattern string, notify bool) bool {
+	retval := false
+
+	if c.pubsubPatterns.Contains(pattern) {
+		retval = true
+		c.pubsubPatterns.Remove(pattern)
+		// Remove the client from the pattern -> clients list hash table
+		pubsubUnlinkClient(server.pubsubPatterns, pattern, c)
+	}
+	// Notify the client
+	if notify {
+		c.addReplyPubsubUnsubscribed(pattern, SharedPUnsubscribeBulk)
+	}
+	return retval
+}
+
+// pubsubUnlinkClient removes the client from the list of subscribers of the
+// channel or pattern, deleting the entry if it was the last subscriber.
+func pubsubUnlinkClient(table *db.HashTable[string, *db.List[*Client]], name string, c *Client) {
+	clients, exist := table.Get(name)
+	if !exist {
+		return
+	}
+	if node := clients.SearchNode(func(v *Client) bool { return v == c }); node != nil {
+		clients.RemoveNode(node)
+	}
+	if clients.Len() == 0 {
+		// Free the list and associated hash entry at all if this was
+		// the latest client, so that it will be possible to abuse
+		// Redis PUBSUB creating millions of channels.
+		table.Delete(name)
+	}
+}
+
+// pubsubUnsubscribeAllChannels unsubscribes from all the channels. Returns the
+// number of channels the client was subscribed to.
+func (c *Client) pubsubUnsubscribeAllChannels(notify bool) int {
+	var channels []string
+	c.pubsubChannels.Range(func(channel string) bool {
+		channels = append(channels, channel)
+		return true
+	})
+
+	for _, channel := range channels {
+		c.pubsubUnsubscribeChannel(channel, notify)
+	}
+
+	// We were subscribed to nothing? Still reply to the client.
+	if notify && len(channels) == 0 {
+		c.addReplyPubsubUnsubscribed("", SharedUnsubscribeBulk)
+	}
+	return len(channels)
+}
+
+// pubsubUnsubscribeAllPatterns unsubscribes from all the patterns. Returns the
+// number of patterns the client was subscribed to.
+func (c *Client) pubsubUnsubscribeAllPatterns(notify bool) int {
+	var patterns []string
+	c.pubsubPatterns.Range(func(pattern string) bool {
+		patterns = append(patterns, pattern)
+		return true
+	})
+
+	for _, pattern := range patterns {
+		c.pubsubUnsubscribePattern(pattern, notify)
+	}
+
+	// We were subscribed to nothing? Still reply to the client.
+	if notify && len(patterns) == 0 {
+		c.addReplyPubsubUnsubscribed("", SharedPUnsubscribeBulk)
+	}
+	return len(patterns)
+}
+
+// pubsubPublishMessage publishes a message to all the subscribers of the
+// channel and of the patterns matching it. Returns the number of clients
+// that received the message.
+func pubsubPublishMessage(channel, message string) int {
+	receivers := 0
+
+	// Send to clients listening for that channel
+	if clients, exist := server.pubsubChannels.Get(channel); exist {
+		iter := clients.NewListIterator(db.DIRECTION_HEAD)
+		for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+			node.Value.addReplyPubsubMessage(channel, message)
+			receivers++
+		}
+	}
+
+	// Send to clients listening to matching channels
+	server.pubsubPatterns.Range(func(pattern string, clients *db.List[*Client]) bool {
+		if !stringMatch(pattern, channel, false) {
+			return true
+		}
+		iter := clients.NewListIterator(db.DIRECTION_HEAD)
+		for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+			node.Value.addReplyPubsubPatMessage(pattern, channel, message)
+			receivers++
+		}
+		return true
+	})
+
+	return receivers
+}
+
+/*-----------------------------------------------------------------------------
+ * Pubsub commands implementation
+ *----------------------------------------------------------------------------*/
+
+// PubSubCmd handles the Pub/Sub commands.
+type PubSubCmd struct {
+	c *Client
+}
+
+// NewPubSubCmd returns a new PubSubCmd.
+func NewPubSubCmd(c *Client) *PubSubCmd {
+	return &PubSubCmd{c: c}
+}
+
+// Subscribe implements SUBSCRIBE channel [channel ...]
+func (cmd *PubSubCmd) Subscribe() {
+	for j := 1; j < cmd.c.argc; j++ {
+		cmd.c.pubsubSubscribeChannel(cmd.c.argv[j].Value.(string))
+	}
+	cmd.c.markClientAsPubSub()
+}
+
+// Unsubscribe implements UNSUBSCRIBE [channel ...]
+func (cmd *PubSubCmd) Unsubscribe() {
+	if cmd.c.argc == 1 {
+		cmd.c.pubsubUnsubscribeAllChannels(true)
+	} else {
+		for j := 1; j < cmd.c.argc; j++ {
+			cmd.c.pubsubUnsubscribeChannel(cmd.c.argv[j].Value.(string), true)
+		}
+	}
+	cmd.c.markClientAsPubSub()
+}
+
+// PSubscribe implements PSUBSCRIBE pattern [pattern ...]
+func (cmd *PubSubCmd) PSubscribe() {
+	for j := 1; j < cmd.c.argc; j++ {
+		cmd.c.pubsubSubscribePattern(cmd.c.argv[j].Value.(string))
+	}
+	cmd.c.markClientAsPubSub()
+}
+
+// PUnsubscribe implements PUNSUBSCRIBE [pattern ...]
+func (cmd *PubSubCmd) PUnsubscribe() {
+	if cmd.c.argc == 1 {
+		cmd.c.pubsubUnsubscribeAllPatterns(true)
+	} else {
+		for j := 1; j < cmd.c.argc; j++ {
+			cmd.c.pubsubUnsubscribePattern(cmd.c.argv[j].Value.(string), true)
+		}
+	}
+	cmd.c.markClientAsPubSub()
+}
+
+// Publish implements PUBLISH channel message
+func (cmd *PubSubCmd) Publish() {
+	receivers := pubsubPublishMessage(cmd.c.argv[1].Value.(string), cmd.c.argv[2].Value.(string))
+	cmd.c.addReplyLongLong(int64(receivers))
+}
+
+// Channels implements PUBSUB CHANNELS [pattern]
+func (cmd *PubSubCmd) Channels() {
+	var pattern string
+	if cmd.c.argc == 3 {
+		pattern = cmd.c.argv[2].Value.(string)
+	}
+
+	var channels []string
+	server.pubsubChannels.Range(func(channel string, _ *db.List[*Client]) bool {
+		if pattern == "" || stringMatch(pattern, channel, false) {
+			channels = append(channels, channel)
+		}
+		return true
+	})
+
+	cmd.c.addReplyArrayLen(len(channels))
+	for _, channel := range channels {
+		cmd.c.addReplyBulkCString(channel)
+	}
+}
+
+// NumSub implements PUBSUB NUMSUB [channel ...]
+func (cmd *PubSubCmd) NumSub() {
+	cmd.c.addReplyMapLen(cmd.c.argc - 2)
+	for j := 2; j < cmd.c.argc; j++ {
+		channel := cmd.c.argv[j].Value.(string)
+		var count int
+		if clients, exist := server.pubsubChannels.Get(channel); exist {
+			count = clients.Len()
+		}
+		cmd.c.addReplyBulkCString(channel)
+		cmd.c.addReplyLongLong(int64(count))
+	}
+}
+
+// NumPat implements PUBSUB NUMPAT
+func (cmd *PubSubCmd) NumPat() {
+	cmd.c.addReplyLongLong(int64(server.pubsubPatterns.Len()))
+}
+
+// Help implements PUBSUB HELP
+func (cmd *PubSubCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"CHANNELS [<pattern>]",
+		"    Return the currently active channels matching a <pattern> (default: '*').",
+		"NUMPAT",
+		"    Return number of subscriptions to patterns.",
+		"NUMSUB [<channel> ...]",
+		"    Return the number of subscribers for the specified channels, excluding",
+		"    pattern subscriptions(default: no channels).",
+	})
+}
+
+// isPubSubContextCommand returns true for the commands a RESP2 client can
+// still send once it entered the Pub/Sub mode.
+func isPubSubContextCommand(cmd RedisCommand) bool {
+	switch cmd.Fullname() {
+	case "ping", "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "quit", "reset":
+		return true
+	}
+	return false
+}
+
+// ChannelFlags describe how a command uses a Pub/Sub channel.
+type ChannelFlags uint8
+
+const (
+	ChannelPattern     ChannelFlags = 1 << iota // The argument is a channel pattern.
+	ChannelPublish                              // The command publishes to this channel.
+	ChannelSubscribe                            // The command subscribes to this channel.
+	ChannelUnsubscribe                          // The command unsubscribes from this channel.
+)
+
+// channelReference is a channel found in the arguments of a command.
+type channelReference struct {
+	pos   int
+	flags ChannelFlags
+}
+
+// getChannelsFromCommand returns the channels of the arguments of the Pub/Sub
+// commands.
+func getChannelsFromCommand(cmd RedisCommand, argv []*db.RedisObj, argc int) []channelReference {
+	var (
+		flags ChannelFlags
+		first int
+		last  = argc - 1
+	)
+	switch cmd.Fullname() {
+	case "publish":
+		flags, first, last = ChannelPublish, 1, 1
+	case "subscribe":
+		flags, first = ChannelSubscribe, 1
+	case "psubscribe":
+		flags, first = ChannelPattern|ChannelSubscribe, 1
+	case "unsubscribe":
+		flags, first = ChannelUnsubscribe, 1
+	case "punsubscribe":
+		flags, first = ChannelPattern|ChannelUnsubscribe, 1
+	default:
+		return nil
+	}
+	channels := make([]channelReference, 0, last-first+1)
+	for j := first; j <= last && j < argc; j++ {
+		channels = append(channels, channelReference{pos: j, flags: flags})
+	}
+	return channels
+}
+
+func subscribeCommand(c *Client) error {
+	NewPubSubCmd(c).Subscribe()
+	return nil
+}
+
+func unsubscribeCommand(c *Client) error {
+	NewPubSubCmd(c).Unsubscribe()
+	return nil
+}
+
+func psubscribeCommand(c *Client) error {
+	NewPubSubCmd(c).PSubscribe()
+	return nil
+}
+
+func punsubscribeCommand(c *Client) error {
+	NewPubSubCmd(c).PUnsubscribe()
+	return nil
+}
+
+func publishCommand(c *Client) error {
+	NewPubSubCmd(c).Publish()
+	return nil
+}
+
+func pubsubChannelsCommand(c *Client) error {
+	NewPubSubCmd(c).Channels()
+	return nil
+}
+
+func pubsubNumSubCommand(c *Client) error {
+	NewPubSubCmd(c).NumSub()
+	return nil
+}
+
+func pubsubNumPatCommand(c *Client) error {
+	NewPubSubCmd(c).NumPat()
+	return nil
+}
+
+func pubsubHelpCommand(c *Client) error {
+	NewPubSubCmd(c).Help()
+	return nil
+}
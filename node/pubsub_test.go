@@ -0,0 +1,47 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPubSub(t *testing.T) {
+	c, conn := newTestClient()
+	sub, subConn := newTestClient()
+	defer freeClient(sub)
+
+	if got := sendCommand(sub, subConn, "SUBSCRIBE", "news"); got != "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n" {
+		t.Fatalf("SUBSCRIBE replied %q", got)
+	}
+	if got := sendCommand(sub, subConn, "PSUBSCRIBE", "n*"); got != "*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:2\r\n" {
+		t.Fatalf("PSUBSCRIBE replied %q", got)
+	}
+
+	// Only the Pub/Sub commands are allowed in the context of RESP2.
+	if got := sendCommand(sub, subConn, "GET", "news"); !strings.HasPrefix(got, "-ERR Can't execute 'get'") {
+		t.Fatalf("GET replied %q", got)
+	}
+
+	subConn.Buffer.Reset()
+	if got := sendCommand(c, conn, "PUBLISH", "news", "hello"); got != ":2\r\n" {
+		t.Fatalf("PUBLISH replied %q", got)
+	}
+	want := "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n" +
+		"*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n"
+	if got := subConn.Buffer.String(); got != want {
+		t.Fatalf("the subscriber got %q, want %q", got, want)
+	}
+
+	if got := sendCommand(c, conn, "PUBSUB", "NUMSUB", "news", "other"); got != "*4\r\n$4\r\nnews\r\n:1\r\n$5\r\nother\r\n:0\r\n" {
+		t.Fatalf("PUBSUB NUMSUB replied %q", got)
+	}
+	if got := sendCommand(c, conn, "PUBSUB", "NUMPAT"); got != ":1\r\n" {
+		t.Fatalf("PUBSUB NUMPAT replied %q", got)
+	}
+
+	// A freed client is unsubscribed from everything.
+	freeClient(sub)
+	if got := sendCommand(c, conn, "PUBLISH", "news", "hello"); got != ":0\r\n" {
+		t.Fatalf("PUBLISH replied %q after the subscriber was freed", got)
+	}
+}
@@ -1,6 +1,11 @@
 package node
 
 type IReactor interface {
-	NewReactor() (r *Reactor, err error)
 	Run()
+	SetHandler(handler ReaderHandler)
+	// ProcessEventsWhileBlocked serves the pending events without waiting, it
+	// is called while the server is busy running a long script.
+	ProcessEventsWhileBlocked()
+	// Stop makes Run return once the current event is served.
+	Stop()
 }
@@ -4,45 +4,66 @@
 package node
 
 import (
+	"crypto/tls"
 	"net"
 	"os"
+
+	"golang.org/x/sys/unix"
 )
 
 type Reactor struct {
-	listener net.Listener
-	poll     *Poll
-	done     chan struct{}
-	sig      chan os.Signal
+	listeners    []net.Listener    // TCP listeners, one per bind address
+	unixListener *net.UnixListener // nil if not listening on a unix socket
+	tlsListeners []net.Listener    // TLS listeners, one per bind address
+	poll         *Poll
+	done         chan struct{}
+	sig          chan os.Signal
 }
 
 func (r *Reactor) Run() {
 	go r.poll.poll()
 
-	select {
-	case <-r.done:
-		return
-	case <-r.sig:
-		r.poll.sendSignal(SignalStop)
-		<-r.done
-		return
+	// The signals are delivered to the event loop, SIGUSR1 shuts down right
+	// away.
+	for {
+		select {
+		case <-r.done:
+			return
+		case sig := <-r.sig:
+			if sig == unix.SIGUSR1 {
+				r.poll.sendSignal(SignalShutdownNow)
+			} else {
+				r.poll.sendSignal(SignalShutdown)
+			}
+		}
 	}
 }
 
-func NewReactor(listener net.Listener, sig chan os.Signal) (*Reactor, error) {
+// Stop stops the event loop, Run returns once the current event is served.
+func (r *Reactor) Stop() {
+	r.poll.sendSignal(SignalStop)
+}
+
+func NewReactor(listeners []net.Listener, sig chan os.Signal) (*Reactor, error) {
 	r := &Reactor{
-		listener: listener,
-		done:     make(chan struct{}),
-		sig:      sig,
+		listeners: listeners,
+		done:      make(chan struct{}),
+		sig:       sig,
 	}
 
-	f, err := listener.(*net.TCPListener).File()
-	if err != nil {
-		return nil, err
+	fds := make([]int, 0, len(listeners))
+	for _, ln := range listeners {
+		fd, err := listenerFd(ln)
+		if err != nil {
+			closeFds(fds)
+			return nil, err
+		}
+		fds = append(fds, fd)
 	}
 
-	fd := int(f.Fd())
-	p, err := NewPoll(r.done, MaxFD, fd)
+	p, err := NewPoll(r.done, MaxFD, fds)
 	if err != nil {
+		closeFds(fds)
 		return nil, err
 	}
 
@@ -50,6 +71,82 @@ func NewReactor(listener net.Listener, sig chan os.Signal) (*Reactor, error) {
 	return r, nil
 }
 
+// ListenUnix accepts the connections of the unix socket listener too, on the
+// same epoll instance as the TCP listeners.
+func (r *Reactor) ListenUnix(ln *net.UnixListener) error {
+	fd, err := listenerFd(ln)
+	if err != nil {
+		return err
+	}
+	if err := r.poll.listenUnix(fd, ln.Addr().String()); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	r.unixListener = ln
+	return nil
+}
+
+// ListenTLS accepts the connections of the TLS listeners too, they speak TLS
+// with the configuration.
+func (r *Reactor) ListenTLS(listeners []net.Listener, config *tls.Config) error {
+	fds := make([]int, 0, len(listeners))
+	for _, ln := range listeners {
+		fd, err := listenerFd(ln)
+		if err != nil {
+			closeFds(fds)
+			return err
+		}
+		fds = append(fds, fd)
+	}
+	if err := r.poll.listenTLS(fds, config); err != nil {
+		closeFds(fds)
+		return err
+	}
+	r.tlsListeners = append(r.tlsListeners, listeners...)
+	return nil
+}
+
+// closeFds closes the listener fds not yet owned by the poll.
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
+
+// listenerFd returns a non blocking duplicate of the fd of the listener, owned
+// by the poll. The os.File of the listener is closed right away, it would
+// close the fd once collected otherwise.
+func listenerFd(ln net.Listener) (int, error) {
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return -1, unix.EINVAL
+	}
+	f, err := fl.File()
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	fd, err := unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
 func (r *Reactor) SetHandler(handler ReaderHandler) {
 	r.poll.SetHandler(handler)
 }
+
+func (r *Reactor) ProcessEventsWhileBlocked() {
+	r.poll.processEventsWhileBlocked()
+}
+
+// SetTCPKeepAlive sets the SO_KEEPALIVE interval in seconds of the accepted
+// connections, 0 disables it.
+func (r *Reactor) SetTCPKeepAlive(interval int) {
+	r.poll.tcpKeepAlive = interval
+}
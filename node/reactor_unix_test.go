@@ -0,0 +1,218 @@
+//go:build linux
+// +build linux
+
+package node
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// acceptHandler reports the connections accepted by the reactor.
+type acceptHandler struct {
+	opened chan Conn
+}
+
+func (h acceptHandler) Open(conn Conn) error {
+	h.opened <- conn
+	return nil
+}
+
+func (h acceptHandler) Read(conn Conn) error {
+	if _, err := conn.Read(); err != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+func (h acceptHandler) Closed(conn Conn) {
+	conn.Close()
+}
+
+// accepted returns the connection accepted after dialing the address.
+func (h acceptHandler) accepted(t *testing.T, network, address string) Conn {
+	t.Helper()
+	c, err := net.Dial(network, address)
+	if err != nil {
+		t.Fatalf("dial %s %s: %v", network, address, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	select {
+	case conn := <-h.opened:
+		return conn
+	case <-time.After(time.Second):
+		t.Fatalf("the %s connection was not accepted", network)
+		return nil
+	}
+}
+
+func TestReactorUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+
+	// A socket file left by a previous instance.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := &RedisServer{unixSocket: path, unixSocketPerm: 0700}
+	uln, err := s.listenUnix()
+	if err != nil {
+		t.Fatalf("listenUnix: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0700 {
+		t.Fatalf("the socket file is %v, %v", fi, err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	r, err := NewReactor([]net.Listener{ln}, make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ListenUnix(uln); err != nil {
+		t.Fatal(err)
+	}
+	h := acceptHandler{opened: make(chan Conn, 1)}
+	r.SetHandler(h)
+	go r.Run()
+	defer func() {
+		r.poll.sendSignal(SignalStop)
+		<-r.done
+		uln.Close()
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("the socket file was not removed: %v", err)
+		}
+	}()
+
+	// Both listeners are served by the same epoll instance.
+	conn := h.accepted(t, "unix", path)
+	if uc, ok := conn.(UnixSocketConn); !ok || !uc.IsUnixSocket() {
+		t.Errorf("the unix connection is not flagged")
+	}
+	if conn.Ip() != path || conn.Addr() != path+":0" || conn.LocalAddr() != path+":0" {
+		t.Errorf("the unix connection is %q %q %q", conn.Ip(), conn.Addr(), conn.LocalAddr())
+	}
+
+	conn = h.accepted(t, "tcp", ln.Addr().String())
+	if uc, ok := conn.(UnixSocketConn); !ok || uc.IsUnixSocket() {
+		t.Errorf("the TCP connection is flagged")
+	}
+	if conn.Ip() != "127.0.0.1" || conn.LocalAddr() != ln.Addr().String() {
+		t.Errorf("the TCP connection is %q %q", conn.Ip(), conn.LocalAddr())
+	}
+}
+
+func TestReactorBindAddresses(t *testing.T) {
+	// Pick a free port.
+	free, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	// The optional addresses not available on this host are skipped, like
+	// the IPv6 loopback when IPv6 is disabled.
+	s := &RedisServer{port: port, bindAddr: []string{"127.0.0.1", "-::1", "-192.0.2.1"}}
+	listeners, err := s.listenToPort(port)
+	if err != nil {
+		t.Fatalf("listenToPort: %v", err)
+	}
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+	if len(listeners) == 0 || len(listeners) > 2 {
+		t.Fatalf("%d listeners", len(listeners))
+	}
+
+	// A mandatory address that is not available is an error.
+	s.bindAddr = []string{"192.0.2.1"}
+	if _, err := s.listenToPort(port); err == nil {
+		t.Fatalf("listening on an unavailable address")
+	}
+
+	r, err := NewReactor(listeners, make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := acceptHandler{opened: make(chan Conn, 1)}
+	r.SetHandler(h)
+	go r.Run()
+	defer func() {
+		r.poll.sendSignal(SignalStop)
+		<-r.done
+	}()
+
+	// Every listener is registered in the poll.
+	for _, ln := range listeners {
+		conn := h.accepted(t, "tcp", ln.Addr().String())
+		if ip := net.ParseIP(conn.Ip()); ip == nil || !ip.IsLoopback() {
+			t.Errorf("the connection to %s is from %q", ln.Addr(), conn.Ip())
+		}
+	}
+}
+
+// shutdownHandler reports the shutdown signals delivered to the event loop.
+type shutdownHandler struct {
+	acceptHandler
+	shutdowns chan bool
+}
+
+func (h shutdownHandler) Shutdown(now bool) {
+	h.shutdowns <- now
+}
+
+func TestReactorShutdownSignals(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sig := make(chan os.Signal)
+	r, err := NewReactor([]net.Listener{ln}, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := shutdownHandler{shutdowns: make(chan bool, 1)}
+	r.SetHandler(h)
+	done := make(chan struct{})
+	go func() {
+		r.Run()
+		close(done)
+	}()
+
+	// The handler shuts down by itself, SIGUSR1 right away.
+	for _, tc := range []struct {
+		sig os.Signal
+		now bool
+	}{{syscall.SIGTERM, false}, {syscall.SIGINT, false}, {syscall.SIGUSR1, true}} {
+		sig <- tc.sig
+		select {
+		case now := <-h.shutdowns:
+			if now != tc.now {
+				t.Errorf("%v shuts down with now %v", tc.sig, now)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v is not delivered", tc.sig)
+		}
+	}
+
+	r.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("the reactor is not stopped")
+	}
+}
@@ -40,29 +40,40 @@ func (r *Registry) registerRead(fd int) (err error) {
 	return
 }
 
-// registerWrite registers fd to epoll for write events.
-func (r *Registry) registerWrite(fd int) (err error) {
-	_, ok := r.epollSet[fd]
+// registerWrite adds the write events to the events monitored for fd, it is a
+// no-op if they are monitored already.
+func (r *Registry) registerWrite(fd int) error {
+	events, ok := r.epollSet[fd]
+	if ok && events&writeEvents != 0 {
+		return nil
+	}
+	return r.setEvents(fd, events|writeEvents, ok)
+}
 
-	if ok {
-		err = r.ModWrite(fd)
-	} else {
-		err = r.AddWrite(fd)
+// deregisterWrite stops monitoring the write events of fd, the read events
+// are kept. It is a no-op if the write events are not monitored.
+func (r *Registry) deregisterWrite(fd int) error {
+	events, ok := r.epollSet[fd]
+	if ok && events&writeEvents == 0 {
+		return nil
 	}
+	return r.setEvents(fd, events&^writeEvents|readEvents, ok)
+}
 
+// setEvents adds fd to epoll, or modifies it if it is registered already, to
+// monitor the events.
+func (r *Registry) setEvents(fd int, events int, registered bool) (err error) {
+	ev := &unix.EpollEvent{Fd: int32(fd), Events: uint32(events)}
+	if registered {
+		err = os.NewSyscallError("epoll_ctl mod", unix.EpollCtl(r.epollFd, unix.EPOLL_CTL_MOD, fd, ev))
+	} else {
+		err = os.NewSyscallError("epoll_ctl add", unix.EpollCtl(r.epollFd, unix.EPOLL_CTL_ADD, fd, ev))
+	}
 	if err != nil {
 		return err
 	}
-
-	r.epollSet[fd] = writeEvents
-	return
-}
-
-// deregisterWrite modifies fd in epoll to stop monitoring write events. turn to read events.
-func (r *Registry) deregisterWrite(fd int) error {
-	// Assuming you want to keep monitoring the fd for read events.
-	// If not, adjust the events as necessary.
-	return r.registerRead(fd)
+	r.epollSet[fd] = events
+	return nil
 }
 
 // unregister removes fd from epoll.
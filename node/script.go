@@ -0,0 +1,456 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/log"
+	"github.com/fzft/go-mock-redis/resp"
+	"go.uber.org/zap"
+)
+
+/* This file implements the logic shared by all the scripts run by the server
+ * (the functions called by FCALL): the run context, the execution of Redis
+ * commands from the script, the detection of busy scripts and their kill. */
+
+// ScriptFlags are the flags a script declares.
+type ScriptFlags uint16
+
+const (
+	ScriptFlagNoWrites       ScriptFlags = 1 << iota // The script does not write to the keyspace.
+	ScriptFlagAllowOOM                               // The script may run when the server is out of memory.
+	ScriptFlagAllowStale                             // The script may run on a stale replica.
+	ScriptFlagNoCluster                              // The script can not run in cluster mode.
+	ScriptFlagAllowCrossSlot                         // The script may access keys of different slots.
+	ScriptFlagEvalCompatMode                         // An EVAL script without shebang, not a user visible flag.
+)
+
+// scriptFlagsDef maps the script flags to their user visible names.
+var scriptFlagsDef = []struct {
+	flag ScriptFlags
+	name string
+}{
+	{ScriptFlagNoWrites, "no-writes"},
+	{ScriptFlagAllowOOM, "allow-oom"},
+	{ScriptFlagAllowStale, "allow-stale"},
+	{ScriptFlagNoCluster, "no-cluster"},
+	{ScriptFlagAllowCrossSlot, "allow-cross-slot-keys"},
+}
+
+// scriptFlagsNames returns the names of the flags, in declaration order.
+func scriptFlagsNames(flags ScriptFlags) []string {
+	names := make([]string, 0, len(scriptFlagsDef))
+	for _, def := range scriptFlagsDef {
+		if flags&def.flag != 0 {
+			names = append(names, def.name)
+		}
+	}
+	return names
+}
+
+// scriptRunFlags describe the state of the running script.
+type scriptRunFlags uint8
+
+const (
+	scriptWriteDirty scriptRunFlags = 1 << iota // The script already performed a write command.
+	scriptTimedOut                              // The script exceeded the busy reply threshold.
+	scriptKilled                                // The script was marked to be killed.
+	scriptReadOnly                              // The script may only perform read commands.
+	scriptEvalMode                              // The script was called with EVAL.
+	scriptAllowOOM                              // The script may write when the server is out of memory.
+)
+
+// ReplyError is a Redis error reply, starting with the error code, like
+// "WRONGTYPE Operation against a key holding the wrong kind of value".
+// Errors returned by ScriptRunCtx.Call have this type, and returning one
+// from a script replies with it verbatim.
+type ReplyError string
+
+func (e ReplyError) Error() string {
+	return string(e)
+}
+
+// StatusReply is a Redis status reply, like "OK". Status replies returned by
+// ScriptRunCtx.Call have this type, while plain strings are bulk replies.
+type StatusReply string
+
+// ScriptRunCtx is the context of the running script, scripts use it to call
+// Redis commands.
+type ScriptRunCtx struct {
+	funcname       string
+	c              *Client // the script client, used to run the commands
+	originalClient *Client // the client that called the script
+	flags          scriptRunFlags
+	startTime      time.Time
+}
+
+// scriptConn collects the replies of the commands run by a script.
+type scriptConn struct {
+	buf bytes.Buffer
+}
+
+func (sc *scriptConn) Read() ([]byte, error) {
+	return nil, nil
+}
+
+func (sc *scriptConn) Write(data []byte) (int, error) {
+	return sc.buf.Write(data)
+}
+
+func (sc *scriptConn) Close() error {
+	return nil
+}
+
+func (sc *scriptConn) Fd() int {
+	return -1
+}
+
+func (sc *scriptConn) Ip() string {
+	return ""
+}
+
+func (sc *scriptConn) Addr() string {
+	return ""
+}
+
+func (sc *scriptConn) LocalAddr() string {
+	return ""
+}
+
+// createScriptClient creates the client used to run the commands called by
+// the scripts, it is not linked to the server clients.
+func createScriptClient() *Client {
+	c := NewClient(0, ClientScript, &scriptConn{}, 2, server.db[0])
+	// The commands are checked against the ACLs of the caller of the script.
+	c.user = nil
+	c.authenticated = true
+	return c
+}
+
+// scriptIsRunning reports whether a script is running.
+func scriptIsRunning() bool {
+	return server.scriptRunCtx != nil
+}
+
+// scriptIsTimedOut reports whether the running script exceeded the busy reply
+// threshold, the other clients are replied with BUSY in that case.
+func scriptIsTimedOut() bool {
+	return scriptIsRunning() && server.scriptRunCtx.flags&scriptTimedOut != 0
+}
+
+// scriptIsEval reports whether the running script was called with EVAL.
+func scriptIsEval() bool {
+	return scriptIsRunning() && server.scriptRunCtx.flags&scriptEvalMode != 0
+}
+
+// isInsideYieldingLongCommand reports whether the server is serving the
+// clients from within a long running command.
+func isInsideYieldingLongCommand() bool {
+	return scriptIsTimedOut()
+}
+
+// scriptPrepareForRun prepares the run context before running the script,
+// false is returned, and the caller replied with an error, if the script can
+// not run.
+func scriptPrepareForRun(runCtx *ScriptRunCtx, caller *Client, funcname string, scriptFlags ScriptFlags, ro bool) bool {
+	compat := scriptFlags&ScriptFlagEvalCompatMode != 0
+	if !compat && scriptFlags&ScriptFlagNoWrites == 0 && ro {
+		caller.AddReplyError("Can not execute a script with write flag using *_ro command.")
+		return false
+	}
+
+	// Check OOM state. the no-writes flag imply allow-oom. we tested it
+	// after the no-write error, so no need to mention it in the error reply.
+	if !compat && scriptFlags&(ScriptFlagAllowOOM|ScriptFlagNoWrites) == 0 &&
+		server.maxmemory != 0 && !caller.mustObeyClient() && server.preCommandOOMState {
+		caller.addReplyErrorFormat("-OOM allow-oom flag is not set on the script, can not run it when used memory > 'maxmemory'")
+		return false
+	}
+
+	c := server.scriptClient
+	c.db = caller.db
+	c.resp = 2
+
+	runCtx.c = c
+	runCtx.originalClient = caller
+	runCtx.funcname = funcname
+	if (!compat && scriptFlags&ScriptFlagNoWrites != 0) || ro {
+		runCtx.flags |= scriptReadOnly
+	}
+	if !compat && scriptFlags&ScriptFlagAllowOOM != 0 {
+		runCtx.flags |= scriptAllowOOM
+	}
+	runCtx.startTime = time.Now()
+
+	// The script is shown to the monitors before the commands it calls.
+	replicationFeedMonitors(caller, server.monitors, caller.db.GetID(), caller.commandVector())
+
+	server.scriptRunCtx = runCtx
+	return true
+}
+
+// scriptResetRun resets the run context after the script returned.
+func scriptResetRun(runCtx *ScriptRunCtx) {
+	if runCtx.flags&scriptTimedOut != 0 {
+		runCtx.flags &= ^scriptTimedOut
+		runCtx.originalClient.unprotectClient()
+	}
+	server.scriptRunCtx = nil
+}
+
+// scriptInterrupt is called periodically while the script runs: once the
+// script exceeds the busy reply threshold it serves the other clients, which
+// get a BUSY error unless they kill the script. true is returned if the
+// script was killed and must stop.
+func scriptInterrupt(runCtx *ScriptRunCtx) bool {
+	if runCtx.flags&scriptTimedOut != 0 {
+		// script already timedout we just need to process some events and return
+		server.processEventsWhileBlocked()
+		return runCtx.flags&scriptKilled != 0
+	}
+
+	elapsed := time.Since(runCtx.startTime).Milliseconds()
+	if elapsed < server.busyReplyThreshold {
+		return false
+	}
+
+	killCmd := "FUNCTION KILL"
+	if runCtx.flags&scriptEvalMode != 0 {
+		killCmd = "SCRIPT KILL"
+	}
+	log.Logger.Warn("Slow script detected: still in execution, you can try killing the script",
+		zap.Int64("elapsed_ms", elapsed), zap.String("kill_command", killCmd), zap.String("script", runCtx.funcname))
+
+	// Once the script timeouts we reenter the event loop to permit others
+	// some commands execution. For this reason we need to make sure that the
+	// calling client is protected and not freed.
+	runCtx.flags |= scriptTimedOut
+	runCtx.originalClient.protectClient()
+
+	server.processEventsWhileBlocked()
+	return runCtx.flags&scriptKilled != 0
+}
+
+// killedError is the error returned by a killed script.
+func (runCtx *ScriptRunCtx) killedError() error {
+	if runCtx.flags&scriptEvalMode != 0 {
+		return ReplyError("ERR Script killed by user with SCRIPT KILL...")
+	}
+	return ReplyError("ERR Script killed by user with FUNCTION KILL...")
+}
+
+// scriptKill kills the running script, it implements SCRIPT KILL and
+// FUNCTION KILL.
+func scriptKill(c *Client, isEval bool) {
+	runCtx := server.scriptRunCtx
+	if runCtx == nil {
+		c.addReplyErrorFormat("-NOTBUSY No scripts in execution right now.")
+		return
+	}
+	if runCtx.flags&scriptWriteDirty != 0 {
+		c.addReplyErrorFormat("-UNKILLABLE Sorry the script already executed write " +
+			"commands against the dataset. You can either wait the " +
+			"script termination or kill the server in a hard way " +
+			"using the SHUTDOWN NOSAVE command.")
+		return
+	}
+	if isEval && runCtx.flags&scriptEvalMode == 0 {
+		// Kill a function with 'SCRIPT KILL' is not allow
+		c.addReplyErrorFormat("-NOTBUSY No scripts in execution right now.")
+		return
+	}
+	if !isEval && runCtx.flags&scriptEvalMode != 0 {
+		// Kill an eval with 'FUNCTION KILL' is not allow
+		c.addReplyErrorFormat("-NOTBUSY No scripts in execution right now.")
+		return
+	}
+	runCtx.flags |= scriptKilled
+	c.AddReply(SharedOk)
+}
+
+// scriptVerifyWriteCommandAllow checks that a write command may run from the
+// script.
+func (runCtx *ScriptRunCtx) scriptVerifyWriteCommandAllow() error {
+	if runCtx.c.cmd.Flags()&CmdWrite == 0 {
+		return nil
+	}
+	if runCtx.flags&scriptReadOnly != 0 {
+		return ReplyError("ERR Write commands are not allowed from read-only scripts.")
+	}
+	return nil
+}
+
+// scriptVerifyOOM checks that the command may run from the script when the
+// server is out of memory. Once the script performed a write the following
+// commands are not denied, so that the script is not left half executed.
+func (runCtx *ScriptRunCtx) scriptVerifyOOM() error {
+	if runCtx.flags&scriptAllowOOM != 0 {
+		// Allow any call
+		return nil
+	}
+	if server.maxmemory != 0 && !runCtx.originalClient.mustObeyClient() &&
+		runCtx.flags&scriptWriteDirty == 0 && server.preCommandOOMState &&
+		runCtx.c.cmd.Flags()&CmdDenyOOM != 0 {
+		return ReplyError("OOM command not allowed when used memory > 'maxmemory'.")
+	}
+	return nil
+}
+
+// scriptCall runs the command given by args from the script, and returns its
+// parsed reply. An error is returned if the command can not be called from
+// the script, or if the script was killed.
+func scriptCall(runCtx *ScriptRunCtx, args []string) (resp.Node, error) {
+	if scriptInterrupt(runCtx) {
+		return nil, runCtx.killedError()
+	}
+	if len(args) == 0 {
+		return nil, ReplyError("ERR Please specify at least one argument for this redis lib call")
+	}
+
+	c := runCtx.c
+	c.argc = len(args)
+	c.argv = make([]*db.RedisObj, 0, len(args))
+	for _, arg := range args {
+		c.argv = append(c.argv, createObject(db.StringType, arg))
+	}
+	defer c.freeClientArgv()
+
+	c.cmd = c.lookupCommand(c.argv, c.argc)
+	c.realCmd = c.cmd
+	if c.cmd == nil {
+		return nil, ReplyError("ERR Unknown Redis command called from script")
+	}
+	if _, ok := c.commandCheckArity(); !ok {
+		return nil, ReplyError("ERR Wrong number of args calling Redis command from script")
+	}
+	if c.cmd.Flags()&CmdNoScript != 0 {
+		return nil, ReplyError("ERR This Redis command is not allowed from script")
+	}
+	// Check the ACLs of the user running the script.
+	caller := runCtx.originalClient
+	if aclRet, aclErrPos := caller.user.ACLCheckAllUserCommandPerm(c.cmd, c.argv, c.argc); aclRet != ACLOK {
+		// The denial is logged for the caller, the object is taken from the
+		// command of the script.
+		object := c.argv[aclErrPos].Value.(string)
+		if aclRet == ACLDeniedCmd {
+			object = c.cmd.Fullname()
+		}
+		addACLLogEntry(caller, aclRet, ACLLogCtxLua, 0, "", object)
+		return nil, ReplyError("NOPERM " + getAclErrorMessage(aclRet, caller.user, c.cmd, c.argv[aclErrPos].Value.(string), false))
+	}
+	if err := runCtx.scriptVerifyWriteCommandAllow(); err != nil {
+		return nil, err
+	}
+	if err := runCtx.scriptVerifyOOM(); err != nil {
+		return nil, err
+	}
+	if c.cmd.Flags()&CmdWrite != 0 {
+		// signify that we already change the data in this execution
+		runCtx.flags |= scriptWriteDirty
+	}
+
+	conn := c.connection.(*scriptConn)
+	conn.buf.Reset()
+	c.Call(CmdCallFull)
+	reply, _ := resp.Parse(conn.buf.Bytes())
+	conn.buf.Reset()
+	return reply, nil
+}
+
+// Call runs a Redis command from the script, like redis.call() in Lua. The
+// reply is returned as a Go value: nil, int64, string, StatusReply or []any.
+// Error replies are returned as a ReplyError.
+func (runCtx *ScriptRunCtx) Call(args ...string) (any, error) {
+	reply, err := scriptCall(runCtx, args)
+	if err != nil {
+		return nil, err
+	}
+	return respToScriptValue(reply)
+}
+
+// Yield must be called periodically by the scripts doing long computations
+// without calling commands, so that the server can serve the other clients
+// once the busy reply threshold is reached. An error is returned if the
+// script was killed, the script should return it.
+func (runCtx *ScriptRunCtx) Yield() error {
+	if scriptInterrupt(runCtx) {
+		return runCtx.killedError()
+	}
+	return nil
+}
+
+// respToScriptValue converts a reply to the value returned by Call.
+func respToScriptValue(node resp.Node) (any, error) {
+	switch n := node.(type) {
+	case resp.Null:
+		return nil, nil
+	case resp.Integer:
+		return int64(n.Value), nil
+	case resp.BlobString:
+		return n.Value, nil
+	case resp.SimpleString:
+		return StatusReply(n.Value), nil
+	case resp.Error:
+		return nil, ReplyError(n.Message)
+	case resp.Array:
+		values := make([]any, 0, len(n.Elements))
+		for _, e := range n.Elements {
+			v, err := respToScriptValue(e)
+			if err != nil {
+				// Errors nested in arrays are kept as values.
+				v = err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	default:
+		return nil, ReplyError(fmt.Sprintf("ERR Unsupported reply type %T", node))
+	}
+}
+
+// addReplyScriptValue replies with the value returned by a script, see Call
+// for the types. Besides, booleans are replied as 1 (true) and null (false),
+// like Lua does, and any other error is replied with the ERR code.
+func (c *Client) addReplyScriptValue(v any) {
+	switch value := v.(type) {
+	case nil:
+		c.addReplyNull()
+	case ReplyError:
+		c.addReplyErrorFormat("-" + strings.TrimPrefix(string(value), "-"))
+	case error:
+		c.addReplyErrorFormat(value.Error())
+	case StatusReply:
+		c.addReplyStatus(string(value))
+	case string:
+		c.addReplyBulkCString(value)
+	case []byte:
+		c.addReplyBulkCString(string(value))
+	case int:
+		c.addReplyLongLong(int64(value))
+	case int64:
+		c.addReplyLongLong(value)
+	case float64:
+		c.addReplyLongLong(int64(value))
+	case bool:
+		if value {
+			c.addReplyLongLong(1)
+		} else {
+			c.addReplyNull()
+		}
+	case []string:
+		c.addReplyArrayLen(len(value))
+		for _, s := range value {
+			c.addReplyBulkCString(s)
+		}
+	case []any:
+		c.addReplyArrayLen(len(value))
+		for _, e := range value {
+			c.addReplyScriptValue(e)
+		}
+	default:
+		c.addReplyErrorFormat(fmt.Sprintf("Unsupported script reply type %T", v))
+	}
+}
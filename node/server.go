@@ -1,18 +1,25 @@
 package node
 
 import (
-	"fmt"
+	"crypto/tls"
+	"errors"
 	"github.com/fzft/go-mock-redis/db"
 	"github.com/fzft/go-mock-redis/log"
 	"go.uber.org/zap"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 const UserCommandBitsCount = 1024
 
+// RedisVersion is the version of the server, as reported by HELLO.
+const RedisVersion = "255.255.255"
+
 var server *RedisServer
 var users *db.RaxTree[*User]
 var defaultUser *User
@@ -24,7 +31,10 @@ const (
 	ProtoMBulkBigArg     = 1024 * 32
 	ProtoResizeThreshold = 1024 * 32
 	ProtoReplyMinBytes   = 1024
-	RedisAutoSyncBytes   = 1024 * 1024 * 4 // 512MB
+	ProtoMaxBulkLen      = 512 * 1024 * 1024 // Max length of a single bulk argument
+	ProtoMaxMultiBulkLen = 1024 * 1024       // Max number of arguments of a multi bulk request
+	RedisAutoSyncBytes   = 1024 * 1024 * 4   // 512MB
+	IOVMax               = 1024              // Max number of buffers written by a single Writev
 )
 
 const (
@@ -33,34 +43,178 @@ const (
 
 const MaxFD int64 = 1024
 
+// clientBufferLimitsConfig is the output buffer limit of a class of clients,
+// as set by client-output-buffer-limit. A zero limit is disabled.
+type clientBufferLimitsConfig struct {
+	hardLimitBytes   int64
+	softLimitBytes   int64
+	softLimitSeconds int64
+}
+
+const (
+	ConfigDefaultHz               = 10 // Time interrupt calls/sec.
+	ConfigDefaultDbNum            = 16 // Number of databases.
+	ActiveExpireCycleSlowTimePerc = 25 // Max % of CPU to use.
+)
+
+// EmptyDbFlags control how emptyData releases the keys.
+type EmptyDbFlags uint8
+
+const (
+	EmptyDbNoFlags EmptyDbFlags = 0      // No flags.
+	EmptyDbAsync   EmptyDbFlags = 1 << 0 // Reclaim memory in another thread.
+)
+
 type RedisServer struct {
 
 	// General
-	pid            int    // server pid
-	configFile     string // Path of config file
-	executable     string // Path of executable file
-	db             *db.RedisDb
+	pid            int           // server pid
+	configFile     string        // Path of config file
+	executable     string        // Path of executable file
+	db             []*db.RedisDb // database array, dbNum entries
 	commands       *db.HashTable[string, RedisCommand]
 	originCommands *db.HashTable[string, RedisCommand]
 	pidPath        string // pid file path
+	runId          string // ID always different at every exec
 	reactor        IReactor
 	handler        ReaderHandler
 	hz             int // serverCron() calls frequency in hertz
 
 	// Networking
-	port          int
-	tlsPort       int
-	bindAddr      []string // Addresses we should bind to
-	bindAddrCount int      // Number of addresses in bindAddr
-	clients       *db.List[Client]
+	port           int
+	tlsPort        int
+	bindAddr       []string // Addresses we should bind to
+	bindAddrCount  int      // Number of addresses in bindAddr
+	unixSocket     string   // UNIX socket path
+	unixSocketPerm uint32   // UNIX socket permission
+	protectedMode  bool     // Don't accept external connections without a password or an explicit bind
+	tlsCertFile    string   // Certificate of the server
+	tlsKeyFile     string   // Private key of the certificate
+	tlsCaCertFile  string   // CA certificates verifying the clients
+	tlsCaCertDir   string   // Directory of CA certificates verifying the clients
+	tlsAuthClients int      // Whether the clients must authenticate with a certificate
+	tlsProtocols   string   // Enabled TLS protocols
+	tlsCiphers     string   // Enabled TLSv1.2 cipher suites
+	clients        *db.List[*Client]
+	clientsIndex   *db.RaxTree[*Client] // Active clients dictionary by client ID.
+	clientsToClose *db.List[*Client]    // Clients to close asynchronously
+	connClients    map[int]*Client      // Clients indexed by connection fd
+	nextClientId   uint64               // Next client unique ID. Incremental.
+	nextCommandId  int                  // Next command ID, used to index the ACL bitmaps
+	currentClient  *Client              // Current client executing the command
+	monitors       *db.List[*Client]    // List of MONITOR clients
+
+	// Blocked clients
+	unblockedClients *db.List[*Client] // List of clients to unblock before next loop
+	postponedClients *db.List[*Client] // List of postponed clients
+
+	// Threaded I/O
+	ioThreadsNum                 int               // Number of I/O threads, including the event loop
+	ioThreadsDoReads             bool              // Read and parse from the I/O threads too
+	ioThreads                    []*ioThread       // The I/O threads, the event loop is the first one
+	ioThreadsActive              bool              // The I/O threads are running
+	clientsPendingRead           *db.List[*Client] // Clients to read from, by the I/O threads
+	clientsPendingWrite          *db.List[*Client] // Clients with replies to write, before the next loop
+	processingEventsWhileBlocked bool              // Serving the events from a long running script
+
+	// Shutdown
+	shutdownTimeout int64         // Seconds to wait for the replicas on shutdown
+	shutdownFlags   ShutdownFlags // Flags of the shutdown in progress
+	shutdownMstime  int64         // Time in milliseconds the shutdown waits for the replicas until, 0 if none
+
+	// Client pause
+	clientPauseType    PauseType // True if clients are currently paused
+	clientPauseEndTime int64     // Time in milliseconds when the pause ends
+
+	// Transactions
+	watchedKeys []*db.HashTable[string, *db.List[*watchedKey]] // WATCHED keys for MULTI/EXEC CAS, indexed by db id
+
+	// Scripting
+	functions          *functionsLibCtx // Registered function libraries
+	lua                *luaCtx          // Lua interpreter and scripts cache of EVAL
+	scriptClient       *Client          // The client running the commands called by the scripts
+	scriptRunCtx       *ScriptRunCtx    // The running script, nil if none
+	busyReplyThreshold int64            // Script / module timeout in milliseconds
+
+	// Client side caching
+	trackingClients     int        // Number of clients with tracking enabled
+	trackingPendingKeys [][]string // Invalidations of the current client sent after its command, nil after a flush
+
+	// Pubsub
+	pubsubChannels       *db.HashTable[string, *db.List[*Client]] // Map channels to list of subscribed clients
+	pubsubPatterns       *db.HashTable[string, *db.List[*Client]] // Map patterns to list of subscribed clients
+	notifyKeyspaceEvents db.NotifyType                            // Events to propagate via Pub/Sub.
+
+	// Fields used only for stats
+	cronLoops                  int64                                 // Number of times the cron function run
+	expireCurrentDb            int                                   // Next DB to test in the active expire cycle
+	statStartTime              int64                                 // Server start time, unix time in seconds
+	statNumCommands            uint64                                // Number of processed commands
+	statNumConnections         uint64                                // Number of connections received
+	statRejectedConn           uint64                                // Clients rejected when accepted, by the protected mode
+	statNetInputBytes          uint64                                // Bytes read from network
+	statNetOutputBytes         uint64                                // Bytes written to network
+	statTotalReadsProcessed    uint64                                // Total number of read events processed
+	statTotalWritesProcessed   uint64                                // Total number of write events processed
+	statIOReadsProcessed       uint64                                // Number of read events processed by the I/O threads
+	statIOWritesProcessed      uint64                                // Number of write events processed by the I/O threads
+	statTotalErrorReplies      uint64                                // Total number of issued error replies
+	statUnexpectedErrorReplies uint64                                // Number of unexpected (aof-loading, replica to master, etc.) error replies
+	statPeakMemory             int64                                 // Max used memory record
+	initialMemoryUsage         int64                                 // Bytes used after initialization
+	prevErrCount               uint64                                // Error replies count before the current command, see incrCommandStatsOnError
+	errors                     *db.RaxTree[*redisError]              // Errors table, error code -> count
+	errorsEnabled              bool                                  // If true, errorstats is enabled, and we will add new errors
+	instMetric                 [StatsMetricCount]instantaneousMetric // Samples of the instantaneous metrics
+
+	// ACLs
+	aclFilename  string     // ACL Users file. Empty if not configured.
+	aclLogMaxLen int        // Max number of entries of the ACL LOG
+	usersToLoad  [][]string // Users declared by the user directives of the config file
+
+	// Replication
+	replId string // My current replication ID
+
+	// Slow log
+	slowlog              *db.List[*slowlogEntry] // SLOWLOG list of commands, newest first
+	slowlogEntryId       int64                   // SLOWLOG current entry ID
+	slowlogLogSlowerThan int64                   // SLOWLOG time limit (to get logged), in microseconds
+	slowlogMaxLen        int64                   // SLOWLOG max number of items logged
+
+	// Latency monitor
+	latencyEvents                  map[string]*latencyTimeSeries // Time series of the sampled events, by event name
+	latencyMonitorThreshold        int64                         // Events slower than this, in milliseconds, are sampled
+	latencyTrackingEnabled         bool                          // 1 if extended latency tracking is enabled, 0 otherwise.
+	latencyTrackingInfoPercentiles []float64                     // Extended latency tracking info output percentile list configuration.
 
 	// RDB persistence
 	dirty uint64 // change to DB from the last save
 
+	// Limits
+	maxmemory                 int64            // Max number of memory bytes to use
+	maxmemoryPolicy           int              // Policy for key eviction
+	maxmemorySamples          int              // Precision of random sampling
+	maxmemoryEvictionTenacity int              // Aggressiveness of eviction processing
+	lfuLogFactor              int              // LFU logarithmic counter factor
+	lfuDecayTime              int              // LFU counter decay factor, in minutes
+	evictionPool              *db.EvictionPool // Best keys to evict, shared by all the DBs
+	evictionInProgress        bool             // The eviction reached its time limit and goes on in the cron
+	nextEvictDb               int              // Next DB a random key is evicted from
+	preCommandOOMState        bool             // OOM before command (script?) was started
+
+	// Lazy free
+	lazyfreeLazyEviction  bool // Free the evicted keys in the background
+	lazyfreeLazyExpire    bool // Free the expired keys in the background
+	lazyfreeLazyServerDel bool // Free the keys deleted implicitly by commands in the background
+	lazyfreeLazyUserDel   bool // DEL behaves like UNLINK
+	lazyfreeThreshold     int  // Values with a smaller free effort are freed synchronously
+
 	// Configuration
-	maxIdleTime int64 // default client timeout
-	tcpKeepLive int   // default tcp keepalive
-	dbNum       int   // default db number
+	maxIdleTime          int64                                         // default client timeout
+	tcpKeepLive          int                                           // default tcp keepalive
+	dbNum                int                                           // default db number
+	clientMaxQueryBufLen int64                                         // Limit for client query buffer length
+	clientObufLimits     [ClientTypeObufCount]clientBufferLimitsConfig // Output buffer limits by client class
 
 	lastSave int64 // Unix time of last save successful completion
 
@@ -69,51 +223,446 @@ type RedisServer struct {
 }
 
 func NewServer(port int) *RedisServer {
-	return &RedisServer{
-		port: port,
+	s := &RedisServer{}
+	s.initConfigValues()
+	// Functions can be registered before the server runs.
+	s.functions = newFunctionsLibCtx()
+	s.port = port
+	s.runId = getRandomHexChars(ConfigRunIdSize)
+	s.replId = getRandomHexChars(ConfigRunIdSize)
+	return s
+}
+
+// initServer creates the runtime state of the server (databases, command
+// table, Pub/Sub, ...) and makes it the current server.
+func (s *RedisServer) initServer() {
+	server = s
+	s.pid = os.Getpid()
+	s.statStartTime = time.Now().Unix()
+	if s.executable == "" {
+		s.executable, _ = os.Executable()
 	}
+	s.db = make([]*db.RedisDb, s.dbNum)
+	s.watchedKeys = make([]*db.HashTable[string, *db.List[*watchedKey]], s.dbNum)
+	for j := 0; j < s.dbNum; j++ {
+		s.db[j] = db.New(uint64(j))
+		s.watchedKeys[j] = db.NewHashTable[string, *db.List[*watchedKey]](db.INITIAL_DB_SIZE)
+	}
+	s.clients = db.NewList[*Client]()
+	s.clientsIndex = db.NewRaxTree[*Client]()
+	s.unblockedClients = db.NewList[*Client]()
+	s.postponedClients = db.NewList[*Client]()
+	s.clientsToClose = db.NewList[*Client]()
+	s.clientsPendingRead = db.NewList[*Client]()
+	s.clientsPendingWrite = db.NewList[*Client]()
+	s.monitors = db.NewList[*Client]()
+	s.slowlog = db.NewList[*slowlogEntry]()
+	s.latencyEvents = make(map[string]*latencyTimeSeries)
+	s.evictionPool = db.NewEvictionPool()
+	s.connClients = make(map[int]*Client)
+	s.pubsubChannels = db.NewHashTable[string, *db.List[*Client]](db.INITIAL_DB_SIZE)
+	s.pubsubPatterns = db.NewHashTable[string, *db.List[*Client]](db.INITIAL_DB_SIZE)
+	s.commands = db.NewHashTable[string, RedisCommand](len(redisCommandTable))
+	s.originCommands = db.NewHashTable[string, RedisCommand](len(redisCommandTable))
+	s.populateCommandTable()
+	s.scriptClient = createScriptClient()
+	s.lua = scriptingInit()
+	aclInit()
+	trackingInit()
+	s.resetErrorTableStats()
+	db.SetKeyspaceNotifier(notifyKeyspaceEvent)
+	db.SetModifiedKeyHook(signalModifiedKey)
+	db.SetEvictionConfigGetter(func() db.EvictionConfig {
+		return db.EvictionConfig{MaxmemoryPolicy: s.maxmemoryPolicy, LFULogFactor: s.lfuLogFactor, LFUDecayTime: s.lfuDecayTime}
+	})
+	db.SetLazyfreeConfigGetter(func() db.LazyfreeConfig {
+		return db.LazyfreeConfig{
+			LazyEviction:  s.lazyfreeLazyEviction,
+			LazyExpire:    s.lazyfreeLazyExpire,
+			LazyServerDel: s.lazyfreeLazyServerDel,
+			Threshold:     s.lazyfreeThreshold,
+		}
+	})
+	s.initialMemoryUsage = db.UsedMemory()
 }
 
 func (s *RedisServer) Run() error {
-	sigCh := make(chan os.Signal)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
-	if err != nil {
-		log.Logger.Error("listen error: ", zap.Error(err))
+	s.initServer()
+	if err := ACLLoadUsersAtStartup(); err != nil {
+		log.Logger.Error("Aborting Redis startup because of ACL errors", zap.Error(err))
 		return err
 	}
 
-	reactor, err := NewReactor(ln, sigCh)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1)
+
+	// Open the TCP listening sockets for the user commands, the port 0
+	// disables TCP.
+	var listeners []net.Listener
+	if s.port != 0 {
+		var err error
+		if listeners, err = s.listenToPort(s.port); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+
+	// The TLS listening sockets, on tls-port.
+	var tlsListeners []net.Listener
+	var tlsConfig *tls.Config
+	if s.tlsPort != 0 {
+		var err error
+		if tlsConfig, err = s.tlsConfigure(); err != nil {
+			log.Logger.Error("Failed to configure TLS", zap.Error(err))
+			return err
+		}
+		if tlsListeners, err = s.listenToPort(s.tlsPort); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		for _, ln := range tlsListeners {
+			ln.Close()
+		}
+	}()
+
+	if len(listeners) == 0 && len(tlsListeners) == 0 && s.unixSocket == "" {
+		log.Logger.Error("Configured to not listen anywhere, exiting.")
+		return errors.New("configured to not listen anywhere")
+	}
+
+	reactor, err := NewReactor(listeners, sigCh)
 	if err != nil {
 		return err
 	}
 
 	if s.handler == nil {
-		s.handler = DefaultHandler{}
+		s.handler = RedisHandler{server: s}
+	}
+
+	if len(tlsListeners) > 0 {
+		if err := reactor.ListenTLS(tlsListeners, tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if s.unixSocket != "" {
+		uln, err := s.listenUnix()
+		if err != nil {
+			log.Logger.Error("Failed opening Unix socket", zap.String("path", s.unixSocket), zap.Error(err))
+			return err
+		}
+		// Closing the listener removes the socket file.
+		defer uln.Close()
+		if err := reactor.ListenUnix(uln); err != nil {
+			return err
+		}
 	}
 
 	reactor.SetHandler(s.handler)
+	reactor.SetTCPKeepAlive(s.tcpKeepLive)
+	s.reactor = reactor
+
+	s.initThreadedIO()
+	defer s.killIOThreads()
 
-	log.Logger.Info("listening on ", zap.Int("port", s.port))
+	if len(listeners) > 0 {
+		log.Logger.Info("listening on ", zap.Int("port", s.port), zap.Strings("bind", s.bindAddr))
+	}
+	if len(tlsListeners) > 0 {
+		log.Logger.Info("listening for TLS connections on ", zap.Int("port", s.tlsPort), zap.Strings("bind", s.bindAddr))
+	}
+	if s.unixSocket != "" {
+		log.Logger.Info("The server is now ready to accept connections at " + s.unixSocket)
+	}
+	s.createPidFile()
 	reactor.Run()
 	log.Logger.Info("shutting down server")
 	return nil
 }
 
+// listenToPort listens on the port for every bind address. "*" and "::*"
+// are the IPv4 and IPv6 wildcards. An address with the "-" prefix is
+// optional: it is skipped if it is not available on this host, like the IPv6
+// addresses when IPv6 is disabled.
+func (s *RedisServer) listenToPort(port int) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(s.bindAddr))
+	for _, addr := range s.bindAddr {
+		optional := strings.HasPrefix(addr, "-")
+		addr = strings.TrimPrefix(addr, "-")
+		network := "tcp4"
+		if strings.Contains(addr, ":") {
+			network = "tcp6"
+		}
+		switch addr {
+		case "*":
+			addr = "0.0.0.0"
+		case "::*":
+			addr = "::"
+		}
+
+		ln, err := net.Listen(network, net.JoinHostPort(addr, strconv.Itoa(port)))
+		if err != nil {
+			if optional && isAddrNotAvailable(err) {
+				log.Logger.Warn("Skipping the optional bind address", zap.String("addr", addr), zap.Error(err))
+				continue
+			}
+			log.Logger.Error("Could not create server TCP listening socket", zap.String("addr", addr), zap.Int("port", port), zap.Error(err))
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on the unix socket, the socket file left by a previous
+// instance that did not exit cleanly is removed first. The permissions of the
+// socket are set to unixsocketperm, if configured.
+func (s *RedisServer) listenUnix() (*net.UnixListener, error) {
+	if fi, err := os.Lstat(s.unixSocket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.unixSocket)
+	}
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: s.unixSocket, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if s.unixSocketPerm != 0 {
+		if err := os.Chmod(s.unixSocket, os.FileMode(s.unixSocketPerm)); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// processEventsWhileBlocked serves the pending events of the clients while
+// the server is busy running a long script.
+func (s *RedisServer) processEventsWhileBlocked() {
+	if s.reactor != nil {
+		// The clients are served by the event loop alone in the meantime.
+		s.processingEventsWhileBlocked = true
+		s.reactor.ProcessEventsWhileBlocked()
+		s.handleClientsWithPendingWrites()
+		s.processingEventsWhileBlocked = false
+	}
+}
+
 func (s *RedisServer) SetHandler(handler ReaderHandler) {
 	s.handler = handler
 }
 
-//func (s *Server) populateCommandTable() {
-//	for j := 0; ; j++ {
-//		if
-//	}
-//}
-//
-//// populateCommandStructure recursively populates the command table starting
-//func (s *Server) populateCommandStructure(c RedisCommand) bool {
-//	for _, subCmd := range c.SubCommands() {
+// beforeSleep is called by the event loop before waiting for the next
+// events: the clients queued for the I/O threads are served.
+func (s *RedisServer) beforeSleep() {
+	s.handleClientsWithPendingReads()
+	s.handleClientsWithPendingWrites()
+}
+
+/* serverCron is our timer interrupt, called server.hz times per second.
+ * Here is where we do a number of things that need to be done asynchronously.
+ * For instance:
+ *
+ * - Active expired keys collection (it is also performed in a lazy way on
+ *   lookup).
+ *
+ * It returns the number of milliseconds before the next call. */
+func (s *RedisServer) serverCron() int {
+	freeClientsInAsyncFreeQueue()
+	s.clientsCron()
+	// Unpause the clients once the pause timeout is reached.
+	s.checkClientPauseTimeoutAndReturnIfPaused()
+	// Finish the shutdown once the replicas caught up.
+	s.shutdownCron()
+	s.processUnblockedClients()
+	s.databasesCron()
+	// Go on evicting the keys once performEvictions reached its time limit.
+	if s.evictionInProgress {
+		evictionTimeProc()
+	}
+	// Send the invalidation of the keys expired by the cron.
+	trackingBroadcastInvalidationMessages()
+	if s.runWithPeriod(100) {
+		s.trackInstantaneousMetrics()
+	}
+	// Record the max memory used since the server was started.
+	if used := db.UsedMemory(); used > s.statPeakMemory {
+		s.statPeakMemory = used
+	}
+	s.cronLoops++
+	return 1000 / s.hz
+}
+
+// clientsCron handles the periodic operations on the clients, it closes the
+// clients idle for longer than the timeout and accounts for the memory used
+// by their buffers.
+func (s *RedisServer) clientsCron() {
+	now := time.Now().Unix()
+	iter := s.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		if clientsCronHandleTimeout(node.Value, now) {
+			continue
+		}
+		// The output buffer grows also when the client is not served, for
+		// example with the Pub/Sub messages.
+		updateClientMemUsage(node.Value)
+	}
+}
+
+// clientsCronHandleTimeout closes the client if it is idle for longer than
+// the timeout. The replicas, masters, blocked and Pub/Sub clients are never
+// closed. It returns true if the client was freed.
+func clientsCronHandleTimeout(c *Client, now int64) bool {
+	if server.maxIdleTime != 0 &&
+		c.flags&(ClientSlave|ClientMaster|ClientBlocked|ClientPubSub) == 0 &&
+		now-c.lastInteraction > server.maxIdleTime {
+		log.Logger.Debug("Closing idle client", zap.Uint64("id", c.id))
+		freeClient(c)
+		return true
+	}
+	return false
+}
+
+// databasesCron handles background operations on Redis databases.
+func (s *RedisServer) databasesCron() {
+	// The keys can't expire while the writes are paused.
+	if s.areClientsPaused() || s.isShutdownInitiated() {
+		return
+	}
+
+	// Expire keys by random sampling. Every call starts from the DB next to
+	// the last one tested, so that all the DBs get their share of time.
+	timelimit := time.Duration(1000000*ActiveExpireCycleSlowTimePerc/s.hz/100) * time.Microsecond
+	start := time.Now()
+	for j := 0; j < len(s.db); j++ {
+		elapsed := time.Since(start)
+		if elapsed >= timelimit {
+			break
+		}
+		s.db[s.expireCurrentDb%len(s.db)].ActiveExpireCycle(timelimit - elapsed)
+		s.expireCurrentDb++
+	}
+	latencyAddSampleIfNeeded(LatencyEventExpireCycle, time.Since(start).Milliseconds())
+}
+
+// emptyData removes all the keys from the given DB, or from all the DBs when
+// dbnum is -1. With EmptyDbAsync the keys are freed by the lazyfree worker.
+// It returns the number of keys removed.
+func (s *RedisServer) emptyData(dbnum int, flags EmptyDbFlags) int {
+	startdb, enddb := dbnum, dbnum
+	if dbnum == -1 {
+		startdb, enddb = 0, len(s.db)-1
+	}
+
+	removed := 0
+	for j := startdb; j <= enddb; j++ {
+		// Make sure the WATCHed keys are affected by the FLUSH* commands.
+		// Note that we need to call the function while the keys are still there.
+		touchAllWatchedKeysInDb(s.db[j], nil)
+		if flags&EmptyDbAsync != 0 {
+			removed += s.db[j].EmptyAsync()
+		} else {
+			removed += s.db[j].Empty()
+		}
+	}
+	trackingInvalidateKeysOnFlush()
+	return removed
+}
+
+// dbSwapDatabases swaps two databases at runtime so that all clients will
+// magically see the new database even if already connected. Note that the
+// client structure c->db points to a given DB, so we need to be smarter and
+// swap the underlying referenced structures, otherwise we would need to fix
+// all the references to the Redis DB structure.
 //
-//	}
-//}
+// Returns false if at least one of the DB ids are out of range.
+func (s *RedisServer) dbSwapDatabases(id1, id2 int64) bool {
+	if id1 < 0 || id1 >= int64(len(s.db)) || id2 < 0 || id2 >= int64(len(s.db)) {
+		return false
+	}
+	if id1 == id2 {
+		return true
+	}
+	db1, db2 := s.db[id1], s.db[id2]
+
+	// Swapdb should make transaction fail if there is any
+	// client watching keys that exists in the databases that were swapped.
+	touchAllWatchedKeysInDb(db1, db2)
+	touchAllWatchedKeysInDb(db2, db1)
+
+	// Swap the keyspaces. Note that we don't swap the watched keys, since
+	// we want clients to remain in the same DB they were.
+	db1.SwapWith(db2)
+	return true
+}
+
+// populateCommandTable populates the server command table starting from the
+// hard coded list we have in the commands.go file.
+func (s *RedisServer) populateCommandTable() {
+	for _, c := range redisCommandTable {
+		cmd := s.populateCommandStructure(c, nil)
+		s.commands.Set(cmd.declaredName, cmd)
+		s.originCommands.Set(cmd.declaredName, cmd)
+	}
+}
+
+// populateCommandStructure creates the runtime copy of a command of the table,
+// recursively populating its subcommands.
+func (s *RedisServer) populateCommandStructure(c *BaseCommand, parent *BaseCommand) *BaseCommand {
+	cmd := *c
+	cmd.fullname = cmd.declaredName
+	if parent != nil {
+		cmd.parent = parent
+		cmd.fullname = parent.declaredName + "|" + cmd.declaredName
+	}
+	setImplicitACLCategories(&cmd)
+	populateCommandLegacyRangeSpec(&cmd)
+
+	// Assign the ID used for the ACL command bitmap.
+	cmd.id = s.nextCommandId
+	s.nextCommandId++
+
+	if len(c.subCommands) > 0 {
+		cmd.subCommands = make([]RedisCommand, 0, len(c.subCommands))
+		cmd.subCommandsDict = db.NewHashTable[string, RedisCommand](len(c.subCommands))
+		for _, sub := range c.subCommands {
+			subCmd := s.populateCommandStructure(sub.(*BaseCommand), &cmd)
+			cmd.subCommands = append(cmd.subCommands, subCmd)
+			cmd.subCommandsDict.Set(subCmd.declaredName, subCmd)
+		}
+	}
+	return &cmd
+}
+
+// setImplicitACLCategories sets the ACL categories implied by the command flags.
+func setImplicitACLCategories(c *BaseCommand) {
+	if c.flags&CmdWrite != 0 {
+		c.aclCategories |= ACLCategoryWrite
+	}
+	// Exclude scripting commands from the RO category.
+	if c.flags&CmdReadOnly != 0 && c.aclCategories&ACLCategoryScripting == 0 {
+		c.aclCategories |= ACLCategoryRead
+	}
+	if c.flags&CmdAdmin != 0 {
+		c.aclCategories |= ACLCategoryAdmin | ACLCategoryDangerous
+	}
+	if c.flags&CmdPubSub != 0 {
+		c.aclCategories |= ACLCategoryPubSub
+	}
+	if c.flags&CmdFast != 0 {
+		c.aclCategories |= ACLCategoryFast
+	}
+	if c.flags&CmdBlocking != 0 {
+		c.aclCategories |= ACLCategoryBlocking
+	}
+	// If it's not @fast is @slow in this binary world.
+	if c.aclCategories&ACLCategoryFast == 0 {
+		c.aclCategories |= ACLCategorySlow
+	}
+}
@@ -0,0 +1,358 @@
+package node
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/log"
+)
+
+func TestMain(m *testing.M) {
+	log.InitLogger()
+	newTestServer()
+	os.Exit(m.Run())
+}
+
+// newTestServer creates and initializes a server that is not listening,
+// clients are attached to it with newTestClient.
+func newTestServer() *RedisServer {
+	s := NewServer(0)
+	s.initServer()
+	return s
+}
+
+// newTestClient creates a client of the current server writing its replies
+// to a TestConn.
+func newTestClient() (*Client, *TestConn) {
+	conn := &TestConn{}
+	server.nextClientId++
+	c := NewClient(server.nextClientId, 0, conn, 2, server.db[0])
+	server.linkClient(c)
+	return c, conn
+}
+
+// sendCommand feeds the command to the client as a multi bulk request and
+// returns the protocol written in reply.
+func sendCommand(c *Client, conn *TestConn, args ...string) string {
+	var b strings.Builder
+	b.WriteString("*")
+	b.WriteString(strconv.Itoa(len(args)))
+	b.WriteString("\r\n")
+	for _, arg := range args {
+		b.WriteString("$")
+		b.WriteString(strconv.Itoa(len(arg)))
+		b.WriteString("\r\n")
+		b.WriteString(arg)
+		b.WriteString("\r\n")
+	}
+	conn.Buffer.Reset()
+	c.queryBuf = append(c.queryBuf, b.String()...)
+	c.processInputBuffer()
+	return conn.Buffer.String()
+}
+
+func TestProcessInlineAndMultibulk(t *testing.T) {
+	c, conn := newTestClient()
+
+	c.queryBuf = append(c.queryBuf, "SET inline value\r\n"...)
+	c.processInputBuffer()
+	if got := conn.Buffer.String(); got != "+OK\r\n" {
+		t.Fatalf("inline SET replied %q", got)
+	}
+
+	if got := sendCommand(c, conn, "GET", "inline"); got != "$5\r\nvalue\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+
+	// A partial request is kept in the query buffer until it is complete.
+	conn.Buffer.Reset()
+	c.queryBuf = append(c.queryBuf, "*2\r\n$3\r\nGET\r\n$6\r\ninl"...)
+	c.processInputBuffer()
+	if conn.Buffer.Len() != 0 {
+		t.Fatalf("partial request replied %q", conn.Buffer.String())
+	}
+	c.queryBuf = append(c.queryBuf, "ine\r\n"...)
+	c.processInputBuffer()
+	if got := conn.Buffer.String(); got != "$5\r\nvalue\r\n" {
+		t.Fatalf("GET replied %q", got)
+	}
+}
+
+func TestProcessCommandErrors(t *testing.T) {
+	c, conn := newTestClient()
+
+	if got := sendCommand(c, conn, "NOSUCHCMD", "a"); got != "-ERR unknown command 'NOSUCHCMD', with args beginning with: 'a' \r\n" {
+		t.Fatalf("unknown command replied %q", got)
+	}
+	// The arguments are cut after 128 bytes.
+	long := strings.Repeat("x", 124)
+	want := "-ERR unknown command 'NOSUCHCMD', with args beginning with: '" + long + "' 'y' \r\n"
+	if got := sendCommand(c, conn, "NOSUCHCMD", long, strings.Repeat("y", 200)); got != want {
+		t.Fatalf("unknown command replied %q", got)
+	}
+	if got := sendCommand(c, conn, "GET"); got != "-ERR wrong number of arguments for 'get' command\r\n" {
+		t.Fatalf("wrong arity replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "NOSUCHSUB"); got != "-ERR unknown subcommand 'NOSUCHSUB'. Try CONFIG HELP.\r\n" {
+		t.Fatalf("unknown subcommand replied %q", got)
+	}
+}
+
+func TestConfigSetGet(t *testing.T) {
+	c, conn := newTestClient()
+	defer func() { server.hz = ConfigDefaultHz }()
+
+	if got := sendCommand(c, conn, "CONFIG", "SET", "hz", "20"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "GET", "hz"); got != "*2\r\n$2\r\nhz\r\n$2\r\n20\r\n" {
+		t.Fatalf("CONFIG GET replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "SET", "port", "1234"); !strings.HasPrefix(got, "-ERR CONFIG SET failed") {
+		t.Fatalf("CONFIG SET of an immutable config replied %q", got)
+	}
+	if len(server.db) != ConfigDefaultDbNum || server.db[0].GetID() != 0 {
+		t.Fatalf("unexpected server dbs %v", server.db)
+	}
+}
+
+func TestLoadConfigFromString(t *testing.T) {
+	s := NewServer(0)
+	if err := s.loadConfigFromString([]byte("hz: 50\nnotify-keyspace-events: KEg$\n")); err != nil {
+		t.Fatal(err)
+	}
+	if s.hz != 50 {
+		t.Fatalf("hz is %d", s.hz)
+	}
+	if s.notifyKeyspaceEvents != db.NotifyKeyspace|db.NotifyKeyevent|db.NotifyGeneric|db.NotifyString {
+		t.Fatalf("notify-keyspace-events is %v", s.notifyKeyspaceEvents)
+	}
+	if err := s.loadConfigFromString([]byte("unixsocket: /tmp/redis.sock\nunixsocketperm: 770\n")); err != nil {
+		t.Fatal(err)
+	}
+	if s.unixSocket != "/tmp/redis.sock" || s.unixSocketPerm != 0770 {
+		t.Fatalf("unixsocket is %q, unixsocketperm is %o", s.unixSocket, s.unixSocketPerm)
+	}
+	if err := s.loadConfigFromString([]byte("unixsocketperm: 778\n")); err == nil {
+		t.Fatal("expected an error for an invalid unixsocketperm")
+	}
+	if !s.isDefaultBindAddr() {
+		t.Fatalf("bind is %v", s.bindAddr)
+	}
+	if err := s.loadConfigFromString([]byte("bind: 127.0.0.1 -::1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if s.isDefaultBindAddr() || s.bindAddrCount != 2 || s.bindAddr[1] != "-::1" {
+		t.Fatalf("bind is %v", s.bindAddr)
+	}
+	if err := s.loadConfigFromString([]byte("no-such-config: 1\n")); err == nil {
+		t.Fatal("expected an error for an unknown config")
+	}
+}
+
+func TestProtectedMode(t *testing.T) {
+	defer func() {
+		server.protectedMode = true
+		server.bindAddr = ConfigDefaultBindAddr
+	}()
+	rejected := server.statRejectedConn
+
+	// accept returns the reply sent to the client connecting from ip, and
+	// whether it was accepted.
+	accept := func(ip string, flags ClientFlags) (string, bool) {
+		conn := &TestConn{ip: ip}
+		c := server.createClient(conn)
+		c.flags |= flags
+		ok := server.clientAcceptHandler(c)
+		if ok {
+			freeClient(c)
+		}
+		return conn.Buffer.String(), ok
+	}
+
+	for _, ip := range []string{"127.0.0.1", "::1", ""} {
+		if _, ok := accept(ip, 0); !ok {
+			t.Errorf("the client from %q was rejected", ip)
+		}
+	}
+	if _, ok := accept("10.0.0.1", ClientUnixSocket); !ok {
+		t.Errorf("the unix socket client was rejected")
+	}
+	if got, ok := accept("10.0.0.1", 0); ok || !strings.HasPrefix(got, "-DENIED Redis is running in protected mode") {
+		t.Errorf("the external client was accepted: %q", got)
+	}
+	if server.statRejectedConn != rejected+1 {
+		t.Errorf("%d connections rejected", server.statRejectedConn-rejected)
+	}
+
+	// A password, an explicit bind address or disabling the protected mode
+	// allows the external clients.
+	defaultUser.flags &= ^UserFlagNoPass
+	_, ok := accept("10.0.0.1", 0)
+	defaultUser.flags |= UserFlagNoPass
+	if !ok {
+		t.Errorf("the external client was rejected with a password")
+	}
+	server.bindAddr = []string{"10.0.0.2"}
+	if _, ok := accept("10.0.0.1", 0); !ok {
+		t.Errorf("the external client was rejected with an explicit bind")
+	}
+	server.bindAddr = ConfigDefaultBindAddr
+	server.protectedMode = false
+	if _, ok := accept("10.0.0.1", 0); !ok {
+		t.Errorf("the external client was rejected without the protected mode")
+	}
+}
+
+func TestReplyListChunks(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	// The output the connection doesn't accept is kept in the reply list.
+	conn.full = true
+	big := strings.Repeat("x", ProtoReplyChunkBytes+10)
+	if got := sendCommand(c, conn, "SET", "obuf:k", big); got != "" {
+		t.Fatalf("SET replied %q with a full connection", got)
+	}
+	sendCommand(c, conn, "GET", "obuf:k")
+	if c.replies.Len() != 2 || c.replyBytes != len("+OK\r\n")+len(bulkString(big)) {
+		t.Fatalf("reply list has %d blocks of %d bytes", c.replies.Len(), c.replyBytes)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "INFO"); got != "" || !c.hasPendingReplies() {
+		t.Fatalf("CLIENT INFO replied %q with a full connection", got)
+	}
+
+	// Once writable, the pending replies are sent in order.
+	conn.full = false
+	c.writeToClient(true)
+	got := conn.Buffer.String()
+	if !strings.HasPrefix(got, "+OK\r\n"+bulkString(big)) || !strings.Contains(got, " events=rw ") {
+		t.Fatalf("pending replies are %q", got)
+	}
+	if c.hasPendingReplies() || c.replyBytes != 0 {
+		t.Fatalf("reply list has %d bytes after the write", c.replyBytes)
+	}
+	if got := sendCommand(c, conn, "GET", "obuf:k"); got != bulkString(big) {
+		t.Fatalf("GET replied %q", got)
+	}
+}
+
+func TestOutputBufferLimits(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer func() { server.clientObufLimits = clientBufferLimitsDefaults }()
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CONFIG", "SET", "client-output-buffer-limit", "normal 1mb"}, "-ERR CONFIG SET failed (possibly related to argument 'client-output-buffer-limit') - Wrong number of arguments in buffer limit configuration.\r\n"},
+		{[]string{"CONFIG", "SET", "client-output-buffer-limit", "master 1mb 0 0"}, "-ERR CONFIG SET failed (possibly related to argument 'client-output-buffer-limit') - Invalid client class specified in buffer limit configuration.\r\n"},
+		{[]string{"CONFIG", "SET", "client-output-buffer-limit", "normal x 0 0"}, "-ERR CONFIG SET failed (possibly related to argument 'client-output-buffer-limit') - Error in hard, soft or soft_seconds setting in buffer limit configuration.\r\n"},
+		{[]string{"CONFIG", "SET", "client-output-buffer-limit", "normal 100 0 0 pubsub 1kb 512 10"}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "client-output-buffer-limit"}, "*2\r\n" + bulkString("client-output-buffer-limit") + bulkString("normal 100 0 0 slave 268435456 67108864 60 pubsub 1024 512 10")},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// The client is closed once its pending output reaches the hard limit.
+	sendCommand(c, conn, "SET", "obuf:small", strings.Repeat("x", 50))
+	sendCommand(c, conn, "SET", "obuf:big", strings.Repeat("x", 200))
+	victim, victimConn := newTestClient()
+	victimConn.full = true
+	sendCommand(victim, victimConn, "GET", "obuf:small")
+	if victim.flags&ClientCloseASAP != 0 {
+		t.Fatalf("client closed under the hard limit")
+	}
+	sendCommand(victim, victimConn, "GET", "obuf:small")
+	if victim.flags&ClientCloseASAP == 0 {
+		t.Fatalf("client over the hard limit is not closed")
+	}
+	freeClientsInAsyncFreeQueue()
+	if lookupClientByID(victim.id) != nil {
+		t.Fatalf("client over the hard limit is not freed")
+	}
+
+	// The soft limit must be exceeded for longer than the soft seconds.
+	server.clientObufLimits[ClientTypeNormal] = clientBufferLimitsConfig{softLimitBytes: 100, softLimitSeconds: 10}
+	victim, victimConn = newTestClient()
+	defer freeClient(victim)
+	victimConn.full = true
+	sendCommand(victim, victimConn, "GET", "obuf:big")
+	if victim.flags&ClientCloseASAP != 0 || victim.obufSoftLimitReachedTime == 0 {
+		t.Fatalf("client closed as soon as the soft limit was reached")
+	}
+	victim.obufSoftLimitReachedTime -= 11
+	sendCommand(victim, victimConn, "PING")
+	if victim.flags&ClientCloseASAP == 0 {
+		t.Fatalf("client over the soft limit for too long is not closed")
+	}
+}
+
+func TestQueryBufferLimit(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer func() { server.clientMaxQueryBufLen = 1024 * 1024 * 1024 }()
+
+	if got := sendCommand(c, conn, "CONFIG", "SET", "client-query-buffer-limit", "1k"); !strings.HasPrefix(got, "-ERR CONFIG SET failed") {
+		t.Fatalf("CONFIG SET under the minimum replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CONFIG", "SET", "client-query-buffer-limit", "1mb"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET replied %q", got)
+	}
+	if server.clientMaxQueryBufLen != 1024*1024 {
+		t.Fatalf("client-query-buffer-limit is %d", server.clientMaxQueryBufLen)
+	}
+
+	// The client sending a partial request bigger than the limit is closed.
+	victim, _ := newTestClient()
+	victim.connection = &queryTestConn{data: []byte("*2\r\n$4\r\nECHO\r\n$2000000\r\n" + strings.Repeat("x", 1024*1024))}
+	victim.readQueryFromClient()
+	if lookupClientByID(victim.id) != nil {
+		t.Fatalf("client over the query buffer limit is not closed")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer func() { server.maxIdleTime = 0 }()
+
+	if got := sendCommand(c, conn, "CONFIG", "SET", "timeout", "10"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET replied %q", got)
+	}
+	idle, _ := newTestClient()
+	subscriber, subConn := newTestClient()
+	defer freeClient(subscriber)
+	sendCommand(subscriber, subConn, "SUBSCRIBE", "idle")
+
+	now := time.Now().Unix()
+	idle.lastInteraction = now - 11
+	subscriber.lastInteraction = now - 11
+	server.clientsCron()
+	if lookupClientByID(idle.id) != nil {
+		t.Fatalf("idle client is not closed")
+	}
+	if lookupClientByID(c.id) == nil || lookupClientByID(subscriber.id) == nil {
+		t.Fatalf("active or Pub/Sub client closed")
+	}
+}
+
+// queryTestConn is a TestConn the client reads the given data from.
+type queryTestConn struct {
+	TestConn
+	data []byte
+}
+
+func (q *queryTestConn) Read() ([]byte, error) {
+	data := q.data
+	q.data = nil
+	return data, nil
+}
@@ -0,0 +1,286 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+	"github.com/fzft/go-mock-redis/log"
+	"go.uber.org/zap"
+)
+
+/*-----------------------------------------------------------------------------
+ * SHUTDOWN
+ *
+ * The server is shut down by SHUTDOWN, SIGINT or SIGTERM. Unless NOW is
+ * given the writes are paused and the server waits up to shutdown-timeout
+ * seconds for the replicas to receive their output buffers, then it saves
+ * the data, removes the pid file and the unix socket, and stops the event
+ * loop. SIGUSR1, or a second SIGINT or SIGTERM, exits right away without
+ * saving.
+ *----------------------------------------------------------------------------*/
+
+// ShutdownFlags are the modifiers of SHUTDOWN.
+type ShutdownFlags uint8
+
+const ShutdownNoFlags ShutdownFlags = 0
+
+const (
+	ShutdownSave   ShutdownFlags = 1 << iota // Save even if no save points are configured.
+	ShutdownNoSave                           // Don't save even if save points are configured.
+	ShutdownNow                              // Don't wait for the replicas to catch up.
+	ShutdownForce                            // Ignore the errors writing the data on disk.
+)
+
+// ShutdownCmd implements the SHUTDOWN command.
+type ShutdownCmd struct {
+	c *Client
+}
+
+// NewShutdownCmd returns a new ShutdownCmd.
+func NewShutdownCmd(c *Client) *ShutdownCmd {
+	return &ShutdownCmd{c: c}
+}
+
+// Shutdown implements SHUTDOWN [NOSAVE|SAVE] [NOW] [FORCE] [ABORT]
+// The client is blocked while the server waits for the replicas, it is
+// replied with an error if the shutdown is aborted.
+func (cmd *ShutdownCmd) Shutdown() {
+	c := cmd.c
+	flags := ShutdownNoFlags
+	abort := false
+	for j := 1; j < c.argc; j++ {
+		switch strings.ToLower(c.argv[j].Value.(string)) {
+		case "nosave":
+			flags |= ShutdownNoSave
+		case "save":
+			flags |= ShutdownSave
+		case "now":
+			flags |= ShutdownNow
+		case "force":
+			flags |= ShutdownForce
+		case "abort":
+			abort = true
+		default:
+			c.addReplyErrorObject(SharedSyntaxErr)
+			return
+		}
+	}
+	if (abort && flags != ShutdownNoFlags) || (flags&ShutdownNoSave != 0 && flags&ShutdownSave != 0) {
+		// Illegal combo.
+		c.addReplyErrorObject(SharedSyntaxErr)
+		return
+	}
+
+	if abort {
+		if !server.abortShutdown() {
+			c.AddReplyError("No shutdown in progress.")
+			return
+		}
+		c.AddReply(SharedOk)
+		return
+	}
+
+	if flags&ShutdownNow == 0 && c.flags&ClientDenyBlocking != 0 {
+		c.AddReplyError("SHUTDOWN without NOW or ABORT isn't allowed for DENY BLOCKING client")
+		return
+	}
+
+	if flags&ShutdownNoSave == 0 && isInsideYieldingLongCommand() {
+		// Script timed out. Shutdown allowed only with the NOSAVE flag. See
+		// also processCommand where these errors are returned.
+		if scriptIsEval() {
+			c.addReplyErrorObject(SharedSlowEvalErr)
+		} else {
+			c.addReplyErrorObject(SharedSlowScriptErr)
+		}
+		return
+	}
+
+	c.blockClient(BlockShutdown)
+	server.prepareForShutdown(flags)
+	// The client is still blocked if the server waits for the replicas.
+}
+
+func shutdownCommand(c *Client) error {
+	NewShutdownCmd(c).Shutdown()
+	return nil
+}
+
+// isShutdownInitiated reports whether the server is waiting for the replicas
+// before shutting down.
+func (s *RedisServer) isShutdownInitiated() bool {
+	return s.shutdownMstime != 0
+}
+
+// isReadyToShutdown reports whether the replicas received all their output,
+// the monitors are not waited for. Nothing sets ClientSlave until replication
+// is implemented, so for now the server is always ready.
+func (s *RedisServer) isReadyToShutdown() bool {
+	iter := s.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		c := node.Value
+		if c.flags&ClientSlave != 0 && c.flags&ClientMonitor == 0 && c.hasPendingReplies() {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareForShutdown starts the shutdown. Unless ShutdownNow is given, and if
+// some replicas are lagging, the writes are paused and the shutdown is
+// finished by the cron once they catch up or after shutdown-timeout seconds.
+// Otherwise the server is shut down right away.
+func (s *RedisServer) prepareForShutdown(flags ShutdownFlags) {
+	if s.isShutdownInitiated() {
+		return
+	}
+	log.Logger.Warn("User requested shutdown...")
+
+	s.shutdownFlags = flags
+	if flags&ShutdownNow == 0 && s.shutdownTimeout != 0 && !s.isReadyToShutdown() {
+		s.shutdownMstime = time.Now().UnixMilli() + s.shutdownTimeout*1000
+		log.Logger.Warn("Waiting for replicas before shutting down.")
+		return
+	}
+	s.finishShutdown()
+}
+
+// finishShutdown saves the data, removes the pid file and the unix socket,
+// and stops the event loop. A running script is killed, the data it changed
+// is not saved anyway. If the data can't be saved, and FORCE isn't given, the
+// shutdown is cancelled instead.
+func (s *RedisServer) finishShutdown() {
+	// Never true until replication sets ClientSlave, see isReadyToShutdown.
+	if s.isShutdownInitiated() && time.Now().UnixMilli() >= s.shutdownMstime {
+		iter := s.clients.NewListIterator(db.DIRECTION_HEAD)
+		for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+			c := node.Value
+			if c.flags&ClientSlave != 0 && c.flags&ClientMonitor == 0 && c.hasPendingReplies() {
+				log.Logger.Warn("Lagging replica", zap.String("addr", c.connection.Addr()),
+					zap.Int("pending_bytes", c.replyBytes-c.sentLen))
+			}
+		}
+	}
+
+	// There is no RDB or AOF persistence yet, so SAVE always fails: the
+	// shutdown is cancelled unless FORCE is given.
+	if s.shutdownFlags&ShutdownSave != 0 {
+		if s.shutdownFlags&ShutdownForce == 0 {
+			log.Logger.Warn("Error trying to save the DB, can't exit: no persistence is available.")
+			log.Logger.Warn("Errors trying to shut down the server. Check the logs for more information.")
+			s.cancelShutdown()
+			return
+		}
+		log.Logger.Warn("Error trying to save the DB, exit anyway: no persistence is available.")
+	}
+
+	if s.pidPath != "" {
+		log.Logger.Info("Removing the pid file.")
+		if err := os.Remove(s.pidPath); err != nil && !os.IsNotExist(err) {
+			log.Logger.Warn("Error removing the pid file", zap.String("path", s.pidPath), zap.Error(err))
+		}
+	}
+
+	// Best effort flush of the replicas output buffers.
+	iter := s.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		if c := node.Value; c.flags&ClientSlave != 0 && c.hasPendingReplies() {
+			_, _ = c.writeReplies()
+		}
+	}
+
+	if s.unixSocket != "" {
+		if err := os.Remove(s.unixSocket); err != nil && !os.IsNotExist(err) {
+			log.Logger.Warn("Error removing the unix socket", zap.String("path", s.unixSocket), zap.Error(err))
+		}
+	}
+
+	if scriptIsRunning() {
+		s.scriptRunCtx.flags |= scriptKilled
+	}
+
+	s.shutdownMstime = 0
+	log.Logger.Warn("Redis is now ready to exit, bye bye...")
+	if s.reactor != nil {
+		s.reactor.Stop()
+	}
+}
+
+// cancelShutdown cancels the shutdown waiting for the replicas, the writes
+// are resumed and the clients of SHUTDOWN are replied with an error.
+func (s *RedisServer) cancelShutdown() {
+	s.shutdownFlags = ShutdownNoFlags
+	s.shutdownMstime = 0
+	s.replyToClientsBlockedOnShutdown()
+	// The writes postponed by the shutdown are run again, they are
+	// postponed again if CLIENT PAUSE is still in effect.
+	if !s.areClientsPaused() {
+		s.unpauseClients()
+	}
+}
+
+// abortShutdown implements SHUTDOWN ABORT, it returns false if no shutdown
+// is in progress.
+func (s *RedisServer) abortShutdown() bool {
+	if !s.isShutdownInitiated() {
+		return false
+	}
+	s.cancelShutdown()
+	log.Logger.Warn("Shutdown manually aborted.")
+	return true
+}
+
+// replyToClientsBlockedOnShutdown replies with an error to the clients of
+// SHUTDOWN, and unblocks them.
+func (s *RedisServer) replyToClientsBlockedOnShutdown() {
+	iter := s.clients.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+		c := node.Value
+		if c.flags&ClientBlocked != 0 && c.btype == BlockShutdown {
+			c.AddReplyError("Errors trying to SHUTDOWN. Check logs.")
+			c.unblockClient()
+		}
+	}
+}
+
+// shutdownOnSignal shuts the server down on SIGINT and SIGTERM, as SHUTDOWN
+// without modifiers, or right away without saving on SIGUSR1. A second
+// signal while waiting for the replicas exits right away too.
+func (s *RedisServer) shutdownOnSignal(now bool) {
+	if now || s.isShutdownInitiated() {
+		if now {
+			log.Logger.Warn("Received SIGUSR1, exiting now without saving.")
+		} else {
+			log.Logger.Warn("You insist... exiting now.")
+		}
+		s.shutdownFlags = ShutdownNoSave | ShutdownNow | ShutdownForce
+		s.finishShutdown()
+		return
+	}
+	log.Logger.Warn("Received a shutdown signal, scheduling shutdown...")
+	s.prepareForShutdown(ShutdownNoFlags)
+}
+
+// shutdownCron finishes the shutdown once the replicas caught up, or once
+// shutdown-timeout is reached.
+func (s *RedisServer) shutdownCron() {
+	if !s.isShutdownInitiated() {
+		return
+	}
+	if time.Now().UnixMilli() >= s.shutdownMstime || s.isReadyToShutdown() {
+		s.finishShutdown()
+	}
+}
+
+// createPidFile writes the pid of the server in the pid file, if configured.
+func (s *RedisServer) createPidFile() {
+	if s.pidPath == "" {
+		return
+	}
+	if err := os.WriteFile(s.pidPath, []byte(fmt.Sprintf("%d\n", s.pid)), 0644); err != nil {
+		log.Logger.Warn("Failed to write PID file", zap.String("path", s.pidPath), zap.Error(err))
+	}
+}
@@ -0,0 +1,178 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// startShutdownTest sets a test reactor, and a pid file and a unix socket
+// file in a temporary directory, restored once the test is done.
+func startShutdownTest(t *testing.T) *testReactor {
+	t.Helper()
+	dir := t.TempDir()
+	r := &testReactor{}
+	server.reactor = r
+	server.pidPath = filepath.Join(dir, "redis.pid")
+	server.unixSocket = filepath.Join(dir, "redis.sock")
+	server.pid = os.Getpid()
+	server.createPidFile()
+	if err := os.WriteFile(server.unixSocket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.reactor = nil
+		server.pidPath = ""
+		server.unixSocket = ""
+		server.shutdownMstime = 0
+		server.shutdownFlags = ShutdownNoFlags
+	})
+	return r
+}
+
+// assertShutdown checks that the server was shut down.
+func assertShutdown(t *testing.T, r *testReactor) {
+	t.Helper()
+	if !r.stopped {
+		t.Fatalf("the event loop is not stopped")
+	}
+	for _, path := range []string{server.pidPath, server.unixSocket} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s is not removed", filepath.Base(path))
+		}
+	}
+}
+
+func TestShutdownCommand(t *testing.T) {
+	r := startShutdownTest(t)
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	if data, err := os.ReadFile(server.pidPath); err != nil || string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Fatalf("the pid file is %q: %v", data, err)
+	}
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SHUTDOWN", "SAVE", "NOSAVE"}, "-ERR syntax error\r\n"},
+		{[]string{"SHUTDOWN", "ABORT", "NOW"}, "-ERR syntax error\r\n"},
+		{[]string{"SHUTDOWN", "LATER"}, "-ERR syntax error\r\n"},
+		{[]string{"SHUTDOWN", "ABORT"}, "-ERR No shutdown in progress.\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if r.stopped {
+		t.Fatalf("the event loop is stopped")
+	}
+
+	// There is no persistence, SAVE fails and cancels the shutdown.
+	if got := sendCommand(c, conn, "SHUTDOWN", "SAVE"); got != "-ERR Errors trying to SHUTDOWN. Check logs.\r\n" {
+		t.Fatalf("SHUTDOWN SAVE replied %q", got)
+	}
+	if r.stopped || c.flags&ClientBlocked != 0 {
+		t.Fatalf("SHUTDOWN SAVE is not cancelled")
+	}
+
+	// Without replicas the server is shut down right away.
+	if got := sendCommand(c, conn, "SHUTDOWN", "NOSAVE"); got != "" {
+		t.Fatalf("SHUTDOWN replied %q", got)
+	}
+	assertShutdown(t, r)
+
+	// FORCE ignores the save error.
+	r = startShutdownTest(t)
+	c, conn = newTestClient()
+	defer freeClient(c)
+	if got := sendCommand(c, conn, "SHUTDOWN", "SAVE", "FORCE"); got != "" {
+		t.Fatalf("SHUTDOWN SAVE FORCE replied %q", got)
+	}
+	assertShutdown(t, r)
+}
+
+func TestShutdownWaitsForReplicas(t *testing.T) {
+	r := startShutdownTest(t)
+	c, conn := newTestClient()
+	defer freeClient(c)
+	writer, writerConn := newTestClient()
+	defer freeClient(writer)
+	replica, replicaConn := newTestClient()
+	defer freeClient(replica)
+	replica.flags |= ClientSlave
+	replicaConn.full = true
+	replica._addReplyProtoToList([]byte("*1\r\n$4\r\nPING\r\n"))
+
+	// The shutdown waits for the replica, the writes are paused meanwhile.
+	if got := sendCommand(c, conn, "SHUTDOWN"); got != "" {
+		t.Fatalf("SHUTDOWN replied %q", got)
+	}
+	if r.stopped || c.flags&ClientBlocked == 0 {
+		t.Fatalf("the shutdown doesn't wait for the replica")
+	}
+	if got := infoSections(t, writer, writerConn, "server")["Server"]["shutdown_in_milliseconds"]; got == "0" {
+		t.Fatalf("shutdown_in_milliseconds is %s", got)
+	}
+	if got := sendCommand(writer, writerConn, "SET", "shutdown:k", "v"); got != "" {
+		t.Fatalf("SET replied %q while shutting down", got)
+	}
+
+	// Aborted, the client of SHUTDOWN gets an error and the writes resume.
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+	conn.Buffer.Reset()
+	if got := sendCommand(other, otherConn, "SHUTDOWN", "ABORT"); got != "+OK\r\n" {
+		t.Fatalf("SHUTDOWN ABORT replied %q", got)
+	}
+	if got := conn.Buffer.String(); got != "-ERR Errors trying to SHUTDOWN. Check logs.\r\n" {
+		t.Fatalf("the aborted SHUTDOWN replied %q", got)
+	}
+	writerConn.Buffer.Reset()
+	server.processUnblockedClients()
+	if got := writerConn.Buffer.String(); got != "+OK\r\n" {
+		t.Fatalf("postponed SET replied %q", got)
+	}
+
+	// Finished by the cron once the replica caught up.
+	sendCommand(c, conn, "SHUTDOWN")
+	server.shutdownCron()
+	if r.stopped {
+		t.Fatalf("the shutdown doesn't wait for the replica")
+	}
+	replicaConn.full = false
+	replica.writeToClient(false)
+	server.shutdownCron()
+	assertShutdown(t, r)
+	if got := replicaConn.Buffer.String(); got != "*1\r\n$4\r\nPING\r\n" {
+		t.Fatalf("the replica got %q", got)
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	r := startShutdownTest(t)
+	replica, replicaConn := newTestClient()
+	defer freeClient(replica)
+	replica.flags |= ClientSlave
+	replicaConn.full = true
+	replica._addReplyProtoToList([]byte("*1\r\n$4\r\nPING\r\n"))
+
+	// SIGTERM waits for the replica, a second one exits right away.
+	server.shutdownOnSignal(false)
+	if r.stopped || !server.isShutdownInitiated() {
+		t.Fatalf("the shutdown doesn't wait for the replica")
+	}
+	server.shutdownOnSignal(false)
+	assertShutdown(t, r)
+
+	// SIGUSR1 doesn't wait.
+	r = startShutdownTest(t)
+	server.shutdownOnSignal(true)
+	assertShutdown(t, r)
+	if server.shutdownFlags&ShutdownNoSave == 0 {
+		t.Fatalf("SIGUSR1 saves")
+	}
+}
@@ -0,0 +1,201 @@
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* Slowlog implements a system that is able to remember the latest N
+ * queries that took more than M microseconds to execute.
+ *
+ * The execution time to reach to be logged in the slow log is set using the
+ * 'slowlog-log-slower-than' config directive, that is also readable and
+ * writable using the CONFIG SET/GET command.
+ *
+ * The slow queries log is actually not "logged" in the Redis log file but
+ * is accessible thanks to the SLOWLOG command. */
+
+const (
+	SlowlogEntryMaxArgc   = 32  // Max number of arguments logged.
+	SlowlogEntryMaxString = 128 // Max length of a logged argument.
+)
+
+// slowlogEntry is an entry of the slow log.
+type slowlogEntry struct {
+	argv     []string
+	id       int64  // Unique entry identifier.
+	duration int64  // Time spent by the query, in microseconds.
+	time     int64  // Unix time at which the query was executed.
+	cname    string // Client name.
+	peerid   string // Client network address.
+}
+
+// slowlogCreateEntry creates a new slow log entry for the command. The
+// arguments are truncated to SlowlogEntryMaxArgc, and their length to
+// SlowlogEntryMaxString, the last argument or bytes logged telling how many
+// were omitted.
+func slowlogCreateEntry(c *Client, argv []*db.RedisObj, duration int64) *slowlogEntry {
+	slargc := len(argv)
+	if slargc > SlowlogEntryMaxArgc {
+		slargc = SlowlogEntryMaxArgc
+	}
+	se := &slowlogEntry{argv: make([]string, slargc)}
+	for j := 0; j < slargc; j++ {
+		// Logging too many arguments is a useless memory waste, so we stop
+		// at SlowlogEntryMaxArgc, but use the last argument to specify how
+		// many remaining arguments there were in the original command.
+		if slargc != len(argv) && j == slargc-1 {
+			se.argv[j] = fmt.Sprintf("... (%d more arguments)", len(argv)-slargc+1)
+			continue
+		}
+		arg := argv[j].Value.(string)
+		// Trim too long strings as well...
+		if len(arg) > SlowlogEntryMaxString {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:SlowlogEntryMaxString], len(arg)-SlowlogEntryMaxString)
+		}
+		se.argv[j] = arg
+	}
+	se.time = time.Now().Unix()
+	se.duration = duration
+	se.id = server.slowlogEntryId
+	server.slowlogEntryId++
+	if c.connection != nil {
+		se.peerid = c.connection.Addr()
+	}
+	se.cname = c.name
+	return se
+}
+
+// slowlogPushEntryIfNeeded pushes a new entry into the slow log if the
+// command took longer than slowlog-log-slower-than microseconds. The old
+// entries are removed to keep at most slowlog-max-len entries.
+func slowlogPushEntryIfNeeded(c *Client, argv []*db.RedisObj, duration int64) {
+	if server.slowlogLogSlowerThan < 0 || server.slowlogMaxLen == 0 {
+		return // Slowlog disabled
+	}
+	if duration >= server.slowlogLogSlowerThan {
+		server.slowlog.AddNodeHead(slowlogCreateEntry(c, argv, duration))
+	}
+
+	// Remove old entries if needed.
+	for int64(server.slowlog.Len()) > server.slowlogMaxLen {
+		_ = server.slowlog.RemoveNode(server.slowlog.Tail)
+	}
+}
+
+// slowlogPushCurrentCommand logs the command the client just executed if
+// it is slow enough. The commands flagged CmdSkipSlowLog are never logged,
+// and the redacted arguments are logged in place of the real ones.
+func slowlogPushCurrentCommand(c *Client, cmd RedisCommand, duration int64) {
+	// Some commands may contain sensitive data that should not be
+	// available in the slowlog.
+	if cmd.Flags()&CmdSkipSlowLog != 0 {
+		return
+	}
+	slowlogPushEntryIfNeeded(c, c.commandVector(), duration)
+}
+
+// slowlogReset removes all the entries from the slow log.
+func slowlogReset() {
+	server.slowlog.Empty()
+}
+
+// SlowlogCmd implements the SLOWLOG command.
+type SlowlogCmd struct {
+	c *Client
+}
+
+// NewSlowlogCmd returns a new SlowlogCmd.
+func NewSlowlogCmd(c *Client) *SlowlogCmd {
+	return &SlowlogCmd{c: c}
+}
+
+// Get implements SLOWLOG GET [count]
+func (cmd *SlowlogCmd) Get() {
+	c := cmd.c
+	count := int64(10)
+	if c.argc == 3 {
+		// Consume count arg.
+		n, err := strconv.ParseInt(c.argv[2].Value.(string), 10, 64)
+		if err != nil || n < -1 {
+			c.AddReplyError("count should be greater than or equal to -1")
+			return
+		}
+		count = n
+		if count == -1 {
+			count = int64(server.slowlog.Len())
+		}
+	} else if c.argc > 3 {
+		c.addReplyErrorArity()
+		return
+	}
+
+	if count > int64(server.slowlog.Len()) {
+		count = int64(server.slowlog.Len())
+	}
+	c.addReplyArrayLen(int(count))
+	iter := server.slowlog.NewListIterator(db.DIRECTION_HEAD)
+	for node := iter.NextNode(); node != nil && count > 0; node = iter.NextNode() {
+		se := node.Value
+		c.addReplyArrayLen(6)
+		c.addReplyLongLong(se.id)
+		c.addReplyLongLong(se.time)
+		c.addReplyLongLong(se.duration)
+		c.addReplyArrayLen(len(se.argv))
+		for _, arg := range se.argv {
+			c.addReplyBulkCString(arg)
+		}
+		c.addReplyBulkCString(se.peerid)
+		c.addReplyBulkCString(se.cname)
+		count--
+	}
+}
+
+// Len implements SLOWLOG LEN
+func (cmd *SlowlogCmd) Len() {
+	cmd.c.addReplyLongLong(int64(server.slowlog.Len()))
+}
+
+// Reset implements SLOWLOG RESET
+func (cmd *SlowlogCmd) Reset() {
+	slowlogReset()
+	cmd.c.AddReply(SharedOk)
+}
+
+// Help implements SLOWLOG HELP
+func (cmd *SlowlogCmd) Help() {
+	cmd.c.addReplyHelp([]string{
+		"GET [<count>]",
+		"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+		"    Entries are made of:",
+		"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+		"    client name",
+		"LEN",
+		"    Return the length of the slowlog.",
+		"RESET",
+		"    Reset the slowlog.",
+	})
+}
+
+func slowlogGetCommand(c *Client) error {
+	NewSlowlogCmd(c).Get()
+	return nil
+}
+
+func slowlogLenCommand(c *Client) error {
+	NewSlowlogCmd(c).Len()
+	return nil
+}
+
+func slowlogResetCommand(c *Client) error {
+	NewSlowlogCmd(c).Reset()
+	return nil
+}
+
+func slowlogHelpCommand(c *Client) error {
+	NewSlowlogCmd(c).Help()
+	return nil
+}
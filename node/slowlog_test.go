@@ -0,0 +1,121 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withSlowlog logs every command in the slow log, and restores the default
+// configuration once the test is done.
+func withSlowlog(t *testing.T, maxLen int64) {
+	oldSlowerThan, oldMaxLen := server.slowlogLogSlowerThan, server.slowlogMaxLen
+	server.slowlogLogSlowerThan = 0
+	server.slowlogMaxLen = maxLen
+	slowlogReset()
+	t.Cleanup(func() {
+		server.slowlogLogSlowerThan, server.slowlogMaxLen = oldSlowerThan, oldMaxLen
+		slowlogReset()
+	})
+}
+
+func TestSlowlogEntries(t *testing.T) {
+	withSlowlog(t, 128)
+	c, conn := newTestClient()
+	defer freeClient(c)
+	conn.addr = "10.0.0.1:6000"
+	sendCommand(c, conn, "CLIENT", "SETNAME", "slow")
+
+	sendCommand(c, conn, "SET", "slowlog:k", "v")
+	se := server.slowlog.Head.Value
+	if strings.Join(se.argv, " ") != "SET slowlog:k v" || se.peerid != "10.0.0.1:6000" || se.cname != "slow" {
+		t.Fatalf("unexpected entry %+v", se)
+	}
+	if got := sendCommand(c, conn, "SLOWLOG", "LEN"); got != ":2\r\n" {
+		t.Fatalf("SLOWLOG LEN replied %q", got)
+	}
+
+	want := "*1\r\n*6\r\n:" + strconv.FormatInt(se.id+1, 10) + "\r\n"
+	got := sendCommand(c, conn, "SLOWLOG", "GET", "1")
+	if !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "*2\r\n"+bulkString("SLOWLOG")+bulkString("LEN")+bulkString("10.0.0.1:6000")+bulkString("slow")) {
+		t.Fatalf("SLOWLOG GET 1 replied %q", got)
+	}
+	if got := sendCommand(c, conn, "SLOWLOG", "GET", "-2"); got != "-ERR count should be greater than or equal to -1\r\n" {
+		t.Fatalf("SLOWLOG GET -2 replied %q", got)
+	}
+
+	if got := sendCommand(c, conn, "SLOWLOG", "RESET"); got != "+OK\r\n" {
+		t.Fatalf("SLOWLOG RESET replied %q", got)
+	}
+	// The reset itself is slow enough to be logged.
+	if server.slowlog.Len() != 1 {
+		t.Fatalf("slow log has %d entries after a reset", server.slowlog.Len())
+	}
+}
+
+func TestSlowlogTruncation(t *testing.T) {
+	withSlowlog(t, 128)
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	args := []string{"CLIENT", "LIST", "ID"}
+	for j := 0; j < 37; j++ {
+		args = append(args, strconv.Itoa(j+1))
+	}
+	sendCommand(c, conn, args...)
+	se := server.slowlog.Head.Value
+	if len(se.argv) != SlowlogEntryMaxArgc || se.argv[SlowlogEntryMaxArgc-1] != "... (9 more arguments)" {
+		t.Fatalf("unexpected arguments %q", se.argv)
+	}
+
+	sendCommand(c, conn, "SET", "slowlog:k", strings.Repeat("x", 200))
+	se = server.slowlog.Head.Value
+	if se.argv[2] != strings.Repeat("x", SlowlogEntryMaxString)+"... (72 more bytes)" {
+		t.Fatalf("unexpected argument %q", se.argv[2])
+	}
+}
+
+func TestSlowlogRedactionAndSkip(t *testing.T) {
+	withSlowlog(t, 128)
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	sendCommand(c, conn, "AUTH", "default", "secret")
+	if got := strings.Join(server.slowlog.Head.Value.argv, " "); got != "AUTH (redacted) (redacted)" {
+		t.Fatalf("AUTH logged as %q", got)
+	}
+	sendCommand(c, conn, "HELLO", "2", "AUTH", "default", "secret", "SETNAME", "x")
+	if got := strings.Join(server.slowlog.Head.Value.argv, " "); got != "HELLO 2 AUTH (redacted) (redacted) SETNAME x" {
+		t.Fatalf("HELLO logged as %q", got)
+	}
+
+	// EXEC is not logged, the commands of the transaction are.
+	sendCommand(c, conn, "MULTI")
+	sendCommand(c, conn, "SET", "slowlog:k", "v")
+	slowlogReset()
+	sendCommand(c, conn, "EXEC")
+	if server.slowlog.Len() != 1 || server.slowlog.Head.Value.argv[0] != "SET" {
+		t.Fatalf("EXEC logged %d entries", server.slowlog.Len())
+	}
+}
+
+func TestSlowlogMaxLen(t *testing.T) {
+	withSlowlog(t, 2)
+	c, conn := newTestClient()
+	defer freeClient(c)
+
+	for j := 0; j < 5; j++ {
+		sendCommand(c, conn, "GET", "slowlog:k")
+	}
+	if server.slowlog.Len() != 2 {
+		t.Fatalf("slow log has %d entries", server.slowlog.Len())
+	}
+
+	// Disabled with a negative threshold.
+	server.slowlogLogSlowerThan = -1
+	slowlogReset()
+	sendCommand(c, conn, "GET", "slowlog:k")
+	if server.slowlog.Len() != 0 {
+		t.Fatalf("disabled slow log has %d entries", server.slowlog.Len())
+	}
+}
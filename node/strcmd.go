@@ -3,6 +3,7 @@ package node
 import (
 	"github.com/fzft/go-mock-redis/db"
 	"strings"
+	"time"
 )
 
 const (
@@ -50,22 +51,22 @@ func (cmd *StrCmd) Set() {
 	if !ok {
 		return
 	}
-	cmd.setGenericCommand(retFlags, cmd.c.argv[1].Value.(string), cmd.c.argv[2], expire, uint)
+	cmd.setGenericCommand(retFlags, cmd.c.argv[1].Value.(string), cmd.c.argv[2], expire, uint, nil, nil)
 }
 
 // SetNx implements the SETNX command.
 func (cmd *StrCmd) SetNx() {
-	cmd.setGenericCommand(ObjSetNX, cmd.c.argv[1].Value.(string), cmd.c.argv[2], nil, 0)
+	cmd.setGenericCommand(ObjSetNX, cmd.c.argv[1].Value.(string), cmd.c.argv[2], nil, 0, SharedCone, SharedZCone)
 }
 
 // SetEx implements the SETEX command.
 func (cmd *StrCmd) SetEx() {
-	cmd.setGenericCommand(ObjSetEX, cmd.c.argv[1].Value.(string), cmd.c.argv[3], cmd.c.argv[2], UintSeconds)
+	cmd.setGenericCommand(ObjSetEX, cmd.c.argv[1].Value.(string), cmd.c.argv[3], cmd.c.argv[2], UintSeconds, nil, nil)
 }
 
 // PSetEx implements the PSETEX command.
 func (cmd *StrCmd) PSetEx() {
-	cmd.setGenericCommand(ObjSetPX, cmd.c.argv[1].Value.(string), cmd.c.argv[3], cmd.c.argv[2], UintMilliseconds)
+	cmd.setGenericCommand(ObjSetPX, cmd.c.argv[1].Value.(string), cmd.c.argv[3], cmd.c.argv[2], UintMilliseconds, nil, nil)
 }
 
 // Get implements the GET command.
@@ -76,7 +77,7 @@ func (cmd *StrCmd) Get() {
 func (cmd *StrCmd) getGenericCommand() bool {
 	o, exist := cmd.db.LookupKeyRead(cmd.c.argv[1].Value.(string))
 	if !exist {
-		cmd.c.AddReply(SharedNull3)
+		cmd.c.addReplyNull()
 		return false
 	}
 	cmd.c.AddReplyBulk(o)
@@ -92,13 +93,13 @@ func (cmd *StrCmd) getGenericCommand() bool {
  * 'expire' represents an expire to set in form of a Redis object as passed
  * by the user. It is interpreted according to the specified 'unit'.
  *
- * 'ok_reply' and 'abort_reply' is what the function will reply to the client
+ * 'okReply' and 'abortReply' is what the function will reply to the client
  * if the operation is performed, or when it is not because of NX or
  * XX flags.
  *
- * If ok_reply is NULL "+OK" is used.
- * If abort_reply is NULL, "$-1" is used. */
-func (cmd *StrCmd) setGenericCommand(flags StrSetType, key string, val *db.RedisObj, expire *db.RedisObj, uint int) {
+ * If okReply is nil "+OK" is used.
+ * If abortReply is nil, "$-1" is used. */
+func (cmd *StrCmd) setGenericCommand(flags StrSetType, key string, val *db.RedisObj, expire *db.RedisObj, uint int, okReply, abortReply *db.RedisObj) {
 
 	var (
 		milliseconds uint64
@@ -113,11 +114,20 @@ func (cmd *StrCmd) setGenericCommand(flags StrSetType, key string, val *db.Redis
 		}
 	}
 
+	// The old value is replied before the key is changed.
+	if flags&ObjSetGet != 0 {
+		cmd.getGenericCommand()
+	}
+
 	_, exist := cmd.db.LookupKeyWrite(key)
 
 	if (flags&ObjSetXX != 0 && !exist) || (flags&ObjSetNX != 0 && exist) {
 		if !(flags&ObjSetGet != 0) {
-			cmd.c.AddReply(SharedNull3)
+			if abortReply != nil {
+				cmd.c.AddReply(abortReply)
+			} else {
+				cmd.c.addReplyNull()
+			}
 		}
 		return
 	}
@@ -134,15 +144,20 @@ func (cmd *StrCmd) setGenericCommand(flags StrSetType, key string, val *db.Redis
 	}
 
 	cmd.db.SetKey(key, val, setkeyFlags)
-	// TODO: notifyKeyspaceEvent(NOTIFY_STRING, "set", key, cmd.db.GetID())
+	server.dirty++
+	notifyKeyspaceEvent(db.NotifyString, "set", key, cmd.db.GetID())
 
 	if expire != nil {
 		cmd.db.SetExpire(key, milliseconds)
-		// TODO: notifyKeyspaceEvent(NOTIFY_GENERIC, "expire", key, cmd.db.GetID())
+		notifyKeyspaceEvent(db.NotifyGeneric, "expire", key, cmd.db.GetID())
 	}
 
 	if flags&ObjSetGet == 0 {
-		cmd.c.AddReply(SharedOk)
+		if okReply != nil {
+			cmd.c.AddReply(okReply)
+		} else {
+			cmd.c.AddReply(SharedOk)
+		}
 	}
 }
 
@@ -264,14 +279,15 @@ func (cmd *StrCmd) parseExtendedStringArgumentsOrReply(flags StrSetType, command
 	return
 }
 
-// getExpireMillisecondsOrReply extracts the expire time in milliseconds from the expire obj.
+// getExpireMillisecondsOrReply extracts the expire time in milliseconds from the expire obj,
+// relative expires (EX, PX, SETEX, PSETEX) are turned into an absolute unix time.
 func (cmd *StrCmd) getExpireMillisecondsOrReply(expire *db.RedisObj, flags StrSetType, uint int) (uint64, bool) {
-	ret := getLongLongFromObject(expire)
-	if ret == 0 {
-		cmd.c.AddReplyError("invalid expire time in SETEX")
+	ret, ok := getLongLongFromObject(expire)
+	if !ok {
+		cmd.c.AddReplyError("value is not an integer or out of range")
 		return 0, false
 	}
-	if (uint == UintSeconds && ret > 9223372036) || (uint == UintMilliseconds && ret > 9223372036854775) {
+	if ret <= 0 || (uint == UintSeconds && ret > 9223372036) || (uint == UintMilliseconds && ret > 9223372036854775) {
 		cmd.c.AddReplyErrorExpireTime()
 		return 0, false
 	}
@@ -280,5 +296,34 @@ func (cmd *StrCmd) getExpireMillisecondsOrReply(expire *db.RedisObj, flags StrSe
 		ret *= 1000
 	}
 
-	return ret, true
+	if flags&(ObjPXAT|ObjEXAT) == 0 {
+		ret += time.Now().UnixMilli()
+	}
+
+	return uint64(ret), true
+}
+
+func getCommand(c *Client) error {
+	NewStrCmd(c, c.db).Get()
+	return nil
+}
+
+func setCommand(c *Client) error {
+	NewStrCmd(c, c.db).Set()
+	return nil
+}
+
+func setnxCommand(c *Client) error {
+	NewStrCmd(c, c.db).SetNx()
+	return nil
+}
+
+func setexCommand(c *Client) error {
+	NewStrCmd(c, c.db).SetEx()
+	return nil
+}
+
+func psetexCommand(c *Client) error {
+	NewStrCmd(c, c.db).PSetEx()
+	return nil
 }
@@ -9,6 +9,9 @@ import (
 
 type TestConn struct {
 	Buffer bytes.Buffer // buffer to capture output
+	ip     string       // ip of the peer
+	addr   string       // address of the peer
+	full   bool         // the socket can't accept more output
 }
 
 func (t *TestConn) Read() ([]byte, error) {
@@ -16,14 +19,23 @@ func (t *TestConn) Read() ([]byte, error) {
 	return nil, nil
 }
 
-func (t *TestConn) Write(b []byte) error {
-	_, err := t.Buffer.Write(b) // Capture output to buffer
-	// For testing, you might want to capture this output and validate it.
-	return err
+func (t *TestConn) Write(b []byte) (int, error) {
+	if t.full {
+		return 0, nil
+	}
+	return t.Buffer.Write(b) // Capture output to buffer
 }
 
 func (t *TestConn) Ip() string {
-	return ""
+	return t.ip
+}
+
+func (t *TestConn) Addr() string {
+	return t.addr
+}
+
+func (t *TestConn) LocalAddr() string {
+	return "127.0.0.1:6379"
 }
 
 func (t *TestConn) Close() error {
@@ -55,7 +67,10 @@ func TestSetAndGetCommand(t *testing.T) {
 	assert.Equal(t, true, exist)
 
 	// Check if key-value pair is set in db
-	assert.Equal(t, &db.RedisObj{Value: "myvalue", LRU: 100}, myValue)
+	assert.Equal(t, db.StringType, myValue.Type)
+	assert.Equal(t, "myvalue", myValue.Value)
+	// The access time is the current LRU clock.
+	assert.InDelta(t, db.LRUClock(), myValue.LRU, 1)
 
 	// Test GET command
 	cmd.c.argc = 2
@@ -67,3 +82,15 @@ func TestSetAndGetCommand(t *testing.T) {
 	cmd.Get()
 
 }
+
+func TestSetNxCommand(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer server.emptyData(-1, EmptyDbNoFlags)
+
+	// SETNX replies with an integer, unlike SET NX.
+	assert.Equal(t, ":1\r\n", sendCommand(c, conn, "SETNX", "setnx:k", "v1"))
+	assert.Equal(t, ":0\r\n", sendCommand(c, conn, "SETNX", "setnx:k", "v2"))
+	assert.Equal(t, "$2\r\nv1\r\n", sendCommand(c, conn, "GET", "setnx:k"))
+	assert.Equal(t, "$-1\r\n", sendCommand(c, conn, "SET", "setnx:k", "v3", "NX"))
+}
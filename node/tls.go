@@ -0,0 +1,165 @@
+package node
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*-----------------------------------------------------------------------------
+ * TLS configuration
+ *
+ * The clients connecting to tls-port speak TLS, the certificate of the server
+ * is loaded from tls-cert-file and tls-key-file. The clients certificates are
+ * verified against the CA certificates of tls-ca-cert-file and
+ * tls-ca-cert-dir, as required by tls-auth-clients.
+ *----------------------------------------------------------------------------*/
+
+// Values of tls-auth-clients
+const (
+	TLSClientAuthNo       = iota // Don't request a client certificate
+	TLSClientAuthYes             // Require a valid client certificate
+	TLSClientAuthOptional        // Verify the client certificate, if any
+)
+
+var tlsAuthClientsEnum = []configEnum{
+	{"no", TLSClientAuthNo},
+	{"yes", TLSClientAuthYes},
+	{"optional", TLSClientAuthOptional},
+}
+
+// tlsProtocols maps the tls-protocols names to the TLS versions.
+var tlsProtocols = []struct {
+	name    string
+	version uint16
+}{
+	{"TLSv1", tls.VersionTLS10},
+	{"TLSv1.1", tls.VersionTLS11},
+	{"TLSv1.2", tls.VersionTLS12},
+	{"TLSv1.3", tls.VersionTLS13},
+}
+
+// parseTLSProtocols returns the min and max TLS versions enabled by the
+// tls-protocols config, a space separated list of protocols. An empty list
+// enables TLSv1.2 and TLSv1.3.
+func parseTLSProtocols(protocols string) (minVersion, maxVersion uint16, err error) {
+	names := strings.Fields(protocols)
+	if len(names) == 0 {
+		return tls.VersionTLS12, tls.VersionTLS13, nil
+	}
+	for _, name := range names {
+		found := false
+		for _, p := range tlsProtocols {
+			if strings.EqualFold(name, p.name) {
+				if minVersion == 0 || p.version < minVersion {
+					minVersion = p.version
+				}
+				if p.version > maxVersion {
+					maxVersion = p.version
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, 0, fmt.Errorf("Failed to enable unknown TLS protocol '%s'", name)
+		}
+	}
+	return minVersion, maxVersion, nil
+}
+
+// parseTLSCiphers returns the TLSv1.2 cipher suites of the tls-ciphers config,
+// a colon separated list of IANA names, like
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. An empty list keeps the default
+// suites. The TLSv1.3 suites are not configurable.
+func parseTLSCiphers(ciphers string) ([]uint16, error) {
+	if ciphers == "" {
+		return nil, nil
+	}
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	var ids []uint16
+	for _, name := range strings.Split(ciphers, ":") {
+		found := false
+		for _, suite := range suites {
+			if suite.Name == name {
+				ids = append(ids, suite.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Failed to configure ciphers: unknown cipher suite '%s'", name)
+		}
+	}
+	return ids, nil
+}
+
+// loadCACerts returns the pool of the CA certificates of the file and of the
+// files in the directory.
+func loadCACerts(caCertFile, caCertDir string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	files := make([]string, 0, 1)
+	if caCertFile != "" {
+		files = append(files, caCertFile)
+	}
+	if caCertDir != "" {
+		entries, err := os.ReadDir(caCertDir)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to configure CA certificate(s) directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(caCertDir, entry.Name()))
+			}
+		}
+	}
+	for _, file := range files {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to configure CA certificate(s) file/directory: %w", err)
+		}
+		// The directory may hold other files than the certificates.
+		if !pool.AppendCertsFromPEM(pem) && file == caCertFile {
+			return nil, fmt.Errorf("Failed to configure CA certificate(s) file/directory: no certificate found in '%s'", file)
+		}
+	}
+	return pool, nil
+}
+
+// tlsConfigure builds the TLS configuration of the server connections from
+// the tls-* configs.
+func (s *RedisServer) tlsConfigure() (*tls.Config, error) {
+	if s.tlsCertFile == "" || s.tlsKeyFile == "" {
+		return nil, errors.New("No tls-cert-file or tls-key-file configured")
+	}
+	cert, err := tls.LoadX509KeyPair(s.tlsCertFile, s.tlsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load certificate: %s: %w", s.tlsCertFile, err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if config.MinVersion, config.MaxVersion, err = parseTLSProtocols(s.tlsProtocols); err != nil {
+		return nil, err
+	}
+	if config.CipherSuites, err = parseTLSCiphers(s.tlsCiphers); err != nil {
+		return nil, err
+	}
+
+	if s.tlsAuthClients != TLSClientAuthNo {
+		if s.tlsCaCertFile == "" && s.tlsCaCertDir == "" {
+			return nil, errors.New("Either tls-ca-cert-file or tls-ca-cert-dir must be specified when tls-auth-clients is enabled")
+		}
+		if config.ClientCAs, err = loadCACerts(s.tlsCaCertFile, s.tlsCaCertDir); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if s.tlsAuthClients == TLSClientAuthOptional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,278 @@
+//go:build linux
+// +build linux
+
+package node
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCerts are the files of a CA, and of the server and client certificates
+// it signed.
+type testCerts struct {
+	caCert, serverCert, serverKey, clientCert, clientKey string
+}
+
+// genTestCerts generates the certificates in the directory.
+func genTestCerts(t *testing.T, dir string) testCerts {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDer)
+
+	certs := testCerts{caCert: filepath.Join(dir, "ca.crt")}
+	writePEM(t, certs.caCert, "CERTIFICATE", caDer)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+		writePEM(t, certFile, "CERTIFICATE", der)
+		writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+		return certFile, keyFile
+	}
+	certs.serverCert, certs.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	certs.clientCert, certs.clientKey = issue("client", 3, x509.ExtKeyUsageClientAuth)
+	return certs
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// echoHandler writes back what it reads, keeping the output the connection
+// does not accept until it is writable.
+type echoHandler struct {
+	opened  chan Conn
+	pending map[int][]byte
+}
+
+func (h *echoHandler) Open(conn Conn) error {
+	h.opened <- conn
+	return nil
+}
+
+func (h *echoHandler) Read(conn Conn) error {
+	data, err := conn.Read()
+	if err != nil {
+		return conn.Close()
+	}
+	h.pending[conn.Fd()] = append(h.pending[conn.Fd()], data...)
+	return h.Writable(conn)
+}
+
+func (h *echoHandler) Writable(conn Conn) error {
+	out := h.pending[conn.Fd()]
+	n, err := conn.Write(out)
+	if err != nil {
+		return conn.Close()
+	}
+	h.pending[conn.Fd()] = out[n:]
+	return conn.(WriteNotifier).SetWriteHandler(n < len(out))
+}
+
+func (h *echoHandler) Closed(conn Conn) {
+	delete(h.pending, conn.Fd())
+	conn.Close()
+}
+
+// startTLSReactor serves the TLS connections of the server configuration with
+// the echo handler.
+func startTLSReactor(t *testing.T, s *RedisServer) (string, *echoHandler) {
+	t.Helper()
+	config, err := s.tlsConfigure()
+	if err != nil {
+		t.Fatalf("tlsConfigure: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	r, err := NewReactor(nil, make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ListenTLS([]net.Listener{ln}, config); err != nil {
+		t.Fatal(err)
+	}
+	h := &echoHandler{opened: make(chan Conn, 1), pending: make(map[int][]byte)}
+	r.SetHandler(h)
+	go r.Run()
+	t.Cleanup(func() {
+		r.poll.sendSignal(SignalStop)
+		<-r.done
+	})
+	return ln.Addr().String(), h
+}
+
+func TestTLSConfigure(t *testing.T) {
+	certs := genTestCerts(t, t.TempDir())
+
+	s := &RedisServer{}
+	if _, err := s.tlsConfigure(); err == nil {
+		t.Errorf("configured without a certificate")
+	}
+	s.tlsCertFile, s.tlsKeyFile = certs.serverCert, certs.serverKey
+	s.tlsAuthClients = TLSClientAuthYes
+	if _, err := s.tlsConfigure(); err == nil {
+		t.Errorf("authenticating the clients without a CA")
+	}
+
+	s.tlsCaCertFile = certs.caCert
+	s.tlsAuthClients = TLSClientAuthOptional
+	s.tlsProtocols = "TLSv1.3"
+	s.tlsCiphers = "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"
+	config, err := s.tlsConfigure()
+	if err != nil {
+		t.Fatalf("tlsConfigure: %v", err)
+	}
+	if config.ClientAuth != tls.VerifyClientCertIfGiven || config.ClientCAs == nil {
+		t.Errorf("client auth %v", config.ClientAuth)
+	}
+	if config.MinVersion != tls.VersionTLS13 || config.MaxVersion != tls.VersionTLS13 {
+		t.Errorf("versions %x-%x", config.MinVersion, config.MaxVersion)
+	}
+	if len(config.CipherSuites) != 1 || config.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("cipher suites %v", config.CipherSuites)
+	}
+
+	s.tlsProtocols = "TLSv1.2 SSLv3"
+	if _, err := s.tlsConfigure(); err == nil {
+		t.Errorf("configured an unknown protocol")
+	}
+	s.tlsProtocols = ""
+	s.tlsCiphers = "RC4"
+	if _, err := s.tlsConfigure(); err == nil {
+		t.Errorf("configured an unknown cipher")
+	}
+}
+
+func TestReactorTLS(t *testing.T) {
+	certs := genTestCerts(t, t.TempDir())
+	addr, h := startTLSReactor(t, &RedisServer{
+		tlsCertFile:    certs.serverCert,
+		tlsKeyFile:     certs.serverKey,
+		tlsCaCertFile:  certs.caCert,
+		tlsAuthClients: TLSClientAuthYes,
+	})
+
+	caPEM, _ := os.ReadFile(certs.caCert)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	clientCert, err := tls.LoadX509KeyPair(certs.clientCert, certs.clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	select {
+	case sc := <-h.opened:
+		if _, ok := sc.(*TLSConn); !ok || sc.Ip() != "127.0.0.1" {
+			t.Errorf("the connection is %T from %q", sc, sc.Ip())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the TLS connection was not accepted")
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "PING\r\n" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+
+	// A payload bigger than the socket buffers, the records the socket can't
+	// accept are kept until it is writable.
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1<<18)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(payload)
+		errCh <- err
+	}()
+	echo := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, echo); err != nil {
+		t.Fatalf("read the echo: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !bytes.Equal(echo, payload) {
+		t.Errorf("the echo differs from the payload")
+	}
+
+	// A client without certificate is rejected.
+	conn2, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots})
+	if err == nil {
+		defer conn2.Close()
+		conn2.SetDeadline(time.Now().Add(10 * time.Second))
+		_, err = conn2.Read(make([]byte, 1))
+	}
+	if err == nil {
+		t.Errorf("the client without certificate was accepted")
+	}
+	select {
+	case <-h.opened:
+		t.Errorf("the client without certificate was served")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,436 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fzft/go-mock-redis/db"
+)
+
+/* This file implements client side caching: the server remembers the keys
+ * a client fetched (or, in BCAST mode, the prefixes it is interested in) and
+ * sends invalidation messages when those keys are modified.
+ *
+ * The tracking table maps every key to the ids of the clients that may have
+ * it cached. Once a key is modified its clients are notified and the key is
+ * removed from the table: it is tracked again the next time it is fetched.
+ *
+ * The prefix table maps every prefix tracked in BCAST mode to the clients
+ * subscribed to it, and to the keys modified in the current event loop
+ * iteration, sent to the clients all at once before the next iteration.
+ *
+ * The invalidation messages are sent as RESP3 push messages, or, when the
+ * client redirects them to a RESP2 client, as Pub/Sub messages of the
+ * __redis__:invalidate channel. */
+
+// TrackingChannelName is the Pub/Sub channel the invalidation messages are
+// published to, for the RESP2 clients receiving the redirected messages.
+const TrackingChannelName = "__redis__:invalidate"
+
+// bcastState is the state of a prefix tracked in BCAST mode.
+type bcastState struct {
+	keys    *db.RaxTree[*Client] // Keys modified in the current event loop cycle, and the client that modified them.
+	clients *db.RaxTree[*Client] // Clients subscribed to the notification events for this prefix, by id.
+}
+
+var (
+	trackingTable           *db.RaxTree[*db.RaxTree[struct{}]] // Keys to the ids of the clients that may have cached them.
+	trackingTableTotalItems int                                // Total number of ids in all the tracking table entries.
+	prefixTable             *db.RaxTree[*bcastState]           // Prefixes tracked in BCAST mode.
+)
+
+// disableTracking removes the client from the tracking: its prefixes are
+// removed from the prefix table. The entries of the tracking table are
+// removed lazily, when the keys are invalidated.
+func (c *Client) disableTracking() {
+	if c.flags&ClientTracking == 0 {
+		return
+	}
+	// If this client is in broadcasting mode, we need to unsubscribe it
+	// from all the prefixes it is registered to.
+	if c.flags&ClientTrackingBcast != 0 {
+		c.trackingPrefixes.Range(func(prefix []byte, _ struct{}) bool {
+			if bs, ok := prefixTable.Find(prefix); ok {
+				bs.clients.Delete(clientIdKey(c.id))
+				if bs.clients.Len() == 0 {
+					prefixTable.Delete(prefix)
+				}
+			}
+			return true
+		})
+		c.trackingPrefixes = nil
+	}
+
+	// Clear flags and adjust the count.
+	c.flags &= ^(ClientTracking | ClientTrackingBrokenRedir | ClientTrackingBcast |
+		ClientTrackingOptIn | ClientTrackingOptOut | ClientTrackingCaching | ClientTrackingNoLoop)
+	server.trackingClients--
+}
+
+// stringCheckPrefix reports whether one of the strings is a prefix of the
+// other.
+func stringCheckPrefix(s1, s2 string) bool {
+	if len(s1) > len(s2) {
+		s1, s2 = s2, s1
+	}
+	return strings.HasPrefix(s2, s1)
+}
+
+// checkPrefixCollisionsOrReply checks that the prefixes don't overlap with
+// each other or with the prefixes the client already tracks, replying with
+// an error if they do.
+func (c *Client) checkPrefixCollisionsOrReply(prefixes []string) bool {
+	for i, prefix := range prefixes {
+		// Check input list has no overlap with existing prefixes.
+		if c.trackingPrefixes != nil {
+			collision := ""
+			c.trackingPrefixes.Range(func(key []byte, _ struct{}) bool {
+				if stringCheckPrefix(string(key), prefix) {
+					collision = string(key)
+					return false
+				}
+				return true
+			})
+			if collision != "" {
+				c.addReplyErrorFormat(fmt.Sprintf("Prefix '%s' overlaps with an existing prefix '%s'. Prefixes for a single client must not overlap.", prefix, collision))
+				return false
+			}
+		}
+		// Check input has no overlap with itself.
+		for _, other := range prefixes[i+1:] {
+			if stringCheckPrefix(prefix, other) {
+				c.addReplyErrorFormat(fmt.Sprintf("Prefix '%s' overlaps with another provided prefix '%s'. Prefixes for a single client must not overlap.", prefix, other))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// enableBcastTrackingForPrefix subscribes the client to the invalidation of
+// the keys matching the prefix.
+func (c *Client) enableBcastTrackingForPrefix(prefix string) {
+	bs, ok := prefixTable.Find([]byte(prefix))
+	// If this is the first client subscribing to such prefix, create the
+	// prefix in the table.
+	if !ok {
+		bs = &bcastState{keys: db.NewRaxTree[*Client](), clients: db.NewRaxTree[*Client]()}
+		prefixTable.Insert([]byte(prefix), bs)
+	}
+	if _, ok := bs.clients.Find(clientIdKey(c.id)); !ok {
+		bs.clients.Insert(clientIdKey(c.id), c)
+		if c.trackingPrefixes == nil {
+			c.trackingPrefixes = db.NewRaxTree[struct{}]()
+		}
+		c.trackingPrefixes.Insert([]byte(prefix), struct{}{})
+	}
+}
+
+// enableTracking enables the tracking of the keys fetched by the client. The
+// invalidation messages are sent to the client redirectTo if not zero. In
+// BCAST mode the client tracks the prefixes, or all the keys if there are
+// none.
+func (c *Client) enableTracking(redirectTo uint64, options ClientFlags, prefixes []string) {
+	if c.flags&ClientTracking == 0 {
+		server.trackingClients++
+	}
+	c.flags |= ClientTracking
+	c.flags &= ^(ClientTrackingBrokenRedir | ClientTrackingBcast | ClientTrackingOptIn | ClientTrackingOptOut | ClientTrackingNoLoop)
+	c.trackingRedirection = redirectTo
+
+	if options&ClientTrackingBcast != 0 {
+		c.flags |= ClientTrackingBcast
+		if len(prefixes) == 0 {
+			c.enableBcastTrackingForPrefix("")
+		}
+		for _, prefix := range prefixes {
+			c.enableBcastTrackingForPrefix(prefix)
+		}
+	}
+
+	// Set the remaining flags that don't need any special handling.
+	c.flags |= options & (ClientTrackingOptIn | ClientTrackingOptOut | ClientTrackingNoLoop)
+}
+
+// trackingRememberKeys remembers the keys of the read only command executed
+// by the executing client, so that the tracking client, which is the same
+// client or the caller of the script, is notified when they are modified.
+func trackingRememberKeys(tracking, executing *Client) {
+	// Return if we are in optin/out mode and the right CACHING command
+	// was/wasn't given in order to modify the default behavior.
+	optin := tracking.flags&ClientTrackingOptIn != 0
+	optout := tracking.flags&ClientTrackingOptOut != 0
+	cachingGiven := tracking.flags&ClientTrackingCaching != 0
+	if (optin && !cachingGiven) || (optout && cachingGiven) {
+		return
+	}
+
+	// Shard channels are treated as special keys, they don't need to be
+	// tracked.
+	if executing.cmd.Flags()&CmdPubSub != 0 {
+		return
+	}
+
+	id := clientIdKey(tracking.id)
+	for _, key := range getKeysFromCommand(executing.cmd, executing.argv, executing.argc) {
+		name := []byte(executing.argv[key.pos].Value.(string))
+		ids, ok := trackingTable.Find(name)
+		if !ok {
+			ids = db.NewRaxTree[struct{}]()
+			trackingTable.Insert(name, ids)
+		}
+		if _, ok := ids.Find(id); !ok {
+			ids.Insert(id, struct{}{})
+			trackingTableTotalItems++
+		}
+	}
+}
+
+// sendTrackingMessage sends the invalidation of the keys to the client, or
+// to the client its messages are redirected to. A nil keys invalidates all
+// the keys, after a flush.
+//
+// The messages are RESP3 push messages. A RESP2 client can only receive them
+// through a redirection to a client subscribed to the __redis__:invalidate
+// channel.
+func sendTrackingMessage(c *Client, keys []string) {
+	oldFlags := c.flags
+	c.flags |= ClientPushing
+
+	usingRedirection := false
+	if c.trackingRedirection != 0 {
+		redir := lookupClientByID(c.trackingRedirection)
+		if redir == nil {
+			c.flags |= ClientTrackingBrokenRedir
+			// We need to signal to the original connection that we are
+			// unable to send invalidation messages to the redirected
+			// connection, because the client no longer exist.
+			if c.resp > 2 {
+				c.addReplyPushLen(2)
+				c.addReplyBulkCString("tracking-redir-broken")
+				c.addReplyLongLong(int64(c.trackingRedirection))
+			}
+			if oldFlags&ClientPushing == 0 {
+				c.flags &= ^ClientPushing
+			}
+			return
+		}
+		if oldFlags&ClientPushing == 0 {
+			c.flags &= ^ClientPushing
+		}
+		c = redir
+		usingRedirection = true
+		oldFlags = c.flags
+		c.flags |= ClientPushing
+	}
+
+	// Only send such info for clients in RESP version 3 or more. However if
+	// redirection is active, and the connection we redirect to is in
+	// Pub/Sub mode, we can support the feature with RESP 2 as well, by
+	// sending Pub/Sub messages in the __redis__:invalidate channel.
+	if c.resp > 2 {
+		c.addReplyPushLen(2)
+		c.addReplyBulkCString("invalidate")
+	} else if usingRedirection && c.flags&ClientPubSub != 0 {
+		c.addReplyPubsubHeader(3)
+		c.AddReply(SharedMessageBulk)
+		c.addReplyBulkCString(TrackingChannelName)
+	} else {
+		// If are here, the client is not using RESP3, nor is redirecting to
+		// another client. We can't send anything to it since RESP2 does not
+		// support push messages in the same connection.
+		if oldFlags&ClientPushing == 0 {
+			c.flags &= ^ClientPushing
+		}
+		return
+	}
+
+	// Send the "value" part, which is the array of keys.
+	if keys == nil {
+		c.addReplyNull()
+	} else {
+		c.addReplyArrayLen(len(keys))
+		for _, key := range keys {
+			c.addReplyBulkCString(key)
+		}
+	}
+	if oldFlags&ClientPushing == 0 {
+		c.flags &= ^ClientPushing
+	}
+}
+
+// trackingRememberKeyToBroadcast adds the key to the keys to broadcast of
+// the prefixes matching it, along with the client that modified it.
+func trackingRememberKeyToBroadcast(c *Client, key string) {
+	prefixTable.Range(func(prefix []byte, bs *bcastState) bool {
+		if strings.HasPrefix(key, string(prefix)) {
+			bs.keys.Insert([]byte(key), c)
+		}
+		return true
+	})
+}
+
+// trackingInvalidateKey is called by signalModifiedKey every time the key is
+// modified by the client c, nil if the key is modified by the server. The
+// clients that may have the key cached are notified, and if bcast is true
+// the key is also queued for the prefixes matching it.
+func trackingInvalidateKey(c *Client, key string, bcast bool) {
+	if trackingTable == nil {
+		return
+	}
+	if bcast && prefixTable.Len() > 0 {
+		trackingRememberKeyToBroadcast(c, key)
+	}
+
+	ids, ok := trackingTable.Find([]byte(key))
+	if !ok {
+		return
+	}
+	ids.Range(func(id []byte, _ struct{}) bool {
+		target := lookupClientByID(clientIdFromKey(id))
+		// Note that if the client is in BCAST mode, we don't want to send
+		// invalidation messages that were pending in the case previously
+		// the client was not in BCAST mode. This can happen if TRACKING is
+		// enabled normally, and then the client switches to BCAST mode.
+		if target == nil || target.flags&ClientTracking == 0 || target.flags&ClientTrackingBcast != 0 {
+			return true
+		}
+		// If the client enabled the NOLOOP mode, don't send notifications
+		// about keys changed by the client itself.
+		if target.flags&ClientTrackingNoLoop != 0 && target == server.currentClient {
+			return true
+		}
+		// If target is current client and it's executing a command, we need
+		// schedule key invalidation. As the invalidation messages may be
+		// interleaved with command response and should after command
+		// response.
+		if target == server.currentClient && target.flags&ClientExecutingCommand != 0 {
+			server.trackingPendingKeys = append(server.trackingPendingKeys, []string{key})
+		} else {
+			sendTrackingMessage(target, []string{key})
+		}
+		return true
+	})
+
+	// Free the tracking table: we'll create the radix tree and populate it
+	// again if more keys will be modified in this caching slot.
+	trackingTableTotalItems -= ids.Len()
+	trackingTable.Delete([]byte(key))
+}
+
+// trackingHandlePendingKeyInvalidations sends the invalidations of the keys
+// modified by the current client itself, delayed until its command replied.
+func trackingHandlePendingKeyInvalidations() {
+	if len(server.trackingPendingKeys) == 0 {
+		return
+	}
+	// The current client may have been freed by its own command.
+	if c := server.currentClient; c != nil && c.connection != nil {
+		for _, keys := range server.trackingPendingKeys {
+			sendTrackingMessage(c, keys)
+		}
+	}
+	server.trackingPendingKeys = nil
+}
+
+// trackingInvalidateKeysOnFlush is called when the databases are flushed:
+// all the tracking clients are sent a null invalidation message, meaning
+// that all the keys are invalidated, and the tracking table is reset.
+func trackingInvalidateKeysOnFlush() {
+	if server.trackingClients > 0 {
+		iter := server.clients.NewListIterator(db.DIRECTION_HEAD)
+		for node := iter.NextNode(); node != nil; node = iter.NextNode() {
+			c := node.Value
+			if c.flags&ClientTracking == 0 {
+				continue
+			}
+			if c == server.currentClient {
+				// We use a special nil to indicate that we should send null.
+				server.trackingPendingKeys = append(server.trackingPendingKeys, nil)
+			} else {
+				sendTrackingMessage(c, nil)
+			}
+		}
+	}
+
+	// In case of FLUSHALL, reclaim all the memory used by tracking.
+	if trackingTable != nil {
+		trackingTable = db.NewRaxTree[*db.RaxTree[struct{}]]()
+		trackingTableTotalItems = 0
+	}
+}
+
+// trackingBuildBroadcastReply returns the keys modified for a prefix, but
+// the ones modified by the client c itself if not nil, for NOLOOP clients.
+func trackingBuildBroadcastReply(c *Client, keys *db.RaxTree[*Client]) []string {
+	out := make([]string, 0, keys.Len())
+	keys.Range(func(key []byte, modifier *Client) bool {
+		if c == nil || modifier != c {
+			out = append(out, string(key))
+		}
+		return true
+	})
+	return out
+}
+
+// trackingBroadcastInvalidationMessages sends the keys modified since the
+// last call to the clients tracking their prefixes in BCAST mode, it is
+// called before the event loop waits for new events.
+func trackingBroadcastInvalidationMessages() {
+	if prefixTable == nil || prefixTable.Len() == 0 {
+		return
+	}
+	prefixTable.Range(func(_ []byte, bs *bcastState) bool {
+		if bs.keys.Len() == 0 {
+			return true
+		}
+		// Generate the common protocol for all the clients that are not
+		// using the NOLOOP option.
+		keys := trackingBuildBroadcastReply(nil, bs.keys)
+
+		// Send this array of keys to every client in the list.
+		bs.clients.Range(func(_ []byte, c *Client) bool {
+			if c.flags&ClientTrackingNoLoop != 0 {
+				// This client may have certain keys excluded.
+				if adhoc := trackingBuildBroadcastReply(c, bs.keys); len(adhoc) > 0 {
+					sendTrackingMessage(c, adhoc)
+				}
+			} else {
+				sendTrackingMessage(c, keys)
+			}
+			return true
+		})
+		bs.keys = db.NewRaxTree[*Client]()
+		return true
+	})
+}
+
+// trackingInit creates the tracking and prefix tables.
+func trackingInit() {
+	trackingTable = db.NewRaxTree[*db.RaxTree[struct{}]]()
+	trackingTableTotalItems = 0
+	prefixTable = db.NewRaxTree[*bcastState]()
+}
+
+// trackingGetTotalItems returns the total number of client ids in all the
+// tracking table entries, reported by INFO.
+func trackingGetTotalItems() int {
+	return trackingTableTotalItems
+}
+
+// trackingGetTotalKeys returns the number of keys in the tracking table.
+func trackingGetTotalKeys() int {
+	if trackingTable == nil {
+		return 0
+	}
+	return trackingTable.Len()
+}
+
+// trackingGetTotalPrefixes returns the number of prefixes tracked in BCAST
+// mode.
+func trackingGetTotalPrefixes() int {
+	if prefixTable == nil {
+		return 0
+	}
+	return prefixTable.Len()
+}
@@ -0,0 +1,169 @@
+package node
+
+import (
+	"strconv"
+	"testing"
+)
+
+func invalidatePush(keys ...string) string {
+	s := ">2\r\n$10\r\ninvalidate\r\n*" + strconv.Itoa(len(keys)) + "\r\n"
+	for _, key := range keys {
+		s += bulkString(key)
+	}
+	return s
+}
+
+func TestTrackingDefaultMode(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	c.resp = 3
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	if got := sendCommand(c, conn, "CLIENT", "TRACKING", "ON"); got != "+OK\r\n" {
+		t.Fatalf("CLIENT TRACKING ON replied %q", got)
+	}
+	sendCommand(c, conn, "GET", "track:k")
+
+	conn.Buffer.Reset()
+	if got := sendCommand(other, otherConn, "SET", "track:k", "v"); got != "+OK\r\n" {
+		t.Fatalf("SET replied %q", got)
+	}
+	if got := conn.Buffer.String(); got != invalidatePush("track:k") {
+		t.Fatalf("tracking client received %q", got)
+	}
+
+	// The key is no longer tracked until it is read again.
+	conn.Buffer.Reset()
+	sendCommand(other, otherConn, "SET", "track:k", "v2")
+	if got := conn.Buffer.String(); got != "" {
+		t.Fatalf("tracking client received %q", got)
+	}
+
+	// Modifying a key read by the client itself invalidates it after the
+	// reply, unless NOLOOP is used.
+	sendCommand(c, conn, "GET", "track:k")
+	if got := sendCommand(c, conn, "SET", "track:k", "v3"); got != "+OK\r\n"+invalidatePush("track:k") {
+		t.Fatalf("SET replied %q", got)
+	}
+	sendCommand(c, conn, "CLIENT", "TRACKING", "ON", "NOLOOP")
+	sendCommand(c, conn, "GET", "track:k")
+	if got := sendCommand(c, conn, "SET", "track:k", "v4"); got != "+OK\r\n" {
+		t.Fatalf("SET replied %q with NOLOOP", got)
+	}
+
+	// A flush invalidates everything with a null.
+	conn.Buffer.Reset()
+	sendCommand(other, otherConn, "FLUSHDB")
+	if got := conn.Buffer.String(); got != ">2\r\n$10\r\ninvalidate\r\n_\r\n" {
+		t.Fatalf("tracking client received %q after FLUSHDB", got)
+	}
+
+	if got := sendCommand(c, conn, "CLIENT", "TRACKING", "OFF"); got != "+OK\r\n" || c.flags&ClientTracking != 0 {
+		t.Fatalf("CLIENT TRACKING OFF replied %q", got)
+	}
+}
+
+func TestTrackingRedirect(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	sub, subConn := newTestClient()
+	defer freeClient(sub)
+	subId := strconv.FormatUint(sub.id, 10)
+
+	sendCommand(sub, subConn, "SUBSCRIBE", TrackingChannelName)
+	if got := sendCommand(c, conn, "CLIENT", "TRACKING", "ON", "REDIRECT", subId); got != "+OK\r\n" {
+		t.Fatalf("CLIENT TRACKING ON REDIRECT replied %q", got)
+	}
+	if got := sendCommand(c, conn, "CLIENT", "GETREDIR"); got != ":"+subId+"\r\n" {
+		t.Fatalf("CLIENT GETREDIR replied %q", got)
+	}
+	sendCommand(c, conn, "GET", "redir:k")
+
+	subConn.Buffer.Reset()
+	sendCommand(c, conn, "SET", "redir:k", "v")
+	want := "*3\r\n" + bulkString("message") + bulkString(TrackingChannelName) + "*1\r\n" + bulkString("redir:k")
+	if got := subConn.Buffer.String(); got != want {
+		t.Fatalf("redirect client received %q, want %q", got, want)
+	}
+}
+
+func TestTrackingBcast(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	c.resp = 3
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	if got := sendCommand(c, conn, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "bcast:"); got != "+OK\r\n" {
+		t.Fatalf("CLIENT TRACKING ON BCAST replied %q", got)
+	}
+	sendCommand(other, otherConn, "SET", "bcast:a", "1")
+	sendCommand(other, otherConn, "SET", "other:a", "1")
+
+	conn.Buffer.Reset()
+	trackingBroadcastInvalidationMessages()
+	if got := conn.Buffer.String(); got != invalidatePush("bcast:a") {
+		t.Fatalf("bcast client received %q", got)
+	}
+
+	want := "%3\r\n" + bulkString("flags") + "~2\r\n" + bulkString("on") + bulkString("bcast") +
+		bulkString("redirect") + ":0\r\n" + bulkString("prefixes") + "*1\r\n" + bulkString("bcast:")
+	if got := sendCommand(c, conn, "CLIENT", "TRACKINGINFO"); got != want {
+		t.Fatalf("CLIENT TRACKINGINFO replied %q, want %q", got, want)
+	}
+}
+
+func TestTrackingOptIn(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	c.resp = 3
+	other, otherConn := newTestClient()
+	defer freeClient(other)
+
+	sendCommand(c, conn, "CLIENT", "TRACKING", "ON", "OPTIN")
+	sendCommand(c, conn, "GET", "optin:a")
+	if got := sendCommand(c, conn, "CLIENT", "CACHING", "YES"); got != "+OK\r\n" {
+		t.Fatalf("CLIENT CACHING YES replied %q", got)
+	}
+	sendCommand(c, conn, "GET", "optin:b")
+
+	conn.Buffer.Reset()
+	sendCommand(other, otherConn, "SET", "optin:a", "1")
+	sendCommand(other, otherConn, "SET", "optin:b", "1")
+	if got := conn.Buffer.String(); got != invalidatePush("optin:b") {
+		t.Fatalf("optin client received %q", got)
+	}
+}
+
+func TestTrackingErrors(t *testing.T) {
+	c, conn := newTestClient()
+	defer freeClient(c)
+	defer c.disableTracking()
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "GETREDIR"}, ":-1\r\n"},
+		{[]string{"CLIENT", "CACHING", "YES"}, "-ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled\r\n"},
+		{[]string{"CLIENT", "TRACKING", "MAYBE"}, "-ERR syntax error\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "FOO"}, "-ERR syntax error\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "REDIRECT", "999999"}, "-ERR The client ID you want redirect to does not exist\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "PREFIX", "a"}, "-ERR PREFIX option requires BCAST mode to be enabled\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "BCAST", "OPTIN"}, "-ERR OPTIN and OPTOUT are not compatible with BCAST\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "OPTIN", "OPTOUT"}, "-ERR You can't use both OPTIN and OPTOUT\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "ab", "PREFIX", "abc"}, "-ERR Prefix 'ab' overlaps with another provided prefix 'abc'. Prefixes for a single client must not overlap.\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "OPTOUT"}, "+OK\r\n"},
+		{[]string{"CLIENT", "CACHING", "YES"}, "-ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.\r\n"},
+		{[]string{"CLIENT", "CACHING", "NO"}, "+OK\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "OPTIN"}, "-ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "BCAST"}, "-ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.\r\n"},
+		{[]string{"CLIENT", "GETREDIR"}, ":0\r\n"},
+	}
+	for _, tc := range cases {
+		if got := sendCommand(c, conn, tc.args...); got != tc.want {
+			t.Errorf("%v replied %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
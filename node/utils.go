@@ -1,6 +1,11 @@
 package node
 
-import "strings"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 func mapChars(s, from, to string) string {
 	for i := 0; i < len(from); i++ {
@@ -8,3 +13,180 @@ func mapChars(s, from, to string) string {
 	}
 	return s
 }
+
+// stringMatch glob-style pattern matching, supporting '*', '?', '[...]'
+// character classes with ranges and negation, and '\' escaping.
+func stringMatch(pattern, str string, nocase bool) bool {
+	return stringMatchImpl(pattern, str, nocase, 0)
+}
+
+func stringMatchImpl(pattern, str string, nocase bool, nesting int) bool {
+	// Protection against abusive patterns.
+	if nesting > 1000 {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true // match
+			}
+			for len(str) > 0 {
+				if stringMatchImpl(pattern[1:], str, nocase, nesting+1) {
+					return true // match
+				}
+				str = str[1:]
+			}
+			return false // no match
+		case '?':
+			str = str[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for {
+				if len(pattern) == 0 {
+					break
+				}
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == str[0] {
+						match = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end := pattern[0], pattern[2]
+					c := str[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						match = true
+					}
+				} else {
+					if nocase {
+						if toLower(pattern[0]) == toLower(str[0]) {
+							match = true
+						}
+					} else if pattern[0] == str[0] {
+						match = true
+					}
+				}
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				// [] pattern unterminated, consider the '[' as the last char.
+				return false
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false // no match
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if nocase {
+				if toLower(pattern[0]) != toLower(str[0]) {
+					return false // no match
+				}
+			} else if pattern[0] != str[0] {
+				return false // no match
+			}
+			str = str[1:]
+		}
+		pattern = pattern[1:]
+		if len(str) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+
+	return len(pattern) == 0 && len(str) == 0
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// memtoll converts a memory amount like "1gb" into bytes, the units are case
+// insensitive: b, k, kb, m, mb, g, gb. The k, m and g units are powers of
+// 1000, while kb, mb and gb are powers of 1024. It returns false if the
+// amount can't be parsed.
+func memtoll(s string) (int64, bool) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	lower := strings.ToLower(s)
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			mul = u.mul
+			break
+		}
+	}
+	val, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || val > math.MaxInt64/mul || val < math.MinInt64/mul {
+		return 0, false
+	}
+	return val * mul, true
+}
+
+// catRepr appends to b the escaped representation of s, between quotes: all
+// the non printable characters are escaped with "\n", "\r", "\t", "\a",
+// "\b" or "\x<hex-number>", like sdscatrepr.
+func catRepr(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for j := 0; j < len(s); j++ {
+		switch ch := s[j]; ch {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\a':
+			b.WriteString("\\a")
+		case '\b':
+			b.WriteString("\\b")
+		default:
+			if ch >= 0x20 && ch <= 0x7e {
+				b.WriteByte(ch)
+			} else {
+				fmt.Fprintf(b, "\\x%02x", ch)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
@@ -4,8 +4,10 @@
 package node
 
 import (
+	"errors"
+	"fmt"
+
 	"golang.org/x/sys/unix"
-	"strings"
 )
 
 func isFDValid(fd int) bool {
@@ -20,8 +22,19 @@ func isFDValid(fd int) bool {
 
 // IsTemporaryError checks if the error is temporary, e.g., EAGAIN or EWOULDBLOCK.
 func IsTemporaryError(err error) bool {
-	// This may need more sophisticated checking depending on error format.
-	return strings.Contains(err.Error(), "EAGAIN") || strings.Contains(err.Error(), "EWOULDBLOCK")
+	return errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EWOULDBLOCK)
+}
+
+// isAddrNotAvailable checks if the listen error is due to the address, or
+// its family, not being available on this host.
+func isAddrNotAvailable(err error) bool {
+	for _, errno := range []unix.Errno{unix.EADDRNOTAVAIL, unix.EAFNOSUPPORT, unix.EPROTONOSUPPORT,
+		unix.ESOCKTNOSUPPORT, unix.EPFNOSUPPORT, unix.ENOPROTOOPT} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
 }
 
 func CloseFd(fd int) error {
@@ -32,3 +45,63 @@ func CloseFd(fd int) error {
 	}
 	return nil
 }
+
+// keepAlive enables SO_KEEPALIVE on the socket, the peer is probed after
+// interval seconds of inactivity, then every interval/3 seconds, and the
+// connection is closed after 3 unanswered probes.
+func keepAlive(fd int, interval int) error {
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1); err != nil {
+		return err
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, interval); err != nil {
+		return err
+	}
+	probe := interval / 3
+	if probe == 0 {
+		probe = 1
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, probe); err != nil {
+		return err
+	}
+	return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, 3)
+}
+
+// Targets of rusageTimes
+const (
+	RusageSelf     = unix.RUSAGE_SELF
+	RusageChildren = unix.RUSAGE_CHILDREN
+	RusageThread   = unix.RUSAGE_THREAD
+)
+
+// rusageTimes returns the system and user CPU time used by the target, in
+// seconds with microseconds precision.
+func rusageTimes(who int) (sys, user string) {
+	var ru unix.Rusage
+	if err := unix.Getrusage(who, &ru); err != nil {
+		return "0.000000", "0.000000"
+	}
+	sys = fmt.Sprintf("%d.%06d", ru.Stime.Sec, ru.Stime.Usec)
+	user = fmt.Sprintf("%d.%06d", ru.Utime.Sec, ru.Utime.Usec)
+	return sys, user
+}
+
+// unameString returns the name, release and machine of the operating
+// system, as in "Linux 5.15.0 x86_64".
+func unameString() string {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s %s %s", unix.ByteSliceToString(u.Sysname[:]),
+		unix.ByteSliceToString(u.Release[:]), unix.ByteSliceToString(u.Machine[:]))
+}
+
+// totalSystemMemory returns the physical memory of the system in bytes, 0
+// if unknown.
+func totalSystemMemory() int64 {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return int64(info.Totalram) * int64(info.Unit)
+}
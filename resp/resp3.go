@@ -67,12 +67,24 @@ type Attribute struct {
 	Value Node
 }
 
+// Parse parses the first RESP value of data, it returns the value and the
+// data that follows it. The RESP2 null bulk and null array are parsed as Null.
+func Parse(data []byte) (Node, []byte) {
+	return parseRESP(data)
+}
+
 func parseRESP(data []byte) (Node, []byte) {
+	if len(data) == 0 {
+		return nil, data
+	}
 	switch data[0] {
 	case TypeArray: // Array
 		parts := bytes.SplitN(data, []byte(CRLF), 2)
 		count, _ := strconv.Atoi(string(parts[0][1:]))
 		remaining := parts[1]
+		if count < 0 {
+			return Null{}, remaining
+		}
 
 		array := Array{Elements: make([]Node, count)}
 		for i := 0; i < count; i++ {
@@ -83,6 +95,9 @@ func parseRESP(data []byte) (Node, []byte) {
 	case TypeBlob: // Bulk string
 		parts := bytes.SplitN(data, []byte(CRLF), 2)
 		length, _ := strconv.Atoi(string(parts[0][1:]))
+		if length < 0 {
+			return Null{}, parts[1]
+		}
 		end := length + 2 // Add 2 for trailing \r\n
 		return BlobString{Value: string(parts[1][:length])}, parts[1][end:]
 
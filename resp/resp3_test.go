@@ -209,3 +209,11 @@ func TestConvertToRESPZAddMultiple(t *testing.T) {
 //	}
 //	assert.Equal(t, expected, node)
 //}
+
+func TestParseRESP2Null(t *testing.T) {
+	node, remaining := Parse([]byte("$-1\r\n*-1\r\n"))
+	assert.Equal(t, Null{}, node)
+	node, remaining = Parse(remaining)
+	assert.Equal(t, Null{}, node)
+	assert.Empty(t, remaining)
+}